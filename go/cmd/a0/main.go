@@ -3,26 +3,39 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/bench"
 	"github.com/thomasrohde/agent0/go/pkg/capabilities"
 	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
 	"github.com/thomasrohde/agent0/go/pkg/formatter"
 	"github.com/thomasrohde/agent0/go/pkg/help"
+	"github.com/thomasrohde/agent0/go/pkg/manifest"
+	"github.com/thomasrohde/agent0/go/pkg/output"
 	"github.com/thomasrohde/agent0/go/pkg/runtime"
+	"github.com/thomasrohde/agent0/go/pkg/stdlib"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+	"github.com/thomasrohde/agent0/go/pkg/trace"
 )
 
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintln(os.Stderr, "usage: a0 <command> [options]")
-		fmt.Fprintln(os.Stderr, "commands: run, check, fmt, trace, help, policy")
+		fmt.Fprintln(os.Stderr, "commands: run, test, check, fmt, doc, trace, evidence, help, policy, plan, tools, bench, hash, verify, explain")
 		os.Exit(1)
 	}
 
@@ -30,16 +43,34 @@ func main() {
 	switch cmd {
 	case "run":
 		os.Exit(cmdRun(os.Args[2:]))
+	case "test":
+		os.Exit(cmdTest(os.Args[2:]))
 	case "check":
 		os.Exit(cmdCheck(os.Args[2:]))
 	case "fmt":
 		os.Exit(cmdFmt(os.Args[2:]))
+	case "doc":
+		os.Exit(cmdDoc(os.Args[2:]))
 	case "trace":
 		os.Exit(cmdTrace(os.Args[2:]))
+	case "evidence":
+		os.Exit(cmdEvidence(os.Args[2:]))
 	case "help", "--help", "-h":
 		os.Exit(cmdHelp(os.Args[2:]))
 	case "policy":
 		os.Exit(cmdPolicy(os.Args[2:]))
+	case "plan":
+		os.Exit(cmdPlan(os.Args[2:]))
+	case "tools":
+		os.Exit(cmdTools(os.Args[2:]))
+	case "bench":
+		os.Exit(cmdBench(os.Args[2:]))
+	case "hash":
+		os.Exit(cmdHash(os.Args[2:]))
+	case "verify":
+		os.Exit(cmdVerify(os.Args[2:]))
+	case "explain":
+		os.Exit(cmdExplain(os.Args[2:]))
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
 		os.Exit(1)
@@ -47,17 +78,127 @@ func main() {
 }
 
 func cmdRun(args []string) int {
-	var file string
+	var files []string
 	pretty := false
 	unsafeAllowAll := false
 	evidencePath := ""
+	evidenceAppend := false
+	workdir := ""
+	keepTemp := false
+	httpCache := ""
 	debugParse := false
-	traceEnabled := false
+	tracePath := ""
+	traceValues := false
+	verbose := false
+	strict := ""
+	parallel := 1
+	sharedBudget := ""
+	runID := ""
+	strictBool := false
+	batch := false
+	requireSigned := false
+	profile := ""
+	overlayDir := ""
+	applyDir := ""
+	fileDiffs := false
+	var numberFormat evaluator.NumberFormat
+	stableJSON := false
+	fullOutput := false
+	maxOutput := 0
+	outputFile := ""
+	selectPath := ""
+	hasSelect := false
+	maxDiags := 0
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
+		case "--max-diagnostics":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "--max-diagnostics must be a positive integer, got '%s'\n", args[i])
+					return 1
+				}
+				maxDiags = n
+			}
+		case "--select":
+			if i+1 < len(args) {
+				i++
+				selectPath, hasSelect = args[i], true
+			}
+		case "--full-output":
+			fullOutput = true
+		case "--output-file":
+			if i+1 < len(args) {
+				i++
+				outputFile = args[i]
+			}
+		case "--max-output":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "--max-output must be a positive number of bytes, got '%s'\n", args[i])
+					return 1
+				}
+				maxOutput = n
+			}
+		case "--float-digits", "--float-exp":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "%s must be a positive integer, got '%s'\n", args[i-1], args[i])
+					return 1
+				}
+				if args[i-1] == "--float-digits" {
+					numberFormat.Digits = min(n, 17)
+				} else {
+					numberFormat.ExpThreshold = n
+				}
+			}
+		case "--float-point":
+			numberFormat.FloatPoint = true
+		case "--stable-json":
+			stableJSON = true
 		case "--pretty":
 			pretty = true
+		case "--strict", "--strict=error":
+			strict = "error"
+		case "--strict=warn":
+			strict = "warn"
+		case "--strict-bool":
+			strictBool = true
+		case "--require-signed-policy":
+			requireSigned = true
+		case "--profile":
+			if i+1 < len(args) {
+				i++
+				profile = args[i]
+			}
+		case "--batch":
+			batch = true
+		case "--parallel":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "--parallel must be a positive integer, got '%s'\n", args[i])
+					return 1
+				}
+				parallel = n
+			}
+		case "--shared-budget":
+			if i+1 < len(args) {
+				i++
+				sharedBudget = args[i]
+			}
+		case "--run-id":
+			if i+1 < len(args) {
+				i++
+				runID = args[i]
+			}
 		case "--unsafe-allow-all":
 			unsafeAllowAll = true
 		case "--evidence":
@@ -65,44 +206,233 @@ func cmdRun(args []string) int {
 				i++
 				evidencePath = args[i]
 			}
+		case "--evidence-append":
+			evidenceAppend = true
+		case "--workdir":
+			if i+1 < len(args) {
+				i++
+				workdir = args[i]
+			}
+		case "--keep-temp":
+			keepTemp = true
+		case "--overlay":
+			if i+1 < len(args) {
+				i++
+				overlayDir = args[i]
+			}
+		case "--diff":
+			fileDiffs = true
+		case "--apply":
+			if i+1 < len(args) {
+				i++
+				applyDir = args[i]
+			}
+		case "--http-cache":
+			if i+1 < len(args) {
+				i++
+				httpCache = args[i]
+			}
 		case "--debug-parse":
 			debugParse = true
 		case "--trace":
-			traceEnabled = true
+			if i+1 < len(args) {
+				i++
+				tracePath = args[i]
+			}
+		case "--trace-values":
+			traceValues = true
+		case "--verbose":
+			verbose = true
 		default:
 			if !strings.HasPrefix(args[i], "-") {
-				file = args[i]
+				files = append(files, args[i])
 			}
 		}
 	}
 
-	if file == "" {
-		fmt.Fprintln(os.Stderr, "usage: a0 run <file> [--pretty] [--unsafe-allow-all] [--evidence <path>]")
+	man, code := loadManifest()
+	if code != 0 {
+		return code
+	}
+	if man != nil {
+		if len(files) == 0 && man.Entry != "" {
+			files = []string{man.Path(man.Entry)}
+		}
+		pretty = pretty || man.Run.Pretty
+		if evidencePath == "" {
+			evidencePath = man.Path(man.Run.Evidence)
+		}
+		evidenceAppend = evidenceAppend || man.Run.EvidenceAppend
+		if tracePath == "" {
+			tracePath = man.Path(man.Run.Trace)
+		}
+		if maxOutput == 0 {
+			maxOutput = man.Run.MaxOutput
+		}
+	}
+	if maxOutput == 0 {
+		maxOutput = output.DefaultMaxOutput
+	}
+
+	if applyDir != "" {
+		return applyOverlay(applyDir, pretty)
+	}
+	if len(files) == 0 && !batch {
+		fmt.Fprintln(os.Stderr, "usage: a0 run [file...] [--pretty] [--unsafe-allow-all] [--evidence <path>] [--evidence-append] [--workdir <dir>] [--overlay <dir>] [--diff] [--keep-temp] [--http-cache <dir>] [--trace <path>] [--verbose] [--strict[=warn]] [--strict-bool] [--require-signed-policy] [--profile <name>] [--parallel <n>] [--shared-budget <json>] [--run-id <id>] [--float-digits <n>] [--float-exp <n>] [--float-point] [--stable-json] [--max-output <bytes>] [--full-output] [--output-file <path>] [--select <path>] [--max-diagnostics <n>]")
+		fmt.Fprintln(os.Stderr, "       a0 run --batch [--parallel <n>]  (JSON requests on stdin, one response per line)")
+		fmt.Fprintln(os.Stderr, "       a0 run --apply <dir>             (copy an --overlay directory's changes into the tree)")
+		fmt.Fprintln(os.Stderr, "file defaults to the \"entry\" of a0.json")
 		return 1
 	}
 
-	source, filename, exitCode := readSource(file, pretty)
-	if exitCode != 0 {
-		return exitCode
+	// Check --select before running, so a typo does not look like a null
+	// result after the program's effects have happened.
+	if hasSelect {
+		if err := stdlib.CheckSelectPath(selectPath); err != nil {
+			diag := diagnostics.MakeDiag(diagnostics.EPath, fmt.Sprintf("invalid --select: %s", err), nil, "join keys with '.' and index lists with [n] or [], as in .items[0].name")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+			return 2
+		}
 	}
 
 	_ = debugParse
-	_ = traceEnabled
 
 	// Build runtime
 	var opts []runtime.Option
 	if unsafeAllowAll {
 		opts = append(opts, runtime.WithUnsafeAllowAll())
+	} else {
+		policy, code := loadPolicy(capabilities.LoadOptions{RequireSigned: requireSigned, Profile: profile}, pretty)
+		if code != 0 {
+			return code
+		}
+		opts = append(opts, runtime.WithPolicy(policy))
+	}
+	if strict != "" {
+		opts = append(opts, runtime.WithStrict(strict == "warn"))
+	}
+	if strictBool {
+		opts = append(opts, runtime.WithStrictBool())
+	}
+	if man != nil && man.ImportRoot != "" {
+		opts = append(opts, runtime.WithImportRoot(man.Path(man.ImportRoot)))
+	}
+	if workdir != "" {
+		if info, err := os.Stat(workdir); err != nil || !info.IsDir() {
+			diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("workdir '%s' is not a directory", workdir), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+			return 4
+		}
+		opts = append(opts, runtime.WithWorkdir(workdir))
+	}
+	if keepTemp {
+		opts = append(opts, runtime.WithKeepTempOnFailure())
+	}
+	if httpCache != "" {
+		opts = append(opts, runtime.WithHTTPCache(httpCache))
+	}
+	if fileDiffs {
+		opts = append(opts, runtime.WithFileDiffs())
+	}
+	if overlayDir != "" {
+		root := workdir
+		if root == "" {
+			root, _ = os.Getwd()
+		}
+		ov, err := tools.OpenOverlay(root, overlayDir)
+		if err != nil {
+			diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot open overlay: %s", err), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+			return 4
+		}
+		opts = append(opts, runtime.WithOverlay(ov))
+		defer printOverlayChanges(ov)
+	}
+	var shared *evaluator.SharedBudget
+	if sharedBudget != "" {
+		limits, err := parseBudgetFlag(sharedBudget)
+		if err != nil {
+			diag := diagnostics.MakeDiag(diagnostics.EBudget, fmt.Sprintf("invalid --shared-budget: %s", err), nil,
+				`e.g. --shared-budget '{ "maxToolCalls": 20, "timeMs": 60000 }'`)
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+			return 1
+		}
+		shared = evaluator.NewSharedBudget(limits)
+		opts = append(opts, runtime.WithSharedBudget(shared))
+	}
+	var sinks []evaluator.TraceSink
+	if tracePath != "" {
+		traceSink, err := evaluator.NewNDJSONFileSink(tracePath)
+		if err != nil {
+			diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot create trace file: %s", err), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+			return 4
+		}
+		defer traceSink.Close()
+		sinks = append(sinks, traceSink)
+		if traceValues {
+			opts = append(opts, runtime.WithTraceValues())
+		}
+	}
+	if verbose {
+		sinks = append(sinks, output.NewVerboseLog(os.Stderr))
+	}
+	switch len(sinks) {
+	case 1:
+		opts = append(opts, runtime.WithTrace(sinks[0]))
+	case 2:
+		opts = append(opts, runtime.WithTrace(evaluator.NewMultiSink(sinks...)))
+	}
+
+	opts = append(opts, runtime.WithLogWriter(os.Stderr, pretty))
+	if numberFormat != (evaluator.NumberFormat{}) {
+		opts = append(opts, runtime.WithNumberFormat(numberFormat))
+	}
+	if stableJSON {
+		opts = append(opts, runtime.WithStableJSON())
+	}
+
+	if batch {
+		return runBatch(os.Stdin, os.Stdout, opts, parallel)
+	}
+	if len(files) > 1 {
+		return runMany(files, opts, runID, parallel, shared, evidencePath, evidenceAppend, pretty)
+	}
+	if runID != "" {
+		opts = append(opts, runtime.WithRunID(runID))
+	}
+
+	source, filename, exitCode := readSource(files[0], pretty)
+	if exitCode != 0 {
+		return exitCode
 	}
 	rt := runtime.New(opts...)
 
 	// Execute
 	ctx := context.Background()
+	started := time.Now()
 	result, execErr := rt.Run(ctx, source, filename)
+	meta := runMeta(started)
+	meta.Program = filename
+	meta.ProgramSHA256 = runtime.ProgramSHA256(source, nil)
+	if result != nil {
+		meta.ProgramMeta = result.Meta
+		meta.ProgramSHA256 = result.ProgramSHA256
+	}
+
+	if result != nil && len(result.Warnings) > 0 {
+		printDiagnostics(result.Warnings, pretty, maxDiags)
+	}
+	if result != nil && result.KeptTempDir != "" {
+		fmt.Fprintf(os.Stderr, "temp files kept in %s\n", result.KeptTempDir)
+	}
+	if result != nil && (pretty || fileDiffs) {
+		printFilesChanged(os.Stderr, result.FilesChanged)
+	}
 
 	if execErr != nil {
 		if diagErr, ok := execErr.(*runtime.DiagnosticError); ok {
-			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(diagErr.Diagnostics, pretty))
+			printDiagnostics(diagErr.Diagnostics, pretty, maxDiags)
 			return 2
 		}
 		if rtErr, ok := execErr.(*evaluator.A0RuntimeError); ok {
@@ -110,11 +440,16 @@ func cmdRun(args []string) int {
 			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
 
 			// Write evidence if available
+			exitCode := exitCodeForDiag(rtErr.Code)
 			if result != nil && len(result.Evidence) > 0 && evidencePath != "" {
-				writeEvidence(evidencePath, result.Evidence)
+				meta.RunID, meta.ExitCode = result.RunID, exitCode
+				writeEvidence(evidencePath, evidenceAppend, meta, result.Evidence)
+			}
+			if result != nil {
+				printFailedEvidence(os.Stderr, result.Evidence)
 			}
 
-			return exitCodeForDiag(rtErr.Code)
+			return exitCode
 		}
 		fmt.Fprintln(os.Stderr, execErr.Error())
 		return 4
@@ -122,23 +457,48 @@ func cmdRun(args []string) int {
 
 	// Write evidence if requested
 	if result != nil && len(result.Evidence) > 0 && evidencePath != "" {
-		writeEvidence(evidencePath, result.Evidence)
+		meta.RunID, meta.ExitCode = result.RunID, 0
+		for _, ev := range result.Evidence {
+			if !ev.OK {
+				meta.ExitCode = 5
+			}
+		}
+		writeEvidence(evidencePath, evidenceAppend, meta, result.Evidence)
 	}
 
 	// Output value
 	if result != nil && result.Value != nil {
-		jsonBytes, err := evaluator.ValueToJSON(result.Value)
+		if hasSelect {
+			result.Value, _ = stdlib.Select(result.Value, selectPath) // checked above
+		}
+		jsonBytes, err := result.ValueJSON()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error serializing result: %s\n", err)
 			return 4
 		}
-		fmt.Println(string(jsonBytes))
+		if outputFile != "" {
+			if err := output.WriteFileAtomic(outputFile, append(jsonBytes, '\n')); err != nil {
+				diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot write output file: %s", err), nil, "")
+				fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+				return 4
+			}
+			if pretty {
+				fmt.Printf("result written to %s (%s)\n", outputFile, output.FormatSize(len(jsonBytes)+1))
+			}
+		} else {
+			limit := maxOutput
+			if !pretty || fullOutput {
+				limit = 0
+			}
+			output.WriteResult(os.Stdout, result.Value, jsonBytes, limit)
+		}
 	}
 
 	// Check if any evidence failed
 	if result != nil {
 		for _, ev := range result.Evidence {
 			if !ev.OK {
+				printFailedEvidence(os.Stderr, result.Evidence)
 				return 5
 			}
 		}
@@ -147,200 +507,1770 @@ func cmdRun(args []string) int {
 	return 0
 }
 
-func cmdCheck(args []string) int {
-	var file string
+// cmdTest runs programs for their evidence, comparing expect.snapshot values
+// against __snapshots__/ (rewriting them with --update).
+func cmdTest(args []string) int {
+	var files []string
 	pretty := false
-	debugParse := false
+	unsafeAllowAll := false
+	update := false
+	parallel := 1
+	requireSigned := false
+	profile := ""
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
 		case "--pretty":
 			pretty = true
-		case "--debug-parse":
-			debugParse = true
+		case "--update", "-u":
+			update = true
+		case "--require-signed-policy":
+			requireSigned = true
+		case "--profile":
+			if i+1 < len(args) {
+				i++
+				profile = args[i]
+			}
+		case "--unsafe-allow-all":
+			unsafeAllowAll = true
+		case "--parallel":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "--parallel must be a positive integer, got '%s'\n", args[i])
+					return 1
+				}
+				parallel = n
+			}
 		default:
 			if !strings.HasPrefix(args[i], "-") {
-				file = args[i]
+				files = append(files, args[i])
 			}
 		}
 	}
 
-	if file == "" {
-		fmt.Fprintln(os.Stderr, "usage: a0 check <file> [--pretty]")
-		return 1
+	man, code := loadManifest()
+	if code != 0 {
+		return code
 	}
-
-	_ = debugParse
-
-	source, filename, exitCode := readSource(file, pretty)
-	if exitCode != 0 {
-		return exitCode
+	if man != nil {
+		if len(files) == 0 && man.Entry != "" {
+			files = []string{man.Path(man.Entry)}
+		}
+		pretty = pretty || man.Run.Pretty
 	}
-
-	rt := runtime.New()
-	diags := rt.Check(source, filename)
-	if len(diags) > 0 {
-		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(diags, pretty))
-		return 2
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: a0 test [file...] [--update] [--pretty] [--unsafe-allow-all] [--require-signed-policy] [--profile <name>] [--parallel <n>]")
+		fmt.Fprintln(os.Stderr, "file defaults to the \"entry\" of a0.json")
+		return 1
 	}
 
-	// Valid program
-	if pretty {
-		fmt.Println("No errors found.")
+	var opts []runtime.Option
+	if unsafeAllowAll {
+		opts = append(opts, runtime.WithUnsafeAllowAll())
 	} else {
-		fmt.Println("[]")
+		policy, code := loadPolicy(capabilities.LoadOptions{RequireSigned: requireSigned, Profile: profile}, pretty)
+		if code != 0 {
+			return code
+		}
+		opts = append(opts, runtime.WithPolicy(policy))
 	}
-	return 0
+	if man != nil && man.ImportRoot != "" {
+		opts = append(opts, runtime.WithImportRoot(man.Path(man.ImportRoot)))
+	}
+	if update {
+		opts = append(opts, runtime.WithSnapshotUpdate())
+	}
+	return runMany(files, opts, "", parallel, nil, "", false, pretty)
 }
 
-func cmdFmt(args []string) int {
-	var file string
-	write := false
+// RunReport is the combined JSON report of a multi-file `a0 run`.
+type RunReport struct {
+	Files      []FileResult `json:"files"`
+	Total      int          `json:"total"`
+	Passed     int          `json:"passed"`
+	Failed     int          `json:"failed"`
+	DurationMs float64      `json:"durationMs"`
 
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--write":
-			write = true
-		default:
-			if !strings.HasPrefix(args[i], "-") {
-				file = args[i]
+	// SharedBudgetUsed reports the combined usage when --shared-budget is set.
+	SharedBudgetUsed *evaluator.BudgetTracker `json:"sharedBudgetUsed,omitempty"`
+}
+
+// FileResult is one program's entry in a RunReport.
+type FileResult struct {
+	File           string                   `json:"file"`
+	RunID          string                   `json:"runId"`
+	ExitCode       int                      `json:"exitCode"`
+	Value          json.RawMessage          `json:"value,omitempty"`
+	EvidenceTotal  int                      `json:"evidenceTotal"`
+	EvidenceFailed int                      `json:"evidenceFailed"`
+	Diagnostics    []diagnostics.Diagnostic `json:"diagnostics,omitempty"`
+	DurationMs     float64                  `json:"durationMs"`
+	FilesChanged   []tools.FileChange       `json:"filesChanged,omitempty"`
+	ProgramSHA256  string                   `json:"programSha256,omitempty"`
+	evidence       []evaluator.Evidence
+}
+
+// runMany runs several programs, at most parallel at a time, prints a
+// per-file table to stderr and the combined report to stdout. The exit code
+// is that of the first failing file in argument order.
+//
+// Each file gets its own run ID: runID-<n> when runID is set, else a fresh
+// ULID.
+func runMany(files []string, opts []runtime.Option, runID string, parallel int, shared *evaluator.SharedBudget, evidencePath string, evidenceAppend, pretty bool) int {
+	start := time.Now()
+	results := make([]FileResult, len(files))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			id := runtime.NewRunID()
+			if runID != "" {
+				id = fmt.Sprintf("%s-%d", runID, i+1)
+			}
+			fileOpts := append(append([]runtime.Option{}, opts...), runtime.WithRunID(id))
+			results[i] = runFile(runtime.New(fileOpts...), file)
+			results[i].RunID = id
+		}(i, file)
+	}
+	wg.Wait()
+
+	report := RunReport{Files: results, Total: len(results), DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+	var evidence []evaluator.Evidence
+	exitCode := 0
+	for _, r := range results {
+		if r.ExitCode == 0 {
+			report.Passed++
+		} else {
+			report.Failed++
+			if exitCode == 0 {
+				exitCode = r.ExitCode
 			}
 		}
+		evidence = append(evidence, r.evidence...)
+	}
+	if shared != nil {
+		used := shared.Used()
+		report.SharedBudgetUsed = &used
 	}
 
-	if file == "" {
-		fmt.Fprintln(os.Stderr, "usage: a0 fmt <file> [--write]")
-		return 1
+	printRunTable(os.Stderr, results)
+	for _, r := range results {
+		if len(r.Diagnostics) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%s:\n%s\n", r.File, diagnostics.FormatDiagnostics(r.Diagnostics, pretty))
+		}
+		printFailedEvidence(os.Stderr, r.evidence)
+	}
+	if len(evidence) > 0 && evidencePath != "" {
+		meta := runMeta(start)
+		meta.RunID, meta.ExitCode = runID, exitCode
+		writeEvidence(evidencePath, evidenceAppend, meta, evidence)
 	}
 
-	// Read source
-	sourceBytes, err := os.ReadFile(file)
+	out, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
-		diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
-		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
-		return 1
+		fmt.Fprintf(os.Stderr, "error serializing report: %s\n", err)
+		return 4
 	}
-	source := string(sourceBytes)
+	fmt.Println(string(out))
+	return exitCode
+}
 
-	rt := runtime.New()
-	formatted, fmtErr := rt.Format(source, file)
-	if fmtErr != nil {
-		if diagErr, ok := fmtErr.(*runtime.DiagnosticError); ok {
-			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(diagErr.Diagnostics, false))
-			return 2
+// runFile executes one program of a multi-file run, mapping the outcome to
+// the exit code a single-file `a0 run` would have returned.
+func runFile(rt *runtime.Runtime, file string) FileResult {
+	start := time.Now()
+	res := FileResult{File: file}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		res.ExitCode = 1
+		res.Diagnostics = []diagnostics.Diagnostic{
+			diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, ""),
 		}
-		fmt.Fprintln(os.Stderr, fmtErr.Error())
-		return 2
+		res.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		return res
 	}
 
-	// Warn about comments
-	if formatter.HasComments(source) {
-		fmt.Fprintln(os.Stderr, "warning: comments are not preserved by the formatter")
+	result, execErr := rt.Run(context.Background(), string(source), file)
+	collectResult(&res, result, execErr)
+	res.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return res
+}
+
+// collectResult fills res from a finished run, mapping the outcome to the
+// exit code a single-file `a0 run` would have returned.
+func collectResult(res *FileResult, result *runtime.Result, execErr error) {
+	if result != nil {
+		res.ProgramSHA256 = result.ProgramSHA256
+		res.Diagnostics = append(res.Diagnostics, result.Warnings...)
+		res.FilesChanged = result.FilesChanged
+		res.evidence = result.Evidence
+		res.EvidenceTotal = len(result.Evidence)
+		for _, ev := range result.Evidence {
+			if !ev.OK {
+				res.EvidenceFailed++
+			}
+		}
 	}
 
-	if write {
-		if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
-			fmt.Fprintf(os.Stderr, "error writing file: %s\n", err)
-			return 1
+	switch e := execErr.(type) {
+	case nil:
+		if result != nil && result.Value != nil {
+			if data, err := result.ValueJSON(); err == nil {
+				res.Value = data
+			}
 		}
-	} else {
-		// Output without trailing newline (Format adds one)
-		fmt.Print(formatted)
+		if res.EvidenceFailed > 0 {
+			res.ExitCode = 5
+		}
+	case *runtime.DiagnosticError:
+		res.ExitCode = 2
+		res.Diagnostics = append(res.Diagnostics, e.Diagnostics...)
+	case *evaluator.A0RuntimeError:
+		res.ExitCode = exitCodeForDiag(e.Code)
+		res.Diagnostics = append(res.Diagnostics, diagnostics.MakeDiag(e.Code, e.Message, e.Span, ""))
+	default:
+		res.ExitCode = 4
+		res.Diagnostics = append(res.Diagnostics, diagnostics.MakeDiag(diagnostics.EIO, execErr.Error(), nil, ""))
 	}
+}
 
-	return 0
+// BatchRequest is one line of `a0 run --batch` input: a program given as
+// source or as a file path, plus an optional run.input value. ID is echoed
+// back so callers can match responses to requests.
+type BatchRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Source string          `json:"source,omitempty"`
+	Path   string          `json:"path,omitempty"`
+	Input  json.RawMessage `json:"input,omitempty"`
 }
 
-func cmdTrace(args []string) int {
-	var file string
-	jsonOutput := false
-	textOutput := false
+// BatchResponse is one line of `a0 run --batch` output.
+type BatchResponse struct {
+	ID json.RawMessage `json:"id,omitempty"`
+	FileResult
+	Evidence json.RawMessage `json:"evidence,omitempty"`
+}
 
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--json":
-			jsonOutput = true
-		case "--text":
-			textOutput = true
-		default:
-			if !strings.HasPrefix(args[i], "-") {
-				file = args[i]
-			}
+// runBatch serves `a0 run --batch`: it reads one JSON request per line from
+// in and writes one JSON response per line to out, running at most parallel
+// requests at a time on a shared pool. With parallel > 1 responses are
+// written as runs finish, so callers should match them by id. The exit code
+// is 0 unless reading in fails; per-request failures are reported in the
+// responses.
+func runBatch(in io.Reader, out io.Writer, opts []runtime.Option, parallel int) int {
+	pool := runtime.NewPool(parallel, opts...)
+	var mu sync.Mutex
+	respond := func(resp BatchResponse) {
+		line, err := json.Marshal(resp)
+		if err != nil {
+			line, _ = json.Marshal(BatchResponse{ID: resp.ID, FileResult: FileResult{ExitCode: 4,
+				Diagnostics: []diagnostics.Diagnostic{diagnostics.MakeDiag(diagnostics.EIO, err.Error(), nil, "")}}})
 		}
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(out, string(line))
 	}
 
-	if file == "" {
-		fmt.Fprintln(os.Stderr, "usage: a0 trace <file.jsonl> [--json|--text]")
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var req BatchRequest
+		if err := json.Unmarshal(text, &req); err != nil {
+			respond(batchError(nil, fmt.Sprintf("invalid request: %s", err)))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			respond(runBatchRequest(pool, req))
+		}()
+		if parallel == 1 {
+			wg.Wait()
+		}
+	}
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "error reading stdin: %s\n", err)
 		return 1
 	}
+	return 0
+}
 
-	// Read and parse NDJSON trace file
-	f, err := os.Open(file)
-	if err != nil {
+func runBatchRequest(pool *runtime.Pool, req BatchRequest) BatchResponse {
+	start := time.Now()
+	source, file := req.Source, req.Path
+	switch {
+	case source != "" && file != "":
+		return batchError(req.ID, "give either source or path, not both")
+	case source == "" && file == "":
+		return batchError(req.ID, "missing source or path")
+	case source == "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return BatchResponse{ID: req.ID, FileResult: FileResult{File: file, ExitCode: 1,
+				Diagnostics: []diagnostics.Diagnostic{
+					diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, ""),
+				}}}
+		}
+		source = string(data)
+	default:
+		file = "<batch>"
+	}
+	var input evaluator.A0Value
+	if len(req.Input) > 0 {
+		v, err := evaluator.ParseJSONToValue(req.Input)
+		if err != nil {
+			return batchError(req.ID, fmt.Sprintf("invalid input: %s", err))
+		}
+		input = v
+	}
+
+	resp := BatchResponse{ID: req.ID, FileResult: FileResult{File: file}}
+	result, execErr := pool.RunInput(context.Background(), source, file, input)
+	collectResult(&resp.FileResult, result, execErr)
+	if result != nil {
+		resp.RunID = result.RunID
+		if len(result.Evidence) > 0 {
+			resp.Evidence, _ = evaluator.EvidenceToJSON(result.Evidence)
+		}
+	}
+	resp.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return resp
+}
+
+// batchError is the response to a request that could not be run.
+func batchError(id json.RawMessage, msg string) BatchResponse {
+	return BatchResponse{ID: id, FileResult: FileResult{
+		ExitCode:    1,
+		Diagnostics: []diagnostics.Diagnostic{diagnostics.MakeDiag(diagnostics.EBatch, msg, nil, "")},
+	}}
+}
+
+// printRunTable writes one line per file: exit status, evidence counts,
+// duration and a truncated value.
+func printRunTable(w io.Writer, results []FileResult) {
+	width := len("FILE")
+	for _, r := range results {
+		if len(r.File) > width {
+			width = len(r.File)
+		}
+	}
+	fmt.Fprintf(w, "%-*s  %4s  %-8s  %9s  %s\n", width, "FILE", "EXIT", "EVIDENCE", "TIME", "VALUE")
+	for _, r := range results {
+		value := string(r.Value)
+		if r.ExitCode != 0 && len(r.Diagnostics) > 0 {
+			value = r.Diagnostics[len(r.Diagnostics)-1].Code
+		}
+		if len(value) > 50 {
+			value = value[:47] + "..."
+		}
+		fmt.Fprintf(w, "%-*s  %4d  %-8s  %7.1fms  %s\n", width, r.File, r.ExitCode,
+			fmt.Sprintf("%d/%d", r.EvidenceTotal-r.EvidenceFailed, r.EvidenceTotal), r.DurationMs, value)
+	}
+}
+
+// printFailedEvidence lists failed evidence with its location; snapshot
+// mismatches also show the stored and actual values, and failed eq checks
+// the paths at which the two sides differ.
+func printFailedEvidence(w io.Writer, evidence []evaluator.Evidence) {
+	for _, ev := range evidence {
+		if ev.OK {
+			continue
+		}
+		loc := ""
+		if ev.Span != nil {
+			loc = fmt.Sprintf("%s:%d: ", ev.Span.File, ev.Span.StartLine)
+		}
+		msg := ev.Msg
+		if msg == "" {
+			msg = ev.Kind + " failed"
+		}
+		fmt.Fprintf(w, "\nFAIL %s%s\n", loc, msg)
+		if ev.Details == nil {
+			continue
+		}
+		for _, key := range []string{"expected", "actual"} {
+			if v, ok := ev.Details.Get(key); ok {
+				if s, ok := v.(evaluator.A0String); ok {
+					fmt.Fprintf(w, "  %s:\n    %s\n", key, strings.ReplaceAll(s.Value, "\n", "\n    "))
+				}
+			}
+		}
+		printEqDiff(w, ev.Details)
+	}
+}
+
+// printEqDiff renders the diff recorded for a failed eq check, one line per
+// path: "- path: a" (only in a), "+ path: b" (only in b), "~ path: a -> b".
+func printEqDiff(w io.Writer, details *evaluator.A0Record) {
+	v, ok := details.Get("diff")
+	list, isList := v.(evaluator.A0List)
+	if !ok || !isList {
+		return
+	}
+	fmt.Fprintln(w, "  diff (a -> b):")
+	for _, item := range list.Items {
+		entry, ok := item.(evaluator.A0Record)
+		if !ok {
+			continue
+		}
+		field := func(key string) string {
+			if v, ok := entry.Get(key); ok {
+				if s, ok := v.(evaluator.A0String); ok && key != "a" && key != "b" {
+					return s.Value
+				}
+				return evaluator.ValueToJSONString(v)
+			}
+			return ""
+		}
+		path := field("path")
+		if path == "" {
+			path = "(value)"
+		}
+		switch field("op") {
+		case "added":
+			fmt.Fprintf(w, "    + %s: %s\n", path, field("b"))
+		case "removed":
+			fmt.Fprintf(w, "    - %s: %s\n", path, field("a"))
+		default:
+			fmt.Fprintf(w, "    ~ %s: %s -> %s\n", path, field("a"), field("b"))
+		}
+	}
+	if t, ok := details.Get("truncated"); ok && evaluator.Truthiness(t) {
+		fmt.Fprintln(w, "    ...")
+	}
+}
+
+// parseBudgetFlag reads a --shared-budget JSON object.
+func parseBudgetFlag(s string) (evaluator.Budget, error) {
+	var raw map[string]json.Number
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return evaluator.Budget{}, fmt.Errorf("expected a JSON object of budget limits: %s", err)
+	}
+	var b evaluator.Budget
+	for key, num := range raw {
+		n, err := num.Int64()
+		if err != nil || n < 0 {
+			return evaluator.Budget{}, fmt.Errorf("%s must be a non-negative integer", key)
+		}
+		switch key {
+		case "timeMs":
+			b.TimeMs = &n
+		case "maxToolCalls":
+			b.MaxToolCalls = &n
+		case "maxIterations":
+			b.MaxIterations = &n
+		case "maxBytesWritten":
+			b.MaxBytesWritten = &n
+		case "maxBytesRead":
+			b.MaxBytesRead = &n
+		case "maxMemoryBytes":
+			b.MaxMemoryBytes = &n
+		case "maxBytesSent":
+			b.MaxBytesSent = &n
+		case "maxSteps":
+			b.MaxSteps = &n
+		default:
+			return evaluator.Budget{}, fmt.Errorf("unknown budget field '%s'", key)
+		}
+	}
+	return b, nil
+}
+
+func cmdCheck(args []string) int {
+	var files []string
+	pretty := false
+	debugParse := false
+	strict := ""
+	nullSafety := false
+	jsonLines := false
+	maxDiags := 0
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--pretty":
+			pretty = true
+		case "--max-diagnostics":
+			if i+1 < len(args) {
+				i++
+				n, err := strconv.Atoi(args[i])
+				if err != nil || n < 1 {
+					fmt.Fprintf(os.Stderr, "--max-diagnostics must be a positive integer, got '%s'\n", args[i])
+					return 1
+				}
+				maxDiags = n
+			}
+		case "--strict", "--strict=error":
+			strict = "error"
+		case "--strict=warn":
+			strict = "warn"
+		case "--null-safety":
+			nullSafety = true
+		case "--json-lines":
+			jsonLines = true
+		case "--debug-parse":
+			debugParse = true
+		default:
+			if !strings.HasPrefix(args[i], "-") {
+				files = append(files, args[i])
+			}
+		}
+	}
+
+	man, code := loadManifest()
+	if code != 0 {
+		return code
+	}
+	if man != nil {
+		if len(files) == 0 && man.Entry != "" {
+			files = []string{man.Path(man.Entry)}
+		}
+		pretty = pretty || man.Run.Pretty
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: a0 check [file...] [--pretty] [--json-lines] [--strict[=warn]] [--null-safety] [--max-diagnostics <n>]")
+		fmt.Fprintln(os.Stderr, "file defaults to the \"entry\" of a0.json")
+		return 1
+	}
+
+	_ = debugParse
+
+	var opts []runtime.Option
+	if strict != "" {
+		opts = append(opts, runtime.WithStrict(strict == "warn"))
+	}
+	if nullSafety {
+		opts = append(opts, runtime.WithNullSafety())
+	}
+	if man != nil && man.ImportRoot != "" {
+		opts = append(opts, runtime.WithImportRoot(man.Path(man.ImportRoot)))
+	}
+	if man != nil && len(man.Lint.Disable) > 0 {
+		opts = append(opts, runtime.WithDisabledLints(man.Lint.Disable...))
+	}
+	rt := runtime.New(opts...)
+
+	if jsonLines {
+		return checkJSONLines(rt, files, maxDiags)
+	}
+
+	var diags []diagnostics.Diagnostic
+	for _, file := range files {
+		source, filename, exitCode := readSource(file, pretty)
+		if exitCode != 0 {
+			return exitCode
+		}
+		diags = append(diags, rt.Check(source, filename)...)
+	}
+	if diagnostics.HasErrors(diags) {
+		printDiagnostics(diags, pretty, maxDiags)
+		return 2
+	}
+	if len(diags) > 0 {
+		// Warnings only: report them but keep the program valid
+		printDiagnostics(diags, pretty, maxDiags)
+	}
+
+	// Valid program
+	if pretty {
+		fmt.Println("No errors found.")
+	} else {
+		fmt.Println("[]")
+	}
+	return 0
+}
+
+// printDiagnostics writes diags to stderr with identical ones grouped,
+// showing at most limit of them (all of them when limit is 0).
+func printDiagnostics(diags []diagnostics.Diagnostic, pretty bool, limit int) {
+	shown, omitted := diagnostics.Limit(diagnostics.Group(diags), limit)
+	fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(shown, pretty))
+	printOmitted(os.Stderr, omitted, limit, pretty)
+}
+
+// printOmitted tells how many diagnostics the limit left out, if any: a
+// line of text when pretty, otherwise a JSON record on its own line,
+// {"omitted": n, "maxDiagnostics": limit}, after the diagnostics.
+func printOmitted(w io.Writer, omitted, limit int, pretty bool) {
+	if omitted == 0 {
+		return
+	}
+	if pretty {
+		fmt.Fprintf(w, "\n... %d more not shown (--max-diagnostics %d)\n", omitted, limit)
+		return
+	}
+	b, _ := json.Marshal(struct {
+		Omitted        int `json:"omitted"`
+		MaxDiagnostics int `json:"maxDiagnostics"`
+	}{omitted, limit})
+	fmt.Fprintln(w, string(b))
+}
+
+// checkJSONLines checks files one at a time, writing each diagnostic to
+// stdout as a JSON object on its own line as soon as its file is checked.
+// Nothing is printed for clean files; the exit code is 2 if any file has
+// errors and 1 if any file could not be read. Identical diagnostics of a
+// file are grouped, and at most limit are written across all files (all of
+// them when limit is 0), errors first within each file; a last line
+// counts the ones left out, as printOmitted does.
+func checkJSONLines(rt *runtime.Runtime, files []string, limit int) int {
+	out := bufio.NewWriter(os.Stdout)
+	exit := 0
+	written, omitted := 0, 0
+	for _, file := range files {
+		var diags []diagnostics.Diagnostic
+		source, err := os.ReadFile(file)
+		if err != nil {
+			diags = []diagnostics.Diagnostic{diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")}
+			exit = max(exit, 1)
+		} else {
+			diags = rt.Check(string(source), file)
+		}
+		if diagnostics.HasErrors(diags) {
+			exit = 2
+		}
+		shown := diagnostics.Group(diags)
+		if limit > 0 {
+			if written == limit {
+				omitted += len(shown)
+				shown = nil
+			} else {
+				var left int
+				shown, left = diagnostics.Limit(shown, limit-written)
+				omitted += left
+			}
+		}
+		for _, d := range shown {
+			fmt.Fprintln(out, diagnostics.FormatDiagnostic(d, false))
+		}
+		written += len(shown)
+		out.Flush()
+	}
+	printOmitted(os.Stdout, omitted, limit, false)
+	return exit
+}
+
+func cmdFmt(args []string) int {
+	var file string
+	write := false
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--write":
+			write = true
+		default:
+			if !strings.HasPrefix(args[i], "-") {
+				file = args[i]
+			}
+		}
+	}
+
+	man, code := loadManifest()
+	if code != 0 {
+		return code
+	}
+	if file == "" && man != nil {
+		file = man.Path(man.Entry)
+	}
+
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 fmt [file] [--write]")
+		fmt.Fprintln(os.Stderr, "file defaults to the \"entry\" of a0.json")
+		return 1
+	}
+
+	// Read source
+	sourceBytes, err := os.ReadFile(file)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 1
+	}
+	source := string(sourceBytes)
+
+	var opts []runtime.Option
+	if man != nil {
+		opts = append(opts, runtime.WithFormatOptions(formatter.Options{Indent: man.Fmt.Indent}))
+	}
+	rt := runtime.New(opts...)
+	formatted, fmtErr := rt.Format(source, file)
+	if fmtErr != nil {
+		if diagErr, ok := fmtErr.(*runtime.DiagnosticError); ok {
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(diagErr.Diagnostics, false))
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, fmtErr.Error())
+		return 2
+	}
+
+	// Warn about comments
+	if formatter.HasComments(source) {
+		fmt.Fprintln(os.Stderr, "warning: comments are not preserved by the formatter")
+	}
+
+	if write {
+		if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing file: %s\n", err)
+			return 1
+		}
+	} else {
+		// Output without trailing newline (Format adds one)
+		fmt.Print(formatted)
+	}
+
+	return 0
+}
+
+func cmdDoc(args []string) int {
+	var file string
+	jsonOutput := false
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			jsonOutput = true
+		default:
+			if !strings.HasPrefix(args[i], "-") {
+				file = args[i]
+			}
+		}
+	}
+
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 doc <file> [--json]")
+		return 1
+	}
+
+	sourceBytes, err := os.ReadFile(file)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 1
+	}
+
+	rt := runtime.New()
+	doc, docErr := rt.Doc(string(sourceBytes), file)
+	if docErr != nil {
+		if diagErr, ok := docErr.(*runtime.DiagnosticError); ok {
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(diagErr.Diagnostics, false))
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, docErr.Error())
+		return 2
+	}
+
+	if jsonOutput {
+		b, _ := json.Marshal(doc)
+		fmt.Println(string(b))
+		return 0
+	}
+	fmt.Printf("module %s\n", doc.File)
+	if m := doc.Meta; m != nil {
+		if m.Name != "" {
+			title := m.Name
+			if m.Version != "" {
+				title += " " + m.Version
+			}
+			fmt.Printf("  %s\n", title)
+		}
+		if m.Description != "" {
+			fmt.Printf("  %s\n", m.Description)
+		}
+		if m.Author != "" {
+			fmt.Printf("  author: %s\n", m.Author)
+		}
+		if m.Deprecated != "" {
+			fmt.Printf("  deprecated: %s\n", m.Deprecated)
+		}
+	}
+	if len(doc.Exports) == 0 {
+		fmt.Println("  (no exported functions)")
+	}
+	for _, fn := range doc.Exports {
+		fmt.Printf("  fn %s { %s }\n", fn.Name, strings.Join(fn.Params, ", "))
+		if fn.Deprecated != "" {
+			fmt.Printf("    deprecated: %s\n", fn.Deprecated)
+		}
+	}
+	return 0
+}
+
+func cmdTrace(args []string) int {
+	var file string
+	var files []string
+	jsonOutput := false
+	textOutput := false
+	merge := false
+	validate := false
+	pretty := false
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			jsonOutput = true
+		case "--text":
+			textOutput = true
+		case "--merge":
+			merge = true
+		case "--validate":
+			validate = true
+		case "--pretty":
+			pretty = true
+		default:
+			if !strings.HasPrefix(args[i], "-") {
+				file = args[i]
+				files = append(files, args[i])
+			}
+		}
+	}
+
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 trace <file.jsonl> [--json|--text]")
+		fmt.Fprintln(os.Stderr, "       a0 trace --merge <file.jsonl|glob>... [--json|--text]")
+		fmt.Fprintln(os.Stderr, "       a0 trace --validate <file.jsonl>... [--pretty]")
+		return 1
+	}
+	if merge {
+		return mergeTraces(files, textOutput)
+	}
+	if validate {
+		return validateTraces(files, pretty)
+	}
+
+	// Read and parse NDJSON trace file
+	f, err := os.Open(file)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 1
+	}
+	defer f.Close()
+
+	// Refuse traces from a newer a0; other problems only warn, since the
+	// summary skips lines it cannot read.
+	version, err := evaluator.ValidateTrace(f)
+	if err != nil {
+		var schemaErr *evaluator.SchemaError
+		if errors.As(err, &schemaErr) {
+			diag := diagnostics.MakeDiag(diagnostics.ETrace, err.Error(), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", file, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 1
+	}
+
+	summary := trace.Summarize(f)
+	summary.SchemaVersion = version
+
+	if textOutput {
+		printTraceSummaryText(summary)
+	} else if jsonOutput {
+		b, _ := json.Marshal(summary)
+		fmt.Println(string(b))
+	} else {
+		// Default to JSON
+		b, _ := json.Marshal(summary)
+		fmt.Println(string(b))
+	}
+
+	return 0
+}
+
+// validateTraces lints trace files strictly, printing an E_TRACE diagnostic
+// (spanning the offending line) per problem like a0 check does. It returns
+// 2 if any file has problems and 1 if one could not be read.
+func validateTraces(files []string, pretty bool) int {
+	var diags []diagnostics.Diagnostic
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+			return 1
+		}
+		problems, err := evaluator.LintTrace(f)
+		f.Close()
+		if err != nil {
+			problems = append(problems, evaluator.TraceProblem{Message: err.Error()})
+		}
+		for _, p := range problems {
+			var span *ast.Span
+			if p.Line > 0 {
+				span = &ast.Span{File: file, StartLine: p.Line, StartCol: 1, EndLine: p.Line, EndCol: 1}
+			} else {
+				p.Message = fmt.Sprintf("%s: %s", file, p.Message)
+			}
+			diags = append(diags, diagnostics.MakeDiag(diagnostics.ETrace, p.Message, span, ""))
+		}
+	}
+	if len(diags) > 0 {
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(diags, pretty))
+		return 2
+	}
+	if pretty {
+		fmt.Println("No problems found.")
+	} else {
+		fmt.Println("[]")
+	}
+	return 0
+}
+
+// EvidenceSummary is the output of a0 evidence summarize.
+type EvidenceSummary struct {
+	SchemaVersion int                     `json:"schemaVersion"`
+	Total         int                     `json:"total"`
+	Passed        int                     `json:"passed"`
+	Failed        int                     `json:"failed"`
+	ByKind        map[string]*kindSummary `json:"byKind"`
+	// Run is the metadata of the run that wrote the file, when it has any.
+	Run *evaluator.RunMeta `json:"run,omitempty"`
+	// Runs breaks the totals down per run for files holding several runs
+	// (see --evidence-append), in file order.
+	Runs []runSummary `json:"runs,omitempty"`
+}
+
+type runSummary struct {
+	evaluator.RunMeta
+	Total  int `json:"total"`
+	Failed int `json:"failed"`
+}
+
+type kindSummary struct {
+	Total  int `json:"total"`
+	Failed int `json:"failed"`
+}
+
+// cmdEvidence handles a0 evidence summarize <file> [--json|--text].
+func cmdEvidence(args []string) int {
+	const usage = "usage: a0 evidence summarize <file.json> [--json|--text]"
+	if len(args) == 0 || args[0] != "summarize" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 1
+	}
+	var file string
+	textOutput := false
+	for _, arg := range args[1:] {
+		switch arg {
+		case "--text":
+			textOutput = true
+		case "--json":
+			textOutput = false
+		default:
+			if !strings.HasPrefix(arg, "-") {
+				file = arg
+			}
+		}
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 1
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
 		diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
 		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
 		return 1
 	}
-	defer f.Close()
+	runs, err := evaluator.ValidateEvidenceRuns(data)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EEvidence, err.Error(), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 1
+	}
+
+	summary := &EvidenceSummary{
+		SchemaVersion: evaluator.EvidenceSchemaVersion,
+		ByKind:        make(map[string]*kindSummary),
+	}
+	var evidence []evaluator.Evidence
+	for _, run := range runs {
+		evidence = append(evidence, run.Evidence...)
+		if len(runs) == 1 {
+			summary.Run = run.Meta
+			continue
+		}
+		rs := runSummary{Total: len(run.Evidence)}
+		if run.Meta != nil {
+			rs.RunMeta = *run.Meta
+		}
+		for _, e := range run.Evidence {
+			if !e.OK {
+				rs.Failed++
+			}
+		}
+		summary.Runs = append(summary.Runs, rs)
+	}
+	for _, e := range evidence {
+		k, ok := summary.ByKind[e.Kind]
+		if !ok {
+			k = &kindSummary{}
+			summary.ByKind[e.Kind] = k
+		}
+		summary.Total++
+		k.Total++
+		if e.OK {
+			summary.Passed++
+		} else {
+			summary.Failed++
+			k.Failed++
+		}
+	}
+
+	if !textOutput {
+		b, _ := json.Marshal(summary)
+		fmt.Println(string(b))
+		return 0
+	}
+	if run := summary.Run; run != nil {
+		fmt.Printf("Run: %s (exit %d)\n", run.RunID, run.ExitCode)
+		if run.Program != "" {
+			fmt.Printf("Program: %s (sha256 %s)\n", run.Program, run.ProgramSHA256)
+		}
+		if run.StartTime != "" {
+			fmt.Printf("Time: %s .. %s\n", run.StartTime, run.EndTime)
+		}
+		if run.A0Version != "" {
+			fmt.Printf("A0: %s\n", run.A0Version)
+		}
+	}
+	if len(summary.Runs) > 0 {
+		fmt.Printf("Runs: %d\n", len(summary.Runs))
+		for _, r := range summary.Runs {
+			fmt.Printf("  %s  %s  exit %d  %d/%d passed\n", r.RunID, r.StartTime, r.ExitCode, r.Total-r.Failed, r.Total)
+		}
+	}
+	fmt.Printf("Evidence: %d (%d passed, %d failed)\n", summary.Total, summary.Passed, summary.Failed)
+	kinds := make([]string, 0, len(summary.ByKind))
+	for kind := range summary.ByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		k := summary.ByKind[kind]
+		fmt.Printf("  %s: %d (%d failed)\n", kind, k.Total, k.Failed)
+	}
+	printFailedEvidence(os.Stdout, evidence)
+	return 0
+}
+
+func cmdHelp(args []string) int {
+	showIndex := false
+	topic := ""
+	for _, arg := range args {
+		if arg == "--index" {
+			showIndex = true
+		} else if !strings.HasPrefix(arg, "-") {
+			topic = arg
+		}
+	}
+
+	if showIndex {
+		if topic == "" {
+			fmt.Fprintln(os.Stderr, "error: --index requires a topic (e.g., a0 help stdlib --index)")
+			return 1
+		}
+		if topic != "stdlib" {
+			fmt.Fprintf(os.Stderr, "error: --index is only supported for the stdlib topic\n")
+			return 1
+		}
+		fmt.Print(help.StdlibIndex())
+		return 0
+	}
+
+	if topic == "" {
+		fmt.Print(help.QUICKREF)
+		return 0
+	}
+
+	if _, isTopic := help.Topics[topic]; !isTopic {
+		if _, ok := help.Lookup(topic); ok {
+			return cmdExplain([]string{topic})
+		}
+	}
+	name, content, err := help.MatchTopic(topic)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\nAvailable topics: %s\n", err, strings.Join(help.TopicList, ", "))
+		fmt.Fprintln(os.Stderr, "Diagnostic codes, tools and stdlib functions work too, e.g. a0 help E_PARSE")
+		return 1
+	}
+	_ = name
+	fmt.Print(content)
+	return 0
+}
+
+// cmdExplain handles a0 explain: it prints the help entry for one
+// diagnostic code, tool or stdlib function.
+func cmdExplain(args []string) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "usage: a0 explain <E_CODE|tool|function>")
+		return 1
+	}
+	text, err := help.Explain(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(text)
+	return 0
+}
+
+// PlanReport is the output of a0 plan: the effects a run would perform.
+// Complete is false when the plan run stopped at an error, in which case
+// Steps holds the effects up to that point.
+type PlanReport struct {
+	File     string     `json:"file"`
+	Complete bool       `json:"complete"`
+	Steps    []PlanItem `json:"steps"`
+}
+
+// PlanItem is one do call of a PlanReport.
+type PlanItem struct {
+	Step int             `json:"step"`
+	Tool string          `json:"tool"`
+	Args json.RawMessage `json:"args"`
+	Span ast.Span        `json:"span"`
+}
+
+// cmdPlan handles a0 plan <file>: it runs the program with do calls
+// recorded instead of executed and prints the resulting plan.
+func cmdPlan(args []string) int {
+	var file string
+	pretty := false
+	textOutput := false
+	unsafeAllowAll := false
+	profile := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--pretty":
+			pretty = true
+		case "--text":
+			textOutput = true
+		case "--json":
+			textOutput = false
+		case "--unsafe-allow-all":
+			unsafeAllowAll = true
+		case "--profile":
+			if i+1 < len(args) {
+				i++
+				profile = args[i]
+			}
+		default:
+			if !strings.HasPrefix(args[i], "-") {
+				file = args[i]
+			}
+		}
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 plan <file> [--text|--json] [--pretty] [--unsafe-allow-all] [--profile <name>]")
+		return 1
+	}
+
+	opts := []runtime.Option{runtime.WithPlan()}
+	if unsafeAllowAll {
+		opts = append(opts, runtime.WithUnsafeAllowAll())
+	} else {
+		policy, code := loadPolicy(capabilities.LoadOptions{Profile: profile}, pretty)
+		if code != 0 {
+			return code
+		}
+		opts = append(opts, runtime.WithPolicy(policy))
+	}
+	source, filename, code := readSource(file, pretty)
+	if code != 0 {
+		return code
+	}
+	result, execErr := runtime.New(opts...).Run(context.Background(), source, filename)
+
+	exitCode := 0
+	switch e := execErr.(type) {
+	case nil:
+	case *runtime.DiagnosticError:
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(e.Diagnostics, pretty))
+		return 2
+	case *evaluator.A0RuntimeError:
+		diag := diagnostics.MakeDiag(e.Code, e.Message, e.Span, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+		exitCode = exitCodeForDiag(e.Code)
+	default:
+		fmt.Fprintln(os.Stderr, execErr.Error())
+		exitCode = 4
+	}
+
+	report := PlanReport{File: filename, Complete: execErr == nil, Steps: []PlanItem{}}
+	if result != nil {
+		for i, step := range result.Plan {
+			argsJSON, _ := evaluator.ValueToJSON(step.Args)
+			report.Steps = append(report.Steps, PlanItem{Step: i + 1, Tool: step.Tool, Args: argsJSON, Span: step.Span})
+		}
+	}
+	if !textOutput {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(b))
+		return exitCode
+	}
+	fmt.Printf("Plan for %s: %d effect(s)\n", filename, len(report.Steps))
+	for _, step := range report.Steps {
+		fmt.Printf("  %d. %s at %d:%d %s\n", step.Step, step.Tool, step.Span.StartLine, step.Span.StartCol, step.Args)
+	}
+	if !report.Complete {
+		fmt.Println("  (incomplete: the plan run stopped at an error)")
+	}
+	return exitCode
+}
+
+// ToolInfo describes a registered tool for a0 tools. Allowed reports
+// whether a run under the effective policy may call it: every capability
+// it requires is allowed and none rests on a lapsed grant.
+type ToolInfo struct {
+	Name       string `json:"name"`
+	Mode       string `json:"mode"`
+	Capability string `json:"capability"`
+	Allowed    bool   `json:"allowed"`
+}
+
+// cmdTools handles a0 tools: it lists every registered tool with its mode,
+// capability and whether the current policy permits it.
+func cmdTools(args []string) int {
+	jsonOutput := false
+	profile := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			jsonOutput = true
+		case "--profile":
+			if i+1 < len(args) {
+				i++
+				profile = args[i]
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "usage: a0 tools [--json] [--profile <name>]")
+			return 1
+		}
+	}
+	policy, code := loadPolicy(capabilities.LoadOptions{Profile: profile}, false)
+	if code != 0 {
+		return code
+	}
+
+	reg := tools.NewRegistry()
+	tools.RegisterDefaults(reg)
+	now := time.Now()
+	infos := []ToolInfo{}
+	for name, def := range reg.All() {
+		infos = append(infos, ToolInfo{
+			Name:       name,
+			Mode:       def.Mode,
+			Capability: def.CapabilityID,
+			Allowed:    policy.PermitsTool(def.CapabilityID, def.AlsoRequires, now),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	if jsonOutput {
+		b, _ := json.MarshalIndent(infos, "", "  ")
+		fmt.Println(string(b))
+		return 0
+	}
+	fmt.Printf("%-15s %-7s %-12s %s\n", "TOOL", "MODE", "CAPABILITY", "ALLOWED")
+	allowed := 0
+	for _, t := range infos {
+		mark := "no"
+		if t.Allowed {
+			mark = "yes"
+			allowed++
+		}
+		fmt.Printf("%-15s %-7s %-12s %s\n", t.Name, t.Mode, t.Capability, mark)
+	}
+	fmt.Printf("\n%d of %d tools allowed by the current policy\n", allowed, len(infos))
+	return 0
+}
+
+// cmdBench handles a0 bench --self: it runs the parser and evaluator stress
+// benchmarks and exits 5 when a case exceeds its allocation budget.
+func cmdBench(args []string) int {
+	self := false
+	jsonOutput := false
+	filter := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--self":
+			self = true
+		case "--json":
+			jsonOutput = true
+		case "--run":
+			if i+1 < len(args) {
+				i++
+				filter = args[i]
+			}
+		}
+	}
+	if !self {
+		fmt.Fprintln(os.Stderr, "usage: a0 bench --self [--run <substring>] [--json]")
+		return 1
+	}
+
+	results := bench.Run(filter)
+	exitCode := 0
+	for _, r := range results {
+		if r.OverBudget || r.Error != "" {
+			exitCode = 5
+		}
+	}
+	if jsonOutput {
+		b, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(b))
+		return exitCode
+	}
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.Error != "":
+			status = "FAILED: " + r.Error
+		case r.OverBudget:
+			status = fmt.Sprintf("OVER BUDGET (max %d allocs/op)", r.MaxAllocs)
+		}
+		fmt.Printf("%-22s %12d ns/op %12d B/op %10d allocs/op  %s\n", r.Name, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp, status)
+	}
+	if len(results) == 0 {
+		fmt.Printf("no benchmark matches '%s'\n", filter)
+	}
+	return exitCode
+}
+
+// cmdHash handles a0 hash: it prints the canonical hash of a program and
+// the modules it imports, taken after formatting so layout changes don't
+// alter it.
+func cmdHash(args []string) int {
+	file := ""
+	pretty := false
+	for _, arg := range args {
+		switch {
+		case arg == "--pretty":
+			pretty = true
+		case arg == "-" || !strings.HasPrefix(arg, "-"):
+			file = arg
+		default:
+			fmt.Fprintln(os.Stderr, "usage: a0 hash <file.a0> [--pretty]")
+			return 1
+		}
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 hash <file.a0> [--pretty]")
+		return 1
+	}
+	source, filename, code := readSource(file, pretty)
+	if code != 0 {
+		return code
+	}
+	hash, err := runtime.New().Hash(source, filename)
+	if err != nil {
+		if dErr, ok := err.(*runtime.DiagnosticError); ok {
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(dErr.Diagnostics, pretty))
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 4
+	}
+	fmt.Println(hash)
+	return 0
+}
 
-	summary := computeTraceSummary(f)
+// VerifyReport is the result of a0 verify.
+type VerifyReport struct {
+	Trace    string `json:"trace"`
+	Program  string `json:"program"`
+	RunID    string `json:"runId"`
+	Verified bool   `json:"verified"`
+	// ProgramChanged is set when the program's hash differs from the one
+	// in the trace's run_start event.
+	ProgramChanged bool            `json:"programChanged,omitempty"`
+	ToolCalls      int             `json:"toolCalls"`
+	Expected       json.RawMessage `json:"expected,omitempty"`
+	Actual         json.RawMessage `json:"actual,omitempty"`
+	Problems       []string        `json:"problems,omitempty"`
+}
 
-	if textOutput {
-		printTraceSummaryText(summary)
-	} else if jsonOutput {
-		b, _ := json.Marshal(summary)
-		fmt.Println(string(b))
-	} else {
-		// Default to JSON
-		b, _ := json.Marshal(summary)
-		fmt.Println(string(b))
+// recordedRun is what a0 verify needs from a trace recorded with
+// --trace-values.
+type recordedRun struct {
+	runID   string
+	program string
+	sha256  string
+	// calls holds each tool's recorded outcomes in call order.
+	calls     map[string][]recordedCall
+	total     int
+	value     json.RawMessage // set when the run succeeded
+	errorCode string          // set when it failed
+	ended     bool
+}
+
+type recordedCall struct {
+	result json.RawMessage
+	err    string
+}
+
+// cmdVerify handles a0 verify: it re-runs the program a trace was recorded
+// from, answering every tool call with the result recorded in the trace,
+// and checks that the program produces the recorded value again.
+func cmdVerify(args []string) int {
+	tracePath, programPath := "", ""
+	pretty := false
+	for _, arg := range args {
+		switch {
+		case arg == "--pretty":
+			pretty = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Fprintln(os.Stderr, "usage: a0 verify <trace.jsonl> [file.a0] [--pretty]")
+			return 1
+		case tracePath == "":
+			tracePath = arg
+		default:
+			programPath = arg
+		}
+	}
+	if tracePath == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 verify <trace.jsonl> [file.a0] [--pretty]")
+		return 1
+	}
+
+	rec, err := readRecordedRun(tracePath)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.ETrace, fmt.Sprintf("%s: %s", tracePath, err), nil,
+			"record the run with a0 run <file> --trace <trace.jsonl> --trace-values")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+		return 4
 	}
+	if programPath == "" {
+		programPath = rec.program
+	}
+	source, filename, code := readSource(programPath, pretty)
+	if code != 0 {
+		return code
+	}
+
+	report := VerifyReport{Trace: tracePath, Program: filename, RunID: rec.runID, ToolCalls: rec.total}
+	replay := &toolReplay{calls: rec.calls}
+	rt := runtime.New(
+		runtime.WithTools(replay.registry()),
+		runtime.WithUnsafeAllowAll(),
+		runtime.WithRunID(rec.runID),
+		// Recorded calls are answered in trace order, which is item order
+		// within a batch.
+		runtime.WithMaxBatchConcurrency(1),
+	)
+	result, execErr := rt.Run(context.Background(), source, filename)
+	if dErr, ok := execErr.(*runtime.DiagnosticError); ok {
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics(dErr.Diagnostics, pretty))
+		return 2
+	}
+	if result != nil && rec.sha256 != "" && result.ProgramSHA256 != rec.sha256 {
+		report.ProgramChanged = true
+		report.Problems = append(report.Problems, "program or its modules changed since the trace was recorded")
+	}
+	report.Problems = append(report.Problems, replay.problems()...)
+
+	switch {
+	case rec.errorCode != "":
+		var rtErr *evaluator.A0RuntimeError
+		if !errors.As(execErr, &rtErr) || rtErr.Code != rec.errorCode {
+			report.Problems = append(report.Problems, fmt.Sprintf("recorded run failed with %s, replay ended with %v", rec.errorCode, describeOutcome(execErr)))
+		}
+	case execErr != nil:
+		report.Problems = append(report.Problems, fmt.Sprintf("replay failed: %s", execErr))
+	default:
+		expected, actual, match := compareValues(rec.value, result.Value)
+		report.Expected, report.Actual = expected, actual
+		if !match {
+			report.Problems = append(report.Problems, "output value differs from the recorded one")
+		}
+	}
+	report.Verified = len(report.Problems) == 0
 
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(b))
+	if !report.Verified {
+		return 5
+	}
 	return 0
 }
 
-func cmdHelp(args []string) int {
-	showIndex := false
-	topic := ""
-	for _, arg := range args {
-		if arg == "--index" {
-			showIndex = true
-		} else if !strings.HasPrefix(arg, "-") {
-			topic = arg
+func describeOutcome(err error) string {
+	if err == nil {
+		return "success"
+	}
+	return err.Error()
+}
+
+// compareValues compares a recorded value with a replayed one in stable
+// JSON form, so record key order does not matter.
+func compareValues(recorded json.RawMessage, actual evaluator.A0Value) (json.RawMessage, json.RawMessage, bool) {
+	want, err := evaluator.ParseJSONToValue(recorded)
+	if err != nil {
+		return recorded, nil, false
+	}
+	expected, _ := evaluator.StableJSON(want, evaluator.NumberFormat{})
+	got, _ := evaluator.StableJSON(actual, evaluator.NumberFormat{})
+	return expected, got, bytes.Equal(expected, got)
+}
+
+// readRecordedRun reads the first run of an NDJSON trace.
+func readRecordedRun(path string) (*recordedRun, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file")
+	}
+	defer f.Close()
+
+	rec := &recordedRun{calls: make(map[string][]recordedCall)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			RunID string            `json:"runId"`
+			Event string            `json:"event"`
+			Span  *ast.Span         `json:"span"`
+			Data  map[string]string `json:"data"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
+		}
+		if rec.runID == "" && event.Event == string(evaluator.TraceRunStart) {
+			rec.runID = event.RunID
+			rec.sha256 = event.Data["programSha256"]
+			if event.Span != nil {
+				rec.program = event.Span.File
+			}
+		}
+		if rec.runID == "" || event.RunID != rec.runID {
+			continue
 		}
+		switch event.Event {
+		case string(evaluator.TraceToolEnd):
+			result, hasResult := event.Data["result"]
+			errMsg, hasErr := event.Data["error"]
+			if !hasResult && !hasErr {
+				return nil, fmt.Errorf("tool_end for '%s' has no recorded result", event.Data["tool"])
+			}
+			rec.calls[event.Data["tool"]] = append(rec.calls[event.Data["tool"]], recordedCall{result: json.RawMessage(result), err: errMsg})
+			rec.total++
+		case string(evaluator.TraceRunEnd):
+			if value, ok := event.Data["value"]; ok {
+				rec.value = json.RawMessage(value)
+			} else if code, ok := event.Data["code"]; ok {
+				rec.errorCode = code
+			} else {
+				return nil, fmt.Errorf("run_end has no recorded value")
+			}
+			rec.ended = true
+		}
+		if rec.ended {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if rec.runID == "" {
+		return nil, fmt.Errorf("no run_start event")
+	}
+	if !rec.ended {
+		return nil, fmt.Errorf("run %s has no run_end event", rec.runID)
 	}
+	return rec, nil
+}
 
-	if showIndex {
-		if topic == "" {
-			fmt.Fprintln(os.Stderr, "error: --index requires a topic (e.g., a0 help stdlib --index)")
-			return 1
+// toolReplay answers tool calls from a recorded run. Calls are matched per
+// tool in order, so parallel map workers may interleave freely.
+type toolReplay struct {
+	mu         sync.Mutex
+	calls      map[string][]recordedCall
+	unexpected []string
+}
+
+// registry returns the default tools with Execute replaced by the replay
+// and no-op transaction hooks, so nothing touches the outside world.
+func (r *toolReplay) registry() *tools.Registry {
+	defaults := tools.NewRegistry()
+	tools.RegisterDefaults(defaults)
+	reg := tools.NewRegistry()
+	for name, def := range defaults.All() {
+		name := name
+		replayed := tools.Def{Name: name, Mode: def.Mode, CapabilityID: def.CapabilityID,
+			Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+				return r.next(name)
+			},
 		}
-		if topic != "stdlib" {
-			fmt.Fprintf(os.Stderr, "error: --index is only supported for the stdlib topic\n")
-			return 1
+		if def.Prepare != nil {
+			replayed.Prepare = func(context.Context, *evaluator.A0Record) (any, error) { return nil, nil }
+			replayed.Commit = func(context.Context, any) error { return nil }
+			replayed.Rollback = func(context.Context, any) error { return nil }
 		}
-		fmt.Print(help.StdlibIndex())
-		return 0
+		reg.Register(replayed)
 	}
+	return reg
+}
 
-	if topic == "" {
-		fmt.Print(help.QUICKREF)
-		return 0
+func (r *toolReplay) next(name string) (evaluator.A0Value, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queue := r.calls[name]
+	if len(queue) == 0 {
+		r.unexpected = append(r.unexpected, name)
+		return nil, fmt.Errorf("no recorded result left for this call")
 	}
+	call := queue[0]
+	r.calls[name] = queue[1:]
+	if call.err != "" {
+		return nil, errors.New(call.err)
+	}
+	return evaluator.ParseJSONToValue(call.result)
+}
 
-	name, content, err := help.MatchTopic(topic)
+// problems lists calls the replay could not answer and recorded calls the
+// replay never made.
+func (r *toolReplay) problems() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, name := range r.unexpected {
+		out = append(out, fmt.Sprintf("replay called %s more often than the recorded run", name))
+	}
+	names := make([]string, 0, len(r.calls))
+	for name := range r.calls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if n := len(r.calls[name]); n > 0 {
+			out = append(out, fmt.Sprintf("replay made %d fewer %s call(s) than the recorded run", n, name))
+		}
+	}
+	return out
+}
+
+// printFilesChanged prints the "files changed" section of pretty run output.
+func printFilesChanged(w io.Writer, changes []tools.FileChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "files changed (%d):\n", len(changes))
+	for _, c := range changes {
+		fmt.Fprintf(w, "  %-8s %s  %d -> %d bytes (%+d) via %s\n", c.Op, c.Path, c.BytesBefore, c.BytesAfter, c.Delta, c.Tool)
+	}
+	for _, c := range changes {
+		if c.Diff != "" {
+			fmt.Fprint(w, c.Diff)
+		}
+	}
+}
+
+// printOverlayChanges reports on stderr what an --overlay run left to apply.
+func printOverlayChanges(ov *tools.Overlay) {
+	changes, err := ov.Changes()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\nAvailable topics: %s\n", err, strings.Join(help.TopicList, ", "))
-		return 1
+		fmt.Fprintf(os.Stderr, "overlay %s: %s\n", ov.Dir, err)
+		return
 	}
-	_ = name
-	fmt.Print(content)
-	return 0
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stderr, "overlay %s: no changes\n", ov.Dir)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "overlay %s: %d file(s) changed, apply with: a0 run --apply %s\n", ov.Dir, len(changes), ov.Dir)
+	printChangeList(os.Stderr, changes)
+}
+
+func printChangeList(w io.Writer, changes []tools.OverlayChange) {
+	for _, c := range changes {
+		mark := "M"
+		if c.Status == "added" {
+			mark = "A"
+		}
+		fmt.Fprintf(w, "  %s %s (%d bytes)\n", mark, c.Path, c.Bytes)
+	}
+}
+
+// applyOverlay handles a0 run --apply <dir>.
+func applyOverlay(dir string, pretty bool) int {
+	ov, err := tools.LoadOverlay(dir)
+	if err == nil {
+		var changes []tools.OverlayChange
+		if changes, err = ov.Apply(); err == nil {
+			fmt.Printf("applied %d file(s) to %s\n", len(changes), ov.Root)
+			printChangeList(os.Stdout, changes)
+			return 0
+		}
+	}
+	diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot apply overlay: %s", err), nil, "")
+	fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+	return 4
+}
+
+// loadPolicy resolves the policy for a0 run and a0 test. An unverified
+// project policy (see LoadOptions.RequireSigned) or an unknown profile is
+// refused with exit 3.
+func loadPolicy(lopts capabilities.LoadOptions, pretty bool) (*capabilities.Policy, int) {
+	cwd, _ := os.Getwd()
+	policy, _, err := capabilities.LoadPolicyWith(cwd, lopts)
+	if err != nil {
+		hint := "sign it with a0 policy sign --key <keyfile> and add the public key to ~/.a0/trusted_keys"
+		if !errors.Is(err, capabilities.ErrUnsigned) && !errors.Is(err, capabilities.ErrBadSignature) && !errors.Is(err, capabilities.ErrNoTrustedKeys) {
+			hint = "define the profile under \"profiles\" in the policy file, or unset " + capabilities.ProfileEnv
+		}
+		diag := diagnostics.MakeDiag(diagnostics.EPolicy, err.Error(), nil, hint)
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, pretty))
+		return nil, 3
+	}
+	return policy, 0
 }
 
+// cmdPolicy handles a0 policy [show|verify|sign|keygen].
 func cmdPolicy(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "verify":
+			return cmdPolicyVerify(args[1:])
+		case "sign":
+			return cmdPolicySign(args[1:])
+		case "keygen":
+			return cmdPolicyKeygen(args[1:])
+		}
+	}
+
+	var lopts capabilities.LoadOptions
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--profile" && i+1 < len(args) {
+			i++
+			lopts.Profile = args[i]
+		}
+	}
 	cwd, _ := os.Getwd()
-	policy, pf := capabilities.LoadPolicy(cwd)
+	policy, pf, err := capabilities.LoadPolicyWith(cwd, lopts)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EPolicy, err.Error(), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 3
+	}
 
 	if pf != nil {
 		b, _ := json.MarshalIndent(pf, "", "  ")
@@ -353,99 +2283,155 @@ func cmdPolicy(args []string) int {
 	return 0
 }
 
-type TraceSummary struct {
-	RunID           string         `json:"runId"`
-	TotalEvents     int            `json:"totalEvents"`
-	ToolInvocations int            `json:"toolInvocations"`
-	ToolsByName     map[string]int `json:"toolsByName"`
-	EvidenceCount   int            `json:"evidenceCount"`
-	Failures        int            `json:"failures"`
-	BudgetExceeded  int            `json:"budgetExceeded"`
-	StartTime       string         `json:"startTime,omitempty"`
-	EndTime         string         `json:"endTime,omitempty"`
-	DurationMs      float64        `json:"durationMs"`
-}
-
-type traceEvent struct {
-	Event string         `json:"event"`
-	RunID string         `json:"runId"`
-	TS    string         `json:"ts"`
-	Data  map[string]any `json:"data,omitempty"`
+// policyFileArg returns the policy file named in args, defaulting to the
+// project policy.
+func policyFileArg(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ".a0policy.json"
 }
 
-func computeTraceSummary(r io.Reader) *TraceSummary {
-	summary := &TraceSummary{
-		ToolsByName: make(map[string]int),
+// cmdPolicyVerify handles a0 policy verify [file]: it checks the file's
+// detached signature against ~/.a0/trusted_keys. Exit 3 when it does not
+// verify, 1 when the files cannot be read.
+func cmdPolicyVerify(args []string) int {
+	path := policyFileArg(args)
+	keysPath, err := capabilities.TrustedKeysPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot locate trusted keys: %s\n", err)
+		return 1
+	}
+	keys, err := capabilities.LoadTrustedKeys(keysPath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	key, err := capabilities.VerifyPolicyFile(path, keys)
+	switch {
+	case errors.Is(err, capabilities.ErrUnsigned), errors.Is(err, capabilities.ErrBadSignature), errors.Is(err, capabilities.ErrNoTrustedKeys):
+		diag := diagnostics.MakeDiag(diagnostics.EPolicy, fmt.Sprintf("%s: %s", path, err), nil,
+			fmt.Sprintf("trusted keys are read from %s", keysPath))
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return 3
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if key.Name != "" {
+		fmt.Printf("%s: signature OK (%s)\n", path, key.Name)
+	} else {
+		fmt.Printf("%s: signature OK\n", path)
 	}
+	return 0
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
+// cmdPolicySign handles a0 policy sign --key <keyfile> [file].
+func cmdPolicySign(args []string) int {
+	keyPath := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--key" && i+1 < len(args) {
+			i++
+			keyPath = args[i]
 			continue
 		}
-
-		var event traceEvent
-		if err := json.Unmarshal([]byte(line), &event); err != nil {
-			continue // skip invalid lines
-		}
-
-		summary.TotalEvents++
-		if summary.RunID == "" {
-			summary.RunID = event.RunID
-		}
-
-		switch event.Event {
-		case "run_start":
-			if summary.StartTime == "" {
-				summary.StartTime = event.TS
-			}
-		case "run_end":
-			summary.EndTime = event.TS
-		case "tool_start":
-			summary.ToolInvocations++
-			if name, ok := event.Data["tool"]; ok {
-				if s, ok := name.(string); ok {
-					summary.ToolsByName[s]++
-				}
-			}
-		case "evidence":
-			summary.EvidenceCount++
-			if ok, found := event.Data["ok"]; found {
-				if b, ok := ok.(bool); ok && !b {
-					summary.Failures++
-				}
-			}
-		case "budget_exceeded":
-			summary.BudgetExceeded++
-		}
+		rest = append(rest, args[i])
 	}
-
-	// Compute duration from start/end times
-	if summary.StartTime != "" && summary.EndTime != "" {
-		start, err1 := parseTime(summary.StartTime)
-		end, err2 := parseTime(summary.EndTime)
-		if err1 == nil && err2 == nil {
-			summary.DurationMs = float64(end.Sub(start).Milliseconds())
-		}
+	if keyPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: a0 policy sign --key <keyfile> [policy.json]")
+		return 1
+	}
+	path := policyFileArg(rest)
+	if err := capabilities.SignPolicyFile(path, keyPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	fmt.Printf("wrote %s%s\n", path, capabilities.SignatureSuffix)
+	return 0
+}
 
-	return summary
+// cmdPolicyKeygen handles a0 policy keygen <keyfile>: it writes a new
+// private key and prints the public key line for ~/.a0/trusted_keys.
+func cmdPolicyKeygen(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: a0 policy keygen <keyfile>")
+		return 1
+	}
+	pub, err := capabilities.GenerateKey(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(pub)
+	return 0
 }
 
-func printTraceSummaryText(s *TraceSummary) {
+func printTraceSummaryText(s *trace.Summary) {
 	fmt.Printf("Run: %s\n", s.RunID)
 	fmt.Printf("Events: %d\n", s.TotalEvents)
 	fmt.Printf("Tools: %d invocations\n", s.ToolInvocations)
 	for name, count := range s.ToolsByName {
 		fmt.Printf("  %s: %d\n", name, count)
 	}
+	if len(s.ToolPhasesMs) > 0 {
+		fmt.Printf("Tool phases:\n")
+		for _, phase := range []string{"dns", "connect", "tls", "ttfb", "transfer"} {
+			if ms, ok := s.ToolPhasesMs[phase]; ok {
+				fmt.Printf("  %s: %.1fms\n", phase, ms)
+			}
+		}
+	}
 	fmt.Printf("Evidence: %d (%d failures)\n", s.EvidenceCount, s.Failures)
+	if len(s.LogsByLevel) > 0 {
+		var parts []string
+		for _, level := range evaluator.LogLevels {
+			if n, ok := s.LogsByLevel[level]; ok {
+				parts = append(parts, fmt.Sprintf("%s=%d", level, n))
+			}
+		}
+		fmt.Printf("Logs: %s\n", strings.Join(parts, " "))
+	}
+	if len(s.Capabilities) > 0 {
+		fmt.Printf("Capabilities:\n")
+		for _, c := range s.Capabilities {
+			verdict := "allowed"
+			if !c.Allowed {
+				verdict = "denied"
+			}
+			line := fmt.Sprintf("  %s: %s (%s)", c.Capability, verdict, c.Source)
+			if c.Reason != "" {
+				line += ": " + c.Reason
+			}
+			fmt.Println(line)
+		}
+	}
+	if len(s.SlowestStatements) > 0 {
+		fmt.Printf("Slowest statements:\n")
+		for _, st := range s.SlowestStatements {
+			fmt.Printf("  %s  x%d  total %.1fms  avg %.3fms\n", st.Span, st.Count, st.TotalMs, st.AvgMs)
+		}
+	}
 	if s.DurationMs > 0 {
 		fmt.Printf("Duration: %.0fms\n", s.DurationMs)
 	}
 }
 
+// loadManifest finds a0.json in the working directory or its parents. A
+// malformed manifest is reported and yields a non-zero exit code.
+func loadManifest() (*manifest.Manifest, int) {
+	cwd, _ := os.Getwd()
+	man, err := manifest.Find(cwd)
+	if err != nil {
+		diag := diagnostics.MakeDiag(diagnostics.EIO, err.Error(), nil, "")
+		fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+		return nil, 1
+	}
+	return man, 0
+}
+
 func readSource(file string, pretty bool) (string, string, int) {
 	if file == "-" {
 		// Read from stdin
@@ -479,23 +2465,101 @@ func exitCodeForDiag(code string) int {
 	}
 }
 
-func parseTime(s string) (time.Time, error) {
-	// Try RFC3339Nano first, then other common formats
-	t, err := time.Parse(time.RFC3339Nano, s)
-	if err == nil {
-		return t, nil
+// mergeTraces summarizes every run in files; arguments that are glob
+// patterns are expanded.
+func mergeTraces(patterns []string, textOutput bool) int {
+	var files []string
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil || len(matches) == 0 {
+			matches = []string{p}
+		}
+		files = append(files, matches...)
 	}
-	t, err = time.Parse(time.RFC3339, s)
-	if err == nil {
-		return t, nil
+
+	merger := trace.NewMerger()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			diag := diagnostics.MakeDiag(diagnostics.EIO, fmt.Sprintf("cannot read file: %s", file), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+			return 1
+		}
+		_, err = evaluator.ValidateTrace(f)
+		var schemaErr *evaluator.SchemaError
+		if errors.As(err, &schemaErr) {
+			f.Close()
+			diag := diagnostics.MakeDiag(diagnostics.ETrace, fmt.Sprintf("%s: %v", file, err), nil, "")
+			fmt.Fprintln(os.Stderr, diagnostics.FormatDiagnostics([]diagnostics.Diagnostic{diag}, false))
+			return 1
+		}
+		f.Seek(0, io.SeekStart)
+		merger.Add(f)
+		f.Close()
+	}
+
+	summary := merger.Summary()
+	if textOutput {
+		printMergedTraceSummaryText(summary)
+	} else {
+		b, _ := json.Marshal(summary)
+		fmt.Println(string(b))
+	}
+	return 0
+}
+
+func printMergedTraceSummaryText(s *trace.MergedSummary) {
+	fmt.Printf("Files: %d\n", s.Files)
+	fmt.Printf("Runs: %d (%d succeeded, %d failed, %.1f%% success)\n", s.Runs, s.Succeeded, s.Failed, s.SuccessRate*100)
+	if len(s.Tools) > 0 {
+		names := make([]string, 0, len(s.Tools))
+		for name := range s.Tools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("Tools:\n")
+		for _, name := range names {
+			t := s.Tools[name]
+			fmt.Printf("  %s: %d calls, p50 %.2fms, p90 %.2fms, p99 %.2fms, max %.2fms\n", name, t.Calls, t.P50Ms, t.P90Ms, t.P99Ms, t.MaxMs)
+		}
+	}
+	if len(s.TopFailures) > 0 {
+		fmt.Printf("Top failures:\n")
+		for _, f := range s.TopFailures {
+			code := f.Code
+			if code == "" {
+				code = "-"
+			}
+			fmt.Printf("  %4d  %s  %s\n", f.Count, code, f.Message)
+		}
+	}
+}
+
+// runMeta starts the run metadata of an evidence file for a run that began
+// at started and has just ended.
+func runMeta(started time.Time) evaluator.RunMeta {
+	return evaluator.RunMeta{
+		A0Version: runtime.Version,
+		StartTime: started.UTC().Format(time.RFC3339Nano),
+		EndTime:   time.Now().UTC().Format(time.RFC3339Nano),
 	}
-	return time.Time{}, fmt.Errorf("cannot parse time: %s", s)
 }
 
-func writeEvidence(path string, evidence []evaluator.Evidence) {
-	data, err := evaluator.EvidenceToJSON(evidence)
+// writeEvidence writes the evidence file, or with appendRun adds the run to
+// it as one NDJSON line so repeated runs accumulate in one file.
+func writeEvidence(path string, appendRun bool, meta evaluator.RunMeta, evidence []evaluator.Evidence) {
+	data, err := evaluator.EvidenceFileToJSON(meta, evidence)
+	if err != nil {
+		return
+	}
+	if !appendRun {
+		_ = os.WriteFile(path, data, 0644)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		return
 	}
-	_ = os.WriteFile(path, data, 0644)
+	defer f.Close()
+	_, _ = f.Write(append(data, '\n'))
 }
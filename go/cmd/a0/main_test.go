@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// capture runs fn with stdout and stderr redirected and returns what it
+// wrote to each along with its exit code.
+func capture(t *testing.T, fn func() int) (stdout, stderr string, code int) {
+	t.Helper()
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldOut, oldErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outW, errW
+	outC := make(chan string)
+	errC := make(chan string)
+	go func() { b, _ := io.ReadAll(outR); outC <- string(b) }()
+	go func() { b, _ := io.ReadAll(errR); errC <- string(b) }()
+	defer func() {
+		os.Stdout, os.Stderr = oldOut, oldErr
+	}()
+	code = fn()
+	outW.Close()
+	errW.Close()
+	return <-outC, <-errC, code
+}
+
+// project makes a fresh working directory and home for a command, with the
+// given files written into the working directory.
+func project(t *testing.T, files map[string]string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("A0_PROFILE", "")
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestTools_AllowedMatchesRuntimeChecks(t *testing.T) {
+	project(t, map[string]string{".a0policy.json": `{
+  "allow": ["fs.write"],
+  "grants": {
+    "http.get": { "until": "2000-01-01T00:00:00Z" },
+    "sh.exec": { "until": "2999-01-01T00:00:00Z" }
+  }
+}`})
+	stdout, stderr, code := capture(t, func() int { return cmdTools([]string{"--json"}) })
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var infos []ToolInfo
+	if err := json.Unmarshal([]byte(stdout), &infos); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	allowed := make(map[string]bool)
+	for _, info := range infos {
+		allowed[info.Name] = info.Allowed
+	}
+	for name, want := range map[string]bool{
+		"fs.write":      true,
+		"archive.zip":   false, // also requires fs.read
+		"archive.unzip": false,
+		"http.get":      false, // its grant expired
+		"sh.exec":       true,  // its grant is still valid
+		"fs.read":       false,
+	} {
+		if got, ok := allowed[name]; !ok || got != want {
+			t.Errorf("%s: allowed = %v (listed %v), want %v", name, got, ok, want)
+		}
+	}
+}
+
+// jsonLines decodes one diagnostic per line of out.
+func jsonLines(t *testing.T, out string) []diagnostics.Diagnostic {
+	t.Helper()
+	var diags []diagnostics.Diagnostic
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		var d diagnostics.Diagnostic
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatalf("line is not a JSON diagnostic: %v\n%s", err, line)
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+func TestCheck_JSONLines(t *testing.T) {
+	project(t, map[string]string{
+		"ok.a0":   "let x = 1\nreturn { x: x }\n",
+		"bad.a0":  "let a = 1\nlet b = nope\nreturn { a: a, b: b }\n",
+		"many.a0": "let a = u1\nlet b = u2\nlet c = u3\nreturn { a: a, b: b, c: c }\n",
+	})
+
+	stdout, stderr, code := capture(t, func() int { return cmdCheck([]string{"ok.a0", "bad.a0", "--json-lines"}) })
+	if code != 2 || stderr != "" {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+	diags := jsonLines(t, stdout)
+	if len(diags) != 1 {
+		t.Fatalf("expected one diagnostic for the bad line, got %+v", diags)
+	}
+	if d := diags[0]; d.Code != diagnostics.EUnbound || d.Span == nil || d.Span.File != "bad.a0" || d.Span.StartLine != 2 {
+		t.Errorf("got %+v, want E_UNBOUND at bad.a0 line 2", d)
+	}
+
+	stdout, _, code = capture(t, func() int { return cmdCheck([]string{"ok.a0", "--json-lines"}) })
+	if code != 0 || stdout != "" {
+		t.Errorf("clean file: exit %d, stdout %q", code, stdout)
+	}
+}
+
+func TestCheck_JSONLinesMaxDiagnostics(t *testing.T) {
+	project(t, map[string]string{
+		"bad.a0":  "let a = 1\nlet b = nope\nreturn { a: a, b: b }\n",
+		"many.a0": "let a = u1\nlet b = u2\nlet c = u3\nreturn { a: a, b: b, c: c }\n",
+	})
+	for _, tt := range []struct {
+		limit   string
+		want    []string
+		omitted string
+	}{
+		{"1", []string{"bad.a0:2"}, `{"omitted":3,"maxDiagnostics":1}`},
+		{"2", []string{"bad.a0:2", "many.a0:1"}, `{"omitted":2,"maxDiagnostics":2}`},
+		{"9", []string{"bad.a0:2", "many.a0:1", "many.a0:2", "many.a0:3"}, ""},
+	} {
+		stdout, stderr, code := capture(t, func() int {
+			return cmdCheck([]string{"bad.a0", "many.a0", "--json-lines", "--max-diagnostics", tt.limit})
+		})
+		if code != 2 {
+			t.Fatalf("limit %s: exit %d, stderr %q", tt.limit, code, stderr)
+		}
+		if tt.omitted != "" {
+			var ok bool
+			stdout, ok = strings.CutSuffix(stdout, tt.omitted+"\n")
+			if !ok {
+				t.Errorf("limit %s: output does not end with %s:\n%s", tt.limit, tt.omitted, stdout)
+				continue
+			}
+		}
+		var got []string
+		for _, d := range jsonLines(t, stdout) {
+			got = append(got, fmt.Sprintf("%s:%d", d.Span.File, d.Span.StartLine))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("limit %s: got %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestCheck_MaxDiagnosticsReportsOmitted(t *testing.T) {
+	project(t, map[string]string{
+		"many.a0": "let a = u1\nlet b = u2\nlet c = u3\nreturn { a: a, b: b, c: c }\n",
+	})
+
+	_, stderr, code := capture(t, func() int { return cmdCheck([]string{"many.a0", "--max-diagnostics", "1"}) })
+	if code != 2 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSuffix(stderr, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected the diagnostics and an omitted record, got:\n%s", stderr)
+	}
+	var diags []diagnostics.Diagnostic
+	if err := json.Unmarshal([]byte(lines[0]), &diags); err != nil || len(diags) != 1 {
+		t.Errorf("expected one diagnostic (err %v), got %s", err, lines[0])
+	}
+	if lines[1] != `{"omitted":2,"maxDiagnostics":1}` {
+		t.Errorf("omitted record = %s", lines[1])
+	}
+
+	_, stderr, _ = capture(t, func() int { return cmdCheck([]string{"many.a0", "--max-diagnostics", "1", "--pretty"}) })
+	if !strings.HasSuffix(stderr, "\n... 2 more not shown (--max-diagnostics 1)\n") || strings.Count(stderr, "E_UNBOUND") != 1 {
+		t.Errorf("pretty output:\n%s", stderr)
+	}
+
+	// Nothing is left out, so nothing is reported.
+	_, stderr, _ = capture(t, func() int { return cmdCheck([]string{"many.a0", "--max-diagnostics", "3"}) })
+	if strings.Contains(stderr, "omitted") {
+		t.Errorf("unexpected omitted record:\n%s", stderr)
+	}
+}
+
+func TestRun_MalformedSelectIsAnError(t *testing.T) {
+	project(t, map[string]string{"main.a0": "return { a: { b: 1 } }\n"})
+
+	stdout, stderr, code := capture(t, func() int { return cmdRun([]string{"main.a0", "--select", ".a.b"}) })
+	if code != 0 || stdout != "1\n" {
+		t.Fatalf("valid path: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	for _, path := range []string{"a..b", "a["} {
+		stdout, stderr, code := capture(t, func() int { return cmdRun([]string{"main.a0", "--select", path}) })
+		if code != 2 || stdout != "" || !strings.Contains(stderr, diagnostics.EPath) {
+			t.Errorf("--select %q: exit %d, stdout %q, stderr %q", path, code, stdout, stderr)
+		}
+	}
+}
+
+func TestCheck_ManifestFromSubdirectory(t *testing.T) {
+	dir := project(t, nil)
+	if err := os.MkdirAll(filepath.Join(dir, "src", "deep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "main.a0"), []byte("cap { fs.read: true }\nreturn {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(dir, "src", "deep")); err != nil {
+		t.Fatal(err)
+	}
+
+	for manifestJSON, warned := range map[string]bool{
+		`{"entry": "src/main.a0"}`: true,
+		`{"entry": "src/main.a0", "lint": {"disable": ["E_UNUSED_CAP"]}}`: false,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "a0.json"), []byte(manifestJSON), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stdout, stderr, code := capture(t, func() int { return cmdCheck(nil) })
+		if code != 0 || stdout != "[]\n" {
+			t.Fatalf("%s: exit %d, stdout %q, stderr %q", manifestJSON, code, stdout, stderr)
+		}
+		if got := strings.Contains(stderr, diagnostics.EUnusedCap); got != warned {
+			t.Errorf("%s: warned = %v, want %v\n%s", manifestJSON, got, warned, stderr)
+		}
+	}
+}
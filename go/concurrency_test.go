@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/runtime"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// These tests are most useful under the race detector: go test -race .
+
+const concurrentProgram = `
+let items = range { from: 0, to: 50 }
+let base = { n: 0 }
+let rec = { ...base, tag: "x" }
+let doubled = for { in: items, as: "i" } { return { ...rec, n: i * 2 } }
+let u = unique { in: doubled }
+log.info { msg: "done", count: len { in: u } }
+check { that: len { in: u } == 50, msg: "unique" }
+return { count: len { in: u }, h: hash { in: u } }
+`
+
+func TestRuntime_ConcurrentRuns(t *testing.T) {
+	var events int
+	var logs bytes.Buffer
+	rt := runtime.New(
+		runtime.WithTrace(evaluator.TraceFunc(func(evaluator.TraceEvent) { events++ })),
+		runtime.WithLogWriter(&logs, true),
+	)
+
+	const runs = 16
+	results := make([]*runtime.Result, runs)
+	errs := make([]error, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = rt.Run(context.Background(), concurrentProgram, fmt.Sprintf("run%d.a0", i))
+		}(i)
+	}
+	wg.Wait()
+
+	want := evaluator.ValueToJSONString(results[0].Value)
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("run %d: %v", i, errs[i])
+		}
+		if got := evaluator.ValueToJSONString(results[i].Value); got != want {
+			t.Errorf("run %d: got %s, want %s", i, got, want)
+		}
+		if len(results[i].Evidence) != 1 || !results[i].Evidence[0].OK {
+			t.Errorf("run %d: unexpected evidence %+v", i, results[i].Evidence)
+		}
+	}
+	if n := strings.Count(logs.String(), "INFO  done"); n != runs {
+		t.Errorf("expected %d log lines, got %d:\n%s", runs, n, logs.String())
+	}
+	if events == 0 {
+		t.Error("expected trace events")
+	}
+}
+
+func TestPool_BoundsConcurrencyAndAssignsRunIDs(t *testing.T) {
+	pool := runtime.NewPool(3)
+
+	const runs = 10
+	ids := make(chan string, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := pool.Run(context.Background(), "return run.id", "pool.a0")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if s, ok := res.Value.(evaluator.A0String); !ok || s.Value != res.RunID {
+				t.Errorf("run.id %v does not match Result.RunID %q", res.Value, res.RunID)
+			}
+			ids <- res.RunID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[string]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("duplicate run ID %s", id)
+		}
+		seen[id] = true
+	}
+
+}
+
+func TestPool_RunHonorsContextWhileWaiting(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	reg := tools.NewRegistry()
+	// Stand in for a real tool so the program passes validation.
+	reg.Register(tools.Def{
+		Name: "fs.exists", Mode: "read", CapabilityID: "fs.read",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			close(started)
+			<-release
+			return evaluator.NewNull(), nil
+		},
+	})
+	pool := runtime.NewPool(1, runtime.WithTools(reg), runtime.WithUnsafeAllowAll())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.Run(context.Background(), "cap { fs.read: true }\nlet x = call? fs.exists { path: \"x\" }\nreturn x", "hold.a0")
+		done <- err
+	}()
+	select {
+	case <-started:
+	case err := <-done:
+		t.Fatalf("holding run finished early: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pool.Run(ctx, "return 1", "wait.a0"); err != context.Canceled {
+		t.Errorf("expected context.Canceled while the pool is full, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("holding run failed: %v", err)
+	}
+}
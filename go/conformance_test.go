@@ -22,6 +22,15 @@ import (
 	"github.com/thomasrohde/agent0/go/pkg/validator"
 )
 
+// goSkippedScenarios are shared scenarios the Go harness does not run, with
+// the reason. budget-time expects a 1000-iteration loop to overrun a 1ms
+// budget, which the Go evaluator often finishes in time;
+// TestBudgetTime_SleepOverrunsBudget covers the same failure
+// deterministically.
+var goSkippedScenarios = map[string]string{
+	"budget-time": "timing-dependent; see TestBudgetTime_SleepOverrunsBudget",
+}
+
 func TestConformance(t *testing.T) {
 	scenariosRoot := testutil.ScenariosDir
 
@@ -33,6 +42,9 @@ func TestConformance(t *testing.T) {
 	for _, dir := range dirs {
 		name := filepath.Base(dir)
 		t.Run(name, func(t *testing.T) {
+			if reason, ok := goSkippedScenarios[name]; ok {
+				t.Skip(reason)
+			}
 			scenario, err := testutil.LoadScenario(dir)
 			if err != nil {
 				t.Fatalf("failed to load scenario: %v", err)
@@ -63,6 +75,23 @@ func TestConformance(t *testing.T) {
 	}
 }
 
+// TestBudgetTime_SleepOverrunsBudget is the Go-only counterpart of the
+// budget-time scenario: a time.sleep longer than the timeMs budget must stop
+// the run with E_BUDGET. time.sleep is a Go tool, so this cannot be a shared
+// scenario.
+func TestBudgetTime_SleepOverrunsBudget(t *testing.T) {
+	dir := t.TempDir()
+	program := "budget { timeMs: 1 }\ncap { time.sleep: true }\ncall? time.sleep { ms: 60000 } -> waited\nreturn { waited: waited }\n"
+	if err := os.WriteFile(filepath.Join(dir, "program.a0"), []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runRunScenario(t, dir, &testutil.Scenario{
+		Cmd:    []string{"run", "program.a0"},
+		Policy: &testutil.ScenarioPolicy{Allow: []string{"time.sleep"}},
+		Expect: testutil.ExpectedResult{ExitCode: 4, StderrContains: "E_BUDGET"},
+	})
+}
+
 // --- Command handlers ---
 
 func runRunScenario(t *testing.T, scenarioDir string, scenario *testutil.Scenario) {
@@ -110,7 +139,7 @@ func runRunScenario(t *testing.T, scenarioDir string, scenario *testutil.Scenari
 	// Trace capture
 	var traceEvents []map[string]any
 	if scenario.Capture != nil && scenario.Capture.Trace {
-		opts.Trace = func(event evaluator.TraceEvent) {
+		opts.Trace = evaluator.TraceFunc(func(event evaluator.TraceEvent) {
 			m := map[string]any{
 				"event": string(event.Event),
 				"runId": event.RunID,
@@ -119,7 +148,7 @@ func runRunScenario(t *testing.T, scenarioDir string, scenario *testutil.Scenari
 			if event.Data != nil {
 				// Convert A0Record to map[string]any for JSON compatibility
 				dataMap := make(map[string]any)
-				for _, kv := range event.Data.Pairs {
+				for _, kv := range event.Data.Pairs() {
 					if s, ok := kv.Value.(evaluator.A0String); ok {
 						dataMap[kv.Key] = s.Value
 					} else if b, ok := kv.Value.(evaluator.A0Bool); ok {
@@ -136,7 +165,7 @@ func runRunScenario(t *testing.T, scenarioDir string, scenario *testutil.Scenari
 				m["data"] = dataMap
 			}
 			traceEvents = append(traceEvents, m)
-		}
+		})
 	}
 
 	// Execute in working directory (for file tool scenarios)
@@ -1010,7 +1039,11 @@ var validTraceEvents = map[string]bool{
 	"reduce_start": true, "reduce_end": true,
 	"try_start": true, "try_end": true,
 	"filter_start": true, "filter_end": true,
+	"find_start": true, "find_end": true,
 	"loop_start": true, "loop_end": true,
+	"cap_check": true,
+	"transaction_start": true, "transaction_end": true,
+	"batch_start": true, "batch_end": true,
 }
 
 func computeTestTraceSummary(f *os.File) (*testTraceSummary, error) {
@@ -0,0 +1,20 @@
+//go:build !windows
+
+// Package filelock provides exclusive advisory locks on files, used to keep
+// concurrent a0 processes from interleaving read-modify-write updates.
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock blocks until it holds an exclusive advisory lock on f.
+func Lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// Unlock releases a lock taken with Lock.
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
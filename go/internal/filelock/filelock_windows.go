@@ -0,0 +1,37 @@
+//go:build windows
+
+// Package filelock provides exclusive advisory locks on files, used to keep
+// concurrent a0 processes from interleaving read-modify-write updates.
+package filelock
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const lockfileExclusiveLock = 0x2
+
+var (
+	kernel32DLL      = syscall.NewLazyDLL("kernel32.dll")
+	lockFileExProc   = kernel32DLL.NewProc("LockFileEx")
+	unlockFileExProc = kernel32DLL.NewProc("UnlockFileEx")
+)
+
+// Lock blocks until it holds an exclusive lock on the first byte of f.
+func Lock(f *os.File) error {
+	var ol syscall.Overlapped
+	if r, _, err := lockFileExProc.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&ol))); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// Unlock releases a lock taken with Lock.
+func Unlock(f *os.File) error {
+	var ol syscall.Overlapped
+	if r, _, err := unlockFileExProc.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol))); r == 0 {
+		return err
+	}
+	return nil
+}
@@ -188,6 +188,8 @@ func (n *DoExpr) exprNode()       {}
 type AssertExpr struct {
 	Span Span
 	Args *RecordExpr
+	// Approx marks assert.approx { a, b, tolerance? }.
+	Approx bool
 }
 
 func (n *AssertExpr) Kind() string    { return "AssertExpr" }
@@ -250,7 +252,7 @@ func (n *ForExpr) exprNode()       {}
 
 type MatchArm struct {
 	Span    Span
-	Tag     string // "ok" or "err"
+	Tag     string // "ok" or "err"; a type name or "_" in a TypeMatchExpr
 	Binding string
 	Body    []Stmt
 }
@@ -269,6 +271,18 @@ func (n *MatchExpr) Kind() string    { return "MatchExpr" }
 func (n *MatchExpr) NodeSpan() Span  { return n.Span }
 func (n *MatchExpr) exprNode()       {}
 
+// TypeMatchExpr is match type (subject) { str { ... } num n { ... } _ { ... } }.
+// Arm tags are typeof names ("string", "number", ...) or "_" for the default.
+type TypeMatchExpr struct {
+	Span    Span
+	Subject Expr
+	Arms    []*MatchArm
+}
+
+func (n *TypeMatchExpr) Kind() string    { return "TypeMatchExpr" }
+func (n *TypeMatchExpr) NodeSpan() Span  { return n.Span }
+func (n *TypeMatchExpr) exprNode()       {}
+
 // --- Binary & Unary Expressions ---
 
 type BinaryExpr struct {
@@ -292,6 +306,18 @@ func (n *UnaryExpr) Kind() string    { return "UnaryExpr" }
 func (n *UnaryExpr) NodeSpan() Span  { return n.Span }
 func (n *UnaryExpr) exprNode()       {}
 
+// IndexExpr is a postfix index such as s[0] or items[i], written with no
+// space before the '['.
+type IndexExpr struct {
+	Span   Span
+	Target Expr
+	Index  Expr
+}
+
+func (n *IndexExpr) Kind() string   { return "IndexExpr" }
+func (n *IndexExpr) NodeSpan() Span { return n.Span }
+func (n *IndexExpr) exprNode()      {}
+
 // --- Error Handling ---
 
 type TryExpr struct {
@@ -305,6 +331,17 @@ func (n *TryExpr) Kind() string    { return "TryExpr" }
 func (n *TryExpr) NodeSpan() Span  { return n.Span }
 func (n *TryExpr) exprNode()       {}
 
+// TransactionExpr is transaction { body }: effect tool calls in the body
+// are rolled back if the body fails.
+type TransactionExpr struct {
+	Span Span
+	Body []Stmt
+}
+
+func (n *TransactionExpr) Kind() string    { return "TransactionExpr" }
+func (n *TransactionExpr) NodeSpan() Span  { return n.Span }
+func (n *TransactionExpr) exprNode()       {}
+
 // --- v0.5: Filter and Loop ---
 
 type FilterBlockExpr struct {
@@ -318,6 +355,19 @@ func (n *FilterBlockExpr) Kind() string    { return "FilterBlockExpr" }
 func (n *FilterBlockExpr) NodeSpan() Span  { return n.Span }
 func (n *FilterBlockExpr) exprNode()       {}
 
+// FindBlockExpr is find { in, as } { body }: the first item for which body
+// returns a truthy value, or null. Iteration stops at that item.
+type FindBlockExpr struct {
+	Span    Span
+	List    Expr
+	Binding string
+	Body    []Stmt
+}
+
+func (n *FindBlockExpr) Kind() string    { return "FindBlockExpr" }
+func (n *FindBlockExpr) NodeSpan() Span  { return n.Span }
+func (n *FindBlockExpr) exprNode()       {}
+
 type LoopExpr struct {
 	Span    Span
 	Init    Expr
@@ -361,17 +411,42 @@ func (n *ReturnStmt) Kind() string    { return "ReturnStmt" }
 func (n *ReturnStmt) NodeSpan() Span  { return n.Span }
 func (n *ReturnStmt) stmtNode()       {}
 
+// EnsureStmt is ensure { that: cond, else: value }: when cond is falsy the
+// enclosing block returns value (null when else is omitted).
+type EnsureStmt struct {
+	Span Span
+	That Expr
+	Else Expr // nil when omitted
+}
+
+func (n *EnsureStmt) Kind() string    { return "EnsureStmt" }
+func (n *EnsureStmt) NodeSpan() Span  { return n.Span }
+func (n *EnsureStmt) stmtNode()       {}
+
 type FnDecl struct {
-	Span   Span
-	Name   string
-	Params []string
-	Body   []Stmt
+	Span       Span
+	Name       string
+	Params     []string
+	Body       []Stmt
+	Exported   bool   // declared as "export fn"
+	Deprecated string // message of an @deprecated annotation, or ""
+	Memo       bool   // annotated @memo: results are cached by arguments
 }
 
 func (n *FnDecl) Kind() string    { return "FnDecl" }
 func (n *FnDecl) NodeSpan() Span  { return n.Span }
 func (n *FnDecl) stmtNode()       {}
 
+// ExportDecl is an "export { a, b }" footer naming the fns a module exposes.
+type ExportDecl struct {
+	Span  Span
+	Names []string
+}
+
+func (n *ExportDecl) Kind() string    { return "ExportDecl" }
+func (n *ExportDecl) NodeSpan() Span  { return n.Span }
+func (n *ExportDecl) stmtNode()       {}
+
 // --- Headers ---
 
 type CapDecl struct {
@@ -392,10 +467,24 @@ func (n *BudgetDecl) Kind() string    { return "BudgetDecl" }
 func (n *BudgetDecl) NodeSpan() Span  { return n.Span }
 func (n *BudgetDecl) headerNode()     {}
 
+// MetaDecl is the meta { name, version, description, author } header that
+// describes a program for catalogues; it has no effect on execution.
+type MetaDecl struct {
+	Span   Span
+	Fields *RecordExpr
+}
+
+func (n *MetaDecl) Kind() string    { return "MetaDecl" }
+func (n *MetaDecl) NodeSpan() Span  { return n.Span }
+func (n *MetaDecl) headerNode()     {}
+
 type ImportDecl struct {
 	Span  Span
 	Path  string
 	Alias string
+	// Budget optionally caps what the module may consume of the importer's
+	// budget: import "m.a0" as m budget { maxToolCalls: 3 }.
+	Budget *RecordExpr
 }
 
 func (n *ImportDecl) Kind() string    { return "ImportDecl" }
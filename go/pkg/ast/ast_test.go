@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/parser"
 )
 
 func TestNodeKinds(t *testing.T) {
@@ -29,3 +30,42 @@ func TestNodeKinds(t *testing.T) {
 		}
 	}
 }
+
+func TestInspect(t *testing.T) {
+	prog, diags := parser.Parse(`cap { http.get: true }
+fn f { x } {
+  let y = if { cond: x > 1, then: [x], else: { ...x } }
+  return y
+}
+let r = call? http.get { url: "u" }
+return { r: r }`, "test.a0")
+	if len(diags) > 0 {
+		t.Fatalf("parse errors: %v", diags)
+	}
+
+	kinds := map[string]int{}
+	ast.Inspect(prog, func(n ast.Node) bool {
+		kinds[n.Kind()]++
+		return true
+	})
+	for _, k := range []string{"Program", "CapDecl", "FnDecl", "IfExpr", "BinaryExpr", "SpreadPair", "CallExpr", "ReturnStmt"} {
+		if kinds[k] == 0 {
+			t.Errorf("Inspect did not visit %s (visited %v)", k, kinds)
+		}
+	}
+
+	// Returning false prunes the subtree.
+	var sawBinary bool
+	ast.Inspect(prog, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FnDecl); ok {
+			return false
+		}
+		if _, ok := n.(*ast.BinaryExpr); ok {
+			sawBinary = true
+		}
+		return true
+	})
+	if sawBinary {
+		t.Error("expected FnDecl body to be skipped")
+	}
+}
@@ -0,0 +1,68 @@
+package ast
+
+// ExportedFns returns every top-level fn declared in p, mapped to whether it
+// is exported, either as "export fn" or by name in an "export { ... }" footer.
+func ExportedFns(p *Program) map[string]bool {
+	fns := make(map[string]bool)
+	for _, stmt := range p.Statements {
+		if fn, ok := stmt.(*FnDecl); ok {
+			fns[fn.Name] = fns[fn.Name] || fn.Exported
+		}
+	}
+	for _, stmt := range p.Statements {
+		if exp, ok := stmt.(*ExportDecl); ok {
+			for _, name := range exp.Names {
+				if _, defined := fns[name]; defined {
+					fns[name] = true
+				}
+			}
+		}
+	}
+	return fns
+}
+
+// ProgramMeta is the content of a program's meta { ... } header.
+type ProgramMeta struct {
+	Name        string `json:"name,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	// Deprecated, when set, is why importers should stop using the module.
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// Meta returns the fields of p's meta header, or nil when it has none.
+// Fields that are not string literals are left empty.
+func Meta(p *Program) *ProgramMeta {
+	for _, h := range p.Headers {
+		decl, ok := h.(*MetaDecl)
+		if !ok {
+			continue
+		}
+		m := &ProgramMeta{}
+		for _, entry := range decl.Fields.Pairs {
+			pair, ok := entry.(*RecordPair)
+			if !ok {
+				continue
+			}
+			lit, ok := pair.Value.(*StrLiteral)
+			if !ok {
+				continue
+			}
+			switch pair.Key {
+			case "name":
+				m.Name = lit.Value
+			case "version":
+				m.Version = lit.Value
+			case "description":
+				m.Description = lit.Value
+			case "author":
+				m.Author = lit.Value
+			case "deprecated":
+				m.Deprecated = lit.Value
+			}
+		}
+		return m
+	}
+	return nil
+}
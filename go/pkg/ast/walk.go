@@ -0,0 +1,132 @@
+package ast
+
+// Inspect traverses the AST rooted at node in depth-first order, calling f
+// for each node. If f returns false, Inspect skips the node's children.
+// Nil nodes (e.g. a missing else branch) are not visited.
+func Inspect(node Node, f func(Node) bool) {
+	if isNilNode(node) || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, h := range n.Headers {
+			Inspect(h, f)
+		}
+		inspectStmts(n.Statements, f)
+	case *CapDecl:
+		Inspect(n.Capabilities, f)
+	case *BudgetDecl:
+		Inspect(n.Budget, f)
+	case *MetaDecl:
+		Inspect(n.Fields, f)
+	case *ImportDecl:
+		Inspect(n.Budget, f)
+
+	case *LetStmt:
+		Inspect(n.Value, f)
+	case *ExprStmt:
+		Inspect(n.Expr, f)
+		Inspect(n.Target, f)
+	case *ReturnStmt:
+		Inspect(n.Value, f)
+	case *EnsureStmt:
+		Inspect(n.That, f)
+		Inspect(n.Else, f)
+	case *FnDecl:
+		inspectStmts(n.Body, f)
+
+	case *RecordExpr:
+		for _, entry := range n.Pairs {
+			Inspect(entry, f)
+		}
+	case *RecordPair:
+		Inspect(n.Value, f)
+	case *SpreadPair:
+		Inspect(n.Expr, f)
+	case *ListExpr:
+		for _, el := range n.Elements {
+			Inspect(el, f)
+		}
+	case *CallExpr:
+		Inspect(n.Tool, f)
+		Inspect(n.Args, f)
+	case *DoExpr:
+		Inspect(n.Tool, f)
+		Inspect(n.Args, f)
+	case *AssertExpr:
+		Inspect(n.Args, f)
+	case *CheckExpr:
+		Inspect(n.Args, f)
+	case *FnCallExpr:
+		Inspect(n.Name, f)
+		Inspect(n.Args, f)
+	case *IfExpr:
+		Inspect(n.Cond, f)
+		Inspect(n.Then, f)
+		Inspect(n.Else, f)
+	case *IfBlockExpr:
+		Inspect(n.Cond, f)
+		inspectStmts(n.ThenBody, f)
+		inspectStmts(n.ElseBody, f)
+	case *ForExpr:
+		Inspect(n.List, f)
+		inspectStmts(n.Body, f)
+	case *MatchExpr:
+		Inspect(n.Subject, f)
+		Inspect(n.OkArm, f)
+		Inspect(n.ErrArm, f)
+	case *MatchArm:
+		inspectStmts(n.Body, f)
+	case *TypeMatchExpr:
+		Inspect(n.Subject, f)
+		for _, arm := range n.Arms {
+			Inspect(arm, f)
+		}
+	case *BinaryExpr:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *UnaryExpr:
+		Inspect(n.Operand, f)
+	case *IndexExpr:
+		Inspect(n.Target, f)
+		Inspect(n.Index, f)
+	case *TryExpr:
+		inspectStmts(n.TryBody, f)
+		inspectStmts(n.CatchBody, f)
+	case *TransactionExpr:
+		inspectStmts(n.Body, f)
+	case *FilterBlockExpr:
+		Inspect(n.List, f)
+		inspectStmts(n.Body, f)
+	case *FindBlockExpr:
+		Inspect(n.List, f)
+		inspectStmts(n.Body, f)
+	case *LoopExpr:
+		Inspect(n.Init, f)
+		Inspect(n.Times, f)
+		inspectStmts(n.Body, f)
+	}
+}
+
+func inspectStmts(stmts []Stmt, f func(Node) bool) {
+	for _, s := range stmts {
+		Inspect(s, f)
+	}
+}
+
+// isNilNode reports whether node is nil or a typed nil pointer, which is how
+// optional children such as ExprStmt.Target are stored.
+func isNilNode(node Node) bool {
+	switch n := node.(type) {
+	case nil:
+		return true
+	case *IdentPath:
+		return n == nil
+	case *RecordExpr:
+		return n == nil
+	case *MatchArm:
+		return n == nil
+	}
+	return false
+}
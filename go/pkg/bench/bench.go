@@ -0,0 +1,182 @@
+// Package bench holds stress benchmarks for the parser and evaluator:
+// synthetic 10k-statement programs, a 1M-iteration loop and deep recursion.
+// Each case has an allocation budget, so a change that makes the evaluator
+// or parser allocate much more per run shows up as a failure rather than a
+// slowdown someone has to notice.
+//
+// go test -bench . ./pkg/bench runs the cases as Go benchmarks, and
+// a0 bench --self runs them from the a0 binary:
+//
+//	for _, r := range bench.Run("") {
+//		fmt.Println(r.Name, r.NsPerOp, r.AllocsPerOp, r.OverBudget)
+//	}
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/parser"
+	"github.com/thomasrohde/agent0/go/pkg/stdlib"
+	"github.com/thomasrohde/agent0/go/pkg/validator"
+)
+
+// Case is one benchmark. MaxAllocs is its allocation budget: the most
+// allocations one op may make before the case counts as a regression.
+type Case struct {
+	Name      string
+	MaxAllocs int64
+	Bench     func(b *testing.B)
+}
+
+// Result is the outcome of running a Case.
+type Result struct {
+	Name        string `json:"name"`
+	Ops         int    `json:"ops"`
+	NsPerOp     int64  `json:"nsPerOp"`
+	BytesPerOp  int64  `json:"bytesPerOp"`
+	AllocsPerOp int64  `json:"allocsPerOp"`
+	MaxAllocs   int64  `json:"maxAllocs"`
+	OverBudget  bool   `json:"overBudget"`
+	// Error is set when the case's program failed, which makes its
+	// numbers meaningless.
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	bigProgramStmts = 10000
+	loopIterations  = 1000000
+	recursionDepth  = 10000
+)
+
+// Cases returns the benchmark cases in a fixed order. The budgets leave
+// about 50% headroom over the allocations measured when they were set.
+func Cases() []Case {
+	big := StatementsProgram(bigProgramStmts)
+	loop := fmt.Sprintf(`let xs = for { in: range { from: 0, to: %d }, as: "i" } { return i * 2 }
+return len { in: xs }`, loopIterations)
+	recursion := fmt.Sprintf(`fn down { n } {
+  ensure { that: n > 0, else: 0 }
+  return down { n: n - 1 }
+}
+return down { n: %d }`, recursionDepth)
+
+	return []Case{
+		{Name: "parse/10k-statements", MaxAllocs: 1300, Bench: parseBench(big)},
+		{Name: "check/10k-statements", MaxAllocs: 1000, Bench: checkBench(big)},
+		{Name: "exec/10k-statements", MaxAllocs: 14000, Bench: execBench(big)},
+		{Name: "exec/1m-loop", MaxAllocs: 4500000, Bench: execBench(loop)},
+		{Name: "exec/deep-recursion", MaxAllocs: 150000, Bench: execBench(recursion)},
+	}
+}
+
+// StatementsProgram returns a program of n let statements, each reading
+// the one before it, followed by a return.
+func StatementsProgram(n int) string {
+	var sb strings.Builder
+	sb.WriteString("let v0 = 0\n")
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(&sb, "let v%d = v%d + 1\n", i, i-1)
+	}
+	fmt.Fprintf(&sb, "return { last: v%d }\n", n-1)
+	return sb.String()
+}
+
+// Run benchmarks the cases whose name contains filter ("" runs all).
+func Run(filter string) []Result {
+	var results []Result
+	for _, c := range Cases() {
+		if !strings.Contains(c.Name, filter) {
+			continue
+		}
+		results = append(results, RunCase(c))
+	}
+	return results
+}
+
+// RunCase benchmarks c with testing.Benchmark and checks its budget.
+func RunCase(c Case) Result {
+	var failure string
+	br := testing.Benchmark(func(b *testing.B) {
+		defer func() {
+			if r := recover(); r != nil {
+				failure = fmt.Sprint(r)
+			}
+		}()
+		c.Bench(b)
+	})
+	r := Result{
+		Name:        c.Name,
+		Ops:         br.N,
+		NsPerOp:     br.NsPerOp(),
+		BytesPerOp:  br.AllocedBytesPerOp(),
+		AllocsPerOp: br.AllocsPerOp(),
+		MaxAllocs:   c.MaxAllocs,
+		Error:       failure,
+	}
+	r.OverBudget = r.AllocsPerOp > c.MaxAllocs
+	return r
+}
+
+func parseBench(source string) func(b *testing.B) {
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, diags := parser.Parse(source, "bench.a0"); len(diags) > 0 {
+				panic("parse: " + diags[0].Message)
+			}
+		}
+	}
+}
+
+func checkBench(source string) func(b *testing.B) {
+	return func(b *testing.B) {
+		program := mustParse(source)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			validator.Validate(program)
+		}
+	}
+}
+
+func execBench(source string) func(b *testing.B) {
+	return func(b *testing.B) {
+		program := mustParse(source)
+		opts := evaluator.ExecOptions{Stdlib: stdlibMap()}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := evaluator.Execute(context.Background(), program, opts); err != nil {
+				panic("exec: " + err.Error())
+			}
+		}
+	}
+}
+
+// mustParse parses and validates source, panicking on diagnostics: the
+// cases' programs are fixed, so a diagnostic is a bug in this package.
+func mustParse(source string) *ast.Program {
+	program, diags := parser.Parse(source, "bench.a0")
+	if len(diags) > 0 {
+		panic("parse: " + diags[0].Message)
+	}
+	if diags := validator.Validate(program); len(diags) > 0 && !diags[0].IsWarning() {
+		panic("validate: " + diags[0].Message)
+	}
+	return program
+}
+
+func stdlibMap() map[string]*evaluator.StdlibFn {
+	reg := stdlib.NewRegistry()
+	stdlib.RegisterDefaults(reg)
+	out := make(map[string]*evaluator.StdlibFn)
+	for name, fn := range reg.All() {
+		out[name] = &evaluator.StdlibFn{Name: name, Execute: fn.Execute, Deprecated: fn.Deprecated}
+	}
+	return out
+}
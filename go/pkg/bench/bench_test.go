@@ -0,0 +1,15 @@
+package bench_test
+
+import (
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/bench"
+)
+
+// BenchmarkStress runs every case; compare allocs/op with the case's
+// MaxAllocs, or run a0 bench --self to have it checked.
+func BenchmarkStress(b *testing.B) {
+	for _, c := range bench.Cases() {
+		b.Run(c.Name, c.Bench)
+	}
+}
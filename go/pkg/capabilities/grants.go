@@ -0,0 +1,194 @@
+package capabilities
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/internal/filelock"
+)
+
+// Grant is an entry of the policy's "grants" section: a capability allowed
+// only until a deadline, or only for a number of runs, or both.
+type Grant struct {
+	// Until is when the grant lapses; nil means it does not expire.
+	Until *time.Time `json:"until,omitempty"`
+	// Uses is how many runs may use the grant; 0 means unlimited.
+	Uses int `json:"uses,omitempty"`
+}
+
+// grantLedger counts how often each counted grant has been used. Counts are
+// kept in a JSON file (~/.a0/grant_uses.json) so one-shot grants stay
+// consumed across a0 invocations; with no file they are kept in memory.
+type grantLedger struct {
+	mu     sync.Mutex
+	path   string
+	memory map[string]int
+}
+
+// memoryLedger counts uses for policies that were not loaded from a file.
+var memoryLedger = &grantLedger{memory: make(map[string]int)}
+
+func newGrantLedger() *grantLedger {
+	l := &grantLedger{memory: make(map[string]int)}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		l.path = filepath.Join(homeDir, ".a0", "grant_uses.json")
+	}
+	return l
+}
+
+// peek returns the number of recorded uses of key without adding one.
+func (l *grantLedger) peek(key string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.path == "" {
+		return l.memory[key], nil
+	}
+	counts, err := l.load()
+	return counts[key], err
+}
+
+// load reads the use counts from the ledger file; the caller holds l.mu.
+// The file is only ever replaced by rename, so reading it needs no lock.
+func (l *grantLedger) load() (map[string]int, error) {
+	counts := make(map[string]int)
+	if data, err := os.ReadFile(l.path); err == nil {
+		if err := json.Unmarshal(data, &counts); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// take records one use of key and returns the number of earlier uses, or
+// an error when the ledger cannot be updated. The ledger file is updated
+// under a lock on grant_uses.json.lock, so concurrent a0 runs cannot both
+// spend the last use, and is replaced by rename so a crash cannot leave it
+// half written.
+func (l *grantLedger) take(key string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.path == "" {
+		used := l.memory[key]
+		l.memory[key] = used + 1
+		return used, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return 0, err
+	}
+	lock, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+	if err := filelock.Lock(lock); err != nil {
+		return 0, fmt.Errorf("cannot lock %s: %w", l.path, err)
+	}
+	defer filelock.Unlock(lock)
+
+	counts, err := l.load()
+	if err != nil {
+		return 0, err
+	}
+	used := counts[key]
+	counts[key] = used + 1
+	data, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return used, writeLedger(l.path, data)
+}
+
+// writeLedger replaces the ledger file with data via a temporary file.
+func writeLedger(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".grant_uses-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// UseGrant enforces the grant for capability, if the policy has one, and
+// counts the use. It is called once per run for each declared capability
+// and returns an error describing why a lapsed grant no longer applies.
+// Capabilities without a grant are left to Allowed.
+func (p *Policy) UseGrant(capability string, now time.Time) error {
+	return p.checkGrant(capability, now, true)
+}
+
+// CheckGrant is UseGrant without counting a use: it reports why the grant
+// for capability, if any, would not apply to a run at now.
+func (p *Policy) CheckGrant(capability string, now time.Time) error {
+	return p.checkGrant(capability, now, false)
+}
+
+// PermitsTool reports whether a run at now may call a tool that requires
+// capability and the also capabilities, as the runtime enforces it: each
+// must be allowed and must not rest on an expired or used-up grant.
+func (p *Policy) PermitsTool(capability string, also []string, now time.Time) bool {
+	if p != nil && p.Allowed == nil {
+		return true // AllowAll
+	}
+	for _, c := range append([]string{capability}, also...) {
+		if !p.IsAllowed(c) || p.CheckGrant(c, now) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) checkGrant(capability string, now time.Time, use bool) error {
+	if p == nil {
+		return nil
+	}
+	grant, ok := p.Grants[capability]
+	if !ok {
+		return nil
+	}
+	if grant.Until != nil && !now.Before(*grant.Until) {
+		return fmt.Errorf("grant for '%s' expired at %s", capability, grant.Until.UTC().Format(time.RFC3339))
+	}
+	if grant.Uses <= 0 {
+		return nil
+	}
+	// The key includes the grant itself so that re-issuing it with a new
+	// count or deadline starts a fresh tally.
+	key := fmt.Sprintf("%s#%s#%d", p.source, capability, grant.Uses)
+	if grant.Until != nil {
+		key += "#" + grant.Until.UTC().Format(time.RFC3339)
+	}
+	ledger := p.ledger
+	if ledger == nil {
+		ledger = memoryLedger
+	}
+	take, what := ledger.peek, "read uses"
+	if use {
+		take, what = ledger.take, "record use"
+	}
+	used, err := take(key)
+	if err != nil {
+		return fmt.Errorf("grant for '%s': cannot %s: %w", capability, what, err)
+	}
+	if used >= grant.Uses {
+		return fmt.Errorf("grant for '%s' used up (allowed %d uses)", capability, grant.Uses)
+	}
+	return nil
+}
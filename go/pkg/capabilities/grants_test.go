@@ -0,0 +1,204 @@
+package capabilities_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/internal/filelock"
+	"github.com/thomasrohde/agent0/go/pkg/capabilities"
+)
+
+func loadGrants(t *testing.T, project string) *capabilities.Policy {
+	t.Helper()
+	policy, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadPolicyWith: %v", err)
+	}
+	return policy
+}
+
+func writePolicy(t *testing.T, project, policyJSON string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(project, ".a0policy.json"), []byte(policyJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrants_Expiry(t *testing.T) {
+	_, project := policyHome(t, `{"grants":{"fs.write":{"until":"2026-01-01T00:00:00Z"}}}`)
+	policy := loadGrants(t, project)
+	if !policy.IsAllowed("fs.write") {
+		t.Fatal("a granted capability should be allowed")
+	}
+
+	before := time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC)
+	if err := policy.UseGrant("fs.write", before); err != nil {
+		t.Errorf("grant should apply before its deadline, got %v", err)
+	}
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := policy.UseGrant("fs.write", at)
+	if err == nil || !strings.Contains(err.Error(), "grant for 'fs.write' expired at 2026-01-01T00:00:00Z") {
+		t.Errorf("expected the grant to expire at its deadline, got %v", err)
+	}
+	if err := policy.UseGrant("fs.read", at); err != nil {
+		t.Errorf("capabilities without a grant are not checked, got %v", err)
+	}
+}
+
+func TestGrants_UsesPersistAcrossReloads(t *testing.T) {
+	home, project := policyHome(t, `{"grants":{"sh.exec":{"uses":2}}}`)
+	now := time.Now()
+
+	// Each load gets a fresh ledger, as a new a0 run would.
+	for i := 0; i < 2; i++ {
+		if err := loadGrants(t, project).UseGrant("sh.exec", now); err != nil {
+			t.Fatalf("use %d: %v", i+1, err)
+		}
+	}
+	err := loadGrants(t, project).UseGrant("sh.exec", now)
+	if err == nil || !strings.Contains(err.Error(), "used up (allowed 2 uses)") {
+		t.Fatalf("expected the grant to be used up, got %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".a0", "grant_uses.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counts map[string]int
+	if err := json.Unmarshal(data, &counts); err != nil {
+		t.Fatalf("ledger is not valid JSON: %v\n%s", err, data)
+	}
+	if len(counts) != 1 {
+		t.Fatalf("expected one ledger entry, got %v", counts)
+	}
+	for key, n := range counts {
+		if !strings.Contains(key, "sh.exec") || n != 3 {
+			t.Errorf("ledger entry %q = %d, want 3 attempts for sh.exec", key, n)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(home, ".a0", ".grant_uses-*")); len(matches) != 0 {
+		t.Errorf("temporary ledger files left behind: %v", matches)
+	}
+}
+
+func TestGrants_ReissueResetsCount(t *testing.T) {
+	_, project := policyHome(t, `{"grants":{"sh.exec":{"uses":1}}}`)
+	now := time.Now()
+	if err := loadGrants(t, project).UseGrant("sh.exec", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadGrants(t, project).UseGrant("sh.exec", now); err == nil {
+		t.Fatal("expected a one-shot grant to be used up")
+	}
+
+	// Re-issuing the grant with a different count or deadline starts over.
+	writePolicy(t, project, `{"grants":{"sh.exec":{"uses":2}}}`)
+	if err := loadGrants(t, project).UseGrant("sh.exec", now); err != nil {
+		t.Errorf("a re-issued grant should start a fresh tally, got %v", err)
+	}
+	writePolicy(t, project, `{"grants":{"sh.exec":{"uses":2,"until":"2999-01-01T00:00:00Z"}}}`)
+	policy := loadGrants(t, project)
+	for i := 0; i < 2; i++ {
+		if err := policy.UseGrant("sh.exec", now); err != nil {
+			t.Errorf("use %d of the grant with a deadline: %v", i+1, err)
+		}
+	}
+}
+
+func TestGrants_ConcurrentLedgersShareUses(t *testing.T) {
+	_, project := policyHome(t, `{"grants":{"sh.exec":{"uses":3}}}`)
+	now := time.Now()
+
+	// Separate policies open the ledger separately, like separate processes,
+	// so only the file lock keeps them from spending the same use twice.
+	policies := make([]*capabilities.Policy, 10)
+	for i := range policies {
+		policies[i] = loadGrants(t, project)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for _, p := range policies {
+		wg.Add(1)
+		go func(p *capabilities.Policy) {
+			defer wg.Done()
+			if p.UseGrant("sh.exec", now) == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	if granted != 3 {
+		t.Errorf("%d runs used a 3-use grant", granted)
+	}
+}
+
+func TestGrants_WaitsForLedgerLock(t *testing.T) {
+	home, project := policyHome(t, `{"grants":{"sh.exec":{"uses":1}}}`)
+	policy := loadGrants(t, project)
+
+	// Hold the lock as another a0 process would while it updates the ledger.
+	lock, err := os.OpenFile(filepath.Join(home, ".a0", "grant_uses.json.lock"), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Close()
+	if err := filelock.Lock(lock); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- policy.UseGrant("sh.exec", time.Now()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("UseGrant did not wait for the ledger lock (err = %v)", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := filelock.Unlock(lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("UseGrant after the lock was released: %v", err)
+	}
+}
+
+func TestGrants_MalformedLedger(t *testing.T) {
+	home, project := policyHome(t, `{"grants":{"sh.exec":{"uses":1}}}`)
+	ledger := filepath.Join(home, ".a0", "grant_uses.json")
+	if err := os.WriteFile(ledger, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := loadGrants(t, project).UseGrant("sh.exec", time.Now())
+	if err == nil || !strings.Contains(err.Error(), "cannot record use") {
+		t.Errorf("expected a corrupt ledger to deny the grant, got %v", err)
+	}
+}
+
+func TestGrants_CheckDoesNotCountUses(t *testing.T) {
+	_, project := policyHome(t, `{"allow":["fs.read"],"grants":{"sh.exec":{"uses":1}}}`)
+	policy := loadGrants(t, project)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := policy.CheckGrant("sh.exec", now); err != nil {
+			t.Fatalf("check %d: %v", i+1, err)
+		}
+	}
+	if !policy.PermitsTool("sh.exec", nil, now) || policy.PermitsTool("sh.exec", []string{"fs.write"}, now) {
+		t.Error("PermitsTool should require every capability")
+	}
+	if err := policy.UseGrant("sh.exec", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.CheckGrant("sh.exec", now); err == nil || policy.PermitsTool("sh.exec", nil, now) {
+		t.Error("a used-up grant should no longer be permitted")
+	}
+	if !capabilities.AllowAll().PermitsTool("sh.exec", []string{"fs.write"}, now) {
+		t.Error("AllowAll permits every tool")
+	}
+}
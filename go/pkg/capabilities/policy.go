@@ -3,13 +3,49 @@ package capabilities
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // Policy defines which capabilities are allowed for program execution.
 type Policy struct {
 	Allowed map[string]bool
+	// Hosts restricts which hosts network tools may contact. nil means any
+	// host; entries are exact host names or "*.example.com" wildcards.
+	Hosts []string
+	// KVPath is the store file used by kv.* tools ("" for the default).
+	KVPath string
+	// S3 configures the s3.* tools; nil uses the environment defaults.
+	S3 *S3Policy
+	// StrictBool makes conditions require booleans instead of truthiness.
+	StrictBool bool
+	// Taint lists data-flow rules enforced at tool calls.
+	Taint []TaintRule
+	// Grants allow capabilities until a deadline or for a number of runs;
+	// see UseGrant.
+	Grants map[string]Grant
+
+	source string // policy file path, part of the grant ledger key
+	ledger *grantLedger
+}
+
+// TaintRule forbids data produced by the From tool or capability from being
+// passed to the To tool or capability, e.g. http.get -> sh.exec. Either side
+// may be "*".
+type TaintRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// S3Policy is the "s3" section of a policy file. Credentials are not part of
+// the policy; they come from the environment or runtime.WithS3Credentials.
+type S3Policy struct {
+	Endpoint string   `json:"endpoint,omitempty"`
+	Region   string   `json:"region,omitempty"`
+	Buckets  []string `json:"buckets,omitempty"`
 }
 
 // PolicyFile represents the JSON structure of a policy file.
@@ -17,6 +53,81 @@ type PolicyFile struct {
 	Allow  []string       `json:"allow,omitempty"`
 	Deny   []string       `json:"deny,omitempty"`
 	Limits map[string]any `json:"limits,omitempty"`
+	Hosts  []string       `json:"hosts,omitempty"`
+	KVPath string         `json:"kvPath,omitempty"`
+	S3     *S3Policy      `json:"s3,omitempty"`
+	// StrictBool enables strict boolean conditions for every run.
+	StrictBool bool        `json:"strictBool,omitempty"`
+	Taint      []TaintRule `json:"taint,omitempty"`
+	// Grants allow capabilities with an expiry or a use count, e.g.
+	// "sh.exec": { "until": "2025-07-01T00:00:00Z", "uses": 1 }.
+	Grants map[string]Grant `json:"grants,omitempty"`
+	// RequireSignedProjectPolicy, honored in the user policy only, refuses
+	// project policies that are not signed by a trusted key.
+	RequireSignedProjectPolicy bool `json:"requireSignedProjectPolicy,omitempty"`
+	// Profiles are named variants (dev, ci, prod) selected with
+	// LoadOptions.Profile or A0_PROFILE; see WithProfile.
+	Profiles map[string]*PolicyFile `json:"profiles,omitempty"`
+}
+
+// ProfileEnv names the environment variable that selects a policy profile
+// when LoadOptions.Profile is empty.
+const ProfileEnv = "A0_PROFILE"
+
+// WithProfile returns the policy file with the named profile applied. Each
+// field the profile sets replaces the top-level one; unset fields are
+// inherited, and strictBool can only be turned on. Profiles do not nest.
+func (pf *PolicyFile) WithProfile(name string) (*PolicyFile, error) {
+	profile := pf.Profiles[name]
+	if profile == nil {
+		names := make([]string, 0, len(pf.Profiles))
+		for n := range pf.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown policy profile '%s': the policy defines no profiles", name)
+		}
+		return nil, fmt.Errorf("unknown policy profile '%s'; available: %s", name, strings.Join(names, ", "))
+	}
+	merged := *pf
+	merged.Profiles = nil
+	if profile.Allow != nil {
+		merged.Allow = profile.Allow
+	}
+	if profile.Deny != nil {
+		merged.Deny = profile.Deny
+	}
+	if profile.Limits != nil {
+		merged.Limits = profile.Limits
+	}
+	if profile.Hosts != nil {
+		merged.Hosts = profile.Hosts
+	}
+	if profile.KVPath != "" {
+		merged.KVPath = profile.KVPath
+	}
+	if profile.S3 != nil {
+		merged.S3 = profile.S3
+	}
+	if profile.Taint != nil {
+		merged.Taint = profile.Taint
+	}
+	if profile.Grants != nil {
+		merged.Grants = profile.Grants
+	}
+	merged.StrictBool = merged.StrictBool || profile.StrictBool
+	return &merged, nil
+}
+
+// LoadOptions controls how LoadPolicyWith resolves the policy.
+type LoadOptions struct {
+	// RequireSigned refuses a project policy that is not signed by a key in
+	// the trusted keys file (see TrustedKeysPath).
+	RequireSigned bool
+	// Profile selects a named profile of the policy; "" falls back to the
+	// A0_PROFILE environment variable, then to the top-level policy.
+	Profile string
 }
 
 // IsAllowed checks whether a capability is permitted by this policy.
@@ -29,24 +140,81 @@ func (p *Policy) IsAllowed(cap string) bool {
 
 // LoadPolicy loads capability policies from project and user config files.
 // Policy precedence: project (.a0policy.json) → user (~/.a0/policy.json) → deny-all default.
+// A project policy refused for lack of a valid signature yields deny-all.
 func LoadPolicy(projectDir string) (*Policy, *PolicyFile) {
+	policy, pf, err := LoadPolicyWith(projectDir, LoadOptions{})
+	if err != nil {
+		return DenyAll(), nil
+	}
+	return policy, pf
+}
+
+// LoadPolicyWith is LoadPolicy with options. It returns an error when a
+// signature is required, either by opts or by the user policy's
+// requireSignedProjectPolicy, and the project policy does not verify, or
+// when the selected profile does not exist.
+func LoadPolicyWith(projectDir string, opts LoadOptions) (*Policy, *PolicyFile, error) {
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv(ProfileEnv)
+	}
+
+	var userPolicy *PolicyFile
+	userPath := ""
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		userPath = filepath.Join(homeDir, ".a0", "policy.json")
+		userPolicy, _ = loadPolicyFile(userPath)
+	}
+
 	// Try project policy
 	projectPath := filepath.Join(projectDir, ".a0policy.json")
 	if pf, err := loadPolicyFile(projectPath); err == nil {
-		return buildPolicy(pf), pf
+		if opts.RequireSigned || (userPolicy != nil && userPolicy.RequireSignedProjectPolicy) {
+			if err := verifyWithTrustedKeys(projectPath); err != nil {
+				return nil, nil, fmt.Errorf("refusing %s: %w", projectPath, err)
+			}
+		}
+		return withProfile(pf, profile, projectPath)
 	}
 
 	// Try user policy
-	homeDir, err := os.UserHomeDir()
-	if err == nil {
-		userPath := filepath.Join(homeDir, ".a0", "policy.json")
-		if pf, err := loadPolicyFile(userPath); err == nil {
-			return buildPolicy(pf), pf
-		}
+	if userPolicy != nil {
+		return withProfile(userPolicy, profile, userPath)
 	}
 
 	// Default: deny all
-	return DenyAll(), nil
+	if profile != "" {
+		return nil, nil, fmt.Errorf("unknown policy profile '%s': no policy file found", profile)
+	}
+	return DenyAll(), nil, nil
+}
+
+func withProfile(pf *PolicyFile, profile, path string) (*Policy, *PolicyFile, error) {
+	if profile != "" {
+		var err error
+		if pf, err = pf.WithProfile(profile); err != nil {
+			return nil, nil, err
+		}
+	}
+	policy := buildPolicy(pf)
+	if len(policy.Grants) > 0 {
+		policy.source = path
+		policy.ledger = newGrantLedger()
+	}
+	return policy, pf, nil
+}
+
+func verifyWithTrustedKeys(path string) error {
+	keysPath, err := TrustedKeysPath()
+	if err != nil {
+		return err
+	}
+	keys, err := LoadTrustedKeys(keysPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err = VerifyPolicyFile(path, keys)
+	return err
 }
 
 func loadPolicyFile(path string) (*PolicyFile, error) {
@@ -69,12 +237,17 @@ func buildPolicy(pf *PolicyFile) *Policy {
 		allowed[cap] = true
 	}
 
+	// Grants allow too, subject to UseGrant at run time
+	for cap := range pf.Grants {
+		allowed[cap] = true
+	}
+
 	// Deny overrides allow
 	for _, cap := range pf.Deny {
 		delete(allowed, cap)
 	}
 
-	return &Policy{Allowed: allowed}
+	return &Policy{Allowed: allowed, Hosts: pf.Hosts, KVPath: pf.KVPath, S3: pf.S3, StrictBool: pf.StrictBool, Taint: pf.Taint, Grants: pf.Grants}
 }
 
 // AllowAll returns a policy that permits all capabilities. Used for --unsafe-allow-all.
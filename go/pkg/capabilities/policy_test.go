@@ -0,0 +1,105 @@
+package capabilities_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/capabilities"
+)
+
+// policyHome points the user config at a fresh home directory and returns
+// it with a project directory holding policyJSON.
+func policyHome(t *testing.T, policyJSON string) (home, project string) {
+	t.Helper()
+	home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(capabilities.ProfileEnv, "")
+	if err := os.MkdirAll(filepath.Join(home, ".a0"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	project = t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, ".a0policy.json"), []byte(policyJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return home, project
+}
+
+const profilesPolicy = `{
+  "allow": ["fs.read", "http.get"],
+  "hosts": ["api.example.com"],
+  "limits": { "maxToolCalls": 100 },
+  "profiles": {
+    "ci": { "allow": ["fs.read"], "limits": { "maxToolCalls": 10 }, "strictBool": true },
+    "dev": { "deny": ["http.get"] }
+  }
+}`
+
+func TestProfiles_OverrideAndInherit(t *testing.T) {
+	_, project := policyHome(t, profilesPolicy)
+
+	policy, pf, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{Profile: "ci"})
+	if err != nil {
+		t.Fatalf("LoadPolicyWith ci: %v", err)
+	}
+	if !policy.IsAllowed("fs.read") || policy.IsAllowed("http.get") {
+		t.Errorf("ci allow list not applied: %v", policy.Allowed)
+	}
+	if !reflect.DeepEqual(policy.Hosts, []string{"api.example.com"}) {
+		t.Errorf("ci should inherit hosts, got %v", policy.Hosts)
+	}
+	if !policy.StrictBool {
+		t.Errorf("ci should turn on strictBool")
+	}
+	if pf.Limits["maxToolCalls"] != float64(10) || pf.Profiles != nil {
+		t.Errorf("ci limits = %v, profiles = %v", pf.Limits, pf.Profiles)
+	}
+
+	// A profile's deny list applies on top of the inherited allow list.
+	policy, _, _ = capabilities.LoadPolicyWith(project, capabilities.LoadOptions{Profile: "dev"})
+	if !policy.IsAllowed("fs.read") || policy.IsAllowed("http.get") {
+		t.Errorf("dev policy = %v", policy.Allowed)
+	}
+
+	policy, pf, _ = capabilities.LoadPolicyWith(project, capabilities.LoadOptions{})
+	if !policy.IsAllowed("http.get") || pf.Limits["maxToolCalls"] != float64(100) {
+		t.Errorf("without a profile the top-level policy should apply")
+	}
+}
+
+func TestProfiles_SelectedByEnvironment(t *testing.T) {
+	_, project := policyHome(t, profilesPolicy)
+	t.Setenv(capabilities.ProfileEnv, "dev")
+	policy, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{})
+	if err != nil || policy.IsAllowed("http.get") {
+		t.Errorf("A0_PROFILE=dev not applied: %v, %v", policy, err)
+	}
+	// An explicit profile wins over the environment.
+	policy, _, _ = capabilities.LoadPolicyWith(project, capabilities.LoadOptions{Profile: "ci"})
+	if !policy.StrictBool {
+		t.Errorf("LoadOptions.Profile should take precedence over A0_PROFILE")
+	}
+}
+
+func TestProfiles_UnknownProfile(t *testing.T) {
+	_, project := policyHome(t, profilesPolicy)
+	_, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{Profile: "prod"})
+	if err == nil || !strings.Contains(err.Error(), "unknown policy profile 'prod'; available: ci, dev") {
+		t.Errorf("expected the available profiles to be listed, got %v", err)
+	}
+
+	_, project = policyHome(t, `{"allow":[]}`)
+	_, _, err = capabilities.LoadPolicyWith(project, capabilities.LoadOptions{Profile: "ci"})
+	if err == nil || !strings.Contains(err.Error(), "the policy defines no profiles") {
+		t.Errorf("expected a policy without profiles to be reported, got %v", err)
+	}
+
+	os.Remove(filepath.Join(project, ".a0policy.json"))
+	_, _, err = capabilities.LoadPolicyWith(project, capabilities.LoadOptions{Profile: "ci"})
+	if err == nil || !strings.Contains(err.Error(), "no policy file found") {
+		t.Errorf("expected a missing policy file to be reported, got %v", err)
+	}
+}
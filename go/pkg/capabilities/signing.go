@@ -0,0 +1,149 @@
+package capabilities
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SignatureSuffix is appended to a policy file's path to find its detached
+// signature, e.g. .a0policy.json.sig.
+const SignatureSuffix = ".sig"
+
+var (
+	// ErrUnsigned means the policy file has no signature file next to it.
+	ErrUnsigned = errors.New("policy is not signed")
+	// ErrBadSignature means no trusted key verifies the policy's signature.
+	ErrBadSignature = errors.New("policy signature does not match any trusted key")
+	// ErrNoTrustedKeys means the trusted keys file is missing or empty.
+	ErrNoTrustedKeys = errors.New("no trusted keys configured")
+)
+
+// TrustedKey is one entry of the trusted keys file.
+type TrustedKey struct {
+	Name string
+	Key  ed25519.PublicKey
+}
+
+// TrustedKeysPath returns the user-level trusted keys file, ~/.a0/trusted_keys.
+func TrustedKeysPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".a0", "trusted_keys"), nil
+}
+
+// LoadTrustedKeys reads a trusted keys file: one base64 Ed25519 public key
+// per line, optionally followed by a name. Blank lines and lines starting
+// with # are ignored.
+func LoadTrustedKeys(path string) ([]TrustedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []TrustedKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		raw, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: not a base64 Ed25519 public key", path, line)
+		}
+		key := TrustedKey{Key: ed25519.PublicKey(raw)}
+		if len(fields) > 1 {
+			key.Name = strings.Join(fields[1:], " ")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// VerifyPolicyFile checks the detached signature of the policy file at path
+// against keys and returns the key that signed it.
+func VerifyPolicyFile(path string, keys []TrustedKey) (*TrustedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sigText, err := os.ReadFile(path + SignatureSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnsigned
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoTrustedKeys
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigText)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%s%s: not a base64 Ed25519 signature", path, SignatureSuffix)
+	}
+	for i := range keys {
+		if ed25519.Verify(keys[i].Key, data, sig) {
+			return &keys[i], nil
+		}
+	}
+	return nil, ErrBadSignature
+}
+
+// SignPolicyFile writes the detached signature of the policy file at path
+// using the private key stored in keyPath.
+func SignPolicyFile(path, keyPath string) error {
+	key, err := loadPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return os.WriteFile(path+SignatureSuffix, []byte(sig+"\n"), 0o644)
+}
+
+// GenerateKey writes a new private key to keyPath (readable by the owner
+// only) and returns the base64 public key for the trusted keys file.
+func GenerateKey(keyPath string) (string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(priv)
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(encoded + "\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
+
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s: not a base64 Ed25519 private key", path)
+	}
+	return ed25519.PrivateKey(raw), nil
+}
@@ -0,0 +1,131 @@
+package capabilities_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/capabilities"
+)
+
+// trustNewKey generates a key in dir, adds its public half to the trusted
+// keys file under name and returns the private key path.
+func trustNewKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	keyPath := filepath.Join(dir, name+".key")
+	pub, err := capabilities.GenerateKey(keyPath)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keysPath, _ := capabilities.TrustedKeysPath()
+	f, err := os.OpenFile(keysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("# comment\n\n" + pub + " " + name + "\n")
+	return keyPath
+}
+
+func TestSigning_SignVerifyRoundTrip(t *testing.T) {
+	home, project := policyHome(t, `{"allow":["fs.read"]}`)
+	trustNewKey(t, home, "other")
+	keyPath := trustNewKey(t, home, "ci release")
+	policyPath := filepath.Join(project, ".a0policy.json")
+
+	if err := capabilities.SignPolicyFile(policyPath, keyPath); err != nil {
+		t.Fatalf("SignPolicyFile: %v", err)
+	}
+	keysPath, _ := capabilities.TrustedKeysPath()
+	keys, err := capabilities.LoadTrustedKeys(keysPath)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("LoadTrustedKeys = %d keys, %v", len(keys), err)
+	}
+	key, err := capabilities.VerifyPolicyFile(policyPath, keys)
+	if err != nil {
+		t.Fatalf("VerifyPolicyFile: %v", err)
+	}
+	if key.Name != "ci release" {
+		t.Errorf("verified by %q, want \"ci release\"", key.Name)
+	}
+
+	policy, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{RequireSigned: true})
+	if err != nil || !policy.IsAllowed("fs.read") {
+		t.Errorf("expected the signed policy to load, got %v", err)
+	}
+}
+
+func TestSigning_TamperedPolicyIsRejected(t *testing.T) {
+	home, project := policyHome(t, `{"allow":["fs.read"]}`)
+	keyPath := trustNewKey(t, home, "ci")
+	policyPath := filepath.Join(project, ".a0policy.json")
+	capabilities.SignPolicyFile(policyPath, keyPath)
+
+	os.WriteFile(policyPath, []byte(`{"allow":["fs.read","sh.exec"]}`), 0o644)
+	keysPath, _ := capabilities.TrustedKeysPath()
+	keys, _ := capabilities.LoadTrustedKeys(keysPath)
+	if _, err := capabilities.VerifyPolicyFile(policyPath, keys); !errors.Is(err, capabilities.ErrBadSignature) {
+		t.Errorf("VerifyPolicyFile on a tampered policy = %v, want ErrBadSignature", err)
+	}
+	if _, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{RequireSigned: true}); !errors.Is(err, capabilities.ErrBadSignature) {
+		t.Errorf("LoadPolicyWith on a tampered policy = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestSigning_UntrustedKeyIsRejected(t *testing.T) {
+	home, project := policyHome(t, `{"allow":[]}`)
+	trustNewKey(t, home, "trusted")
+	rogue := filepath.Join(home, "rogue.key")
+	if _, err := capabilities.GenerateKey(rogue); err != nil {
+		t.Fatal(err)
+	}
+	capabilities.SignPolicyFile(filepath.Join(project, ".a0policy.json"), rogue)
+	if _, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{RequireSigned: true}); !errors.Is(err, capabilities.ErrBadSignature) {
+		t.Errorf("LoadPolicyWith signed by an untrusted key = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestSigning_UnsignedPolicyRefusedWhenRequired(t *testing.T) {
+	home, project := policyHome(t, `{"allow":["fs.read"]}`)
+	trustNewKey(t, home, "ci")
+
+	// Signatures are optional by default.
+	policy, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{})
+	if err != nil || !policy.IsAllowed("fs.read") {
+		t.Fatalf("expected the unsigned policy to load, got %v", err)
+	}
+
+	if _, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{RequireSigned: true}); !errors.Is(err, capabilities.ErrUnsigned) {
+		t.Errorf("LoadPolicyWith RequireSigned = %v, want ErrUnsigned", err)
+	}
+
+	// The user policy can require signatures too.
+	os.WriteFile(filepath.Join(home, ".a0", "policy.json"), []byte(`{"allow":[],"requireSignedProjectPolicy":true}`), 0o644)
+	if _, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{}); !errors.Is(err, capabilities.ErrUnsigned) {
+		t.Errorf("LoadPolicyWith with requireSignedProjectPolicy = %v, want ErrUnsigned", err)
+	}
+	if policy, _ := capabilities.LoadPolicy(project); policy.IsAllowed("fs.read") {
+		t.Errorf("LoadPolicy should fall back to deny-all for a refused project policy")
+	}
+}
+
+func TestSigning_NoTrustedKeys(t *testing.T) {
+	home, project := policyHome(t, `{"allow":[]}`)
+	keyPath := filepath.Join(home, "k.key")
+	capabilities.GenerateKey(keyPath)
+	capabilities.SignPolicyFile(filepath.Join(project, ".a0policy.json"), keyPath)
+	if _, _, err := capabilities.LoadPolicyWith(project, capabilities.LoadOptions{RequireSigned: true}); !errors.Is(err, capabilities.ErrNoTrustedKeys) {
+		t.Errorf("LoadPolicyWith without a trusted keys file = %v, want ErrNoTrustedKeys", err)
+	}
+}
+
+func TestSigning_LoadTrustedKeysRejectsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trusted_keys")
+	os.WriteFile(path, []byte("# keys\nnot-a-key ci\n"), 0o644)
+	_, err := capabilities.LoadTrustedKeys(path)
+	if err == nil || !strings.Contains(err.Error(), ":2: not a base64 Ed25519 public key") {
+		t.Errorf("LoadTrustedKeys = %v, want an error naming line 2", err)
+	}
+}
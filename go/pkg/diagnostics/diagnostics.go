@@ -38,14 +38,52 @@ const (
 	EMatchNoArm     = "E_MATCH_NO_ARM"
 	EType           = "E_TYPE"
 	EIO             = "E_IO"
+	ETrace          = "E_TRACE"
+	EEvidence       = "E_EVIDENCE"
+	EImport         = "E_IMPORT"
+	EImportPrivate  = "E_IMPORT_PRIVATE"
+	EBatch          = "E_BATCH"
+	EPolicy         = "E_POLICY"
+	ECapValue       = "E_CAP_VALUE"
+
+	// Strict-mode diagnostics (see validator.Options.Strict).
+	EImplicitReturn = "E_IMPLICIT_RETURN"
+	EIfNoElse       = "E_IF_NO_ELSE"
+
+	// Advisory diagnostics, always reported as warnings.
+	EUnusedCap      = "E_UNUSED_CAP"
+	EUnsafeAllowAll = "E_UNSAFE_ALLOW_ALL"
+	EDeprecated     = "E_DEPRECATED"
+	ECoercion       = "E_COERCION"
+	EBudgetNear     = "E_BUDGET_NEAR"
+	ENullable       = "E_NULLABLE"
+	EDupKey         = "E_DUP_KEY"
+	ESpreadOverride = "E_SPREAD_OVERRIDE"
+	EShadow         = "E_SHADOW"
+	EDeadBranch     = "E_DEAD_BRANCH"
+	EFloatEq        = "E_FLOAT_EQ"
+	EBudgetZero     = "E_BUDGET_ZERO"
+)
+
+// Severity levels. An empty severity is treated as an error so diagnostics
+// produced before severities existed keep their meaning.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
 )
 
 // Diagnostic represents a parse, validation, or runtime diagnostic.
 type Diagnostic struct {
-	Code    string    `json:"code"`
-	Message string    `json:"message"`
-	Span    *ast.Span `json:"span,omitempty"`
-	Hint    string    `json:"hint,omitempty"`
+	Code     string    `json:"code"`
+	Message  string    `json:"message"`
+	Span     *ast.Span `json:"span,omitempty"`
+	Hint     string    `json:"hint,omitempty"`
+	Severity string    `json:"severity,omitempty"`
+	// Count and Also are set by Group on a diagnostic that stands for
+	// several identical ones: Count is how many, and Also holds the spans
+	// of all but the first.
+	Count int         `json:"count,omitempty"`
+	Also  []*ast.Span `json:"also,omitempty"`
 }
 
 // MakeDiag creates a new Diagnostic.
@@ -58,17 +96,108 @@ func MakeDiag(code, message string, span *ast.Span, hint string) Diagnostic {
 	}
 }
 
+// MakeWarning creates a new Diagnostic with warning severity.
+func MakeWarning(code, message string, span *ast.Span, hint string) Diagnostic {
+	d := MakeDiag(code, message, span, hint)
+	d.Severity = SeverityWarning
+	return d
+}
+
+// IsWarning reports whether the diagnostic is a warning rather than an error.
+func (d Diagnostic) IsWarning() bool {
+	return d.Severity == SeverityWarning
+}
+
+// HasErrors reports whether any diagnostic in the slice is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if !d.IsWarning() {
+			return true
+		}
+	}
+	return false
+}
+
+// Split separates diagnostics into errors and warnings, preserving order.
+func Split(diags []Diagnostic) (errs, warnings []Diagnostic) {
+	for _, d := range diags {
+		if d.IsWarning() {
+			warnings = append(warnings, d)
+		} else {
+			errs = append(errs, d)
+		}
+	}
+	return errs, warnings
+}
+
+// Group merges diagnostics with the same severity, code, message and hint
+// into the first of them, keeping the order of first occurrences, so a
+// mistake repeated across a file is reported once with a count.
+func Group(diags []Diagnostic) []Diagnostic {
+	type key struct {
+		warning             bool
+		code, message, hint string
+	}
+	index := make(map[key]int)
+	out := make([]Diagnostic, 0, len(diags))
+	for _, d := range diags {
+		k := key{d.IsWarning(), d.Code, d.Message, d.Hint}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(out)
+			out = append(out, d)
+			continue
+		}
+		g := &out[i]
+		g.Count = max(g.Count, 1) + max(d.Count, 1)
+		g.Also = append(append(g.Also, d.Span), d.Also...)
+	}
+	return out
+}
+
+// Limit returns at most n of diags, errors before warnings, and how many
+// it left out. It returns diags unchanged when n <= 0 or there are no more
+// than n.
+func Limit(diags []Diagnostic, n int) ([]Diagnostic, int) {
+	if n <= 0 || len(diags) <= n {
+		return diags, 0
+	}
+	errs, warnings := Split(diags)
+	return append(errs, warnings...)[:n], len(diags) - n
+}
+
+// maxAlsoShown is how many of a group's other locations pretty output lists.
+const maxAlsoShown = 5
+
+func formatLoc(span *ast.Span) string {
+	if span == nil {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s:%d:%d", span.File, span.StartLine, span.StartCol)
+}
+
 // FormatDiagnostic formats a single diagnostic for display.
 func FormatDiagnostic(d Diagnostic, pretty bool) string {
 	if !pretty {
 		b, _ := json.Marshal(d)
 		return string(b)
 	}
-	loc := "<unknown>"
-	if d.Span != nil {
-		loc = fmt.Sprintf("%s:%d:%d", d.Span.File, d.Span.StartLine, d.Span.StartCol)
+	label := SeverityError
+	if d.IsWarning() {
+		label = SeverityWarning
+	}
+	out := fmt.Sprintf("%s[%s]: %s\n  --> %s", label, d.Code, d.Message, formatLoc(d.Span))
+	if len(d.Also) > 0 {
+		locs := make([]string, 0, maxAlsoShown+1)
+		for i, span := range d.Also {
+			if i == maxAlsoShown {
+				locs = append(locs, fmt.Sprintf("and %d more", len(d.Also)-maxAlsoShown))
+				break
+			}
+			locs = append(locs, formatLoc(span))
+		}
+		out += fmt.Sprintf("\n  (%d times) also at: %s", max(d.Count, len(d.Also)+1), strings.Join(locs, ", "))
 	}
-	out := fmt.Sprintf("error[%s]: %s\n  --> %s", d.Code, d.Message, loc)
 	if d.Hint != "" {
 		out += fmt.Sprintf("\n  hint: %s", d.Hint)
 	}
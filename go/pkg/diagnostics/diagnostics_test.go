@@ -43,3 +43,66 @@ func TestFormatDiagnosticJSON(t *testing.T) {
 		t.Errorf("expected JSON code in output, got: %s", out)
 	}
 }
+
+func TestFormatWarningPretty(t *testing.T) {
+	span := &ast.Span{File: "test.a0", StartLine: 2, StartCol: 1, EndLine: 2, EndCol: 4}
+	d := diagnostics.MakeWarning(diagnostics.EImplicitReturn, "if body relies on its implicit last-expression value", span, "")
+
+	out := diagnostics.FormatDiagnostic(d, true)
+	if !strings.Contains(out, "warning[E_IMPLICIT_RETURN]") {
+		t.Errorf("expected warning label in output, got: %s", out)
+	}
+}
+
+func TestHasErrorsAndSplit(t *testing.T) {
+	diags := []diagnostics.Diagnostic{
+		diagnostics.MakeWarning(diagnostics.EIfNoElse, "if without else", nil, ""),
+	}
+	if diagnostics.HasErrors(diags) {
+		t.Errorf("expected warnings alone not to count as errors")
+	}
+
+	diags = append(diags, diagnostics.MakeDiag(diagnostics.EParse, "bad", nil, ""))
+	if !diagnostics.HasErrors(diags) {
+		t.Errorf("expected HasErrors to report the error diagnostic")
+	}
+	errs, warnings := diagnostics.Split(diags)
+	if len(errs) != 1 || len(warnings) != 1 {
+		t.Errorf("got %d errors and %d warnings, want 1 and 1", len(errs), len(warnings))
+	}
+}
+
+func TestGroupMergesIdenticalDiagnostics(t *testing.T) {
+	span := func(line int) *ast.Span { return &ast.Span{File: "test.a0", StartLine: line, StartCol: 1} }
+	diags := diagnostics.Group([]diagnostics.Diagnostic{
+		diagnostics.MakeDiag(diagnostics.EUnbound, "unbound variable 'x'", span(1), ""),
+		diagnostics.MakeWarning(diagnostics.EShadow, "shadowed", span(2), ""),
+		diagnostics.MakeDiag(diagnostics.EUnbound, "unbound variable 'x'", span(3), ""),
+		diagnostics.MakeDiag(diagnostics.EUnbound, "unbound variable 'x'", span(4), ""),
+	})
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(diags))
+	}
+	if diags[0].Count != 3 || len(diags[0].Also) != 2 || diags[1].Count != 0 {
+		t.Errorf("expected the first group to count 3, got count %d with %d more spans", diags[0].Count, len(diags[0].Also))
+	}
+	out := diagnostics.FormatDiagnostic(diags[0], true)
+	if !strings.Contains(out, "(3 times) also at: test.a0:3:1, test.a0:4:1") {
+		t.Errorf("expected the other locations in output, got: %s", out)
+	}
+}
+
+func TestLimitKeepsErrorsFirst(t *testing.T) {
+	diags := []diagnostics.Diagnostic{
+		diagnostics.MakeWarning(diagnostics.EShadow, "shadowed", nil, ""),
+		diagnostics.MakeDiag(diagnostics.EParse, "bad", nil, ""),
+		diagnostics.MakeDiag(diagnostics.EUnbound, "unbound", nil, ""),
+	}
+	shown, omitted := diagnostics.Limit(diags, 2)
+	if omitted != 1 || len(shown) != 2 || !diagnostics.HasErrors(shown[1:]) {
+		t.Errorf("expected the two errors to be kept, got %v (%d omitted)", shown, omitted)
+	}
+	if shown, omitted := diagnostics.Limit(diags, 0); len(shown) != 3 || omitted != 0 {
+		t.Errorf("expected no limit to keep all diagnostics")
+	}
+}
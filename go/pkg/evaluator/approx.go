@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// DefaultApproxTolerance is the absolute tolerance used by assert.approx and
+// approxEq when none is given.
+const DefaultApproxTolerance = 1e-9
+
+// ApproxEqual reports whether a and b differ by at most tolerance.
+func ApproxEqual(a, b, tolerance float64) bool {
+	if a == b {
+		return true
+	}
+	return math.Abs(a-b) <= tolerance
+}
+
+// evalAssertApprox implements assert.approx { a, b, tolerance?, msg? }. Like
+// assert it is fatal on failure; the evidence details carry the delta.
+func (ev *evaluator) evalAssertApprox(e *ast.AssertExpr, rec A0Record) (A0Value, error) {
+	span := e.Span
+	num := func(key string) (float64, error) {
+		v, _ := rec.Get(key)
+		n, ok := v.(A0Number)
+		if !ok {
+			return 0, &A0RuntimeError{
+				Code:    diagnostics.EType,
+				Message: fmt.Sprintf("assert.approx requires '%s' to be a number, got %s", key, typeNameOf(v)),
+				Span:    &span,
+			}
+		}
+		return n.Value, nil
+	}
+	a, err := num("a")
+	if err != nil {
+		return nil, err
+	}
+	b, err := num("b")
+	if err != nil {
+		return nil, err
+	}
+	tolerance := DefaultApproxTolerance
+	if _, found := rec.Get("tolerance"); found {
+		if tolerance, err = num("tolerance"); err != nil {
+			return nil, err
+		}
+		if tolerance < 0 {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EType,
+				Message: "assert.approx requires 'tolerance' to be non-negative",
+				Span:    &span,
+			}
+		}
+	}
+	msg := ""
+	if s, ok := rec.Get("msg"); ok {
+		if str, ok := s.(A0String); ok {
+			msg = str.Value
+		}
+	}
+
+	delta := math.Abs(a - b)
+	ok := ApproxEqual(a, b, tolerance)
+	details := NewRecord([]KeyValue{
+		{Key: "a", Value: NewNumber(a)},
+		{Key: "b", Value: NewNumber(b)},
+		{Key: "delta", Value: NewNumber(delta)},
+		{Key: "tolerance", Value: NewNumber(tolerance)},
+	}).(A0Record)
+	ev.recordEvidence(Evidence{
+		Kind:    "assert",
+		OK:      ok,
+		Msg:     msg,
+		Details: &details,
+		Span:    &span,
+	})
+
+	if !ok {
+		return nil, &A0RuntimeError{
+			Code: diagnostics.EAssert,
+			Message: fmt.Sprintf("assertion failed: %s (|%s - %s| = %s > tolerance %s)", msg,
+				FormatNumber(a), FormatNumber(b), FormatNumber(delta), FormatNumber(tolerance)),
+			Span:    &span,
+			Details: &details,
+		}
+	}
+	return NewRecord([]KeyValue{
+		{Key: "kind", Value: NewString("assert")},
+		{Key: "ok", Value: NewBool(true)},
+		{Key: "msg", Value: NewString(msg)},
+		{Key: "delta", Value: NewNumber(delta)},
+	}), nil
+}
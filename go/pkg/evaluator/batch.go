@@ -0,0 +1,303 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// DefaultBatchConcurrency is how many calls call.batch runs at once when
+// concurrency is omitted.
+const DefaultBatchConcurrency = 4
+
+// evalCallBatch implements call.batch { tool, items, argsFn?, concurrency?,
+// continueOnError? }: a call? of a read tool once per item, with at most
+// concurrency calls in flight. Each item is the call's args, or argsFn
+// builds them from it. The result partitions the items:
+//
+//	{ ok: [{ index, item, value }], err: [{ index, item, code, message }] }
+//
+// Without continueOnError the first failure stops new calls and fails the
+// batch with the lowest failing item's error. Budget errors always fail it.
+//
+// Trace events of the calls are written in item order once the batch
+// finishes, between batch_start and batch_end, so a trace reads (and
+// a0 verify replays) the same however the calls interleaved.
+func (ev *evaluator) evalCallBatch(args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	toolName := ""
+	if v, ok := args.Get("tool"); ok {
+		if s, ok := v.(A0String); ok {
+			toolName = s.Value
+		}
+	}
+	tool, ok := ev.opts.Tools[toolName]
+	if !ok {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EUnknownTool,
+			Message: fmt.Sprintf("unknown tool '%s'", toolName),
+			Span:    &span,
+		}
+	}
+	if err := ev.checkToolCaps(tool, span); err != nil {
+		return nil, err
+	}
+	if tool.Mode == "effect" {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.ECallEffect,
+			Message: fmt.Sprintf("call.batch cannot call effect tool '%s'; use do in a for loop", toolName),
+			Span:    &span,
+		}
+	}
+	itemsVal, _ := args.Get("items")
+	items, ok := itemsVal.(A0List)
+	if !ok {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: "call.batch requires 'items' to be a list",
+			Span:    &span,
+		}
+	}
+	concurrency := DefaultBatchConcurrency
+	if v, ok := args.Get("concurrency"); ok {
+		n, ok := v.(A0Number)
+		if !ok || n.Value < 1 || n.Value != math.Trunc(n.Value) {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EType,
+				Message: "call.batch: 'concurrency' must be a positive integer",
+				Span:    &span,
+			}
+		}
+		concurrency = int(n.Value)
+	}
+	if limit := ev.opts.MaxBatchConcurrency; limit > 0 && concurrency > limit {
+		concurrency = limit
+	}
+	continueOnError := false
+	if v, ok := args.Get("continueOnError"); ok {
+		b, ok := v.(A0Bool)
+		if !ok {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EType,
+				Message: "call.batch: 'continueOnError' must be a boolean",
+				Span:    &span,
+			}
+		}
+		continueOnError = b.Value
+	}
+
+	// Build every call's args first: argsFn runs user code, which is not
+	// safe to run concurrently.
+	var argsFn *userFn
+	if v, ok := args.Get("argsFn"); ok {
+		name, _ := v.(A0String)
+		uf, err := ev.lookupFn(name.Value, &span)
+		if err != nil {
+			return nil, err
+		}
+		if uf == nil {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EUnknownFn,
+				Message: fmt.Sprintf("unknown function '%s'", name.Value),
+				Span:    &span,
+			}
+		}
+		argsFn = uf
+	}
+	callArgs := make([]A0Record, len(items.Items))
+	for i, item := range items.Items {
+		if err := ev.countIteration(); err != nil {
+			return nil, err
+		}
+		a := item
+		if argsFn != nil {
+			var err error
+			if a, err = ev.runUserFn(argsFn, ev.bindFnParams(argsFn, item)); err != nil {
+				return nil, err
+			}
+		}
+		rec, ok := a.(A0Record)
+		if !ok {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EToolArgs,
+				Message: fmt.Sprintf("call.batch: item %d: tool arguments must be a record, got %s", i, typeNameOf(a)),
+				Span:    &span,
+			}
+		}
+		if err := ev.checkTaint(tool, rec, &span); err != nil {
+			return nil, err
+		}
+		callArgs[i] = rec
+	}
+
+	ev.emitWithData(TraceBatchStart, &span, map[string]string{
+		"tool":        toolName,
+		"items":       strconv.Itoa(len(callArgs)),
+		"concurrency": strconv.Itoa(concurrency),
+	})
+
+	type outcome struct {
+		started bool
+		value   A0Value
+		err     error
+		events  []TraceEvent
+	}
+	outcomes := make([]outcome, len(callArgs))
+	var mu sync.Mutex // guards ev.tracker while calls run
+	chargeSent := func(n int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return ev.chargeBytesSent(n)
+	}
+	var failed bool
+	var budgetErr error
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range callArgs {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed && !continueOnError
+		if !stop {
+			budgetErr = ev.chargeBatchCall()
+		}
+		mu.Unlock()
+		if stop || budgetErr != nil || ev.ctx.Err() != nil {
+			<-sem
+			break
+		}
+		o := &outcomes[i]
+		o.started = true
+		w := *ev
+		if ev.opts.Trace != nil {
+			w.opts.Trace = TraceFunc(func(e TraceEvent) { o.events = append(o.events, e) })
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			w.emitWithData(TraceToolStart, &span, map[string]string{"tool": toolName, "index": strconv.Itoa(i)})
+			ctx, timings := w.beginToolCall()
+			ctx = context.WithValue(ctx, bytesSentKey{}, chargeSent)
+			o.value, o.err = tool.Execute(ctx, &callArgs[i])
+			w.emitToolEnd(toolName, timings, o.value, o.err, &span)
+			if o.err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	okItems := []A0Value{}
+	errItems := []A0Value{}
+	var firstErr error
+	for i := range outcomes {
+		o := &outcomes[i]
+		if !o.started {
+			break
+		}
+		if ev.opts.Trace != nil {
+			for _, event := range o.events {
+				ev.opts.Trace.Emit(event)
+			}
+		}
+		if o.err != nil {
+			rtErr := ev.batchCallError(toolName, i, o.err, &span)
+			if rtErr.Code == diagnostics.EBudget {
+				return nil, rtErr
+			}
+			if !continueOnError {
+				if firstErr == nil {
+					firstErr = rtErr
+				}
+				continue
+			}
+			errItems = append(errItems, NewRecord([]KeyValue{
+				{Key: "index", Value: NewNumber(float64(i))},
+				{Key: "item", Value: items.Items[i]},
+				{Key: "code", Value: NewString(rtErr.Code)},
+				{Key: "message", Value: NewString(rtErr.Message)},
+			}))
+			continue
+		}
+		ev.emitToolData(toolName, o.value, &span)
+		if ev.taint != nil {
+			ev.taint.mark(o.value, toolSources(tool))
+		}
+		if err := ev.trackBytesRead(o.value); err != nil {
+			return nil, err
+		}
+		if err := ev.chargeMemory(o.value, true); err != nil {
+			return nil, err
+		}
+		okItems = append(okItems, NewRecord([]KeyValue{
+			{Key: "index", Value: NewNumber(float64(i))},
+			{Key: "item", Value: items.Items[i]},
+			{Key: "value", Value: o.value},
+		}))
+	}
+	if budgetErr != nil {
+		return nil, budgetErr
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ev.ctx.Err(); err != nil {
+		if bErr := ev.checkTimeBudget(); bErr != nil {
+			return nil, bErr
+		}
+		return nil, err
+	}
+
+	ev.emitWithData(TraceBatchEnd, &span, map[string]string{
+		"tool": toolName,
+		"ok":   strconv.Itoa(len(okItems)),
+		"err":  strconv.Itoa(len(errItems)),
+	})
+	return NewRecord([]KeyValue{
+		{Key: "ok", Value: NewList(okItems)},
+		{Key: "err", Value: NewList(errItems)},
+	}), nil
+}
+
+// chargeBatchCall charges one tool call against maxToolCalls, as a call?
+// does.
+func (ev *evaluator) chargeBatchCall() error {
+	if ev.budget.MaxToolCalls != nil && ev.tracker.ToolCalls >= *ev.budget.MaxToolCalls {
+		return &A0RuntimeError{
+			Code:    diagnostics.EBudget,
+			Message: "tool call budget exceeded",
+		}
+	}
+	if err := ev.chargeShared("maxToolCalls", 1); err != nil {
+		return err
+	}
+	ev.tracker.ToolCalls++
+	return nil
+}
+
+// batchCallError turns the error of item i's call into the runtime error a
+// call? would have failed with.
+func (ev *evaluator) batchCallError(toolName string, i int, err error, span *ast.Span) *A0RuntimeError {
+	if bErr := ev.checkTimeBudget(); bErr != nil {
+		var rtErr *A0RuntimeError
+		errors.As(bErr, &rtErr)
+		return rtErr
+	}
+	var rtErr *A0RuntimeError
+	if errors.As(err, &rtErr) && rtErr.Code == diagnostics.EBudget {
+		rtErr.Span = span
+		return rtErr
+	}
+	return &A0RuntimeError{
+		Code:    diagnostics.ETool,
+		Message: fmt.Sprintf("call.batch item %d: tool '%s' error: %s", i, toolName, err.Error()),
+		Span:    span,
+	}
+}
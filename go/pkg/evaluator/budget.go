@@ -1,11 +1,25 @@
 package evaluator
 
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
 // Budget holds the resource limits for a program execution.
 type Budget struct {
 	TimeMs          *int64
 	MaxToolCalls    *int64
 	MaxBytesWritten *int64
 	MaxIterations   *int64
+	MaxBytesRead    *int64
+	MaxMemoryBytes  *int64
+	MaxBytesSent    *int64
+	MaxSteps        *int64
 }
 
 // BudgetTracker tracks resource consumption during execution.
@@ -13,5 +27,210 @@ type BudgetTracker struct {
 	ToolCalls    int64
 	BytesWritten int64
 	Iterations   int64
+	BytesRead    int64
+	MemoryBytes  int64
+	BytesSent    int64
+	Steps        int64
 	StartMs      int64
 }
+
+// SharedBudget pools resource limits across several runs, such as the
+// programs of a multi-file `a0 run`. Each run still enforces its own budget
+// header; the shared limits cap the combined usage. It is safe for
+// concurrent use.
+type SharedBudget struct {
+	limits Budget
+	start  time.Time
+	// module is the import namespace for a per-module budget, "" otherwise.
+	module string
+
+	mu   sync.Mutex
+	used BudgetTracker
+}
+
+// budgetFromRecord reads the numeric fields of a budget record.
+func budgetFromRecord(rec *ast.RecordExpr) Budget {
+	var b Budget
+	for _, entry := range rec.Pairs {
+		pair, ok := entry.(*ast.RecordPair)
+		if !ok {
+			continue
+		}
+		val := int64(extractNumber(pair.Value))
+		switch pair.Key {
+		case "timeMs":
+			b.TimeMs = &val
+		case "maxToolCalls":
+			b.MaxToolCalls = &val
+		case "maxIterations":
+			b.MaxIterations = &val
+		case "maxBytesWritten":
+			b.MaxBytesWritten = &val
+		case "maxBytesRead":
+			b.MaxBytesRead = &val
+		case "maxMemoryBytes":
+			b.MaxMemoryBytes = &val
+		case "maxBytesSent":
+			b.MaxBytesSent = &val
+		case "maxSteps":
+			b.MaxSteps = &val
+		}
+	}
+	return b
+}
+
+// NewSharedBudget creates a shared budget; its time limit starts now.
+func NewSharedBudget(limits Budget) *SharedBudget {
+	now := time.Now()
+	return &SharedBudget{limits: limits, start: now, used: BudgetTracker{StartMs: now.UnixMilli()}}
+}
+
+// Used returns the resources consumed so far by all runs.
+func (s *SharedBudget) Used() BudgetTracker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// deadline returns the end of the shared time limit, if any.
+func (s *SharedBudget) deadline() (time.Time, bool) {
+	if s.limits.TimeMs == nil {
+		return time.Time{}, false
+	}
+	return s.start.Add(time.Duration(*s.limits.TimeMs) * time.Millisecond), true
+}
+
+func (s *SharedBudget) checkTime() error {
+	if d, ok := s.deadline(); ok && !time.Now().Before(d) {
+		return &A0RuntimeError{
+			Code:    diagnostics.EBudget,
+			Message: fmt.Sprintf("shared time budget exceeded (%dms)", *s.limits.TimeMs),
+		}
+	}
+	return nil
+}
+
+// charge adds n to the named counter and fails once the combined usage
+// passes its limit. Tool calls, iterations, steps and bytes sent are checked
+// before they happen, other bytes after.
+func (s *SharedBudget) charge(field string, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var used *int64
+	var limit *int64
+	var what string
+	switch field {
+	case "maxToolCalls":
+		used, limit, what = &s.used.ToolCalls, s.limits.MaxToolCalls, "tool call"
+	case "maxIterations":
+		used, limit, what = &s.used.Iterations, s.limits.MaxIterations, "iteration"
+	case "maxBytesWritten":
+		used, limit, what = &s.used.BytesWritten, s.limits.MaxBytesWritten, "bytes written"
+	case "maxBytesRead":
+		used, limit, what = &s.used.BytesRead, s.limits.MaxBytesRead, "bytes read"
+	case "maxMemoryBytes":
+		used, limit, what = &s.used.MemoryBytes, s.limits.MaxMemoryBytes, "memory"
+	case "maxBytesSent":
+		used, limit, what = &s.used.BytesSent, s.limits.MaxBytesSent, "bytes sent"
+	case "maxSteps":
+		used, limit, what = &s.used.Steps, s.limits.MaxSteps, "step"
+	default:
+		return nil
+	}
+	if limit != nil {
+		over := *used+n > *limit
+		if field == "maxToolCalls" || field == "maxIterations" || field == "maxSteps" {
+			over = *used >= *limit
+		}
+		if over && s.module != "" {
+			details := NewRecord([]KeyValue{
+				{Key: "module", Value: NewString(s.module)},
+				{Key: "field", Value: NewString(field)},
+			}).(A0Record)
+			return &A0RuntimeError{
+				Code:    diagnostics.EBudget,
+				Message: fmt.Sprintf("module '%s' %s budget exceeded (max %d)", s.module, what, *limit),
+				Details: &details,
+			}
+		}
+		if over {
+			return &A0RuntimeError{
+				Code:    diagnostics.EBudget,
+				Message: fmt.Sprintf("shared %s budget exceeded (max %d)", what, *limit),
+			}
+		}
+	}
+	*used += n
+	return nil
+}
+
+type bytesSentKey struct{}
+
+// ChargeBytesSent counts n outbound bytes against the maxBytesSent budgets
+// of the run making the tool call in ctx. Network tools call it before
+// sending a request; an error (E_BUDGET) means the request must not be sent
+// and should be returned as is. Outside a tool call it does nothing.
+func ChargeBytesSent(ctx context.Context, n int64) error {
+	if charge, ok := ctx.Value(bytesSentKey{}).(func(int64) error); ok {
+		return charge(n)
+	}
+	return nil
+}
+
+type bytesWrittenKey struct{}
+
+// BytesWriteAllowance returns how many more bytes the run making the tool
+// call in ctx may write before its maxBytesWritten budgets are exceeded, and
+// false when none applies. The bytes field of a tool's result is charged
+// only after the call returns, so tools that write data of unknown size,
+// such as archive extraction, use it to stop before they overrun the budget.
+func BytesWriteAllowance(ctx context.Context) (int64, bool) {
+	if allowance, ok := ctx.Value(bytesWrittenKey{}).(func() (int64, bool)); ok {
+		return allowance()
+	}
+	return 0, false
+}
+
+// bytesWriteAllowance is the BytesWriteAllowance hook for this run's tool
+// calls: the smallest allowance left by the run, import and shared budgets.
+func (ev *evaluator) bytesWriteAllowance() (int64, bool) {
+	var left int64
+	found := false
+	consider := func(limit *int64, used int64) {
+		if limit == nil {
+			return
+		}
+		if r := *limit - used; !found || r < left {
+			left, found = r, true
+		}
+	}
+	consider(ev.budget.MaxBytesWritten, ev.tracker.BytesWritten)
+	shared := []*SharedBudget{ev.opts.SharedBudget}
+	for ns := ev.module; ns != ""; ns = parentNamespace(ns) {
+		shared = append(shared, ev.moduleBudgets[ns])
+	}
+	for _, b := range shared {
+		if b == nil {
+			continue
+		}
+		b.mu.Lock()
+		consider(b.limits.MaxBytesWritten, b.used.BytesWritten)
+		b.mu.Unlock()
+	}
+	return max(left, 0), found
+}
+
+// chargeBytesSent is the ChargeBytesSent hook for this run's tool calls.
+func (ev *evaluator) chargeBytesSent(n int64) error {
+	if ev.budget.MaxBytesSent != nil && ev.tracker.BytesSent+n > *ev.budget.MaxBytesSent {
+		return &A0RuntimeError{
+			Code:    diagnostics.EBudget,
+			Message: fmt.Sprintf("bytes sent budget exceeded (max %d)", *ev.budget.MaxBytesSent),
+		}
+	}
+	if err := ev.chargeShared("maxBytesSent", n); err != nil {
+		return err
+	}
+	ev.tracker.BytesSent += n
+	return nil
+}
@@ -0,0 +1,137 @@
+package evaluator
+
+import (
+	"strconv"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+)
+
+// maxDiffEntries caps the entries recorded for a failed eq check so a large
+// mismatch does not bloat the evidence file.
+const maxDiffEntries = 50
+
+// diffEntry is one difference between two values. Op is "added" (only in
+// b), "removed" (only in a) or "changed"; Path is "" for the values
+// themselves, otherwise a path such as server.ports[1].
+type diffEntry struct {
+	Op   string
+	Path string
+	A, B A0Value
+}
+
+// structuralDiff lists the paths at which a and b differ, walking records by
+// key and lists by index. Values of different types differ as a whole.
+func structuralDiff(a, b A0Value) []diffEntry {
+	var out []diffEntry
+	diffInto(&out, "", a, b)
+	return out
+}
+
+func diffInto(out *[]diffEntry, path string, a, b A0Value) {
+	if DeepEqual(a, b) {
+		return
+	}
+	switch av := a.(type) {
+	case A0Record:
+		if bv, ok := b.(A0Record); ok {
+			for _, kv := range av.Pairs() {
+				if other, found := bv.Get(kv.Key); found {
+					diffInto(out, joinDiffPath(path, kv.Key), kv.Value, other)
+				} else {
+					*out = append(*out, diffEntry{Op: "removed", Path: joinDiffPath(path, kv.Key), A: kv.Value})
+				}
+			}
+			for _, kv := range bv.Pairs() {
+				if _, found := av.Get(kv.Key); !found {
+					*out = append(*out, diffEntry{Op: "added", Path: joinDiffPath(path, kv.Key), B: kv.Value})
+				}
+			}
+			return
+		}
+	case A0List:
+		if bv, ok := b.(A0List); ok {
+			for i := 0; i < len(av.Items) || i < len(bv.Items); i++ {
+				elem := path + "[" + strconv.Itoa(i) + "]"
+				switch {
+				case i >= len(bv.Items):
+					*out = append(*out, diffEntry{Op: "removed", Path: elem, A: av.Items[i]})
+				case i >= len(av.Items):
+					*out = append(*out, diffEntry{Op: "added", Path: elem, B: bv.Items[i]})
+				default:
+					diffInto(out, elem, av.Items[i], bv.Items[i])
+				}
+			}
+			return
+		}
+	}
+	*out = append(*out, diffEntry{Op: "changed", Path: path, A: a, B: b})
+}
+
+func joinDiffPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// eqOperands remembers the operands of the most recent eq call so a failed
+// check or assert on it can report what differed.
+type eqOperands struct {
+	call *ast.FnCallExpr
+	a, b A0Value
+}
+
+// eqDiffDetails returns evidence details for a failed check/assert whose
+// that: is an eq call, or nil when it is not.
+func (ev *evaluator) eqDiffDetails(args *ast.RecordExpr) *A0Record {
+	if ev.lastEq == nil || args == nil {
+		return nil
+	}
+	var call *ast.FnCallExpr
+	for _, entry := range args.Pairs {
+		if p, ok := entry.(*ast.RecordPair); ok && p.Key == "that" {
+			call, _ = p.Value.(*ast.FnCallExpr)
+		}
+	}
+	if call == nil || call != ev.lastEq.call {
+		return nil
+	}
+
+	entries := structuralDiff(ev.lastEq.a, ev.lastEq.b)
+	truncated := len(entries) > maxDiffEntries
+	if truncated {
+		entries = entries[:maxDiffEntries]
+	}
+	items := make([]A0Value, len(entries))
+	for i, d := range entries {
+		pairs := []KeyValue{
+			{Key: "op", Value: NewString(d.Op)},
+			{Key: "path", Value: NewString(d.Path)},
+		}
+		if d.A != nil {
+			pairs = append(pairs, KeyValue{Key: "a", Value: d.A})
+		}
+		if d.B != nil {
+			pairs = append(pairs, KeyValue{Key: "b", Value: d.B})
+		}
+		items[i] = NewRecord(pairs)
+	}
+	pairs := []KeyValue{
+		{Key: "a", Value: ev.lastEq.a},
+		{Key: "b", Value: ev.lastEq.b},
+		{Key: "diff", Value: NewList(items)},
+	}
+	if truncated {
+		pairs = append(pairs, KeyValue{Key: "truncated", Value: NewBool(true)})
+	}
+	details := NewRecord(pairs).(A0Record)
+	return &details
+}
+
+// orNull treats a missing argument as null, as eq does.
+func orNull(v A0Value) A0Value {
+	if v == nil {
+		return NewNull()
+	}
+	return v
+}
@@ -1,18 +1,27 @@
 package evaluator
 
+// inlineBindings is how many bindings an Env holds before it switches to a
+// map. Loop bodies and fn calls get a fresh scope each time and usually bind
+// only a few names, so most scopes never allocate a map.
+const inlineBindings = 4
+
+type binding struct {
+	name  string
+	value A0Value
+}
+
 // Env is a scoped environment for variable bindings.
 // It supports parent-chained lookup for lexical scoping.
 type Env struct {
+	inline   [inlineBindings]binding
+	n        int
 	bindings map[string]A0Value
 	parent   *Env
 }
 
 // NewEnv creates a new environment with an optional parent scope.
 func NewEnv(parent *Env) *Env {
-	return &Env{
-		bindings: make(map[string]A0Value),
-		parent:   parent,
-	}
+	return &Env{parent: parent}
 }
 
 // Child creates a new child scope whose parent is this environment.
@@ -20,29 +29,58 @@ func (e *Env) Child() *Env {
 	return NewEnv(e)
 }
 
+// lookup finds name in this scope only.
+func (e *Env) lookup(name string) (A0Value, bool) {
+	if e.bindings != nil {
+		val, ok := e.bindings[name]
+		return val, ok
+	}
+	for i := 0; i < e.n; i++ {
+		if e.inline[i].name == name {
+			return e.inline[i].value, true
+		}
+	}
+	return nil, false
+}
+
 // Get looks up a variable by name, traversing parent scopes.
 func (e *Env) Get(name string) (A0Value, bool) {
-	if val, ok := e.bindings[name]; ok {
-		return val, true
-	}
-	if e.parent != nil {
-		return e.parent.Get(name)
+	for s := e; s != nil; s = s.parent {
+		if val, ok := s.lookup(name); ok {
+			return val, true
+		}
 	}
 	return nil, false
 }
 
 // Set binds a variable in this scope.
 func (e *Env) Set(name string, val A0Value) {
+	if e.bindings != nil {
+		e.bindings[name] = val
+		return
+	}
+	for i := 0; i < e.n; i++ {
+		if e.inline[i].name == name {
+			e.inline[i].value = val
+			return
+		}
+	}
+	if e.n < inlineBindings {
+		e.inline[e.n] = binding{name: name, value: val}
+		e.n++
+		return
+	}
+	e.bindings = make(map[string]A0Value, 2*inlineBindings)
+	for _, b := range e.inline[:e.n] {
+		e.bindings[b.name] = b.value
+	}
 	e.bindings[name] = val
+	e.inline = [inlineBindings]binding{}
+	e.n = 0
 }
 
 // Has checks whether a variable is defined in this scope or any parent.
 func (e *Env) Has(name string) bool {
-	if _, ok := e.bindings[name]; ok {
-		return true
-	}
-	if e.parent != nil {
-		return e.parent.Has(name)
-	}
-	return false
+	_, ok := e.Get(name)
+	return ok
 }
@@ -2,9 +2,12 @@ package evaluator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/thomasrohde/agent0/go/pkg/ast"
@@ -13,11 +16,12 @@ import (
 
 // Evidence represents an assert or check result.
 type Evidence struct {
-	Kind    string    `json:"kind"` // "assert" or "check"
+	Kind    string    `json:"kind"` // "assert", "check", "snapshot", "schema", "forall" or a program's own (see evidence { ... })
 	OK      bool      `json:"ok"`
 	Msg     string    `json:"msg"`
 	Details *A0Record `json:"details,omitempty"`
 	Span    *ast.Span `json:"span,omitempty"`
+	RunID   string    `json:"runId,omitempty"`
 }
 
 // TraceEventType identifies the type of a trace event.
@@ -46,8 +50,16 @@ const (
 	TraceTryEnd         TraceEventType = "try_end"
 	TraceFilterStart    TraceEventType = "filter_start"
 	TraceFilterEnd      TraceEventType = "filter_end"
+	TraceFindStart      TraceEventType = "find_start"
+	TraceFindEnd        TraceEventType = "find_end"
 	TraceLoopStart      TraceEventType = "loop_start"
 	TraceLoopEnd        TraceEventType = "loop_end"
+	TraceSleep          TraceEventType = "sleep"
+	TraceCapCheck       TraceEventType = "cap_check"
+	TraceTxStart        TraceEventType = "transaction_start"
+	TraceTxEnd          TraceEventType = "transaction_end"
+	TraceBatchStart     TraceEventType = "batch_start"
+	TraceBatchEnd       TraceEventType = "batch_end"
 )
 
 // TraceEvent represents a single trace event emitted during execution.
@@ -64,22 +76,93 @@ type ToolDef struct {
 	Name         string
 	Mode         string // "read" or "effect"
 	CapabilityID string
+	// AlsoRequires lists further capabilities the tool exercises, such as
+	// fs.read for archive.zip, which reads the files it packs.
+	AlsoRequires []string
 	Execute      func(ctx context.Context, args *A0Record) (A0Value, error)
+	// Prepare, Commit and Rollback let an effect tool run inside a
+	// transaction block. Prepare is called before Execute and returns a
+	// token capturing what the call will change; when the block succeeds
+	// the token is passed to Commit, and when it fails to Rollback, which
+	// restores the state Prepare saw. Commit and Rollback may be nil.
+	Prepare  func(ctx context.Context, args *A0Record) (any, error)
+	Commit   func(ctx context.Context, token any) error
+	Rollback func(ctx context.Context, token any) error
+}
+
+// ToolValue returns the ExecOptions.ToolContext value stored under key, if
+// it is present and of type T.
+func ToolValue[T any](ctx context.Context, key any) (T, bool) {
+	v, ok := ctx.Value(key).(T)
+	return v, ok
 }
 
 // StdlibFn defines a standard library function.
 type StdlibFn struct {
 	Name    string
 	Execute func(args *A0Record) (A0Value, error)
+	// Deprecated, when set, names the replacement; calls still succeed but
+	// produce a warning.
+	Deprecated string
 }
 
+// HostFn is a side-effect-free function provided by the embedding program
+// and called from A0 like a stdlib function. It receives the run's context,
+// including ExecOptions.ToolContext values. Returning an *A0RuntimeError
+// keeps its code; any other error becomes E_FN.
+type HostFn func(ctx context.Context, args *A0Record) (A0Value, error)
+
 // ExecOptions configures program execution.
 type ExecOptions struct {
 	AllowedCapabilities map[string]bool
 	Tools               map[string]*ToolDef
 	Stdlib              map[string]*StdlibFn
-	Trace               func(event TraceEvent)
-	RunID               string
+	// Trace receives trace events; nil turns tracing off.
+	Trace TraceSink
+	RunID string
+	// ProgramSHA256, when set, is reported in the run_start trace event.
+	ProgramSHA256 string
+	// TraceValues records each tool's result (or error) in its tool_end
+	// event and the program's value in run_end, as JSON, so the run can be
+	// replayed and verified from its trace.
+	TraceValues bool
+	// Modules holds the resolved program for each import header, including
+	// those of imported modules.
+	Modules map[*ast.ImportDecl]*ast.Program
+	// SharedBudget, when set, caps usage combined with other runs that use
+	// the same SharedBudget.
+	SharedBudget *SharedBudget
+	// Snapshots configures expect.snapshot.
+	Snapshots SnapshotOptions
+	// Log configures where log.* entries are written.
+	Log LogOptions
+	// ToolContext holds per-run values (tenant IDs, auth tokens, loggers)
+	// that ToolDef.Execute can read with ctx.Value(key) or ToolValue. Keys
+	// follow context.WithValue rules: comparable, ideally unexported types.
+	ToolContext map[any]any
+	// StrictBool makes if, assert, check and filter predicates require a
+	// boolean; any other value is an E_TYPE error instead of being coerced
+	// by truthiness.
+	StrictBool bool
+	// Input is exposed to the program as run.input; nil reads as null.
+	Input A0Value
+	// HostFns are host-provided functions by name. Stdlib functions take
+	// precedence over a host function of the same name.
+	HostFns map[string]HostFn
+	// TaintRules stop data produced by one tool from being passed to
+	// another; a violating call fails with E_CAP_DENIED. See TaintRule.
+	TaintRules []TaintRule
+	// Plan records do calls as ExecResult.Plan steps instead of executing
+	// them; each do evaluates to { planned: true, tool }. call? reads
+	// still run, so arguments built from them are exact.
+	Plan bool
+	// MaxBatchConcurrency caps how many calls a call.batch runs at once,
+	// whatever concurrency the program asks for; 0 means no cap.
+	MaxBatchConcurrency int
+	// UseCapability, when set, is called once per run for each declared
+	// capability the policy allows, before any statement runs. An error
+	// (an expired or used-up grant) denies it with E_CAP_DENIED.
+	UseCapability func(capability string) error
 }
 
 // ExecResult holds the result of a program execution.
@@ -87,6 +170,13 @@ type ExecResult struct {
 	Value       A0Value
 	Evidence    []Evidence
 	Diagnostics []diagnostics.Diagnostic
+	// Warnings holds soft issues found while running (deprecated stdlib
+	// names, truthiness coercions, budgets close to their limit). They never
+	// affect the outcome of the run.
+	Warnings []diagnostics.Diagnostic
+	// Plan holds the do calls recorded in plan mode (ExecOptions.Plan), in
+	// order. It is also set when a plan run fails part-way.
+	Plan []PlanStep
 }
 
 // A0RuntimeError represents a runtime error during A0 execution.
@@ -95,6 +185,9 @@ type A0RuntimeError struct {
 	Message string
 	Span    *ast.Span
 	Details *A0Record
+	// locals snapshots the bindings at the failure site for catch; it is
+	// only taken inside a try.
+	locals *A0Record
 }
 
 func (e *A0RuntimeError) Error() string {
@@ -102,25 +195,55 @@ func (e *A0RuntimeError) Error() string {
 }
 
 type userFn struct {
-	decl    *ast.FnDecl
-	closure *Env
+	decl     *ast.FnDecl
+	closure  *Env
+	module   string // namespace of the declaring module ("" for the program)
+	exported bool
 }
 
 type evaluator struct {
 	ctx        context.Context
 	opts       ExecOptions
 	env        *Env
+	globals    *Env
 	evidence   []Evidence
 	budget     Budget
 	tracker    BudgetTracker
+	// budgetSpans locates each field of the budget header, for warnings.
+	budgetSpans map[string]ast.Span
 	startTime  time.Time
 	startHires int64 // high-resolution monotonic start time
 	userFns    map[string]*userFn
+	module     string // namespace of the code being executed
+	warnings   []diagnostics.Diagnostic
+	warned     map[string]bool
+	iterations *atomic.Int64 // shared iteration count inside a parallel map
+	steps      *atomic.Int64 // shared step count inside a parallel map
+	parallel   bool          // running as a parallel map worker
+	purity     map[*ast.FnDecl]string
+	// moduleBudgets holds import budgets by module namespace.
+	moduleBudgets map[string]*SharedBudget
+	// lastEq holds the operands of the latest eq call; see eqDiffDetails.
+	lastEq *eqOperands
+	// taint tracks tool-produced data when TaintRules are set, else nil.
+	taint *taintTracker
+	// capsUsed holds the capabilities already passed to UseCapability.
+	capsUsed map[string]bool
+	// plan collects do calls when opts.Plan is set.
+	plan []PlanStep
+	// memo caches the results of @memo fns.
+	memo *memoCache
+	// tryDepth counts the try blocks being run; errors only snapshot
+	// their locals inside one.
+	tryDepth int
+	// tx holds the effect tool calls of the running transaction block; it
+	// is nil outside one.
+	tx []txEntry
 }
 
 func (ev *evaluator) emit(event TraceEventType, span *ast.Span) {
 	if ev.opts.Trace != nil {
-		ev.opts.Trace(TraceEvent{
+		ev.opts.Trace.Emit(TraceEvent{
 			Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
 			RunID:     ev.opts.RunID,
 			Event:     event,
@@ -129,6 +252,16 @@ func (ev *evaluator) emit(event TraceEventType, span *ast.Span) {
 	}
 }
 
+// emitAt is emit for a span held by value. The copy whose address escapes
+// is made only when a trace sink is set, so untraced runs don't
+// allocate a span per statement.
+func (ev *evaluator) emitAt(event TraceEventType, span ast.Span) {
+	if ev.opts.Trace != nil {
+		traced := span
+		ev.emit(event, &traced)
+	}
+}
+
 func (ev *evaluator) emitWithData(event TraceEventType, span *ast.Span, data map[string]string) {
 	if ev.opts.Trace != nil {
 		var dataRec *A0Record
@@ -140,7 +273,7 @@ func (ev *evaluator) emitWithData(event TraceEventType, span *ast.Span, data map
 			r := NewRecord(pairs).(A0Record)
 			dataRec = &r
 		}
-		ev.opts.Trace(TraceEvent{
+		ev.opts.Trace.Emit(TraceEvent{
 			Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
 			RunID:     ev.opts.RunID,
 			Event:     event,
@@ -150,6 +283,25 @@ func (ev *evaluator) emitWithData(event TraceEventType, span *ast.Span, data map
 	}
 }
 
+// recordEvidence stamps e with the run ID, keeps it and emits an evidence
+// trace event.
+func (ev *evaluator) recordEvidence(e Evidence) {
+	e.RunID = ev.opts.RunID
+	ev.evidence = append(ev.evidence, e)
+	ev.emit(TraceEvidence, e.Span)
+}
+
+// globalEnv holds the read-only bindings visible to the program and its
+// modules: run.id and run.input.
+func (ev *evaluator) globalEnv() *Env {
+	env := NewEnv(nil)
+	env.Set("run", NewRecord([]KeyValue{
+		{Key: "id", Value: NewString(ev.opts.RunID)},
+		{Key: "input", Value: orNull(ev.opts.Input)},
+	}))
+	return env
+}
+
 func (ev *evaluator) checkTimeBudget() error {
 	if ev.budget.TimeMs != nil {
 		// Use high-resolution timer for accurate sub-millisecond budget enforcement
@@ -161,83 +313,102 @@ func (ev *evaluator) checkTimeBudget() error {
 			}
 		}
 	}
+	if ev.opts.SharedBudget != nil {
+		return ev.opts.SharedBudget.checkTime()
+	}
 	return nil
 }
 
-func (ev *evaluator) checkIterationBudget() error {
-	if ev.budget.MaxIterations != nil {
-		if ev.tracker.Iterations >= *ev.budget.MaxIterations {
+// countIteration charges one loop iteration against the budget. Workers of a
+// parallel map share an atomic counter so the limit holds across goroutines.
+func (ev *evaluator) countIteration() error {
+	for {
+		var used int64
+		if ev.iterations != nil {
+			used = ev.iterations.Load()
+		} else {
+			used = ev.tracker.Iterations
+		}
+		if ev.budget.MaxIterations != nil && used >= *ev.budget.MaxIterations {
 			return &A0RuntimeError{
 				Code:    diagnostics.EBudget,
 				Message: fmt.Sprintf("iteration budget exceeded (max %d)", *ev.budget.MaxIterations),
 			}
 		}
+		if ev.iterations == nil {
+			ev.tracker.Iterations++
+			break
+		}
+		if ev.iterations.CompareAndSwap(used, used+1) {
+			break
+		}
 	}
-	return nil
+	return ev.chargeShared("maxIterations", 1)
+}
+
+// countStep charges one evaluated expression against maxSteps. Unlike
+// maxIterations it also stops deep recursion and large expression trees
+// that never loop.
+func (ev *evaluator) countStep() error {
+	var used int64
+	if ev.steps != nil {
+		used = ev.steps.Add(1)
+	} else {
+		ev.tracker.Steps++
+		used = ev.tracker.Steps
+	}
+	if ev.budget.MaxSteps != nil && used > *ev.budget.MaxSteps {
+		return &A0RuntimeError{
+			Code:    diagnostics.EBudget,
+			Message: fmt.Sprintf("step budget exceeded (max %d)", *ev.budget.MaxSteps),
+		}
+	}
+	return ev.chargeShared("maxSteps", 1)
+}
+
+// chargeShared records usage against the shared budget, if any, and against
+// the import budgets of the module being executed and its importers.
+func (ev *evaluator) chargeShared(field string, n int64) error {
+	for ns := ev.module; ns != ""; ns = parentNamespace(ns) {
+		if b := ev.moduleBudgets[ns]; b != nil {
+			if err := b.charge(field, n); err != nil {
+				return err
+			}
+		}
+	}
+	if ev.opts.SharedBudget == nil {
+		return nil
+	}
+	return ev.opts.SharedBudget.charge(field, n)
 }
 
 // Execute runs an A0 program and returns the result.
 func Execute(ctx context.Context, program *ast.Program, opts ExecOptions) (*ExecResult, error) {
+	for k, v := range opts.ToolContext {
+		ctx = context.WithValue(ctx, k, v)
+	}
 	now := time.Now()
 	ev := &evaluator{
 		ctx:       ctx,
 		opts:       opts,
-		env:        NewEnv(nil),
 		userFns:    make(map[string]*userFn),
 		startTime:  now,
 		startHires: hiresNow(),
 		tracker:    BudgetTracker{StartMs: now.UnixMilli()},
+		memo:       newMemoCache(),
 	}
-
-	// Extract capabilities from CapDecl headers
-	for _, h := range program.Headers {
-		if capDecl, ok := h.(*ast.CapDecl); ok {
-			for _, entry := range capDecl.Capabilities.Pairs {
-				pair, ok := entry.(*ast.RecordPair)
-				if !ok {
-					continue
-				}
-				boolVal, ok := pair.Value.(*ast.BoolLiteral)
-				if !ok {
-					continue
-				}
-				if boolVal.Value {
-					capID := pair.Key
-					// Check against allowed capabilities
-					if opts.AllowedCapabilities != nil && !opts.AllowedCapabilities[capID] {
-						span := pair.Span
-						return nil, &A0RuntimeError{
-							Code:    diagnostics.ECapDenied,
-							Message: fmt.Sprintf("capability '%s' denied by policy", capID),
-							Span:    &span,
-						}
-					}
-				}
-			}
-		}
+	if len(opts.TaintRules) > 0 {
+		ev.taint = newTaintTracker()
 	}
 
+	ev.globals = ev.globalEnv()
+	ev.env = NewEnv(ev.globals)
+
 	// Extract budget from BudgetDecl headers
 	for _, h := range program.Headers {
 		if budgetDecl, ok := h.(*ast.BudgetDecl); ok {
-			for _, entry := range budgetDecl.Budget.Pairs {
-				pair, ok := entry.(*ast.RecordPair)
-				if !ok {
-					continue
-				}
-				val := extractNumber(pair.Value)
-				intVal := int64(val)
-				switch pair.Key {
-				case "timeMs":
-					ev.budget.TimeMs = &intVal
-				case "maxToolCalls":
-					ev.budget.MaxToolCalls = &intVal
-				case "maxIterations":
-					ev.budget.MaxIterations = &intVal
-				case "maxBytesWritten":
-					ev.budget.MaxBytesWritten = &intVal
-				}
-			}
+			ev.budget = budgetFromRecord(budgetDecl.Budget)
+			ev.budgetSpans = budgetFieldSpans(budgetDecl)
 		}
 	}
 
@@ -248,24 +419,61 @@ func Execute(ctx context.Context, program *ast.Program, opts ExecOptions) (*Exec
 		defer cancel()
 		ev.ctx = ctx
 	}
+	if opts.SharedBudget != nil {
+		if deadline, ok := opts.SharedBudget.deadline(); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+			ev.ctx = ctx
+		}
+	}
 
 	span := program.Span
-	ev.emit(TraceRunStart, &span)
+	startData := map[string]string{"schemaVersion": strconv.Itoa(TraceSchemaVersion)}
+	if opts.ProgramSHA256 != "" {
+		startData["programSha256"] = opts.ProgramSHA256
+	}
+	ev.emitWithData(TraceRunStart, &span, startData)
 
-	val, err := ev.executeBlock(program.Statements, ev.env)
+	err := ev.checkCapDecls(program)
+	if err == nil {
+		err = ev.loadImports(program, "")
+	}
+	var val A0Value
+	if err == nil {
+		val, err = ev.executeBlock(program.Statements, ev.env)
+	}
 
-	ev.emit(TraceRunEnd, &span)
+	if err != nil {
+		ev.emitWithData(TraceRunEnd, &span, runEndData(err))
+	} else if ev.opts.TraceValues {
+		ev.emitWithData(TraceRunEnd, &span, map[string]string{"value": ValueToJSONString(val)})
+	} else {
+		ev.emit(TraceRunEnd, &span)
+	}
+	ev.warnBudgets()
 
 	if err != nil {
-		return &ExecResult{Evidence: ev.evidence}, err
+		return &ExecResult{Evidence: ev.evidence, Warnings: ev.warnings, Plan: ev.plan}, err
 	}
 
 	return &ExecResult{
 		Value:    val,
 		Evidence: ev.evidence,
+		Warnings: ev.warnings,
+		Plan:     ev.plan,
 	}, nil
 }
 
+// runEndData describes the error that ended a run, for the run_end event.
+func runEndData(err error) map[string]string {
+	code := "E_RUNTIME"
+	if rtErr, ok := err.(*A0RuntimeError); ok {
+		code = rtErr.Code
+	}
+	return map[string]string{"code": code, "message": err.Error()}
+}
+
 func extractNumber(expr ast.Expr) float64 {
 	switch e := expr.(type) {
 	case *ast.IntLiteral:
@@ -277,15 +485,23 @@ func extractNumber(expr ast.Expr) float64 {
 }
 
 func (ev *evaluator) executeBlock(stmts []ast.Stmt, env *Env) (A0Value, error) {
+	val, err := ev.executeStmts(stmts, env)
+	if err != nil && ev.tryDepth > 0 {
+		ev.captureLocals(err, env)
+	}
+	return val, err
+}
+
+func (ev *evaluator) executeStmts(stmts []ast.Stmt, env *Env) (A0Value, error) {
 	var lastVal A0Value = NewNull()
 
 	for _, stmt := range stmts {
+		span := stmt.NodeSpan()
 		if err := ev.checkTimeBudget(); err != nil {
-			return nil, err
+			return nil, withSpan(err, span)
 		}
 
-		span := stmt.NodeSpan()
-		ev.emit(TraceStmtStart, &span)
+		ev.emitAt(TraceStmtStart, span)
 
 		switch s := stmt.(type) {
 		case *ast.LetStmt:
@@ -317,7 +533,7 @@ func (ev *evaluator) executeBlock(stmts []ast.Stmt, env *Env) (A0Value, error) {
 			lastVal = val
 
 		case *ast.FnDecl:
-			ev.userFns[s.Name] = &userFn{decl: s, closure: env}
+			ev.userFns[ev.qualify(s.Name)] = &userFn{decl: s, closure: env, module: ev.module}
 			lastVal = NewNull()
 
 		case *ast.ReturnStmt:
@@ -325,23 +541,69 @@ func (ev *evaluator) executeBlock(stmts []ast.Stmt, env *Env) (A0Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			ev.emit(TraceStmtEnd, &span)
+			ev.emitAt(TraceStmtEnd, span)
 			return val, nil
+
+		case *ast.EnsureStmt:
+			cond, err := ev.evalExpr(s.That, env)
+			if err != nil {
+				return nil, err
+			}
+			ensureSpan := span // copied here so span stays off the heap on other paths
+			ev.warnCoercion("ensure", cond, &ensureSpan)
+			ok, err := ev.truthy("ensure", cond, &ensureSpan)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				var val A0Value = NewNull()
+				if s.Else != nil {
+					if val, err = ev.evalExpr(s.Else, env); err != nil {
+						return nil, err
+					}
+				}
+				ev.emitAt(TraceStmtEnd, span)
+				return val, nil
+			}
 		}
 
-		ev.emit(TraceStmtEnd, &span)
+		ev.emitAt(TraceStmtEnd, span)
 	}
 
 	return lastVal, nil
 }
 
+// evalExpr evaluates expr. A runtime error raised without a position (a
+// budget check, say) gets the span of the innermost expression being
+// evaluated, so every runtime diagnostic points at file:line:col.
 func (ev *evaluator) evalExpr(expr ast.Expr, env *Env) (A0Value, error) {
+	var val A0Value
+	err := ev.countStep()
+	if err == nil {
+		val, err = ev.evalExprNode(expr, env)
+	}
+	if err != nil {
+		withSpan(err, expr.NodeSpan())
+	}
+	return val, err
+}
+
+// withSpan sets the span of a runtime error that has none and returns err.
+func withSpan(err error, span ast.Span) error {
+	var rtErr *A0RuntimeError
+	if errors.As(err, &rtErr) && rtErr.Span == nil {
+		rtErr.Span = &span
+	}
+	return err
+}
+
+func (ev *evaluator) evalExprNode(expr ast.Expr, env *Env) (A0Value, error) {
 	if expr == nil {
 		return NewNull(), nil
 	}
 
 	// Check time budget during expression evaluation for tight loops
-	if ev.budget.TimeMs != nil {
+	if ev.budget.TimeMs != nil || ev.opts.SharedBudget != nil {
 		if err := ev.checkTimeBudget(); err != nil {
 			return nil, err
 		}
@@ -367,17 +629,23 @@ func (ev *evaluator) evalExpr(expr ast.Expr, env *Env) (A0Value, error) {
 		return ev.evalIdentPath(e, env)
 
 	case *ast.RecordExpr:
-		return ev.evalRecord(e, env)
+		val, err := ev.evalRecord(e, env)
+		return ev.allocated(val, err, false)
 
 	case *ast.ListExpr:
-		return ev.evalList(e, env)
+		val, err := ev.evalList(e, env)
+		return ev.allocated(val, err, false)
 
 	case *ast.BinaryExpr:
-		return ev.evalBinaryOp(e, env)
+		val, err := ev.evalBinaryOp(e, env)
+		return ev.allocated(val, err, false)
 
 	case *ast.UnaryExpr:
 		return ev.evalUnary(e, env)
 
+	case *ast.IndexExpr:
+		return ev.evalIndex(e, env)
+
 	case *ast.IfExpr:
 		return ev.evalIfExpr(e, env)
 
@@ -385,16 +653,25 @@ func (ev *evaluator) evalExpr(expr ast.Expr, env *Env) (A0Value, error) {
 		return ev.evalIfBlockExpr(e, env)
 
 	case *ast.ForExpr:
-		return ev.evalForExpr(e, env)
+		val, err := ev.evalForExpr(e, env)
+		return ev.allocated(val, err, false)
 
 	case *ast.MatchExpr:
 		return ev.evalMatchExpr(e, env)
+	case *ast.TypeMatchExpr:
+		return ev.evalTypeMatchExpr(e, env)
+	case *ast.TransactionExpr:
+		return ev.evalTransactionExpr(e, env)
 
 	case *ast.TryExpr:
 		return ev.evalTryExpr(e, env)
 
 	case *ast.FilterBlockExpr:
-		return ev.evalFilterBlockExpr(e, env)
+		val, err := ev.evalFilterBlockExpr(e, env)
+		return ev.allocated(val, err, false)
+
+	case *ast.FindBlockExpr:
+		return ev.evalFindBlockExpr(e, env)
 
 	case *ast.LoopExpr:
 		return ev.evalLoopExpr(e, env)
@@ -460,7 +737,7 @@ func (ev *evaluator) evalIdentPath(e *ast.IdentPath, env *Env) (A0Value, error)
 }
 
 func (ev *evaluator) evalRecord(e *ast.RecordExpr, env *Env) (A0Value, error) {
-	rec := &A0Record{Pairs: make([]KeyValue, 0, len(e.Pairs))}
+	rec := A0Record{}
 
 	for _, entry := range e.Pairs {
 		switch p := entry.(type) {
@@ -469,7 +746,11 @@ func (ev *evaluator) evalRecord(e *ast.RecordExpr, env *Env) (A0Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			rec.Set(p.Key, val)
+			if strings.Contains(p.Key, ".") {
+				rec = withPath(rec, strings.Split(p.Key, "."), val)
+			} else {
+				rec = rec.With(p.Key, val)
+			}
 
 		case *ast.SpreadPair:
 			val, err := ev.evalExpr(p.Expr, env)
@@ -485,13 +766,32 @@ func (ev *evaluator) evalRecord(e *ast.RecordExpr, env *Env) (A0Value, error) {
 					Span:    &span,
 				}
 			}
-			for _, kv := range spreadRec.Pairs {
-				rec.Set(kv.Key, kv.Value)
+			if rec.Len() == 0 {
+				// A leading spread shares the operand's storage.
+				rec = spreadRec.shared()
+				continue
+			}
+			for _, kv := range spreadRec.Pairs() {
+				rec = rec.With(kv.Key, kv.Value)
 			}
 		}
 	}
 
-	return *rec, nil
+	return rec, nil
+}
+
+// withPath sets the value at a dotted record key such as server.port,
+// creating nested records along the way. Like put, it replaces any
+// intermediate value that is not a record.
+func withPath(rec A0Record, path []string, val A0Value) A0Record {
+	if len(path) == 1 {
+		return rec.With(path[0], val)
+	}
+	var inner A0Record
+	if existing, ok := rec.Get(path[0]); ok {
+		inner, _ = existing.(A0Record)
+	}
+	return rec.With(path[0], withPath(inner, path[1:], val))
 }
 
 func (ev *evaluator) evalList(e *ast.ListExpr, env *Env) (A0Value, error) {
@@ -506,6 +806,26 @@ func (ev *evaluator) evalList(e *ast.ListExpr, env *Env) (A0Value, error) {
 	return NewList(items), nil
 }
 
+// finiteResult returns the result of l op r, or an E_TYPE error naming the
+// operation when it overflowed to an infinity or is NaN: A0 numbers are
+// finite so that every value can be written as JSON.
+func finiteResult(op ast.BinaryOp, l, r, result float64, span *ast.Span) (A0Value, error) {
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		details := NewRecord([]KeyValue{
+			{Key: "op", Value: NewString(string(op))},
+			{Key: "left", Value: NewNumber(l)},
+			{Key: "right", Value: NewNumber(r)},
+		}).(A0Record)
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: fmt.Sprintf("%s %s %s is not a finite number", FormatNumber(l), string(op), FormatNumber(r)),
+			Span:    span,
+			Details: &details,
+		}
+	}
+	return NewNumber(result), nil
+}
+
 func (ev *evaluator) evalBinaryOp(e *ast.BinaryExpr, env *Env) (A0Value, error) {
 	left, err := ev.evalExpr(e.Left, env)
 	if err != nil {
@@ -516,14 +836,14 @@ func (ev *evaluator) evalBinaryOp(e *ast.BinaryExpr, env *Env) (A0Value, error)
 		return nil, err
 	}
 
-	span := e.Span
+	span := &e.Span
 
 	switch e.Op {
 	case ast.OpAdd:
 		// Number + Number or String + String
 		if lNum, ok := left.(A0Number); ok {
 			if rNum, ok := right.(A0Number); ok {
-				return NewNumber(lNum.Value + rNum.Value), nil
+				return finiteResult(e.Op, lNum.Value, rNum.Value, lNum.Value+rNum.Value, span)
 			}
 		}
 		if lStr, ok := left.(A0String); ok {
@@ -534,7 +854,7 @@ func (ev *evaluator) evalBinaryOp(e *ast.BinaryExpr, env *Env) (A0Value, error)
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.EType,
 			Message: fmt.Sprintf("Operator '+' requires two numbers or two strings, got %s and %s.", typeNameOf(left), typeNameOf(right)),
-			Span:    &span,
+			Span:    span,
 		}
 
 	case ast.OpSub, ast.OpMul, ast.OpDiv, ast.OpMod:
@@ -544,24 +864,24 @@ func (ev *evaluator) evalBinaryOp(e *ast.BinaryExpr, env *Env) (A0Value, error)
 			return nil, &A0RuntimeError{
 				Code:    diagnostics.EType,
 				Message: fmt.Sprintf("'%s' requires two numbers", string(e.Op)),
-				Span:    &span,
+				Span:    span,
 			}
 		}
 		switch e.Op {
 		case ast.OpSub:
-			return NewNumber(lNum.Value - rNum.Value), nil
+			return finiteResult(e.Op, lNum.Value, rNum.Value, lNum.Value-rNum.Value, span)
 		case ast.OpMul:
-			return NewNumber(lNum.Value * rNum.Value), nil
+			return finiteResult(e.Op, lNum.Value, rNum.Value, lNum.Value*rNum.Value, span)
 		case ast.OpDiv:
 			if rNum.Value == 0 {
-				return nil, &A0RuntimeError{Code: diagnostics.EType, Message: "division by zero", Span: &span}
+				return nil, &A0RuntimeError{Code: diagnostics.EType, Message: "division by zero", Span: span}
 			}
-			return NewNumber(lNum.Value / rNum.Value), nil
+			return finiteResult(e.Op, lNum.Value, rNum.Value, lNum.Value/rNum.Value, span)
 		case ast.OpMod:
 			if rNum.Value == 0 {
-				return nil, &A0RuntimeError{Code: diagnostics.EType, Message: "modulo by zero", Span: &span}
+				return nil, &A0RuntimeError{Code: diagnostics.EType, Message: "modulo by zero", Span: span}
 			}
-			return NewNumber(math.Mod(lNum.Value, rNum.Value)), nil
+			return finiteResult(e.Op, lNum.Value, rNum.Value, math.Mod(lNum.Value, rNum.Value), span)
 		}
 
 	case ast.OpEqEq:
@@ -602,7 +922,7 @@ func (ev *evaluator) evalBinaryOp(e *ast.BinaryExpr, env *Env) (A0Value, error)
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.EType,
 			Message: fmt.Sprintf("'%s' requires two numbers or two strings", string(e.Op)),
-			Span:    &span,
+			Span:    span,
 		}
 	}
 
@@ -625,12 +945,75 @@ func (ev *evaluator) evalUnary(e *ast.UnaryExpr, env *Env) (A0Value, error) {
 	}
 }
 
+// evalIndex indexes a string by code point or a list by position.
+// Out-of-range indexes yield null, like missing record fields.
+func (ev *evaluator) evalIndex(e *ast.IndexExpr, env *Env) (A0Value, error) {
+	target, err := ev.evalExpr(e.Target, env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := ev.evalExpr(e.Index, env)
+	if err != nil {
+		return nil, err
+	}
+	span := e.Span
+	num, ok := index.(A0Number)
+	if !ok || num.Value != math.Trunc(num.Value) {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: fmt.Sprintf("index must be an integer, got %s", typeNameOf(index)),
+			Span:    &span,
+		}
+	}
+	i := int(num.Value)
+	switch t := target.(type) {
+	case A0String:
+		runes := []rune(t.Value)
+		if i < 0 || i >= len(runes) {
+			return NewNull(), nil
+		}
+		return NewString(string(runes[i])), nil
+	case A0List:
+		if i < 0 || i >= len(t.Items) {
+			return NewNull(), nil
+		}
+		return t.Items[i], nil
+	}
+	return nil, &A0RuntimeError{
+		Code:    diagnostics.EType,
+		Message: fmt.Sprintf("cannot index %s; only strings and lists support [i]", typeNameOf(target)),
+		Span:    &span,
+	}
+}
+
+// truthy decides a condition. With ExecOptions.StrictBool only booleans are
+// accepted; otherwise the value's truthiness is used.
+func (ev *evaluator) truthy(construct string, val A0Value, span *ast.Span) (bool, error) {
+	if b, ok := val.(A0Bool); ok {
+		return b.Value, nil
+	}
+	if ev.opts.StrictBool {
+		return false, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: fmt.Sprintf("%s condition must be a boolean, got %s (strictBool)", construct, typeNameOf(val)),
+			Span:    span,
+		}
+	}
+	return Truthiness(val), nil
+}
+
 func (ev *evaluator) evalIfExpr(e *ast.IfExpr, env *Env) (A0Value, error) {
 	cond, err := ev.evalExpr(e.Cond, env)
 	if err != nil {
 		return nil, err
 	}
-	if Truthiness(cond) {
+	span := e.Span
+	ev.warnCoercion("if", cond, &span)
+	ok, err := ev.truthy("if", cond, &span)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
 		return ev.evalExpr(e.Then, env)
 	}
 	return ev.evalExpr(e.Else, env)
@@ -641,7 +1024,13 @@ func (ev *evaluator) evalIfBlockExpr(e *ast.IfBlockExpr, env *Env) (A0Value, err
 	if err != nil {
 		return nil, err
 	}
-	if Truthiness(cond) {
+	span := e.Span
+	ev.warnCoercion("if", cond, &span)
+	ok, err := ev.truthy("if", cond, &span)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
 		childEnv := env.Child()
 		return ev.executeBlock(e.ThenBody, childEnv)
 	}
@@ -653,33 +1042,52 @@ func (ev *evaluator) evalIfBlockExpr(e *ast.IfBlockExpr, env *Env) (A0Value, err
 }
 
 func (ev *evaluator) evalForExpr(e *ast.ForExpr, env *Env) (A0Value, error) {
-	listVal, err := ev.evalExpr(e.List, env)
+	rng, isRange, err := ev.forRange(e.List, env)
 	if err != nil {
 		return nil, err
 	}
-	list, ok := listVal.(A0List)
-	if !ok {
-		span := e.Span
-		return nil, &A0RuntimeError{
-			Code:    diagnostics.EForNotList,
-			Message: "for expression requires a list",
-			Span:    &span,
+	var items []A0Value
+	n := rng.Len
+	if !isRange {
+		listVal, err := ev.evalExpr(e.List, env)
+		if err != nil {
+			return nil, err
 		}
+		switch v := listVal.(type) {
+		case A0List:
+			items = v.Items
+		case A0Record:
+			// Iterating a record binds { key, value } per pair, like entries.
+			items = v.Entries()
+		default:
+			span := e.Span
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EForNotList,
+				Message: "for expression requires a list or record",
+				Span:    &span,
+			}
+		}
+		n = len(items)
 	}
 
 	span := e.Span
 	ev.emit(TraceForStart, &span)
 
-	results := make([]A0Value, 0, len(list.Items))
-	for _, item := range list.Items {
+	results := make([]A0Value, 0, n)
+	for i := 0; i < n; i++ {
 		if err := ev.checkTimeBudget(); err != nil {
 			return nil, err
 		}
-		if err := ev.checkIterationBudget(); err != nil {
+		if err := ev.countIteration(); err != nil {
 			return nil, err
 		}
-		ev.tracker.Iterations++
 
+		var item A0Value
+		if isRange {
+			item = NewNumber(rng.At(i))
+		} else {
+			item = items[i]
+		}
 		childEnv := env.Child()
 		childEnv.Set(e.Binding, item)
 		val, err := ev.executeBlock(e.Body, childEnv)
@@ -735,21 +1143,65 @@ func (ev *evaluator) evalMatchExpr(e *ast.MatchExpr, env *Env) (A0Value, error)
 	}
 }
 
+// evalTypeMatchExpr runs the arm of match type (x) { ... } named after x's
+// typeof, falling back to the _ arm, with the arm's binding set to x.
+func (ev *evaluator) evalTypeMatchExpr(e *ast.TypeMatchExpr, env *Env) (A0Value, error) {
+	subject, err := ev.evalExpr(e.Subject, env)
+	if err != nil {
+		return nil, err
+	}
+
+	span := e.Span
+	ev.emit(TraceMatchStart, &span)
+
+	typ := typeNameOf(subject)
+	var arm *ast.MatchArm
+	for _, a := range e.Arms {
+		if a.Tag == typ || (a.Tag == "_" && arm == nil) {
+			arm = a
+		}
+	}
+	if arm == nil {
+		ev.emit(TraceMatchEnd, &span)
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EMatchNoArm,
+			Message: fmt.Sprintf("no match type arm for %s; add a %s arm or a _ arm", typ, typ),
+			Span:    &span,
+		}
+	}
+
+	childEnv := env.Child()
+	if arm.Binding != "" {
+		childEnv.Set(arm.Binding, subject)
+	}
+	val, err := ev.executeBlock(arm.Body, childEnv)
+	ev.emit(TraceMatchEnd, &span)
+	return val, err
+}
+
 func (ev *evaluator) evalTryExpr(e *ast.TryExpr, env *Env) (A0Value, error) {
 	span := e.Span
 	ev.emit(TraceTryStart, &span)
 
 	tryEnv := env.Child()
+	ev.tryDepth++
 	val, err := ev.executeBlock(e.TryBody, tryEnv)
+	ev.tryDepth--
 	if err != nil {
 		if rtErr, ok := err.(*A0RuntimeError); ok {
 			// Catch the error
 			catchEnv := env.Child()
-			errRec := NewRecord([]KeyValue{
+			pairs := []KeyValue{
 				{Key: "code", Value: NewString(rtErr.Code)},
 				{Key: "message", Value: NewString(rtErr.Message)},
-			})
-			catchEnv.Set(e.CatchBinding, errRec)
+			}
+			if rtErr.Details != nil {
+				pairs = append(pairs, KeyValue{Key: "details", Value: *rtErr.Details})
+			}
+			if rtErr.locals != nil {
+				pairs = append(pairs, KeyValue{Key: "locals", Value: *rtErr.locals})
+			}
+			catchEnv.Set(e.CatchBinding, NewRecord(pairs))
 			result, catchErr := ev.executeBlock(e.CatchBody, catchEnv)
 			ev.emit(TraceTryEnd, &span)
 			return result, catchErr
@@ -784,10 +1236,9 @@ func (ev *evaluator) evalFilterBlockExpr(e *ast.FilterBlockExpr, env *Env) (A0Va
 		if err := ev.checkTimeBudget(); err != nil {
 			return nil, err
 		}
-		if err := ev.checkIterationBudget(); err != nil {
+		if err := ev.countIteration(); err != nil {
 			return nil, err
 		}
-		ev.tracker.Iterations++
 
 		childEnv := env.Child()
 		if e.Binding != "" {
@@ -797,7 +1248,11 @@ func (ev *evaluator) evalFilterBlockExpr(e *ast.FilterBlockExpr, env *Env) (A0Va
 		if err != nil {
 			return nil, err
 		}
-		if Truthiness(val) {
+		keep, err := ev.truthy("filter", val, &span)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
 			results = append(results, item)
 		}
 	}
@@ -806,6 +1261,56 @@ func (ev *evaluator) evalFilterBlockExpr(e *ast.FilterBlockExpr, env *Env) (A0Va
 	return NewList(results), nil
 }
 
+// evalFindBlockExpr returns the first item for which the body is truthy,
+// or null. Items after it are not visited, so they use no iterations.
+func (ev *evaluator) evalFindBlockExpr(e *ast.FindBlockExpr, env *Env) (A0Value, error) {
+	listVal, err := ev.evalExpr(e.List, env)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := listVal.(A0List)
+	if !ok {
+		span := e.Span
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: "find block requires a list",
+			Span:    &span,
+		}
+	}
+
+	span := e.Span
+	ev.emit(TraceFindStart, &span)
+
+	for _, item := range list.Items {
+		if err := ev.checkTimeBudget(); err != nil {
+			return nil, err
+		}
+		if err := ev.countIteration(); err != nil {
+			return nil, err
+		}
+
+		childEnv := env.Child()
+		if e.Binding != "" {
+			childEnv.Set(e.Binding, item)
+		}
+		val, err := ev.executeBlock(e.Body, childEnv)
+		if err != nil {
+			return nil, err
+		}
+		found, err := ev.truthy("find", val, &span)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			ev.emit(TraceFindEnd, &span)
+			return item, nil
+		}
+	}
+
+	ev.emit(TraceFindEnd, &span)
+	return NewNull(), nil
+}
+
 func (ev *evaluator) evalLoopExpr(e *ast.LoopExpr, env *Env) (A0Value, error) {
 	var current A0Value = NewNull()
 	if e.Init != nil {
@@ -843,10 +1348,9 @@ func (ev *evaluator) evalLoopExpr(e *ast.LoopExpr, env *Env) (A0Value, error) {
 		if err := ev.checkTimeBudget(); err != nil {
 			return nil, err
 		}
-		if err := ev.checkIterationBudget(); err != nil {
+		if err := ev.countIteration(); err != nil {
 			return nil, err
 		}
-		ev.tracker.Iterations++
 
 		childEnv := env.Child()
 		if e.Binding != "" {
@@ -879,6 +1383,10 @@ func (ev *evaluator) evalAssertExpr(e *ast.AssertExpr, env *Env) (A0Value, error
 		}
 	}
 
+	if e.Approx {
+		return ev.evalAssertApprox(e, rec)
+	}
+
 	thatVal, _ := rec.Get("that")
 	msgVal, _ := rec.Get("msg")
 	msg := ""
@@ -886,16 +1394,21 @@ func (ev *evaluator) evalAssertExpr(e *ast.AssertExpr, env *Env) (A0Value, error
 		msg = s.Value
 	}
 
-	ok = Truthiness(thatVal)
 	span := e.Span
+	ok, err = ev.truthy("assert", thatVal, &span)
+	if err != nil {
+		return nil, err
+	}
 	evidence := Evidence{
 		Kind: "assert",
 		OK:   ok,
 		Msg:  msg,
 		Span: &span,
 	}
-	ev.evidence = append(ev.evidence, evidence)
-	ev.emit(TraceEvidence, &span)
+	if !ok {
+		evidence.Details = ev.eqDiffDetails(e.Args)
+	}
+	ev.recordEvidence(evidence)
 
 	// Return evidence as record
 	evRecord := NewRecord([]KeyValue{
@@ -910,6 +1423,7 @@ func (ev *evaluator) evalAssertExpr(e *ast.AssertExpr, env *Env) (A0Value, error
 			Code:    diagnostics.EAssert,
 			Message: fmt.Sprintf("assertion failed: %s", msg),
 			Span:    &span,
+			Details: evidence.Details,
 		}
 	}
 
@@ -939,16 +1453,21 @@ func (ev *evaluator) evalCheckExpr(e *ast.CheckExpr, env *Env) (A0Value, error)
 		msg = s.Value
 	}
 
-	ok = Truthiness(thatVal)
 	span := e.Span
+	ok, err = ev.truthy("check", thatVal, &span)
+	if err != nil {
+		return nil, err
+	}
 	evidence := Evidence{
 		Kind: "check",
 		OK:   ok,
 		Msg:  msg,
 		Span: &span,
 	}
-	ev.evidence = append(ev.evidence, evidence)
-	ev.emit(TraceEvidence, &span)
+	if !ok {
+		evidence.Details = ev.eqDiffDetails(e.Args)
+	}
+	ev.recordEvidence(evidence)
 
 	// Return evidence as record
 	evRecord := NewRecord([]KeyValue{
@@ -973,6 +1492,9 @@ func (ev *evaluator) evalCallExpr(e *ast.CallExpr, env *Env) (A0Value, error) {
 			Span:    &span,
 		}
 	}
+	if err := ev.checkToolCaps(tool, e.Span); err != nil {
+		return nil, err
+	}
 
 	// Evaluate args
 	argsVal, err := ev.evalExpr(e.Args, env)
@@ -996,26 +1518,52 @@ func (ev *evaluator) evalCallExpr(e *ast.CallExpr, env *Env) (A0Value, error) {
 			Message: "tool call budget exceeded",
 		}
 	}
+	if err := ev.chargeShared("maxToolCalls", 1); err != nil {
+		return nil, err
+	}
 	ev.tracker.ToolCalls++
 
 	span := e.Span
+	if err := ev.checkTaint(tool, argsRec, &span); err != nil {
+		return nil, err
+	}
 	ev.emitWithData(TraceToolStart, &span, map[string]string{"tool": toolName})
 
-	result, err := tool.Execute(ev.ctx, &argsRec)
+	callCtx, timings := ev.beginToolCall()
+	result, err := tool.Execute(callCtx, &argsRec)
 
-	ev.emit(TraceToolEnd, &span)
+	ev.emitToolEnd(toolName, timings, result, err, &span)
 
 	if err != nil {
+		// A tool cut short by the timeMs deadline is a budget failure
+		if bErr := ev.checkTimeBudget(); bErr != nil {
+			return nil, bErr
+		}
+		var rtErr *A0RuntimeError
+		if errors.As(err, &rtErr) && rtErr.Code == diagnostics.EBudget {
+			rtErr.Span = &span
+			return nil, rtErr
+		}
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.ETool,
 			Message: fmt.Sprintf("tool '%s' error: %s", toolName, err.Error()),
 			Span:    &span,
 		}
 	}
+	ev.emitToolData(toolName, result, &span)
+	if ev.taint != nil {
+		ev.taint.mark(result, toolSources(tool))
+	}
 
 	if bErr := ev.trackBytesWritten(result); bErr != nil {
 		return nil, bErr
 	}
+	if bErr := ev.trackBytesRead(result); bErr != nil {
+		return nil, bErr
+	}
+	if mErr := ev.chargeMemory(result, true); mErr != nil {
+		return nil, mErr
+	}
 
 	return result, nil
 }
@@ -1032,6 +1580,9 @@ func (ev *evaluator) evalDoExpr(e *ast.DoExpr, env *Env) (A0Value, error) {
 			Span:    &span,
 		}
 	}
+	if err := ev.checkToolCaps(tool, e.Span); err != nil {
+		return nil, err
+	}
 
 	argsVal, err := ev.evalExpr(e.Args, env)
 	if err != nil {
@@ -1047,32 +1598,69 @@ func (ev *evaluator) evalDoExpr(e *ast.DoExpr, env *Env) (A0Value, error) {
 		}
 	}
 
+	if ev.opts.Plan {
+		span := e.Span
+		if err := ev.checkTaint(tool, argsRec, &span); err != nil {
+			return nil, err
+		}
+		return ev.planDo(toolName, argsRec, span), nil
+	}
+
 	if ev.budget.MaxToolCalls != nil && ev.tracker.ToolCalls >= *ev.budget.MaxToolCalls {
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.EBudget,
 			Message: "tool call budget exceeded",
 		}
 	}
+	if err := ev.chargeShared("maxToolCalls", 1); err != nil {
+		return nil, err
+	}
 	ev.tracker.ToolCalls++
 
 	span := e.Span
+	if err := ev.checkTaint(tool, argsRec, &span); err != nil {
+		return nil, err
+	}
+	if err := ev.txPrepare(tool, &argsRec, &span); err != nil {
+		return nil, err
+	}
 	ev.emitWithData(TraceToolStart, &span, map[string]string{"tool": toolName})
 
-	result, err := tool.Execute(ev.ctx, &argsRec)
+	callCtx, timings := ev.beginToolCall()
+	result, err := tool.Execute(callCtx, &argsRec)
 
-	ev.emit(TraceToolEnd, &span)
+	ev.emitToolEnd(toolName, timings, result, err, &span)
 
 	if err != nil {
+		// A tool cut short by the timeMs deadline is a budget failure
+		if bErr := ev.checkTimeBudget(); bErr != nil {
+			return nil, bErr
+		}
+		var rtErr *A0RuntimeError
+		if errors.As(err, &rtErr) && rtErr.Code == diagnostics.EBudget {
+			rtErr.Span = &span
+			return nil, rtErr
+		}
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.ETool,
 			Message: fmt.Sprintf("tool '%s' error: %s", toolName, err.Error()),
 			Span:    &span,
 		}
 	}
+	ev.emitToolData(toolName, result, &span)
+	if ev.taint != nil {
+		ev.taint.mark(result, toolSources(tool))
+	}
 
 	if bErr := ev.trackBytesWritten(result); bErr != nil {
 		return nil, bErr
 	}
+	if bErr := ev.trackBytesRead(result); bErr != nil {
+		return nil, bErr
+	}
+	if mErr := ev.chargeMemory(result, true); mErr != nil {
+		return nil, mErr
+	}
 
 	return result, nil
 }
@@ -1096,7 +1684,11 @@ func (ev *evaluator) evalFnCallExpr(e *ast.FnCallExpr, env *Env) (A0Value, error
 	}
 
 	// Check user-defined functions first
-	if uf, ok := ev.userFns[fnName]; ok {
+	uf, err := ev.lookupFn(fnName, &e.Span)
+	if err != nil {
+		return nil, err
+	}
+	if uf != nil {
 		span := e.Span
 		ev.emit(TraceFnCallStart, &span)
 
@@ -1110,7 +1702,7 @@ func (ev *evaluator) evalFnCallExpr(e *ast.FnCallExpr, env *Env) (A0Value, error
 			childEnv.Set(param, val)
 		}
 
-		result, err := ev.executeBlock(uf.decl.Body, childEnv)
+		result, err := ev.runUserFn(uf, childEnv)
 		ev.emit(TraceFnCallEnd, &span)
 		if err != nil {
 			return nil, err
@@ -1122,11 +1714,41 @@ func (ev *evaluator) evalFnCallExpr(e *ast.FnCallExpr, env *Env) (A0Value, error
 	if stdFn, ok := ev.opts.Stdlib[fnName]; ok {
 		// Special handling for map/reduce/filter which take function args
 		if fnName == "map" {
-			return ev.evalMapCall(&argsRec, env, e)
+			val, err := ev.evalMapCall(&argsRec, env, e)
+			return ev.allocated(val, err, false)
 		}
 		if fnName == "reduce" {
 			return ev.evalReduceCall(&argsRec, env, e)
 		}
+		if fnName == "expect.snapshot" {
+			return ev.evalSnapshot(&argsRec, e)
+		}
+		if fnName == "expect.schema" {
+			return ev.evalExpectSchema(&argsRec, e)
+		}
+		if fnName == "forall" {
+			return ev.evalForallCall(&argsRec, e)
+		}
+		if fnName == "paginate" {
+			val, err := ev.evalPaginateCall(&argsRec, e)
+			return ev.allocated(val, err, false)
+		}
+		if fnName == "call.batch" {
+			val, err := ev.evalCallBatch(&argsRec, e)
+			return ev.allocated(val, err, false)
+		}
+		if fnName == "evidence" {
+			return ev.evalEvidenceCall(&argsRec, e)
+		}
+		if fnName == "tools.list" {
+			return ev.evalToolsList(), nil
+		}
+		if fnName == "stdlib.list" {
+			return ev.evalStdlibList(), nil
+		}
+		if level, ok := strings.CutPrefix(fnName, "log."); ok {
+			return ev.evalLogCall(level, &argsRec, e)
+		}
 		if fnName == "filter" {
 			// Check if fn: or by: args are present — if fn:, dispatch specially
 			_, hasFn := argsRec.Get("fn")
@@ -1135,19 +1757,44 @@ func (ev *evaluator) evalFnCallExpr(e *ast.FnCallExpr, env *Env) (A0Value, error
 				return ev.evalFilterFnCall(&argsRec, env, e)
 			}
 		}
+		if fnName == "eq" {
+			a, _ := argsRec.Get("a")
+			b, _ := argsRec.Get("b")
+			ev.lastEq = &eqOperands{call: e, a: orNull(a), b: orNull(b)}
+		}
 
 		span := e.Span
+		if stdFn.Deprecated != "" {
+			ev.warn(diagnostics.EDeprecated,
+				fmt.Sprintf("stdlib '%s' is deprecated; use '%s' instead", fnName, stdFn.Deprecated), &span, "")
+		}
 		ev.emit(TraceFnCallStart, &span)
 		result, err := stdFn.Execute(&argsRec)
 		ev.emit(TraceFnCallEnd, &span)
 		if err != nil {
+			// A function can return an *A0RuntimeError to attach details.
+			var details *A0Record
+			var rtErr *A0RuntimeError
+			if errors.As(err, &rtErr) {
+				details = rtErr.Details
+			}
 			return nil, &A0RuntimeError{
 				Code:    diagnostics.EFn,
 				Message: fmt.Sprintf("stdlib '%s' error: %s", fnName, err.Error()),
 				Span:    &span,
+				Details: details,
 			}
 		}
-		return result, nil
+		ev.propagateTaint(argsRec, result)
+		return ev.allocated(result, nil, true)
+	}
+
+	if hostFn, ok := ev.opts.HostFns[fnName]; ok {
+		result, err := ev.callHostFn(fnName, hostFn, &argsRec, e)
+		if err == nil {
+			ev.propagateTaint(argsRec, result)
+		}
+		return result, err
 	}
 
 	span := e.Span
@@ -1158,6 +1805,31 @@ func (ev *evaluator) evalFnCallExpr(e *ast.FnCallExpr, env *Env) (A0Value, error
 	}
 }
 
+func (ev *evaluator) callHostFn(name string, fn HostFn, args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	ev.emit(TraceFnCallStart, &span)
+	result, err := fn(ev.ctx, args)
+	ev.emit(TraceFnCallEnd, &span)
+	if err != nil {
+		var rtErr *A0RuntimeError
+		if errors.As(err, &rtErr) {
+			if rtErr.Span == nil {
+				rtErr.Span = &span
+			}
+			return nil, rtErr
+		}
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("host function '%s' error: %s", name, err.Error()),
+			Span:    &span,
+		}
+	}
+	if result == nil {
+		result = NewNull()
+	}
+	return ev.allocated(result, nil, true)
+}
+
 func (ev *evaluator) evalMapCall(args *A0Record, env *Env, e *ast.FnCallExpr) (A0Value, error) {
 	span := e.Span
 	ev.emit(TraceMapStart, &span)
@@ -1179,8 +1851,11 @@ func (ev *evaluator) evalMapCall(args *A0Record, env *Env, e *ast.FnCallExpr) (A
 		}
 	}
 
-	uf, found := ev.userFns[fnName]
-	if !found {
+	uf, err := ev.lookupFn(fnName, &span)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.EUnknownFn,
 			Message: fmt.Sprintf("unknown function '%s'", fnName),
@@ -1188,15 +1863,34 @@ func (ev *evaluator) evalMapCall(args *A0Record, env *Env, e *ast.FnCallExpr) (A
 		}
 	}
 
+	workers, err := parallelArg(args, &span)
+	if err != nil {
+		return nil, err
+	}
+	if workers > 1 && !ev.parallel {
+		if reason := ev.impurity(uf, map[*ast.FnDecl]bool{}); reason != "" {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: fmt.Sprintf("map: 'parallel' requires a pure fn, but '%s' %s", fnName, reason),
+				Span:    &span,
+			}
+		}
+		results, err := ev.parallelMap(uf, list.Items, workers)
+		if err != nil {
+			return nil, err
+		}
+		ev.emit(TraceMapEnd, &span)
+		return NewList(results), nil
+	}
+
 	results := make([]A0Value, 0, len(list.Items))
 	for _, item := range list.Items {
-		if err := ev.checkIterationBudget(); err != nil {
+		if err := ev.countIteration(); err != nil {
 			return nil, err
 		}
-		ev.tracker.Iterations++
 
 		childEnv := ev.bindFnParams(uf, item)
-		result, err := ev.executeBlock(uf.decl.Body, childEnv)
+		result, err := ev.runUserFn(uf, childEnv)
 		if err != nil {
 			return nil, err
 		}
@@ -1229,8 +1923,11 @@ func (ev *evaluator) evalReduceCall(args *A0Record, env *Env, e *ast.FnCallExpr)
 		}
 	}
 
-	uf, found := ev.userFns[fnName]
-	if !found {
+	uf, err := ev.lookupFn(fnName, &span)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.EUnknownFn,
 			Message: fmt.Sprintf("unknown function '%s'", fnName),
@@ -1244,10 +1941,9 @@ func (ev *evaluator) evalReduceCall(args *A0Record, env *Env, e *ast.FnCallExpr)
 	}
 
 	for _, item := range list.Items {
-		if err := ev.checkIterationBudget(); err != nil {
+		if err := ev.countIteration(); err != nil {
 			return nil, err
 		}
-		ev.tracker.Iterations++
 
 		// Bind positionally: params[0]=acc, params[1]=item
 		childEnv := uf.closure.Child()
@@ -1258,7 +1954,7 @@ func (ev *evaluator) evalReduceCall(args *A0Record, env *Env, e *ast.FnCallExpr)
 			childEnv.Set(uf.decl.Params[1], item)
 		}
 
-		result, err := ev.executeBlock(uf.decl.Body, childEnv)
+		result, err := ev.runUserFn(uf, childEnv)
 		if err != nil {
 			return nil, err
 		}
@@ -1310,17 +2006,23 @@ func (ev *evaluator) evalFilterFnCall(args *A0Record, env *Env, e *ast.FnCallExp
 
 		var results []A0Value
 		for _, item := range list.Items {
-			if err := ev.checkIterationBudget(); err != nil {
+			if err := ev.countIteration(); err != nil {
 				return nil, err
 			}
-			ev.tracker.Iterations++
 
 			rec, ok := item.(A0Record)
 			if !ok {
 				continue // discard non-records
 			}
 			val, found := rec.Get(byStr.Value)
-			if found && Truthiness(val) {
+			if !found {
+				continue
+			}
+			keep, err := ev.truthy("filter", val, &span)
+			if err != nil {
+				return nil, err
+			}
+			if keep {
 				results = append(results, item)
 			}
 		}
@@ -1340,8 +2042,11 @@ func (ev *evaluator) evalFilterFnCall(args *A0Record, env *Env, e *ast.FnCallExp
 		}
 	}
 
-	uf, found := ev.userFns[fnStr.Value]
-	if !found {
+	uf, err := ev.lookupFn(fnStr.Value, &span)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
 		return nil, &A0RuntimeError{
 			Code:    diagnostics.EUnknownFn,
 			Message: fmt.Sprintf("unknown function '%s'", fnStr.Value),
@@ -1351,23 +2056,23 @@ func (ev *evaluator) evalFilterFnCall(args *A0Record, env *Env, e *ast.FnCallExp
 
 	var results []A0Value
 	for _, item := range list.Items {
-		if err := ev.checkIterationBudget(); err != nil {
+		if err := ev.countIteration(); err != nil {
 			return nil, err
 		}
-		ev.tracker.Iterations++
 
 		childEnv := ev.bindFnParams(uf, item)
-		result, err := ev.executeBlock(uf.decl.Body, childEnv)
+		result, err := ev.runUserFn(uf, childEnv)
 		if err != nil {
 			return nil, err
 		}
 		// Check the first value of the result record for truthiness
 		// (fn returns { ok: bool }, filter checks the first value)
-		keep := false
-		if rec, ok := result.(A0Record); ok && len(rec.Pairs) > 0 {
-			keep = Truthiness(rec.Pairs[0].Value)
-		} else {
-			keep = Truthiness(result)
+		if rec, ok := result.(A0Record); ok && rec.Len() > 0 {
+			result = rec.Pairs()[0].Value
+		}
+		keep, err := ev.truthy("filter", result, &span)
+		if err != nil {
+			return nil, err
 		}
 		if keep {
 			results = append(results, item)
@@ -1408,6 +2113,26 @@ func (ev *evaluator) bindFnParams(uf *userFn, item A0Value) *Env {
 	return childEnv
 }
 
+// emitToolData emits tool-specific trace events derived from a tool result.
+func (ev *evaluator) emitToolData(toolName string, result A0Value, span *ast.Span) {
+	if toolName != "time.sleep" {
+		return
+	}
+	rec, ok := result.(A0Record)
+	if !ok {
+		return
+	}
+	data := make(map[string]string)
+	for _, key := range []string{"requestedMs", "actualMs"} {
+		if v, found := rec.Get(key); found {
+			if n, ok := v.(A0Number); ok {
+				data[key] = FormatNumber(n.Value)
+			}
+		}
+	}
+	ev.emitWithData(TraceSleep, span, data)
+}
+
 // trackBytesWritten checks tool result for bytes field and tracks it against budget.
 func (ev *evaluator) trackBytesWritten(result A0Value) error {
 	if result == nil {
@@ -1422,6 +2147,9 @@ func (ev *evaluator) trackBytesWritten(result A0Value) error {
 		return nil
 	}
 	if num, ok := bytesVal.(A0Number); ok {
+		if err := ev.chargeShared("maxBytesWritten", int64(num.Value)); err != nil {
+			return err
+		}
 		ev.tracker.BytesWritten += int64(num.Value)
 		if ev.budget.MaxBytesWritten != nil && ev.tracker.BytesWritten > *ev.budget.MaxBytesWritten {
 			return &A0RuntimeError{
@@ -1433,6 +2161,31 @@ func (ev *evaluator) trackBytesWritten(result A0Value) error {
 	return nil
 }
 
+// trackBytesRead checks tool result for a bytesRead field and tracks it against budget.
+func (ev *evaluator) trackBytesRead(result A0Value) error {
+	rec, ok := result.(A0Record)
+	if !ok {
+		return nil
+	}
+	bytesVal, found := rec.Get("bytesRead")
+	if !found {
+		return nil
+	}
+	if num, ok := bytesVal.(A0Number); ok {
+		if err := ev.chargeShared("maxBytesRead", int64(num.Value)); err != nil {
+			return err
+		}
+		ev.tracker.BytesRead += int64(num.Value)
+		if ev.budget.MaxBytesRead != nil && ev.tracker.BytesRead > *ev.budget.MaxBytesRead {
+			return &A0RuntimeError{
+				Code:    diagnostics.EBudget,
+				Message: fmt.Sprintf("bytes read budget exceeded (max %d)", *ev.budget.MaxBytesRead),
+			}
+		}
+	}
+	return nil
+}
+
 // DeepEqual recursively compares two A0 values.
 // typeNameOf returns the A0 type name for error messages.
 func typeNameOf(v A0Value) string {
@@ -1484,6 +2237,12 @@ func DeepEqual(a, b A0Value) bool {
 		if !ok || len(av.Items) != len(bv.Items) {
 			return false
 		}
+		if sameBacking(av.Items, bv.Items) {
+			return true
+		}
+		if hashesDiffer(av, bv) {
+			return false
+		}
 		for i := range av.Items {
 			if !DeepEqual(av.Items[i], bv.Items[i]) {
 				return false
@@ -1493,10 +2252,16 @@ func DeepEqual(a, b A0Value) bool {
 
 	case A0Record:
 		bv, ok := b.(A0Record)
-		if !ok || len(av.Pairs) != len(bv.Pairs) {
+		if !ok || av.Len() != bv.Len() {
+			return false
+		}
+		if sameBacking(av.Pairs(), bv.Pairs()) {
+			return true
+		}
+		if hashesDiffer(av, bv) {
 			return false
 		}
-		for _, kv := range av.Pairs {
+		for _, kv := range av.Pairs() {
 			bVal, found := bv.Get(kv.Key)
 			if !found || !DeepEqual(kv.Value, bVal) {
 				return false
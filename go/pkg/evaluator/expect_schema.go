@@ -0,0 +1,182 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// schemaTypes are the type names a schema may use: those typeof returns,
+// plus "any".
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "number": true, "string": true,
+	"list": true, "record": true, "any": true,
+}
+
+// schemaViolation is one place where a value does not match its schema.
+// Actual is the type found there, or "missing" for an absent field.
+type schemaViolation struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+// evalExpectSchema implements expect.schema { in, schema, msg? }. schema
+// describes the expected shape:
+//
+//   - a type name ("string", "number", ...; "any" matches everything),
+//     with a trailing "?" when a record field may be missing or null;
+//   - a record, matching a record whose fields match each entry (fields
+//     the schema does not name are allowed);
+//   - a one-item list, matching a list whose items all match that item.
+//
+// The outcome is recorded as non-fatal "schema" evidence, with the
+// violations in its details when the value does not match.
+func (ev *evaluator) evalExpectSchema(args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	schema, found := args.Get("schema")
+	if !found {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: "expect.schema requires a 'schema'",
+			Span:    &span,
+		}
+	}
+	if err := checkSchema(schema, ""); err != nil {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: "expect.schema: " + err.Error(),
+			Span:    &span,
+		}
+	}
+	value, found := args.Get("in")
+	if !found {
+		value = NewNull()
+	}
+
+	var violations []schemaViolation
+	matchSchema(&violations, "", value, schema)
+
+	ok := len(violations) == 0
+	msg := ""
+	if m, found := args.Get("msg"); found {
+		if s, isStr := m.(A0String); isStr {
+			msg = s.Value
+		}
+	}
+	if msg == "" {
+		msg = "value matches schema"
+		if !ok {
+			msg = fmt.Sprintf("value does not match schema (%d violations)", len(violations))
+		}
+	}
+
+	entry := Evidence{Kind: "schema", OK: ok, Msg: msg, Span: &span}
+	if !ok {
+		items := make([]A0Value, 0, min(len(violations), maxDiffEntries))
+		for _, v := range violations[:min(len(violations), maxDiffEntries)] {
+			items = append(items, NewRecord([]KeyValue{
+				{Key: "path", Value: NewString(v.Path)},
+				{Key: "expected", Value: NewString(v.Expected)},
+				{Key: "actual", Value: NewString(v.Actual)},
+			}))
+		}
+		details := NewRecord([]KeyValue{
+			{Key: "violations", Value: NewList(items)},
+			{Key: "total", Value: NewNumber(float64(len(violations)))},
+		}).(A0Record)
+		entry.Details = &details
+	}
+	ev.recordEvidence(entry)
+
+	return NewRecord([]KeyValue{
+		{Key: "kind", Value: NewString("schema")},
+		{Key: "ok", Value: NewBool(ok)},
+		{Key: "msg", Value: NewString(msg)},
+	}), nil
+}
+
+// checkSchema reports the first malformed part of a schema.
+func checkSchema(schema A0Value, path string) error {
+	at := func() string {
+		if path == "" {
+			return ""
+		}
+		return " at " + path
+	}
+	switch s := schema.(type) {
+	case A0String:
+		if !schemaTypes[strings.TrimSuffix(s.Value, "?")] {
+			return fmt.Errorf("unknown type '%s'%s; use null, boolean, number, string, list, record or any", s.Value, at())
+		}
+		return nil
+	case A0Record:
+		for _, kv := range s.Pairs() {
+			if err := checkSchema(kv.Value, joinDiffPath(path, kv.Key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case A0List:
+		if len(s.Items) != 1 {
+			return fmt.Errorf("a list schema must have exactly one item%s, got %d", at(), len(s.Items))
+		}
+		return checkSchema(s.Items[0], path+"[]")
+	}
+	return fmt.Errorf("schema%s must be a type name, record or one-item list, got %s", at(), typeNameOf(schema))
+}
+
+// matchSchema appends the places where value does not match schema, which
+// checkSchema has accepted.
+func matchSchema(out *[]schemaViolation, path string, value, schema A0Value) {
+	switch s := schema.(type) {
+	case A0String:
+		name, optional := strings.CutSuffix(s.Value, "?")
+		if _, isNull := value.(A0Null); isNull && optional {
+			return
+		}
+		if name != "any" && typeNameOf(value) != name {
+			*out = append(*out, schemaViolation{Path: path, Expected: s.Value, Actual: typeNameOf(value)})
+		}
+	case A0Record:
+		rec, ok := value.(A0Record)
+		if !ok {
+			*out = append(*out, schemaViolation{Path: path, Expected: "record", Actual: typeNameOf(value)})
+			return
+		}
+		for _, kv := range s.Pairs() {
+			field, found := rec.Get(kv.Key)
+			if !found {
+				if t, isType := kv.Value.(A0String); isType && strings.HasSuffix(t.Value, "?") {
+					continue
+				}
+				*out = append(*out, schemaViolation{Path: joinDiffPath(path, kv.Key), Expected: schemaName(kv.Value), Actual: "missing"})
+				continue
+			}
+			matchSchema(out, joinDiffPath(path, kv.Key), field, kv.Value)
+		}
+	case A0List:
+		list, ok := value.(A0List)
+		if !ok {
+			*out = append(*out, schemaViolation{Path: path, Expected: "list", Actual: typeNameOf(value)})
+			return
+		}
+		for i, item := range list.Items {
+			matchSchema(out, path+"["+strconv.Itoa(i)+"]", item, s.Items[0])
+		}
+	}
+}
+
+// schemaName is how a schema is named in a violation's expected field.
+func schemaName(schema A0Value) string {
+	switch s := schema.(type) {
+	case A0String:
+		return s.Value
+	case A0List:
+		return "list"
+	}
+	return "record"
+}
@@ -0,0 +1,225 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// DefaultForallRuns is the number of inputs forall tries when runs is omitted.
+const DefaultForallRuns = 100
+
+// evalForallCall implements forall { gen, fn, runs?, seed? }: fn is called
+// with runs generated inputs and every input for which it returns a falsy
+// value (or fails) is recorded as failing evidence. Generation is seeded so
+// a failure can be replayed with the reported seed.
+func (ev *evaluator) evalForallCall(args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	genVal, found := args.Get("gen")
+	if !found {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: "forall requires 'gen' (e.g. gen.int { min: 0, max: 10 })",
+			Span:    &span,
+		}
+	}
+	fnName := ""
+	if fnVal, ok := args.Get("fn"); ok {
+		if s, ok := fnVal.(A0String); ok {
+			fnName = s.Value
+		}
+	}
+	runs := int64(DefaultForallRuns)
+	if v, ok := args.Get("runs"); ok {
+		n, ok := v.(A0Number)
+		if !ok || n.Value < 1 {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: "forall requires 'runs' to be a positive number",
+				Span:    &span,
+			}
+		}
+		runs = int64(n.Value)
+	}
+	seed := time.Now().UnixNano()
+	if v, ok := args.Get("seed"); ok {
+		n, ok := v.(A0Number)
+		if !ok {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: "forall requires 'seed' to be a number",
+				Span:    &span,
+			}
+		}
+		seed = int64(n.Value)
+	}
+
+	uf, err := ev.lookupFn(fnName, &span)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EUnknownFn,
+			Message: fmt.Sprintf("unknown function '%s'", fnName),
+			Span:    &span,
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var counterexamples []A0Value
+	for run := int64(0); run < runs; run++ {
+		if err := ev.countIteration(); err != nil {
+			return nil, err
+		}
+
+		input, err := generate(rng, genVal)
+		if err != nil {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: fmt.Sprintf("forall: %s", err),
+				Span:    &span,
+			}
+		}
+
+		result, err := ev.runUserFn(uf, ev.bindFnParams(uf, input))
+		reason := ""
+		if err != nil {
+			var rtErr *A0RuntimeError
+			if !errors.As(err, &rtErr) || rtErr.Code == diagnostics.EBudget {
+				return nil, err
+			}
+			reason = rtErr.Message
+		} else if !Truthiness(result) {
+			reason = fmt.Sprintf("returned %s", ValueToJSONString(result))
+		}
+		if reason == "" {
+			continue
+		}
+
+		counterexamples = append(counterexamples, input)
+		details := NewRecord([]KeyValue{
+			{Key: "input", Value: input},
+			{Key: "run", Value: NewNumber(float64(run + 1))},
+			{Key: "seed", Value: NewNumber(float64(seed))},
+			{Key: "reason", Value: NewString(reason)},
+		}).(A0Record)
+		ev.recordEvidence(Evidence{
+			Kind: "forall",
+			OK:   false,
+			Msg: fmt.Sprintf("forall '%s' failed on run %d (seed %d) for input %s: %s",
+				fnName, run+1, seed, ValueToJSONString(input), reason),
+			Details: &details,
+			Span:    &span,
+		})
+	}
+
+	ok := len(counterexamples) == 0
+	if ok {
+		ev.recordEvidence(Evidence{
+			Kind: "forall",
+			OK:   true,
+			Msg:  fmt.Sprintf("forall '%s' held for %d runs (seed %d)", fnName, runs, seed),
+			Span: &span,
+		})
+	}
+
+	if counterexamples == nil {
+		counterexamples = []A0Value{}
+	}
+	return NewRecord([]KeyValue{
+		{Key: "ok", Value: NewBool(ok)},
+		{Key: "runs", Value: NewNumber(float64(runs))},
+		{Key: "seed", Value: NewNumber(float64(seed))},
+		{Key: "counterexamples", Value: NewList(counterexamples)},
+	}), nil
+}
+
+// generate produces one value from a generator built by gen.int, gen.string
+// or gen.list. A record of generators yields a record of values and any
+// other value is used as a constant.
+func generate(rng *rand.Rand, g A0Value) (A0Value, error) {
+	rec, ok := g.(A0Record)
+	if !ok {
+		return g, nil
+	}
+	kindVal, _ := rec.Get("gen")
+	kind, ok := kindVal.(A0String)
+	if !ok {
+		pairs := make([]KeyValue, rec.Len())
+		for i, kv := range rec.Pairs() {
+			v, err := generate(rng, kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[i] = KeyValue{Key: kv.Key, Value: v}
+		}
+		return NewRecord(pairs), nil
+	}
+
+	num := func(key string, def int64) int64 {
+		if v, ok := rec.Get(key); ok {
+			if n, ok := v.(A0Number); ok {
+				return int64(n.Value)
+			}
+		}
+		return def
+	}
+	between := func(lo, hi int64) (int64, error) {
+		if hi < lo {
+			return 0, fmt.Errorf("gen.%s: max (%d) is less than min (%d)", kind.Value, hi, lo)
+		}
+		return lo + rng.Int63n(hi-lo+1), nil
+	}
+
+	switch kind.Value {
+	case "int":
+		n, err := between(num("min", 0), num("max", 100))
+		if err != nil {
+			return nil, err
+		}
+		return NewNumber(float64(n)), nil
+
+	case "string":
+		alphabet := []rune(DefaultGenAlphabet)
+		if v, ok := rec.Get("alphabet"); ok {
+			if s, ok := v.(A0String); ok && s.Value != "" {
+				alphabet = []rune(s.Value)
+			}
+		}
+		n, err := between(num("minLen", 0), num("maxLen", 16))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]rune, n)
+		for i := range out {
+			out[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return NewString(string(out)), nil
+
+	case "list":
+		of, found := rec.Get("of")
+		if !found {
+			return nil, fmt.Errorf("gen.list requires 'of'")
+		}
+		n, err := between(num("minLen", 0), num("maxLen", 10))
+		if err != nil {
+			return nil, err
+		}
+		items := make([]A0Value, n)
+		for i := range items {
+			if items[i], err = generate(rng, of); err != nil {
+				return nil, err
+			}
+		}
+		return NewList(items), nil
+	}
+	return nil, fmt.Errorf("unknown generator '%s'", kind.Value)
+}
+
+// DefaultGenAlphabet is the character set of gen.string.
+const DefaultGenAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
@@ -0,0 +1,134 @@
+package evaluator
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// Hash returns a structural hash of v that is consistent with DeepEqual:
+// equal values always hash the same. Record hashes ignore key order, as
+// DeepEqual does. Hashes of store-backed records and lists are cached, so
+// repeated membership and dedup checks on the same values do not re-walk them.
+// The result is stable across runs and platforms.
+func Hash(v A0Value) uint64 {
+	switch val := v.(type) {
+	case nil, A0Null:
+		return hashBytes('n', nil)
+	case A0Bool:
+		if val.Value {
+			return hashBytes('b', []byte{1})
+		}
+		return hashBytes('b', []byte{0})
+	case A0Number:
+		n := val.Value
+		if n == 0 {
+			n = 0 // -0 == 0
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(n))
+		return hashBytes('f', buf[:])
+	case A0String:
+		return hashBytes('s', []byte(val.Value))
+	case A0List:
+		if h, ok := cachedHash(val); ok {
+			return h
+		}
+		h := hashBytes('l', nil)
+		for _, item := range val.Items {
+			h = mixHash(h, Hash(item))
+		}
+		storeHash(val, h)
+		return h
+	case A0Record:
+		if h, ok := cachedHash(val); ok {
+			return h
+		}
+		// Sum the per-pair hashes so the result is independent of key order.
+		var sum uint64
+		for _, kv := range val.Pairs() {
+			sum += mixHash(hashBytes('k', []byte(kv.Key)), Hash(kv.Value))
+		}
+		h := mixHash(hashBytes('r', nil), sum)
+		storeHash(val, h)
+		return h
+	}
+	return 0
+}
+
+// cachedHash returns a previously computed hash for a store-backed value.
+func cachedHash(v A0Value) (uint64, bool) {
+	switch val := v.(type) {
+	case A0List:
+		if val.store == nil {
+			return 0, false
+		}
+		val.store.mu.Lock()
+		defer val.store.mu.Unlock()
+		h, ok := val.store.hashes[len(val.Items)]
+		return h, ok
+	case A0Record:
+		if val.store == nil || val.edits != nil {
+			return 0, false
+		}
+		val.store.mu.RLock()
+		defer val.store.mu.RUnlock()
+		h, ok := val.store.hashes[len(val.pairs)]
+		return h, ok
+	}
+	return 0, false
+}
+
+// hashesDiffer reports whether a and b both have cached hashes that differ,
+// which proves them unequal without a traversal.
+func hashesDiffer(a, b A0Value) bool {
+	ha, ok := cachedHash(a)
+	if !ok {
+		return false
+	}
+	hb, ok := cachedHash(b)
+	return ok && ha != hb
+}
+
+func storeHash(v A0Value, h uint64) {
+	switch val := v.(type) {
+	case A0List:
+		if val.store == nil {
+			return
+		}
+		val.store.mu.Lock()
+		if val.store.hashes == nil {
+			val.store.hashes = make(map[int]uint64)
+		}
+		val.store.hashes[len(val.Items)] = h
+		val.store.mu.Unlock()
+	case A0Record:
+		if val.store == nil || val.edits != nil {
+			return
+		}
+		val.store.mu.Lock()
+		if val.store.hashes == nil {
+			val.store.hashes = make(map[int]uint64)
+		}
+		val.store.hashes[len(val.pairs)] = h
+		val.store.mu.Unlock()
+	}
+}
+
+func hashBytes(tag byte, b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{tag})
+	h.Write(b)
+	return h.Sum64()
+}
+
+// mixHash combines two hashes (splitmix64 finalizer over a ^ b-rotation).
+func mixHash(a, b uint64) uint64 {
+	x := a ^ (b<<29 | b>>35) ^ 0x9e3779b97f4a7c15
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
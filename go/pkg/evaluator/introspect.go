@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+	"sort"
+)
+
+// evalToolsList implements tools.list {}: the tools registered for this
+// run, sorted by name, as { name, mode, capability, allowed } records.
+// allowed reports whether the policy grants the tool's capability; the
+// program must still declare it in its cap header to call the tool.
+func (ev *evaluator) evalToolsList() A0Value {
+	names := make([]string, 0, len(ev.opts.Tools))
+	for name := range ev.opts.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]A0Value, len(names))
+	for i, name := range names {
+		tool := ev.opts.Tools[name]
+		allowed := ev.opts.AllowedCapabilities == nil || ev.opts.AllowedCapabilities[tool.CapabilityID]
+		items[i] = NewRecord([]KeyValue{
+			{Key: "name", Value: NewString(name)},
+			{Key: "mode", Value: NewString(tool.Mode)},
+			{Key: "capability", Value: NewString(tool.CapabilityID)},
+			{Key: "allowed", Value: NewBool(allowed)},
+		})
+	}
+	return NewList(items)
+}
+
+// evalStdlibList implements stdlib.list {}: the sorted names of the stdlib
+// functions available to this run.
+func (ev *evaluator) evalStdlibList() A0Value {
+	names := make([]string, 0, len(ev.opts.Stdlib))
+	for name := range ev.opts.Stdlib {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]A0Value, len(names))
+	for i, name := range names {
+		items[i] = NewString(name)
+	}
+	return NewList(items)
+}
@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limits of the locals snapshot a caught error carries.
+const (
+	// MaxLocals is how many bindings the snapshot keeps, innermost first.
+	MaxLocals = 32
+	// MaxLocalStringBytes is how much of a string binding the snapshot keeps.
+	MaxLocalStringBytes = 256
+)
+
+// secretNameParts mark binding names whose values the snapshot redacts.
+var secretNameParts = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "auth", "credential", "private"}
+
+// captureLocals records the bindings in scope where err was raised, for the
+// catch record of an enclosing try. Only the innermost block an error
+// leaves records them, so they describe the failure site.
+func (ev *evaluator) captureLocals(err error, env *Env) {
+	rtErr, ok := err.(*A0RuntimeError)
+	if !ok || rtErr.locals != nil {
+		return
+	}
+	locals := localsSnapshot(env, ev.globals)
+	rtErr.locals = &locals
+}
+
+// localsSnapshot is a shallow view of the bindings visible from env, up to
+// but not including stop. Inner bindings shadow outer ones. Scalars are
+// kept (strings cut to MaxLocalStringBytes), lists and records are
+// summarized as "list(N)" and "record(N)" by length, and bindings whose
+// name looks like a secret read "[redacted]".
+func localsSnapshot(env *Env, stop *Env) A0Record {
+	seen := make(map[string]bool)
+	var pairs []KeyValue
+	for s := env; s != nil && s != stop && len(pairs) < MaxLocals; s = s.parent {
+		for _, name := range s.names() {
+			if seen[name] || len(pairs) == MaxLocals {
+				continue
+			}
+			seen[name] = true
+			val, _ := s.lookup(name)
+			pairs = append(pairs, KeyValue{Key: name, Value: localValue(name, val)})
+		}
+	}
+	return NewRecord(pairs).(A0Record)
+}
+
+func localValue(name string, v A0Value) A0Value {
+	lower := strings.ToLower(name)
+	for _, part := range secretNameParts {
+		if strings.Contains(lower, part) {
+			return NewString("[redacted]")
+		}
+	}
+	switch val := v.(type) {
+	case A0String:
+		if len(val.Value) > MaxLocalStringBytes {
+			return NewString(truncateUTF8(val.Value, MaxLocalStringBytes) + "...")
+		}
+		return val
+	case A0List:
+		return NewString(fmt.Sprintf("list(%d)", len(val.Items)))
+	case A0Record:
+		return NewString(fmt.Sprintf("record(%d)", val.Len()))
+	case nil:
+		return NewNull()
+	}
+	return v
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// names returns the names bound in this scope only, sorted.
+func (e *Env) names() []string {
+	var out []string
+	if e.bindings != nil {
+		for name := range e.bindings {
+			out = append(out, name)
+		}
+	} else {
+		for i := 0; i < e.n; i++ {
+			out = append(out, e.inline[i].name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// TraceLog is emitted for every log.* call.
+const TraceLog TraceEventType = "log"
+
+// LogLevels are the log.* functions, in increasing severity.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// LogOptions configures where log.* entries are written besides the trace.
+type LogOptions struct {
+	// Writer receives one entry per line; nil discards entries.
+	Writer io.Writer
+	// Text writes "level msg key=value" lines instead of JSON.
+	Text bool
+}
+
+// evalLogCall implements log.<level> { msg, ...fields }. The entry goes to
+// the log writer and into the trace as a log event; the call returns null
+// so logging never changes a program's value.
+func (ev *evaluator) evalLogCall(level string, args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	msgVal, _ := args.Get("msg")
+	msg, ok := msgVal.(A0String)
+	if !ok {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("log.%s requires 'msg' to be a string", level),
+			Span:    &span,
+		}
+	}
+	var fields []KeyValue
+	for _, kv := range args.Pairs() {
+		if kv.Key != "msg" {
+			fields = append(fields, kv)
+		}
+	}
+
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	if ev.opts.Trace != nil {
+		data := NewRecord([]KeyValue{
+			{Key: "level", Value: NewString(level)},
+			{Key: "msg", Value: msg},
+			{Key: "fields", Value: NewRecord(fields)},
+		}).(A0Record)
+		ev.opts.Trace.Emit(TraceEvent{
+			Timestamp: ts,
+			RunID:     ev.opts.RunID,
+			Event:     TraceLog,
+			Span:      &span,
+			Data:      &data,
+		})
+	}
+
+	if w := ev.opts.Log.Writer; w != nil {
+		var line string
+		if ev.opts.Log.Text {
+			line = formatLogText(level, msg.Value, fields)
+		} else {
+			line = formatLogJSON(ts, ev.opts.RunID, level, msg.Value, fields)
+		}
+		io.WriteString(w, line+"\n")
+	}
+	return NewNull(), nil
+}
+
+func formatLogJSON(ts, runID, level, msg string, fields []KeyValue) string {
+	pairs := []KeyValue{
+		{Key: "ts", Value: NewString(ts)},
+		{Key: "level", Value: NewString(level)},
+		{Key: "msg", Value: NewString(msg)},
+	}
+	if runID != "" {
+		pairs = append(pairs, KeyValue{Key: "runId", Value: NewString(runID)})
+	}
+	pairs = append(pairs, fields...)
+	return ValueToJSONString(NewRecord(pairs))
+}
+
+func formatLogText(level, msg string, fields []KeyValue) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-5s %s", strings.ToUpper(level), msg)
+	for _, kv := range fields {
+		v := ValueToJSONString(kv.Value)
+		if str, ok := kv.Value.(A0String); ok && str.Value != "" && !strings.ContainsAny(str.Value, " \t\n\"=") {
+			v = str.Value
+		}
+		fmt.Fprintf(&b, " %s=%s", kv.Key, v)
+	}
+	return b.String()
+}
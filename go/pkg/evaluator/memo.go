@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// memoCache holds the results of @memo fns for one run. Parallel map
+// workers share it, so every access holds mu; fn bodies run unlocked.
+type memoCache struct {
+	mu      sync.Mutex
+	results map[*userFn]map[uint64][]memoEntry
+	// impure holds, per fn, why it cannot be memoized ("" if it can).
+	impure map[*userFn]string
+}
+
+type memoEntry struct {
+	args  A0Record
+	value A0Value
+}
+
+func newMemoCache() *memoCache {
+	return &memoCache{
+		results: make(map[*userFn]map[uint64][]memoEntry),
+		impure:  make(map[*userFn]string),
+	}
+}
+
+// runMemoFn runs a @memo fn, or returns its cached result for the same
+// arguments. The arguments are the fn's bound params, so map, reduce and
+// direct calls share entries. Failed calls are not cached. The fn must be
+// pure: a cached call skips its body, and with it any effect.
+//
+// Each declaration is cached separately, since a fn declared again (in a
+// loop body, say) may close over different bindings.
+func (ev *evaluator) runMemoFn(uf *userFn, env *Env) (A0Value, error) {
+	pairs := make([]KeyValue, len(uf.decl.Params))
+	for i, param := range uf.decl.Params {
+		val, _ := env.lookup(param)
+		pairs[i] = KeyValue{Key: param, Value: val}
+	}
+	args := NewRecord(pairs).(A0Record)
+	key := Hash(args)
+
+	c := ev.memo
+	c.mu.Lock()
+	reason, checked := c.impure[uf]
+	if !checked {
+		reason = ev.impurity(uf, map[*ast.FnDecl]bool{})
+		c.impure[uf] = reason
+	}
+	if reason == "" {
+		for _, e := range c.results[uf][key] {
+			if DeepEqual(e.args, args) {
+				c.mu.Unlock()
+				return e.value, nil
+			}
+		}
+	}
+	c.mu.Unlock()
+	if reason != "" {
+		span := uf.decl.Span
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("@memo fn '%s' must be pure, but it %s", uf.decl.Name, reason),
+			Span:    &span,
+		}
+	}
+
+	val, err := ev.execUserFn(uf, env)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.results[uf] == nil {
+		c.results[uf] = make(map[uint64][]memoEntry)
+	}
+	c.results[uf][key] = append(c.results[uf][key], memoEntry{args: args, value: val})
+	c.mu.Unlock()
+	return val, nil
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// Approximate in-memory sizes used for maxMemoryBytes accounting. They do
+// not match Go's allocator exactly; they only need to grow with the data.
+const (
+	scalarSize    = 8
+	stringHeader  = 16
+	containerSize = 24
+	slotSize      = 16
+)
+
+// ValueSize returns the approximate number of bytes held by v, including
+// everything it contains.
+func ValueSize(v A0Value) int64 {
+	switch val := v.(type) {
+	case A0String:
+		return stringHeader + int64(len(val.Value))
+	case A0List:
+		n := int64(containerSize)
+		for _, item := range val.Items {
+			n += slotSize + ValueSize(item)
+		}
+		return n
+	case A0Record:
+		n := int64(containerSize)
+		for _, kv := range val.Pairs() {
+			n += slotSize + int64(len(kv.Key)) + ValueSize(kv.Value)
+		}
+		return n
+	default:
+		return scalarSize
+	}
+}
+
+// shallowSize is the size of v not counting its elements, for containers
+// whose elements were already charged when they were built.
+func shallowSize(v A0Value) int64 {
+	switch val := v.(type) {
+	case A0List:
+		return containerSize + slotSize*int64(len(val.Items))
+	case A0Record:
+		n := int64(containerSize)
+		for _, kv := range val.Pairs() {
+			n += slotSize + int64(len(kv.Key))
+		}
+		return n
+	default:
+		return ValueSize(v)
+	}
+}
+
+// tracksMemory reports whether value construction needs to be charged.
+func (ev *evaluator) tracksMemory() bool {
+	return ev.budget.MaxMemoryBytes != nil ||
+		(ev.opts.SharedBudget != nil && ev.opts.SharedBudget.limits.MaxMemoryBytes != nil)
+}
+
+// chargeMemory adds the size of a newly constructed value to the run's
+// memory total. The total only grows: it approximates bytes allocated for
+// values over the run, not what is still live.
+func (ev *evaluator) chargeMemory(v A0Value, deep bool) error {
+	if v == nil || !ev.tracksMemory() {
+		return nil
+	}
+	n := shallowSize(v)
+	if deep {
+		n = ValueSize(v)
+	}
+	if err := ev.chargeShared("maxMemoryBytes", n); err != nil {
+		return err
+	}
+	ev.tracker.MemoryBytes += n
+	if ev.budget.MaxMemoryBytes != nil && ev.tracker.MemoryBytes > *ev.budget.MaxMemoryBytes {
+		return &A0RuntimeError{
+			Code:    diagnostics.EBudget,
+			Message: fmt.Sprintf("memory budget exceeded (max %d bytes)", *ev.budget.MaxMemoryBytes),
+		}
+	}
+	return nil
+}
+
+// allocated charges the result of a constructing expression.
+func (ev *evaluator) allocated(v A0Value, err error, deep bool) (A0Value, error) {
+	if err != nil {
+		return v, err
+	}
+	if mErr := ev.chargeMemory(v, deep); mErr != nil {
+		return nil, mErr
+	}
+	return v, nil
+}
@@ -0,0 +1,210 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// checkCapDecls rejects programs whose cap { ... } header asks for a
+// capability the policy does not allow, tracing each decision as cap_check.
+func (ev *evaluator) checkCapDecls(program *ast.Program) error {
+	for _, h := range program.Headers {
+		capDecl, ok := h.(*ast.CapDecl)
+		if !ok {
+			continue
+		}
+		for _, entry := range capDecl.Capabilities.Pairs {
+			pair, ok := entry.(*ast.RecordPair)
+			if !ok {
+				continue
+			}
+			boolVal, ok := pair.Value.(*ast.BoolLiteral)
+			if !ok {
+				continue
+			}
+			span := pair.Span
+			if !boolVal.Value {
+				ev.emitCapCheck(pair.Key, false, "header", "", &span)
+				continue
+			}
+			source := "policy"
+			if ev.opts.AllowedCapabilities == nil {
+				source = "unsafe-allow-all"
+			} else if !ev.opts.AllowedCapabilities[pair.Key] {
+				ev.emitCapCheck(pair.Key, false, source, "", &span)
+				return &A0RuntimeError{
+					Code:    diagnostics.ECapDenied,
+					Message: fmt.Sprintf("capability '%s' denied by policy", pair.Key),
+					Span:    &span,
+				}
+			}
+			if err := ev.useCapability(pair.Key, pair.Span); err != nil {
+				ev.emitCapCheck(pair.Key, false, "policy", err.Error(), &span)
+				return err
+			}
+			ev.emitCapCheck(pair.Key, true, source, "", &span)
+		}
+	}
+	return nil
+}
+
+// checkToolCaps rejects a call to tool unless the policy allows every
+// capability it exercises, its own and those in AlsoRequires. The cap
+// header is checked when the run starts, but only the validator ties a
+// tool to the header, so without this a program run unvalidated (or a
+// tool needing more than its header capability) could reach what the
+// policy denies.
+func (ev *evaluator) checkToolCaps(tool *ToolDef, span ast.Span) error {
+	if ev.opts.AllowedCapabilities == nil {
+		return nil
+	}
+	for _, capability := range append([]string{tool.CapabilityID}, tool.AlsoRequires...) {
+		if !ev.opts.AllowedCapabilities[capability] {
+			return &A0RuntimeError{
+				Code:    diagnostics.ECapDenied,
+				Message: fmt.Sprintf("tool '%s' requires capability '%s', which the policy denies", tool.Name, capability),
+				Span:    &span,
+			}
+		}
+	}
+	return nil
+}
+
+// emitCapCheck records one capability decision as a cap_check event. source
+// is what decided it: "header" for a capability the program declares false,
+// "policy" for the loaded policy (and its grants), or "unsafe-allow-all"
+// when no policy restricts the run.
+func (ev *evaluator) emitCapCheck(capability string, allowed bool, source, reason string, span *ast.Span) {
+	data := map[string]string{
+		"capability": capability,
+		"allowed":    strconv.FormatBool(allowed),
+		"source":     source,
+	}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	ev.emitWithData(TraceCapCheck, span, data)
+}
+
+// useCapability passes a declared capability to ExecOptions.UseCapability
+// the first time the run declares it. Plan runs do not use up grants.
+func (ev *evaluator) useCapability(capability string, span ast.Span) error {
+	if ev.opts.UseCapability == nil || ev.opts.Plan || ev.capsUsed[capability] {
+		return nil
+	}
+	if ev.capsUsed == nil {
+		ev.capsUsed = make(map[string]bool)
+	}
+	ev.capsUsed[capability] = true
+	if err := ev.opts.UseCapability(capability); err != nil {
+		return &A0RuntimeError{
+			Code:    diagnostics.ECapDenied,
+			Message: fmt.Sprintf("capability '%s' denied by policy: %s", capability, err),
+			Span:    &span,
+		}
+	}
+	return nil
+}
+
+// loadImports runs the top-level statements of every module imported by
+// program, registering each module's fns under "<prefix><alias>.".
+func (ev *evaluator) loadImports(program *ast.Program, prefix string) error {
+	for _, h := range program.Headers {
+		decl, ok := h.(*ast.ImportDecl)
+		if !ok {
+			continue
+		}
+		mod, ok := ev.opts.Modules[decl]
+		if !ok {
+			span := decl.Span
+			return &A0RuntimeError{
+				Code:    diagnostics.EImport,
+				Message: fmt.Sprintf("module '%s' was not resolved", decl.Path),
+				Span:    &span,
+			}
+		}
+		if err := ev.checkCapDecls(mod); err != nil {
+			return err
+		}
+
+		ns := prefix + decl.Alias
+		if decl.Budget != nil {
+			if ev.moduleBudgets == nil {
+				ev.moduleBudgets = make(map[string]*SharedBudget)
+			}
+			ev.moduleBudgets[ns] = &SharedBudget{limits: budgetFromRecord(decl.Budget), module: ns}
+		}
+		if err := ev.loadImports(mod, ns+"."); err != nil {
+			return err
+		}
+		saved := ev.module
+		ev.module = ns
+		_, err := ev.executeBlock(mod.Statements, NewEnv(ev.globals))
+		ev.module = saved
+		if err != nil {
+			return err
+		}
+
+		for name, exported := range ast.ExportedFns(mod) {
+			if uf, ok := ev.userFns[ns+"."+name]; ok {
+				uf.exported = exported
+			}
+		}
+	}
+	return nil
+}
+
+// parentNamespace returns the namespace that imported ns ("" for the program).
+func parentNamespace(ns string) string {
+	if i := strings.LastIndex(ns, "."); i >= 0 {
+		return ns[:i]
+	}
+	return ""
+}
+
+// qualify maps a fn name to its key in userFns for the current module.
+func (ev *evaluator) qualify(name string) string {
+	if ev.module == "" {
+		return name
+	}
+	return ev.module + "." + name
+}
+
+// lookupFn resolves a user fn from the current module's namespace. It
+// returns nil when no such fn exists, and an error when the fn belongs to
+// another module that does not export it.
+func (ev *evaluator) lookupFn(name string, span *ast.Span) (*userFn, error) {
+	uf, ok := ev.userFns[ev.qualify(name)]
+	if !ok {
+		return nil, nil
+	}
+	if uf.module != ev.module && !uf.exported {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EImportPrivate,
+			Message: fmt.Sprintf("function '%s' is not exported by its module", name),
+			Span:    span,
+		}
+	}
+	return uf, nil
+}
+
+// runUserFn executes uf's body in env inside uf's module namespace, so the
+// body sees its own module's fns and imports. A @memo fn goes through the
+// run's memo cache.
+func (ev *evaluator) runUserFn(uf *userFn, env *Env) (A0Value, error) {
+	if uf.decl.Memo {
+		return ev.runMemoFn(uf, env)
+	}
+	return ev.execUserFn(uf, env)
+}
+
+func (ev *evaluator) execUserFn(uf *userFn, env *Env) (A0Value, error) {
+	saved := ev.module
+	ev.module = uf.module
+	defer func() { ev.module = saved }()
+	return ev.executeBlock(uf.decl.Body, env)
+}
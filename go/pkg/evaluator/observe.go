@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// builtinEvidenceKinds are the kinds a0 records itself; programs cannot
+// claim them with evidence { ... } so summaries keep their meaning.
+var builtinEvidenceKinds = map[string]bool{
+	"assert": true, "check": true, "snapshot": true, "schema": true, "forall": true,
+}
+
+// evalEvidenceCall implements evidence { kind, msg?, details? }: a passing
+// entry of a program-chosen kind that records an observation (a latency, a
+// count) without asserting anything. It returns the entry like check does.
+func (ev *evaluator) evalEvidenceCall(args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	kindVal, _ := args.Get("kind")
+	kind, ok := kindVal.(A0String)
+	if !ok || kind.Value == "" {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: "evidence requires 'kind' to be a non-empty string",
+			Span:    &span,
+		}
+	}
+	if builtinEvidenceKinds[kind.Value] {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("evidence kind '%s' is reserved for a0's own entries", kind.Value),
+			Span:    &span,
+		}
+	}
+	msg := ""
+	if msgVal, found := args.Get("msg"); found {
+		s, ok := msgVal.(A0String)
+		if !ok {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: "evidence requires 'msg' to be a string",
+				Span:    &span,
+			}
+		}
+		msg = s.Value
+	}
+	entry := Evidence{Kind: kind.Value, OK: true, Msg: msg, Span: &span}
+	if detailsVal, found := args.Get("details"); found {
+		details, ok := detailsVal.(A0Record)
+		if !ok {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: "evidence requires 'details' to be a record",
+				Span:    &span,
+			}
+		}
+		entry.Details = &details
+	}
+	ev.recordEvidence(entry)
+
+	return NewRecord([]KeyValue{
+		{Key: "kind", Value: kind},
+		{Key: "ok", Value: NewBool(true)},
+		{Key: "msg", Value: NewString(msg)},
+	}), nil
+}
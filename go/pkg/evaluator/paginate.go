@@ -0,0 +1,155 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// DefaultPaginateMaxPages is the number of pages paginate fetches when
+// maxPages is omitted.
+const DefaultPaginateMaxPages = 100
+
+// evalPaginateCall implements paginate { fn, start?, nextPath?, itemsPath?,
+// maxPages? }: fn is called with a cursor (start, then each page's next
+// value) until a page has no next cursor or maxPages pages were fetched.
+// The items of every page are collected in order.
+//
+// Each page counts as an iteration against maxIterations, and the tool
+// calls fn makes count against the other budgets as usual.
+func (ev *evaluator) evalPaginateCall(args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	fnName := ""
+	if fnVal, ok := args.Get("fn"); ok {
+		if s, ok := fnVal.(A0String); ok {
+			fnName = s.Value
+		}
+	}
+	nextPath, err := paginatePathArg(args, "nextPath", "next", &span)
+	if err != nil {
+		return nil, err
+	}
+	itemsPath, err := paginatePathArg(args, "itemsPath", "items", &span)
+	if err != nil {
+		return nil, err
+	}
+	maxPages := DefaultPaginateMaxPages
+	if v, ok := args.Get("maxPages"); ok {
+		n, ok := v.(A0Number)
+		if !ok || n.Value < 1 || n.Value != float64(int(n.Value)) {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: "paginate requires 'maxPages' to be a positive integer",
+				Span:    &span,
+			}
+		}
+		maxPages = int(n.Value)
+	}
+	var cursor A0Value = NewNull()
+	if v, ok := args.Get("start"); ok {
+		cursor = v
+	}
+
+	uf, err := ev.lookupFn(fnName, &span)
+	if err != nil {
+		return nil, err
+	}
+	if uf == nil {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EUnknownFn,
+			Message: fmt.Sprintf("unknown function '%s'", fnName),
+			Span:    &span,
+		}
+	}
+
+	items := []A0Value{}
+	pages := 0
+	for {
+		if err := ev.countIteration(); err != nil {
+			return nil, err
+		}
+		page, err := ev.runUserFn(uf, ev.bindFnParams(uf, cursor))
+		if err != nil {
+			return nil, err
+		}
+		pages++
+
+		switch got := lookupDotted(page, itemsPath).(type) {
+		case A0Null:
+		case A0List:
+			items = append(items, got.Items...)
+		default:
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EType,
+				Message: fmt.Sprintf("paginate: page %d has %s at '%s', expected a list", pages, typeNameOf(got), strings.Join(itemsPath, ".")),
+				Span:    &span,
+			}
+		}
+
+		next := lookupDotted(page, nextPath)
+		if !Truthiness(next) {
+			cursor = NewNull()
+			break
+		}
+		if DeepEqual(next, cursor) {
+			return nil, &A0RuntimeError{
+				Code:    diagnostics.EFn,
+				Message: fmt.Sprintf("paginate: page %d returned the cursor it was called with (%s), which would repeat forever", pages, ValueToJSONString(next)),
+				Span:    &span,
+			}
+		}
+		cursor = next
+		if pages == maxPages {
+			break
+		}
+	}
+
+	return NewRecord([]KeyValue{
+		{Key: "items", Value: NewList(items)},
+		{Key: "pages", Value: NewNumber(float64(pages))},
+		{Key: "next", Value: cursor},
+	}), nil
+}
+
+func paginatePathArg(args *A0Record, key, def string, span *ast.Span) ([]string, error) {
+	v, ok := args.Get(key)
+	if !ok {
+		return []string{def}, nil
+	}
+	s, ok := v.(A0String)
+	if !ok || s.Value == "" {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("paginate requires '%s' to be a dotted path such as \"body.%s\"", key, def),
+			Span:    span,
+		}
+	}
+	return strings.Split(s.Value, "."), nil
+}
+
+// lookupDotted reads a dotted path through records, and lists by numeric
+// segment. A missing step yields null.
+func lookupDotted(v A0Value, path []string) A0Value {
+	for _, part := range path {
+		switch c := v.(type) {
+		case A0Record:
+			next, ok := c.Get(part)
+			if !ok {
+				return NewNull()
+			}
+			v = next
+		case A0List:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c.Items) {
+				return NewNull()
+			}
+			v = c.Items[i]
+		default:
+			return NewNull()
+		}
+	}
+	return v
+}
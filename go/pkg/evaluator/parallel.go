@@ -0,0 +1,212 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// parallelArg reads the optional parallel: n worker count of a map call.
+// It returns 0 when the argument is absent.
+func parallelArg(args *A0Record, span *ast.Span) (int, error) {
+	v, ok := args.Get("parallel")
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(A0Number)
+	if !ok || n.Value < 1 || n.Value != math.Trunc(n.Value) {
+		return 0, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: "map: 'parallel' must be a positive integer",
+			Span:    span,
+		}
+	}
+	return int(n.Value), nil
+}
+
+// impurity explains why uf cannot safely run concurrently, or returns "" if
+// it can. A fn is pure when neither its body nor any fn it reaches calls a
+// tool, writes snapshots, logs, or declares fns. The check is static, so fns
+// passed to map/reduce/filter/forall must be named by string literals.
+func (ev *evaluator) impurity(uf *userFn, visiting map[*ast.FnDecl]bool) string {
+	top := len(visiting) == 0
+	if top {
+		if reason, ok := ev.purity[uf.decl]; ok {
+			return reason
+		}
+	}
+	if visiting[uf.decl] {
+		return "" // recursion: the fn's own body decides
+	}
+	visiting[uf.decl] = true
+
+	var reason string
+	resolve := func(name string) *userFn {
+		if uf.module != "" {
+			name = uf.module + "." + name
+		}
+		return ev.userFns[name]
+	}
+	for _, stmt := range uf.decl.Body {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if reason != "" {
+				return false
+			}
+			switch node := n.(type) {
+			case *ast.CallExpr:
+				reason = fmt.Sprintf("calls tool '%s'", strings.Join(node.Tool.Parts, "."))
+			case *ast.DoExpr:
+				reason = fmt.Sprintf("calls tool '%s'", strings.Join(node.Tool.Parts, "."))
+			case *ast.FnDecl:
+				reason = fmt.Sprintf("declares fn '%s'", node.Name)
+			case *ast.FnCallExpr:
+				name := strings.Join(node.Name.Parts, ".")
+				if callee := resolve(name); callee != nil {
+					if r := ev.impurity(callee, visiting); r != "" {
+						reason = fmt.Sprintf("calls '%s', which %s", name, r)
+					}
+					return reason == ""
+				}
+				switch {
+				case name == "expect.snapshot" || name == "call.batch" || strings.HasPrefix(name, "log."):
+					reason = fmt.Sprintf("calls '%s'", name)
+				case name == "map" || name == "reduce" || name == "filter" || name == "forall" || name == "paginate":
+					reason = ev.fnArgImpurity(node, resolve, visiting)
+				}
+			}
+			return reason == ""
+		})
+		if reason != "" {
+			break
+		}
+	}
+
+	if top {
+		if ev.purity == nil {
+			ev.purity = make(map[*ast.FnDecl]string)
+		}
+		ev.purity[uf.decl] = reason
+	}
+	return reason
+}
+
+// fnArgImpurity checks the fn: argument of a higher-order stdlib call.
+func (ev *evaluator) fnArgImpurity(call *ast.FnCallExpr, resolve func(string) *userFn, visiting map[*ast.FnDecl]bool) string {
+	for _, entry := range call.Args.Pairs {
+		pair, ok := entry.(*ast.RecordPair)
+		if !ok || pair.Key != "fn" {
+			continue
+		}
+		lit, ok := pair.Value.(*ast.StrLiteral)
+		if !ok {
+			return "passes a fn that is not a string literal"
+		}
+		callee := resolve(lit.Value)
+		if callee == nil {
+			return ""
+		}
+		if r := ev.impurity(callee, visiting); r != "" {
+			return fmt.Sprintf("calls '%s', which %s", lit.Value, r)
+		}
+	}
+	return ""
+}
+
+// parallelMap applies uf to items on up to workers goroutines. Each item runs
+// in a forked evaluator whose evidence, warnings and trace events are merged
+// back in item order, so the observable result matches a sequential map. On
+// failure the error of the lowest failing item wins and later items are
+// discarded, as if the map had stopped there.
+func (ev *evaluator) parallelMap(uf *userFn, items []A0Value, workers int) ([]A0Value, error) {
+	type outcome struct {
+		value  A0Value
+		err    error
+		worker *evaluator
+		events []TraceEvent
+	}
+	outcomes := make([]outcome, len(items))
+	counter := &atomic.Int64{}
+	counter.Store(ev.tracker.Iterations)
+	steps := &atomic.Int64{}
+	steps.Store(ev.tracker.Steps)
+
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for n := min(workers, len(items)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				// Items are claimed in index order, so once item i fails every
+				// item before it has already been claimed and will finish.
+				i := int(next.Add(1) - 1)
+				if i >= len(items) || failed.Load() {
+					return
+				}
+				o := &outcomes[i]
+				o.worker = ev.fork(counter, steps, &o.events)
+				if o.err = o.worker.countIteration(); o.err == nil {
+					o.value, o.err = o.worker.runUserFn(uf, o.worker.bindFnParams(uf, items[i]))
+				}
+				if o.err != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	ev.tracker.Iterations = counter.Load()
+	ev.tracker.Steps = steps.Load()
+	memBase := ev.tracker.MemoryBytes
+	results := make([]A0Value, 0, len(items))
+	for i := range outcomes {
+		o := &outcomes[i]
+		if o.worker == nil {
+			break
+		}
+		ev.join(o.worker, o.events, memBase)
+		if o.err != nil {
+			return nil, o.err
+		}
+		results = append(results, o.value)
+	}
+	return results, nil
+}
+
+// fork returns a copy of ev for one parallel map item. Iterations and steps
+// go to the shared counters and trace events are buffered into events.
+func (ev *evaluator) fork(iterations, steps *atomic.Int64, events *[]TraceEvent) *evaluator {
+	w := *ev
+	w.evidence = nil
+	w.warnings = nil
+	w.warned = nil
+	w.plan = nil
+	w.iterations = iterations
+	w.steps = steps
+	w.parallel = true
+	if ev.opts.Trace != nil {
+		w.opts.Trace = TraceFunc(func(e TraceEvent) { *events = append(*events, e) })
+	}
+	return &w
+}
+
+// join merges a finished worker's side effects back into ev. memBase is the
+// memory total the worker was forked with.
+func (ev *evaluator) join(w *evaluator, events []TraceEvent, memBase int64) {
+	for _, e := range events {
+		ev.opts.Trace.Emit(e)
+	}
+	ev.evidence = append(ev.evidence, w.evidence...)
+	ev.plan = append(ev.plan, w.plan...)
+	for _, d := range w.warnings {
+		ev.warn(d.Code, d.Message, d.Span, d.Hint)
+	}
+	ev.tracker.MemoryBytes += w.tracker.MemoryBytes - memBase
+}
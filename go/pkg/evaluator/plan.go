@@ -0,0 +1,23 @@
+package evaluator
+
+import (
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+)
+
+// PlanStep is one effect a program would perform: a do call recorded by
+// ExecOptions.Plan instead of being executed.
+type PlanStep struct {
+	Tool string
+	Args A0Record
+	Span ast.Span
+}
+
+// planDo records a do call in plan mode and returns the stand-in result
+// { planned: true, tool } in place of the tool's.
+func (ev *evaluator) planDo(tool string, args A0Record, span ast.Span) A0Value {
+	ev.plan = append(ev.plan, PlanStep{Tool: tool, Args: args, Span: span})
+	return NewRecord([]KeyValue{
+		{Key: "planned", Value: NewBool(true)},
+		{Key: "tool", Value: NewString(tool)},
+	})
+}
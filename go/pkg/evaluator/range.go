@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// maxRangeLen bounds the number of items range { ... } may produce.
+const maxRangeLen = 1000000
+
+// rangeTolerance is how close, in steps, the end of a range must come to
+// to for to to count as reached, absorbing float error in (to - from) / step.
+const rangeTolerance = 1e-9
+
+// NumberRange is the sequence range { from, to, step?, inclusive? } yields:
+// Len numbers from From in increments of Step.
+type NumberRange struct {
+	From, Step float64
+	Len        int
+}
+
+// ParseRange reads the arguments of range. step defaults to 1 and may be
+// negative for a descending range; a step pointing away from to yields an
+// empty range. to is excluded unless inclusive is true.
+func ParseRange(args *A0Record) (NumberRange, error) {
+	num := func(key string, def float64) (float64, error) {
+		v, found := args.Get(key)
+		if !found {
+			return def, nil
+		}
+		n, ok := v.(A0Number)
+		if !ok || math.IsNaN(n.Value) || math.IsInf(n.Value, 0) {
+			return 0, fmt.Errorf("'%s' must be a finite number", key)
+		}
+		return n.Value, nil
+	}
+	from, err := num("from", 0)
+	if err != nil {
+		return NumberRange{}, err
+	}
+	to, err := num("to", 0)
+	if err != nil {
+		return NumberRange{}, err
+	}
+	step, err := num("step", 1)
+	if err != nil {
+		return NumberRange{}, err
+	}
+	if step == 0 {
+		return NumberRange{}, fmt.Errorf("'step' must not be 0")
+	}
+	inclusive := false
+	if v, found := args.Get("inclusive"); found {
+		b, ok := v.(A0Bool)
+		if !ok {
+			return NumberRange{}, fmt.Errorf("'inclusive' must be a boolean")
+		}
+		inclusive = b.Value
+	}
+
+	steps := (to - from) / step
+	var n float64
+	switch {
+	case steps < -rangeTolerance:
+		n = 0
+	case inclusive:
+		n = math.Floor(steps+rangeTolerance) + 1
+	default:
+		n = math.Max(math.Ceil(steps-rangeTolerance), 0)
+	}
+	if n > maxRangeLen {
+		return NumberRange{}, fmt.Errorf("range too large: %.0f items", n)
+	}
+	return NumberRange{From: from, Step: step, Len: int(n)}, nil
+}
+
+// At returns the i-th number of the range. It is computed as from + i*step
+// rather than by repeated addition, and rounded to 15 significant digits,
+// so float steps give the numbers as written: 0.1, 0.2, 0.3 rather than
+// 0.30000000000000004.
+func (r NumberRange) At(i int) float64 {
+	x := r.From + float64(i)*r.Step
+	if r.Step == math.Trunc(r.Step) && r.From == math.Trunc(r.From) {
+		return x
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(x, 'g', 15, 64), 64)
+	if err != nil {
+		return x
+	}
+	return rounded
+}
+
+// Items materializes the range as a list.
+func (r NumberRange) Items() []A0Value {
+	items := make([]A0Value, r.Len)
+	for i := range items {
+		items[i] = NewNumber(r.At(i))
+	}
+	return items
+}
+
+// forRange returns the range a for loop iterates when its in: is a direct
+// call to the range stdlib function, so the loop can walk the numbers
+// without building the list. ok is false for any other in: expression.
+func (ev *evaluator) forRange(expr ast.Expr, env *Env) (r NumberRange, ok bool, err error) {
+	call, isCall := expr.(*ast.FnCallExpr)
+	if !isCall || strings.Join(call.Name.Parts, ".") != "range" || ev.opts.Stdlib["range"] == nil {
+		return NumberRange{}, false, nil
+	}
+	if uf, err := ev.lookupFn("range", &call.Span); uf != nil || err != nil {
+		return NumberRange{}, false, nil
+	}
+	argsVal, err := ev.evalExpr(call.Args, env)
+	if err != nil {
+		return NumberRange{}, true, err
+	}
+	args, isRec := argsVal.(A0Record)
+	span := call.Span
+	if !isRec {
+		return NumberRange{}, true, &A0RuntimeError{
+			Code:    diagnostics.EType,
+			Message: "function arguments must be a record",
+			Span:    &span,
+		}
+	}
+	r, err = ParseRange(&args)
+	if err != nil {
+		return NumberRange{}, true, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("stdlib 'range' error: %s", err.Error()),
+			Span:    &span,
+		}
+	}
+	return r, true, nil
+}
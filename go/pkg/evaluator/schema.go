@@ -0,0 +1,289 @@
+package evaluator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+)
+
+// Schema versions of the files a0 writes. Readers accept any version up to
+// the one they were built for and refuse newer ones, so the formats can grow
+// without old tools misreading them.
+const (
+	// EvidenceSchemaVersion is the version of --evidence files. Version 1 is
+	// a JSON array of entries as written by EvidenceToJSON, optionally
+	// wrapped as { "schemaVersion": 1, ...RunMeta, "evidence": [...] } as
+	// written by EvidenceFileToJSON.
+	EvidenceSchemaVersion = 1
+
+	// TraceSchemaVersion is the version of --trace NDJSON files, recorded as
+	// data.schemaVersion on each run_start event. Traces without it predate
+	// versioning and are read as version 1.
+	TraceSchemaVersion = 1
+)
+
+// SchemaError reports a file whose schema version this build cannot read.
+type SchemaError struct {
+	File      string // "evidence" or "trace"
+	Version   int
+	Supported int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s schema version %d is newer than supported version %d; upgrade a0", e.File, e.Version, e.Supported)
+}
+
+// ValidateEvidence checks that data is an evidence file this build can read
+// and returns its entries. An unknown schema version yields a *SchemaError.
+func ValidateEvidence(data []byte) ([]Evidence, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var envelope struct {
+			SchemaVersion *int            `json:"schemaVersion"`
+			Evidence      json.RawMessage `json:"evidence"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, fmt.Errorf("invalid evidence file: %v", err)
+		}
+		if envelope.SchemaVersion == nil {
+			return nil, fmt.Errorf("invalid evidence file: missing schemaVersion")
+		}
+		if v := *envelope.SchemaVersion; v < 1 {
+			return nil, fmt.Errorf("invalid evidence file: schemaVersion %d", v)
+		} else if v > EvidenceSchemaVersion {
+			return nil, &SchemaError{File: "evidence", Version: v, Supported: EvidenceSchemaVersion}
+		}
+		data = envelope.Evidence
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("invalid evidence file: expected a JSON array of entries")
+	}
+	evidence := make([]Evidence, len(items))
+	for i, item := range items {
+		var fields map[string]json.RawMessage
+		var e evidenceJSON
+		if json.Unmarshal(item, &fields) != nil || json.Unmarshal(item, &e) != nil {
+			return nil, fmt.Errorf("evidence[%d]: expected an object with kind, ok and msg", i)
+		}
+		for _, field := range []string{"kind", "ok", "msg"} {
+			if _, ok := fields[field]; !ok {
+				return nil, fmt.Errorf("evidence[%d]: missing %s", i, field)
+			}
+		}
+		evidence[i] = Evidence{Kind: e.Kind, OK: e.OK, Msg: e.Msg, RunID: e.RunID}
+		if len(e.Details) > 0 {
+			if v, err := ParseJSONToValue(e.Details); err == nil {
+				if details, ok := v.(A0Record); ok {
+					evidence[i].Details = &details
+				}
+			}
+		}
+		if e.Span != nil {
+			evidence[i].Span = &ast.Span{
+				File:      e.Span.File,
+				StartLine: e.Span.StartLine,
+				StartCol:  e.Span.StartCol,
+				EndLine:   e.Span.EndLine,
+				EndCol:    e.Span.EndCol,
+			}
+		}
+	}
+	return evidence, nil
+}
+
+// EvidenceRun is one run recorded in an evidence file.
+type EvidenceRun struct {
+	Meta     *RunMeta // nil for files without run metadata
+	Evidence []Evidence
+}
+
+// ValidateEvidenceRuns reads an evidence file holding one or more runs:
+// a single array or envelope, or NDJSON with one envelope per line as
+// written by a0 run --evidence-append.
+func ValidateEvidenceRuns(data []byte) ([]EvidenceRun, error) {
+	data = bytes.TrimSpace(data)
+	if json.Valid(data) {
+		evidence, err := ValidateEvidence(data)
+		if err != nil {
+			return nil, err
+		}
+		return []EvidenceRun{{Meta: EvidenceRunMeta(data), Evidence: evidence}}, nil
+	}
+	var runs []EvidenceRun
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		evidence, err := ValidateEvidence(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		runs = append(runs, EvidenceRun{Meta: EvidenceRunMeta(line), Evidence: evidence})
+	}
+	return runs, nil
+}
+
+// EvidenceRunMeta returns the run metadata of an evidence file written by
+// EvidenceFileToJSON, or nil for a bare array or an envelope without it.
+func EvidenceRunMeta(data []byte) *RunMeta {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil
+	}
+	var meta RunMeta
+	if json.Unmarshal(data, &meta) != nil || meta == (RunMeta{}) {
+		return nil
+	}
+	return &meta
+}
+
+// ValidateTrace checks that r holds NDJSON trace events this build can read:
+// every line an object with ts, runId and event, and no run_start newer than
+// TraceSchemaVersion. It returns the highest schema version seen. An unknown
+// version yields a *SchemaError.
+func ValidateTrace(r io.Reader) (int, error) {
+	version := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var event struct {
+			TS    string         `json:"ts"`
+			RunID string         `json:"runId"`
+			Event string         `json:"event"`
+			Data  map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(text, &event); err != nil {
+			return version, fmt.Errorf("line %d: invalid JSON", line)
+		}
+		if event.TS == "" || event.RunID == "" || event.Event == "" {
+			return version, fmt.Errorf("line %d: missing ts, runId, or event", line)
+		}
+		if event.Event != string(TraceRunStart) {
+			continue
+		}
+		v := 1
+		switch raw := event.Data["schemaVersion"].(type) {
+		case string:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return version, fmt.Errorf("line %d: invalid schemaVersion %q", line, raw)
+			}
+			v = n
+		case float64:
+			v = int(raw)
+		}
+		if v > TraceSchemaVersion {
+			return version, &SchemaError{File: "trace", Version: v, Supported: TraceSchemaVersion}
+		}
+		if v > version {
+			version = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return version, err
+	}
+	if line == 0 {
+		return version, fmt.Errorf("no trace events found")
+	}
+	if version == 0 {
+		version = 1
+	}
+	return version, nil
+}
+
+// knownTraceEvents holds every event name a0 writes to traces.
+var knownTraceEvents = map[TraceEventType]bool{
+	TraceRunStart: true, TraceRunEnd: true,
+	TraceStmtStart: true, TraceStmtEnd: true,
+	TraceToolStart: true, TraceToolEnd: true,
+	TraceEvidence: true, TraceBudgetExceeded: true,
+	TraceForStart: true, TraceForEnd: true,
+	TraceFnCallStart: true, TraceFnCallEnd: true,
+	TraceMatchStart: true, TraceMatchEnd: true,
+	TraceMapStart: true, TraceMapEnd: true,
+	TraceReduceStart: true, TraceReduceEnd: true,
+	TraceTryStart: true, TraceTryEnd: true,
+	TraceFilterStart: true, TraceFilterEnd: true,
+	TraceFindStart: true, TraceFindEnd: true,
+	TraceLoopStart: true, TraceLoopEnd: true,
+	TraceSleep: true, TraceCapCheck: true,
+	TraceTxStart: true, TraceTxEnd: true,
+	TraceBatchStart: true, TraceBatchEnd: true,
+}
+
+// TraceProblem is one finding of LintTrace. Line is 1-based, or 0 for a
+// problem with the file as a whole.
+type TraceProblem struct {
+	Line    int
+	Message string
+}
+
+// LintTrace checks r strictly as the trace of a single run, for producers
+// other than a0 that write the format: every line must be a JSON object
+// with string ts (RFC 3339), runId and event fields, every event must be
+// one a0 knows, and all events must share one run ID. Unlike
+// ValidateTrace it reports every problem instead of stopping at the first.
+func LintTrace(r io.Reader) ([]TraceProblem, error) {
+	var problems []TraceProblem
+	report := func(line int, format string, args ...any) {
+		problems = append(problems, TraceProblem{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+	runID := ""
+	events := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		events++
+		var event map[string]any
+		if err := json.Unmarshal(text, &event); err != nil {
+			report(line, "invalid JSON")
+			continue
+		}
+		for _, field := range []string{"ts", "runId", "event"} {
+			if v, ok := event[field].(string); !ok || v == "" {
+				report(line, "missing or non-string field '%s'", field)
+			}
+		}
+		if ts, ok := event["ts"].(string); ok && ts != "" {
+			if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+				report(line, "ts %q is not an RFC 3339 timestamp", ts)
+			}
+		}
+		if name, ok := event["event"].(string); ok && name != "" && !knownTraceEvents[TraceEventType(name)] {
+			report(line, "unknown event '%s'", name)
+		}
+		if id, ok := event["runId"].(string); ok && id != "" {
+			if runID == "" {
+				runID = id
+			} else if id != runID {
+				report(line, "run ID '%s' differs from '%s' on earlier lines", id, runID)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return problems, err
+	}
+	if events == 0 {
+		report(0, "no trace events found")
+	}
+	return problems, nil
+}
@@ -0,0 +1,178 @@
+package evaluator
+
+import "sync"
+
+// Records and lists are immutable once they are visible to A0 code, so values
+// derived from one another can share a backing array. Each shared array lives
+// in a store that only ever grows: a value sees a prefix of the store, and
+// extending the newest value (the one whose length equals the store's) appends
+// in place. Extending an older value forks a fresh store. This makes
+// accumulation loops such as
+//
+//	for { in: xs, as: "x" } { out = append { in: out, value: x } }
+//
+// and record spreads that add new fields amortized O(1) per step instead of
+// copying the whole value each iteration.
+//
+// Overriding an existing record key, as { ...big, k: v } does when big
+// already has k, doesn't touch the shared pairs either. The new record keeps
+// big's view of the store and layers a small position-to-value map of edits
+// on top, which Get consults first and Pairs folds in on first use. Once a
+// record carries maxPairEdits edits, the next new one copies the pairs into a
+// fresh store, so lookups stay O(1) and edit maps stay small.
+
+// maxPairEdits bounds the number of overridden keys a record layers over its
+// shared pairs before With copies them into a fresh store.
+const maxPairEdits = 32
+
+// pairStore is the shared backing store for records.
+type pairStore struct {
+	mu     sync.RWMutex
+	pairs  []KeyValue
+	index  map[string]int
+	hashes map[int]uint64 // structural hash per view length, see hash.go
+}
+
+// pairEdits holds the values a record overrides on top of its shared pairs,
+// keyed by position. vals is never modified after creation, so records that
+// extend an edited record share it.
+type pairEdits struct {
+	vals map[int]A0Value
+	once sync.Once
+	flat []KeyValue
+}
+
+// itemStore is the shared backing store for lists.
+type itemStore struct {
+	mu     sync.Mutex
+	items  []A0Value
+	hashes map[int]uint64
+}
+
+func newPairStore(pairs []KeyValue) *pairStore {
+	idx := make(map[string]int, len(pairs))
+	for i, kv := range pairs {
+		idx[kv.Key] = i
+	}
+	return &pairStore{pairs: pairs, index: idx}
+}
+
+// lookup returns the position of key within the first n pairs of the store.
+func (s *pairStore) lookup(key string, n int) (int, bool) {
+	s.mu.RLock()
+	i, ok := s.index[key]
+	s.mu.RUnlock()
+	if !ok || i >= n {
+		return 0, false
+	}
+	return i, true
+}
+
+// get returns the overriding value at position i, if there is one.
+func (e *pairEdits) get(i int) (A0Value, bool) {
+	if e == nil {
+		return nil, false
+	}
+	v, ok := e.vals[i]
+	return v, ok
+}
+
+// flatten returns pairs with the edits applied, computing it once.
+func (e *pairEdits) flatten(pairs []KeyValue) []KeyValue {
+	e.once.Do(func() {
+		flat := make([]KeyValue, len(pairs))
+		copy(flat, pairs)
+		for i, v := range e.vals {
+			flat[i].Value = v
+		}
+		e.flat = flat
+	})
+	return e.flat
+}
+
+// extend returns the edits for a record that appends to the one e belongs to.
+func (e *pairEdits) extend() *pairEdits {
+	if e == nil {
+		return nil
+	}
+	return &pairEdits{vals: e.vals}
+}
+
+// shared returns r backed by a store, adopting its pairs if it has none yet.
+func (r A0Record) shared() A0Record {
+	if r.store != nil {
+		return r
+	}
+	n := len(r.pairs)
+	return A0Record{pairs: r.pairs[:n:n], store: newPairStore(r.pairs[:n:n])}
+}
+
+// With returns a record with key set to val, leaving r unchanged. Existing
+// keys keep their position; new keys are appended.
+func (r A0Record) With(key string, val A0Value) A0Record {
+	r = r.shared()
+	n := len(r.pairs)
+	if i, ok := r.store.lookup(key, n); ok {
+		var old map[int]A0Value
+		if r.edits != nil {
+			old = r.edits.vals
+		}
+		if _, ok := old[i]; !ok && len(old) >= maxPairEdits {
+			pairs := make([]KeyValue, n)
+			copy(pairs, r.Pairs())
+			pairs[i].Value = val
+			return A0Record{pairs: pairs, store: newPairStore(pairs)}
+		}
+		vals := make(map[int]A0Value, len(old)+1)
+		for j, v := range old {
+			vals[j] = v
+		}
+		vals[i] = val
+		return A0Record{pairs: r.pairs, store: r.store, edits: &pairEdits{vals: vals}}
+	}
+
+	s := r.store
+	s.mu.Lock()
+	if len(s.pairs) == n {
+		s.pairs = append(s.pairs, KeyValue{Key: key, Value: val})
+		s.index[key] = n
+		pairs := s.pairs[: n+1 : n+1]
+		s.mu.Unlock()
+		return A0Record{pairs: pairs, store: s, edits: r.edits.extend()}
+	}
+	s.mu.Unlock()
+
+	pairs := make([]KeyValue, n+1, 2*n+1)
+	copy(pairs, r.Pairs())
+	pairs[n] = KeyValue{Key: key, Value: val}
+	return A0Record{pairs: pairs[: n+1 : n+1], store: newPairStore(pairs[:n+1])}
+}
+
+// Append returns a list with v added at the end, leaving l unchanged.
+func (l A0List) Append(v A0Value) A0List {
+	n := len(l.Items)
+	if l.store == nil {
+		l.store = &itemStore{items: l.Items[:n:n]}
+	}
+
+	s := l.store
+	s.mu.Lock()
+	if len(s.items) == n {
+		s.items = append(s.items, v)
+		items := s.items[: n+1 : n+1]
+		s.mu.Unlock()
+		return A0List{Items: items, store: s}
+	}
+	s.mu.Unlock()
+
+	items := make([]A0Value, n+1, 2*n+1)
+	copy(items, l.Items)
+	items[n] = v
+	return A0List{Items: items[: n+1 : n+1], store: &itemStore{items: items[:n+1]}}
+}
+
+// sameBacking reports whether two equal-length slices are views of the same
+// memory, in which case their contents are necessarily equal.
+func sameBacking[T any](a, b []T) bool {
+	return len(a) > 0 && len(a) == len(b) && &a[0] == &b[0]
+}
@@ -0,0 +1,133 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// DefaultSnapshotDir is where expect.snapshot keeps its files when
+// SnapshotOptions.Dir is empty.
+const DefaultSnapshotDir = "__snapshots__"
+
+// SnapshotOptions configures expect.snapshot.
+type SnapshotOptions struct {
+	// Dir holds one <name>.snap.json file per snapshot.
+	Dir string
+	// Update rewrites snapshots that differ instead of failing them.
+	Update bool
+}
+
+var snapshotNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// evalSnapshot implements expect.snapshot { name, value }: the value is
+// compared with the stored snapshot and the outcome recorded as evidence.
+// A missing snapshot is written and passes; a mismatch is a failed (non-fatal)
+// evidence unless snapshots are being updated.
+func (ev *evaluator) evalSnapshot(args *A0Record, e *ast.FnCallExpr) (A0Value, error) {
+	span := e.Span
+	nameVal, _ := args.Get("name")
+	name, ok := nameVal.(A0String)
+	if !ok || !snapshotNameRe.MatchString(name.Value) {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: "expect.snapshot requires 'name' to be a string of letters, digits, '.', '_' or '-'",
+			Span:    &span,
+		}
+	}
+	value, found := args.Get("value")
+	if !found {
+		value = NewNull()
+	}
+
+	actual, err := snapshotJSON(value)
+	if err != nil {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EFn,
+			Message: fmt.Sprintf("expect.snapshot '%s': %s", name.Value, err),
+			Span:    &span,
+		}
+	}
+
+	dir := ev.opts.Snapshots.Dir
+	if dir == "" {
+		dir = DefaultSnapshotDir
+	}
+	path := filepath.Join(dir, name.Value+".snap.json")
+
+	ok = true
+	var msg string
+	var details *A0Record
+	expected, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		msg = fmt.Sprintf("snapshot '%s' written", name.Value)
+		err = writeSnapshot(path, actual)
+	case err != nil:
+		// reported below
+	case bytes.Equal(expected, actual):
+		msg = fmt.Sprintf("snapshot '%s' matches", name.Value)
+	case ev.opts.Snapshots.Update:
+		msg = fmt.Sprintf("snapshot '%s' updated", name.Value)
+		err = writeSnapshot(path, actual)
+	default:
+		ok = false
+		msg = fmt.Sprintf("snapshot '%s' does not match %s", name.Value, path)
+		rec := NewRecord([]KeyValue{
+			{Key: "path", Value: NewString(path)},
+			{Key: "expected", Value: NewString(string(bytes.TrimSpace(expected)))},
+			{Key: "actual", Value: NewString(string(bytes.TrimSpace(actual)))},
+		}).(A0Record)
+		details = &rec
+	}
+	if err != nil {
+		return nil, &A0RuntimeError{
+			Code:    diagnostics.EIO,
+			Message: fmt.Sprintf("expect.snapshot '%s': %s", name.Value, err),
+			Span:    &span,
+		}
+	}
+
+	ev.recordEvidence(Evidence{
+		Kind:    "snapshot",
+		OK:      ok,
+		Msg:     msg,
+		Details: details,
+		Span:    &span,
+	})
+
+	return NewRecord([]KeyValue{
+		{Key: "kind", Value: NewString("snapshot")},
+		{Key: "ok", Value: NewBool(ok)},
+		{Key: "msg", Value: NewString(msg)},
+	}), nil
+}
+
+// snapshotJSON renders a value the way it is stored on disk: indented JSON
+// with a trailing newline, so snapshot files diff cleanly.
+func snapshotJSON(v A0Value) ([]byte, error) {
+	raw, err := ValueToJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeSnapshot(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// TaintRule forbids data produced by one tool from reaching another. From
+// and To each name a tool ("http.get") or a capability ("http.get",
+// "fs.read"); "*" matches any tool.
+type TaintRule struct {
+	From string
+	To   string
+}
+
+// minTaintLen is the shortest tool-produced string that is tracked. Shorter
+// strings ("ok", "200", "main") are too common to attribute reliably.
+const minTaintLen = 8
+
+// taintTracker records which tools produced which strings. Tracking is by
+// content: a string is tainted by a source when it contains a string that
+// source produced, so data stays tainted through records, lists and string
+// concatenation. Stdlib and host function results inherit the taint of
+// their arguments, which covers transformations such as str.upper or
+// parse.json. It is shared by the workers of a parallel map.
+type taintTracker struct {
+	mu      sync.Mutex
+	sources map[string]map[string]bool // content -> tool names and capabilities
+}
+
+func newTaintTracker() *taintTracker {
+	return &taintTracker{sources: make(map[string]map[string]bool)}
+}
+
+// mark records every string in v as coming from sources.
+func (t *taintTracker) mark(v A0Value, sources map[string]bool) {
+	if t == nil || len(sources) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	walkStrings(v, func(s string) {
+		if len(s) < minTaintLen {
+			return
+		}
+		set := t.sources[s]
+		if set == nil {
+			set = make(map[string]bool)
+			t.sources[s] = set
+		}
+		for src := range sources {
+			set[src] = true
+		}
+	})
+}
+
+// of returns the sources of any tainted content inside v.
+func (t *taintTracker) of(v A0Value) map[string]bool {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var found map[string]bool
+	walkStrings(v, func(s string) {
+		if len(s) < minTaintLen {
+			return
+		}
+		for content, set := range t.sources {
+			if !strings.Contains(s, content) {
+				continue
+			}
+			if found == nil {
+				found = make(map[string]bool)
+			}
+			for src := range set {
+				found[src] = true
+			}
+		}
+	})
+	return found
+}
+
+func walkStrings(v A0Value, f func(string)) {
+	switch val := v.(type) {
+	case A0String:
+		f(val.Value)
+	case A0List:
+		for _, item := range val.Items {
+			walkStrings(item, f)
+		}
+	case A0Record:
+		for _, kv := range val.Pairs() {
+			walkStrings(kv.Value, f)
+		}
+	}
+}
+
+// toolSources is the taint a tool's result carries: its name and capability.
+func toolSources(tool *ToolDef) map[string]bool {
+	return map[string]bool{tool.Name: true, tool.CapabilityID: true}
+}
+
+// propagateTaint gives a stdlib or host function result the taint of its
+// arguments.
+func (ev *evaluator) propagateTaint(args A0Record, result A0Value) {
+	if ev.taint == nil {
+		return
+	}
+	ev.taint.mark(result, ev.taint.of(args))
+}
+
+// checkTaint enforces ExecOptions.TaintRules before tool runs with args.
+func (ev *evaluator) checkTaint(tool *ToolDef, args A0Record, span *ast.Span) error {
+	if ev.taint == nil {
+		return nil
+	}
+	for _, kv := range args.Pairs() {
+		sources := ev.taint.of(kv.Value)
+		if len(sources) == 0 {
+			continue
+		}
+		for _, rule := range ev.opts.TaintRules {
+			if rule.To != "*" && rule.To != tool.Name && rule.To != tool.CapabilityID {
+				continue
+			}
+			if rule.From != "*" && !sources[rule.From] {
+				continue
+			}
+			from := rule.From
+			if from == "*" {
+				from = strings.Join(sortedKeys(sources), ", ")
+			}
+			details := NewRecord([]KeyValue{
+				{Key: "tool", Value: NewString(tool.Name)},
+				{Key: "arg", Value: NewString(kv.Key)},
+				{Key: "from", Value: NewString(from)},
+			}).(A0Record)
+			return &A0RuntimeError{
+				Code: diagnostics.ECapDenied,
+				Message: fmt.Sprintf("tool '%s' denied: argument '%s' carries data from %s (policy taint rule %s -> %s)",
+					tool.Name, kv.Key, from, rule.From, rule.To),
+				Span:    span,
+				Details: &details,
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
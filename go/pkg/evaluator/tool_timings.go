@@ -0,0 +1,89 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+)
+
+// ToolTimings collects phase durations a tool reports for a single call.
+// When tracing is enabled the evaluator attaches one to the context passed
+// to Execute and includes the recorded phases in the tool_end event data as
+// "<phase>Ms" entries.
+type ToolTimings struct {
+	mu     sync.Mutex
+	phases []toolPhase
+}
+
+type toolPhase struct {
+	name string
+	d    time.Duration
+}
+
+// Record adds d to the named phase.
+func (t *ToolTimings) Record(phase string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.phases {
+		if t.phases[i].name == phase {
+			t.phases[i].d += d
+			return
+		}
+	}
+	t.phases = append(t.phases, toolPhase{name: phase, d: d})
+}
+
+// data renders the phases as trace data in milliseconds.
+func (t *ToolTimings) data(into map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.phases {
+		ms := float64(p.d) / float64(time.Millisecond)
+		into[p.name+"Ms"] = FormatNumber(math.Round(ms*1000) / 1000)
+	}
+}
+
+type toolTimingsKey struct{}
+
+// ToolTimingsFrom returns the timings collector for the current tool call,
+// or nil when the call is not being traced.
+func ToolTimingsFrom(ctx context.Context) *ToolTimings {
+	t, _ := ctx.Value(toolTimingsKey{}).(*ToolTimings)
+	return t
+}
+
+// beginToolCall returns the context for a tool call and the collector for
+// its timings; the collector is nil when tracing is off. The context also
+// carries the run's ChargeBytesSent and BytesWriteAllowance hooks.
+func (ev *evaluator) beginToolCall() (context.Context, *ToolTimings) {
+	ctx := context.WithValue(ev.ctx, bytesSentKey{}, ev.chargeBytesSent)
+	ctx = context.WithValue(ctx, bytesWrittenKey{}, ev.bytesWriteAllowance)
+	if ev.opts.Trace == nil {
+		return ctx, nil
+	}
+	t := &ToolTimings{}
+	return context.WithValue(ctx, toolTimingsKey{}, t), t
+}
+
+// emitToolEnd emits the tool_end event with any timings the tool recorded,
+// and with TraceValues its result or error.
+func (ev *evaluator) emitToolEnd(toolName string, timings *ToolTimings, result A0Value, err error, span *ast.Span) {
+	if ev.opts.Trace == nil {
+		return
+	}
+	data := map[string]string{"tool": toolName}
+	if timings != nil {
+		timings.data(data)
+	}
+	if ev.opts.TraceValues {
+		if err != nil {
+			data["error"] = err.Error()
+		} else if result != nil {
+			data["result"] = ValueToJSONString(result)
+		}
+	}
+	ev.emitWithData(TraceToolEnd, span, data)
+}
@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// TraceSink receives a run's trace events. Implementations must be safe for
+// concurrent use: a Runtime shares one sink between concurrent runs, and
+// parallel map workers hand their events back from other goroutines.
+//
+// Emit must not block on slow consumers for long, since it runs on the
+// evaluator's path. Flush makes buffered events durable; the runtime calls
+// it after each run. Close flushes and releases the sink; events emitted
+// after Close are dropped.
+type TraceSink interface {
+	Emit(event TraceEvent)
+	Flush() error
+	Close() error
+}
+
+// TraceFunc adapts a plain callback to a TraceSink. Its Flush and Close do
+// nothing. The callback is not serialized, so a TraceFunc shared between
+// goroutines must do its own locking.
+type TraceFunc func(event TraceEvent)
+
+// Emit calls f.
+func (f TraceFunc) Emit(event TraceEvent) { f(event) }
+
+// Flush does nothing.
+func (f TraceFunc) Flush() error { return nil }
+
+// Close does nothing.
+func (f TraceFunc) Close() error { return nil }
+
+// NDJSONSink writes one JSON event per line, the format a0 trace reads.
+type NDJSONSink struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	err    error
+	closed bool
+}
+
+// NewNDJSONSink returns a sink writing to w. Closing the sink flushes it
+// but leaves w open.
+func NewNDJSONSink(w io.Writer) *NDJSONSink {
+	return &NDJSONSink{w: bufio.NewWriter(w)}
+}
+
+// NewNDJSONFileSink creates (or truncates) the file at path and returns a
+// sink writing to it. Closing the sink closes the file.
+func NewNDJSONFileSink(path string) (*NDJSONSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONSink{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+// Emit writes event as one line. A write error is kept and returned by the
+// next Flush or Close; later events are dropped.
+func (s *NDJSONSink) Emit(event TraceEvent) {
+	line, err := MarshalTraceEvent(event)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.err != nil {
+		return
+	}
+	if err != nil {
+		s.err = err
+		return
+	}
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		s.err = err
+	}
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (s *NDJSONSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushLocked()
+}
+
+func (s *NDJSONSink) flushLocked() error {
+	if s.err != nil || s.closed {
+		return s.err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.err = err
+	}
+	return s.err
+}
+
+// Close flushes the sink and, for a file sink, closes the file.
+func (s *NDJSONSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return s.err
+	}
+	err := s.flushLocked()
+	s.closed = true
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// MarshalTraceEvent encodes event as a trace line (without the newline):
+// { ts, runId, event, span?, data? }.
+func MarshalTraceEvent(event TraceEvent) ([]byte, error) {
+	line := map[string]any{
+		"ts":    event.Timestamp,
+		"runId": event.RunID,
+		"event": event.Event,
+	}
+	if event.Span != nil {
+		line["span"] = event.Span
+	}
+	if event.Data != nil {
+		raw, err := ValueToJSON(*event.Data)
+		if err != nil {
+			return nil, err
+		}
+		line["data"] = json.RawMessage(raw)
+	}
+	return json.Marshal(line)
+}
+
+// MemorySink keeps events in memory, for tests and for hosts that inspect a
+// run's trace after it finishes.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []TraceEvent
+}
+
+// NewMemorySink returns an empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Emit appends event.
+func (s *MemorySink) Emit(event TraceEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+// Events returns a copy of the events emitted so far.
+func (s *MemorySink) Events() []TraceEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TraceEvent(nil), s.events...)
+}
+
+// Reset discards the events emitted so far.
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+}
+
+// Flush does nothing.
+func (s *MemorySink) Flush() error { return nil }
+
+// Close does nothing; the events stay readable.
+func (s *MemorySink) Close() error { return nil }
+
+// MultiSink fans each event out to several sinks, for example an NDJSON file
+// and an OTLP exporter. Emit calls the sinks in order under one lock, so
+// every sink sees events in the same order.
+type MultiSink struct {
+	mu    sync.Mutex
+	sinks []TraceSink
+}
+
+// NewMultiSink returns a sink that forwards to sinks. Nil sinks are
+// skipped.
+func NewMultiSink(sinks ...TraceSink) *MultiSink {
+	m := &MultiSink{}
+	for _, s := range sinks {
+		if s != nil {
+			m.sinks = append(m.sinks, s)
+		}
+	}
+	return m
+}
+
+// Emit forwards event to every sink.
+func (m *MultiSink) Emit(event TraceEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sinks {
+		s.Emit(event)
+	}
+}
+
+// Flush flushes every sink and returns their errors joined.
+func (m *MultiSink) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for _, s := range m.sinks {
+		errs = append(errs, s.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink, even if some fail, and returns their errors
+// joined.
+func (m *MultiSink) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for _, s := range m.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
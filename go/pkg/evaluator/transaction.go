@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// txEntry is one effect tool call made inside a transaction block, with
+// the token its Prepare returned.
+type txEntry struct {
+	tool  *ToolDef
+	token any
+}
+
+// evalTransactionExpr runs transaction { ... }. Effect tools called in the
+// block must implement Prepare; if the block fails, the calls that
+// completed are rolled back, most recent first, and the error is returned.
+// A nested transaction joins the enclosing one: its calls roll back on its
+// own failure but commit only when the outermost block succeeds.
+func (ev *evaluator) evalTransactionExpr(e *ast.TransactionExpr, env *Env) (A0Value, error) {
+	span := e.Span
+	outermost := ev.tx == nil
+	if outermost {
+		ev.tx = []txEntry{}
+	}
+	mark := len(ev.tx)
+	ev.emit(TraceTxStart, &span)
+
+	val, err := ev.executeBlock(e.Body, env.Child())
+	if err != nil {
+		entries := ev.tx[mark:]
+		ev.tx = ev.tx[:mark]
+		if outermost {
+			ev.tx = nil
+		}
+		err = ev.rollback(entries, err)
+		ev.emitWithData(TraceTxEnd, &span, map[string]string{
+			"outcome": "rollback",
+			"effects": strconv.Itoa(len(entries)),
+		})
+		return nil, err
+	}
+	if !outermost {
+		ev.emitWithData(TraceTxEnd, &span, map[string]string{
+			"outcome": "pending",
+			"effects": strconv.Itoa(len(ev.tx) - mark),
+		})
+		return val, nil
+	}
+
+	entries := ev.tx
+	ev.tx = nil
+	var commitErr error
+	for _, entry := range entries {
+		if entry.tool.Commit == nil {
+			continue
+		}
+		if cErr := entry.tool.Commit(ev.ctx, entry.token); cErr != nil && commitErr == nil {
+			commitErr = &A0RuntimeError{
+				Code:    diagnostics.ETool,
+				Message: fmt.Sprintf("transaction commit of '%s' failed: %s", entry.tool.Name, cErr.Error()),
+				Span:    &span,
+			}
+		}
+	}
+	ev.emitWithData(TraceTxEnd, &span, map[string]string{
+		"outcome": "commit",
+		"effects": strconv.Itoa(len(entries)),
+	})
+	if commitErr != nil {
+		return nil, commitErr
+	}
+	return val, nil
+}
+
+// rollback undoes entries in reverse order. Rollback failures are added to
+// cause's message, since the files they name are left in an unknown state.
+func (ev *evaluator) rollback(entries []txEntry, cause error) error {
+	var failed []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.tool.Rollback == nil {
+			continue
+		}
+		if rErr := entry.tool.Rollback(ev.ctx, entry.token); rErr != nil {
+			failed = append(failed, fmt.Sprintf("'%s': %s", entry.tool.Name, rErr.Error()))
+		}
+	}
+	if len(failed) == 0 {
+		return cause
+	}
+	rtErr, ok := cause.(*A0RuntimeError)
+	if !ok {
+		return cause
+	}
+	msg := rtErr.Message + "; rollback failed for " + strings.Join(failed, ", ")
+	return &A0RuntimeError{Code: rtErr.Code, Message: msg, Span: rtErr.Span, Details: rtErr.Details}
+}
+
+// txPrepare is called before an effect tool runs. Inside a transaction it
+// calls the tool's Prepare and records the call, so a later failure rolls
+// it back even if the tool itself failed part-way.
+func (ev *evaluator) txPrepare(tool *ToolDef, args *A0Record, span *ast.Span) error {
+	if ev.tx == nil {
+		return nil
+	}
+	if tool.Prepare == nil {
+		return &A0RuntimeError{
+			Code:    diagnostics.ETool,
+			Message: fmt.Sprintf("tool '%s' cannot be used in a transaction: it does not support rollback", tool.Name),
+			Span:    span,
+		}
+	}
+	token, err := tool.Prepare(ev.ctx, args)
+	if err != nil {
+		return &A0RuntimeError{
+			Code:    diagnostics.ETool,
+			Message: fmt.Sprintf("tool '%s' prepare failed: %s", tool.Name, err.Error()),
+			Span:    span,
+		}
+	}
+	ev.tx = append(ev.tx, txEntry{tool: tool, token: token})
+	return nil
+}
@@ -1,6 +1,8 @@
 // Package evaluator implements the A0 runtime evaluator.
 package evaluator
 
+import "math"
+
 // A0Value is the interface for all A0 runtime values.
 // Use the sealed marker method to restrict implementations to this package.
 type A0Value interface {
@@ -36,6 +38,7 @@ func (A0String) a0value() {}
 // A0List represents an ordered list of values.
 type A0List struct {
 	Items []A0Value
+	store *itemStore // shared backing store, see sharing.go
 }
 
 func (A0List) a0value() {}
@@ -47,10 +50,11 @@ type KeyValue struct {
 }
 
 // A0Record represents an ordered map of string keys to values.
-// Insertion order is preserved via the Pairs slice.
+// Insertion order is preserved; see Pairs.
 type A0Record struct {
-	Pairs []KeyValue
-	index map[string]int // lazy index for lookups
+	pairs []KeyValue
+	store *pairStore // shared backing store, see sharing.go
+	edits *pairEdits // values overridden on top of pairs, see sharing.go
 }
 
 func (A0Record) a0value() {}
@@ -65,8 +69,26 @@ func NewBool(b bool) A0Value {
 	return A0Bool{Value: b}
 }
 
+// smallInts holds pre-boxed numbers for the integers loops and counters
+// produce most, so NewNumber doesn't allocate an interface for each.
+var smallInts = func() [smallIntMax - smallIntMin + 1]A0Value {
+	var t [smallIntMax - smallIntMin + 1]A0Value
+	for i := range t {
+		t[i] = A0Number{Value: float64(i + smallIntMin)}
+	}
+	return t
+}()
+
+const (
+	smallIntMin = -128
+	smallIntMax = 1023
+)
+
 // NewNumber creates a numeric value.
 func NewNumber(n float64) A0Value {
+	if n >= smallIntMin && n <= smallIntMax && n == math.Trunc(n) && !(n == 0 && math.Signbit(n)) {
+		return smallInts[int(n)-smallIntMin]
+	}
 	return A0Number{Value: n}
 }
 
@@ -77,58 +99,74 @@ func NewString(s string) A0Value {
 
 // NewList creates a list value.
 func NewList(items []A0Value) A0Value {
-	return A0List{Items: items}
+	n := len(items)
+	return A0List{Items: items, store: &itemStore{items: items[:n:n]}}
 }
 
 // NewRecord creates a record value from key-value pairs.
 func NewRecord(pairs []KeyValue) A0Value {
-	idx := make(map[string]int, len(pairs))
-	for i, kv := range pairs {
-		idx[kv.Key] = i
+	n := len(pairs)
+	return A0Record{pairs: pairs, store: newPairStore(pairs[:n:n])}
+}
+
+// Pairs returns the record's key-value pairs in insertion order. The slice
+// may be shared with other records and must not be modified.
+func (r A0Record) Pairs() []KeyValue {
+	if r.edits != nil {
+		return r.edits.flatten(r.pairs)
 	}
-	return A0Record{Pairs: pairs, index: idx}
+	return r.pairs
+}
+
+// Len returns the number of keys in the record.
+func (r A0Record) Len() int {
+	return len(r.pairs)
 }
 
 // Get retrieves a value by key from the record.
 func (r *A0Record) Get(key string) (A0Value, bool) {
-	if r.index == nil {
-		r.index = make(map[string]int, len(r.Pairs))
-		for i, kv := range r.Pairs {
-			r.index[kv.Key] = i
-		}
+	if r.store == nil {
+		return nil, false
 	}
-	i, ok := r.index[key]
+	i, ok := r.store.lookup(key, len(r.pairs))
 	if !ok {
 		return nil, false
 	}
-	return r.Pairs[i].Value, true
+	if v, ok := r.edits.get(i); ok {
+		return v, true
+	}
+	return r.pairs[i].Value, true
 }
 
-// Set sets a value by key in the record, preserving insertion order.
+// Set sets a value by key in the record, preserving insertion order. Records
+// that share storage with r are not affected.
 func (r *A0Record) Set(key string, val A0Value) {
-	if r.index == nil {
-		r.index = make(map[string]int, len(r.Pairs))
-		for i, kv := range r.Pairs {
-			r.index[kv.Key] = i
-		}
-	}
-	if i, ok := r.index[key]; ok {
-		r.Pairs[i].Value = val
-		return
-	}
-	r.index[key] = len(r.Pairs)
-	r.Pairs = append(r.Pairs, KeyValue{Key: key, Value: val})
+	*r = r.With(key, val)
 }
 
 // Keys returns all keys in insertion order.
 func (r *A0Record) Keys() []string {
-	keys := make([]string, len(r.Pairs))
-	for i, kv := range r.Pairs {
+	keys := make([]string, len(r.pairs))
+	for i, kv := range r.pairs {
 		keys[i] = kv.Key
 	}
 	return keys
 }
 
+// Entries returns one { key, value } record per pair, in insertion order.
+// It backs both the entries stdlib function and for over a record.
+func (r *A0Record) Entries() []A0Value {
+	pairs := r.Pairs()
+	items := make([]A0Value, len(pairs))
+	for i, kv := range pairs {
+		items[i] = NewRecord([]KeyValue{
+			{Key: "key", Value: NewString(kv.Key)},
+			{Key: "value", Value: kv.Value},
+		})
+	}
+	return items
+}
+
 // Truthiness returns the boolean interpretation of an A0 value.
 // null, false, 0, and "" are falsy; everything else is truthy.
 func Truthiness(v A0Value) bool {
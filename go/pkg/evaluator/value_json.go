@@ -1,19 +1,84 @@
 package evaluator
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"math"
+	"sort"
 	"strconv"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
 )
 
+// NumberFormat controls how ValueToJSONWith writes numbers. The zero value
+// gives ValueToJSON's output.
+type NumberFormat struct {
+	// Digits rounds numbers to this many significant digits, so float noise
+	// such as 0.1+0.2 = 0.30000000000000004 prints as 0.3. 0 keeps the
+	// shortest representation that round-trips.
+	Digits int
+	// FloatPoint writes integral numbers with a decimal point (3.0) instead
+	// of as integers (3).
+	FloatPoint bool
+	// ExpThreshold switches to scientific notation for magnitudes of at
+	// least 1e<ExpThreshold> or below 1e-<ExpThreshold>. 0 keeps the JSON
+	// encoder's thresholds (1e21 and 1e-6).
+	ExpThreshold int
+}
+
 // ValueToJSON marshals an A0Value to JSON bytes.
 // Records preserve key order. Numbers output integers without decimal point.
 func ValueToJSON(v A0Value) ([]byte, error) {
-	raw := valueToRaw(v)
-	return json.Marshal(raw)
+	return ValueToJSONWith(v, NumberFormat{})
+}
+
+// ValueToJSONWith is ValueToJSON with numbers written according to nf.
+func ValueToJSONWith(v A0Value, nf NumberFormat) ([]byte, error) {
+	if nf == (NumberFormat{}) {
+		return json.Marshal(valueToRaw(v))
+	}
+	return json.Marshal(valueToRawWith(v, &nf))
+}
+
+// StableJSON marshals v canonically, so equal results are byte-for-byte
+// equal across runs: record keys are sorted at every level and numbers are
+// rounded to at most 15 significant digits, which drops float noise.
+func StableJSON(v A0Value, nf NumberFormat) ([]byte, error) {
+	if nf.Digits == 0 || nf.Digits > 15 {
+		nf.Digits = 15
+	}
+	return ValueToJSONWith(sortKeys(v), nf)
+}
+
+// sortKeys returns v with the keys of every record in it sorted.
+func sortKeys(v A0Value) A0Value {
+	switch val := v.(type) {
+	case A0List:
+		items := make([]A0Value, len(val.Items))
+		for i, item := range val.Items {
+			items[i] = sortKeys(item)
+		}
+		return NewList(items)
+	case A0Record:
+		pairs := make([]KeyValue, val.Len())
+		for i, kv := range val.Pairs() {
+			pairs[i] = KeyValue{Key: kv.Key, Value: sortKeys(kv.Value)}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		return NewRecord(pairs)
+	}
+	return v
 }
 
 func valueToRaw(v A0Value) any {
+	return valueToRawWith(v, nil)
+}
+
+// valueToRawWith converts v for json.Marshal; nf is nil for the default
+// number format.
+func valueToRawWith(v A0Value, nf *NumberFormat) any {
 	if v == nil {
 		return nil
 	}
@@ -26,6 +91,12 @@ func valueToRaw(v A0Value) any {
 		return val.Value
 
 	case A0Number:
+		if nf != nil {
+			if n, ok := nf.format(val.Value); ok {
+				return n
+			}
+			return val.Value
+		}
 		// Output integers without decimal point
 		if val.Value == math.Trunc(val.Value) && !math.IsInf(val.Value, 0) && !math.IsNaN(val.Value) {
 			if val.Value >= math.MinInt64 && val.Value <= math.MaxInt64 {
@@ -40,12 +111,12 @@ func valueToRaw(v A0Value) any {
 	case A0List:
 		items := make([]any, len(val.Items))
 		for i, item := range val.Items {
-			items[i] = valueToRaw(item)
+			items[i] = valueToRawWith(item, nf)
 		}
 		return items
 
 	case A0Record:
-		return &orderedRecord{pairs: val.Pairs}
+		return &orderedRecord{pairs: val.Pairs(), nf: nf}
 	}
 
 	return nil
@@ -54,6 +125,7 @@ func valueToRaw(v A0Value) any {
 // orderedRecord preserves key order in JSON output.
 type orderedRecord struct {
 	pairs []KeyValue
+	nf    *NumberFormat
 }
 
 func (o *orderedRecord) MarshalJSON() ([]byte, error) {
@@ -75,7 +147,7 @@ func (o *orderedRecord) MarshalJSON() ([]byte, error) {
 		buf = append(buf, ':')
 
 		// Value
-		raw := valueToRaw(kv.Value)
+		raw := valueToRawWith(kv.Value, o.nf)
 		valBytes, err := json.Marshal(raw)
 		if err != nil {
 			return nil, err
@@ -86,6 +158,43 @@ func (o *orderedRecord) MarshalJSON() ([]byte, error) {
 	return buf, nil
 }
 
+// format renders f as a JSON number, or reports false for NaN and
+// infinities, which JSON cannot represent.
+func (nf *NumberFormat) format(f float64) (json.Number, bool) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	if nf.Digits > 0 {
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', nf.Digits, 64), 64)
+	}
+	if f == 0 {
+		f = 0 // -0 is written as 0, as ValueToJSON does
+	}
+	abs := math.Abs(f)
+	sci := abs >= 1e21 || (abs != 0 && abs < 1e-6)
+	if nf.ExpThreshold > 0 {
+		limit := math.Pow(10, float64(nf.ExpThreshold))
+		sci = abs >= limit || (abs != 0 && abs < 1/limit)
+	}
+	var s string
+	switch {
+	case sci:
+		s = strconv.FormatFloat(f, 'e', -1, 64)
+		// Trim the exponent's leading zero as encoding/json does: 1e-07 -> 1e-7.
+		if n := len(s); n >= 4 && s[n-4] == 'e' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	case f == math.Trunc(f):
+		s = strconv.FormatFloat(f, 'f', 0, 64)
+		if nf.FloatPoint {
+			s += ".0"
+		}
+	default:
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return json.Number(s), true
+}
+
 // ValueToJSONString is a convenience that returns a string.
 func ValueToJSONString(v A0Value) string {
 	b, err := ValueToJSON(v)
@@ -104,10 +213,12 @@ type evidenceSpanJSON struct {
 }
 
 type evidenceJSON struct {
-	Kind string            `json:"kind"`
-	OK   bool              `json:"ok"`
-	Msg  string            `json:"msg"`
-	Span *evidenceSpanJSON `json:"span,omitempty"`
+	Kind    string            `json:"kind"`
+	OK      bool              `json:"ok"`
+	Msg     string            `json:"msg"`
+	Details json.RawMessage   `json:"details,omitempty"`
+	Span    *evidenceSpanJSON `json:"span,omitempty"`
+	RunID   string            `json:"runId,omitempty"`
 }
 
 // EvidenceToJSON marshals a slice of Evidence to JSON bytes.
@@ -115,9 +226,17 @@ func EvidenceToJSON(evidence []Evidence) ([]byte, error) {
 	items := make([]evidenceJSON, len(evidence))
 	for i, ev := range evidence {
 		item := evidenceJSON{
-			Kind: ev.Kind,
-			OK:   ev.OK,
-			Msg:  ev.Msg,
+			Kind:  ev.Kind,
+			OK:    ev.OK,
+			Msg:   ev.Msg,
+			RunID: ev.RunID,
+		}
+		if ev.Details != nil {
+			details, err := ValueToJSON(*ev.Details)
+			if err != nil {
+				return nil, err
+			}
+			item.Details = details
 		}
 		if ev.Span != nil {
 			item.Span = &evidenceSpanJSON{
@@ -133,51 +252,120 @@ func EvidenceToJSON(evidence []Evidence) ([]byte, error) {
 	return json.Marshal(items)
 }
 
-// ParseJSONToValue converts a JSON value to an A0Value.
+// RunMeta describes the run an evidence file came from. Program and
+// ProgramSHA256 are empty for files combining several programs.
+type RunMeta struct {
+	RunID         string `json:"runId,omitempty"`
+	Program       string `json:"program,omitempty"`
+	ProgramSHA256 string `json:"programSha256,omitempty"`
+	A0Version     string `json:"a0Version,omitempty"`
+	StartTime     string `json:"startTime,omitempty"`
+	EndTime       string `json:"endTime,omitempty"`
+	ExitCode      int    `json:"exitCode"`
+	// ProgramMeta is the program's meta { ... } header, if it has one.
+	ProgramMeta *ast.ProgramMeta `json:"programMeta,omitempty"`
+}
+
+// EvidenceFileToJSON marshals evidence wrapped in the versioned envelope
+// of --evidence files, with meta alongside the entries.
+func EvidenceFileToJSON(meta RunMeta, evidence []Evidence) ([]byte, error) {
+	entries, err := EvidenceToJSON(evidence)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		SchemaVersion int `json:"schemaVersion"`
+		RunMeta
+		Evidence json.RawMessage `json:"evidence"`
+	}{EvidenceSchemaVersion, meta, entries})
+}
+
+// ParseJSONToValue converts a JSON value to an A0Value. Object keys keep
+// their order in data.
 func ParseJSONToValue(data json.RawMessage) (A0Value, error) {
-	var raw any
-	if err := json.Unmarshal(data, &raw); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeValue(dec)
+	if err != nil {
 		return nil, err
 	}
-	return anyToValue(raw), nil
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: trailing data after value")
+	}
+	return v, nil
 }
 
-func anyToValue(v any) A0Value {
-	if v == nil {
-		return NewNull()
+func decodeValue(dec *json.Decoder) (A0Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
 	}
-	switch val := v.(type) {
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			var items []A0Value
+			for dec.More() {
+				item, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return NewList(items), nil
+		case '{':
+			var pairs []KeyValue
+			index := make(map[string]int)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := keyTok.(string)
+				val, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				// A repeated key keeps its first position and last value,
+				// as encoding/json does.
+				if i, ok := index[key]; ok {
+					pairs[i].Value = val
+					continue
+				}
+				index[key] = len(pairs)
+				pairs = append(pairs, KeyValue{Key: key, Value: val})
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return NewRecord(pairs), nil
+		}
+		return nil, fmt.Errorf("invalid JSON: unexpected %v", t)
 	case bool:
-		return NewBool(val)
-	case float64:
-		return NewNumber(val)
-	case string:
-		return NewString(val)
+		return NewBool(t), nil
 	case json.Number:
-		if f, err := val.Float64(); err == nil {
-			return NewNumber(f)
-		}
-		return NewNull()
-	case []any:
-		items := make([]A0Value, len(val))
-		for i, item := range val {
-			items[i] = anyToValue(item)
-		}
-		return NewList(items)
-	case map[string]any:
-		pairs := make([]KeyValue, 0, len(val))
-		for k, v := range val {
-			pairs = append(pairs, KeyValue{Key: k, Value: anyToValue(v)})
+		f, err := t.Float64()
+		if err != nil {
+			return nil, err
 		}
-		return NewRecord(pairs)
+		return NewNumber(f), nil
+	case string:
+		return NewString(t), nil
 	}
-	return NewNull()
+	return NewNull(), nil
 }
 
 // FormatNumber formats a float64 as an integer string if it's a whole number.
+// Magnitudes of 1e21 and above use exponent notation.
 func FormatNumber(n float64) string {
-	if n == math.Trunc(n) && !math.IsInf(n, 0) && !math.IsNaN(n) {
-		return strconv.FormatInt(int64(n), 10)
+	if n == 0 {
+		return "0"
+	}
+	if math.Abs(n) >= 1e21 && !math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'g', -1, 64)
 	}
 	return strconv.FormatFloat(n, 'f', -1, 64)
 }
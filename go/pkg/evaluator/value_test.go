@@ -1,6 +1,8 @@
 package evaluator_test
 
 import (
+	"math"
+	"strconv"
 	"testing"
 
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
@@ -95,3 +97,314 @@ func TestRecordGetSet(t *testing.T) {
 		t.Errorf("got %v, want A0String{hello}", val)
 	}
 }
+
+func TestRecordWithSharesStorage(t *testing.T) {
+	base := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "a", Value: evaluator.NewNumber(1)},
+	}).(evaluator.A0Record)
+
+	r1 := base.With("b", evaluator.NewNumber(2))
+	r2 := r1.With("c", evaluator.NewNumber(3))
+	// Extending an older version must fork rather than clobber r2's entry.
+	r3 := r1.With("c", evaluator.NewNumber(30))
+	r4 := r2.With("a", evaluator.NewNumber(10))
+
+	checks := []struct {
+		rec  evaluator.A0Record
+		want string
+	}{
+		{base, `{"a":1}`},
+		{r1, `{"a":1,"b":2}`},
+		{r2, `{"a":1,"b":2,"c":3}`},
+		{r3, `{"a":1,"b":2,"c":30}`},
+		{r4, `{"a":10,"b":2,"c":3}`},
+	}
+	for i, c := range checks {
+		got, err := evaluator.ValueToJSON(c.rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("record %d: got %s, want %s", i, got, c.want)
+		}
+	}
+
+	if _, ok := r1.Get("c"); ok {
+		t.Error("r1 must not see keys appended after it")
+	}
+	if !evaluator.DeepEqual(r2, r2.With("c", evaluator.NewNumber(3))) {
+		t.Error("expected records to be equal")
+	}
+}
+
+func TestRecordWithOverrideLayersEdits(t *testing.T) {
+	pairs := make([]evaluator.KeyValue, 100)
+	for i := range pairs {
+		pairs[i] = evaluator.KeyValue{Key: "k" + strconv.Itoa(i), Value: evaluator.NewNumber(float64(i))}
+	}
+	base := evaluator.NewRecord(pairs).(evaluator.A0Record)
+
+	r1 := base.With("k5", evaluator.NewString("five"))
+	r2 := r1.With("new", evaluator.NewBool(true))
+	r3 := r2.With("k5", evaluator.NewString("again"))
+
+	if v, _ := base.Get("k5"); !evaluator.DeepEqual(v, evaluator.NewNumber(5)) {
+		t.Errorf("base.k5 = %v, want 5", v)
+	}
+	if v, _ := r1.Get("k5"); !evaluator.DeepEqual(v, evaluator.NewString("five")) {
+		t.Errorf("r1.k5 = %v, want five", v)
+	}
+	if v, _ := r2.Get("k5"); !evaluator.DeepEqual(v, evaluator.NewString("five")) {
+		t.Errorf("r2.k5 = %v, want five", v)
+	}
+	if v, _ := r3.Get("k5"); !evaluator.DeepEqual(v, evaluator.NewString("again")) {
+		t.Errorf("r3.k5 = %v, want again", v)
+	}
+	if _, ok := r1.Get("new"); ok {
+		t.Error("r1 must not see keys appended after it")
+	}
+	if got := r2.Pairs()[5].Value; !evaluator.DeepEqual(got, evaluator.NewString("five")) {
+		t.Errorf("r2.Pairs()[5] = %v, want five", got)
+	}
+	if got := base.Pairs()[5].Value; !evaluator.DeepEqual(got, evaluator.NewNumber(5)) {
+		t.Errorf("base.Pairs()[5] = %v, want 5", got)
+	}
+	if r2.Len() != 101 || len(r2.Pairs()) != 101 {
+		t.Errorf("r2 has %d pairs, want 101", r2.Len())
+	}
+
+	// Overriding more keys than fit in the edit layer folds them into a fresh
+	// store without losing earlier edits.
+	rec := base
+	for i := 0; i < 50; i++ {
+		rec = rec.With("k"+strconv.Itoa(i), evaluator.NewNumber(float64(-i)))
+	}
+	for i, kv := range rec.Pairs() {
+		want := float64(i)
+		if i < 50 {
+			want = float64(-i)
+		}
+		if !evaluator.DeepEqual(kv.Value, evaluator.NewNumber(want)) {
+			t.Fatalf("%s = %v, want %v", kv.Key, kv.Value, want)
+		}
+	}
+
+	same := base.With("k5", evaluator.NewString("five"))
+	if !evaluator.DeepEqual(r1, same) || evaluator.Hash(r1) != evaluator.Hash(same) {
+		t.Error("records with the same edits must be equal and hash the same")
+	}
+	if evaluator.DeepEqual(r1, base) || evaluator.Hash(r1) == evaluator.Hash(base) {
+		t.Error("an edited record must differ from its base")
+	}
+}
+
+func TestListAppendSharesStorage(t *testing.T) {
+	base := evaluator.NewList([]evaluator.A0Value{evaluator.NewNumber(1)}).(evaluator.A0List)
+	l1 := base.Append(evaluator.NewNumber(2))
+	l2 := l1.Append(evaluator.NewNumber(3))
+	l3 := l1.Append(evaluator.NewNumber(4))
+
+	if len(base.Items) != 1 || len(l1.Items) != 2 {
+		t.Fatalf("appending must not change earlier lists: %d, %d", len(base.Items), len(l1.Items))
+	}
+	if n := l2.Items[2].(evaluator.A0Number).Value; n != 3 {
+		t.Errorf("l2[2] = %v, want 3", n)
+	}
+	if n := l3.Items[2].(evaluator.A0Number).Value; n != 4 {
+		t.Errorf("l3[2] = %v, want 4", n)
+	}
+	if evaluator.DeepEqual(l2, l3) {
+		t.Error("expected lists to differ")
+	}
+	if !evaluator.DeepEqual(l2, l2) {
+		t.Error("expected list to equal itself")
+	}
+}
+
+func BenchmarkRecordWithAccumulate(b *testing.B) {
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = "k" + strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	rec := evaluator.A0Record{}
+	for i := 0; i < b.N; i++ {
+		rec = rec.With(keys[i], evaluator.NewNumber(float64(i)))
+	}
+}
+
+// BenchmarkRecordWithOverride measures { ...big, count: n } on a large
+// record, which must not copy big on every step.
+func BenchmarkRecordWithOverride(b *testing.B) {
+	pairs := make([]evaluator.KeyValue, 10000)
+	for i := range pairs {
+		pairs[i] = evaluator.KeyValue{Key: "k" + strconv.Itoa(i), Value: evaluator.NewNumber(float64(i))}
+	}
+	rec := evaluator.NewRecord(pairs).(evaluator.A0Record)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec = rec.With("k5000", evaluator.NewNumber(float64(i)))
+	}
+}
+
+func BenchmarkListAppendAccumulate(b *testing.B) {
+	list := evaluator.NewList(nil).(evaluator.A0List)
+	for i := 0; i < b.N; i++ {
+		list = list.Append(evaluator.NewNumber(float64(i)))
+	}
+}
+
+func BenchmarkDeepEqualShared(b *testing.B) {
+	pairs := make([]evaluator.KeyValue, 1000)
+	for i := range pairs {
+		pairs[i] = evaluator.KeyValue{Key: "k" + strconv.Itoa(i), Value: evaluator.NewNumber(float64(i))}
+	}
+	rec := evaluator.NewRecord(pairs)
+	for i := 0; i < b.N; i++ {
+		if !evaluator.DeepEqual(rec, rec) {
+			b.Fatal("expected equal")
+		}
+	}
+}
+
+func TestHashConsistentWithDeepEqual(t *testing.T) {
+	ab := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "a", Value: evaluator.NewNumber(1)},
+		{Key: "b", Value: evaluator.NewList([]evaluator.A0Value{evaluator.NewString("x")})},
+	})
+	ba := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "b", Value: evaluator.NewList([]evaluator.A0Value{evaluator.NewString("x")})},
+		{Key: "a", Value: evaluator.NewNumber(1)},
+	})
+	if evaluator.Hash(ab) != evaluator.Hash(ba) {
+		t.Error("records differing only in key order must hash equal")
+	}
+	if evaluator.Hash(evaluator.NewNumber(0)) != evaluator.Hash(evaluator.NewNumber(-0.0*1)) {
+		t.Error("0 and -0 must hash equal")
+	}
+
+	distinct := []evaluator.A0Value{
+		evaluator.NewNull(),
+		evaluator.NewBool(false),
+		evaluator.NewNumber(0),
+		evaluator.NewString(""),
+		evaluator.NewList(nil),
+		evaluator.NewRecord(nil),
+		evaluator.NewList([]evaluator.A0Value{evaluator.NewNumber(1), evaluator.NewNumber(2)}),
+		evaluator.NewList([]evaluator.A0Value{evaluator.NewNumber(2), evaluator.NewNumber(1)}),
+	}
+	seen := map[uint64]int{}
+	for i, v := range distinct {
+		h := evaluator.Hash(v)
+		if j, dup := seen[h]; dup {
+			t.Errorf("values %d and %d collide", j, i)
+		}
+		seen[h] = i
+	}
+
+	// A cached hash must not leak to a differently sized view of the same store.
+	l1 := evaluator.NewList([]evaluator.A0Value{evaluator.NewNumber(1)}).(evaluator.A0List)
+	l2 := l1.Append(evaluator.NewNumber(2))
+	evaluator.Hash(l2)
+	if evaluator.DeepEqual(l1, l2) || evaluator.Hash(l1) == evaluator.Hash(l2) {
+		t.Error("list views of different lengths must differ")
+	}
+}
+
+func TestValueToJSONWith_NumberFormat(t *testing.T) {
+	a, b := 0.1, 0.2 // variables, so the sum is not computed exactly at compile time
+	v := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "sum", Value: evaluator.NewNumber(a + b)},
+		{Key: "whole", Value: evaluator.NewNumber(3)},
+		{Key: "big", Value: evaluator.NewNumber(123456.789)},
+		{Key: "list", Value: evaluator.NewList([]evaluator.A0Value{evaluator.NewNumber(0.000000123)})},
+	})
+	checks := []struct {
+		nf   evaluator.NumberFormat
+		want string
+	}{
+		{evaluator.NumberFormat{}, `{"sum":0.30000000000000004,"whole":3,"big":123456.789,"list":[1.23e-7]}`},
+		{evaluator.NumberFormat{Digits: 6}, `{"sum":0.3,"whole":3,"big":123457,"list":[1.23e-7]}`},
+		{evaluator.NumberFormat{FloatPoint: true, ExpThreshold: 4}, `{"sum":0.30000000000000004,"whole":3.0,"big":1.23456789e+5,"list":[1.23e-7]}`},
+	}
+	for i, c := range checks {
+		got, err := evaluator.ValueToJSONWith(v, c.nf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Errorf("format %d: got %s, want %s", i, got, c.want)
+		}
+	}
+}
+
+func TestStableJSON_SortsKeysAndRoundsNumbers(t *testing.T) {
+	a, b := 0.1, 0.2
+	inner := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "y", Value: evaluator.NewNumber(1)},
+		{Key: "b", Value: evaluator.NewNumber(a + b)},
+	})
+	v := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "z", Value: evaluator.NewList([]evaluator.A0Value{inner})},
+		{Key: "a", Value: evaluator.NewString("s")},
+	})
+	got, err := evaluator.StableJSON(v, evaluator.NumberFormat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":"s","z":[{"b":0.3,"y":1}]}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestNewNumber_SmallIntsKeepValue(t *testing.T) {
+	for _, n := range []float64{-129, -128, -1, 0, 1, 2.5, 1023, 1024} {
+		got := evaluator.NewNumber(n).(evaluator.A0Number).Value
+		if got != n {
+			t.Errorf("NewNumber(%v) = %v", n, got)
+		}
+	}
+	negZero := evaluator.NewNumber(math.Copysign(0, -1)).(evaluator.A0Number).Value
+	if !math.Signbit(negZero) {
+		t.Errorf("NewNumber(-0) lost its sign")
+	}
+}
+
+func TestEnv_SpillsPastInlineBindings(t *testing.T) {
+	parent := evaluator.NewEnv(nil)
+	parent.Set("outer", evaluator.NewString("p"))
+	env := parent.Child()
+	for i := 0; i < 10; i++ {
+		env.Set("v"+strconv.Itoa(i), evaluator.NewNumber(float64(i)))
+		env.Set("v0", evaluator.NewNumber(100))
+	}
+	for i := 1; i < 10; i++ {
+		v, ok := env.Get("v" + strconv.Itoa(i))
+		if !ok || v.(evaluator.A0Number).Value != float64(i) {
+			t.Errorf("v%d = %v, %v", i, v, ok)
+		}
+	}
+	if v, _ := env.Get("v0"); v.(evaluator.A0Number).Value != 100 {
+		t.Errorf("v0 = %v, want 100", v)
+	}
+	if !env.Has("outer") || env.Has("missing") {
+		t.Errorf("Has did not consult the parent scope correctly")
+	}
+	if parent.Has("v1") {
+		t.Errorf("child binding leaked into parent")
+	}
+}
+
+func TestParseJSONToValue_KeepsKeyOrder(t *testing.T) {
+	v, err := evaluator.ParseJSONToValue([]byte(`{"z": 1, "a": {"y": [true, null], "b": "s"}, "z": 2}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := evaluator.ValueToJSONString(v)
+	if want := `{"z":2,"a":{"y":[true,null],"b":"s"}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := evaluator.ParseJSONToValue([]byte(`{} {}`)); err == nil {
+		t.Errorf("expected an error for trailing data")
+	}
+}
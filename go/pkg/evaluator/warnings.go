@@ -0,0 +1,79 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// budgetWarnRatio is the fraction of a budget limit at which a run reports
+// a warning even though the limit itself was not exceeded.
+const budgetWarnRatio = 0.8
+
+// warn records a soft runtime issue. Repeated warnings with the same code at
+// the same location (e.g. inside a loop) are reported once.
+func (ev *evaluator) warn(code, msg string, span *ast.Span, hint string) {
+	key := code
+	if span != nil {
+		key = fmt.Sprintf("%s@%s:%d:%d", code, span.File, span.StartLine, span.StartCol)
+	}
+	if ev.warned == nil {
+		ev.warned = make(map[string]bool)
+	}
+	if ev.warned[key] {
+		return
+	}
+	ev.warned[key] = true
+	ev.warnings = append(ev.warnings, diagnostics.MakeWarning(code, msg, span, hint))
+}
+
+// warnCoercion reports a non-boolean condition that is coerced via truthiness.
+func (ev *evaluator) warnCoercion(construct string, val A0Value, span *ast.Span) {
+	if _, ok := val.(A0Bool); ok {
+		return
+	}
+	ev.warn(diagnostics.ECoercion,
+		fmt.Sprintf("%s condition is %s, not boolean; coerced by truthiness", construct, typeNameOf(val)), span,
+		"compare explicitly, e.g. x != null or len { in: x } > 0")
+}
+
+// warnBudgets reports budget limits that came close to being exhausted.
+func (ev *evaluator) warnBudgets() {
+	check := func(field string, used int64, limit *int64) {
+		if limit == nil || *limit <= 0 || used > *limit {
+			return
+		}
+		if float64(used) >= float64(*limit)*budgetWarnRatio {
+			var span *ast.Span
+			if s, ok := ev.budgetSpans[field]; ok {
+				span = &s
+			}
+			ev.warn(diagnostics.EBudgetNear,
+				fmt.Sprintf("budget '%s' nearly exhausted (%d of %d used)", field, used, *limit), span,
+				fmt.Sprintf("raise %s in budget { ... } if the workload may grow", field))
+		}
+	}
+	check("timeMs", hiresSinceMs(ev.startHires), ev.budget.TimeMs)
+	check("maxToolCalls", ev.tracker.ToolCalls, ev.budget.MaxToolCalls)
+	check("maxIterations", ev.tracker.Iterations, ev.budget.MaxIterations)
+	check("maxBytesWritten", ev.tracker.BytesWritten, ev.budget.MaxBytesWritten)
+	check("maxBytesRead", ev.tracker.BytesRead, ev.budget.MaxBytesRead)
+	check("maxMemoryBytes", ev.tracker.MemoryBytes, ev.budget.MaxMemoryBytes)
+	check("maxBytesSent", ev.tracker.BytesSent, ev.budget.MaxBytesSent)
+	check("maxSteps", ev.tracker.Steps, ev.budget.MaxSteps)
+}
+
+// budgetFieldSpans maps each field of a budget header to its span.
+func budgetFieldSpans(decl *ast.BudgetDecl) map[string]ast.Span {
+	spans := make(map[string]ast.Span)
+	if decl.Budget == nil {
+		return spans
+	}
+	for _, entry := range decl.Budget.Pairs {
+		if pair, ok := entry.(*ast.RecordPair); ok {
+			spans[pair.Key] = pair.Span
+		}
+	}
+	return spans
+}
@@ -4,6 +4,7 @@ package formatter
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -42,7 +43,7 @@ func Format(program *ast.Program) string {
 	var lines []string
 
 	// Headers
-	for _, h := range program.Headers {
+	for _, h := range sortHeaders(program.Headers) {
 		lines = append(lines, formatHeader(h))
 	}
 
@@ -58,6 +59,30 @@ func Format(program *ast.Program) string {
 	return strings.Join(lines, "\n") + "\n"
 }
 
+// Options configures FormatWithOptions.
+type Options struct {
+	// Indent is the number of spaces per nesting level; 0 means the
+	// default of 2.
+	Indent int
+}
+
+// FormatWithOptions formats program like Format, applying opts.
+func FormatWithOptions(program *ast.Program, opts Options) string {
+	out := Format(program)
+	if opts.Indent == 0 || opts.Indent == len(indent) {
+		return out
+	}
+	// Strings never span lines, so leading spaces are always indentation
+	unit := strings.Repeat(" ", opts.Indent)
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		depth := (len(line) - len(trimmed)) / len(indent)
+		lines[i] = strings.Repeat(unit, depth) + trimmed
+	}
+	return strings.Join(lines, "\n")
+}
+
 // HasComments checks if a source string contains A0 comments (# prefix).
 func HasComments(source string) bool {
 	lines := strings.Split(source, "\n")
@@ -81,14 +106,70 @@ func HasComments(source string) bool {
 	return false
 }
 
+// headerRank orders headers canonically: meta, cap, budget, then imports.
+func headerRank(h ast.Header) int {
+	switch h.(type) {
+	case *ast.MetaDecl:
+		return 0
+	case *ast.CapDecl:
+		return 1
+	case *ast.BudgetDecl:
+		return 2
+	}
+	return 3
+}
+
+// sortHeaders returns headers in canonical order, with imports sorted by
+// path, then alias, then budget, and exact duplicates of an import dropped.
+func sortHeaders(headers []ast.Header) []ast.Header {
+	sorted := append([]ast.Header(nil), headers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := headerRank(sorted[i]), headerRank(sorted[j])
+		if ri != rj {
+			return ri < rj
+		}
+		a, aok := sorted[i].(*ast.ImportDecl)
+		b, bok := sorted[j].(*ast.ImportDecl)
+		if !aok || !bok {
+			return false
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Alias != b.Alias {
+			return a.Alias < b.Alias
+		}
+		return formatHeader(a) < formatHeader(b)
+	})
+	out := sorted[:0]
+	seen := make(map[string]bool)
+	for _, h := range sorted {
+		if _, ok := h.(*ast.ImportDecl); ok {
+			text := formatHeader(h)
+			if seen[text] {
+				continue
+			}
+			seen[text] = true
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
 func formatHeader(h ast.Header) string {
 	switch hdr := h.(type) {
 	case *ast.CapDecl:
 		return "cap " + formatRecord(hdr.Capabilities, 0)
 	case *ast.BudgetDecl:
 		return "budget " + formatRecord(hdr.Budget, 0)
+	case *ast.MetaDecl:
+		return "meta " + formatRecord(hdr.Fields, 0)
 	case *ast.ImportDecl:
-		return fmt.Sprintf("import %q as %s", hdr.Path, hdr.Alias)
+		out := fmt.Sprintf("import %q as %s", hdr.Path, hdr.Alias)
+		if hdr.Budget != nil {
+			out += " budget " + formatRecord(hdr.Budget, 0)
+		}
+		return out
 	}
 	return ""
 }
@@ -106,10 +187,29 @@ func formatStmt(s ast.Stmt, depth int) string {
 		return out
 	case *ast.ReturnStmt:
 		return prefix + "return " + formatExpr(stmt.Value, depth)
+	case *ast.EnsureStmt:
+		out := prefix + "ensure { that: " + formatExpr(stmt.That, depth)
+		if stmt.Else != nil {
+			out += ", else: " + formatExpr(stmt.Else, depth)
+		}
+		return out + " }"
 	case *ast.FnDecl:
 		params := strings.Join(stmt.Params, ", ")
 		bodyLines := formatBlock(stmt.Body, depth)
-		return prefix + "fn " + stmt.Name + " { " + params + " } {\n" + bodyLines + "\n" + prefix + "}"
+		export := ""
+		if stmt.Exported {
+			export = "export "
+		}
+		annotation := ""
+		if stmt.Deprecated != "" {
+			annotation = prefix + "@deprecated " + strconv.Quote(stmt.Deprecated) + "\n"
+		}
+		if stmt.Memo {
+			annotation += prefix + "@memo\n"
+		}
+		return annotation + prefix + export + "fn " + stmt.Name + " { " + params + " } {\n" + bodyLines + "\n" + prefix + "}"
+	case *ast.ExportDecl:
+		return prefix + "export { " + strings.Join(stmt.Names, ", ") + " }"
 	}
 	return ""
 }
@@ -148,6 +248,9 @@ func formatExpr(e ast.Expr, depth int) string {
 	case *ast.DoExpr:
 		return "do " + formatIdentPath(expr.Tool) + " " + formatRecord(expr.Args, depth)
 	case *ast.AssertExpr:
+		if expr.Approx {
+			return "assert.approx " + formatRecord(expr.Args, depth)
+		}
 		return "assert " + formatRecord(expr.Args, depth)
 	case *ast.CheckExpr:
 		return "check " + formatRecord(expr.Args, depth)
@@ -168,6 +271,9 @@ func formatExpr(e ast.Expr, depth int) string {
 		}
 		return fmt.Sprintf("if (%s) {\n%s\n%s}",
 			formatExpr(expr.Cond, depth), thenLines, prefix)
+	case *ast.TransactionExpr:
+		prefix := strings.Repeat(indent, depth)
+		return fmt.Sprintf("transaction {\n%s\n%s}", formatBlock(expr.Body, depth), prefix)
 	case *ast.TryExpr:
 		prefix := strings.Repeat(indent, depth)
 		tryLines := formatBlock(expr.TryBody, depth)
@@ -200,11 +306,29 @@ func formatExpr(e ast.Expr, depth int) string {
 		}
 		parts = append(parts, prefix+"}")
 		return strings.Join(parts, "\n")
+	case *ast.TypeMatchExpr:
+		prefix := strings.Repeat(indent, depth)
+		inner := strings.Repeat(indent, depth+1)
+		parts := []string{fmt.Sprintf("match type (%s) {", formatExpr(expr.Subject, depth))}
+		for _, arm := range expr.Arms {
+			head := arm.Tag
+			if arm.Binding != "" {
+				head += " " + arm.Binding
+			}
+			parts = append(parts, fmt.Sprintf("%s%s {\n%s\n%s}", inner, head, formatBlock(arm.Body, depth+1), inner))
+		}
+		parts = append(parts, prefix+"}")
+		return strings.Join(parts, "\n")
 	case *ast.FilterBlockExpr:
 		prefix := strings.Repeat(indent, depth)
 		bodyLines := formatBlock(expr.Body, depth)
 		return fmt.Sprintf("filter { in: %s, as: %q } {\n%s\n%s}",
 			formatExpr(expr.List, depth+1), expr.Binding, bodyLines, prefix)
+	case *ast.FindBlockExpr:
+		prefix := strings.Repeat(indent, depth)
+		bodyLines := formatBlock(expr.Body, depth)
+		return fmt.Sprintf("find { in: %s, as: %q } {\n%s\n%s}",
+			formatExpr(expr.List, depth+1), expr.Binding, bodyLines, prefix)
 	case *ast.LoopExpr:
 		prefix := strings.Repeat(indent, depth)
 		bodyLines := formatBlock(expr.Body, depth)
@@ -229,6 +353,13 @@ func formatExpr(e ast.Expr, depth int) string {
 			return "-(" + operandStr + ")"
 		}
 		return "-" + operandStr
+	case *ast.IndexExpr:
+		targetStr := formatExpr(expr.Target, depth)
+		switch expr.Target.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			targetStr = "(" + targetStr + ")"
+		}
+		return targetStr + "[" + formatExpr(expr.Index, depth) + "]"
 	}
 	return ""
 }
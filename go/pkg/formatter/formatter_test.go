@@ -0,0 +1,139 @@
+package formatter_test
+
+import (
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/formatter"
+	"github.com/thomasrohde/agent0/go/pkg/parser"
+)
+
+func format(t *testing.T, source string) string {
+	t.Helper()
+	prog, diags := parser.Parse(source, "test.a0")
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	return formatter.Format(prog)
+}
+
+func TestFormat_Headers(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{
+			name: "unsorted imports",
+			source: `import "./util.a0" as util
+import "./b.a0" as b
+import "./a.a0" as zeta
+import "./a.a0" as alpha
+return {}
+`,
+			want: `import "./a.a0" as alpha
+import "./a.a0" as zeta
+import "./b.a0" as b
+import "./util.a0" as util
+
+return {}
+`,
+		},
+		{
+			name: "duplicate imports",
+			source: `import "./a.a0" as a
+import "./b.a0" as b
+import "./a.a0" as a
+import "./a.a0" as a2
+return {}
+`,
+			want: `import "./a.a0" as a
+import "./a.a0" as a2
+import "./b.a0" as b
+
+return {}
+`,
+		},
+		{
+			// An import with a budget differs from the same import without.
+			name: "imports differing in budget are kept",
+			source: `import "./a.a0" as a budget { maxToolCalls: 1 }
+import "./a.a0" as a
+return {}
+`,
+			want: `import "./a.a0" as a
+import "./a.a0" as a budget { maxToolCalls: 1 }
+
+return {}
+`,
+		},
+		{
+			name: "mixed header order",
+			source: `budget { timeMs: 1000 }
+import "./b.a0" as b
+cap { fs.read: true }
+import "./a.a0" as a
+meta { name: "demo" }
+return {}
+`,
+			want: `meta { name: "demo" }
+cap { fs.read: true }
+budget { timeMs: 1000 }
+import "./a.a0" as a
+import "./b.a0" as b
+
+return {}
+`,
+		},
+		{
+			name: "alias spacing",
+			source: `import   "./a.a0"    as     a
+return {}
+`,
+			want: `import "./a.a0" as a
+
+return {}
+`,
+		},
+		{
+			// Comments are dropped (a0 fmt warns, see HasComments), and do
+			// not keep the headers around them from being sorted.
+			name: "comments between headers",
+			source: `# helpers
+import "./b.a0" as b # second
+# first
+import "./a.a0" as a
+cap { fs.read: true } # needed for reads
+return {}
+`,
+			want: `cap { fs.read: true }
+import "./a.a0" as a
+import "./b.a0" as b
+
+return {}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format(t, tt.source)
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if again := format(t, got); again != got {
+				t.Errorf("formatting is not stable:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestHasComments(t *testing.T) {
+	for source, want := range map[string]bool{
+		"# leading\nreturn {}\n":           true,
+		"return {} # trailing\n":           true,
+		"let s = \"#not a comment\"\n":     false,
+		"let s = \"a\" # after a string\n": true,
+		"return { a: 1 }\n":                false,
+	} {
+		if got := formatter.HasComments(source); got != want {
+			t.Errorf("HasComments(%q) = %v, want %v", source, got, want)
+		}
+	}
+}
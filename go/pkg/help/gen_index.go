@@ -0,0 +1,127 @@
+//go:build ignore
+
+// gen_index.go writes index_gen.go: one IndexEntry per diagnostic code in
+// pkg/diagnostics, per tool in tools.RegisterDefaults and per stdlib
+// function in stdlib.RegisterDefaults, each with the topic that documents
+// it. Run it with go generate ./pkg/help after adding any of those.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/help"
+	"github.com/thomasrohde/agent0/go/pkg/stdlib"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+func main() {
+	codes, err := diagnosticCodes("../diagnostics/diagnostics.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+	toolReg := tools.NewRegistry()
+	tools.RegisterDefaults(toolReg)
+	stdlibReg := stdlib.NewRegistry()
+	stdlib.RegisterDefaults(stdlibReg)
+
+	var entries []help.IndexEntry
+	for _, code := range codes {
+		entries = append(entries, entry(help.KindDiagnostic, code, "diagnostics"))
+	}
+	for _, name := range sortedKeys(toolReg.All()) {
+		entries = append(entries, entry(help.KindTool, name, "tools"))
+	}
+	for _, name := range sortedKeys(stdlibReg.All()) {
+		entries = append(entries, entry(help.KindStdlib, name, "stdlib"))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen_index.go; DO NOT EDIT.\n\npackage help\n\n")
+	b.WriteString("// Index lists every diagnostic code, tool and stdlib function with the\n// topic that documents it.\n")
+	b.WriteString("var Index = []IndexEntry{\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\t{Kind: %s, Name: %q, Topic: %q},\n", kindConst(e.Kind), e.Name, e.Topic)
+	}
+	b.WriteString("}\n")
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("index_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// entry finds the topic documenting name, trying home first. An entry no
+// topic documents gets an empty Topic, which the package tests report.
+func entry(kind, name, home string) help.IndexEntry {
+	topics := append([]string{home}, help.TopicList...)
+	for _, topic := range topics {
+		if help.Defines(topic, name) {
+			return help.IndexEntry{Kind: kind, Name: name, Topic: topic}
+		}
+	}
+	log.Printf("warning: no help topic documents %s %s", kind, name)
+	return help.IndexEntry{Kind: kind, Name: name}
+}
+
+// diagnosticCodes returns the values of the E... string constants in path,
+// in declaration order.
+func diagnosticCodes(path string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if !strings.HasPrefix(name.Name, "E") || i >= len(vs.Values) {
+					continue
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				if code, err := strconv.Unquote(lit.Value); err == nil && strings.HasPrefix(code, "E_") {
+					codes = append(codes, code)
+				}
+			}
+		}
+	}
+	return codes, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func kindConst(kind string) string {
+	switch kind {
+	case help.KindDiagnostic:
+		return "KindDiagnostic"
+	case help.KindTool:
+		return "KindTool"
+	}
+	return "KindStdlib"
+}
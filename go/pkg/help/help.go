@@ -28,20 +28,30 @@ TOOLS (require cap + policy)
   call? fs.exists { path }                -> bool
   call? http.get  { url, headers? }       -> { status, headers, body }
   do    sh.exec   { cmd, cwd?, env?, timeoutMs? } -> { exitCode, stdout, stderr, durationMs }
+  call.batch { tool: "http.get", items, argsFn?, concurrency?: 4, continueOnError? } -> { ok, err }
   call? = read-only        do = side-effect
-  Note: fs.list and fs.exists share the fs.read capability
+  Note: fs.list and fs.exists share the fs.read capability; fs.temp uses fs.write
 
 STDLIB (pure, no cap needed)
   parse.json { in }             -> parsed value
   get  { in, path }             -> value at dotted path ("a.b[0]")
   put  { in, path, value }      -> new record
   patch { in, ops }             -> patched record (RFC 6902)
+  diff.text { a, b, context? } -> unified diff lines   diff.json { a, b } -> patch ops (a -> b)
   eq { a, b } -> bool           contains { in, value } -> bool
+  approxEq { a, b, tolerance? } -> bool  # float-safe eq
+  hash { in } -> str            # structural hash, equal values hash equal
+  forall { gen: gen.int { min, max }, fn: "prop", runs? } -> counterexamples as failed evidence
+  log.info { msg, ...fields } -> null   # also log.debug/warn/error; stderr + trace, not stdout
   not { in }  -> bool           and { a, b } / or { a, b } -> bool
   coalesce { in, default } -> non-null value  typeof { in } -> type string
   pluck { in, key } -> list       flat { in } -> flattened list
   entries { in } -> [{ key, value }]
-  str.template { in, vars } -> interpolated string
+  str.template { in, vars } -> interpolated string; {{#each xs}}..{{/each}} {{#if x}}..{{else}}..{{/if}}
+  str.chars { in } -> [str]    str.substr { in, start, end? } -> str    s[i] -> char
+  str.compare { a, b, caseInsensitive?, locale? } -> -1 | 0 | 1
+  md.table { rows, headers? } -> str   md.link { text, url }   md.codeBlock { in, lang? }   html.escape { in }
+  tools.list {} -> [{ name, mode, capability, allowed }]   stdlib.list {} -> [str]
 
 CONTROL FLOW
   let x = if { cond: expr, then: val, else: val }
@@ -51,17 +61,27 @@ CONTROL FLOW
   fn name { params } { ... return expr }               # define before use
   let x = match ident { ok {v} { return v } err {e} { return e } }
   let out = map { in: list, fn: "fnName" }            # apply fn to each element
+  let out = map { in: list, fn: "fnName", parallel: 8 }  # pure fn only; order kept
   let val = reduce { in: list, fn: "add", init: 0 }   # accumulate to single value
+  let all = paginate { fn: "fetchPage", maxPages: 20 }  # follow next cursors -> { items, pages, next }
   let f = filter { in: list, fn: "pred" }             # keep where fn is truthy
 
 EVIDENCE
   assert { that: bool_expr, msg?: "..." }  # fatal: false -> exit 5, halts immediately
   check  { that: bool_expr, msg?: "..." }  # non-fatal: records evidence, continues; exit 5 if any failed
   msg is optional; omitted msg becomes ""
+  expect.snapshot { name: "id", value: v }  # non-fatal: compare v with __snapshots__/id.snap.json
+  assert.approx { a, b, tolerance?: 1e-9, msg? }  # fatal: |a - b| > tolerance; delta in evidence details
+  expect.schema { in: v, schema: { name: "string", age: "number?", tags: ["string"] }, msg? }
+    # non-fatal: types are typeof names or "any" ("?" = optional), records nest, [s] = list of s;
+    # failures list violations [{ path, expected, actual }] in details
+  evidence { kind: "metric", msg?, details?: { ms: t } }  # record an observation; always ok, never fails the run
+  that: eq { a, b } failing records details { a, b, diff: [{ op, path, a?, b? }] }
+    (op: added/removed/changed); a0 run and a0 test print the diff
 
 REFERENCE CHEAT SHEET
   CAPS: fs.read  fs.write  http.get  sh.exec
-  BUDGET: timeMs  maxToolCalls  maxBytesWritten  maxIterations
+  BUDGET: timeMs  maxToolCalls  maxBytesWritten  maxIterations  maxBytesRead  maxMemoryBytes  maxBytesSent  maxSteps
   EXIT CODES: 0=ok  1=cli-usage/help  2=parse/validate  3=cap-denied  4=runtime  5=assert/check
   PROPERTY ACCESS: resp.body  result.exitCode  data.items
 
@@ -82,6 +102,7 @@ HELP TOPICS
   a0 help diagnostics
   a0 help examples
   a0 help stdlib --index    # compact full stdlib index
+  a0 explain E_TYPE         # one diagnostic code, tool or stdlib function
 `
 
 // Topics maps topic names to their full help content.
@@ -97,15 +118,25 @@ COMMENTS
 PROGRAM HEADERS (must appear before any statements, any order)
   cap { capability.name: true, ... }     # declare required capabilities (value must be true)
   budget { field: value, ... }           # declare resource limits
-  import "path" as alias                 # reserved for future use (currently E_IMPORT_UNSUPPORTED)
+  import "path" as alias                 # import a module's exported fns as alias.fn
+  meta { name: "str", version: "str", description: "str", author: "str", deprecated: "str" }  # describe the program (string literals)
 
 STATEMENTS
   let name = expr                        # bind a value
   call? tool.name { args } [-> name]     # read-only tool call, optional bind
   do tool.name { args } [-> name]        # effectful tool call, optional bind
   fn name { params } { body }            # define a function
+  export fn name { params } { body }     # define a function visible to importers
+  @deprecated "msg" fn name ...          # mark a fn deprecated; callers get E_DEPRECATED
+  @memo fn name ...                      # cache a pure fn's results by its args for the run
+  export { name1, name2 }                # export footer (top level, may follow return)
   assert { that: expr, msg?: "str" }     # fatal: halt immediately if falsy (exit 5)
+  assert.approx { a: x, b: y, tolerance?: n }  # fatal: numbers must be within tolerance
   check { that: expr, msg?: "str" }      # non-fatal: record evidence, continue; exit 5 if any failed
+  expect.snapshot { name: "id", value: expr }  # non-fatal: compare with stored snapshot (a0 test --update rewrites)
+  expect.schema { in: expr, schema: rec, msg?: "str" }  # non-fatal: check a value's shape, violations in details
+  evidence { kind: "str", msg?: "str", details?: rec }  # record a custom kind of evidence (not assert/check/snapshot/schema/forall)
+  ensure { that: expr, else?: expr }     # guard: return else (default null) from the block if falsy
   return expr                              # required, must be last (any expression)
 
 EXPRESSIONS
@@ -114,12 +145,17 @@ EXPRESSIONS
   [1, 2, 3]                              # list literal
   name                                   # variable reference
   name.field                             # property access (dot notation)
+  run.id                                 # read-only: this run's ID (a0 run --run-id <id> to set)
+  run.input                              # read-only: the request's input in a0 run --batch, else null
   if { cond: x, then: y, else: z }       # conditional (lazy evaluation)
-  for { in: list, as: "v" } { body }     # iteration (produces list)
+  for { in: list, as: "v" } { body }     # iteration (produces list); a record binds { key, value }
   filter { in: list, as: "v" } { body }  # inline filter (keeps truthy)
+  find { in: list, as: "v" } { body }    # first item whose body is truthy, or null; stops early
   loop { in: init, times: N, as: "v" } { body }  # iterative convergence
   match ident { ok {v} {body} err {e} {body} }  # ok/err discrimination
   match ( expr ) { ok {v} {body} err {e} {body} }  # match on expression
+  match type ( expr ) { str s {body} num {body} _ {body} }  # branch on typeof
+  transaction { body }                   # roll back the body's effect tools if it fails
   fn_name { key: val }                   # function/stdlib call
 
 BINDING FORMS
@@ -129,7 +165,7 @@ BINDING FORMS
 RESERVED KEYWORDS (cannot be used as variable names)
   cap  budget  import  as  let  return  call?  do
   assert  check  true  false  null  if  else  for  fn  match
-  try  catch  filter  loop
+  try  catch  filter  loop  export  ensure  transaction
 
 LINE RULES
   - Statements are typically one per line; multiple per line work
@@ -158,12 +194,20 @@ PRIMITIVES
   str     "hello", "a\nb"      double-quoted, JSON escapes
   null    null
 
+  Numbers are always finite. Arithmetic that overflows or has no value
+  (1e308 * 10) is E_TYPE, naming the operation; details hold
+  { op, left, right }. Division or modulo by zero is E_TYPE too, and a
+  literal too large for a double (1e999) is a parse error.
+
 RECORDS
   { key: value }                         # simple record
   { key: value, another: value }         # multiple fields
   { nested: { a: 1 } }                   # nested records
-  { fs.read: true }                      # dotted keys (capability style)
+  { ...cfg, server.port: 8080 }          # dotted key: sets a nested field
   Records are unordered key-value maps. Keys are identifiers or dotted names.
+  A dotted key outside cap { ... } is a path: { a.b: 1 } is { a: { b: 1 } },
+  and after a spread it updates the nested field, keeping its siblings.
+  Intermediate values that are not records are replaced, as with put.
 
 LISTS
   [1, 2, 3]                              # homogeneous list
@@ -222,6 +266,16 @@ fs.exists — Check if path exists
   Example:
     call? fs.exists { path: "config.json" } -> exists
 
+fs.hash — Compute a file checksum
+  Mode: read (call?)    Cap: fs.read
+  Args:   { path: str, alg?: str }
+          alg: "sha256" (default), "sha1", "sha512" or "md5"
+  Return: { path: str, alg: str, digest: str, bytesRead: int }
+          bytesRead counts against budget maxBytesRead
+  Example:
+    call? fs.hash { path: "download.tgz" } -> sum
+    assert { that: sum.digest == expected, msg: "checksum matches" }
+
 fs.write — Write data to file
   Mode: effect (do)     Cap: fs.write
   Args:   { path: str, data: any, format?: str }
@@ -230,11 +284,42 @@ fs.write — Write data to file
   Example:
     do fs.write { path: "out.json", data: result, format: "json" } -> artifact
 
+fs.temp — Write data to a run-scoped temp file
+  Mode: effect (do)     Cap: fs.write
+  Args:   { prefix?: str, data?: any, format?: str }
+  Return: { kind: "file", path: str, bytes: int, sha256: str }
+          Files live in a per-run temp dir removed when the run ends
+          (a0 run --keep-temp keeps it if the run fails)
+  Example:
+    do fs.temp { prefix: "payload-", data: body, format: "json" } -> tmp
+
+archive.zip — Pack files into an archive
+  Mode: effect (do)     Cap: fs.write + fs.read
+  Args:   { files: [str], to: str }
+          to: ends in .zip, .tar, .tar.gz or .tgz; directories are added recursively
+  Return: { kind: "archive", path: str, files: int, bytes: int, sha256: str }
+  Example:
+    do archive.zip { files: ["dist"], to: "build/dist.zip" } -> bundle
+
+archive.unzip — Extract an archive into a directory
+  Mode: effect (do)     Cap: fs.write + fs.read
+  Args:   { from: str, to: str }
+          entries that would land outside to: are rejected; extraction
+          stops with E_BUDGET before it writes past maxBytesWritten
+  Return: { kind: "directory", path: str, files: [str], bytes: int }
+  Example:
+    do archive.unzip { from: "bundle.tgz", to: "vendor" } -> extracted
+
 http.get — HTTP GET request
   Mode: read (call?)    Cap: http.get
-  Args:   { url: str, headers?: record }
-  Return: { status: int, headers: record, body: str }
+  Args:   { url: str, headers?: record, cache?: bool }
+  Return: { status: int, headers: record, body: str, cached?: bool }
           body is always a string — use parse.json to get structured data
+          With a0 run --http-cache <dir>, responses with an ETag or
+          Last-Modified are stored and revalidated; a 304 is served from the
+          cache with cached: true. cache: false skips the cache for one call.
+          With --trace, tool_end data carries dnsMs, connectMs, tlsMs, ttfbMs
+          and transferMs; a0 trace sums them under "Tool phases".
   Example:
     call? http.get { url: "https://api.example.com/data" } -> resp
     let body = parse.json { in: resp.body }
@@ -246,16 +331,107 @@ sh.exec — Execute shell command
   Example:
     do sh.exec { cmd: "ls -la", timeoutMs: 10000 } -> result
 
+time.sleep — Pause execution
+  Mode: read (call?)    Cap: time.sleep
+  Args:   { ms: int }
+  Return: { requestedMs: int, actualMs: int }
+          Sleep time counts against timeMs; a sleep cut short by the
+          time budget fails with E_BUDGET. Emits a "sleep" trace event.
+  Example:
+    call? time.sleep { ms: 500 } -> waited
+
+notify.webhook — POST a JSON payload to a webhook
+  Mode: effect (do)     Cap: notify
+  Args:   { url: str, payload: any, headers?: record }
+  Return: { ok: bool, status: int, body: str }
+  Example:
+    do notify.webhook { url: hookUrl, payload: { run: "nightly", ok: true } } -> sent
+
+notify.slack — Post a message to Slack
+  Mode: effect (do)     Cap: notify
+  Args:   { text: str, channel?: str }
+          Uses A0_SLACK_WEBHOOK_URL if set, otherwise SLACK_BOT_TOKEN
+  Return: { ok: bool, status: int, body: str }
+  Example:
+    do notify.slack { channel: "#ops", text: "deploy finished" } -> sent
+
+kv.get / kv.set / kv.delete — Durable key-value state across runs
+  Mode: kv.get read (call?); kv.set, kv.delete effect (do)     Cap: kv
+  Args:   kv.get { key: str, default?: any }
+          kv.set { key: str, value: any }
+          kv.delete { key: str }
+  Return: kv.get -> stored value (default or null if missing)
+          kv.set -> { key: str, bytes: int }   (bytes count toward maxBytesWritten)
+          kv.delete -> { key: str, deleted: bool }
+          Store file: policy "kvPath", default ~/.a0/kv.json
+          (one JSON file, locked while in use so concurrent runs can share
+          it; meant for small state such as cursors and checkpoints)
+  Example:
+    call? kv.get { key: "cursor", default: 0 } -> cursor
+    do kv.set { key: "cursor", value: cursor + 1 } -> saved
+
+s3.get / s3.put / s3.list — Read and write objects in S3-compatible storage
+  Mode: s3.get, s3.list read (call?); s3.put effect (do)     Cap: s3.read / s3.write
+  Args:   s3.get { bucket: str, key: str }
+          s3.put { bucket: str, key: str, data: any, format?: "json", contentType?: str }
+          s3.list { bucket: str, prefix?: str, maxKeys?: int, continuationToken?: str }
+  Return: s3.get -> { bucket, key, body: str, contentType, etag, bytesRead: int }
+          s3.put -> { bucket, key, etag, bytes: int, sha256: str }
+          s3.list -> { bucket, objects: [{ key, size, etag, lastModified }],
+                       truncated: bool, nextContinuationToken: str | null }
+          bytesRead counts toward maxBytesRead, bytes toward maxBytesWritten
+          Credentials: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN,
+          or a provider set by the embedding host (runtime.WithS3Credentials)
+          Endpoint/region/buckets: policy "s3" section, A0_S3_ENDPOINT, AWS_REGION
+  Example:
+    call? s3.list { bucket: "artifacts", prefix: "runs/" } -> listing
+    do s3.put { bucket: "artifacts", key: "runs/report.json", data: report, format: "json" } -> put
+
+input.prompt — Ask the user a question on the terminal
+  Mode: effect (do)     Cap: interactive
+  Args:   { message: str, choices?: [str], secret?: bool }
+          choices: re-asks until the answer matches one (case-insensitive)
+          secret: input is not echoed
+  Return: str (the answer; the matching choice when choices is given)
+          Fails with E_TOOL when stdin is not a terminal
+  Example:
+    do input.prompt { message: "Deploy?", choices: ["yes", "no"] } -> answer
+
 KEYWORD RULES
   call? on effect tool -> E_CALL_EFFECT (exit 2, caught at check time)
   do on read tool     -> allowed but unconventional (prefer call?)
   Invalid tool args   -> E_TOOL_ARGS (exit 4, runtime schema validation)
   Unknown tool name   -> E_UNKNOWN_TOOL (usually exit 2 from validation; runtime exit 4 is rare)
-  Note: fs.list and fs.exists share the fs.read capability
+  Note: fs.list and fs.exists share the fs.read capability; fs.temp uses fs.write
 
 PATH RESOLUTION
   File paths (fs.read, fs.write) resolve relative to the process
   working directory (cwd), not the script file's directory.
+  With a0 run --workdir <dir>, paths resolve inside <dir> and may not escape it.
+
+FILES CHANGED
+  Every run tracks the files fs.write and archive.* write: one entry per
+  path with op (created|modified), bytesBefore, bytesAfter, delta and the
+  last tool. a0 run --pretty prints them as a "files changed" section on
+  stderr; --diff adds unified diffs for text files. Multi-file and --batch
+  reports carry them as "filesChanged".
+
+TRANSACTIONS
+  transaction { ... } undoes the effect tool calls in its body, most recent
+  first, when a later statement in it fails; the error is then re-raised.
+  Rollback-capable tools: fs.write, archive.unzip, kv.set, kv.delete. Other
+  effect tools fail with E_TOOL inside a transaction. A nested transaction
+  commits with the outermost one. Trace: transaction_start,
+  transaction_end { outcome }.
+  Embedders add rollback to their own tools with Def.Prepare/Commit/Rollback.
+
+OVERLAY MODE
+  a0 run file.a0 --overlay .a0-overlay/  # fs.write/archive.* write into the overlay
+  a0 run --apply .a0-overlay/            # copy its changes into the tree, remove it
+  Under --overlay the real tree (cwd, or --workdir) is never modified: writes
+  land in the overlay, fs reads see them, and the run ends with a list of
+  added/modified files on stderr. Writes outside the tree (other than
+  fs.temp files) fail. sh.exec is not redirected.
 `,
 
 	// --- STDLIB ---
@@ -280,21 +456,49 @@ DATA FUNCTIONS
     Return new record with value set at path. Creates intermediate records.
     Example: let updated = put { in: cfg, path: "meta.version", value: 2 }
 
-  patch { in: record, ops: list } -> record
+  patch { in: record, ops: list | str } -> record
     Apply JSON Patch (RFC 6902) operations.
     Each op: { op: "add"|"remove"|"replace"|"copy"|"move"|"test", path: str, value?: any, from?: str }
+    ops may also be a JSON Patch document as text, as other tools write it;
+    diff.json { a, b } produces the ops that turn a into b.
+    Paths are JSON Pointers ("" or "/a/0/b", ~1 for "/", ~0 for "~"; "-"
+    appends to a list). add, replace and test need value (null counts).
+    The patch is atomic: the first failing op fails the call with E_FN,
+    "op 2 (move \"/a\"): ...", and details { index, op, path, from? }
+    (read them as e.details in try/catch).
     Example:
       let result = patch { in: doc, ops: [
         { op: "replace", path: "/name", value: "Bob" },
         { op: "add", path: "/email", value: "bob@x.com" }
       ] }
 
+  diff.text { a: str, b: str, context?: 3, aName?: "a", bName?: "b" } -> [str]
+    Unified diff lines ("--- a", "+++ b", "@@ -1,3 +1,4 @@", " kept",
+    "-removed", "+added"), as diff -u prints them; [] when a == b.
+    Use it to show what a file write changes, or in evidence details.
+    Example:
+      let d = diff.text { a: old, b: new, aName: "config.json" }
+      evidence { kind: "review", msg: "config.json changes", details: { diff: d } }
+
+  diff.json { a: any, b: any } -> list
+    JSON Patch (RFC 6902) add/remove/replace ops turning a into b, with
+    JSON Pointer paths; patch { in: a, ops: diff.json { a, b } } equals b.
+    Records are compared by key and lists by index.
+    Example: diff.json { a: { v: 1, x: 1 }, b: { v: 2 } }
+    # -> [{ op: "remove", path: "/x" }, { op: "replace", path: "/v", value: 2 }]
+
 PREDICATE FUNCTIONS (use A0 truthiness: false/null/0/"" are falsy)
 
   eq { a: any, b: any } -> bool
     Deep equality (JSON-based comparison).
     Example: let same = eq { a: actual, b: expected }
 
+  hash { in: any } -> str
+    Structural hash as a 16-char hex string. Values that are eq hash the
+    same (record key order is ignored), so it works as a dedup or cache key.
+    Stable across runs.
+    Example: let key = hash { in: { user: u.id, day: d } }
+
   contains { in: str|list|record, value: any } -> bool
     str:    substring check (value must be a string; returns false otherwise)
     list:   element membership (deep equality)
@@ -325,7 +529,7 @@ PREDICATE FUNCTIONS (use A0 truthiness: false/null/0/"" are falsy)
 LIST FUNCTIONS
 
   len { in: list|str|record } -> int
-    Length of a list, string, or record (number of keys).
+    Length of a list, string (in code points), or record (number of keys).
 
   append { in: list, value: any } -> list
     Return new list with value added at end.
@@ -333,9 +537,13 @@ LIST FUNCTIONS
   concat { a: list, b: list } -> list
     Concatenate two lists.
 
-  sort { in: list, by?: str|list } -> list
+  sort { in: list, by?: str|list, caseInsensitive?: bool, locale?: str } -> list
     Sort a list (by record field or multiple fields for multi-key sort).
     Multi-key: sort { in: items, by: ["group", "name"] }
+    Strings compare by code point ("Zoe" before "adam") unless
+    caseInsensitive or locale is given; they collate as in str.compare.
+    Values compared must all have one type (nulls allowed, sorted last);
+    otherwise E_FN names the first element of a different type.
 
   filter { in: list, by: str } -> list
     Keep record elements where element[by] is truthy.
@@ -356,17 +564,29 @@ LIST FUNCTIONS
   find { in: list, key: str, value: any } -> any|null
     Return first record element where element[key] deeply equals value.
 
-  range { from: int, to: int } -> list
-    Generate a list of integers from 'from' (inclusive) to 'to' (exclusive).
+  range { from: num, to: num, step?: num, inclusive?: bool } -> list
+    Generate numbers from 'from' (inclusive) to 'to' (exclusive unless
+    inclusive: true) in increments of step (default 1). A negative step
+    counts down: range { from: 5, to: 0, step: -1 } -> [5, 4, 3, 2, 1].
+    A step pointing away from 'to' gives []; step: 0 is an error.
+    Float steps: item i is from + i*step rounded to 15 significant digits
+    (0.1, 0.2, 0.3, not 0.30000000000000004), and 'to' counts as reached
+    within 1e-9 of a step. for { in: range { ... } } iterates without
+    building the list.
 
   join { in: list, sep?: str } -> str
     Join list elements into a string. Default sep: "" (empty string).
+    Elements must be strings, numbers, booleans or null; a list or record
+    element is an E_FN error naming its index. (Earlier versions joined a
+    record as its JSON text; join the field you want instead.)
 
   map { in: list, fn: "fnName" } -> list
     Apply a named user-defined function to each element, return results list.
     The fn must be defined with fn before use. Single-param fn gets each item;
     multi-param fn destructures record items by key.
     Shares maxIterations budget with for loops and reduce.
+    parallel: n runs up to n items concurrently; results, evidence and trace
+    stay in list order. The fn must be pure (no call?/do, logs or snapshots).
     Example:
       fn double { x } { return { val: x * 2 } }
       let nums = [1, 2, 3]
@@ -379,6 +599,41 @@ LIST FUNCTIONS
       fn addScore { acc, item } { return { val: acc.val + item.score } }
       let result = reduce { in: scores, fn: "addScore", init: { val: 0 } }
 
+  paginate { fn: "fnName", start?: any, nextPath?: "next", itemsPath?: "items", maxPages?: 100 } -> { items, pages, next }
+    Call fn with a cursor (start, default null, then each page's next
+    value) until a page's next is falsy or maxPages pages were fetched.
+    Collects the list at itemsPath of every page. Paths are dotted, such as
+    "body.links.next"; numeric steps index lists. next in the result is the
+    cursor where it stopped: null when the API was exhausted, otherwise
+    where to resume. A page returning its own cursor as next is E_FN; items
+    that are not a list are E_TYPE. Each page is one iteration of
+    maxIterations; fn's tool calls count against maxToolCalls.
+    Example:
+      fn fetchPage { cursor } {
+        let url = if { cond: cursor, then: cursor, else: "https://api.x.dev/repos?per_page=100" }
+        call? http.get { url: url } -> r
+        return parse.json { in: r.body }
+      }
+      let repos = paginate { fn: "fetchPage", maxPages: 20 }
+
+  call.batch { tool: "name", items: list, argsFn?: "fnName", concurrency?: 4, continueOnError?: false } -> { ok, err }
+    call? a read tool once per item, at most concurrency calls at a time.
+    Each item is the call's args record, or argsFn builds it from the item
+    (argsFn runs for every item before any call starts). tool must be a
+    string literal so the validator can check its capability; effect tools
+    are E_CALL_EFFECT. The result partitions items by outcome, in item order:
+      ok:  [{ index, item, value }]
+      err: [{ index, item, code, message }]
+    Without continueOnError the first failure stops new calls and the batch
+    fails with E_TOOL for the lowest failing index. Each call counts against
+    maxToolCalls; budget errors always fail the batch. Traces show
+    batch_start { tool, items, concurrency }, then each call's events in
+    item order, then batch_end { tool, ok, err }.
+    Example:
+      fn fetchArgs { id } { return { url: str.concat { in: ["https://api.x.dev/users/", id] } } }
+      let res = call.batch { tool: "http.get", items: ids, argsFn: "fetchArgs", concurrency: 8, continueOnError: true }
+      let pages = pluck { in: res.ok, key: "value" }
+
   unique { in: list } -> list
     Remove duplicates using deep equality. Preserves first-occurrence order.
 
@@ -389,15 +644,22 @@ LIST FUNCTIONS
 MATH FUNCTIONS
 
   math.max { in: list } -> number
-    Maximum of a numeric list. Throws on empty list or non-numbers.
+    Maximum of a numeric list. Throws on empty list or non-numbers,
+    naming the index and type of the first non-number.
 
   math.min { in: list } -> number
-    Minimum of a numeric list. Throws on empty list or non-numbers.
+    Minimum of a numeric list. Throws on empty list or non-numbers,
+    naming the index and type of the first non-number.
+
+  approxEq { a: number, b: number, tolerance?: number } -> bool
+    True when |a - b| <= tolerance (default 1e-9). Use instead of eq for
+    computed floats: approxEq { a: 0.1 + 0.2, b: 0.3 } -> true
 
 STRING FUNCTIONS
 
   str.concat { parts: list } -> str
-    Concatenate a list of values into a string.
+    Concatenate a list of values into a string. Like join, parts must be
+    strings, numbers, booleans or null.
 
   str.split { in: str, sep: str } -> list
     Split a string by separator.
@@ -414,7 +676,94 @@ STRING FUNCTIONS
   str.template { in: str, vars: record } -> str
     Replace {key} placeholders with values from vars record.
     Unmatched placeholders are left as-is for debugging visibility.
+    {a.b} reads a nested field; {list.0} an item.
+    Blocks, for reports built in one call instead of concat/for fragments:
+      {{#each items}}...{{/each}}      repeat per list item or record value;
+                                       inside, {field} reads the item first,
+                                       {.} is the item, {@index} {@key}
+                                       {@first} {@last} its position
+      {{#if x}}...{{else}}...{{/if}}   else is optional; empty lists and
+                                       records count as false here
+    A block tag alone on its line removes the line. Unclosed or mismatched
+    blocks, or #each over a scalar, fail with E_FN.
     Example: let p = str.template { in: "packages/{name}/pkg.json", vars: { name: dir } }
+    Example: str.template { in: "{{#each rows}}\n- {name}: {status}\n{{/each}}", vars: { rows: rows } }
+
+  Strings are UTF-8 and are indexed by Unicode code point: len, s[i] and
+  the functions below count "é" or "日" as one character.
+
+  str.chars { in: str } -> list
+    Split a string into a list of one-character strings.
+
+  str.codePointAt { in: str, index: int } -> int | null
+    Unicode code point at index; null when out of range.
+
+  str.substr { in: str, start: int, end?: int } -> str
+    Characters from start up to (not including) end, default the end of
+    the string. Indexes are clamped to the string.
+    Example: str.substr { in: "héllo", start: 1, end: 3 } -> "él"
+
+  str.compare { a: str, b: str, caseInsensitive?: bool, locale?: str } -> int
+    -1, 0 or 1 as a sorts before, with or after b. Without options this is
+    code point order, the same as <. caseInsensitive ignores case. locale
+    (a language tag such as "en" or "sv-SE") compares letters first and
+    ignores accents and case unless that is all that differs, so "apple" <
+    "Banana" < "éclair"; "sv", "fi", "da", "nb" and "no" put å, ä, ö
+    (æ, ø) after z. Latin scripts only; other scripts keep code point order.
+    Example: str.compare { a: "é", b: "f", locale: "en" } -> -1
+
+  s[i] -> str | null
+    Index a string (or list) directly; no space before '['. Out-of-range
+    indexes yield null.
+
+MARKUP FUNCTIONS (escaping is done for you; build reports with these)
+
+  md.table { rows: list, headers?: [str] } -> str
+    GitHub-flavored Markdown table. Record rows are read by header name,
+    list rows by position. Without headers, record rows use every key in
+    the order first seen; list rows need headers. null is an empty cell;
+    | is escaped and newlines become <br>.
+    Example: md.table { rows: [{ name: "lint", ok: true }] }
+    # -> "| name | ok |\n| --- | --- |\n| lint | true |"
+
+  md.link { text: str, url: str } -> str
+    [text](url), with brackets in text escaped and spaces and parentheses
+    in url percent-encoded.
+
+  md.codeBlock { in: str, lang?: str } -> str
+    Fenced code block. The fence is longer than any backtick run in the
+    code, so the code cannot end the block early.
+    Example: md.codeBlock { in: src, lang: "go" }
+
+  html.escape { in: str } -> str
+    Escape &, <, >, " and ' so text is safe in HTML content and quoted
+    attribute values.
+
+PROPERTY TESTING
+
+  gen.int { min?: 0, max?: 100 } -> generator
+  gen.string { minLen?: 0, maxLen?: 16, alphabet?: str } -> generator
+  gen.list { of: generator, minLen?: 0, maxLen?: 10 } -> generator
+    Generators are records describing how to draw values. A record of
+    generators draws a record: { a: gen.int {}, b: gen.int {} }.
+
+  forall { gen, fn: "fnName", runs?: 100, seed?: number } -> { ok, runs, seed, counterexamples }
+    Call fn with generated inputs. Each input where fn returns a falsy
+    value or fails is recorded as failing evidence (exit 5) with the seed
+    needed to replay it.
+    Example:
+      fn revTwice { xs } { ... return eq { a: back, b: xs } }
+      forall { gen: gen.list { of: gen.int {} }, fn: "revTwice", runs: 50 }
+
+LOGGING
+
+  log.debug { msg: str, ...fields } -> null
+  log.info  { msg: str, ...fields } -> null
+  log.warn  { msg: str, ...fields } -> null
+  log.error { msg: str, ...fields } -> null
+    Write a structured entry to stderr (JSON lines; text with --pretty) and
+    to the trace as a "log" event. Never touches the stdout value.
+    Example: log.info { msg: "fetched", url: u, status: resp.status }
 
 RECORD FUNCTIONS
 
@@ -431,6 +780,18 @@ RECORD FUNCTIONS
     Return list of { key, value } pairs from a record.
     Example: let pairs = entries { in: config }
     # -> [{ key: "a", value: 1 }, { key: "b", value: 2 }]
+
+INTROSPECTION
+
+  tools.list {} -> list
+    The tools registered for this run, sorted by name, as
+    { name, mode, capability, allowed } records. allowed is true when the
+    policy grants the capability; the program must still declare it in cap.
+    Example: let usable = filter { in: tools.list {}, by: "allowed" }
+
+  stdlib.list {} -> list
+    Sorted names of the stdlib functions available to this run.
+    Example: let hasTemplate = contains { in: stdlib.list {}, value: "str.template" }
 `,
 
 	// --- CAPS ---
@@ -443,7 +804,8 @@ A0 uses deny-by-default capabilities. Two requirements for tool use:
   2. Host policy allows it
 
 VALID CAPABILITIES
-  fs.read    fs.write    http.get    sh.exec
+  fs.read    fs.write    http.get    sh.exec    time.sleep    interactive    notify
+  kv    s3.read    s3.write
 
 DECLARATION
   cap { fs.read: true, http.get: true }    # at top of file, before statements
@@ -457,8 +819,41 @@ POLICY LOADING ORDER (first match wins)
 POLICY FILE FORMAT
   {
     "allow": ["fs.read", "http.get"],
-    "deny": ["sh.exec"]
+    "deny": ["sh.exec"],
+    "hosts": ["api.example.com", "*.slack.com"]
   }
+  hosts (optional) limits http.get and notify.* to the listed hosts
+  "kvPath": "state/kv.json" (optional) sets the kv.* store file
+  "s3": { "endpoint": "http://localhost:9000", "region": "eu-west-1",
+          "buckets": ["artifacts"] } (optional) configures s3.* tools;
+          buckets limits which buckets may be accessed
+  "strictBool": true (optional) makes conditions require booleans
+          (same as a0 run --strict-bool; see help flow)
+  "taint": [{ "from": "http.get", "to": "sh.exec" }] (optional) stops data
+          produced by one tool or capability from reaching another ("*" = any);
+          strings of 8+ chars are tracked through records, lists, + and stdlib
+          calls; a violating call fails with E_CAP_DENIED
+  "grants": { "sh.exec": { "until": "2025-07-01T00:00:00Z" },
+              "fs.write": { "uses": 1 } } (optional) allows a capability
+          until a deadline and/or for N runs (counted per declaring run in
+          ~/.a0/grant_uses.json); a lapsed grant fails with E_CAP_DENIED
+          naming the expiry or the exhausted count
+
+PROFILES
+  "profiles": { "ci": { "allow": ["fs.read", "sh.exec"] },
+                "prod": { "allow": ["fs.read"], "strictBool": true } }
+  a0 run file.a0 --profile ci    # or A0_PROFILE=ci; also a0 test / a0 policy
+  Fields a profile sets replace the top-level ones; the rest are inherited.
+  An unknown profile is refused with E_POLICY (exit 3)
+
+SIGNED POLICIES
+  a0 policy keygen ~/.a0/signing.key       # prints the public key
+  a0 policy sign --key ~/.a0/signing.key   # writes .a0policy.json.sig
+  a0 policy verify                         # checks it against trusted keys (exit 3 if not)
+  Trusted keys live in ~/.a0/trusted_keys: one base64 public key per line,
+  optionally followed by a name. a0 run/test --require-signed-policy, or
+  "requireSignedProjectPolicy": true in ~/.a0/policy.json, refuses a project
+  policy whose signature does not verify (E_POLICY, exit 3)
 
 DEV OVERRIDE
   a0 run file.a0 --unsafe-allow-all        # bypasses all policy checks
@@ -467,7 +862,7 @@ COMMON ERRORS
   E_UNKNOWN_CAP    — invalid capability name in cap { ... }
   E_CAP_VALUE      — capability value is not true
   E_UNDECLARED_CAP — tool used but cap not declared (a0 check catches this)
-  E_CAP_DENIED     — policy denies the capability at runtime (exit 3)
+  E_CAP_DENIED     — policy denies the capability, or its grant lapsed, at runtime (exit 3)
 
 RULES
   - Only declare capabilities the program actually uses
@@ -490,20 +885,38 @@ DECLARATION
 FIELDS
   Field             Type   Meaning
   timeMs            int    Maximum wall-clock time in milliseconds
-  maxToolCalls      int    Maximum number of tool invocations
+  maxToolCalls      int    Maximum number of tool invocations (each call.batch item is one)
   maxBytesWritten   int    Maximum bytes written via fs.write
-  maxIterations     int    Maximum for/filter/loop/map/filter(fn:)/reduce iterations (cumulative)
+  maxIterations     int    Maximum for/filter/loop/map/filter(fn:)/reduce/paginate iterations (cumulative)
+  maxBytesRead      int    Maximum bytes read by tools that report bytesRead (fs.hash)
+  maxMemoryBytes    int    Approximate bytes of values built (lists, records, strings, results)
+  maxBytesSent      int    Maximum outbound bytes (URL, headers, body) sent by http/notify/s3 tools
+  maxSteps          int    Maximum expressions evaluated (cumulative, including function bodies)
 
 RULES
   - Only declare fields the program needs
   - Declare at most one budget header (E_DUP_BUDGET)
   - Unknown fields produce E_UNKNOWN_BUDGET at validation time (exit 2)
-  - Budget fields must be integer literals (E_BUDGET_TYPE)
+  - Budget fields must be integer literals (E_BUDGET_TYPE), not negative,
+    and each may appear once
+  - A zero timeMs/maxToolCalls/maxIterations/maxSteps is a warning
+    (E_BUDGET_ZERO): the program could not run, call a tool or loop at all
   - timeMs is enforced during expression and statement evaluation
-  - maxToolCalls/maxIterations are checked during tool calls and for/filter/loop/map/filter(fn:)/reduce iterations
+  - maxToolCalls/maxIterations are checked during tool calls and for/filter/loop/map/filter(fn:)/reduce/paginate iterations
+  - maxMemoryBytes counts every value as it is constructed and never goes
+    down; it guards against runaway intermediate lists, not exact RSS
+  - maxSteps counts every expression evaluated, so it also stops deep
+    recursion and huge nested expressions that maxIterations never sees;
+    the count is deterministic for a given program and input
+  - maxBytesSent is checked before each request is sent (pre-effect), so a
+    request that would exceed it never leaves the process
   - maxBytesWritten is enforced after each write completes (post-effect);
     the write side effect occurs before the limit is checked
   - budget can appear before or after cap, but both must precede statements
+  - An import can carry its own budget, charged by everything the module
+    does (including calls into it):
+      import "scan.a0" as scan budget { maxToolCalls: 3 }
+    Exceeding it is E_BUDGET naming the module; timeMs is not allowed there
 
 EXAMPLE
   cap { http.get: true, fs.write: true }
@@ -523,17 +936,21 @@ if — Conditional expression
   - Lazy evaluation: only the taken branch evaluates
   - Uses A0 truthiness (false/null/0/"" are falsy)
   - Returns the value of the taken branch
+  - Strict boolean mode (a0 run --strict-bool, or "strictBool": true in
+    the policy): if, assert/check that: and filter predicates must be
+    true/false; anything else is E_TYPE instead of being coerced
   Example:
     let msg = if { cond: ok, then: "success", else: "failure" }
     let safe = if { cond: data, then: data, else: { default: true } }
 
-for — List iteration
+for — List and record iteration
   Syntax: for { in: list_expr, as: "var_name" } { body }
   - Iterates each element, producing a list of results
+  - Over a record, binds { key, value } per pair in key order (like entries)
   - Loop variable is scoped to the body
   - Body MUST end with return
   - Subject to maxIterations budget (cumulative)
-  - E_FOR_NOT_LIST if in: value is not a list
+  - E_FOR_NOT_LIST if in: value is not a list or record
   Example:
     let results = for { in: items, as: "item" } {
       let parsed = parse.json { in: item }
@@ -553,6 +970,32 @@ filter — Inline list filtering (block form)
     }
   Note: filter { in: list, by: "key" } and filter { in: list, fn: "pred" } still work
 
+find — First matching item (block form)
+  Syntax: find { in: list_expr, as: "var_name" } { body }
+  - Returns the first element whose body returns truthy, or null
+  - Stops at that element: later elements are not visited and cost no
+    maxIterations budget (unlike filter followed by indexing)
+  - Body MUST end with return
+  Example:
+    let admin = find { in: users, as: "u" } {
+      return u.role == "admin"
+    }
+  Note: find { in: list, key: "k", value: v } still works
+
+ensure — Guard statement
+  Syntax: ensure { that: cond_expr, else: value_expr }
+  - If cond is falsy, the enclosing block returns the else value at once
+    (null when else is omitted); otherwise execution continues
+  - Like return, it ends only the current block: in a fn body it returns
+    from the fn, in an if/for body from that block
+  - else is evaluated only when the guard fails
+  Example:
+    fn checkPort { port } {
+      ensure { that: typeof { in: port } == "number", else: { ok: false, error: "not a number" } }
+      ensure { that: port > 0, else: { ok: false, error: "not positive" } }
+      return { ok: true, port: port }
+    }
+
 loop — Iterative convergence
   Syntax: loop { in: init_expr, times: int_expr, as: "var_name" } { body }
   - Runs body N times, threading the result through each iteration
@@ -578,11 +1021,41 @@ fn — User-defined functions
   - Lexical scoping: fn reads outer bindings from where it was defined (not from caller scope)
   - Direct recursion allowed
   - Duplicate fn names produce E_FN_DUP
+  - @memo before fn caches results by argument values for the rest of the
+    run, across direct calls, map, reduce and filter. A cached call skips
+    the body, so it costs no iterations or steps. The fn must be pure (no
+    call?/do, logs or snapshots, also in fns it calls); otherwise calling it
+    is E_FN. Failed calls are not cached
   Example:
     fn greet { name, greeting } {
       return { msg: greeting, who: name }
     }
     let result = greet { name: "world", greeting: "hello" }
+    @memo fn fib { n } {
+      return if { cond: n < 2, then: n, else: fib { n: n - 1 } + fib { n: n - 2 } }
+    }
+
+import / export — Modules
+  Syntax: import "path.a0" as alias [budget { ... }]     (header)
+          export fn name { params } { body }  or  export { name, ... }
+  - Paths are relative to the importing file
+  - A module runs once, before the importing program, and need not return
+  - Only exported fns are visible: alias.name { args }, map { fn: "alias.name" }
+  - Calling a private fn produces E_IMPORT_PRIVATE; missing files and
+    import cycles produce E_IMPORT
+  - Module fns see their own module's fns and imports, not the importer's
+  - a0 doc <file> lists a module's exported fns and its meta { ... } header
+  - @deprecated "use y instead" before fn or export fn marks it deprecated;
+    calls warn with E_DEPRECATED and a0 doc shows the notice. A module whose
+    meta { ... } has a deprecated field warns where it is imported
+  - budget { ... } after the alias caps what the module may consume (see budget)
+  Example:
+    # lib/text.a0
+    fn clean { s } { return str.replace { in: s, from: " ", to: "-" } }
+    export fn slug { s } { return clean { s: s } }
+    # main.a0
+    import "lib/text.a0" as text
+    return text.slug { s: "a b" }
 
 match — ok/err discrimination
   Syntax: match ident { ok {var} { body } err {var} { body } }
@@ -602,8 +1075,40 @@ match — ok/err discrimination
       }
     }
 
+match type — Branch on a value's type
+  Syntax: match type ( expr ) { type [var] { body } ... _ [var] { body } }
+  - Runs the arm named after typeof of the value; _ catches the rest
+  - Types: null, bool, num, str, list, rec (or the full typeof names)
+  - The optional var binds the value inside the arm
+  - E_MATCH_NO_ARM if no arm matches and there is no _ arm
+  Example:
+    let size = match type (result) {
+      str s { return len { in: s } }
+      list items { return len { in: items } }
+      _ { return 0 }
+    }
+
+try — Catch runtime errors
+  Syntax: try { body } catch { e } { body }   (or catch e { body })
+  - A runtime error in the try body runs the catch body with e bound to
+    { code, message, details?, locals }
+  - details is present when the failing function reports structured data
+  - locals is a snapshot of the bindings in scope where the error was
+    raised, innermost first, at most 32. It is shallow: lists and records
+    read "list(N)" / "record(N)", strings are cut to 256 bytes,
+    and names containing password/passwd, secret, token, apikey/api_key,
+    auth, credential or private (any case) read "[redacted]"
+  Example:
+    let r = try {
+      let attempt = 3
+      return parse.json { in: raw }
+    } catch { e } {
+      log.warn { msg: e.message, attempt: e.locals.attempt }
+      return null
+    }
+
 map — Higher-order list transformation
-  Syntax: map { in: list_expr, fn: "fnName" }
+  Syntax: map { in: list_expr, fn: "fnName", parallel?: n }
   - Calls the named user-defined function on each list element
   - Returns a new list of results
   - fn must be defined before use (with fn keyword)
@@ -611,6 +1116,10 @@ map — Higher-order list transformation
   - Multi-param fn destructures record items by key name
   - Non-record items with multi-param fn produce E_TYPE
   - Shares maxIterations budget with for/filter(fn:)/reduce (cumulative)
+  - parallel: n fans out across n workers; output order is unchanged and the
+    first failing item's error is reported. Requires a pure fn (checked
+    statically: no tool calls, logs or snapshots, fns named by literals);
+    otherwise E_FN. Nested parallel maps run sequentially.
   - E_TYPE if in: is not a list, fn: is not a string, or a multi-param item is not a record
   - E_UNKNOWN_FN if the named function doesn't exist
   Example:
@@ -666,24 +1175,54 @@ COMPILE-TIME ERRORS (exit 2) — caught by a0 check
   E_AST                  AST construction failed; report bug with minimal repro
   E_NO_RETURN            Missing return; add return <expr> as last stmt
   E_RETURN_NOT_LAST      Statements after return; move return to end
-  E_UNKNOWN_CAP          Invalid capability name; use: fs.read fs.write http.get sh.exec
-  E_IMPORT_UNSUPPORTED   Import reserved; remove import headers for now
-  E_CAP_VALUE            Cap value not true; use: fs.read: true
+  E_UNKNOWN_CAP          Invalid capability name; use: fs.read fs.write http.get sh.exec time.sleep interactive notify kv s3.read s3.write
+  E_IMPORT               Module not found, unparsable, or part of an import cycle
+  E_IMPORT_PRIVATE       Called a module fn that is not exported; export it in the module
+  E_CAP_VALUE            Spread in cap { ... } (error) or cap set to false (warning); use: fs.read: true
   E_UNDECLARED_CAP       Tool used without cap; add capability to cap { ... }
   E_DUP_BUDGET           Multiple budget headers; merge into one budget { ... }
-  E_UNKNOWN_BUDGET       Invalid budget field; use: timeMs maxToolCalls maxBytesWritten maxIterations
+  E_UNKNOWN_BUDGET       Invalid budget field (typos get a suggestion); use: timeMs maxToolCalls maxBytesWritten maxIterations maxBytesRead maxMemoryBytes maxBytesSent maxSteps
   E_BUDGET_TYPE          Budget value not int literal; use integers in budget { ... }
   E_DUP_BINDING          Duplicate let name; rename one binding
   E_UNBOUND              Undefined variable; bind with let or -> first
   E_CALL_EFFECT          call? on effect tool; use do for fs.write, sh.exec
   E_FN_DUP               Duplicate fn name; rename one function
   E_UNKNOWN_FN           Unknown function name; define fn before use / check spelling
-  E_UNKNOWN_TOOL         Unknown tool name; valid: fs.read fs.write fs.list fs.exists http.get sh.exec
+  E_UNKNOWN_TOOL         Unknown tool name; valid: fs.* archive.* http.get notify.* kv.* s3.* sh.exec time.sleep input.prompt
+
+STRICT MODE (a0 check --strict; --strict=warn reports these as warnings)
+  E_NO_RETURN            fn body does not end with return; add return <expr>
+  E_IMPLICIT_RETURN      Block value is implicit; end the block with return <expr>
+  E_IF_NO_ELSE           if block used as a value without else; add an else branch
+
+WARNINGS (reported on stderr; do not change the exit code)
+  E_UNUSED_CAP           Declared capability never used; remove it from cap { ... }
+  E_UNSAFE_ALLOW_ALL     --unsafe-allow-all used; a policy listing the declared caps suffices
+  E_DEPRECATED           Deprecated stdlib name, @deprecated fn or deprecated module used; switch to the suggested replacement
+  E_COERCION             Non-boolean condition coerced by truthiness; compare explicitly
+  E_BUDGET_NEAR          Run used 80%+ of a budget limit; raise it if the workload may grow
+  E_NULLABLE             (a0 check --null-safety) Possibly-null value reaches arithmetic or a
+                         required tool arg; guard with x != null or use coalesce
+  E_SHADOW               (a0 check) let hides a binding of an enclosing scope or fn param;
+                         rename it, or disable via "lint" in a0.json
+  E_BUDGET_ZERO          timeMs/maxToolCalls/maxIterations/maxSteps is 0, so the program cannot
+                         do that at all; remove the field or raise it
+  E_DEAD_BRANCH          (a0 check) if on a literal condition, or for/filter/map over []; remove
+                         the leftover or restore the real condition/list
+  E_FLOAT_EQ             (a0 check) == or != on float arithmetic such as 0.1 + 0.2 or a / b;
+                         compare with approxEq { a, b, tolerance? } or assert.approx
+  E_DUP_KEY              Record literal sets a key twice; the last value wins, remove one
+  E_SPREAD_OVERRIDE      Spread overwrites a key set before it; put the key after the spread
 
 RUNTIME ERRORS (exit 3/4/5)
-  E_CAP_DENIED       (3)  Policy denies capability; update cap {} or policy file
+  E_CAP_DENIED       (3)  Policy denies capability or a taint rule blocks the data; update
+                          cap {} or the policy file
   E_IO               (4)  CLI I/O error; check file paths and permissions
   E_TRACE            (4)  Invalid trace input; use valid single-run JSONL
+  E_EVIDENCE         (4)  Invalid evidence file, or written by a newer a0 (schemaVersion)
+  E_POLICY           (3)  Policy refused: unsigned or untrusted project policy, or
+                          unknown --profile/A0_PROFILE; see help caps
+  E_BATCH            (1)  Malformed a0 run --batch request; send {id, source|path, input?}
   E_UNKNOWN_TOOL     (4)  Unknown tool at runtime; usually caught by validation (exit 2)
   E_TOOL_ARGS        (4)  Invalid tool arguments; check args match tool schema
   E_TOOL             (4)  Tool execution failed; check args, paths, URLs, perms
@@ -693,11 +1232,11 @@ RUNTIME ERRORS (exit 3/4/5)
   E_FN               (4)  Stdlib function threw; check function args (e.g. invalid JSON)
   E_PATH             (4)  Dot-access on non-record; verify variable holds a record
   E_TYPE             (4)  Type mismatch at runtime; check arg types (e.g. map in:/fn:)
-  E_FOR_NOT_LIST     (4)  for in: is not a list; ensure in: evaluates to [...]
+  E_FOR_NOT_LIST     (4)  for in: is not a list or record; ensure in: evaluates to [...] or {...}
   E_MATCH_NOT_RECORD (4)  match on non-record; ensure subject is { ok/err: ... }
   E_MATCH_NO_ARM     (4)  No ok/err key in subject; subject must have ok or err key
   E_ASSERT           (5)  Assertion false (fatal, halts); fix condition or data
-  check failed       (5)  Evidence failure (non-fatal); exit 5 after run
+  E_CHECK            (5)  Check failed (non-fatal, evidence recorded); run exits 5 after finishing
 
 DEBUGGING WORKFLOW
   1. a0 check file.a0                        # catch compile-time errors first
@@ -843,18 +1382,70 @@ COMMON PITFALLS
 CLI USAGE
   a0 run file.a0                        # execute (deny-by-default)
   a0 run file.a0 --debug-parse          # show raw parser internals on parse errors
+  a0 run file.a0 --strict-bool          # conditions must be booleans (no truthiness)
   a0 run file.a0 --unsafe-allow-all     # bypass caps (dev only)
   a0 run file.a0 --trace t.jsonl        # emit execution trace
-  a0 run file.a0 --pretty               # human-readable errors
+  a0 run file.a0 --verbose              # log each statement to stderr: location, time, tools called
+  a0 run file.a0 --trace t.jsonl --trace-values  # also record tool results and the output, for a0 verify
+  a0 run file.a0 --evidence ev.json     # write evidence with run metadata (runId, sha256, times, exit code)
+  a0 run file.a0 --evidence ev.ndjson --evidence-append  # accumulate runs, one line each
+  a0 run file.a0 --run-id job-123       # correlate trace/evidence with an external ID
+  a0 run --batch < requests.jsonl       # one {id, source|path, input?} per line -> one result per line
+  a0 run file.a0 --pretty               # human-readable errors; results over 64 KB are summarized
+  a0 run file.a0 --pretty --full-output # print the whole result anyway (--max-output <bytes> sets the limit)
+  a0 run file.a0 --output-file out.json # write the result atomically; stdout is empty (a status line with --pretty)
+  a0 run file.a0 --select ".items[0].name"  # print only part of the result; ".items[].name" maps over a list
+                                        # a malformed path such as "a..b" exits 2 (E_PATH) before running
+  a0 run file.a0 --workdir sandbox/     # confine fs tool paths to a directory
+  a0 run file.a0 --overlay ovl/         # write fs effects to ovl/; a0 run --apply ovl/ commits them
+  a0 run file.a0 --diff                 # "files changed" on stderr with unified diffs of text files
+  a0 run file.a0 --http-cache .a0cache/ # revalidate http.get responses via ETag
+  a0 run file.a0 --float-digits 12      # round output numbers (0.1+0.2 -> 0.3); also --float-exp <n>, --float-point
+  a0 run file.a0 --stable-json          # sorted keys, normalized numbers: byte-comparable with a golden file
+  a0 test a.a0 b.a0                     # run for evidence; expect.snapshot compares with __snapshots__/
+  a0 test a.a0 --update                 # rewrite snapshots that no longer match
+  a0 run a.a0 b.a0 c.a0 --parallel 4    # run several programs; table on stderr, JSON report on stdout
+  a0 run a.a0 b.a0 --shared-budget '{ "maxToolCalls": 20 }'  # one budget across all runs
   a0 check file.a0                      # validate without running (prints [])
   a0 check file.a0 --stable-json        # validate with stable machine success schema
   a0 check file.a0 --debug-parse        # show raw parser internals on parse errors
+  a0 check file.a0 --strict[=warn]      # require explicit returns in blocks
+  a0 check file.a0 --null-safety        # warn when possibly-null values reach math or tool args
+  a0 check a.a0 b.a0 --json-lines       # one JSON diagnostic per line, streamed file by file
+  a0 check file.a0 --max-diagnostics 20 # show at most 20 (errors first); repeats are grouped with a count
+                                        # JSON output then ends with a {"omitted": n, "maxDiagnostics": 20} line
   a0 fmt file.a0                        # format to stdout
   a0 fmt file.a0 --write                # format in place
-  a0 trace t.jsonl                      # summarize trace file
+  a0 doc lib.a0                         # list a module's exported functions
+  a0 trace t.jsonl                      # summarize trace file (tools, evidence, capabilities, slowest statements)
+  a0 trace t.jsonl --validate           # strict lint: fields, event names, one run ID (E_TRACE per line)
+  a0 trace --merge 'nightly/*.jsonl'    # runs, success rate, tool latency, top failures
+  a0 evidence summarize ev.json --text  # run metadata, evidence by kind, failures
+  a0 plan file.a0                       # JSON list of the do calls a run would make, without making them
+  a0 plan file.a0 --text                # numbered plan for review
   a0 policy                             # show effective policy resolution
   a0 policy --json                      # policy as JSON
+  a0 policy --profile ci                # effective policy with a profile applied
+  a0 policy verify                      # check .a0policy.json.sig against ~/.a0/trusted_keys
+  a0 tools                              # registered tools: mode, capability, allowed by policy
+  a0 tools --json --profile ci          # the same as JSON, with a profile applied
+  a0 bench --self                       # parser/evaluator stress benchmarks; exit 5 if over allocation budget
+  a0 hash file.a0                       # canonical hash of the program and its imports, after formatting
+  a0 verify t.jsonl [file.a0]           # replay a --trace-values run from its trace; exit 5 if the output differs
   a0 help stdlib --index                # compact full stdlib index
+  a0 run                                # run the "entry" program from a0.json
+
+PROJECT MANIFEST (a0.json, found in the working directory or a parent)
+  {
+    "entry": "src/main.a0",                # default file for run/check/fmt
+    "importRoot": "src",                   # bare import paths resolve here
+    "run": { "pretty": true, "evidence": "out/evidence.json", "trace": "out/trace.jsonl" },
+    "fmt": { "indent": 2 },
+    "lint": { "disable": ["E_SHADOW"] }    # turn off a0 check lint warnings by code
+  }
+  "evidenceAppend": true under "run" appends each run to the evidence file as NDJSON.
+  Paths are relative to a0.json; command-line flags take precedence.
+  Imports starting with ./ or ../ stay relative to the importing file.
 `,
 }
 
@@ -908,13 +1499,16 @@ func StdlibIndex() string {
 	}
 
 	entries := []entry{
-		// DATA (4)
+		// DATA (6)
 		{"parse.json", "Parse JSON string -> structured value"},
 		{"get", "Read value at dotted path"},
 		{"put", "Set value at dotted path (returns new record)"},
 		{"patch", "Apply JSON Patch (RFC 6902) operations"},
-		// PREDICATES (7)
+		{"diff.text", "Unified diff of two strings, as a list of lines"},
+		{"diff.json", "JSON Patch ops that turn one value into another"},
+		// PREDICATES (8)
 		{"eq", "Deep equality comparison"},
+		{"hash", "Structural hash string (eq values hash equal)"},
 		{"contains", "Substring / element / key membership test"},
 		{"not", "Boolean negation with truthiness coercion"},
 		{"and", "Logical AND with truthiness coercion"},
@@ -928,29 +1522,54 @@ func StdlibIndex() string {
 		{"sort", "Sort list (optionally by record field)"},
 		{"filter", "Keep elements by key truthiness or predicate fn"},
 		{"find", "Find first record where key equals value"},
-		{"range", "Generate integer list [from, to)"},
+		{"range", "Generate numbers [from, to) by step (inclusive?)"},
 		{"join", "Join list elements into string"},
 		{"unique", "Remove duplicates (deep equality)"},
 		{"pluck", "Extract single field from each record"},
 		{"flat", "Flatten one level of list nesting"},
-		// HIGHER-ORDER (2)
+		// HIGHER-ORDER (4)
 		{"map", "Apply named function to each list element"},
 		{"reduce", "Accumulate list to single value via 2-param fn"},
-		// MATH (2)
+		{"paginate", "Follow next cursors through fn, collecting page items"},
+		{"call.batch", "call? a read tool per item with bounded concurrency"},
+		// MATH (3)
 		{"math.max", "Maximum of numeric list"},
 		{"math.min", "Minimum of numeric list"},
-		// STRING (6)
+		{"approxEq", "Numeric equality within a tolerance"},
+		// STRING (10)
 		{"str.concat", "Concatenate list of values into string"},
 		{"str.split", "Split string by separator"},
 		{"str.starts", "Test if string starts with value"},
 		{"str.ends", "Test if string ends with value"},
 		{"str.replace", "Replace all occurrences of substring"},
-		{"str.template", "Interpolate {key} placeholders from vars record"},
+		{"str.template", "Render {key} placeholders and {{#each}}/{{#if}} blocks from vars"},
+		{"str.chars", "List of one-character strings (code points)"},
+		{"str.codePointAt", "Unicode code point at an index"},
+		{"str.substr", "Substring by code point indexes"},
+		{"str.compare", "Compare strings, optionally case-insensitive or by locale"},
+		// MARKUP (4)
+		{"md.table", "Markdown table from records or lists, cells escaped"},
+		{"md.link", "Markdown link with escaped text and URL"},
+		{"md.codeBlock", "Fenced Markdown code block that its content cannot close"},
+		{"html.escape", "Escape & < > \" ' for HTML text and attributes"},
+		// PROPERTY TESTING (4)
+		{"gen.int", "Generator of integers in [min, max]"},
+		{"gen.string", "Generator of strings from an alphabet"},
+		{"gen.list", "Generator of lists of generated values"},
+		{"forall", "Check a fn against generated inputs"},
+		// LOGGING (4)
+		{"log.debug", "Log a debug entry to stderr and the trace"},
+		{"log.info", "Log an info entry to stderr and the trace"},
+		{"log.warn", "Log a warning entry to stderr and the trace"},
+		{"log.error", "Log an error entry to stderr and the trace"},
 		// RECORD (4)
 		{"keys", "List of record keys"},
 		{"values", "List of record values"},
 		{"merge", "Shallow-merge two records (b overwrites a)"},
 		{"entries", "List of {key, value} pairs from record"},
+		// INTROSPECTION (2)
+		{"tools.list", "Tools available to the run, with mode and capability"},
+		{"stdlib.list", "Names of the available stdlib functions"},
 	}
 
 	var b strings.Builder
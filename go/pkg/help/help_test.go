@@ -1,8 +1,15 @@
 package help
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/stdlib"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
 )
 
 func TestQUICKREFNonEmpty(t *testing.T) {
@@ -119,8 +126,8 @@ func TestStdlibIndex(t *testing.T) {
 
 func TestStdlibIndexCount(t *testing.T) {
 	idx := StdlibIndex()
-	if !strings.Contains(idx, "Total: 36 functions") {
-		t.Errorf("StdlibIndex should report 36 functions, got:\n%s", idx)
+	if !strings.Contains(idx, "Total: 60 functions") {
+		t.Errorf("StdlibIndex should report 60 functions, got:\n%s", idx)
 	}
 }
 
@@ -139,3 +146,89 @@ func TestMatchTopicAllExact(t *testing.T) {
 		}
 	}
 }
+
+// TestIndexComplete fails when a diagnostic code, default tool or stdlib
+// function has no index entry (run go generate ./pkg/help) or its topic
+// does not document it (add an entry to the topic).
+func TestIndexComplete(t *testing.T) {
+	want := map[string]string{}
+	for _, code := range diagnosticCodes(t) {
+		want[code] = KindDiagnostic
+	}
+	toolReg := tools.NewRegistry()
+	tools.RegisterDefaults(toolReg)
+	for name := range toolReg.All() {
+		want[name] = KindTool
+	}
+	stdlibReg := stdlib.NewRegistry()
+	stdlib.RegisterDefaults(stdlibReg)
+	for name := range stdlibReg.All() {
+		want[name] = KindStdlib
+	}
+
+	indexed := map[string]bool{}
+	for _, e := range Index {
+		indexed[e.Name] = true
+		if want[e.Name] != e.Kind {
+			t.Errorf("index entry %s %s is stale; run go generate ./pkg/help", e.Kind, e.Name)
+			continue
+		}
+		if e.Topic == "" || !Defines(e.Topic, e.Name) {
+			t.Errorf("%s %s is not documented in help topic %q", e.Kind, e.Name, e.Topic)
+		}
+	}
+	for name, kind := range want {
+		if !indexed[name] {
+			t.Errorf("%s %s has no help index entry; run go generate ./pkg/help", kind, name)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	for name, want := range map[string]string{
+		"E_PARSE":    "Syntax error",
+		"fs.read":    "Return: str",
+		"parse.json": "Parse a JSON string",
+	} {
+		text, err := Explain(name)
+		if err != nil {
+			t.Errorf("Explain(%q): %v", name, err)
+			continue
+		}
+		if !strings.Contains(text, want) {
+			t.Errorf("Explain(%q) = %q, want it to contain %q", name, text, want)
+		}
+	}
+	if _, err := Explain("E_NOPE"); err == nil {
+		t.Error("expected an error for an unknown name")
+	}
+}
+
+// diagnosticCodes returns the values of the E... constants declared in
+// pkg/diagnostics.
+func diagnosticCodes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "../diagnostics/diagnostics.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, value := range spec.(*ast.ValueSpec).Values {
+				lit, ok := value.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+				if code, _ := strconv.Unquote(lit.Value); strings.HasPrefix(code, "E_") {
+					codes = append(codes, code)
+				}
+			}
+		}
+	}
+	return codes
+}
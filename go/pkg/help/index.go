@@ -0,0 +1,99 @@
+package help
+
+import (
+	"fmt"
+	"strings"
+)
+
+//go:generate go run gen_index.go
+
+// Kinds of IndexEntry.
+const (
+	KindDiagnostic = "diagnostic"
+	KindTool       = "tool"
+	KindStdlib     = "stdlib"
+)
+
+// IndexEntry names a diagnostic code, tool or stdlib function and the
+// topic that documents it. Index is generated from the diagnostics
+// constants and the default tool and stdlib registries; the package tests
+// fail when it is stale or an entry has no documentation.
+type IndexEntry struct {
+	Kind  string
+	Name  string
+	Topic string
+}
+
+// Lookup returns the index entry for name.
+func Lookup(name string) (IndexEntry, bool) {
+	for _, e := range Index {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return IndexEntry{}, false
+}
+
+// Explain returns the documentation of one diagnostic code, tool or stdlib
+// function: its entry in its topic, under a heading naming the topic.
+func Explain(name string) (string, error) {
+	e, ok := Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("no help entry for %s", name)
+	}
+	text, ok := entryText(Topics[e.Topic], name)
+	if !ok {
+		return "", fmt.Errorf("help topic %s has no entry for %s", e.Topic, name)
+	}
+	return fmt.Sprintf("%s (%s, from a0 help %s)\n\n%s", name, e.Kind, e.Topic, text), nil
+}
+
+// Defines reports whether topic has an entry for name, a line starting
+// with it.
+func Defines(topic, name string) bool {
+	_, ok := entryText(Topics[topic], name)
+	return ok
+}
+
+// entryText finds the line of content that defines name, one whose text
+// starts with it, and returns it with the more-indented lines that follow.
+func entryText(content, name string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if !definesName(trimmed, name) {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		end := i + 1
+		for end < len(lines) {
+			next := lines[end]
+			rest := strings.TrimLeft(next, " ")
+			if rest == "" || len(next)-len(rest) <= indent {
+				break
+			}
+			end++
+		}
+		return dedent(lines[i:end], indent), true
+	}
+	return "", false
+}
+
+// definesName reports whether line starts with name as a whole word.
+func definesName(line, name string) bool {
+	if !strings.HasPrefix(line, name) {
+		return false
+	}
+	rest := line[len(name):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+func dedent(lines []string, indent int) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString("  ")
+		b.WriteString(line[min(indent, len(line)):])
+		b.WriteString("\n")
+	}
+	return b.String()
+}
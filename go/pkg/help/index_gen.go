@@ -0,0 +1,139 @@
+// Code generated by gen_index.go; DO NOT EDIT.
+
+package help
+
+// Index lists every diagnostic code, tool and stdlib function with the
+// topic that documents it.
+var Index = []IndexEntry{
+	{Kind: KindDiagnostic, Name: "E_LEX", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_PARSE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_AST", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_NO_RETURN", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_RETURN_NOT_LAST", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNKNOWN_CAP", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_DUP_BINDING", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNBOUND", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_TOOL_ARGS", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNKNOWN_TOOL", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_CALL_EFFECT", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_CAP_DENIED", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_TOOL", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNKNOWN_FN", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_FN", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_ASSERT", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_CHECK", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_PATH", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNDECLARED_CAP", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_BUDGET", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNKNOWN_BUDGET", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_FN_DUP", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_FOR_NOT_LIST", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_MATCH_NOT_RECORD", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_MATCH_NO_ARM", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_TYPE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_IO", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_TRACE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_EVIDENCE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_IMPORT", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_IMPORT_PRIVATE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_BATCH", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_POLICY", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_CAP_VALUE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_IMPLICIT_RETURN", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_IF_NO_ELSE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNUSED_CAP", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_UNSAFE_ALLOW_ALL", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_DEPRECATED", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_COERCION", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_BUDGET_NEAR", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_NULLABLE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_DUP_KEY", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_SPREAD_OVERRIDE", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_SHADOW", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_DEAD_BRANCH", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_FLOAT_EQ", Topic: "diagnostics"},
+	{Kind: KindDiagnostic, Name: "E_BUDGET_ZERO", Topic: "diagnostics"},
+	{Kind: KindTool, Name: "archive.unzip", Topic: "tools"},
+	{Kind: KindTool, Name: "archive.zip", Topic: "tools"},
+	{Kind: KindTool, Name: "fs.exists", Topic: "tools"},
+	{Kind: KindTool, Name: "fs.hash", Topic: "tools"},
+	{Kind: KindTool, Name: "fs.list", Topic: "tools"},
+	{Kind: KindTool, Name: "fs.read", Topic: "tools"},
+	{Kind: KindTool, Name: "fs.temp", Topic: "tools"},
+	{Kind: KindTool, Name: "fs.write", Topic: "tools"},
+	{Kind: KindTool, Name: "http.get", Topic: "tools"},
+	{Kind: KindTool, Name: "input.prompt", Topic: "tools"},
+	{Kind: KindTool, Name: "kv.delete", Topic: "tools"},
+	{Kind: KindTool, Name: "kv.get", Topic: "tools"},
+	{Kind: KindTool, Name: "kv.set", Topic: "tools"},
+	{Kind: KindTool, Name: "notify.slack", Topic: "tools"},
+	{Kind: KindTool, Name: "notify.webhook", Topic: "tools"},
+	{Kind: KindTool, Name: "s3.get", Topic: "tools"},
+	{Kind: KindTool, Name: "s3.list", Topic: "tools"},
+	{Kind: KindTool, Name: "s3.put", Topic: "tools"},
+	{Kind: KindTool, Name: "sh.exec", Topic: "tools"},
+	{Kind: KindTool, Name: "time.sleep", Topic: "tools"},
+	{Kind: KindStdlib, Name: "and", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "append", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "approxEq", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "call.batch", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "coalesce", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "concat", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "contains", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "diff.json", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "diff.text", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "entries", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "eq", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "evidence", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "expect.schema", Topic: "syntax"},
+	{Kind: KindStdlib, Name: "expect.snapshot", Topic: "syntax"},
+	{Kind: KindStdlib, Name: "filter", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "find", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "flat", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "forall", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "gen.int", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "gen.list", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "gen.string", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "get", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "hash", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "html.escape", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "join", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "keys", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "len", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "log.debug", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "log.error", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "log.info", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "log.warn", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "map", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "math.max", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "math.min", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "md.codeBlock", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "md.link", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "md.table", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "merge", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "not", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "or", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "paginate", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "parse.json", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "patch", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "pluck", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "put", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "range", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "reduce", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "sort", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "stdlib.list", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.chars", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.codePointAt", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.compare", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.concat", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.ends", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.replace", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.split", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.starts", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.substr", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "str.template", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "tools.list", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "typeof", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "unique", Topic: "stdlib"},
+	{Kind: KindStdlib, Name: "values", Topic: "stdlib"},
+}
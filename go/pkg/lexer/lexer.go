@@ -38,6 +38,9 @@ const (
 	TokCatch
 	TokFilter
 	TokLoop
+	TokExport
+	TokEnsure
+	TokTransaction
 
 	// Literals
 	TokIntLit
@@ -60,6 +63,7 @@ const (
 	TokDot       // .
 	TokArrow     // ->
 	TokEquals    // =
+	TokAt        // @
 
 	// Comparison operators
 	TokGtEq   // >=
@@ -88,27 +92,30 @@ type Token struct {
 }
 
 var keywords = map[string]TokenType{
-	"cap":    TokCap,
-	"budget": TokBudget,
-	"import": TokImport,
-	"as":     TokAs,
-	"let":    TokLet,
-	"return": TokReturn,
-	"do":     TokDo,
-	"assert": TokAssert,
-	"check":  TokCheck,
-	"true":   TokTrue,
-	"false":  TokFalse,
-	"null":   TokNull,
-	"if":     TokIf,
-	"else":   TokElse,
-	"for":    TokFor,
-	"fn":     TokFn,
-	"match":  TokMatch,
-	"try":    TokTry,
-	"catch":  TokCatch,
-	"filter": TokFilter,
-	"loop":   TokLoop,
+	"cap":         TokCap,
+	"budget":      TokBudget,
+	"import":      TokImport,
+	"as":          TokAs,
+	"let":         TokLet,
+	"return":      TokReturn,
+	"do":          TokDo,
+	"assert":      TokAssert,
+	"check":       TokCheck,
+	"true":        TokTrue,
+	"false":       TokFalse,
+	"null":        TokNull,
+	"if":          TokIf,
+	"else":        TokElse,
+	"for":         TokFor,
+	"fn":          TokFn,
+	"match":       TokMatch,
+	"try":         TokTry,
+	"catch":       TokCatch,
+	"filter":      TokFilter,
+	"loop":        TokLoop,
+	"export":      TokExport,
+	"ensure":      TokEnsure,
+	"transaction": TokTransaction,
 }
 
 type scanner struct {
@@ -419,6 +426,9 @@ func (s *scanner) nextToken() (Token, error) {
 	case '/':
 		s.advance()
 		return Token{Type: TokSlash, Value: "/", Span: s.span(startLine, startCol)}, nil
+	case '@':
+		s.advance()
+		return Token{Type: TokAt, Value: "@", Span: s.span(startLine, startCol)}, nil
 	}
 
 	// Multi-char tokens
@@ -72,6 +72,7 @@ func TestKeywords(t *testing.T) {
 		{"catch", TokCatch},
 		{"filter", TokFilter},
 		{"loop", TokLoop},
+		{"export", TokExport},
 	}
 
 	for _, tt := range tests {
@@ -797,7 +798,6 @@ func TestInvalidCharacter(t *testing.T) {
 		input string
 		char  string
 	}{
-		{"at sign", "@", "@"},
 		{"tilde", "~", "~"},
 		{"backtick", "`", "`"},
 		{"question mark", "?", "?"},
@@ -889,7 +889,7 @@ func TestUnterminatedStringEscapeAtEOF(t *testing.T) {
 
 func TestErrorSpanPosition(t *testing.T) {
 	// Error should include correct position
-	_, err := Tokenize("let x\n@", "test.a0")
+	_, err := Tokenize("let x\n~", "test.a0")
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -1552,7 +1552,7 @@ func TestEmojiInStrings(t *testing.T) {
 // Test: LexError implements error interface and has proper diagnostic
 // ---------------------------------------------------------------------------
 func TestLexErrorInterface(t *testing.T) {
-	_, err := Tokenize("@", "test.a0")
+	_, err := Tokenize("~", "test.a0")
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -1757,6 +1757,7 @@ func TestTokenTypesAreDistinct(t *testing.T) {
 		"TokCatch":    TokCatch,
 		"TokFilter":   TokFilter,
 		"TokLoop":     TokLoop,
+		"TokExport":   TokExport,
 		"TokIntLit":   TokIntLit,
 		"TokFloatLit": TokFloatLit,
 		"TokStringLit": TokStringLit,
@@ -1773,6 +1774,7 @@ func TestTokenTypesAreDistinct(t *testing.T) {
 		"TokDot":      TokDot,
 		"TokArrow":    TokArrow,
 		"TokEquals":   TokEquals,
+		"TokAt":       TokAt,
 		"TokGtEq":     TokGtEq,
 		"TokLtEq":     TokLtEq,
 		"TokEqEq":     TokEqEq,
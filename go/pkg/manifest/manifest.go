@@ -0,0 +1,102 @@
+// Package manifest loads a0.json project manifests.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileName is the manifest file looked up by the CLI.
+const FileName = "a0.json"
+
+// Manifest holds project-level defaults for the CLI. Relative paths are
+// resolved against the directory containing a0.json.
+type Manifest struct {
+	// Entry is the program a0 run executes when no file is given.
+	Entry string `json:"entry,omitempty"`
+	// ImportRoot is where bare import paths (not starting with "./" or
+	// "../") are resolved.
+	ImportRoot string      `json:"importRoot,omitempty"`
+	Run        RunDefaults `json:"run,omitempty"`
+	Fmt        FmtConfig   `json:"fmt,omitempty"`
+	Lint       LintConfig  `json:"lint,omitempty"`
+
+	dir string
+}
+
+// RunDefaults are the a0 run flags applied unless given on the command line.
+type RunDefaults struct {
+	Pretty   bool   `json:"pretty,omitempty"`
+	Evidence string `json:"evidence,omitempty"`
+	// EvidenceAppend appends each run to Evidence as one NDJSON line.
+	EvidenceAppend bool   `json:"evidenceAppend,omitempty"`
+	Trace          string `json:"trace,omitempty"`
+	// MaxOutput is the result size in bytes above which a0 run --pretty
+	// prints a summary instead of the JSON (see --max-output).
+	MaxOutput int `json:"maxOutput,omitempty"`
+}
+
+// FmtConfig configures a0 fmt.
+type FmtConfig struct {
+	// Indent is the number of spaces per nesting level (default 2).
+	Indent int `json:"indent,omitempty"`
+}
+
+// LintConfig configures the advisory warnings of a0 check.
+type LintConfig struct {
+	// Disable lists diagnostic codes of lint warnings to turn off, e.g.
+	// ["E_SHADOW"].
+	Disable []string `json:"disable,omitempty"`
+}
+
+// Find looks for a0.json in dir and its parents. It returns nil without an
+// error when no manifest exists.
+func Find(dir string) (*Manifest, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, FileName)
+		if _, err := os.Stat(path); err == nil {
+			return Load(path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads the manifest at path.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", path, err)
+	}
+	if m.Fmt.Indent < 0 {
+		return nil, fmt.Errorf("invalid %s: fmt.indent must not be negative", path)
+	}
+	m.dir = filepath.Dir(path)
+	return &m, nil
+}
+
+// Dir returns the directory containing the manifest.
+func (m *Manifest) Dir() string {
+	return m.dir
+}
+
+// Path resolves p against the manifest directory. Empty paths stay empty.
+func (m *Manifest) Path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(m.dir, p)
+}
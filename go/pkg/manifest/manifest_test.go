@@ -0,0 +1,142 @@
+package manifest_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/manifest"
+)
+
+func writeManifest(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, manifest.FileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind_FromNestedDirectory(t *testing.T) {
+	root := t.TempDir()
+	writeManifest(t, root, `{
+  "entry": "src/main.a0",
+  "importRoot": "lib",
+  "run": { "pretty": true, "trace": "out/trace.jsonl", "maxOutput": 100 },
+  "fmt": { "indent": 4 },
+  "lint": { "disable": ["E_SHADOW", "E_UNUSED_CAP"] }
+}`)
+	nested := filepath.Join(root, "src", "deep", "er")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := manifest.Find(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil {
+		t.Fatal("expected the manifest in an ancestor directory to be found")
+	}
+	if m.Dir() != root {
+		t.Errorf("Dir() = %q, want %q", m.Dir(), root)
+	}
+	if m.Entry != "src/main.a0" || m.ImportRoot != "lib" || m.Fmt.Indent != 4 {
+		t.Errorf("got %+v", m)
+	}
+	if !m.Run.Pretty || m.Run.Trace != "out/trace.jsonl" || m.Run.MaxOutput != 100 {
+		t.Errorf("run defaults = %+v", m.Run)
+	}
+	if want := []string{"E_SHADOW", "E_UNUSED_CAP"}; !reflect.DeepEqual(m.Lint.Disable, want) {
+		t.Errorf("Lint.Disable = %v, want %v", m.Lint.Disable, want)
+	}
+}
+
+func TestFind_NearestManifestWins(t *testing.T) {
+	root := t.TempDir()
+	writeManifest(t, root, `{"entry": "outer.a0"}`)
+	inner := filepath.Join(root, "inner")
+	if err := os.Mkdir(inner, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeManifest(t, inner, `{"entry": "inner.a0"}`)
+
+	m, err := manifest.Find(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Entry != "inner.a0" {
+		t.Errorf("expected the nearest manifest, got %+v", m)
+	}
+}
+
+func TestFind_NoManifest(t *testing.T) {
+	dir := t.TempDir()
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, manifest.FileName)); err == nil {
+			t.Skipf("%s has a manifest", d)
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	m, err := manifest.Find(dir)
+	if m != nil || err != nil {
+		t.Errorf("Find = %+v, %v; want nil, nil", m, err)
+	}
+}
+
+func TestLoad_Malformed(t *testing.T) {
+	for name, content := range map[string]string{
+		"invalid JSON":    `{"entry": "main.a0",}`,
+		"wrong type":      `{"lint": {"disable": "E_SHADOW"}}`,
+		"negative indent": `{"fmt": {"indent": -2}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeManifest(t, dir, content)
+			m, err := manifest.Find(dir)
+			if err == nil {
+				t.Fatalf("expected an error, got %+v", m)
+			}
+			if !strings.Contains(err.Error(), "invalid "+filepath.Join(dir, manifest.FileName)) {
+				t.Errorf("error should name the manifest, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPath_RelativeToManifest(t *testing.T) {
+	root := t.TempDir()
+	writeManifest(t, root, `{"entry": "src/main.a0"}`)
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The working directory does not matter, only where a0.json lives.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(sub); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	m, err := manifest.Find(".")
+	if err != nil || m == nil {
+		t.Fatalf("Find = %+v, %v", m, err)
+	}
+	abs := filepath.Join(t.TempDir(), "abs.a0")
+	for p, want := range map[string]string{
+		m.Entry:         filepath.Join(root, "src", "main.a0"),
+		"../up.a0":      filepath.Join(filepath.Dir(root), "up.a0"),
+		"./out/ev.json": filepath.Join(root, "out", "ev.json"),
+		abs:             abs,
+		"":              "",
+	} {
+		if got := m.Path(p); got != want {
+			t.Errorf("Path(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package metrics collects A0 run and tool-call statistics and exposes them in
+// the Prometheus text exposition format.
+//
+// There is no `a0 serve` command yet; a host that runs A0 programs behind its
+// own HTTP server mounts a Collector at /metrics, feeds it every run with
+// ObserveRun, and wraps its tool registry with ToolMiddleware:
+//
+//	c := metrics.New()
+//	reg := tools.NewRegistry()
+//	tools.RegisterDefaults(reg)
+//	reg.Use(c.ToolMiddleware())
+//	http.Handle("/metrics", c)
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/runtime"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// DefaultBuckets are the latency histogram bucket bounds, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector accumulates metrics. It is safe for concurrent use and
+// implements http.Handler.
+type Collector struct {
+	mu sync.Mutex
+
+	runs         map[string]uint64 // by outcome
+	runLatency   *histogram
+	toolCalls    map[[3]string]uint64 // tool, mode, outcome
+	toolLatency  map[string]*histogram
+	budgetsHit   uint64
+	evidenceFail map[string]uint64 // by kind
+}
+
+// New returns an empty Collector.
+func New() *Collector {
+	return &Collector{
+		runs:         make(map[string]uint64),
+		runLatency:   newHistogram(),
+		toolCalls:    make(map[[3]string]uint64),
+		toolLatency:  make(map[string]*histogram),
+		evidenceFail: make(map[string]uint64),
+	}
+}
+
+// ObserveRun records the outcome of one runtime.Run call. The outcome is
+// "ok", "failed" (completed with failed evidence) or "error".
+func (c *Collector) ObserveRun(res *runtime.Result, err error, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	outcome := "ok"
+	if res != nil {
+		for _, e := range res.Evidence {
+			if !e.OK {
+				c.evidenceFail[e.Kind]++
+				outcome = "failed"
+			}
+		}
+	}
+	if err != nil {
+		outcome = "error"
+		var rtErr *evaluator.A0RuntimeError
+		if errors.As(err, &rtErr) && rtErr.Code == diagnostics.EBudget {
+			c.budgetsHit++
+		}
+	}
+	c.runs[outcome]++
+	c.runLatency.observe(d.Seconds())
+}
+
+// ToolMiddleware returns registry middleware that counts and times every
+// tool call by name, mode and outcome.
+func (c *Collector) ToolMiddleware() tools.Middleware {
+	return func(tool tools.Def, next tools.ExecuteFunc) tools.ExecuteFunc {
+		return func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			start := time.Now()
+			result, err := next(ctx, args)
+			outcome := "ok"
+			if err != nil {
+				outcome = "error"
+			}
+
+			c.mu.Lock()
+			c.toolCalls[[3]string{tool.Name, tool.Mode, outcome}]++
+			h, ok := c.toolLatency[tool.Name]
+			if !ok {
+				h = newHistogram()
+				c.toolLatency[tool.Name] = h
+			}
+			h.observe(time.Since(start).Seconds())
+			c.mu.Unlock()
+			return result, err
+		}
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+	header(&b, "a0_runs_total", "counter", "A0 program runs by outcome.")
+	for _, outcome := range sortedKeys(c.runs) {
+		fmt.Fprintf(&b, "a0_runs_total{outcome=%q} %d\n", outcome, c.runs[outcome])
+	}
+
+	header(&b, "a0_run_duration_seconds", "histogram", "A0 program run latency.")
+	c.runLatency.write(&b, "a0_run_duration_seconds", "")
+
+	header(&b, "a0_budget_exhausted_total", "counter", "Runs stopped by an exhausted budget.")
+	fmt.Fprintf(&b, "a0_budget_exhausted_total %d\n", c.budgetsHit)
+
+	header(&b, "a0_evidence_failures_total", "counter", "Failed evidence entries by kind.")
+	for _, kind := range sortedKeys(c.evidenceFail) {
+		fmt.Fprintf(&b, "a0_evidence_failures_total{kind=%q} %d\n", kind, c.evidenceFail[kind])
+	}
+
+	header(&b, "a0_tool_calls_total", "counter", "Tool calls by tool, mode and outcome.")
+	calls := make([][3]string, 0, len(c.toolCalls))
+	for k := range c.toolCalls {
+		calls = append(calls, k)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return strings.Join(calls[i][:], "\x00") < strings.Join(calls[j][:], "\x00")
+	})
+	for _, k := range calls {
+		fmt.Fprintf(&b, "a0_tool_calls_total{tool=%q,mode=%q,outcome=%q} %d\n", k[0], k[1], k[2], c.toolCalls[k])
+	}
+
+	header(&b, "a0_tool_call_duration_seconds", "histogram", "Tool call latency by tool.")
+	for _, name := range sortedKeys(c.toolLatency) {
+		c.toolLatency[name].write(&b, "a0_tool_call_duration_seconds", fmt.Sprintf("tool=%q", name))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func header(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// histogram is a cumulative Prometheus-style histogram over DefaultBuckets.
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(DefaultBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range DefaultBuckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(b *strings.Builder, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, bound := range DefaultBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, bound, cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(b, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(b, "%s_count%s %d\n", name, labels, h.count)
+}
@@ -0,0 +1,108 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/metrics"
+	"github.com/thomasrohde/agent0/go/pkg/runtime"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+func exposition(t *testing.T, c *metrics.Collector) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func expectLines(t *testing.T, text string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, text)
+		}
+	}
+}
+
+func TestObserveRun(t *testing.T) {
+	// Durations are powers of two seconds so the _sum line is exact.
+	c := metrics.New()
+	c.ObserveRun(&runtime.Result{}, nil, time.Second/256)
+	c.ObserveRun(&runtime.Result{}, nil, time.Second/32)
+	c.ObserveRun(&runtime.Result{Evidence: []evaluator.Evidence{
+		{Kind: "assert", OK: true},
+		{Kind: "check", OK: false},
+		{Kind: "check", OK: false},
+	}}, nil, 3*time.Second)
+	c.ObserveRun(nil, &evaluator.A0RuntimeError{Code: diagnostics.EBudget, Message: "budget"}, 20*time.Second)
+	c.ObserveRun(nil, errors.New("boom"), time.Second/512)
+
+	text := exposition(t, c)
+	expectLines(t, text,
+		"# TYPE a0_runs_total counter",
+		`a0_runs_total{outcome="error"} 2`,
+		`a0_runs_total{outcome="failed"} 1`,
+		`a0_runs_total{outcome="ok"} 2`,
+		"a0_budget_exhausted_total 1",
+		`a0_evidence_failures_total{kind="check"} 2`,
+		"# TYPE a0_run_duration_seconds histogram",
+		// Buckets are cumulative: each counts every run at or below its bound.
+		`a0_run_duration_seconds_bucket{le="0.005"} 2`,
+		`a0_run_duration_seconds_bucket{le="0.01"} 2`,
+		`a0_run_duration_seconds_bucket{le="0.05"} 3`,
+		`a0_run_duration_seconds_bucket{le="2.5"} 3`,
+		`a0_run_duration_seconds_bucket{le="5"} 4`,
+		`a0_run_duration_seconds_bucket{le="10"} 4`,
+		`a0_run_duration_seconds_bucket{le="+Inf"} 5`,
+		"a0_run_duration_seconds_sum 23.037109375",
+		"a0_run_duration_seconds_count 5",
+	)
+	if strings.Contains(text, `kind="assert"`) {
+		t.Errorf("passing evidence should not be counted:\n%s", text)
+	}
+}
+
+func TestToolMiddleware(t *testing.T) {
+	c := metrics.New()
+	reg := tools.NewRegistry()
+	reg.Register(tools.Def{Name: "test.ok", Mode: "read", Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+		return evaluator.NewNull(), nil
+	}})
+	reg.Register(tools.Def{Name: "test.fail", Mode: "effect", Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+		return nil, errors.New("nope")
+	}})
+	reg.Use(c.ToolMiddleware())
+
+	args := &evaluator.A0Record{}
+	for i := 0; i < 3; i++ {
+		reg.Get("test.ok").Execute(context.Background(), args)
+	}
+	if _, err := reg.Get("test.fail").Execute(context.Background(), args); err == nil || err.Error() != "nope" {
+		t.Errorf("the middleware should pass the tool's error through, got %v", err)
+	}
+
+	text := exposition(t, c)
+	expectLines(t, text,
+		`a0_tool_calls_total{tool="test.fail",mode="effect",outcome="error"} 1`,
+		`a0_tool_calls_total{tool="test.ok",mode="read",outcome="ok"} 3`,
+		`a0_tool_call_duration_seconds_bucket{tool="test.ok",le="+Inf"} 3`,
+		`a0_tool_call_duration_seconds_count{tool="test.ok"} 3`,
+		`a0_tool_call_duration_seconds_count{tool="test.fail"} 1`,
+	)
+	// Instant calls land in the first bucket, and every later bucket
+	// includes them.
+	expectLines(t, text,
+		`a0_tool_call_duration_seconds_bucket{tool="test.ok",le="0.005"} 3`,
+		`a0_tool_call_duration_seconds_bucket{tool="test.ok",le="10"} 3`,
+	)
+}
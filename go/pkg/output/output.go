@@ -0,0 +1,129 @@
+// Package output renders the result of a0 run for the terminal: in full, as
+// a summary when it is too large to print, or into a file.
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// DefaultMaxOutput is the result size above which a0 run --pretty prints a
+// summary instead of the JSON.
+const DefaultMaxOutput = 64 * 1024
+
+// summaryItems is how many elements or keys a result summary shows, and
+// summaryItemBytes how much of each one's JSON.
+const (
+	summaryItems     = 5
+	summaryItemBytes = 120
+)
+
+// WriteResult prints v, whose JSON is data, to w. When limit is positive
+// and data is larger, it prints Summary(v) instead.
+func WriteResult(w io.Writer, v evaluator.A0Value, data []byte, limit int) {
+	if limit > 0 && len(data) > limit {
+		Summary(w, v, len(data), limit)
+		return
+	}
+	fmt.Fprintln(w, string(data))
+}
+
+// Summary describes a result too large to print: its type and length, then
+// its first elements (lists), keys (records) or bytes (strings), each cut
+// short.
+func Summary(w io.Writer, v evaluator.A0Value, size, limit int) {
+	fmt.Fprintf(w, "result is %s of JSON (over the %s output limit): ", FormatSize(size), FormatSize(limit))
+	switch val := v.(type) {
+	case evaluator.A0List:
+		fmt.Fprintf(w, "list of %s\n", plural(len(val.Items), "item"))
+		for i, item := range val.Items[:min(summaryItems, len(val.Items))] {
+			fmt.Fprintf(w, "  [%d] %s\n", i, clipJSON(item))
+		}
+		if len(val.Items) > summaryItems {
+			fmt.Fprintf(w, "  ... %d more\n", len(val.Items)-summaryItems)
+		}
+	case evaluator.A0Record:
+		fmt.Fprintf(w, "record with %s\n", plural(val.Len(), "key"))
+		for _, kv := range val.Pairs()[:min(summaryItems, val.Len())] {
+			if list, ok := kv.Value.(evaluator.A0List); ok {
+				fmt.Fprintf(w, "  %s: (%s) %s\n", kv.Key, plural(len(list.Items), "item"), clipJSON(kv.Value))
+				continue
+			}
+			fmt.Fprintf(w, "  %s: %s\n", kv.Key, clipJSON(kv.Value))
+		}
+		if val.Len() > summaryItems {
+			fmt.Fprintf(w, "  ... %d more\n", val.Len()-summaryItems)
+		}
+	case evaluator.A0String:
+		fmt.Fprintf(w, "string of %s\n  %s\n", plural(len(val.Value), "byte"), clipJSON(v))
+	default:
+		fmt.Fprintln(w, clipJSON(v))
+	}
+	fmt.Fprintln(w, "print it all with --full-output, pick a part with --select <path>, save it with --output-file <path>, or raise the limit with --max-output <bytes>")
+}
+
+// plural renders n followed by noun, adding an s unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// clipJSON renders v as JSON, cut to summaryItemBytes.
+func clipJSON(v evaluator.A0Value) string {
+	s := evaluator.ValueToJSONString(v)
+	if len(s) <= summaryItemBytes {
+		return s
+	}
+	n := summaryItemBytes
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// FormatSize renders a byte count for humans, e.g. 64 KB or 3.2 MB.
+func FormatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	case n == 1:
+		return "1 byte"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// WriteFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers never see a partly written file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".a0-output-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
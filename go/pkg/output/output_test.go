@@ -0,0 +1,130 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+func numbers(n int) evaluator.A0Value {
+	items := make([]evaluator.A0Value, n)
+	for i := range items {
+		items[i] = evaluator.NewNumber(float64(i))
+	}
+	return evaluator.NewList(items)
+}
+
+func TestWriteResult_Limit(t *testing.T) {
+	v := numbers(3)
+	data := []byte(evaluator.ValueToJSONString(v))
+
+	for _, limit := range []int{0, len(data)} {
+		var buf bytes.Buffer
+		WriteResult(&buf, v, data, limit)
+		if buf.String() != "[0,1,2]\n" {
+			t.Errorf("limit %d: got %q, want the full JSON", limit, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	WriteResult(&buf, v, data, len(data)-1)
+	if !strings.HasPrefix(buf.String(), "result is 7 bytes of JSON (over the 6 bytes output limit): list of 3 items\n") {
+		t.Errorf("over the limit: got %q, want a summary", buf.String())
+	}
+}
+
+func TestSummary_List(t *testing.T) {
+	var buf bytes.Buffer
+	Summary(&buf, numbers(7), 100000, 65536)
+	want := "result is 98 KB of JSON (over the 64 KB output limit): list of 7 items\n" +
+		"  [0] 0\n  [1] 1\n  [2] 2\n  [3] 3\n  [4] 4\n  ... 2 more\n" +
+		"print it all with --full-output, pick a part with --select <path>, save it with --output-file <path>, or raise the limit with --max-output <bytes>\n"
+	if buf.String() != want {
+		t.Errorf("Summary =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestSummary_RecordPluralizes(t *testing.T) {
+	var buf bytes.Buffer
+	Summary(&buf, evaluator.NewRecord([]evaluator.KeyValue{{Key: "rows", Value: numbers(1)}}), 10, 1)
+	if lines := strings.Split(buf.String(), "\n"); !strings.HasSuffix(lines[0], "record with 1 key") || lines[1] != "  rows: (1 item) [0]" {
+		t.Errorf("Summary of a one-key record =\n%s", buf.String())
+	}
+
+	buf.Reset()
+	pairs := make([]evaluator.KeyValue, 6)
+	for i := range pairs {
+		pairs[i] = evaluator.KeyValue{Key: string(rune('a' + i)), Value: numbers(2)}
+	}
+	Summary(&buf, evaluator.NewRecord(pairs), 10, 1)
+	out := buf.String()
+	for _, want := range []string{"record with 6 keys\n", "  a: (2 items) [0,1]\n", "  e: (2 items)", "  ... 1 more\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Summary is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "  f:") {
+		t.Errorf("Summary should stop after %d keys:\n%s", summaryItems, out)
+	}
+}
+
+func TestSummary_StringIsClipped(t *testing.T) {
+	var buf bytes.Buffer
+	Summary(&buf, evaluator.NewString(strings.Repeat("é", 100)), 202, 1)
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasSuffix(lines[0], "string of 200 bytes") {
+		t.Errorf("first line = %q", lines[0])
+	}
+	// The cut lands on a rune boundary at or before summaryItemBytes.
+	clipped := strings.TrimPrefix(lines[1], "  ")
+	if !strings.HasSuffix(clipped, "...") || len(clipped) > summaryItemBytes+3 || !strings.HasPrefix(clipped, `"éé`) {
+		t.Errorf("clipped string = %q", clipped)
+	}
+	if body := strings.TrimSuffix(clipped, "..."); !strings.HasSuffix(body, "é") {
+		t.Errorf("clip split a rune: %q", body)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int]string{
+		0:           "0 bytes",
+		1:           "1 byte",
+		1023:        "1023 bytes",
+		1024:        "1 KB",
+		64 * 1024:   "64 KB",
+		3355443:     "3.2 MB",
+		1024 * 1024: "1.0 MB",
+	} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.json")
+	os.WriteFile(path, []byte("old contents that are longer\n"), 0o600)
+
+	if err := WriteFileAtomic(path, []byte("{}\n")); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "{}\n" {
+		t.Errorf("file contains %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o644 {
+		t.Errorf("file mode = %v, want 0644", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, found %d entries", len(entries))
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "result.json"), []byte("{}")); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// VerboseLog is the trace sink behind a0 run --verbose. As each statement
+// finishes it writes a line to w with the statement's location, how long
+// it took and the tools it called itself, indented by nesting depth (a fn
+// body runs inside the statement calling it).
+type VerboseLog struct {
+	w    io.Writer
+	open map[string][]verboseStmt // open statements by run ID, innermost last
+}
+
+type verboseStmt struct {
+	span  string
+	start time.Time
+	tools []string
+}
+
+// NewVerboseLog returns a VerboseLog writing to w.
+func NewVerboseLog(w io.Writer) *VerboseLog {
+	return &VerboseLog{w: w, open: make(map[string][]verboseStmt)}
+}
+
+// Emit implements evaluator.TraceSink. The runtime serializes calls.
+func (l *VerboseLog) Emit(event evaluator.TraceEvent) {
+	stack := l.open[event.RunID]
+	switch event.Event {
+	case evaluator.TraceStmtStart:
+		if event.Span == nil {
+			return
+		}
+		start, _ := time.Parse(time.RFC3339Nano, event.Timestamp)
+		l.open[event.RunID] = append(stack, verboseStmt{span: spanKey(event), start: start})
+	case evaluator.TraceToolStart:
+		if len(stack) == 0 || event.Data == nil {
+			return
+		}
+		if name, ok := event.Data.Get("tool"); ok {
+			if s, ok := name.(evaluator.A0String); ok {
+				stack[len(stack)-1].tools = append(stack[len(stack)-1].tools, s.Value)
+			}
+		}
+	case evaluator.TraceStmtEnd:
+		if event.Span == nil {
+			return
+		}
+		key := spanKey(event)
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].span != key {
+				continue
+			}
+			end, _ := time.Parse(time.RFC3339Nano, event.Timestamp)
+			line := fmt.Sprintf("%s%s  %.2fms", strings.Repeat("  ", i), key, float64(end.Sub(stack[i].start).Microseconds())/1000)
+			if len(stack[i].tools) > 0 {
+				line += "  tools: " + strings.Join(stack[i].tools, ", ")
+			}
+			fmt.Fprintln(l.w, line)
+			l.open[event.RunID] = stack[:i]
+			return
+		}
+	case evaluator.TraceRunEnd:
+		delete(l.open, event.RunID)
+	}
+}
+
+// Flush does nothing; lines are written as statements finish.
+func (l *VerboseLog) Flush() error { return nil }
+
+// Close does nothing.
+func (l *VerboseLog) Close() error { return nil }
+
+// spanKey identifies a statement by where it starts, as file:line:col.
+func spanKey(event evaluator.TraceEvent) string {
+	return fmt.Sprintf("%s:%d:%d", event.Span.File, event.Span.StartLine, event.Span.StartCol)
+}
@@ -0,0 +1,61 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+func TestVerboseLog_TimesStatementsAndTools(t *testing.T) {
+	base := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(ms float64) string {
+		return base.Add(time.Duration(ms * float64(time.Millisecond))).Format(time.RFC3339Nano)
+	}
+	stmt := func(line int) *ast.Span { return &ast.Span{File: "main.a0", StartLine: line, StartCol: 1} }
+	tool := func(name string) *evaluator.A0Record {
+		rec := evaluator.NewRecord([]evaluator.KeyValue{{Key: "tool", Value: evaluator.NewString(name)}}).(evaluator.A0Record)
+		return &rec
+	}
+
+	var buf bytes.Buffer
+	l := NewVerboseLog(&buf)
+	for _, e := range []evaluator.TraceEvent{
+		{Event: evaluator.TraceStmtStart, Span: stmt(1), Timestamp: at(0)},
+		{Event: evaluator.TraceToolStart, Data: tool("fs.read"), Timestamp: at(1)},
+		{Event: evaluator.TraceStmtEnd, Span: stmt(1), Timestamp: at(2.5)},
+		{Event: evaluator.TraceStmtStart, Span: stmt(2), Timestamp: at(3)},
+		// Line 5 is a fn body statement running inside line 2.
+		{Event: evaluator.TraceStmtStart, Span: stmt(5), Timestamp: at(4)},
+		{Event: evaluator.TraceToolStart, Data: tool("http.get"), Timestamp: at(4)},
+		{Event: evaluator.TraceToolStart, Data: tool("kv.get"), Timestamp: at(5)},
+		{Event: evaluator.TraceStmtEnd, Span: stmt(5), Timestamp: at(14)},
+		{Event: evaluator.TraceStmtEnd, Span: stmt(2), Timestamp: at(15)},
+		{Event: evaluator.TraceRunEnd, Timestamp: at(16)},
+	} {
+		l.Emit(e)
+	}
+
+	want := "main.a0:1:1  2.50ms  tools: fs.read\n" +
+		"  main.a0:5:1  10.00ms  tools: http.get, kv.get\n" +
+		"main.a0:2:1  12.00ms\n"
+	if buf.String() != want {
+		t.Errorf("verbose log =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestVerboseLog_SeparatesRuns(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewVerboseLog(&buf)
+	span := &ast.Span{File: "a.a0", StartLine: 1, StartCol: 1}
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	l.Emit(evaluator.TraceEvent{RunID: "r1", Event: evaluator.TraceStmtStart, Span: span, Timestamp: ts})
+	l.Emit(evaluator.TraceEvent{RunID: "r2", Event: evaluator.TraceStmtStart, Span: span, Timestamp: ts})
+	l.Emit(evaluator.TraceEvent{RunID: "r2", Event: evaluator.TraceStmtEnd, Span: span, Timestamp: ts})
+	l.Emit(evaluator.TraceEvent{RunID: "r1", Event: evaluator.TraceStmtEnd, Span: span, Timestamp: ts})
+	if buf.String() != "a.a0:1:1  0.00ms\na.a0:1:1  0.00ms\n" {
+		t.Errorf("parallel runs should not nest into each other:\n%s", buf.String())
+	}
+}
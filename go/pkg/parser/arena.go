@@ -0,0 +1,50 @@
+package parser
+
+import "github.com/thomasrohde/agent0/go/pkg/ast"
+
+// slabSize is how many nodes of one type a slab allocates at a time.
+const slabSize = 64
+
+// slab hands out pointers into chunks of T, so a parse makes one heap
+// allocation per slabSize nodes instead of one per node. A chunk lives as
+// long as any node in it, which is the lifetime of the AST anyway.
+type slab[T any] struct {
+	free []T
+}
+
+func (s *slab[T]) alloc() *T {
+	if len(s.free) == 0 {
+		s.free = make([]T, slabSize)
+	}
+	n := &s.free[0]
+	s.free = s.free[1:]
+	return n
+}
+
+// nodeArena holds the slabs for the node types a typical program has most
+// of. Rarer nodes are allocated individually.
+type nodeArena struct {
+	lets     slab[ast.LetStmt]
+	exprs    slab[ast.ExprStmt]
+	paths    slab[ast.IdentPath]
+	calls    slab[ast.FnCallExpr]
+	binaries slab[ast.BinaryExpr]
+	pairs    slab[ast.RecordPair]
+	ints     slab[ast.IntLiteral]
+	floats   slab[ast.FloatLiteral]
+	strs     slab[ast.StrLiteral]
+	parts    []string
+}
+
+// onePart returns a one-element slice for an identifier path, carved from a
+// shared backing array. Its capacity is 1, so appending a second part
+// copies it rather than overwriting the next path's.
+func (a *nodeArena) onePart(s string) []string {
+	if len(a.parts) == 0 {
+		a.parts = make([]string, slabSize)
+	}
+	a.parts[0] = s
+	part := a.parts[0:1:1]
+	a.parts = a.parts[1:]
+	return part
+}
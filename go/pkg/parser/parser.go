@@ -15,6 +15,7 @@ type parser struct {
 	tokens []lexer.Token
 	pos    int
 	diags  []diagnostics.Diagnostic
+	arena  nodeArena
 }
 
 // Parse tokenizes source and parses it into an AST.
@@ -65,7 +66,8 @@ func (p *parser) advance() lexer.Token {
 func (p *parser) expect(typ lexer.TokenType) (lexer.Token, bool) {
 	tok := p.current()
 	if tok.Type != typ {
-		p.addError(fmt.Sprintf("expected %s, got '%s'", tokenName(typ), tok.Value), &tok.Span)
+		span := tok.Span // copied so tok itself stays off the heap
+		p.addError(fmt.Sprintf("expected %s, got '%s'", tokenName(typ), tok.Value), &span)
 		return tok, false
 	}
 	return p.advance(), true
@@ -133,7 +135,7 @@ func tokenName(t lexer.TokenType) string {
 
 // isKeyword returns true if the token type is a keyword.
 func isKeyword(t lexer.TokenType) bool {
-	return t >= lexer.TokCap && t <= lexer.TokLoop
+	return t >= lexer.TokCap && t <= lexer.TokTransaction
 }
 
 // isRecordKey returns true if the token can be used as a record key.
@@ -149,8 +151,16 @@ func (p *parser) parseProgram(filename string) *ast.Program {
 	var headers []ast.Header
 	var stmts []ast.Stmt
 
-	// Parse headers (cap, budget, import at top level)
+	// Parse headers (cap, budget, import, meta at top level)
 	for p.peek() != lexer.TokEOF {
+		if cur := p.current(); cur.Type == lexer.TokIdent && cur.Value == "meta" && p.peekAt(1) == lexer.TokLBrace {
+			h := p.parseMetaDecl()
+			if h == nil {
+				return nil
+			}
+			headers = append(headers, h)
+			continue
+		}
 		switch p.peek() {
 		case lexer.TokCap:
 			h := p.parseCapDecl()
@@ -177,7 +187,12 @@ func (p *parser) parseProgram(filename string) *ast.Program {
 
 parseStmts:
 	for p.peek() != lexer.TokEOF {
-		stmt := p.parseStmt()
+		var stmt ast.Stmt
+		if p.peek() == lexer.TokExport {
+			stmt = p.parseExport()
+		} else {
+			stmt = p.parseStmt()
+		}
 		if stmt == nil {
 			return nil
 		}
@@ -217,6 +232,18 @@ func (p *parser) parseBudgetDecl() *ast.BudgetDecl {
 	}
 }
 
+func (p *parser) parseMetaDecl() *ast.MetaDecl {
+	start := p.advance() // consume 'meta'
+	rec := p.parseRecordExpr()
+	if rec == nil {
+		return nil
+	}
+	return &ast.MetaDecl{
+		Span:   p.spanFromTo(start.Span, rec.Span),
+		Fields: rec,
+	}
+}
+
 func (p *parser) parseImportDecl() *ast.ImportDecl {
 	start := p.advance() // consume 'import'
 	pathTok, ok := p.expect(lexer.TokStringLit)
@@ -230,11 +257,21 @@ func (p *parser) parseImportDecl() *ast.ImportDecl {
 	if !ok {
 		return nil
 	}
-	return &ast.ImportDecl{
+	decl := &ast.ImportDecl{
 		Span:  p.spanFromTo(start.Span, aliasTok.Span),
 		Path:  pathTok.Value,
 		Alias: aliasTok.Value,
 	}
+	if p.peek() == lexer.TokBudget {
+		p.advance() // consume 'budget'
+		rec := p.parseRecordExpr()
+		if rec == nil {
+			return nil
+		}
+		decl.Budget = rec
+		decl.Span = p.spanFromTo(start.Span, rec.Span)
+	}
+	return decl
 }
 
 // --- Statements ---
@@ -253,12 +290,24 @@ func (p *parser) parseStmt() ast.Stmt {
 			return nil
 		}
 		return s
+	case lexer.TokEnsure:
+		s := p.parseEnsureStmt()
+		if s == nil {
+			return nil
+		}
+		return s
 	case lexer.TokFn:
 		s := p.parseFnDecl()
 		if s == nil {
 			return nil
 		}
 		return s
+	case lexer.TokAt:
+		s := p.parseAnnotatedFnDecl()
+		if s == nil {
+			return nil
+		}
+		return s
 	default:
 		s := p.parseExprStmt()
 		if s == nil {
@@ -281,11 +330,13 @@ func (p *parser) parseLetStmt() *ast.LetStmt {
 	if value == nil {
 		return nil
 	}
-	return &ast.LetStmt{
+	let := p.arena.lets.alloc()
+	*let = ast.LetStmt{
 		Span:  p.spanFromTo(start.Span, value.NodeSpan()),
 		Name:  nameTok.Value,
 		Value: value,
 	}
+	return let
 }
 
 func (p *parser) parseReturnStmt() *ast.ReturnStmt {
@@ -300,6 +351,45 @@ func (p *parser) parseReturnStmt() *ast.ReturnStmt {
 	}
 }
 
+func (p *parser) parseEnsureStmt() *ast.EnsureStmt {
+	start := p.advance() // consume 'ensure'
+	rec := p.parseRecordExpr()
+	if rec == nil {
+		return nil
+	}
+
+	var that, elseExpr ast.Expr
+	for _, entry := range rec.Pairs {
+		pair, ok := entry.(*ast.RecordPair)
+		if !ok {
+			span := entry.NodeSpan()
+			p.addError("ensure does not accept spread entries", &span)
+			return nil
+		}
+		switch pair.Key {
+		case "that":
+			that = pair.Value
+		case "else":
+			elseExpr = pair.Value
+		default:
+			span := pair.Span
+			p.addError(fmt.Sprintf("unknown ensure field '%s'; expected 'that' or 'else'", pair.Key), &span)
+			return nil
+		}
+	}
+	if that == nil {
+		span := rec.Span
+		p.addError("ensure requires a 'that' condition", &span)
+		return nil
+	}
+
+	return &ast.EnsureStmt{
+		Span: p.spanFromTo(start.Span, rec.Span),
+		That: that,
+		Else: elseExpr,
+	}
+}
+
 func (p *parser) parseFnDecl() *ast.FnDecl {
 	start := p.advance() // consume 'fn'
 	nameTok, ok := p.expect(lexer.TokIdent)
@@ -345,6 +435,103 @@ func (p *parser) parseFnDecl() *ast.FnDecl {
 	}
 }
 
+// parseAnnotatedFnDecl parses a fn declaration preceded by annotations:
+// @deprecated "message", which marks the fn so the validator warns where it
+// is called, and @memo, which caches the fn's results by its arguments.
+// Each may appear once, in either order.
+func (p *parser) parseAnnotatedFnDecl() *ast.FnDecl {
+	start := p.current()
+	var msg string
+	seen := map[string]bool{}
+	for p.peek() == lexer.TokAt {
+		p.advance() // consume '@'
+		nameTok, ok := p.expect(lexer.TokIdent)
+		if !ok {
+			return nil
+		}
+		if seen[nameTok.Value] {
+			p.addError(fmt.Sprintf("duplicate annotation '@%s'", nameTok.Value), &nameTok.Span)
+			return nil
+		}
+		seen[nameTok.Value] = true
+		switch nameTok.Value {
+		case "deprecated":
+			if p.peek() != lexer.TokStringLit {
+				span := p.current().Span
+				p.addError("expected a message after @deprecated, e.g. @deprecated \"use y instead\"", &span)
+				return nil
+			}
+			msg = p.advance().Value
+		case "memo":
+		default:
+			p.addError(fmt.Sprintf("unknown annotation '@%s'; annotations are @deprecated and @memo", nameTok.Value), &nameTok.Span)
+			return nil
+		}
+	}
+
+	var fn *ast.FnDecl
+	switch p.peek() {
+	case lexer.TokFn:
+		fn = p.parseFnDecl()
+	case lexer.TokExport:
+		if exported, isFn := p.parseExport().(*ast.FnDecl); isFn {
+			fn = exported
+		}
+	default:
+		span := p.current().Span
+		p.addError("expected 'fn' or 'export fn' after an annotation", &span)
+		return nil
+	}
+	if fn == nil {
+		return nil
+	}
+	fn.Span = p.spanFromTo(start.Span, fn.Span)
+	fn.Deprecated = msg
+	fn.Memo = seen["memo"]
+	return fn
+}
+
+// parseExport parses "export fn name { ... } { ... }" or an
+// "export { a, b }" footer. Exports are only valid at the top level.
+func (p *parser) parseExport() ast.Stmt {
+	start := p.advance() // consume 'export'
+	switch p.peek() {
+	case lexer.TokFn:
+		fn := p.parseFnDecl()
+		if fn == nil {
+			return nil
+		}
+		fn.Span = p.spanFromTo(start.Span, fn.Span)
+		fn.Exported = true
+		return fn
+	case lexer.TokLBrace:
+		p.advance()
+		var names []string
+		for p.peek() != lexer.TokRBrace && p.peek() != lexer.TokEOF {
+			nameTok, ok := p.expect(lexer.TokIdent)
+			if !ok {
+				return nil
+			}
+			names = append(names, nameTok.Value)
+			if p.peek() == lexer.TokComma {
+				p.advance()
+			}
+		}
+		end, ok := p.expect(lexer.TokRBrace)
+		if !ok {
+			return nil
+		}
+		return &ast.ExportDecl{
+			Span:  p.spanFromTo(start.Span, end.Span),
+			Names: names,
+		}
+	default:
+		span := p.current().Span
+		p.addError("expected 'fn' or '{' after 'export'", &span)
+		return nil
+	}
+}
+
 func (p *parser) parseExprStmt() *ast.ExprStmt {
 	expr := p.parseExpr()
 	if expr == nil {
@@ -363,11 +550,13 @@ func (p *parser) parseExprStmt() *ast.ExprStmt {
 		endSpan = ip.Span
 	}
 
-	return &ast.ExprStmt{
+	stmt := p.arena.exprs.alloc()
+	*stmt = ast.ExprStmt{
 		Span:   p.spanFromTo(expr.NodeSpan(), endSpan),
 		Expr:   expr,
 		Target: target,
 	}
+	return stmt
 }
 
 // --- Block ---
@@ -408,6 +597,8 @@ func (p *parser) parseExpr() ast.Expr {
 		return p.parseAssertExpr()
 	case lexer.TokCheck:
 		return p.parseCheckExpr()
+	case lexer.TokTransaction:
+		return p.parseTransactionExpr()
 	case lexer.TokTry:
 		return p.parseTryExpr()
 	case lexer.TokFilter:
@@ -589,9 +780,20 @@ func (p *parser) parseMatchSubject() ast.Expr {
 	}
 }
 
+// typeMatchTags maps the arm names match type accepts to typeof names.
+var typeMatchTags = map[string]string{
+	"null": "null", "bool": "boolean", "boolean": "boolean",
+	"num": "number", "number": "number", "str": "string", "string": "string",
+	"list": "list", "rec": "record", "record": "record", "_": "_",
+}
+
 func (p *parser) parseMatch() ast.Expr {
 	start := p.advance() // consume 'match'
 
+	if cur := p.current(); cur.Type == lexer.TokIdent && cur.Value == "type" && p.peekAt(1) == lexer.TokLParen {
+		return p.parseTypeMatch(start)
+	}
+
 	// Parse match subject as an ident path only (not a full expr that would
 	// greedily consume the following '{' as a function call).
 	subject := p.parseMatchSubject()
@@ -661,6 +863,71 @@ func (p *parser) parseMatch() ast.Expr {
 	}
 }
 
+// parseTypeMatch parses the rest of match type (subject) { arms }, after
+// 'match'. Each arm is a type name, an optional binding and a block.
+func (p *parser) parseTypeMatch(start lexer.Token) ast.Expr {
+	p.advance() // consume 'type'
+	p.advance() // consume '('
+	subject := p.parseExpr()
+	if subject == nil {
+		return nil
+	}
+	if _, ok := p.expect(lexer.TokRParen); !ok {
+		return nil
+	}
+	if _, ok := p.expect(lexer.TokLBrace); !ok {
+		return nil
+	}
+
+	var arms []*ast.MatchArm
+	seen := make(map[string]bool)
+	for p.peek() != lexer.TokRBrace && p.peek() != lexer.TokEOF {
+		tag := p.current()
+		typ, known := typeMatchTags[tag.Value]
+		if !known || (tag.Type != lexer.TokIdent && tag.Type != lexer.TokNull) {
+			p.addError(fmt.Sprintf("expected a type in match type arm (null, bool, num, str, list, rec or _), got '%s'", tag.Value), &tag.Span)
+			return nil
+		}
+		if seen[typ] {
+			p.addError(fmt.Sprintf("duplicate match type arm '%s'", tag.Value), &tag.Span)
+			return nil
+		}
+		seen[typ] = true
+		p.advance()
+
+		var bindingName string
+		if p.peek() == lexer.TokIdent {
+			bindingName = p.advance().Value
+		}
+
+		body := p.parseBlock()
+		if body == nil {
+			return nil
+		}
+		arms = append(arms, &ast.MatchArm{
+			Span:    p.spanFromTo(tag.Span, p.current().Span),
+			Tag:     typ,
+			Binding: bindingName,
+			Body:    body,
+		})
+	}
+
+	if _, ok := p.expect(lexer.TokRBrace); !ok {
+		return nil
+	}
+	if len(arms) == 0 {
+		span := p.spanFromTo(start.Span, p.current().Span)
+		p.addError("match type requires at least one arm", &span)
+		return nil
+	}
+
+	return &ast.TypeMatchExpr{
+		Span:    p.spanFromTo(start.Span, p.current().Span),
+		Subject: subject,
+		Arms:    arms,
+	}
+}
+
 func (p *parser) parseCallExpr() ast.Expr {
 	start := p.advance() // consume 'call?'
 	tool := p.parseIdentPath()
@@ -697,13 +964,25 @@ func (p *parser) parseDoExpr() ast.Expr {
 
 func (p *parser) parseAssertExpr() ast.Expr {
 	start := p.advance() // consume 'assert'
+	approx := false
+	if p.peek() == lexer.TokDot {
+		p.advance() // consume '.'
+		form := p.current()
+		if form.Type != lexer.TokIdent || form.Value != "approx" {
+			p.addError(fmt.Sprintf("unknown assert form 'assert.%s'; expected assert.approx", form.Value), &form.Span)
+			return nil
+		}
+		p.advance()
+		approx = true
+	}
 	args := p.parseRecordExpr()
 	if args == nil {
 		return nil
 	}
 	return &ast.AssertExpr{
-		Span: p.spanFromTo(start.Span, args.Span),
-		Args: args,
+		Span:   p.spanFromTo(start.Span, args.Span),
+		Args:   args,
+		Approx: approx,
 	}
 }
 
@@ -719,6 +998,18 @@ func (p *parser) parseCheckExpr() ast.Expr {
 	}
 }
 
+func (p *parser) parseTransactionExpr() ast.Expr {
+	start := p.advance() // consume 'transaction'
+	body := p.parseBlock()
+	if body == nil {
+		return nil
+	}
+	return &ast.TransactionExpr{
+		Span: p.spanFromTo(start.Span, p.current().Span),
+		Body: body,
+	}
+}
+
 func (p *parser) parseTryExpr() ast.Expr {
 	start := p.advance() // consume 'try'
 	tryBody := p.parseBlock()
@@ -820,6 +1111,43 @@ func (p *parser) parseFilter() ast.Expr {
 	}
 }
 
+func (p *parser) parseFindBlock(name *ast.IdentPath, rec *ast.RecordExpr) ast.Expr {
+	var listExpr ast.Expr
+	var binding string
+	for _, entry := range rec.Pairs {
+		pair, ok := entry.(*ast.RecordPair)
+		if !ok {
+			continue
+		}
+		switch pair.Key {
+		case "in":
+			listExpr = pair.Value
+		case "as":
+			if strLit, ok := pair.Value.(*ast.StrLiteral); ok {
+				binding = strLit.Value
+			}
+		}
+	}
+
+	if listExpr == nil {
+		span := rec.Span
+		p.addError("find block requires 'in' field", &span)
+		return nil
+	}
+
+	body := p.parseBlock()
+	if body == nil {
+		return nil
+	}
+
+	return &ast.FindBlockExpr{
+		Span:    p.spanFromTo(name.Span, p.current().Span),
+		List:    listExpr,
+		Binding: binding,
+		Body:    body,
+	}
+}
+
 func (p *parser) parseLoop() ast.Expr {
 	start := p.advance() // consume 'loop'
 
@@ -892,12 +1220,14 @@ func (p *parser) parseComparison() ast.Expr {
 		if right == nil {
 			return nil
 		}
-		left = &ast.BinaryExpr{
+		bin := p.arena.binaries.alloc()
+		*bin = ast.BinaryExpr{
 			Span:  p.spanFromTo(left.NodeSpan(), right.NodeSpan()),
 			Op:    op,
 			Left:  left,
 			Right: right,
 		}
+		left = bin
 	}
 }
 
@@ -922,12 +1252,14 @@ func (p *parser) parseAdditive() ast.Expr {
 		if right == nil {
 			return nil
 		}
-		left = &ast.BinaryExpr{
+		bin := p.arena.binaries.alloc()
+		*bin = ast.BinaryExpr{
 			Span:  p.spanFromTo(left.NodeSpan(), right.NodeSpan()),
 			Op:    op,
 			Left:  left,
 			Right: right,
 		}
+		left = bin
 	}
 }
 
@@ -954,12 +1286,14 @@ func (p *parser) parseMultiplicative() ast.Expr {
 		if right == nil {
 			return nil
 		}
-		left = &ast.BinaryExpr{
+		bin := p.arena.binaries.alloc()
+		*bin = ast.BinaryExpr{
 			Span:  p.spanFromTo(left.NodeSpan(), right.NodeSpan()),
 			Op:    op,
 			Left:  left,
 			Right: right,
 		}
+		left = bin
 	}
 }
 
@@ -976,7 +1310,36 @@ func (p *parser) parseUnary() ast.Expr {
 			Operand: operand,
 		}
 	}
-	return p.parsePrimary()
+	return p.parsePostfix()
+}
+
+// parsePostfix parses a primary followed by any index suffixes. A '[' only
+// indexes when it directly follows the previous token; after whitespace it
+// starts a list literal, e.g. a new statement on the next line.
+func (p *parser) parsePostfix() ast.Expr {
+	expr := p.parsePrimary()
+	for expr != nil && p.peek() == lexer.TokLBracket && p.pos > 0 {
+		prev := p.tokens[p.pos-1].Span
+		lb := p.current().Span
+		if prev.EndLine != lb.StartLine || prev.EndCol != lb.StartCol {
+			break
+		}
+		p.advance()
+		index := p.parseExpr()
+		if index == nil {
+			return nil
+		}
+		end, ok := p.expect(lexer.TokRBracket)
+		if !ok {
+			return nil
+		}
+		expr = &ast.IndexExpr{
+			Span:   p.spanFromTo(expr.NodeSpan(), end.Span),
+			Target: expr,
+			Index:  index,
+		}
+	}
+	return expr
 }
 
 func (p *parser) parsePrimary() ast.Expr {
@@ -1011,16 +1374,26 @@ func (p *parser) parsePrimary() ast.Expr {
 	case lexer.TokIntLit:
 		tok := p.advance()
 		val, _ := strconv.ParseInt(tok.Value, 10, 64)
-		return &ast.IntLiteral{Span: tok.Span, Value: val}
+		lit := p.arena.ints.alloc()
+		*lit = ast.IntLiteral{Span: tok.Span, Value: val}
+		return lit
 
 	case lexer.TokFloatLit:
 		tok := p.advance()
-		val, _ := strconv.ParseFloat(tok.Value, 64)
-		return &ast.FloatLiteral{Span: tok.Span, Value: val}
+		val, err := strconv.ParseFloat(tok.Value, 64)
+		if err != nil {
+			p.addError(fmt.Sprintf("number literal %s is out of range", tok.Value), &tok.Span)
+			return nil
+		}
+		lit := p.arena.floats.alloc()
+		*lit = ast.FloatLiteral{Span: tok.Span, Value: val}
+		return lit
 
 	case lexer.TokStringLit:
 		tok := p.advance()
-		return &ast.StrLiteral{Span: tok.Span, Value: tok.Value}
+		lit := p.arena.strs.alloc()
+		*lit = ast.StrLiteral{Span: tok.Span, Value: tok.Value}
+		return lit
 
 	case lexer.TokTrue:
 		tok := p.advance()
@@ -1056,11 +1429,17 @@ func (p *parser) parseIdentOrFnCall() ast.Expr {
 		if args == nil {
 			return nil
 		}
-		return &ast.FnCallExpr{
+		// find { in, as } { body } is the block form of the find stdlib call
+		if len(ip.Parts) == 1 && ip.Parts[0] == "find" && p.peek() == lexer.TokLBrace {
+			return p.parseFindBlock(ip, args)
+		}
+		call := p.arena.calls.alloc()
+		*call = ast.FnCallExpr{
 			Span: p.spanFromTo(ip.Span, args.Span),
 			Name: ip,
 			Args: args,
 		}
+		return call
 	}
 
 	return ip
@@ -1071,7 +1450,7 @@ func (p *parser) parseIdentPath() *ast.IdentPath {
 	if !ok {
 		return nil
 	}
-	parts := []string{tok.Value}
+	parts := p.arena.onePart(tok.Value)
 	endSpan := tok.Span
 
 	for p.peek() == lexer.TokDot {
@@ -1087,10 +1466,12 @@ func (p *parser) parseIdentPath() *ast.IdentPath {
 		}
 	}
 
-	return &ast.IdentPath{
+	ip := p.arena.paths.alloc()
+	*ip = ast.IdentPath{
 		Span:  p.spanFromTo(tok.Span, endSpan),
 		Parts: parts,
 	}
+	return ip
 }
 
 func (p *parser) parseRecordExpr() *ast.RecordExpr {
@@ -1140,11 +1521,13 @@ func (p *parser) parseRecordExpr() *ast.RecordExpr {
 				return nil
 			}
 
-			entries = append(entries, &ast.RecordPair{
+			pair := p.arena.pairs.alloc()
+			*pair = ast.RecordPair{
 				Span:  p.spanFromTo(keyTok.Span, value.NodeSpan()),
 				Key:   key,
 				Value: value,
-			})
+			}
+			entries = append(entries, pair)
 		} else {
 			tok := p.current()
 			p.addError(fmt.Sprintf("unexpected token '%s' in record", tok.Value), &tok.Span)
@@ -113,6 +113,10 @@ func TestFloatLiteral(t *testing.T) {
 	}
 }
 
+func TestFloatLiteral_OutOfRange(t *testing.T) {
+	mustFail(t, "return 1e999")
+}
+
 func TestStringLiteral(t *testing.T) {
 	tests := []struct {
 		source string
@@ -824,8 +828,45 @@ return null`
 	}
 }
 
+func TestTypeMatchExpr(t *testing.T) {
+	src := `let x = 1
+let out = match type (x) {
+  str s { return s }
+  num { return x }
+  _ { return null }
+}
+return out`
+	prog := mustParse(t, src)
+	tm, ok := prog.Statements[1].(*ast.LetStmt).Value.(*ast.TypeMatchExpr)
+	if !ok {
+		t.Fatalf("expected TypeMatchExpr, got %T", prog.Statements[1].(*ast.LetStmt).Value)
+	}
+	if len(tm.Arms) != 3 || tm.Arms[0].Tag != "string" || tm.Arms[0].Binding != "s" || tm.Arms[1].Tag != "number" || tm.Arms[2].Tag != "_" {
+		t.Errorf("unexpected arms %+v", tm.Arms)
+	}
+
+	mustFail(t, `return match type (1) { text { return 1 } }`)
+	mustFail(t, `return match type (1) { num { return 1 } number { return 2 } }`)
+}
+
 // ---- 11. Try/Catch ----
 
+func TestTransactionExpr(t *testing.T) {
+	src := `transaction {
+  do fs.write { path: "a.txt", data: "a" }
+  return null
+}
+return null`
+	prog := mustParse(t, src)
+	tx, ok := prog.Statements[0].(*ast.ExprStmt).Expr.(*ast.TransactionExpr)
+	if !ok {
+		t.Fatalf("expected TransactionExpr, got %T", prog.Statements[0].(*ast.ExprStmt).Expr)
+	}
+	if len(tx.Body) != 2 {
+		t.Errorf("expected 2 body stmts, got %d", len(tx.Body))
+	}
+}
+
 func TestTryCatch(t *testing.T) {
 	src := `try {
   return 1
@@ -930,6 +971,53 @@ return null`
 	}
 }
 
+func TestFindBlock(t *testing.T) {
+	src := `let items = [1, 2, 3]
+let big = find { in: items, as: "x" } {
+  return x > 1
+}
+let rec = find { in: items, key: "id", value: 2 }
+return big`
+	prog := mustParse(t, src)
+	let := prog.Statements[1].(*ast.LetStmt)
+	findExpr, ok := let.Value.(*ast.FindBlockExpr)
+	if !ok {
+		t.Fatalf("expected FindBlockExpr, got %T", let.Value)
+	}
+	if findExpr.Binding != "x" || len(findExpr.Body) != 1 {
+		t.Errorf("unexpected find block: binding %q, %d body stmts", findExpr.Binding, len(findExpr.Body))
+	}
+	if _, ok := prog.Statements[2].(*ast.LetStmt).Value.(*ast.FnCallExpr); !ok {
+		t.Errorf("expected find without a block to stay a stdlib call")
+	}
+}
+
+func TestEnsureStmt(t *testing.T) {
+	src := `fn bounded { x } {
+  ensure { that: x > 0, else: "not positive" }
+  ensure { that: x < 10 }
+  return "ok"
+}
+return bounded { x: 5 }`
+	prog := mustParse(t, src)
+	fn := prog.Statements[0].(*ast.FnDecl)
+	first, ok := fn.Body[0].(*ast.EnsureStmt)
+	if !ok {
+		t.Fatalf("expected EnsureStmt, got %T", fn.Body[0])
+	}
+	if first.That == nil || first.Else == nil {
+		t.Errorf("expected that and else, got %+v", first)
+	}
+	if second := fn.Body[1].(*ast.EnsureStmt); second.Else != nil {
+		t.Errorf("expected no else, got %T", second.Else)
+	}
+
+	mustFail(t, `ensure { else: 1 }
+return 1`)
+	mustFail(t, `ensure { that: true, otherwise: 1 }
+return 1`)
+}
+
 // ---- 13. Loop ----
 
 func TestLoopExpr(t *testing.T) {
@@ -1336,6 +1424,28 @@ return x`
 	}
 }
 
+func TestAssertApprox(t *testing.T) {
+	src := `assert.approx { a: 0.1 + 0.2, b: 0.3, tolerance: 0.001 }
+return null`
+	prog := mustParse(t, src)
+	exprStmt := prog.Statements[0].(*ast.ExprStmt)
+	assertExpr, ok := exprStmt.Expr.(*ast.AssertExpr)
+	if !ok {
+		t.Fatalf("expected AssertExpr, got %T", exprStmt.Expr)
+	}
+	if !assertExpr.Approx {
+		t.Error("expected Approx to be set")
+	}
+	if len(assertExpr.Args.Pairs) != 3 {
+		t.Fatalf("expected 3 args, got %d", len(assertExpr.Args.Pairs))
+	}
+}
+
+func TestAssertUnknownForm(t *testing.T) {
+	mustFail(t, `assert.close { a: 1, b: 1 }
+return null`)
+}
+
 // ---- 21. Function Calls ----
 
 func TestFnCall(t *testing.T) {
@@ -1445,6 +1555,74 @@ return null`
 	}
 }
 
+func TestMetaDecl(t *testing.T) {
+	src := `meta { name: "sync", version: "1.0.0", author: "ops" }
+let meta = { a: 1 }
+return meta`
+	prog := mustParse(t, src)
+	if len(prog.Headers) != 1 {
+		t.Fatalf("expected 1 header, got %d", len(prog.Headers))
+	}
+	if _, ok := prog.Headers[0].(*ast.MetaDecl); !ok {
+		t.Fatalf("expected MetaDecl, got %T", prog.Headers[0])
+	}
+	m := ast.Meta(prog)
+	if m == nil || m.Name != "sync" || m.Version != "1.0.0" || m.Author != "ops" || m.Description != "" {
+		t.Errorf("unexpected meta %+v", m)
+	}
+	if _, ok := prog.Statements[0].(*ast.LetStmt); !ok {
+		t.Errorf("expected 'meta' to stay usable as a binding name, got %T", prog.Statements[0])
+	}
+}
+
+func TestDeprecatedAnnotation(t *testing.T) {
+	src := `@deprecated "use add instead"
+export fn plus { a, b } {
+  return { sum: a + b }
+}
+return null`
+	prog := mustParse(t, src)
+	fn, ok := prog.Statements[0].(*ast.FnDecl)
+	if !ok {
+		t.Fatalf("expected FnDecl, got %T", prog.Statements[0])
+	}
+	if fn.Deprecated != "use add instead" || !fn.Exported {
+		t.Errorf("unexpected fn %q deprecated=%q exported=%v", fn.Name, fn.Deprecated, fn.Exported)
+	}
+	if fn.Span.StartLine != 1 {
+		t.Errorf("expected span to start at the annotation, got line %d", fn.Span.StartLine)
+	}
+
+	mustFail(t, `@deprecated fn f { } { return null }
+return null`)
+	mustFail(t, `@pure "x" fn f { } { return null }
+return null`)
+	mustFail(t, `@deprecated "x" let a = 1
+return a`)
+}
+
+func TestMemoAnnotation(t *testing.T) {
+	prog := mustParse(t, `@memo
+@deprecated "use g"
+fn f { x } { return x }
+return null`)
+	fn, ok := prog.Statements[0].(*ast.FnDecl)
+	if !ok {
+		t.Fatalf("expected FnDecl, got %T", prog.Statements[0])
+	}
+	if !fn.Memo || fn.Deprecated != "use g" {
+		t.Errorf("unexpected fn %q memo=%v deprecated=%q", fn.Name, fn.Memo, fn.Deprecated)
+	}
+	if fn.Span.StartLine != 1 {
+		t.Errorf("expected span to start at the first annotation, got line %d", fn.Span.StartLine)
+	}
+
+	mustFail(t, `@memo @memo fn f { x } { return x }
+return null`)
+	mustFail(t, `@memo let a = 1
+return a`)
+}
+
 func TestMultipleHeaders(t *testing.T) {
 	src := `cap { fs.read: true }
 budget { timeMs: 1000 }
@@ -1463,6 +1641,35 @@ return null`
 	}
 }
 
+func TestIndexExpr(t *testing.T) {
+	prog := mustParse(t, `let s = "abc"
+let c = s[1]
+return [c]`)
+	stmt := prog.Statements[1].(*ast.LetStmt)
+	idx, ok := stmt.Value.(*ast.IndexExpr)
+	if !ok {
+		t.Fatalf("expected IndexExpr, got %T", stmt.Value)
+	}
+	if target, ok := idx.Target.(*ast.IdentPath); !ok || target.Parts[0] != "s" {
+		t.Errorf("unexpected index target %#v", idx.Target)
+	}
+	if _, ok := prog.Statements[2].(*ast.ReturnStmt).Value.(*ast.ListExpr); !ok {
+		t.Errorf("expected return of a list literal")
+	}
+}
+
+func TestIndexExpr_SpaceStartsList(t *testing.T) {
+	prog := mustParse(t, `let s = "abc"
+[1, 2]
+return s`)
+	if len(prog.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(prog.Statements))
+	}
+	if _, ok := prog.Statements[0].(*ast.LetStmt).Value.(*ast.StrLiteral); !ok {
+		t.Errorf("a '[' on the next line must not index the previous value")
+	}
+}
+
 func TestImportDecl(t *testing.T) {
 	src := `import "utils.a0" as utils
 return null`
@@ -1482,6 +1689,54 @@ return null`
 	}
 }
 
+func TestImportDecl_Budget(t *testing.T) {
+	src := `import "utils.a0" as utils budget { maxToolCalls: 3 }
+return null`
+	prog := mustParse(t, src)
+	importDecl := prog.Headers[0].(*ast.ImportDecl)
+	if importDecl.Budget == nil || len(importDecl.Budget.Pairs) != 1 {
+		t.Fatalf("expected a one-field import budget, got %+v", importDecl.Budget)
+	}
+}
+
+func TestExportFnDecl(t *testing.T) {
+	src := `export fn inc { x } {
+  return x + 1
+}
+fn helper { x } {
+  return x
+}
+export { helper }`
+	prog := mustParse(t, src)
+	if len(prog.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(prog.Statements))
+	}
+	fn, ok := prog.Statements[0].(*ast.FnDecl)
+	if !ok || !fn.Exported || fn.Name != "inc" {
+		t.Fatalf("expected exported FnDecl 'inc', got %#v", prog.Statements[0])
+	}
+	if fn.Span.StartCol != 1 {
+		t.Errorf("expected export fn span to start at col 1, got %d", fn.Span.StartCol)
+	}
+	if helper := prog.Statements[1].(*ast.FnDecl); helper.Exported {
+		t.Errorf("expected 'helper' not to be marked exported")
+	}
+	exp, ok := prog.Statements[2].(*ast.ExportDecl)
+	if !ok {
+		t.Fatalf("expected ExportDecl, got %T", prog.Statements[2])
+	}
+	if len(exp.Names) != 1 || exp.Names[0] != "helper" {
+		t.Errorf("expected export names [helper], got %v", exp.Names)
+	}
+	if got := ast.ExportedFns(prog); !got["inc"] || !got["helper"] {
+		t.Errorf("expected inc and helper exported, got %v", got)
+	}
+}
+
+func TestExportRequiresFnOrList(t *testing.T) {
+	mustFail(t, "export let x = 1\nreturn x")
+}
+
 // ---- 23. Parenthesized Expressions ----
 
 func TestParenthesizedSimple(t *testing.T) {
@@ -2082,11 +2337,11 @@ return result`
 }
 
 func TestDiagnosticCode(t *testing.T) {
-	_, diags := parser.Parse(`return @`, "test.a0")
+	_, diags := parser.Parse(`return ~`, "test.a0")
 	if len(diags) == 0 {
 		t.Fatal("expected diagnostics")
 	}
-	// The diagnostic should be an E_LEX (lex error for '@')
+	// The diagnostic should be an E_LEX (lex error for '~')
 	if diags[0].Code != "E_LEX" {
 		t.Errorf("expected E_LEX code, got %q", diags[0].Code)
 	}
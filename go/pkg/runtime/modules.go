@@ -0,0 +1,185 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+	"github.com/thomasrohde/agent0/go/pkg/parser"
+	"github.com/thomasrohde/agent0/go/pkg/validator"
+)
+
+// moduleLoader resolves import headers to parsed, validated programs.
+type moduleLoader struct {
+	root    string
+	vopts   validator.Options
+	modules map[*ast.ImportDecl]*ast.Program
+	byPath  map[string]*ast.Program
+	sources map[string]string // module source by absolute path
+	stack   []string          // files being loaded, for cycle detection
+	diags   []diagnostics.Diagnostic
+}
+
+// loadModules resolves every module imported by program, recursively.
+// Import paths are relative to the importing file, or to the import root
+// for bare paths when one is configured. Diagnostics from the
+// modules themselves are returned alongside the module table, and the
+// modules' sources by absolute path.
+func (rt *Runtime) loadModules(program *ast.Program, filename string, vopts validator.Options) (map[*ast.ImportDecl]*ast.Program, map[string]string, []diagnostics.Diagnostic) {
+	l := &moduleLoader{
+		root:    rt.importRoot,
+		vopts:   vopts,
+		modules: make(map[*ast.ImportDecl]*ast.Program),
+		byPath:  make(map[string]*ast.Program),
+		sources: make(map[string]string),
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		l.stack = append(l.stack, abs)
+	}
+	l.load(program, filename)
+	return l.modules, l.sources, l.diags
+}
+
+func (l *moduleLoader) load(program *ast.Program, filename string) {
+	for _, h := range program.Headers {
+		decl, ok := h.(*ast.ImportDecl)
+		if !ok {
+			continue
+		}
+		span := decl.Span
+
+		path := l.resolve(decl.Path, filename)
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			l.diags = append(l.diags, diagnostics.MakeDiag(diagnostics.EImport,
+				fmt.Sprintf("cannot resolve module '%s': %s", decl.Path, err), &span, ""))
+			continue
+		}
+		if cycle := l.cycle(abs); cycle != "" {
+			l.diags = append(l.diags, diagnostics.MakeDiag(diagnostics.EImport,
+				fmt.Sprintf("import cycle: %s", cycle), &span, ""))
+			continue
+		}
+		if mod, ok := l.byPath[abs]; ok {
+			l.modules[decl] = mod
+			continue
+		}
+
+		source, err := os.ReadFile(abs)
+		if err != nil {
+			l.diags = append(l.diags, diagnostics.MakeDiag(diagnostics.EImport,
+				fmt.Sprintf("cannot read module '%s'", decl.Path), &span,
+				"import paths are relative to the importing file or the import root"))
+			continue
+		}
+		mod, pDiags := parser.Parse(string(source), path)
+		if len(pDiags) > 0 {
+			l.diags = append(l.diags, pDiags...)
+			continue
+		}
+		l.byPath[abs] = mod
+		l.sources[abs] = string(source)
+		l.modules[decl] = mod
+
+		l.stack = append(l.stack, abs)
+		l.load(mod, path)
+		l.stack = l.stack[:len(l.stack)-1]
+
+		mopts := l.vopts
+		mopts.Module = true
+		mopts.Modules = l.modules
+		l.diags = append(l.diags, validator.ValidateWithOptions(mod, mopts)...)
+	}
+}
+
+// resolve maps an import path to a file path.
+func (l *moduleLoader) resolve(path, fromFile string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	relative := strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+	if l.root != "" && !relative {
+		return filepath.Join(l.root, path)
+	}
+	return filepath.Join(filepath.Dir(fromFile), path)
+}
+
+// cycle describes the import chain when abs is already being loaded.
+func (l *moduleLoader) cycle(abs string) string {
+	for i, p := range l.stack {
+		if p == abs {
+			chain := make([]string, 0, len(l.stack)-i+1)
+			for _, q := range l.stack[i:] {
+				chain = append(chain, filepath.Base(q))
+			}
+			chain = append(chain, filepath.Base(abs))
+			return strings.Join(chain, " -> ")
+		}
+	}
+	return ""
+}
+
+// FnDoc describes an exported fn.
+type FnDoc struct {
+	Name       string   `json:"name"`
+	Params     []string `json:"params"`
+	Deprecated string   `json:"deprecated,omitempty"`
+}
+
+// ModuleDoc lists the public surface of a module: its exported fns, in
+// declaration order. Private helpers are omitted.
+type ModuleDoc struct {
+	File    string           `json:"file"`
+	Meta    *ast.ProgramMeta `json:"meta,omitempty"`
+	Exports []FnDoc          `json:"exports"`
+}
+
+// Doc parses a module and describes its meta header and exported fns.
+func (rt *Runtime) Doc(source, filename string) (*ModuleDoc, error) {
+	program, diags := parser.Parse(source, filename)
+	if len(diags) > 0 {
+		return nil, &DiagnosticError{Diagnostics: diags}
+	}
+	exported := ast.ExportedFns(program)
+	doc := &ModuleDoc{File: filename, Meta: ast.Meta(program), Exports: []FnDoc{}}
+	for _, stmt := range program.Statements {
+		fn, ok := stmt.(*ast.FnDecl)
+		if !ok || !exported[fn.Name] {
+			continue
+		}
+		params := fn.Params
+		if params == nil {
+			params = []string{}
+		}
+		doc.Exports = append(doc.Exports, FnDoc{Name: fn.Name, Params: params, Deprecated: fn.Deprecated})
+	}
+	return doc, nil
+}
+
+// ProgramSHA256 returns the hex SHA-256 that identifies a program together
+// with the modules it imports. For a program without imports it is the
+// plain SHA-256 of source. Otherwise it hashes source followed by one
+// "\nimport <sha256>" line per module, with the modules' own hashes sorted,
+// so it does not depend on where the modules live or the import order.
+func ProgramSHA256(source string, modules map[string]string) string {
+	if len(modules) == 0 {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	hashes := make([]string, 0, len(modules))
+	for _, src := range modules {
+		hashes = append(hashes, fmt.Sprintf("%x", sha256.Sum256([]byte(src))))
+	}
+	sort.Strings(hashes)
+	h := sha256.New()
+	io.WriteString(h, source)
+	for _, hash := range hashes {
+		io.WriteString(h, "\nimport "+hash)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
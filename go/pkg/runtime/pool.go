@@ -0,0 +1,89 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// Pool runs programs concurrently on one shared Runtime, for hosts that serve
+// many requests at once. It bounds the number of in-flight runs and gives
+// every run a fresh run ID.
+type Pool struct {
+	rt  *Runtime
+	sem chan struct{}
+}
+
+// NewPool creates a Pool allowing at most size concurrent runs (minimum 1)
+// on a Runtime built from opts.
+func NewPool(size int, opts ...Option) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{rt: New(opts...), sem: make(chan struct{}, size)}
+}
+
+// Runtime returns the pool's shared runtime, e.g. for Check or Format.
+func (p *Pool) Runtime() *Runtime {
+	return p.rt
+}
+
+// Run waits for a free slot, then runs source like Runtime.Run under a new
+// run ID (see Result.RunID). It returns ctx.Err() if ctx ends while waiting.
+func (p *Pool) Run(ctx context.Context, source, filename string) (*Result, error) {
+	return p.RunInput(ctx, source, filename, nil)
+}
+
+// RunInput is like Run but binds input as run.input.
+func (p *Pool) RunInput(ctx context.Context, source, filename string, input evaluator.A0Value) (*Result, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+	return p.rt.run(ctx, source, filename, NewRunID(), input)
+}
+
+// serializeTrace makes a trace sink safe to share between runs, whether or
+// not it does its own locking (a TraceFunc doesn't).
+func serializeTrace(sink evaluator.TraceSink) evaluator.TraceSink {
+	return &lockedSink{sink: sink}
+}
+
+type lockedSink struct {
+	mu   sync.Mutex
+	sink evaluator.TraceSink
+}
+
+func (l *lockedSink) Emit(e evaluator.TraceEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sink.Emit(e)
+}
+
+func (l *lockedSink) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sink.Flush()
+}
+
+func (l *lockedSink) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sink.Close()
+}
+
+// lockedWriter serializes writes so concurrent runs never interleave log lines.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -4,8 +4,14 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/thomasrohde/agent0/go/pkg/ast"
 	"github.com/thomasrohde/agent0/go/pkg/capabilities"
 	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
@@ -16,19 +22,95 @@ import (
 	"github.com/thomasrohde/agent0/go/pkg/validator"
 )
 
+// Version is the A0 version this runtime implements, kept in step with the
+// npm packages.
+const Version = "0.5.2"
+
 // Result holds the outcome of a program execution.
 type Result struct {
+	RunID    string
 	Value    evaluator.A0Value
 	Evidence []evaluator.Evidence
+	Warnings []diagnostics.Diagnostic
+	// KeptTempDir is the fs.temp directory left in place after a failed run
+	// (see WithKeepTempOnFailure); empty when it was cleaned up.
+	KeptTempDir string
+	// FilesChanged lists the files fs.write and archive.* wrote, one
+	// entry per path, including on failed runs. See WithFileDiffs.
+	FilesChanged []tools.FileChange
+	// Plan lists the do calls a WithPlan run recorded instead of executing.
+	Plan []evaluator.PlanStep
+	// Meta is the program's meta { ... } header, or nil.
+	Meta *ast.ProgramMeta
+	// ProgramSHA256 identifies the program and its imported modules; see
+	// ProgramSHA256.
+	ProgramSHA256 string
+
+	numberFormat evaluator.NumberFormat
+	stableJSON   bool
+}
+
+// ValueJSON serializes Value with the runtime's number format (see
+// WithNumberFormat), canonically if WithStableJSON is set.
+func (r *Result) ValueJSON() ([]byte, error) {
+	if r.stableJSON {
+		return evaluator.StableJSON(r.Value, r.numberFormat)
+	}
+	return evaluator.ValueToJSONWith(r.Value, r.numberFormat)
 }
 
 // Runtime wires together all A0 components for program execution.
+//
+// A Runtime is safe for concurrent Run, Check and Format calls. Its
+// configuration is fixed by New: the stdlib and tool registries are
+// snapshotted, so registering into them afterwards does not affect the
+// runtime, and the policy must not be modified. Each run gets its own
+// evaluator, temp scope and environment; the trace sink and log writer
+// are shared but serialized, so they never see interleaved calls.
 type Runtime struct {
-	stdlib *stdlib.Registry
-	tools  *tools.Registry
-	policy *capabilities.Policy
-	runID  string
-	trace  func(event evaluator.TraceEvent)
+	stdlib  *stdlib.Registry
+	tools   *tools.Registry
+	policy  *capabilities.Policy
+	runID   string
+	trace   evaluator.TraceSink
+	vopts   validator.Options
+	unsafe  bool
+	workdir string
+	// traceValues records tool results and the run's value in the trace.
+	traceValues bool
+	// keepTemp leaves the fs.temp directory in place when a run fails.
+	keepTemp bool
+	// httpCache is the response cache directory for http tools.
+	httpCache string
+	// overlay receives fs tool writes instead of the real tree.
+	overlay *tools.Overlay
+	// fileDiffs adds unified diffs to Result.FilesChanged.
+	fileDiffs bool
+	// plan records do calls instead of executing them; see WithPlan.
+	plan bool
+	// maxBatchConcurrency caps call.batch; see WithMaxBatchConcurrency.
+	maxBatchConcurrency int
+	// numberFormat and stableJSON are used by Result.ValueJSON.
+	numberFormat evaluator.NumberFormat
+	stableJSON   bool
+	// importRoot resolves bare import paths; see WithImportRoot.
+	importRoot string
+	fmtOpts    formatter.Options
+	// shared caps usage across every run that shares it.
+	shared *evaluator.SharedBudget
+	// updateSnapshots rewrites mismatched expect.snapshot files.
+	updateSnapshots bool
+	log             evaluator.LogOptions
+	// toolContext is passed to tools as ExecOptions.ToolContext.
+	toolContext map[any]any
+	// strictBool requires boolean conditions; see WithStrictBool.
+	strictBool bool
+	// s3Credentials signs s3.* requests; see WithS3Credentials.
+	s3Credentials tools.S3CredentialsProvider
+	// hostFns are the functions registered with WithHostFn.
+	hostFns map[string]evaluator.HostFn
+	// base holds the ExecOptions shared by every run, built once by New.
+	base evaluator.ExecOptions
 }
 
 // Option is a functional option for configuring the Runtime.
@@ -59,20 +141,231 @@ func WithPolicy(p *capabilities.Policy) Option {
 func WithUnsafeAllowAll() Option {
 	return func(rt *Runtime) {
 		rt.policy = capabilities.AllowAll()
+		rt.unsafe = true
 	}
 }
 
-// WithRunID sets the run ID for trace events.
+// WithRunID sets the run ID used in trace events, evidence and run.id.
+// By default each Runtime gets a fresh ULID from NewRunID.
 func WithRunID(id string) Option {
 	return func(rt *Runtime) {
 		rt.runID = id
 	}
 }
 
-// WithTrace sets the trace callback.
-func WithTrace(fn func(event evaluator.TraceEvent)) Option {
+// WithTrace sets the sink that receives every run's trace events. The
+// runtime flushes it after each run; closing it is left to the caller.
+// Use evaluator.TraceFunc to pass a plain callback.
+func WithTrace(sink evaluator.TraceSink) Option {
+	return func(rt *Runtime) {
+		rt.trace = sink
+	}
+}
+
+// WithTraceValues records tool results and the program's value in the
+// trace, so a0 verify can replay the run from it.
+func WithTraceValues() Option {
+	return func(rt *Runtime) {
+		rt.traceValues = true
+	}
+}
+
+// WithWorkdir confines fs tool paths to dir for every run.
+func WithWorkdir(dir string) Option {
+	return func(rt *Runtime) {
+		rt.workdir = dir
+	}
+}
+
+// WithKeepTempOnFailure keeps the run's fs.temp directory when the run
+// fails so its contents can be inspected; see Result.KeptTempDir.
+func WithKeepTempOnFailure() Option {
+	return func(rt *Runtime) {
+		rt.keepTemp = true
+	}
+}
+
+// WithHTTPCache enables conditional-request caching of http tool
+// responses in dir.
+func WithHTTPCache(dir string) Option {
+	return func(rt *Runtime) {
+		rt.httpCache = dir
+	}
+}
+
+// WithOverlay redirects fs effect tools into o, a copy-on-write overlay
+// opened with tools.OpenOverlay; fs read tools see the overlay's files in
+// place of the real ones. Review and apply the result with o.Changes and
+// o.Apply.
+func WithOverlay(o *tools.Overlay) Option {
+	return func(rt *Runtime) {
+		rt.overlay = o
+	}
+}
+
+// WithFileDiffs adds a unified diff of each written text file to
+// Result.FilesChanged. Original contents are held in memory for the run.
+func WithFileDiffs() Option {
+	return func(rt *Runtime) {
+		rt.fileDiffs = true
+	}
+}
+
+// WithPlan makes runs record their do calls in Result.Plan instead of
+// executing them, so the effects can be reviewed before a real run. Reads
+// (call?) still execute.
+func WithPlan() Option {
+	return func(rt *Runtime) {
+		rt.plan = true
+	}
+}
+
+// WithMaxBatchConcurrency caps how many tool calls a call.batch runs at
+// once; n = 1 makes batches call their tool one item at a time, in order.
+func WithMaxBatchConcurrency(n int) Option {
+	return func(rt *Runtime) {
+		rt.maxBatchConcurrency = n
+	}
+}
+
+// WithNumberFormat sets how Result.ValueJSON writes numbers, e.g. rounded
+// to a number of significant digits.
+func WithNumberFormat(nf evaluator.NumberFormat) Option {
+	return func(rt *Runtime) {
+		rt.numberFormat = nf
+	}
+}
+
+// WithStableJSON makes Result.ValueJSON canonical (see
+// evaluator.StableJSON), so results can be compared with golden files.
+func WithStableJSON() Option {
+	return func(rt *Runtime) {
+		rt.stableJSON = true
+	}
+}
+
+// WithImportRoot resolves bare import paths (those not starting with "./"
+// or "../") against dir instead of the importing file's directory.
+func WithImportRoot(dir string) Option {
+	return func(rt *Runtime) {
+		rt.importRoot = dir
+	}
+}
+
+// WithFormatOptions configures Format.
+func WithFormatOptions(opts formatter.Options) Option {
+	return func(rt *Runtime) {
+		rt.fmtOpts = opts
+	}
+}
+
+// WithSharedBudget makes every run count against b in addition to its own
+// budget header, so several runtimes can share one global limit.
+func WithSharedBudget(b *evaluator.SharedBudget) Option {
+	return func(rt *Runtime) {
+		rt.shared = b
+	}
+}
+
+// WithSnapshotUpdate makes expect.snapshot rewrite snapshots that differ
+// instead of recording failed evidence.
+func WithSnapshotUpdate() Option {
+	return func(rt *Runtime) {
+		rt.updateSnapshots = true
+	}
+}
+
+// WithLogWriter sends log.* entries to w as JSON lines, or as plain text
+// lines when text is true. Entries always go to the trace.
+func WithLogWriter(w io.Writer, text bool) Option {
+	return func(rt *Runtime) {
+		rt.log = evaluator.LogOptions{Writer: w, Text: text}
+	}
+}
+
+// WithToolValue makes val available to tool implementations as
+// ctx.Value(key) (or evaluator.ToolValue). Use it to pass per-run data such
+// as tenant IDs or credentials to custom tools without global state.
+func WithToolValue(key, val any) Option {
+	return func(rt *Runtime) {
+		if rt.toolContext == nil {
+			rt.toolContext = make(map[any]any)
+		}
+		rt.toolContext[key] = val
+	}
+}
+
+// WithStrict enables the validator's strict mode. When asWarnings is true,
+// strict findings are reported as warnings and do not block execution.
+func WithStrict(asWarnings bool) Option {
+	return func(rt *Runtime) {
+		rt.vopts.Strict = true
+		rt.vopts.StrictAsWarnings = asWarnings
+	}
+}
+
+// WithNullSafety enables the validator's null-safety warnings (E_NULLABLE).
+func WithNullSafety() Option {
+	return func(rt *Runtime) {
+		rt.vopts.NullSafety = true
+	}
+}
+
+// WithDisabledLints turns off the a0 check lint warnings with the given
+// diagnostic codes, e.g. E_SHADOW.
+func WithDisabledLints(codes ...string) Option {
+	return func(rt *Runtime) {
+		if rt.vopts.DisabledLints == nil {
+			rt.vopts.DisabledLints = make(map[string]bool)
+		}
+		for _, code := range codes {
+			rt.vopts.DisabledLints[code] = true
+		}
+	}
+}
+
+// WithStrictBool makes if, assert, check and filter predicates require a
+// boolean and raise E_TYPE for anything else, instead of using truthiness.
+// A policy with "strictBool": true has the same effect.
+func WithStrictBool() Option {
+	return func(rt *Runtime) {
+		rt.strictBool = true
+	}
+}
+
+// WithHostFn makes fn callable from programs as name { ... }, like a stdlib
+// function. Host functions need no capability, so they should be free of
+// side effects; use a tool for anything that touches the outside world.
+// A name already used by the stdlib is ignored in favour of the stdlib.
+func WithHostFn(name string, fn evaluator.HostFn) Option {
 	return func(rt *Runtime) {
-		rt.trace = fn
+		if rt.hostFns == nil {
+			rt.hostFns = make(map[string]evaluator.HostFn)
+		}
+		rt.hostFns[name] = fn
+		if rt.vopts.HostFns == nil {
+			rt.vopts.HostFns = make(map[string]bool)
+		}
+		rt.vopts.HostFns[name] = true
+	}
+}
+
+// WithS3Credentials makes s3.* tools sign requests with the credentials p
+// returns, such as keys fetched from a secret manager, instead of the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+func WithS3Credentials(p tools.S3CredentialsProvider) Option {
+	return func(rt *Runtime) {
+		rt.s3Credentials = p
+	}
+}
+
+// WithValidatorPass adds a custom validation pass, run on every program
+// and imported module after the built-in checks, e.g. to enforce an
+// organization's approved tools. Its error diagnostics fail Run and Check
+// like the validator's own.
+func WithValidatorPass(p validator.Pass) Option {
+	return func(rt *Runtime) {
+		rt.vopts.Passes = append(rt.vopts.Passes, p)
 	}
 }
 
@@ -89,42 +382,153 @@ func New(opts ...Option) *Runtime {
 		stdlib: stdlibReg,
 		tools:  toolsReg,
 		policy: capabilities.DenyAll(),
-		runID:  "cli",
+		runID:  NewRunID(),
 	}
 	for _, opt := range opts {
 		opt(rt)
 	}
+	if rt.trace != nil {
+		rt.trace = serializeTrace(rt.trace)
+	}
+	if rt.log.Writer != nil {
+		rt.log.Writer = &lockedWriter{w: rt.log.Writer}
+	}
+	rt.base = rt.buildExecOptions()
 	return rt
 }
 
 // Run parses, validates, and executes an A0 program.
 func (rt *Runtime) Run(ctx context.Context, source, filename string) (*Result, error) {
+	return rt.run(ctx, source, filename, rt.runID, nil)
+}
+
+// RunInput is like Run but binds input as run.input.
+func (rt *Runtime) RunInput(ctx context.Context, source, filename string, input evaluator.A0Value) (*Result, error) {
+	return rt.run(ctx, source, filename, rt.runID, input)
+}
+
+func (rt *Runtime) run(ctx context.Context, source, filename, runID string, input evaluator.A0Value) (*Result, error) {
 	program, diags := parser.Parse(source, filename)
 	if len(diags) > 0 {
 		return nil, &DiagnosticError{Diagnostics: diags}
 	}
 
-	vDiags := validator.Validate(program)
-	if len(vDiags) > 0 {
+	modules, moduleSources, vDiags := rt.loadModules(program, filename, rt.vopts)
+	programSHA256 := ProgramSHA256(source, moduleSources)
+	vopts := rt.vopts
+	vopts.Modules = modules
+	vDiags = append(vDiags, validator.ValidateWithOptions(program, vopts)...)
+	if diagnostics.HasErrors(vDiags) {
 		return nil, &DiagnosticError{Diagnostics: vDiags}
 	}
+	_, warnings := diagnostics.Split(vDiags)
+	if rt.unsafe {
+		warnings = append(warnings, unsafeAllowAllWarning(program, modules))
+	}
 
-	opts := rt.buildExecOptions()
+	tempBase := ""
+	if rt.workdir != "" {
+		ctx = tools.WithWorkdir(ctx, rt.workdir)
+		tempBase = rt.workdir
+	}
+	if rt.policy != nil && rt.policy.Hosts != nil {
+		ctx = tools.WithHostAllowlist(ctx, rt.policy.Hosts)
+	}
+	if rt.policy != nil && rt.policy.KVPath != "" {
+		ctx = tools.WithKVPath(ctx, rt.policy.KVPath)
+	}
+	if (rt.policy != nil && rt.policy.S3 != nil) || rt.s3Credentials != nil {
+		cfg := tools.S3Config{Credentials: rt.s3Credentials}
+		if rt.policy != nil && rt.policy.S3 != nil {
+			cfg.Endpoint = rt.policy.S3.Endpoint
+			cfg.Region = rt.policy.S3.Region
+			cfg.Buckets = rt.policy.S3.Buckets
+		}
+		ctx = tools.WithS3Config(ctx, cfg)
+	}
+	if rt.httpCache != "" {
+		ctx = tools.WithHTTPCache(ctx, rt.httpCache)
+	}
+	if rt.overlay != nil {
+		ctx = tools.WithOverlay(ctx, rt.overlay)
+	}
+	changes := &tools.ChangeLog{Diffs: rt.fileDiffs}
+	if rt.workdir != "" {
+		// Match resolvePath, which reports workdir paths symlink-free.
+		changes.Root, _ = filepath.Abs(rt.workdir)
+		if real, err := filepath.EvalSymlinks(changes.Root); err == nil {
+			changes.Root = real
+		}
+	} else {
+		changes.Root, _ = os.Getwd()
+	}
+	ctx = tools.WithChangeLog(ctx, changes)
+	tempScope := tools.NewTempScope(tempBase)
+	ctx = tools.WithTempScope(ctx, tempScope)
+
+	opts := rt.base
+	opts.RunID = runID
+	opts.Input = input
+	opts.Modules = modules
+	opts.ProgramSHA256 = programSHA256
+	opts.Snapshots = evaluator.SnapshotOptions{
+		Dir:    snapshotDir(filename),
+		Update: rt.updateSnapshots,
+	}
 	result, err := evaluator.Execute(ctx, program, opts)
+	if rt.trace != nil {
+		if ferr := rt.trace.Flush(); ferr != nil && err == nil {
+			err = &evaluator.A0RuntimeError{Code: diagnostics.ETrace, Message: fmt.Sprintf("cannot write trace: %s", ferr)}
+		}
+	}
+	keptTemp := ""
+	if rt.keepTemp && runFailed(result, err) {
+		keptTemp = tempScope.Path()
+	} else {
+		tempScope.Cleanup()
+	}
+	if result != nil {
+		warnings = append(warnings, result.Warnings...)
+	}
 	if err != nil {
 		if result != nil {
-			return &Result{Evidence: result.Evidence}, err
+			return &Result{RunID: runID, Evidence: result.Evidence, Warnings: warnings, KeptTempDir: keptTemp, FilesChanged: changes.Changes(), Plan: result.Plan, Meta: ast.Meta(program), ProgramSHA256: programSHA256, numberFormat: rt.numberFormat, stableJSON: rt.stableJSON}, err
 		}
 		return nil, err
 	}
 
 	var value evaluator.A0Value
 	var evidence []evaluator.Evidence
+	var plan []evaluator.PlanStep
 	if result != nil {
 		value = result.Value
 		evidence = result.Evidence
+		plan = result.Plan
+	}
+	return &Result{RunID: runID, Value: value, Evidence: evidence, Warnings: warnings, KeptTempDir: keptTemp, FilesChanged: changes.Changes(), Plan: plan, Meta: ast.Meta(program), ProgramSHA256: programSHA256, numberFormat: rt.numberFormat, stableJSON: rt.stableJSON}, nil
+}
+
+// snapshotDir is the __snapshots__ directory next to the program file.
+func snapshotDir(filename string) string {
+	if filename == "" || strings.HasPrefix(filename, "<") {
+		return evaluator.DefaultSnapshotDir
+	}
+	return filepath.Join(filepath.Dir(filename), evaluator.DefaultSnapshotDir)
+}
+
+// runFailed reports whether a run ended in an error or with failed evidence.
+func runFailed(result *evaluator.ExecResult, err error) bool {
+	if err != nil {
+		return true
+	}
+	if result != nil {
+		for _, ev := range result.Evidence {
+			if !ev.OK {
+				return true
+			}
+		}
 	}
-	return &Result{Value: value, Evidence: evidence}, nil
+	return false
 }
 
 // Check parses and validates an A0 program without executing it.
@@ -134,8 +538,62 @@ func (rt *Runtime) Check(source, filename string) []diagnostics.Diagnostic {
 		return diags
 	}
 
-	vDiags := validator.Validate(program)
-	return vDiags
+	vopts := rt.vopts
+	vopts.Lint = true
+	modules, _, vDiags := rt.loadModules(program, filename, vopts)
+	vopts.Modules = modules
+	return append(vDiags, validator.ValidateWithOptions(program, vopts)...)
+}
+
+// unsafeAllowAllWarning points out that the cap { ... } headers of the
+// program and its modules already name every capability it can use, so a
+// concrete policy would do.
+func unsafeAllowAllWarning(program *ast.Program, modules map[*ast.ImportDecl]*ast.Program) diagnostics.Diagnostic {
+	capSet := make(map[string]bool)
+	var span *ast.Span
+	collect := func(p *ast.Program, main bool) {
+		for _, h := range p.Headers {
+			decl, ok := h.(*ast.CapDecl)
+			if !ok {
+				continue
+			}
+			if span == nil && main {
+				s := decl.Span
+				span = &s
+			}
+			for _, entry := range decl.Capabilities.Pairs {
+				pair, ok := entry.(*ast.RecordPair)
+				if !ok {
+					continue
+				}
+				if b, ok := pair.Value.(*ast.BoolLiteral); ok && b.Value {
+					capSet[pair.Key] = true
+				}
+			}
+		}
+	}
+	collect(program, true)
+	for _, mod := range modules {
+		collect(mod, false)
+	}
+	caps := make([]string, 0, len(capSet))
+	for c := range capSet {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+
+	if len(caps) == 0 {
+		return diagnostics.MakeWarning(diagnostics.EUnsafeAllowAll,
+			"--unsafe-allow-all is unnecessary: the program declares no capabilities", nil,
+			"drop --unsafe-allow-all")
+	}
+	quoted := make([]string, len(caps))
+	for i, c := range caps {
+		quoted[i] = fmt.Sprintf("%q", c)
+	}
+	return diagnostics.MakeWarning(diagnostics.EUnsafeAllowAll,
+		fmt.Sprintf("--unsafe-allow-all grants every capability but the program only needs: %s", strings.Join(caps, ", ")), span,
+		fmt.Sprintf(`use a policy file instead, e.g. .a0policy.json: { "allow": [%s] }`, strings.Join(quoted, ", ")))
 }
 
 // Format parses and formats an A0 program.
@@ -144,7 +602,27 @@ func (rt *Runtime) Format(source, filename string) (string, error) {
 	if len(diags) > 0 {
 		return "", &DiagnosticError{Diagnostics: diags}
 	}
-	return formatter.Format(program), nil
+	return formatter.FormatWithOptions(program, rt.fmtOpts), nil
+}
+
+// Hash returns the canonical hash of a program: ProgramSHA256 of the
+// program and its imported modules after formatting each with the default
+// formatter options, so layout changes leave it alone.
+func (rt *Runtime) Hash(source, filename string) (string, error) {
+	program, diags := parser.Parse(source, filename)
+	if len(diags) > 0 {
+		return "", &DiagnosticError{Diagnostics: diags}
+	}
+	_, sources, mDiags := rt.loadModules(program, filename, rt.vopts)
+	if diagnostics.HasErrors(mDiags) {
+		return "", &DiagnosticError{Diagnostics: mDiags}
+	}
+	formatted := make(map[string]string, len(sources))
+	for path, src := range sources {
+		mod, _ := parser.Parse(src, path)
+		formatted[path] = formatter.Format(mod)
+	}
+	return ProgramSHA256(formatter.Format(program), formatted), nil
 }
 
 // buildExecOptions constructs evaluator options from the runtime's configuration.
@@ -153,8 +631,9 @@ func (rt *Runtime) buildExecOptions() evaluator.ExecOptions {
 	for name, fn := range rt.stdlib.All() {
 		fnCopy := fn
 		stdlibMap[name] = &evaluator.StdlibFn{
-			Name:    name,
-			Execute: fnCopy.Execute,
+			Name:       name,
+			Execute:    fnCopy.Execute,
+			Deprecated: fnCopy.Deprecated,
 		}
 	}
 
@@ -165,13 +644,30 @@ func (rt *Runtime) buildExecOptions() evaluator.ExecOptions {
 			Name:         toolCopy.Name,
 			Mode:         toolCopy.Mode,
 			CapabilityID: toolCopy.CapabilityID,
+			AlsoRequires: toolCopy.AlsoRequires,
 			Execute:      toolCopy.Execute,
+			Prepare:      toolCopy.Prepare,
+			Commit:       toolCopy.Commit,
+			Rollback:     toolCopy.Rollback,
 		}
 	}
 
 	var allowedCaps map[string]bool
+	var taintRules []evaluator.TaintRule
+	var useCapability func(string) error
+	strictBool := rt.strictBool
 	if rt.policy != nil {
+		if len(rt.policy.Grants) > 0 {
+			policy := rt.policy
+			useCapability = func(capability string) error {
+				return policy.UseGrant(capability, time.Now())
+			}
+		}
 		allowedCaps = rt.policy.Allowed
+		strictBool = strictBool || rt.policy.StrictBool
+		for _, r := range rt.policy.Taint {
+			taintRules = append(taintRules, evaluator.TaintRule{From: r.From, To: r.To})
+		}
 	}
 
 	return evaluator.ExecOptions{
@@ -179,7 +675,17 @@ func (rt *Runtime) buildExecOptions() evaluator.ExecOptions {
 		Tools:               toolsMap,
 		Stdlib:              stdlibMap,
 		Trace:               rt.trace,
+		TraceValues:         rt.traceValues,
 		RunID:               rt.runID,
+		SharedBudget:        rt.shared,
+		Log:                 rt.log,
+		ToolContext:         rt.toolContext,
+		StrictBool:          strictBool,
+		HostFns:             rt.hostFns,
+		TaintRules:          taintRules,
+		UseCapability:       useCapability,
+		Plan:                rt.plan,
+		MaxBatchConcurrency: rt.maxBatchConcurrency,
 	}
 }
 
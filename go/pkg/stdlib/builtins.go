@@ -2,6 +2,7 @@ package stdlib
 
 import (
 	"fmt"
+	"unicode/utf8"
 
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
 )
@@ -10,6 +11,7 @@ import (
 func RegisterDefaults(r *Registry) {
 	// Predicates
 	r.Register(Fn{Name: "eq", Execute: stdlibEq})
+	r.Register(Fn{Name: "hash", Execute: stdlibHash})
 	r.Register(Fn{Name: "not", Execute: stdlibNot})
 	r.Register(Fn{Name: "contains", Execute: stdlibContains})
 	r.Register(Fn{Name: "and", Execute: stdlibAnd})
@@ -37,6 +39,16 @@ func RegisterDefaults(r *Registry) {
 	r.Register(Fn{Name: "str.ends", Execute: stdlibStrEnds})
 	r.Register(Fn{Name: "str.replace", Execute: stdlibStrReplace})
 	r.Register(Fn{Name: "str.template", Execute: stdlibStrTemplate})
+	r.Register(Fn{Name: "str.chars", Execute: stdlibStrChars})
+	r.Register(Fn{Name: "str.codePointAt", Execute: stdlibStrCodePointAt})
+	r.Register(Fn{Name: "str.substr", Execute: stdlibStrSubstr})
+	r.Register(Fn{Name: "str.compare", Execute: stdlibStrCompare})
+
+	// Markup ops
+	r.Register(Fn{Name: "md.table", Execute: stdlibMdTable})
+	r.Register(Fn{Name: "md.link", Execute: stdlibMdLink})
+	r.Register(Fn{Name: "md.codeBlock", Execute: stdlibMdCodeBlock})
+	r.Register(Fn{Name: "html.escape", Execute: stdlibHTMLEscape})
 
 	// Record ops
 	r.Register(Fn{Name: "keys", Execute: stdlibKeys})
@@ -54,13 +66,38 @@ func RegisterDefaults(r *Registry) {
 	// Math
 	r.Register(Fn{Name: "math.max", Execute: stdlibMathMax})
 	r.Register(Fn{Name: "math.min", Execute: stdlibMathMin})
+	r.Register(Fn{Name: "approxEq", Execute: stdlibApproxEq})
 
 	// Patch
 	r.Register(Fn{Name: "patch", Execute: stdlibPatch})
 
+	// Diff
+	r.Register(Fn{Name: "diff.text", Execute: stdlibDiffText})
+	r.Register(Fn{Name: "diff.json", Execute: stdlibDiffJSON})
+
 	// Map & reduce are registered but handled specially by the evaluator
 	r.Register(Fn{Name: "map", Execute: stdlibMapStub})
 	r.Register(Fn{Name: "reduce", Execute: stdlibReduceStub})
+	r.Register(Fn{Name: "paginate", Execute: stdlibPaginateStub})
+	r.Register(Fn{Name: "call.batch", Execute: stdlibCallBatchStub})
+	r.Register(Fn{Name: "expect.snapshot", Execute: stdlibSnapshotStub})
+	r.Register(Fn{Name: "expect.schema", Execute: stdlibExpectSchemaStub})
+	r.Register(Fn{Name: "evidence", Execute: stdlibEvidenceStub})
+
+	// Introspection reads the run's registries, so the evaluator handles it
+	r.Register(Fn{Name: "tools.list", Execute: stdlibToolsListStub})
+	r.Register(Fn{Name: "stdlib.list", Execute: stdlibStdlibListStub})
+
+	// Property testing: generators are pure, forall is handled by the evaluator
+	r.Register(Fn{Name: "gen.int", Execute: stdlibGenInt})
+	r.Register(Fn{Name: "gen.string", Execute: stdlibGenString})
+	r.Register(Fn{Name: "gen.list", Execute: stdlibGenList})
+	r.Register(Fn{Name: "forall", Execute: stdlibForallStub})
+
+	// Logging writes to the trace and the log writer, so the evaluator handles it
+	for _, level := range evaluator.LogLevels {
+		r.Register(Fn{Name: "log." + level, Execute: stdlibLogStub})
+	}
 }
 
 // map and reduce stubs — the evaluator intercepts these for special handling
@@ -72,6 +109,46 @@ func stdlibReduceStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	return nil, fmt.Errorf("reduce must be called through evaluator")
 }
 
+func stdlibPaginateStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("paginate must be called through evaluator")
+}
+
+// call.batch calls tools and charges the run's budgets, so the evaluator
+// handles it
+func stdlibCallBatchStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("call.batch must be called through evaluator")
+}
+
+// expect.snapshot needs the snapshot directory, so the evaluator handles it
+func stdlibSnapshotStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("expect.snapshot must be called through evaluator")
+}
+
+// expect.schema records evidence, so the evaluator handles it
+func stdlibExpectSchemaStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("expect.schema must be called through evaluator")
+}
+
+// evidence records into the run's evidence, so the evaluator handles it
+func stdlibEvidenceStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("evidence must be called through evaluator")
+}
+
+// tools.list and stdlib.list read the run's registries, so the evaluator
+// handles them
+func stdlibToolsListStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("tools.list must be called through evaluator")
+}
+
+func stdlibStdlibListStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("stdlib.list must be called through evaluator")
+}
+
+// log.* stub — the evaluator intercepts log calls to reach the trace
+func stdlibLogStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("log functions must be called through evaluator")
+}
+
 // eq { a, b } → deep equality → bool
 func stdlibEq(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	a, _ := args.Get("a")
@@ -85,6 +162,15 @@ func stdlibEq(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	return evaluator.NewBool(evaluator.DeepEqual(a, b)), nil
 }
 
+// hash { in } → 16-char hex structural hash
+func stdlibHash(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	val, _ := args.Get("in")
+	if val == nil {
+		val = evaluator.NewNull()
+	}
+	return evaluator.NewString(fmt.Sprintf("%016x", evaluator.Hash(val))), nil
+}
+
 // not { in } → negate truthiness → bool
 func stdlibNot(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	val, _ := args.Get("in")
@@ -94,35 +180,13 @@ func stdlibNot(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	return evaluator.NewBool(!evaluator.Truthiness(val)), nil
 }
 
-// range { from, to } → list of numbers
+// range { from, to, step?, inclusive? } → list of numbers
 func stdlibRange(args *evaluator.A0Record) (evaluator.A0Value, error) {
-	fromVal, _ := args.Get("from")
-	toVal, _ := args.Get("to")
-
-	from := 0.0
-	to := 0.0
-
-	if num, ok := fromVal.(evaluator.A0Number); ok {
-		from = num.Value
-	}
-	if num, ok := toVal.(evaluator.A0Number); ok {
-		to = num.Value
-	}
-
-	if to < from {
-		return evaluator.NewList(nil), nil
-	}
-
-	count := int(to - from)
-	if count > 1000000 {
-		return nil, fmt.Errorf("range too large: %d items", count)
-	}
-
-	items := make([]evaluator.A0Value, 0, count)
-	for i := from; i < to; i++ {
-		items = append(items, evaluator.NewNumber(i))
+	r, err := evaluator.ParseRange(args)
+	if err != nil {
+		return nil, err
 	}
-	return evaluator.NewList(items), nil
+	return evaluator.NewList(r.Items()), nil
 }
 
 // len { in } → length of list, record, or string
@@ -136,9 +200,9 @@ func stdlibLen(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	case evaluator.A0List:
 		return evaluator.NewNumber(float64(len(v.Items))), nil
 	case evaluator.A0Record:
-		return evaluator.NewNumber(float64(len(v.Pairs))), nil
+		return evaluator.NewNumber(float64(v.Len())), nil
 	case evaluator.A0String:
-		return evaluator.NewNumber(float64(len(v.Value))), nil
+		return evaluator.NewNumber(float64(utf8.RuneCountInString(v.Value))), nil
 	default:
 		return evaluator.NewNumber(0), nil
 	}
@@ -0,0 +1,256 @@
+package stdlib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// collator compares strings for str.compare and sort. Without a locale it
+// uses code point order, like <, optionally ignoring case. With a locale it
+// compares letters first, ignoring accents and case, then accents, then
+// case (lowercase first), so "apple" < "Banana" < "éclair" < "zebra".
+//
+// There is no CLDR data in the build, so locales share one root order for
+// Latin letters with diacritics, and the Nordic languages get their
+// letters after z. Other scripts compare by code point.
+type collator struct {
+	caseInsensitive bool
+	locale          bool
+	tailoring       map[rune]collationElement
+}
+
+// collationElement is one letter's weights: primary is the base letter,
+// secondary the accent (0 for none). Primaries are code points times 4,
+// which leaves room to tailor letters in between existing ones.
+type collationElement struct {
+	primary   rune
+	secondary int
+}
+
+var localeTag = regexp.MustCompile(`^[A-Za-z]{2,8}([-_][A-Za-z0-9]{1,8})*$`)
+
+// collatorFromArgs reads the caseInsensitive and locale args of fn. It
+// returns nil when neither is set, meaning plain code point order.
+func collatorFromArgs(fn string, args *evaluator.A0Record) (*collator, error) {
+	c := &collator{}
+	set := false
+	if v, ok := args.Get("caseInsensitive"); ok {
+		switch b := v.(type) {
+		case evaluator.A0Bool:
+			c.caseInsensitive = b.Value
+			set = set || b.Value
+		case evaluator.A0Null:
+		default:
+			return nil, fmt.Errorf("%s: 'caseInsensitive' must be a boolean", fn)
+		}
+	}
+	if v, ok := args.Get("locale"); ok {
+		switch s := v.(type) {
+		case evaluator.A0String:
+			if !localeTag.MatchString(s.Value) {
+				return nil, fmt.Errorf("%s: 'locale' must be a language tag such as \"en\" or \"sv-SE\", got %q", fn, s.Value)
+			}
+			c.locale = true
+			c.tailoring = tailorings[strings.ToLower(strings.FieldsFunc(s.Value, isTagSep)[0])]
+			set = true
+		case evaluator.A0Null:
+		default:
+			return nil, fmt.Errorf("%s: 'locale' must be a string", fn)
+		}
+	}
+	if !set {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func isTagSep(r rune) bool { return r == '-' || r == '_' }
+
+// compare returns -1, 0 or 1.
+func (c *collator) compare(a, b string) int {
+	if !c.locale {
+		if c.caseInsensitive {
+			return compareRunes([]rune(foldCase(a)), []rune(foldCase(b)))
+		}
+		return strings.Compare(a, b)
+	}
+	ka, kb := c.key(a), c.key(b)
+	if d := compareRunes(ka.primary, kb.primary); d != 0 {
+		return d
+	}
+	if d := compareInts(ka.secondary, kb.secondary); d != 0 {
+		return d
+	}
+	if c.caseInsensitive {
+		return 0
+	}
+	return compareInts(ka.tertiary, kb.tertiary)
+}
+
+type collationKey struct {
+	primary   []rune
+	secondary []int
+	tertiary  []int
+}
+
+func (c *collator) key(s string) collationKey {
+	var k collationKey
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		caseWeight := 0
+		if lower != r {
+			caseWeight = 1
+		}
+		for _, e := range c.elements(lower) {
+			k.primary = append(k.primary, e.primary)
+			k.secondary = append(k.secondary, e.secondary)
+			k.tertiary = append(k.tertiary, caseWeight)
+		}
+	}
+	return k
+}
+
+func (c *collator) elements(r rune) []collationElement {
+	if e, ok := c.tailoring[r]; ok {
+		return []collationElement{e}
+	}
+	if exp, ok := expansions[r]; ok {
+		out := make([]collationElement, 0, len(exp))
+		for _, x := range exp {
+			out = append(out, collationElement{primary: x * 4})
+		}
+		return out
+	}
+	if e, ok := accented[r]; ok {
+		return []collationElement{e}
+	}
+	return []collationElement{{primary: r * 4}}
+}
+
+func foldCase(s string) string {
+	return strings.Map(unicode.ToLower, s)
+}
+
+func compareRunes(a, b []rune) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// accented maps lowercase Latin letters with diacritics to their base
+// letter; the secondary weight is the letter's position in its row.
+var accented = func() map[rune]collationElement {
+	rows := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņň",
+		'o': "òóôõöøōŏő",
+		'r': "ŕŗř",
+		's': "śŝşš",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűų",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+	m := make(map[rune]collationElement)
+	for base, row := range rows {
+		i := 0
+		for _, r := range row {
+			i++
+			m[r] = collationElement{primary: base * 4, secondary: i}
+		}
+	}
+	return m
+}()
+
+// expansions sort as two letters.
+var expansions = map[rune][]rune{
+	'æ': {'a', 'e'},
+	'œ': {'o', 'e'},
+	'ß': {'s', 's'},
+}
+
+// tailorings place the Nordic letters after z, by language subtag.
+var tailorings = func() map[string]map[rune]collationElement {
+	const afterZ = 'z'*4 + 1
+	swedish := map[rune]collationElement{
+		'å': {primary: afterZ},
+		'ä': {primary: afterZ + 1},
+		'æ': {primary: afterZ + 1, secondary: 1},
+		'ö': {primary: afterZ + 2},
+		'ø': {primary: afterZ + 2, secondary: 1},
+	}
+	danish := map[rune]collationElement{
+		'æ': {primary: afterZ},
+		'ä': {primary: afterZ, secondary: 1},
+		'ø': {primary: afterZ + 1},
+		'ö': {primary: afterZ + 1, secondary: 1},
+		'å': {primary: afterZ + 2},
+	}
+	return map[string]map[rune]collationElement{
+		"sv": swedish, "fi": swedish,
+		"da": danish, "nb": danish, "nn": danish, "no": danish,
+	}
+}()
+
+// str.compare { a: str, b: str, caseInsensitive?: bool, locale?: str } → -1 | 0 | 1
+func stdlibStrCompare(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	aVal, _ := args.Get("a")
+	bVal, _ := args.Get("b")
+	aStr, aOk := aVal.(evaluator.A0String)
+	bStr, bOk := bVal.(evaluator.A0String)
+	if !aOk || !bOk {
+		return nil, fmt.Errorf("str.compare: 'a' and 'b' must be strings")
+	}
+	c, err := collatorFromArgs("str.compare", args)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return evaluator.NewNumber(float64(strings.Compare(aStr.Value, bStr.Value))), nil
+	}
+	return evaluator.NewNumber(float64(c.compare(aStr.Value, bStr.Value))), nil
+}
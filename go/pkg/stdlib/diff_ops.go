@@ -0,0 +1,336 @@
+package stdlib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// diff.json { a: any, b: any } → list of JSON Patch ops
+//
+// The ops are RFC 6902 add/remove/replace records with JSON Pointer paths,
+// in an order that patch { in: a, ops } applies to get b: within a list,
+// removals run from the end so earlier indexes stay valid.
+func stdlibDiffJSON(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	a, aOk := args.Get("a")
+	b, bOk := args.Get("b")
+	if !aOk || !bOk {
+		return nil, fmt.Errorf("diff.json: 'a' and 'b' are required")
+	}
+	var ops []evaluator.A0Value
+	diffJSONInto(&ops, "", a, b)
+	return evaluator.NewList(ops), nil
+}
+
+func diffJSONInto(ops *[]evaluator.A0Value, path string, a, b evaluator.A0Value) {
+	if evaluator.DeepEqual(a, b) {
+		return
+	}
+	switch av := a.(type) {
+	case evaluator.A0Record:
+		bv, ok := b.(evaluator.A0Record)
+		if !ok {
+			break
+		}
+		for _, kv := range av.Pairs() {
+			if _, found := bv.Get(kv.Key); !found {
+				*ops = append(*ops, patchOp("remove", path+"/"+escapePointer(kv.Key), nil))
+			}
+		}
+		for _, kv := range av.Pairs() {
+			if other, found := bv.Get(kv.Key); found {
+				diffJSONInto(ops, path+"/"+escapePointer(kv.Key), kv.Value, other)
+			}
+		}
+		for _, kv := range bv.Pairs() {
+			if _, found := av.Get(kv.Key); !found {
+				*ops = append(*ops, patchOp("add", path+"/"+escapePointer(kv.Key), kv.Value))
+			}
+		}
+		return
+	case evaluator.A0List:
+		bv, ok := b.(evaluator.A0List)
+		if !ok {
+			break
+		}
+		common := min(len(av.Items), len(bv.Items))
+		for i := 0; i < common; i++ {
+			diffJSONInto(ops, path+"/"+strconv.Itoa(i), av.Items[i], bv.Items[i])
+		}
+		for i := len(av.Items) - 1; i >= common; i-- {
+			*ops = append(*ops, patchOp("remove", path+"/"+strconv.Itoa(i), nil))
+		}
+		for i := common; i < len(bv.Items); i++ {
+			*ops = append(*ops, patchOp("add", path+"/"+strconv.Itoa(i), bv.Items[i]))
+		}
+		return
+	}
+	*ops = append(*ops, patchOp("replace", path, b))
+}
+
+func patchOp(op, path string, value evaluator.A0Value) evaluator.A0Value {
+	pairs := []evaluator.KeyValue{
+		{Key: "op", Value: evaluator.NewString(op)},
+		{Key: "path", Value: evaluator.NewString(path)},
+	}
+	if value != nil {
+		pairs = append(pairs, evaluator.KeyValue{Key: "value", Value: value})
+	}
+	return evaluator.NewRecord(pairs)
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(key string) string {
+	return pointerEscaper.Replace(key)
+}
+
+// diff.text { a: string, b: string, context?: 3, aName?: "a", bName?: "b" } → list of strings
+//
+// The lines of a unified diff, as diff -u and git diff print them, without
+// newlines. Equal texts give an empty list.
+func stdlibDiffText(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	aVal, _ := args.Get("a")
+	bVal, _ := args.Get("b")
+	aStr, aOk := aVal.(evaluator.A0String)
+	bStr, bOk := bVal.(evaluator.A0String)
+	if !aOk || !bOk {
+		return nil, fmt.Errorf("diff.text: 'a' and 'b' must be strings")
+	}
+	context := 3
+	if cv, ok := args.Get("context"); ok {
+		switch c := cv.(type) {
+		case evaluator.A0Number:
+			if c.Value < 0 || c.Value != float64(int(c.Value)) {
+				return nil, fmt.Errorf("diff.text: 'context' must be a non-negative integer")
+			}
+			context = int(c.Value)
+		case evaluator.A0Null:
+		default:
+			return nil, fmt.Errorf("diff.text: 'context' must be a number")
+		}
+	}
+	names := [2]string{"a", "b"}
+	for i, key := range []string{"aName", "bName"} {
+		if nv, ok := args.Get(key); ok {
+			switch n := nv.(type) {
+			case evaluator.A0String:
+				names[i] = n.Value
+			case evaluator.A0Null:
+			default:
+				return nil, fmt.Errorf("diff.text: '%s' must be a string", key)
+			}
+		}
+	}
+
+	lines := unifiedDiff(splitDiffLines(aStr.Value), splitDiffLines(bStr.Value), names[0], names[1], context)
+	items := make([]evaluator.A0Value, len(lines))
+	for i, l := range lines {
+		items[i] = evaluator.NewString(l)
+	}
+	return evaluator.NewList(items), nil
+}
+
+// diffLine is one line of text. Only the last line of a text can lack its
+// newline; it then differs from the same text with one.
+type diffLine struct {
+	text       string
+	terminated bool
+}
+
+func splitDiffLines(s string) []diffLine {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, "\n")
+	lines := make([]diffLine, 0, len(parts))
+	for i, p := range parts {
+		if i == len(parts)-1 {
+			if p != "" {
+				lines = append(lines, diffLine{text: p})
+			}
+			break
+		}
+		lines = append(lines, diffLine{text: p, terminated: true})
+	}
+	return lines
+}
+
+// edit is one step of an edit script: ' ' keeps a[ai] (== b[bi]), '-'
+// deletes a[ai], '+' inserts b[bi].
+type edit struct {
+	kind   byte
+	ai, bi int
+}
+
+// myersDiff returns a shortest edit script from a to b (Myers, 1986).
+// Common leading and trailing lines are matched first, so a small edit to
+// a large text keeps the search, and the trace it records, small.
+func myersDiff(a, b []diffLine) []edit {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var script []edit
+	for i := 0; i < pre; i++ {
+		script = append(script, edit{' ', i, i})
+	}
+	for _, e := range myersMiddle(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		script = append(script, edit{e.kind, e.ai + pre, e.bi + pre})
+	}
+	for i := suf; i > 0; i-- {
+		script = append(script, edit{' ', len(a) - i, len(b) - i})
+	}
+	return script
+}
+
+// myersMiddle runs the greedy search. trace[d] holds the frontier for
+// diagonals -d-1..d+1 before round d, which is what walking the path back
+// from the end needs.
+func myersMiddle(a, b []diffLine) []edit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, d, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, d, n, m int) []edit {
+	var script []edit
+	x, y := n, m
+	for ; d > 0; d-- {
+		k := x - y
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d+1] }
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, edit{' ', x, y})
+		}
+		if x == prevX {
+			y--
+			script = append(script, edit{'+', x, y})
+		} else {
+			x--
+			script = append(script, edit{'-', x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		script = append(script, edit{' ', x, y})
+	}
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// unifiedDiff groups the edit script into hunks with context lines of
+// unchanged text around each change.
+func unifiedDiff(a, b []diffLine, aName, bName string, context int) []string {
+	script := myersDiff(a, b)
+	var out []string
+	for i := 0; i < len(script); {
+		if script[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := max(0, i-context)
+		end := i
+		for end < len(script) {
+			if script[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].kind == ' ' {
+				run++
+			}
+			if run == len(script) || run-end > 2*context {
+				end = min(run, end+context)
+				break
+			}
+			end = run
+		}
+		if out == nil {
+			out = []string{"--- " + aName, "+++ " + bName}
+		}
+		out = append(out, hunkHeader(script[start:end]))
+		for _, e := range script[start:end] {
+			var line diffLine
+			if e.kind == '+' {
+				line = b[e.bi]
+			} else {
+				line = a[e.ai]
+			}
+			out = append(out, string(e.kind)+line.text)
+			if !line.terminated {
+				out = append(out, `\ No newline at end of file`)
+			}
+		}
+		i = end
+	}
+	return out
+}
+
+func hunkHeader(hunk []edit) string {
+	aStart, bStart := hunk[0].ai, hunk[0].bi
+	aLen, bLen := 0, 0
+	for _, e := range hunk {
+		if e.kind != '+' {
+			aLen++
+		}
+		if e.kind != '-' {
+			bLen++
+		}
+	}
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+}
+
+// hunkRange formats a range the way diff -u does: 1-based, the length
+// omitted when it is 1, and an empty range named by the line before it.
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return strconv.Itoa(start) + ",0"
+	case 1:
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
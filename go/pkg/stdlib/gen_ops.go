@@ -0,0 +1,102 @@
+package stdlib
+
+import (
+	"fmt"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// Generators are plain records tagged with a "gen" kind; forall (handled by
+// the evaluator) draws values from them.
+
+// gen.int { min?, max? } → generator of integers in [min, max]
+func stdlibGenInt(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	min, err := genBound(args, "gen.int", "min", 0)
+	if err != nil {
+		return nil, err
+	}
+	max, err := genBound(args, "gen.int", "max", 100)
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, fmt.Errorf("gen.int: 'max' must not be less than 'min'")
+	}
+	return evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "gen", Value: evaluator.NewString("int")},
+		{Key: "min", Value: evaluator.NewNumber(min)},
+		{Key: "max", Value: evaluator.NewNumber(max)},
+	}), nil
+}
+
+// gen.string { minLen?, maxLen?, alphabet? } → generator of strings
+func stdlibGenString(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	minLen, maxLen, err := genLengths(args, "gen.string", 16)
+	if err != nil {
+		return nil, err
+	}
+	alphabet := evaluator.DefaultGenAlphabet
+	if v, ok := args.Get("alphabet"); ok {
+		s, ok := v.(evaluator.A0String)
+		if !ok || s.Value == "" {
+			return nil, fmt.Errorf("gen.string: 'alphabet' must be a non-empty string")
+		}
+		alphabet = s.Value
+	}
+	return evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "gen", Value: evaluator.NewString("string")},
+		{Key: "minLen", Value: evaluator.NewNumber(minLen)},
+		{Key: "maxLen", Value: evaluator.NewNumber(maxLen)},
+		{Key: "alphabet", Value: evaluator.NewString(alphabet)},
+	}), nil
+}
+
+// gen.list { of, minLen?, maxLen? } → generator of lists of 'of' values
+func stdlibGenList(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	of, ok := args.Get("of")
+	if !ok {
+		return nil, fmt.Errorf("gen.list: 'of' is required")
+	}
+	minLen, maxLen, err := genLengths(args, "gen.list", 10)
+	if err != nil {
+		return nil, err
+	}
+	return evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "gen", Value: evaluator.NewString("list")},
+		{Key: "of", Value: of},
+		{Key: "minLen", Value: evaluator.NewNumber(minLen)},
+		{Key: "maxLen", Value: evaluator.NewNumber(maxLen)},
+	}), nil
+}
+
+// forall stub — the evaluator intercepts forall to call the user fn
+func stdlibForallStub(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	return nil, fmt.Errorf("forall must be called through evaluator")
+}
+
+func genBound(args *evaluator.A0Record, name, key string, def float64) (float64, error) {
+	v, ok := args.Get(key)
+	if !ok {
+		return def, nil
+	}
+	n, ok := v.(evaluator.A0Number)
+	if !ok || n.Value != float64(int64(n.Value)) {
+		return 0, fmt.Errorf("%s: '%s' must be an integer", name, key)
+	}
+	return n.Value, nil
+}
+
+func genLengths(args *evaluator.A0Record, name string, defMax float64) (float64, float64, error) {
+	minLen, err := genBound(args, name, "minLen", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxLen, err := genBound(args, name, "maxLen", defMax)
+	if err != nil {
+		return 0, 0, err
+	}
+	if minLen < 0 || maxLen < minLen {
+		return 0, 0, fmt.Errorf("%s: need 0 <= minLen <= maxLen", name)
+	}
+	return minLen, maxLen, nil
+}
@@ -20,10 +20,7 @@ func stdlibAppend(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if !ok {
 		return nil, fmt.Errorf("append: 'in' must be a list")
 	}
-	newItems := make([]evaluator.A0Value, len(list.Items)+1)
-	copy(newItems, list.Items)
-	newItems[len(list.Items)] = value
-	return evaluator.NewList(newItems), nil
+	return list.Append(value), nil
 }
 
 // concat { a: list, b: list } → list
@@ -41,7 +38,7 @@ func stdlibConcat(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	return evaluator.NewList(newItems), nil
 }
 
-// sort { in: list, by?: string|list } → list
+// sort { in: list, by?: string|list, caseInsensitive?: bool, locale?: string } → list
 func stdlibSort(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	input, _ := args.Get("in")
 	byVal, _ := args.Get("by")
@@ -73,17 +70,33 @@ func stdlibSort(args *evaluator.A0Record) (evaluator.A0Value, error) {
 		}
 	}
 
+	if keys == nil {
+		if err := checkSameType("sort", list.Items, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range keys {
+		if err := checkSameType("sort", list.Items, key); err != nil {
+			return nil, err
+		}
+	}
+
+	coll, err := collatorFromArgs("sort", args)
+	if err != nil {
+		return nil, err
+	}
+
 	sorted := make([]evaluator.A0Value, len(list.Items))
 	copy(sorted, list.Items)
 
 	sort.SliceStable(sorted, func(i, j int) bool {
 		if keys == nil {
-			return compareValues(sorted[i], sorted[j]) < 0
+			return collateValues(sorted[i], sorted[j], coll) < 0
 		}
 		for _, key := range keys {
 			a := getRecordField(sorted[i], key)
 			b := getRecordField(sorted[j], key)
-			cmp := compareValues(a, b)
+			cmp := collateValues(a, b, coll)
 			if cmp != 0 {
 				return cmp < 0
 			}
@@ -94,6 +107,64 @@ func stdlibSort(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	return evaluator.NewList(sorted), nil
 }
 
+// checkSameType reports the first item whose type differs from the items
+// before it, comparing the field key of each record when key is set. Nulls
+// (and missing fields) are allowed anywhere; they sort last.
+func checkSameType(fn string, items []evaluator.A0Value, key string) error {
+	what := func(i int) string {
+		if key == "" {
+			return fmt.Sprintf("element %d", i)
+		}
+		return fmt.Sprintf("'%s' of element %d", key, i)
+	}
+	first := -1
+	var firstType string
+	for i, item := range items {
+		if key != "" {
+			item = getRecordField(item, key)
+		}
+		if _, isNull := item.(evaluator.A0Null); isNull {
+			continue
+		}
+		if first < 0 {
+			first, firstType = i, typeName(item)
+			continue
+		}
+		if t := typeName(item); t != firstType {
+			return fmt.Errorf("%s: %s has type %s but %s has type %s; values must all have one type",
+				fn, what(i), t, what(first), firstType)
+		}
+	}
+	return nil
+}
+
+// checkElements reports the index and type of the first item accepted
+// rejects, so a bad element is named instead of failing later with a
+// generic message.
+func checkElements(fn string, items []evaluator.A0Value, accepted func(evaluator.A0Value) bool, expected string) error {
+	for i, item := range items {
+		if !accepted(item) {
+			return fmt.Errorf("%s: element %d has type %s; %s", fn, i, typeName(item), expected)
+		}
+	}
+	return nil
+}
+
+// isScalar reports whether v is joined as text: a string, number, boolean
+// or null.
+func isScalar(v evaluator.A0Value) bool {
+	switch v.(type) {
+	case evaluator.A0List, evaluator.A0Record:
+		return false
+	}
+	return true
+}
+
+func isNumber(v evaluator.A0Value) bool {
+	_, ok := v.(evaluator.A0Number)
+	return ok
+}
+
 func getRecordField(v evaluator.A0Value, key string) evaluator.A0Value {
 	if rec, ok := v.(evaluator.A0Record); ok {
 		if val, found := rec.Get(key); found {
@@ -103,6 +174,19 @@ func getRecordField(v evaluator.A0Value, key string) evaluator.A0Value {
 	return evaluator.NewNull()
 }
 
+// collateValues is compareValues with strings compared by coll when it is
+// set.
+func collateValues(a, b evaluator.A0Value, coll *collator) int {
+	if coll != nil {
+		aStr, aIsStr := a.(evaluator.A0String)
+		bStr, bIsStr := b.(evaluator.A0String)
+		if aIsStr && bIsStr {
+			return coll.compare(aStr.Value, bStr.Value)
+		}
+	}
+	return compareValues(a, b)
+}
+
 func compareValues(a, b evaluator.A0Value) int {
 	aNum, aIsNum := a.(evaluator.A0Number)
 	bNum, bIsNum := b.(evaluator.A0Number)
@@ -217,6 +301,9 @@ func stdlibJoin(args *evaluator.A0Record) (evaluator.A0Value, error) {
 		}
 	}
 
+	if err := checkElements("join", list.Items, isScalar, "elements must be strings, numbers, booleans or null"); err != nil {
+		return nil, err
+	}
 	parts := make([]string, len(list.Items))
 	for i, item := range list.Items {
 		parts[i] = valueToString(item)
@@ -256,16 +343,20 @@ func stdlibUnique(args *evaluator.A0Record) (evaluator.A0Value, error) {
 		return nil, fmt.Errorf("unique: 'in' must be a list")
 	}
 
+	// Bucket by structural hash so only colliding items are compared deeply.
 	var result []evaluator.A0Value
+	seen := make(map[uint64][]evaluator.A0Value, len(list.Items))
 	for _, item := range list.Items {
+		h := evaluator.Hash(item)
 		found := false
-		for _, existing := range result {
+		for _, existing := range seen[h] {
 			if evaluator.DeepEqual(existing, item) {
 				found = true
 				break
 			}
 		}
 		if !found {
+			seen[h] = append(seen[h], item)
 			result = append(result, item)
 		}
 	}
@@ -0,0 +1,199 @@
+package stdlib
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// md.table { rows: list, headers?: list } → string
+//
+// Rows are records, read by header, or lists, read by position. Without
+// headers, record rows use every key in the order first seen.
+func stdlibMdTable(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	rowsVal, _ := args.Get("rows")
+	rows, ok := rowsVal.(evaluator.A0List)
+	if !ok {
+		return nil, fmt.Errorf("md.table: 'rows' must be a list")
+	}
+
+	var headers []string
+	if hv, ok := args.Get("headers"); ok {
+		if _, isNull := hv.(evaluator.A0Null); !isNull {
+			list, ok := hv.(evaluator.A0List)
+			if !ok {
+				return nil, fmt.Errorf("md.table: 'headers' must be a list of strings")
+			}
+			for i, h := range list.Items {
+				s, ok := h.(evaluator.A0String)
+				if !ok {
+					return nil, fmt.Errorf("md.table: header %d has type %s; headers must be strings", i, typeName(h))
+				}
+				headers = append(headers, s.Value)
+			}
+		}
+	}
+
+	cells := make([][]string, 0, len(rows.Items))
+	seen := map[string]bool{}
+	inferHeaders := headers == nil
+	for i, row := range rows.Items {
+		switch r := row.(type) {
+		case evaluator.A0Record:
+			if inferHeaders {
+				for _, kv := range r.Pairs() {
+					if !seen[kv.Key] {
+						seen[kv.Key] = true
+						headers = append(headers, kv.Key)
+					}
+				}
+			}
+			cells = append(cells, nil)
+		case evaluator.A0List:
+			if inferHeaders {
+				return nil, fmt.Errorf("md.table: row %d is a list; list rows need 'headers'", i)
+			}
+			line := make([]string, len(headers))
+			for j := range line {
+				if j < len(r.Items) {
+					line[j] = mdCell(r.Items[j])
+				}
+			}
+			cells = append(cells, line)
+		default:
+			return nil, fmt.Errorf("md.table: row %d has type %s; rows must be records or lists", i, typeName(row))
+		}
+	}
+	// Record rows are read once every header is known.
+	for i, row := range rows.Items {
+		if r, ok := row.(evaluator.A0Record); ok {
+			line := make([]string, len(headers))
+			for j, h := range headers {
+				if v, found := r.Get(h); found {
+					line[j] = mdCell(v)
+				}
+			}
+			cells[i] = line
+		}
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("md.table: no columns; pass 'headers' or non-empty record rows")
+	}
+
+	var b strings.Builder
+	writeMdRow(&b, headers, mdEscapeCell)
+	sep := make([]string, len(headers))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	writeMdRow(&b, sep, nil)
+	for _, line := range cells {
+		writeMdRow(&b, line, nil)
+	}
+	return evaluator.NewString(strings.TrimSuffix(b.String(), "\n")), nil
+}
+
+func writeMdRow(b *strings.Builder, cells []string, escape func(string) string) {
+	b.WriteString("|")
+	for _, c := range cells {
+		if escape != nil {
+			c = escape(c)
+		}
+		b.WriteString(" ")
+		b.WriteString(c)
+		b.WriteString(" |")
+	}
+	b.WriteString("\n")
+}
+
+// mdCell renders a value as table cell text; null is an empty cell.
+func mdCell(v evaluator.A0Value) string {
+	if _, isNull := v.(evaluator.A0Null); isNull {
+		return ""
+	}
+	return mdEscapeCell(valueToString(v))
+}
+
+// mdEscapeCell keeps a value inside its cell: pipes would start a new
+// column and newlines a new row.
+func mdEscapeCell(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+var mdLinkText = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`)
+
+var mdLinkURL = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", "\n", "", "\r", "")
+
+// md.link { text: string, url: string } → string
+func stdlibMdLink(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	textVal, _ := args.Get("text")
+	urlVal, _ := args.Get("url")
+	text, ok := textVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("md.link: 'text' must be a string")
+	}
+	url, ok := urlVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("md.link: 'url' must be a string")
+	}
+	return evaluator.NewString("[" + mdLinkText.Replace(text.Value) + "](" + mdLinkURL.Replace(url.Value) + ")"), nil
+}
+
+// md.codeBlock { in: string, lang?: string } → string
+//
+// The fence is one backtick longer than the longest run in the code, so
+// code containing ``` cannot close the block early.
+func stdlibMdCodeBlock(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	inVal, _ := args.Get("in")
+	in, ok := inVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("md.codeBlock: 'in' must be a string")
+	}
+	lang := ""
+	if lv, ok := args.Get("lang"); ok {
+		switch l := lv.(type) {
+		case evaluator.A0String:
+			if strings.ContainsAny(l.Value, "`\n") {
+				return nil, fmt.Errorf("md.codeBlock: 'lang' cannot contain backticks or newlines")
+			}
+			lang = l.Value
+		case evaluator.A0Null:
+		default:
+			return nil, fmt.Errorf("md.codeBlock: 'lang' must be a string")
+		}
+	}
+
+	longest, run := 0, 0
+	for _, r := range in.Value {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	var b strings.Builder
+	b.WriteString(fence + lang + "\n" + in.Value)
+	if !strings.HasSuffix(in.Value, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(fence)
+	return evaluator.NewString(b.String()), nil
+}
+
+// html.escape { in: string } → string
+func stdlibHTMLEscape(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	inVal, _ := args.Get("in")
+	in, ok := inVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("html.escape: 'in' must be a string")
+	}
+	return evaluator.NewString(html.EscapeString(in.Value)), nil
+}
@@ -17,13 +17,13 @@ func stdlibMathMax(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if len(list.Items) == 0 {
 		return nil, fmt.Errorf("math.max: list must not be empty")
 	}
+	if err := checkElements("math.max", list.Items, isNumber, "all elements must be numbers"); err != nil {
+		return nil, err
+	}
 
 	max := math.Inf(-1)
 	for _, item := range list.Items {
-		num, ok := item.(evaluator.A0Number)
-		if !ok {
-			return nil, fmt.Errorf("math.max: all elements must be numbers")
-		}
+		num := item.(evaluator.A0Number)
 		if num.Value > max {
 			max = num.Value
 		}
@@ -41,16 +41,36 @@ func stdlibMathMin(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if len(list.Items) == 0 {
 		return nil, fmt.Errorf("math.min: list must not be empty")
 	}
+	if err := checkElements("math.min", list.Items, isNumber, "all elements must be numbers"); err != nil {
+		return nil, err
+	}
 
 	min := math.Inf(1)
 	for _, item := range list.Items {
-		num, ok := item.(evaluator.A0Number)
-		if !ok {
-			return nil, fmt.Errorf("math.min: all elements must be numbers")
-		}
+		num := item.(evaluator.A0Number)
 		if num.Value < min {
 			min = num.Value
 		}
 	}
 	return evaluator.NewNumber(min), nil
 }
+
+// approxEq { a, b, tolerance? } → bool
+func stdlibApproxEq(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	aVal, _ := args.Get("a")
+	bVal, _ := args.Get("b")
+	a, aOK := aVal.(evaluator.A0Number)
+	b, bOK := bVal.(evaluator.A0Number)
+	if !aOK || !bOK {
+		return nil, fmt.Errorf("approxEq: 'a' and 'b' must be numbers")
+	}
+	tolerance := evaluator.DefaultApproxTolerance
+	if tolVal, found := args.Get("tolerance"); found {
+		tol, ok := tolVal.(evaluator.A0Number)
+		if !ok || tol.Value < 0 {
+			return nil, fmt.Errorf("approxEq: 'tolerance' must be a non-negative number")
+		}
+		tolerance = tol.Value
+	}
+	return evaluator.NewBool(evaluator.ApproxEqual(a.Value, b.Value, tolerance)), nil
+}
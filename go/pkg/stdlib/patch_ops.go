@@ -1,6 +1,7 @@
 package stdlib
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -8,7 +9,13 @@ import (
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
 )
 
-// patch { in: any, ops: list } → any (RFC 6902 JSON Patch)
+// patch { in: any, ops: list | string } → any (RFC 6902 JSON Patch)
+//
+// ops is a list of operation records or the JSON text of a patch document,
+// as other JSON Patch tools write it. The ops apply in order and the patch
+// is atomic: the first failing op fails the call, naming its index, and in
+// is never partly patched. diff.json produces such an op list from two
+// documents.
 func stdlibPatch(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	doc, _ := args.Get("in")
 	opsVal, _ := args.Get("ops")
@@ -16,6 +23,13 @@ func stdlibPatch(args *evaluator.A0Record) (evaluator.A0Value, error) {
 		doc = evaluator.NewNull()
 	}
 
+	if text, ok := opsVal.(evaluator.A0String); ok {
+		parsed, err := evaluator.ParseJSONToValue(json.RawMessage(text.Value))
+		if err != nil {
+			return nil, fmt.Errorf("patch: 'ops' is not a JSON Patch document: %v", err)
+		}
+		opsVal = parsed
+	}
 	opsList, ok := opsVal.(evaluator.A0List)
 	if !ok {
 		return nil, fmt.Errorf("patch requires 'ops' to be a list")
@@ -25,16 +39,46 @@ func stdlibPatch(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	for i, opItem := range opsList.Items {
 		opRec, ok := opItem.(evaluator.A0Record)
 		if !ok {
-			return nil, fmt.Errorf("invalid op at index %d", i)
+			return nil, patchOpError(i, nil, fmt.Errorf("must be a record, got %s", typeName(opItem)))
 		}
 		doc, err = applyPatchOp(doc, &opRec)
 		if err != nil {
-			return nil, err
+			return nil, patchOpError(i, &opRec, err)
 		}
 	}
 	return doc, nil
 }
 
+// patchOpError names the op that failed. Its details, { index, op?, path?,
+// from? }, end up on the E_FN error.
+func patchOpError(index int, op *evaluator.A0Record, err error) error {
+	details := []evaluator.KeyValue{{Key: "index", Value: evaluator.NewNumber(float64(index))}}
+	where := ""
+	if op != nil {
+		for _, key := range []string{"op", "path", "from"} {
+			if v, ok := op.Get(key); ok {
+				if s, isStr := v.(evaluator.A0String); isStr {
+					details = append(details, evaluator.KeyValue{Key: key, Value: s})
+				}
+			}
+		}
+		opName, _ := op.Get("op")
+		path, _ := op.Get("path")
+		if o, ok := opName.(evaluator.A0String); ok {
+			where = " (" + o.Value
+			if p, ok := path.(evaluator.A0String); ok {
+				where += " " + strconv.Quote(p.Value)
+			}
+			where += ")"
+		}
+	}
+	rec := evaluator.NewRecord(details).(evaluator.A0Record)
+	return &evaluator.A0RuntimeError{
+		Message: fmt.Sprintf("op %d%s: %v", index, where, err),
+		Details: &rec,
+	}
+}
+
 func applyPatchOp(doc evaluator.A0Value, op *evaluator.A0Record) (evaluator.A0Value, error) {
 	opVal, _ := op.Get("op")
 	pathVal, _ := op.Get("path")
@@ -48,13 +92,16 @@ func applyPatchOp(doc evaluator.A0Value, op *evaluator.A0Record) (evaluator.A0Va
 		return nil, fmt.Errorf("patch op requires a 'path' string")
 	}
 
-	segments := parseJSONPointer(pathStr.Value)
+	segments, err := parseJSONPointer(pathStr.Value)
+	if err != nil {
+		return nil, err
+	}
 
 	switch opStr.Value {
 	case "add":
-		value, _ := op.Get("value")
-		if value == nil {
-			value = evaluator.NewNull()
+		value, err := requiredPatchValue(op, "add")
+		if err != nil {
+			return nil, err
 		}
 		return setAtPointer(doc, segments, value, "add", pathStr.Value)
 
@@ -62,46 +109,51 @@ func applyPatchOp(doc evaluator.A0Value, op *evaluator.A0Record) (evaluator.A0Va
 		return removeAtPointer(doc, segments, pathStr.Value)
 
 	case "replace":
-		value, _ := op.Get("value")
-		if value == nil {
-			value = evaluator.NewNull()
+		value, err := requiredPatchValue(op, "replace")
+		if err != nil {
+			return nil, err
 		}
 		return setAtPointer(doc, segments, value, "replace", pathStr.Value)
 
 	case "move":
-		fromVal, _ := op.Get("from")
-		fromStr, ok := fromVal.(evaluator.A0String)
-		if !ok {
-			return nil, fmt.Errorf("move op requires a 'from' string")
+		from, fromSegs, err := patchFrom(op, "move")
+		if err != nil {
+			return nil, err
+		}
+		if from == pathStr.Value {
+			if _, found := getAtPointer(doc, fromSegs); !found {
+				return nil, fmt.Errorf("Path '%s' does not exist for op 'move'.", from)
+			}
+			return doc, nil
+		}
+		if strings.HasPrefix(pathStr.Value, from+"/") {
+			return nil, fmt.Errorf("Cannot move '%s' into its own child '%s'.", from, pathStr.Value)
 		}
-		fromSegs := parseJSONPointer(fromStr.Value)
 		val, found := getAtPointer(doc, fromSegs)
 		if !found {
-			return nil, fmt.Errorf("Path '%s' does not exist for op 'move'.", fromStr.Value)
+			return nil, fmt.Errorf("Path '%s' does not exist for op 'move'.", from)
 		}
-		doc, err := removeAtPointer(doc, fromSegs, fromStr.Value)
+		doc, err := removeAtPointer(doc, fromSegs, from)
 		if err != nil {
 			return nil, err
 		}
 		return setAtPointer(doc, segments, cloneValue(val), "add", pathStr.Value)
 
 	case "copy":
-		fromVal, _ := op.Get("from")
-		fromStr, ok := fromVal.(evaluator.A0String)
-		if !ok {
-			return nil, fmt.Errorf("copy op requires a 'from' string")
+		from, fromSegs, err := patchFrom(op, "copy")
+		if err != nil {
+			return nil, err
 		}
-		fromSegs := parseJSONPointer(fromStr.Value)
 		val, found := getAtPointer(doc, fromSegs)
 		if !found {
-			return nil, fmt.Errorf("Path '%s' does not exist for op 'copy'.", fromStr.Value)
+			return nil, fmt.Errorf("Path '%s' does not exist for op 'copy'.", from)
 		}
 		return setAtPointer(doc, segments, cloneValue(val), "add", pathStr.Value)
 
 	case "test":
-		value, _ := op.Get("value")
-		if value == nil {
-			value = evaluator.NewNull()
+		value, err := requiredPatchValue(op, "test")
+		if err != nil {
+			return nil, err
 		}
 		actual, found := getAtPointer(doc, segments)
 		if !found {
@@ -120,20 +172,50 @@ func applyPatchOp(doc evaluator.A0Value, op *evaluator.A0Record) (evaluator.A0Va
 	}
 }
 
-func parseJSONPointer(pointer string) []string {
+// requiredPatchValue returns the op's value member. RFC 6902 requires it
+// for add, replace and test; an explicit null is a value.
+func requiredPatchValue(op *evaluator.A0Record, name string) (evaluator.A0Value, error) {
+	value, ok := op.Get("value")
+	if !ok || value == nil {
+		return nil, fmt.Errorf("%s op requires a 'value'", name)
+	}
+	return value, nil
+}
+
+func patchFrom(op *evaluator.A0Record, name string) (string, []string, error) {
+	fromVal, _ := op.Get("from")
+	fromStr, ok := fromVal.(evaluator.A0String)
+	if !ok {
+		return "", nil, fmt.Errorf("%s op requires a 'from' string", name)
+	}
+	segs, err := parseJSONPointer(fromStr.Value)
+	if err != nil {
+		return "", nil, err
+	}
+	return fromStr.Value, segs, nil
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into unescaped reference
+// tokens. "" is the whole document; any other pointer starts with "/".
+func parseJSONPointer(pointer string) ([]string, error) {
 	if pointer == "" {
-		return nil
+		return nil, nil
 	}
 	if !strings.HasPrefix(pointer, "/") {
-		return []string{pointer}
+		return nil, fmt.Errorf("Invalid JSON Pointer '%s': must be empty or start with '/'.", pointer)
 	}
 	parts := strings.Split(pointer[1:], "/")
 	for i, p := range parts {
+		for j := 0; j < len(p); j++ {
+			if p[j] == '~' && (j+1 == len(p) || (p[j+1] != '0' && p[j+1] != '1')) {
+				return nil, fmt.Errorf("Invalid JSON Pointer '%s': '~' must be followed by 0 or 1.", pointer)
+			}
+		}
 		p = strings.ReplaceAll(p, "~1", "/")
 		p = strings.ReplaceAll(p, "~0", "~")
 		parts[i] = p
 	}
-	return parts
+	return parts, nil
 }
 
 func getAtPointer(doc evaluator.A0Value, segments []string) (evaluator.A0Value, bool) {
@@ -205,8 +287,7 @@ func setAtPointer(doc evaluator.A0Value, segments []string, value evaluator.A0Va
 		return evaluator.NewList(items), nil
 
 	case evaluator.A0Record:
-		result := &evaluator.A0Record{Pairs: make([]evaluator.KeyValue, len(v.Pairs))}
-		copy(result.Pairs, v.Pairs)
+		result := &v
 
 		if len(rest) == 0 {
 			if mode == "replace" {
@@ -258,13 +339,13 @@ func removeAtPointer(doc evaluator.A0Value, segments []string, pointer string) (
 			if !found {
 				return nil, fmt.Errorf("Path '%s' does not exist for op 'remove'.", pointer)
 			}
-			result := &evaluator.A0Record{}
-			for _, kv := range v.Pairs {
+			pairs := make([]evaluator.KeyValue, 0, v.Len()-1)
+			for _, kv := range v.Pairs() {
 				if kv.Key != head {
-					result.Pairs = append(result.Pairs, kv)
+					pairs = append(pairs, kv)
 				}
 			}
-			return *result, nil
+			return evaluator.NewRecord(pairs), nil
 		}
 		return nil, fmt.Errorf("Path '%s' does not exist for op 'remove'.", pointer)
 	}
@@ -288,8 +369,7 @@ func removeAtPointer(doc evaluator.A0Value, segments []string, pointer string) (
 		if !found {
 			return nil, fmt.Errorf("Path '%s' does not exist for op 'remove'.", pointer)
 		}
-		result := &evaluator.A0Record{Pairs: make([]evaluator.KeyValue, len(v.Pairs))}
-		copy(result.Pairs, v.Pairs)
+		result := &v
 		existing, _ := result.Get(head)
 		newVal, err := removeAtPointer(existing, rest, pointer)
 		if err != nil {
@@ -310,8 +390,9 @@ func parseArrayIdx(segment string, length int, allowAppend bool, pointer string,
 		return 0, fmt.Errorf("Invalid array index '-' at '%s' for op '%s'.", pointer, op)
 	}
 
+	// RFC 6901 array indexes are decimal digits without leading zeros.
 	idx, err := strconv.Atoi(segment)
-	if err != nil {
+	if err != nil || segment[0] < '0' || segment[0] > '9' || (len(segment) > 1 && segment[0] == '0') {
 		return 0, fmt.Errorf("Invalid array index '%s' at '%s' for op '%s'.", segment, pointer, op)
 	}
 
@@ -339,8 +420,8 @@ func cloneValue(v evaluator.A0Value) evaluator.A0Value {
 		}
 		return evaluator.NewList(items)
 	case evaluator.A0Record:
-		pairs := make([]evaluator.KeyValue, len(val.Pairs))
-		for i, kv := range val.Pairs {
+		pairs := make([]evaluator.KeyValue, val.Len())
+		for i, kv := range val.Pairs() {
 			pairs[i] = evaluator.KeyValue{Key: kv.Key, Value: cloneValue(kv.Value)}
 		}
 		return evaluator.NewRecord(pairs)
@@ -118,8 +118,7 @@ func putByPath(obj evaluator.A0Value, segments []pathSegment, value evaluator.A0
 	// Record path
 	result := &evaluator.A0Record{}
 	if rec, ok := obj.(evaluator.A0Record); ok {
-		result.Pairs = make([]evaluator.KeyValue, len(rec.Pairs))
-		copy(result.Pairs, rec.Pairs)
+		result = &rec
 	}
 
 	existing, found := result.Get(seg.key)
@@ -169,3 +168,78 @@ func stdlibPut(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	segments := parsePath(pathStr.Value)
 	return putByPath(input, segments, value), nil
 }
+
+// Select reads path from v as get does; a0 run --select uses it. A leading
+// "." is optional, so "." alone selects v itself. A "[]" step applies the
+// rest of the path to every element of a list and collects the results,
+// as in ".items[].name". A missing path selects null; a malformed one, as
+// reported by CheckSelectPath, is an error.
+func Select(v evaluator.A0Value, path string) (evaluator.A0Value, error) {
+	if err := CheckSelectPath(path); err != nil {
+		return nil, err
+	}
+	return selectValue(v, path), nil
+}
+
+func selectValue(v evaluator.A0Value, path string) evaluator.A0Value {
+	i := strings.Index(path, "[]")
+	if i < 0 {
+		return getByPath(v, parsePath(path))
+	}
+	list, ok := getByPath(v, parsePath(path[:i])).(evaluator.A0List)
+	if !ok {
+		return evaluator.NewNull()
+	}
+	items := make([]evaluator.A0Value, len(list.Items))
+	for j, item := range list.Items {
+		items[j] = selectValue(item, path[i+2:])
+	}
+	return evaluator.NewList(items)
+}
+
+// CheckSelectPath reports an error if path is not a sequence of keys
+// joined by ".", integer indexes "[n]" and "[]" steps, so that a typo such
+// as "a..b" or "a[" is not mistaken for a missing value.
+func CheckSelectPath(path string) error {
+	rest := strings.TrimPrefix(path, ".")
+	if rest == "" {
+		return nil
+	}
+	for {
+		if rest[0] == '[' {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return fmt.Errorf("malformed path %q: missing ']'", path)
+			}
+			if index := rest[1:end]; index != "" {
+				if _, err := strconv.Atoi(index); err != nil {
+					return fmt.Errorf("malformed path %q: index %q is not an integer", path, index)
+				}
+			}
+			rest = rest[end+1:]
+		} else {
+			n := strings.IndexAny(rest, ".[]")
+			if n < 0 {
+				n = len(rest)
+			}
+			if n == 0 {
+				if rest[0] == '.' {
+					return fmt.Errorf("malformed path %q: empty key", path)
+				}
+				return fmt.Errorf("malformed path %q: unexpected %q", path, rest[:1])
+			}
+			rest = rest[n:]
+		}
+		switch {
+		case rest == "":
+			return nil
+		case rest[0] == '.':
+			rest = rest[1:]
+			if rest == "" {
+				return fmt.Errorf("malformed path %q: empty key", path)
+			}
+		case rest[0] != '[':
+			return fmt.Errorf("malformed path %q: unexpected %q", path, rest[:1])
+		}
+	}
+}
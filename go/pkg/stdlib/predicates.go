@@ -25,9 +25,10 @@ func stdlibContains(args *evaluator.A0Record) (evaluator.A0Value, error) {
 		return evaluator.NewBool(containsSubstring(in_.Value, valStr.Value)), nil
 
 	case evaluator.A0List:
-		// Deep element membership
+		// Deep element membership; hashes rule out most items cheaply
+		h := evaluator.Hash(value)
 		for _, item := range in_.Items {
-			if evaluator.DeepEqual(item, value) {
+			if evaluator.Hash(item) == h && evaluator.DeepEqual(item, value) {
 				return evaluator.NewBool(true), nil
 			}
 		}
@@ -105,22 +106,22 @@ func stdlibCoalesce(args *evaluator.A0Record) (evaluator.A0Value, error) {
 // typeof { in } → string
 func stdlibTypeof(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	input, _ := args.Get("in")
-	if input == nil {
-		return evaluator.NewString("null"), nil
-	}
-	switch input.(type) {
-	case evaluator.A0Null:
-		return evaluator.NewString("null"), nil
+	return evaluator.NewString(typeName(input)), nil
+}
+
+// typeName is the name typeof gives v.
+func typeName(v evaluator.A0Value) string {
+	switch v.(type) {
 	case evaluator.A0Bool:
-		return evaluator.NewString("boolean"), nil
+		return "boolean"
 	case evaluator.A0Number:
-		return evaluator.NewString("number"), nil
+		return "number"
 	case evaluator.A0String:
-		return evaluator.NewString("string"), nil
+		return "string"
 	case evaluator.A0List:
-		return evaluator.NewString("list"), nil
+		return "list"
 	case evaluator.A0Record:
-		return evaluator.NewString("record"), nil
+		return "record"
 	}
-	return evaluator.NewString("null"), nil
+	return "null"
 }
@@ -13,8 +13,8 @@ func stdlibKeys(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if !ok {
 		return nil, fmt.Errorf("keys: 'in' must be a record")
 	}
-	items := make([]evaluator.A0Value, len(rec.Pairs))
-	for i, kv := range rec.Pairs {
+	items := make([]evaluator.A0Value, rec.Len())
+	for i, kv := range rec.Pairs() {
 		items[i] = evaluator.NewString(kv.Key)
 	}
 	return evaluator.NewList(items), nil
@@ -27,8 +27,8 @@ func stdlibValues(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if !ok {
 		return nil, fmt.Errorf("values: 'in' must be a record")
 	}
-	items := make([]evaluator.A0Value, len(rec.Pairs))
-	for i, kv := range rec.Pairs {
+	items := make([]evaluator.A0Value, rec.Len())
+	for i, kv := range rec.Pairs() {
 		items[i] = kv.Value
 	}
 	return evaluator.NewList(items), nil
@@ -46,11 +46,10 @@ func stdlibMerge(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	}
 
 	// Start with a copy of a
-	result := &evaluator.A0Record{Pairs: make([]evaluator.KeyValue, len(aRec.Pairs))}
-	copy(result.Pairs, aRec.Pairs)
+	result := &aRec
 
 	// Merge b on top (b wins)
-	for _, kv := range bRec.Pairs {
+	for _, kv := range bRec.Pairs() {
 		result.Set(kv.Key, kv.Value)
 	}
 
@@ -64,12 +63,5 @@ func stdlibEntries(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if !ok {
 		return nil, fmt.Errorf("entries: 'in' must be a record")
 	}
-	items := make([]evaluator.A0Value, len(rec.Pairs))
-	for i, kv := range rec.Pairs {
-		items[i] = evaluator.NewRecord([]evaluator.KeyValue{
-			{Key: "key", Value: evaluator.NewString(kv.Key)},
-			{Key: "value", Value: kv.Value},
-		})
-	}
-	return evaluator.NewList(items), nil
+	return evaluator.NewList(rec.Entries()), nil
 }
@@ -9,6 +9,8 @@ import (
 type Fn struct {
 	Name    string
 	Execute func(args *evaluator.A0Record) (evaluator.A0Value, error)
+	// Deprecated names the replacement function, if any.
+	Deprecated string
 }
 
 // Registry holds registered stdlib functions.
@@ -2,7 +2,9 @@ package stdlib
 
 import (
 	"fmt"
+	"math"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
 )
@@ -14,6 +16,9 @@ func stdlibStrConcat(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	if !ok {
 		return nil, fmt.Errorf("str.concat: 'parts' must be a list")
 	}
+	if err := checkElements("str.concat", list.Items, isScalar, "parts must be strings, numbers, booleans or null"); err != nil {
+		return nil, err
+	}
 
 	var sb strings.Builder
 	for _, item := range list.Items {
@@ -100,7 +105,7 @@ func stdlibStrReplace(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	return evaluator.NewString(strings.ReplaceAll(inStr.Value, fromStr.Value, toString.Value)), nil
 }
 
-// str.template { in: string, vars: record } → string
+// str.template { in: string, vars: record } → string; see template.go
 func stdlibStrTemplate(args *evaluator.A0Record) (evaluator.A0Value, error) {
 	inVal, _ := args.Get("in")
 	varsVal, _ := args.Get("vars")
@@ -114,18 +119,98 @@ func stdlibStrTemplate(args *evaluator.A0Record) (evaluator.A0Value, error) {
 		return nil, fmt.Errorf("str.template: 'vars' must be a record")
 	}
 
-	result := inStr.Value
-	// Replace {key} placeholders
-	for _, kv := range varsRec.Pairs {
-		placeholder := "{" + kv.Key + "}"
-		if kv.Value == nil {
-			continue
-		}
-		if _, isNull := kv.Value.(evaluator.A0Null); isNull {
-			continue
+	nodes, err := parseTemplate(inStr.Value)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if err := renderTemplate(&b, nodes, []tmplScope{{value: varsRec}}); err != nil {
+		return nil, err
+	}
+	return evaluator.NewString(b.String()), nil
+}
+
+// Strings are UTF-8; the functions below and len count and index by Unicode
+// code point, so "héllo" has length 5 and "é" is a single character.
+
+// str.chars { in: string } → list of one-character strings
+func stdlibStrChars(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	inVal, _ := args.Get("in")
+	inStr, ok := inVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("str.chars: 'in' must be a string")
+	}
+
+	items := make([]evaluator.A0Value, 0, utf8.RuneCountInString(inStr.Value))
+	for _, r := range inStr.Value {
+		items = append(items, evaluator.NewString(string(r)))
+	}
+	return evaluator.NewList(items), nil
+}
+
+// str.codePointAt { in: string, index: int } → int | null
+func stdlibStrCodePointAt(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	inVal, _ := args.Get("in")
+	indexVal, _ := args.Get("index")
+
+	inStr, ok := inVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("str.codePointAt: 'in' must be a string")
+	}
+	index, ok := intArg(indexVal)
+	if !ok {
+		return nil, fmt.Errorf("str.codePointAt: 'index' must be an integer")
+	}
+
+	runes := []rune(inStr.Value)
+	if index < 0 || index >= len(runes) {
+		return evaluator.NewNull(), nil
+	}
+	return evaluator.NewNumber(float64(runes[index])), nil
+}
+
+// str.substr { in: string, start: int, end?: int } → string
+func stdlibStrSubstr(args *evaluator.A0Record) (evaluator.A0Value, error) {
+	inVal, _ := args.Get("in")
+	startVal, _ := args.Get("start")
+	endVal, hasEnd := args.Get("end")
+
+	inStr, ok := inVal.(evaluator.A0String)
+	if !ok {
+		return nil, fmt.Errorf("str.substr: 'in' must be a string")
+	}
+	runes := []rune(inStr.Value)
+	start, ok := intArg(startVal)
+	if !ok {
+		return nil, fmt.Errorf("str.substr: 'start' must be an integer")
+	}
+	end := len(runes)
+	if hasEnd {
+		if end, ok = intArg(endVal); !ok {
+			return nil, fmt.Errorf("str.substr: 'end' must be an integer")
 		}
-		result = strings.ReplaceAll(result, placeholder, valueToString(kv.Value))
 	}
 
-	return evaluator.NewString(result), nil
+	start = clamp(start, 0, len(runes))
+	end = clamp(end, start, len(runes))
+	return evaluator.NewString(string(runes[start:end])), nil
+}
+
+// intArg reads an integral number argument.
+func intArg(v evaluator.A0Value) (int, bool) {
+	n, ok := v.(evaluator.A0Number)
+	if !ok || n.Value != math.Trunc(n.Value) {
+		return 0, false
+	}
+	return int(n.Value), true
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
 }
@@ -0,0 +1,339 @@
+package stdlib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// str.template renders a small mustache-like language:
+//
+//	{name}, {user.name}            value from vars, or from the current item
+//	{.}                            the current item itself
+//	{@index} {@key} {@first} {@last}  position inside {{#each}}
+//	{{#each items}}...{{/each}}    repeat for each list item or record value
+//	{{#if ok}}...{{else}}...{{/if}}  conditional; {{else}} is optional
+//
+// Placeholders that resolve to nothing, or to null, are left as written,
+// and a doubled brace that is not a block tag is plain text, so templates
+// written for the older single-pass replacement render the same.
+//
+// A block tag alone on its line takes the whole line with it, so a
+// Markdown list can be written one tag per line without leaving blank
+// lines behind.
+
+type tmplNode interface{}
+
+type tmplText string
+
+type tmplVar struct {
+	raw  string // the placeholder as written, braces included
+	name string
+}
+
+type tmplEach struct {
+	name string
+	body []tmplNode
+}
+
+type tmplIf struct {
+	name string
+	then []tmplNode
+	els  []tmplNode
+}
+
+// tmplParser builds the node tree. Open blocks are kept on a stack; each
+// entry's nodes slice is where text and placeholders are appended.
+type tmplParser struct {
+	src   string
+	stack []*tmplFrame
+	text  strings.Builder
+}
+
+type tmplFrame struct {
+	tag   string // "", "each" or "if"
+	name  string
+	pos   int
+	nodes []tmplNode
+	then  []tmplNode // for if, the nodes before {{else}}
+	inEls bool
+}
+
+func parseTemplate(src string) ([]tmplNode, error) {
+	p := &tmplParser{src: src, stack: []*tmplFrame{{}}}
+	i := 0
+	for i < len(src) {
+		if strings.HasPrefix(src[i:], "{{") {
+			if end := strings.Index(src[i+2:], "}}"); end >= 0 {
+				tag := strings.TrimSpace(src[i+2 : i+2+end])
+				if isBlockTag(tag) {
+					next := i + 2 + end + 2
+					if start, after, ok := standaloneLine(src, i, next); ok {
+						p.trimTrailingIndent(i - start)
+						next = after
+					}
+					if err := p.tag(tag, i); err != nil {
+						return nil, err
+					}
+					i = next
+					continue
+				}
+			}
+		}
+		if src[i] == '{' {
+			if end := strings.IndexAny(src[i+1:], "{}\n"); end > 0 && src[i+1+end] == '}' {
+				p.flushText()
+				raw := src[i : i+end+2]
+				p.top().nodes = append(p.top().nodes, tmplVar{raw: raw, name: strings.TrimSpace(raw[1 : len(raw)-1])})
+				i += end + 2
+				continue
+			}
+		}
+		p.text.WriteByte(src[i])
+		i++
+	}
+	p.flushText()
+	if len(p.stack) > 1 {
+		open := p.top()
+		return nil, fmt.Errorf("str.template: line %d: {{#%s %s}} is never closed", lineAt(src, open.pos), open.tag, open.name)
+	}
+	return p.stack[0].nodes, nil
+}
+
+func isBlockTag(tag string) bool {
+	return tag == "else" || strings.HasPrefix(tag, "#") || strings.HasPrefix(tag, "/")
+}
+
+// standaloneLine reports whether the tag at src[start:end] is the only
+// thing on its line besides spaces and tabs. It returns where the line's
+// indentation begins and where the next line starts.
+func standaloneLine(src string, start, end int) (lineStart, next int, ok bool) {
+	lineStart = start
+	for lineStart > 0 && (src[lineStart-1] == ' ' || src[lineStart-1] == '\t') {
+		lineStart--
+	}
+	if lineStart > 0 && src[lineStart-1] != '\n' {
+		return 0, 0, false
+	}
+	next = end
+	for next < len(src) && (src[next] == ' ' || src[next] == '\t' || src[next] == '\r') {
+		next++
+	}
+	switch {
+	case next == len(src):
+		return lineStart, next, true
+	case src[next] == '\n':
+		return lineStart, next + 1, true
+	}
+	return 0, 0, false
+}
+
+// trimTrailingIndent drops the last n bytes of pending text, the
+// indentation before a standalone tag.
+func (p *tmplParser) trimTrailingIndent(n int) {
+	s := p.text.String()
+	p.text.Reset()
+	p.text.WriteString(s[:len(s)-n])
+}
+
+func (p *tmplParser) top() *tmplFrame {
+	return p.stack[len(p.stack)-1]
+}
+
+func (p *tmplParser) flushText() {
+	if p.text.Len() > 0 {
+		p.top().nodes = append(p.top().nodes, tmplText(p.text.String()))
+		p.text.Reset()
+	}
+}
+
+func (p *tmplParser) tag(tag string, pos int) error {
+	p.flushText()
+	switch {
+	case strings.HasPrefix(tag, "#"):
+		kind, name, _ := strings.Cut(strings.TrimSpace(tag[1:]), " ")
+		name = strings.TrimSpace(name)
+		if kind != "each" && kind != "if" {
+			return fmt.Errorf("str.template: line %d: unknown block {{#%s}}, expected #each or #if", lineAt(p.src, pos), kind)
+		}
+		if name == "" {
+			return fmt.Errorf("str.template: line %d: {{#%s}} needs a name, as in {{#%s items}}", lineAt(p.src, pos), kind, kind)
+		}
+		p.stack = append(p.stack, &tmplFrame{tag: kind, name: name, pos: pos})
+	case tag == "else":
+		f := p.top()
+		if f.tag != "if" || f.inEls {
+			return fmt.Errorf("str.template: line %d: {{else}} outside {{#if}}", lineAt(p.src, pos))
+		}
+		f.then, f.nodes, f.inEls = f.nodes, nil, true
+	default:
+		kind := strings.TrimSpace(tag[1:])
+		f := p.top()
+		if f.tag == "" {
+			return fmt.Errorf("str.template: line %d: {{/%s}} has no matching {{#%s}}", lineAt(p.src, pos), kind, kind)
+		}
+		if kind != f.tag {
+			return fmt.Errorf("str.template: line %d: {{/%s}} closes {{#%s %s}} from line %d", lineAt(p.src, pos), kind, f.tag, f.name, lineAt(p.src, f.pos))
+		}
+		p.stack = p.stack[:len(p.stack)-1]
+		var node tmplNode
+		if f.tag == "each" {
+			node = tmplEach{name: f.name, body: f.nodes}
+		} else if f.inEls {
+			node = tmplIf{name: f.name, then: f.then, els: f.nodes}
+		} else {
+			node = tmplIf{name: f.name, then: f.nodes}
+		}
+		p.top().nodes = append(p.top().nodes, node)
+	}
+	return nil
+}
+
+func lineAt(src string, pos int) int {
+	return strings.Count(src[:pos], "\n") + 1
+}
+
+// tmplScope is one level of lookup: the vars record at the root, then one
+// per enclosing {{#each}} iteration.
+type tmplScope struct {
+	value evaluator.A0Value
+	loop  bool
+	index int
+	count int
+	key   string
+}
+
+func renderTemplate(b *strings.Builder, nodes []tmplNode, scopes []tmplScope) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case tmplText:
+			b.WriteString(string(n))
+		case tmplVar:
+			v, ok := lookupTemplate(scopes, n.name)
+			if _, isNull := v.(evaluator.A0Null); !ok || isNull {
+				b.WriteString(n.raw)
+				continue
+			}
+			b.WriteString(valueToString(v))
+		case tmplIf:
+			v, _ := lookupTemplate(scopes, n.name)
+			body := n.els
+			if templateTruthy(v) {
+				body = n.then
+			}
+			if err := renderTemplate(b, body, scopes); err != nil {
+				return err
+			}
+		case tmplEach:
+			v, _ := lookupTemplate(scopes, n.name)
+			var items []evaluator.A0Value
+			var keys []string
+			switch c := v.(type) {
+			case nil, evaluator.A0Null:
+			case evaluator.A0List:
+				items = c.Items
+			case evaluator.A0Record:
+				for _, kv := range c.Pairs() {
+					keys = append(keys, kv.Key)
+					items = append(items, kv.Value)
+				}
+			default:
+				return fmt.Errorf("str.template: {{#each %s}} needs a list or record, got %s", n.name, typeName(v))
+			}
+			for i, item := range items {
+				s := tmplScope{value: item, loop: true, index: i, count: len(items)}
+				if keys != nil {
+					s.key = keys[i]
+				}
+				if err := renderTemplate(b, n.body, append(scopes, s)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lookupTemplate resolves a placeholder name. A plain name is looked up in
+// the innermost scope that is a record with that key, then a dotted path
+// descends from there through records and list indexes.
+func lookupTemplate(scopes []tmplScope, name string) (evaluator.A0Value, bool) {
+	inner := scopes[len(scopes)-1]
+	switch name {
+	case ".", "this":
+		return inner.value, true
+	case "@index", "@key", "@first", "@last":
+		if !inner.loop {
+			return nil, false
+		}
+		switch name {
+		case "@index":
+			return evaluator.NewNumber(float64(inner.index)), true
+		case "@key":
+			if inner.key == "" {
+				return nil, false
+			}
+			return evaluator.NewString(inner.key), true
+		case "@first":
+			return evaluator.NewBool(inner.index == 0), true
+		default:
+			return evaluator.NewBool(inner.index == inner.count-1), true
+		}
+	}
+	for i := len(scopes) - 1; i >= 0; i-- {
+		rec, ok := scopes[i].value.(evaluator.A0Record)
+		if !ok {
+			continue
+		}
+		// A key containing dots is matched whole before it is read as a path.
+		if v, ok := rec.Get(name); ok {
+			return v, true
+		}
+		head, rest, dotted := strings.Cut(name, ".")
+		if !dotted {
+			continue
+		}
+		if v, ok := rec.Get(head); ok {
+			return descendTemplate(v, rest)
+		}
+	}
+	return nil, false
+}
+
+func descendTemplate(v evaluator.A0Value, path string) (evaluator.A0Value, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch c := v.(type) {
+		case evaluator.A0Record:
+			next, ok := c.Get(part)
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case evaluator.A0List:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c.Items) {
+				return nil, false
+			}
+			v = c.Items[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// templateTruthy is the usual truthiness, except that empty lists and
+// records are false, so {{#if items}} can guard a heading over a list.
+func templateTruthy(v evaluator.A0Value) bool {
+	switch c := v.(type) {
+	case nil:
+		return false
+	case evaluator.A0List:
+		return len(c.Items) > 0
+	case evaluator.A0Record:
+		return c.Len() > 0
+	}
+	return evaluator.Truthiness(v)
+}
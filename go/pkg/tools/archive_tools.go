@@ -0,0 +1,519 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// archiveFormat picks the archive format from a file name: ".zip", ".tar",
+// ".tar.gz" or ".tgz".
+func archiveFormat(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tgz", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	}
+	return "", fmt.Errorf("unsupported archive type '%s' (use .zip, .tar, .tar.gz or .tgz)", name)
+}
+
+// archiveEntry is a file to be added to an archive.
+type archiveEntry struct {
+	name string // slash-separated name inside the archive
+	src  string // resolved host path
+	info fs.FileInfo
+}
+
+// entryName derives a safe in-archive name from a program-supplied path.
+func entryName(p string) string {
+	p = filepath.ToSlash(filepath.Clean(p))
+	p = strings.TrimLeft(p, "/")
+	for strings.HasPrefix(p, "../") {
+		p = strings.TrimPrefix(p, "../")
+	}
+	if p == ".." || p == "." {
+		return ""
+	}
+	return p
+}
+
+func collectArchiveEntries(ctx context.Context, files evaluator.A0List) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	for i, item := range files.Items {
+		s, ok := item.(evaluator.A0String)
+		if !ok {
+			return nil, fmt.Errorf("archive.zip 'files' item %d must be a string", i)
+		}
+		resolved, err := resolvePath(ctx, s.Value)
+		if err != nil {
+			return nil, fmt.Errorf("archive.zip: invalid path: %s", err)
+		}
+		resolved = readSource(ctx, resolved)
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("archive.zip: %s", err)
+		}
+		base := entryName(s.Value)
+		if !info.IsDir() {
+			if base == "" {
+				base = filepath.Base(resolved)
+			}
+			entries = append(entries, archiveEntry{name: base, src: resolved, info: info})
+			continue
+		}
+		err = filepath.WalkDir(resolved, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(resolved, p)
+			if err != nil {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entries = append(entries, archiveEntry{name: path.Join(base, filepath.ToSlash(rel)), src: p, info: fi})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("archive.zip: %s", err)
+		}
+	}
+	return entries, nil
+}
+
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyFileTo(fw, e.src); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTar(w io.Writer, entries []archiveEntry) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr, err := tar.FileInfoHeader(e.info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = e.name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyFileTo(tw, e.src); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func copyFileTo(w io.Writer, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func archiveZipTool() Def {
+	return Def{
+		Name:         "archive.zip",
+		Mode:         "effect",
+		CapabilityID: "fs.write",
+		AlsoRequires: []string{"fs.read"},
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			filesVal, _ := args.Get("files")
+			files, ok := filesVal.(evaluator.A0List)
+			if !ok {
+				return nil, fmt.Errorf("archive.zip requires a 'files' argument of type list")
+			}
+			toVal, _ := args.Get("to")
+			toStr, ok := toVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("archive.zip requires a 'to' argument of type string")
+			}
+
+			format, err := archiveFormat(toStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.zip: %s", err)
+			}
+			resolved, err := resolvePath(ctx, toStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.zip: invalid path: %s", err)
+			}
+			entries, err := collectArchiveEntries(ctx, files)
+			if err != nil {
+				return nil, err
+			}
+			target, err := writeTarget(ctx, resolved)
+			if err != nil {
+				return nil, fmt.Errorf("archive.zip: %s", err)
+			}
+			record := beforeWrite(ctx, "archive.zip", resolved, readSource(ctx, resolved))
+
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, fmt.Errorf("archive.zip: cannot create directory: %s", err)
+			}
+			out, err := os.Create(target)
+			if err != nil {
+				return nil, fmt.Errorf("archive.zip: %s", err)
+			}
+			hash := sha256.New()
+			counter := &countingWriter{w: io.MultiWriter(out, hash)}
+
+			switch format {
+			case "zip":
+				err = writeZip(counter, entries)
+			case "tar":
+				err = writeTar(counter, entries)
+			case "tgz":
+				gz := gzip.NewWriter(counter)
+				err = writeTar(gz, entries)
+				if err == nil {
+					err = gz.Close()
+				}
+			}
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(target)
+				return nil, fmt.Errorf("archive.zip: %s", err)
+			}
+			record(counter.n, nil)
+
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "kind", Value: evaluator.NewString("archive")},
+				{Key: "path", Value: evaluator.NewString(resolved)},
+				{Key: "files", Value: evaluator.NewNumber(float64(len(entries)))},
+				{Key: "bytes", Value: evaluator.NewNumber(float64(counter.n))},
+				{Key: "sha256", Value: evaluator.NewString(fmt.Sprintf("%x", hash.Sum(nil)))},
+			}), nil
+		},
+	}
+}
+
+func archiveUnzipTool() Def {
+	return Def{
+		Name:         "archive.unzip",
+		Mode:         "effect",
+		CapabilityID: "fs.write",
+		AlsoRequires: []string{"fs.read"},
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			fromVal, _ := args.Get("from")
+			fromStr, ok := fromVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("archive.unzip requires a 'from' argument of type string")
+			}
+			toVal, _ := args.Get("to")
+			toStr, ok := toVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("archive.unzip requires a 'to' argument of type string")
+			}
+
+			format, err := archiveFormat(fromStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: %s", err)
+			}
+			src, err := resolvePath(ctx, fromStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: invalid path: %s", err)
+			}
+			src = readSource(ctx, src)
+			dest, err := resolvePath(ctx, toStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: invalid path: %s", err)
+			}
+			target, err := writeTarget(ctx, dest)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: %s", err)
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, fmt.Errorf("archive.unzip: cannot create directory: %s", err)
+			}
+
+			x := &extractor{ctx: ctx, dest: target, logical: dest}
+			x.allowance, x.limited = evaluator.BytesWriteAllowance(ctx)
+			err = x.extract(src, format)
+			var budgetErr *evaluator.A0RuntimeError
+			if errors.As(err, &budgetErr) {
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: %s", err)
+			}
+
+			names := make([]evaluator.A0Value, len(x.files))
+			for i, n := range x.files {
+				names[i] = evaluator.NewString(n)
+			}
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "kind", Value: evaluator.NewString("directory")},
+				{Key: "path", Value: evaluator.NewString(dest)},
+				{Key: "files", Value: evaluator.NewList(names)},
+				{Key: "bytes", Value: evaluator.NewNumber(float64(x.bytes))},
+			}), nil
+		},
+		Prepare: func(ctx context.Context, args *evaluator.A0Record) (any, error) {
+			fromVal, _ := args.Get("from")
+			fromStr, ok := fromVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("archive.unzip requires a 'from' argument of type string")
+			}
+			toVal, _ := args.Get("to")
+			toStr, ok := toVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("archive.unzip requires a 'to' argument of type string")
+			}
+			format, err := archiveFormat(fromStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: %s", err)
+			}
+			src, err := resolvePath(ctx, fromStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: invalid path: %s", err)
+			}
+			dest, err := resolvePath(ctx, toStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: invalid path: %s", err)
+			}
+			target, err := writeTarget(ctx, dest)
+			if err != nil {
+				return nil, fmt.Errorf("archive.unzip: %s", err)
+			}
+			// Save the files the archive would overwrite by listing it with
+			// an extractor that writes nothing.
+			x := &extractor{dest: target, listOnly: true}
+			if err := x.extract(readSource(ctx, src), format); err != nil {
+				return nil, fmt.Errorf("archive.unzip: %s", err)
+			}
+			states := make([]*fileState, 0, len(x.files))
+			for _, name := range x.files {
+				st, err := saveFileState(filepath.Join(target, filepath.FromSlash(name)))
+				if err != nil {
+					return nil, fmt.Errorf("archive.unzip: %s", err)
+				}
+				states = append(states, st)
+			}
+			return states, nil
+		},
+		Rollback: func(ctx context.Context, token any) error {
+			for _, st := range token.([]*fileState) {
+				if err := st.restore(); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// extractor writes archive entries under dest, rejecting entries that would
+// land outside it ("zip slip"). Each file is recorded in the run's change
+// log under logical, the path the program asked for, and with limited set
+// extraction stops with E_BUDGET once it would write more than allowance
+// bytes. With listOnly it only collects the names of the files.
+type extractor struct {
+	ctx       context.Context
+	dest      string
+	logical   string
+	allowance int64
+	limited   bool
+	listOnly  bool
+	files     []string
+	bytes     int64
+}
+
+func (x *extractor) extract(src, format string) error {
+	switch format {
+	case "zip":
+		return x.zip(src)
+	case "tar":
+		return x.tarFile(src, false)
+	case "tgz":
+		return x.tarFile(src, true)
+	}
+	return nil
+}
+
+func (x *extractor) target(name string) (string, error) {
+	target := filepath.Join(x.dest, filepath.FromSlash(name))
+	if !within(x.dest, target) {
+		return "", fmt.Errorf("entry '%s' escapes destination", name)
+	}
+	return target, nil
+}
+
+// writeFile extracts one entry through a temporary file, so an entry that
+// fails or overruns the budget leaves any existing file untouched.
+func (x *extractor) writeFile(name string, r io.Reader, mode fs.FileMode) error {
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if x.listOnly {
+		x.files = append(x.files, name)
+		return nil
+	}
+	logical := filepath.Join(x.logical, filepath.FromSlash(name))
+	record := beforeWrite(x.ctx, "archive.unzip", logical, readSource(x.ctx, logical))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".a0-unzip-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if x.limited {
+		// Read one byte past the allowance to tell a fit from an overrun.
+		r = io.LimitReader(r, x.allowance-x.bytes+1)
+	}
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Chmod(mode.Perm() | 0600)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if x.limited && x.bytes+n > x.allowance {
+		return &evaluator.A0RuntimeError{
+			Code:    diagnostics.EBudget,
+			Message: fmt.Sprintf("archive.unzip: extracting '%s' exceeds the bytes written budget (%d bytes left)", name, x.allowance-x.bytes),
+		}
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	record(n, nil)
+	x.files = append(x.files, name)
+	x.bytes += n
+	return nil
+}
+
+func (x *extractor) mkdir(name string) error {
+	target, err := x.target(name)
+	if err != nil || x.listOnly {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+func (x *extractor) zip(src string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			if err := x.mkdir(f.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue // skip symlinks and special files
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = x.writeFile(f.Name, rc, f.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) tarFile(src string, gzipped bool) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := x.mkdir(hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := x.writeFile(hdr.Name, tr, fs.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		default:
+			// skip links and special files
+		}
+	}
+}
+
+// countingWriter counts bytes passed through to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,200 @@
+package tools_test
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/runtime"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+func TestArchive_ZipUnzipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("beta"), 0644)
+
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			archive := filepath.Join(dir, name)
+			res, err := tool(t, "archive.zip").Execute(ctx, record(
+				"files", evaluator.NewList([]evaluator.A0Value{evaluator.NewString(src)}),
+				"to", archive))
+			if err != nil {
+				t.Fatalf("archive.zip: %v", err)
+			}
+			if n := evaluator.ValueToJSONString(field(t, res, "files")); n != "2" {
+				t.Errorf("expected 2 files packed, got %s", n)
+			}
+
+			dest := filepath.Join(dir, "unpacked-"+name)
+			if _, err := tool(t, "archive.unzip").Execute(ctx, record("from", archive, "to", dest)); err != nil {
+				t.Fatalf("archive.unzip: %v", err)
+			}
+			base := entryBase(src)
+			for file, want := range map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"} {
+				got, err := os.ReadFile(filepath.Join(dest, base, filepath.FromSlash(file)))
+				if err != nil || string(got) != want {
+					t.Errorf("%s: got %q (%v), want %q", file, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+// entryBase is the in-archive directory archive.zip derives from an
+// absolute path: the path without its leading slash.
+func entryBase(p string) string {
+	return filepath.FromSlash(strings.TrimLeft(filepath.ToSlash(p), "/"))
+}
+
+func TestArchive_UnzipRejectsZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("../escaped.txt")
+	w.Write([]byte("pwned"))
+	zw.Close()
+	f.Close()
+
+	dest := filepath.Join(dir, "dest")
+	_, err = tool(t, "archive.unzip").Execute(context.Background(), record("from", archive, "to", dest))
+	if err == nil || !strings.Contains(err.Error(), "escapes destination") {
+		t.Fatalf("expected a zip slip error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no file outside the destination, stat: %v", err)
+	}
+}
+
+// writeZip creates a zip archive at path holding name/content pairs in order.
+func writeZip(t *testing.T, path string, entries ...string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i := 0; i < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestArchive_UnzipStopsAtBytesWrittenBudget(t *testing.T) {
+	dir := t.TempDir()
+	// A megabyte of zeros compresses to about a kilobyte, like a small zip bomb.
+	writeZip(t, filepath.Join(dir, "bomb.zip"), "small.txt", "hello", "big.bin", strings.Repeat("\x00", 1<<20))
+	os.MkdirAll(filepath.Join(dir, "out"), 0755)
+	os.WriteFile(filepath.Join(dir, "out", "big.bin"), []byte("keep"), 0644)
+
+	rt := runtime.New(runtime.WithUnsafeAllowAll(), runtime.WithWorkdir(dir))
+	res, err := rt.Run(context.Background(), `budget { maxBytesWritten: 4096 }
+cap { fs.read: true, fs.write: true }
+do archive.unzip { from: "bomb.zip", to: "out" } -> x
+return { x: x }
+`, "bomb.a0")
+	var rtErr *evaluator.A0RuntimeError
+	if !errors.As(err, &rtErr) || rtErr.Code != diagnostics.EBudget {
+		t.Fatalf("expected E_BUDGET, got %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "out", "big.bin")); string(got) != "keep" {
+		t.Errorf("the entry that overran the budget replaced the existing file (%d bytes)", len(got))
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "out", "small.txt")); string(got) != "hello" {
+		t.Errorf("small.txt = %q, want the entry extracted before the budget ran out", got)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "out", ".a0-unzip-*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+	if res == nil || len(res.FilesChanged) != 1 || res.FilesChanged[0].Path != "out/small.txt" {
+		t.Errorf("FilesChanged should list only small.txt, got %+v", res)
+	}
+
+	// Within the budget the archive extracts and its bytes are charged.
+	// An archive that exactly fits the budget extracts, and its bytes count.
+	writeZip(t, filepath.Join(dir, "ok.zip"), "a.txt", "alpha", "b.txt", "beta")
+	res, err = rt.Run(context.Background(), `budget { maxBytesWritten: 9 }
+cap { fs.read: true, fs.write: true }
+do archive.unzip { from: "ok.zip", to: "out3" } -> x
+return { bytes: x.bytes }
+`, "ok.a0")
+	if err != nil {
+		t.Fatalf("archive.unzip within the budget: %v", err)
+	}
+	if got := evaluator.ValueToJSONString(res.Value); got != `{"bytes":9}` {
+		t.Errorf("result = %s", got)
+	}
+}
+
+func TestArchive_UnzipRecordsChanges(t *testing.T) {
+	ctx, root, l := changeLogTree(t, false)
+	writeZip(t, filepath.Join(root, "a.zip"), "notes.txt", "new", "sub/c.txt", "see")
+	if _, err := tool(t, "archive.unzip").Execute(ctx, record("from", "a.zip", "to", ".")); err != nil {
+		t.Fatal(err)
+	}
+	changes := l.Changes()
+	want := []tools.FileChange{
+		{Path: "notes.txt", Tool: "archive.unzip", Op: "modified", BytesBefore: 14, BytesAfter: 3, Delta: -11},
+		{Path: "sub/c.txt", Tool: "archive.unzip", Op: "created", BytesBefore: 0, BytesAfter: 3, Delta: 3},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("Changes = %+v, want %+v", changes, want)
+	}
+}
+
+func TestArchive_UnzipRollback(t *testing.T) {
+	ctx, root, _ := changeLogTree(t, false)
+	writeZip(t, filepath.Join(root, "a.zip"), "notes.txt", "new", "sub/c.txt", "see")
+	unzip := tool(t, "archive.unzip")
+	args := record("from", "a.zip", "to", ".")
+
+	token, err := unzip.Prepare(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unzip.Execute(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+	if err := unzip.Rollback(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "notes.txt")); string(got) != "one\ntwo\nthree\n" {
+		t.Errorf("notes.txt after rollback = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", "c.txt")); !os.IsNotExist(err) {
+		t.Errorf("an extracted file should be removed by rollback, stat: %v", err)
+	}
+}
+
+func TestArchive_DeclaresFsRead(t *testing.T) {
+	reg := tools.NewRegistry()
+	tools.RegisterDefaults(reg)
+	for _, name := range []string{"archive.zip", "archive.unzip"} {
+		if got := reg.Get(name).AlsoRequires; len(got) != 1 || got[0] != "fs.read" {
+			t.Errorf("%s: AlsoRequires = %v, want [fs.read]", name, got)
+		}
+	}
+}
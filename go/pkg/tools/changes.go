@@ -0,0 +1,271 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type changeLogKey struct{}
+
+// maxDiffBytes and maxDiffLines bound the files a ChangeLog diffs; larger
+// or binary files are reported by size only.
+const (
+	maxDiffBytes = 256 << 10
+	maxDiffLines = 4000
+)
+
+// FileChange is the net effect of a run on one file. Several writes to the
+// same path are folded into one change from the file's state before the
+// first write to its state after the last.
+type FileChange struct {
+	Path        string `json:"path"`
+	Tool        string `json:"tool"` // tool of the last write
+	Op          string `json:"op"`   // "created" or "modified"
+	BytesBefore int64  `json:"bytesBefore"`
+	BytesAfter  int64  `json:"bytesAfter"`
+	Delta       int64  `json:"delta"`
+	// Diff is a unified diff for text files when ChangeLog.Diffs is set.
+	Diff string `json:"diff,omitempty"`
+}
+
+// ChangeLog records the files fs effect tools write during a run. It is
+// safe for concurrent use by parallel map workers.
+type ChangeLog struct {
+	// Diffs keeps the original content of written files so Changes can
+	// include unified diffs for text.
+	Diffs bool
+	// Root, when set, makes paths under it relative in Changes.
+	Root string
+
+	mu      sync.Mutex
+	order   []string
+	entries map[string]*changeEntry
+}
+
+type changeEntry struct {
+	tool          string
+	existed       bool
+	before, after int64
+	original      []byte // kept when Diffs is set
+	final         []byte
+}
+
+// WithChangeLog returns a context in which fs effect tools record writes
+// into l.
+func WithChangeLog(ctx context.Context, l *ChangeLog) context.Context {
+	return context.WithValue(ctx, changeLogKey{}, l)
+}
+
+func changeLogFrom(ctx context.Context) *ChangeLog {
+	l, _ := ctx.Value(changeLogKey{}).(*ChangeLog)
+	return l
+}
+
+// beforeWrite captures a file's state before tool writes path (the logical
+// path; source is where its current content is read from, which differs
+// under an overlay). It returns a func to call once the write succeeded
+// with the new size and, for text worth diffing, the new content.
+func beforeWrite(ctx context.Context, tool, path, source string) func(size int64, content []byte) {
+	l := changeLogFrom(ctx)
+	if l == nil {
+		return func(int64, []byte) {}
+	}
+	l.mu.Lock()
+	_, seen := l.entries[path]
+	l.mu.Unlock()
+	var entry *changeEntry
+	if !seen {
+		entry = &changeEntry{}
+		if info, err := os.Stat(source); err == nil && info.Mode().IsRegular() {
+			entry.existed = true
+			entry.before = info.Size()
+			if l.Diffs && info.Size() <= maxDiffBytes {
+				entry.original, _ = os.ReadFile(source)
+			}
+		}
+	}
+	return func(size int64, content []byte) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.entries == nil {
+			l.entries = make(map[string]*changeEntry)
+		}
+		e := l.entries[path]
+		if e == nil {
+			if entry == nil {
+				entry = &changeEntry{}
+			}
+			e = entry
+			l.entries[path] = e
+			l.order = append(l.order, path)
+		}
+		e.tool = tool
+		e.after = size
+		e.final = nil
+		if l.Diffs {
+			e.final = content
+		}
+	}
+}
+
+// Changes returns the files written so far, sorted by path. With Diffs,
+// files written back to their original content are left out.
+func (l *ChangeLog) Changes() []FileChange {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	paths := append([]string(nil), l.order...)
+	sort.Strings(paths)
+	var out []FileChange
+	for _, p := range paths {
+		e := l.entries[p]
+		display := filepath.ToSlash(p)
+		if l.Root != "" && within(l.Root, p) {
+			if rel, err := filepath.Rel(l.Root, p); err == nil {
+				display = filepath.ToSlash(rel)
+			}
+		}
+		c := FileChange{
+			Path:        display,
+			Tool:        e.tool,
+			Op:          "modified",
+			BytesBefore: e.before,
+			BytesAfter:  e.after,
+			Delta:       e.after - e.before,
+		}
+		if !e.existed {
+			c.Op = "created"
+		}
+		if l.Diffs && e.final != nil {
+			if e.existed && e.original != nil && bytes.Equal(e.original, e.final) {
+				continue
+			}
+			if e.original != nil || !e.existed {
+				c.Diff = unifiedDiff(display, e.original, e.final)
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// unifiedDiff renders a unified diff with three lines of context, or ""
+// when either side is binary or too large to diff.
+func unifiedDiff(path string, a, b []byte) string {
+	if len(a) > maxDiffBytes || len(b) > maxDiffBytes || !isText(a) || !isText(b) {
+		return ""
+	}
+	x, y := splitLines(a), splitLines(b)
+	if len(x) > maxDiffLines || len(y) > maxDiffLines {
+		return ""
+	}
+
+	// Longest common subsequence table, filled from the end.
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte // ' ', '-', '+'
+		text string
+		ai   int // line index in a (for ' ' and '-')
+		bi   int // line index in b (for ' ' and '+')
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i], i, j})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', x[i], i, j})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j], i, j})
+			j++
+		}
+	}
+
+	const contextLines = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		start := max(k-contextLines, 0)
+		end := k
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].op == ' ' {
+				run++
+			}
+			if run == len(lines) || run-end > 2*contextLines {
+				end = min(end+contextLines, len(lines))
+				break
+			}
+			end = run
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		aStart, bStart := lines[start].ai+1, lines[start].bi+1
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, l := range lines[start:end] {
+			sb.WriteByte(l.op)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		k = end
+	}
+	return sb.String()
+}
+
+func isText(b []byte) bool {
+	return utf8.Valid(b) && bytes.IndexByte(b, 0) < 0
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
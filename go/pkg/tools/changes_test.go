@@ -0,0 +1,92 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+func changeLogTree(t *testing.T, diffs bool) (context.Context, string, *tools.ChangeLog) {
+	t.Helper()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("one\ntwo\nthree\n"), 0o644)
+	l := &tools.ChangeLog{Diffs: diffs, Root: root}
+	return tools.WithChangeLog(tools.WithWorkdir(context.Background(), root), l), root, l
+}
+
+func TestChangeLog_FoldsWritesPerFile(t *testing.T) {
+	ctx, _, l := changeLogTree(t, false)
+	write := tool(t, "fs.write")
+	write.Execute(ctx, record("path", "notes.txt", "data", "x"))
+	write.Execute(ctx, record("path", "notes.txt", "data", "one\ntwo\nthree\nfour\n"))
+	write.Execute(ctx, record("path", "out/new.txt", "data", "hello"))
+
+	changes := l.Changes()
+	want := []tools.FileChange{
+		{Path: "notes.txt", Tool: "fs.write", Op: "modified", BytesBefore: 14, BytesAfter: 19, Delta: 5},
+		{Path: "out/new.txt", Tool: "fs.write", Op: "created", BytesBefore: 0, BytesAfter: 5, Delta: 5},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("Changes = %+v, want %+v", changes, want)
+	}
+}
+
+func TestChangeLog_Diffs(t *testing.T) {
+	ctx, _, l := changeLogTree(t, true)
+	write := tool(t, "fs.write")
+	write.Execute(ctx, record("path", "notes.txt", "data", "one\n2\nthree\n"))
+	write.Execute(ctx, record("path", "new.txt", "data", "hi\n"))
+
+	changes := l.Changes()
+	if len(changes) != 2 {
+		t.Fatalf("Changes = %+v", changes)
+	}
+	if want := "--- a/new.txt\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+hi\n"; changes[0].Diff != want {
+		t.Errorf("diff of a new file =\n%s\nwant\n%s", changes[0].Diff, want)
+	}
+	if want := "--- a/notes.txt\n+++ b/notes.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"; changes[1].Diff != want {
+		t.Errorf("diff of a modified file =\n%s\nwant\n%s", changes[1].Diff, want)
+	}
+}
+
+func TestChangeLog_DiffHunksKeepThreeLinesOfContext(t *testing.T) {
+	ctx, root, l := changeLogTree(t, true)
+	var before, after []string
+	for i := 1; i <= 20; i++ {
+		line := strings.Repeat("x", i)
+		before = append(before, line)
+		if i == 2 || i == 18 {
+			line = "changed"
+		}
+		after = append(after, line)
+	}
+	os.WriteFile(filepath.Join(root, "long.txt"), []byte(strings.Join(before, "\n")+"\n"), 0o644)
+	tool(t, "fs.write").Execute(ctx, record("path", "long.txt", "data", strings.Join(after, "\n")+"\n"))
+
+	diff := l.Changes()[0].Diff
+	if !strings.Contains(diff, "@@ -1,5 +1,5 @@\n") || !strings.Contains(diff, "@@ -15,6 +15,6 @@\n") {
+		t.Errorf("expected two hunks with three lines of context, got\n%s", diff)
+	}
+}
+
+func TestChangeLog_WriteBackAndBinaryFiles(t *testing.T) {
+	ctx, root, l := changeLogTree(t, true)
+	write := tool(t, "fs.write")
+	write.Execute(ctx, record("path", "notes.txt", "data", "temporary"))
+	write.Execute(ctx, record("path", "notes.txt", "data", "one\ntwo\nthree\n"))
+
+	os.WriteFile(filepath.Join(root, "blob.bin"), []byte{0, 1, 2}, 0o644)
+	write.Execute(ctx, record("path", "blob.bin", "data", "text now"))
+
+	changes := l.Changes()
+	if len(changes) != 1 || changes[0].Path != "blob.bin" {
+		t.Fatalf("expected only blob.bin to be reported, got %+v", changes)
+	}
+	if changes[0].Diff != "" {
+		t.Errorf("expected no diff for a binary file, got\n%s", changes[0].Diff)
+	}
+}
@@ -2,11 +2,18 @@ package tools
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/thomasrohde/agent0/go/pkg/evaluator"
 )
@@ -23,12 +30,12 @@ func fsReadTool() Def {
 				return nil, fmt.Errorf("fs.read requires a 'path' argument of type string")
 			}
 
-			resolved, err := filepath.Abs(pathStr.Value)
+			resolved, err := resolvePath(ctx, pathStr.Value)
 			if err != nil {
 				return nil, fmt.Errorf("fs.read: invalid path: %s", err)
 			}
 
-			data, err := os.ReadFile(resolved)
+			data, err := os.ReadFile(readSource(ctx, resolved))
 			if err != nil {
 				return nil, fmt.Errorf("fs.read: %s", err)
 			}
@@ -61,60 +68,198 @@ func fsWriteTool() Def {
 				dataVal = evaluator.NewNull()
 			}
 
-			var content string
-			if format == "json" {
-				// Pretty print JSON with 2-space indent
-				jsonBytes, err := evaluator.ValueToJSON(dataVal)
-				if err != nil {
-					return nil, fmt.Errorf("fs.write: failed to serialize data: %s", err)
-				}
-				// Re-format with indentation
-				var raw any
-				if err := json.Unmarshal(jsonBytes, &raw); err != nil {
-					content = string(jsonBytes)
-				} else {
-					pretty, err := json.MarshalIndent(raw, "", "  ")
-					if err != nil {
-						content = string(jsonBytes)
-					} else {
-						content = string(pretty)
-					}
-				}
-			} else if str, ok := dataVal.(evaluator.A0String); ok {
-				content = str.Value
-			} else {
-				jsonBytes, err := evaluator.ValueToJSON(dataVal)
-				if err != nil {
-					return nil, fmt.Errorf("fs.write: failed to serialize data: %s", err)
-				}
-				content = string(jsonBytes)
+			content, err := serializeWriteData("fs.write", dataVal, format)
+			if err != nil {
+				return nil, err
 			}
 
-			resolved, err := filepath.Abs(pathStr.Value)
+			resolved, err := resolvePath(ctx, pathStr.Value)
 			if err != nil {
 				return nil, fmt.Errorf("fs.write: invalid path: %s", err)
 			}
+			target, err := writeTarget(ctx, resolved)
+			if err != nil {
+				return nil, fmt.Errorf("fs.write: %s", err)
+			}
+			record := beforeWrite(ctx, "fs.write", resolved, readSource(ctx, resolved))
 
 			// Create parent directories
-			dir := filepath.Dir(resolved)
+			dir := filepath.Dir(target)
 			if err := os.MkdirAll(dir, 0755); err != nil {
 				return nil, fmt.Errorf("fs.write: cannot create directory: %s", err)
 			}
 
-			if err := os.WriteFile(resolved, []byte(content), 0644); err != nil {
+			if err := os.WriteFile(target, []byte(content), 0644); err != nil {
 				return nil, fmt.Errorf("fs.write: %s", err)
 			}
+			record(int64(len(content)), []byte(content))
 
-			// Compute SHA256
-			hash := sha256.Sum256([]byte(content))
-			sha256Hex := fmt.Sprintf("%x", hash)
+			return fileArtifact(resolved, content), nil
+		},
+		Prepare: func(ctx context.Context, args *evaluator.A0Record) (any, error) {
+			pathVal, _ := args.Get("path")
+			pathStr, ok := pathVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("fs.write requires a 'path' argument of type string")
+			}
+			resolved, err := resolvePath(ctx, pathStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("fs.write: invalid path: %s", err)
+			}
+			target, err := writeTarget(ctx, resolved)
+			if err != nil {
+				return nil, fmt.Errorf("fs.write: %s", err)
+			}
+			return saveFileState(target)
+		},
+		Rollback: func(ctx context.Context, token any) error {
+			return token.(*fileState).restore()
+		},
+	}
+}
 
-			return evaluator.NewRecord([]evaluator.KeyValue{
-				{Key: "kind", Value: evaluator.NewString("file")},
-				{Key: "path", Value: evaluator.NewString(resolved)},
-				{Key: "bytes", Value: evaluator.NewNumber(float64(len([]byte(content))))},
-				{Key: "sha256", Value: evaluator.NewString(sha256Hex)},
-			}), nil
+// fileState is a file's content before a transactional write, so the write
+// can be rolled back.
+type fileState struct {
+	path    string
+	existed bool
+	content []byte
+	mode    os.FileMode
+}
+
+func saveFileState(path string) (*fileState, error) {
+	s := &fileState{path: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("'%s' is not a regular file", path)
+	}
+	if s.content, err = os.ReadFile(path); err != nil {
+		return nil, err
+	}
+	s.existed = true
+	s.mode = info.Mode().Perm()
+	return s, nil
+}
+
+// restore puts the file back as it was, removing it if it did not exist.
+// Parent directories the write created are left in place.
+func (s *fileState) restore() error {
+	if !s.existed {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(s.path, s.content, s.mode)
+}
+
+// serializeWriteData renders the data argument of a file-writing tool.
+// format "json" pretty-prints; strings are written verbatim; anything else
+// is written as compact JSON.
+func serializeWriteData(toolName string, dataVal evaluator.A0Value, format string) (string, error) {
+	if format == "json" {
+		// Pretty print JSON with 2-space indent
+		jsonBytes, err := evaluator.ValueToJSON(dataVal)
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to serialize data: %s", toolName, err)
+		}
+		// Re-format with indentation
+		var raw any
+		if err := json.Unmarshal(jsonBytes, &raw); err != nil {
+			return string(jsonBytes), nil
+		}
+		pretty, err := json.MarshalIndent(raw, "", "  ")
+		if err != nil {
+			return string(jsonBytes), nil
+		}
+		return string(pretty), nil
+	}
+	if str, ok := dataVal.(evaluator.A0String); ok {
+		return str.Value, nil
+	}
+	jsonBytes, err := evaluator.ValueToJSON(dataVal)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to serialize data: %s", toolName, err)
+	}
+	return string(jsonBytes), nil
+}
+
+// fileArtifact builds the { kind, path, bytes, sha256 } record returned by
+// tools that write a file.
+func fileArtifact(path, content string) evaluator.A0Value {
+	hash := sha256.Sum256([]byte(content))
+	sha256Hex := fmt.Sprintf("%x", hash)
+
+	return evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "kind", Value: evaluator.NewString("file")},
+		{Key: "path", Value: evaluator.NewString(path)},
+		{Key: "bytes", Value: evaluator.NewNumber(float64(len([]byte(content))))},
+		{Key: "sha256", Value: evaluator.NewString(sha256Hex)},
+	})
+}
+
+func fsTempTool() Def {
+	return Def{
+		Name:         "fs.temp",
+		Mode:         "effect",
+		CapabilityID: "fs.write",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			scope := tempScopeFrom(ctx)
+			if scope == nil {
+				return nil, fmt.Errorf("fs.temp: no run-scoped temp directory available")
+			}
+
+			prefix := "tmp-"
+			if prefixVal, found := args.Get("prefix"); found {
+				ps, ok := prefixVal.(evaluator.A0String)
+				if !ok {
+					return nil, fmt.Errorf("fs.temp 'prefix' must be a string")
+				}
+				if strings.ContainsAny(ps.Value, `/\`) {
+					return nil, fmt.Errorf("fs.temp 'prefix' must not contain path separators")
+				}
+				prefix = ps.Value
+			}
+
+			formatVal, _ := args.Get("format")
+			format := "raw"
+			if fs, ok := formatVal.(evaluator.A0String); ok {
+				format = fs.Value
+			}
+
+			dataVal, _ := args.Get("data")
+			if dataVal == nil {
+				dataVal = evaluator.NewString("")
+			}
+
+			content, err := serializeWriteData("fs.temp", dataVal, format)
+			if err != nil {
+				return nil, err
+			}
+
+			dir, err := scope.Dir()
+			if err != nil {
+				return nil, fmt.Errorf("fs.temp: cannot create temp directory: %s", err)
+			}
+			f, err := os.CreateTemp(dir, prefix+"*")
+			if err != nil {
+				return nil, fmt.Errorf("fs.temp: %s", err)
+			}
+			if _, err := f.WriteString(content); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("fs.temp: %s", err)
+			}
+			if err := f.Close(); err != nil {
+				return nil, fmt.Errorf("fs.temp: %s", err)
+			}
+
+			return fileArtifact(f.Name(), content), nil
 		},
 	}
 }
@@ -131,12 +276,12 @@ func fsListTool() Def {
 				return nil, fmt.Errorf("fs.list requires a 'path' argument of type string")
 			}
 
-			resolved, err := filepath.Abs(pathStr.Value)
+			resolved, err := resolvePath(ctx, pathStr.Value)
 			if err != nil {
 				return nil, fmt.Errorf("fs.list: invalid path: %s", err)
 			}
 
-			entries, err := os.ReadDir(resolved)
+			entries, err := readDirMerged(ctx, resolved)
 			if err != nil {
 				return nil, fmt.Errorf("fs.list: %s", err)
 			}
@@ -159,6 +304,64 @@ func fsListTool() Def {
 	}
 }
 
+func fsHashTool() Def {
+	return Def{
+		Name:         "fs.hash",
+		Mode:         "read",
+		CapabilityID: "fs.read",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			pathVal, _ := args.Get("path")
+			pathStr, ok := pathVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("fs.hash requires a 'path' argument of type string")
+			}
+
+			alg := "sha256"
+			if algVal, found := args.Get("alg"); found {
+				s, ok := algVal.(evaluator.A0String)
+				if !ok {
+					return nil, fmt.Errorf("fs.hash 'alg' must be a string")
+				}
+				alg = strings.ToLower(s.Value)
+			}
+			var h hash.Hash
+			switch alg {
+			case "sha256":
+				h = sha256.New()
+			case "sha1":
+				h = sha1.New()
+			case "sha512":
+				h = sha512.New()
+			case "md5":
+				h = md5.New()
+			default:
+				return nil, fmt.Errorf("fs.hash: unsupported alg '%s' (use sha256, sha1, sha512 or md5)", alg)
+			}
+
+			resolved, err := resolvePath(ctx, pathStr.Value)
+			if err != nil {
+				return nil, fmt.Errorf("fs.hash: invalid path: %s", err)
+			}
+			f, err := os.Open(readSource(ctx, resolved))
+			if err != nil {
+				return nil, fmt.Errorf("fs.hash: %s", err)
+			}
+			defer f.Close()
+			n, err := io.Copy(h, f)
+			if err != nil {
+				return nil, fmt.Errorf("fs.hash: %s", err)
+			}
+
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "path", Value: evaluator.NewString(resolved)},
+				{Key: "alg", Value: evaluator.NewString(alg)},
+				{Key: "digest", Value: evaluator.NewString(hex.EncodeToString(h.Sum(nil)))},
+				{Key: "bytesRead", Value: evaluator.NewNumber(float64(n))},
+			}), nil
+		},
+	}
+}
+
 func fsExistsTool() Def {
 	return Def{
 		Name:         "fs.exists",
@@ -171,12 +374,12 @@ func fsExistsTool() Def {
 				return nil, fmt.Errorf("fs.exists requires a 'path' argument of type string")
 			}
 
-			resolved, err := filepath.Abs(pathStr.Value)
+			resolved, err := resolvePath(ctx, pathStr.Value)
 			if err != nil {
 				return evaluator.NewBool(false), nil
 			}
 
-			_, err = os.Stat(resolved)
+			_, err = os.Stat(readSource(ctx, resolved))
 			return evaluator.NewBool(err == nil), nil
 		},
 	}
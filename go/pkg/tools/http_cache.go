@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type httpCacheKey struct{}
+
+// WithHTTPCache returns a context whose http tools keep validated responses
+// in dir and revalidate them with conditional requests.
+func WithHTTPCache(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, httpCacheKey{}, dir)
+}
+
+func httpCacheDir(ctx context.Context) string {
+	dir, _ := ctx.Value(httpCacheKey{}).(string)
+	return dir
+}
+
+// httpCacheEntry is the on-disk form of a cached response. Only responses
+// carrying an ETag or Last-Modified validator are stored.
+type httpCacheEntry struct {
+	URL          string      `json:"url"`
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+}
+
+// httpCacheFile derives the entry path from the URL and request headers, so
+// requests that differ only in e.g. Authorization are cached separately.
+func httpCacheFile(dir, rawURL string, headers map[string]string) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(rawURL)
+	for _, k := range keys {
+		b.WriteString("\n" + strings.ToLower(k) + ":" + headers[k])
+	}
+	return filepath.Join(dir, sha256Hex([]byte(b.String()))+".json")
+}
+
+func loadHTTPCacheEntry(path string) *httpCacheEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entry httpCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+func saveHTTPCacheEntry(path string, entry *httpCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".http-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// cachedGet performs a GET through the cache configured on ctx. A stored
+// entry is revalidated with If-None-Match / If-Modified-Since and served
+// when the server answers 304. The boolean result reports a cache hit.
+// Without a cache directory this is a plain doHTTP call.
+func cachedGet(ctx context.Context, toolName, rawURL string, headers map[string]string) (*httpResponse, bool, error) {
+	dir := httpCacheDir(ctx)
+	if dir == "" {
+		resp, err := doHTTP(ctx, toolName, "GET", rawURL, headers, nil)
+		return resp, false, err
+	}
+
+	path := httpCacheFile(dir, rawURL, headers)
+	entry := loadHTTPCacheEntry(path)
+
+	reqHeaders := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		reqHeaders[k] = v
+	}
+	if entry != nil {
+		if entry.ETag != "" {
+			reqHeaders["If-None-Match"] = entry.ETag
+		}
+		if entry.LastModified != "" {
+			reqHeaders["If-Modified-Since"] = entry.LastModified
+		}
+	}
+
+	resp, err := doHTTP(ctx, toolName, "GET", rawURL, reqHeaders, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.status == http.StatusNotModified && entry != nil {
+		return &httpResponse{status: entry.Status, headers: entry.Headers, body: entry.Body}, true, nil
+	}
+
+	etag := resp.headers.Get("ETag")
+	lastModified := resp.headers.Get("Last-Modified")
+	if resp.status == http.StatusOK && (etag != "" || lastModified != "") {
+		// A failed cache write only costs a future refetch
+		_ = saveHTTPCacheEntry(path, &httpCacheEntry{
+			URL:          rawURL,
+			Status:       resp.status,
+			Headers:      resp.headers,
+			Body:         resp.body,
+			ETag:         etag,
+			LastModified: lastModified,
+		})
+	}
+	return resp, false, nil
+}
@@ -0,0 +1,110 @@
+package tools_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// validatorServer serves body with the given validator header, answers 304
+// when the matching conditional header comes back, and counts full
+// responses.
+func validatorServer(t *testing.T, header, value, conditional string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var full atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(conditional) == value {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set(header, value)
+		w.Write([]byte(`{"version":1}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &full
+}
+
+func getCached(t *testing.T, ctx context.Context, args *evaluator.A0Record) (body, cached string) {
+	t.Helper()
+	resp, err := tool(t, "http.get").Execute(ctx, args)
+	if err != nil {
+		t.Fatalf("http.get: %v", err)
+	}
+	return field(t, resp, "body").(evaluator.A0String).Value, evaluator.ValueToJSONString(field(t, resp, "cached"))
+}
+
+func TestHTTPCache_ETagRevalidation(t *testing.T) {
+	srv, full := validatorServer(t, "ETag", `"v1"`, "If-None-Match")
+	ctx := tools.WithHTTPCache(context.Background(), t.TempDir())
+
+	if body, cached := getCached(t, ctx, record("url", srv.URL)); body != `{"version":1}` || cached != "false" {
+		t.Fatalf("first get = %q cached %s, want a miss", body, cached)
+	}
+	if body, cached := getCached(t, ctx, record("url", srv.URL)); body != `{"version":1}` || cached != "true" {
+		t.Fatalf("second get = %q cached %s, want a hit served from the cache", body, cached)
+	}
+	if n := full.Load(); n != 1 {
+		t.Errorf("server sent %d full responses, want 1", n)
+	}
+}
+
+func TestHTTPCache_LastModifiedRevalidation(t *testing.T) {
+	srv, full := validatorServer(t, "Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT", "If-Modified-Since")
+	ctx := tools.WithHTTPCache(context.Background(), t.TempDir())
+
+	getCached(t, ctx, record("url", srv.URL))
+	if _, cached := getCached(t, ctx, record("url", srv.URL)); cached != "true" {
+		t.Errorf("second get cached %s, want a hit", cached)
+	}
+	if n := full.Load(); n != 1 {
+		t.Errorf("server sent %d full responses, want 1", n)
+	}
+}
+
+func TestHTTPCache_CacheFalseBypasses(t *testing.T) {
+	srv, full := validatorServer(t, "ETag", `"v1"`, "If-None-Match")
+	ctx := tools.WithHTTPCache(context.Background(), t.TempDir())
+
+	getCached(t, ctx, record("url", srv.URL))
+	resp, err := tool(t, "http.get").Execute(ctx, record("url", srv.URL, "cache", false))
+	if err != nil {
+		t.Fatalf("http.get: %v", err)
+	}
+	if c := field(t, resp, "cached"); c != nil {
+		t.Errorf("a bypassed call should not report 'cached', got %s", evaluator.ValueToJSONString(c))
+	}
+	if n := full.Load(); n != 2 {
+		t.Errorf("server sent %d full responses, want 2", n)
+	}
+}
+
+func TestHTTPCache_CorruptEntryIsRefetched(t *testing.T) {
+	srv, full := validatorServer(t, "ETag", `"v1"`, "If-None-Match")
+	dir := t.TempDir()
+	ctx := tools.WithHTTPCache(context.Background(), dir)
+
+	getCached(t, ctx, record("url", srv.URL))
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(entries) != 1 {
+		t.Fatalf("expected one cache entry, found %d", len(entries))
+	}
+	os.WriteFile(entries[0], []byte("{truncated"), 0644)
+
+	if body, cached := getCached(t, ctx, record("url", srv.URL)); body != `{"version":1}` || cached != "false" {
+		t.Fatalf("get with a corrupt entry = %q cached %s, want a refetch", body, cached)
+	}
+	if _, cached := getCached(t, ctx, record("url", srv.URL)); cached != "true" {
+		t.Errorf("expected the refetch to repair the entry, got cached %s", cached)
+	}
+	if n := full.Load(); n != 2 {
+		t.Errorf("server sent %d full responses, want 2", n)
+	}
+}
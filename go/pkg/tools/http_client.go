@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+type hostAllowlistKey struct{}
+
+// WithHostAllowlist returns a context that limits network tools to the given
+// hosts. Entries are exact host names or "*.example.com" wildcards.
+func WithHostAllowlist(ctx context.Context, hosts []string) context.Context {
+	return context.WithValue(ctx, hostAllowlistKey{}, hosts)
+}
+
+// checkHost rejects URLs whose host is not on the allowlist carried by ctx.
+func checkHost(ctx context.Context, rawURL string) error {
+	hosts, ok := ctx.Value(hostAllowlistKey{}).([]string)
+	if !ok {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if h == host {
+			return nil
+		}
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host '%s' is not in the policy host allowlist", host)
+}
+
+// httpClient sends the requests of network tools. It checks the host
+// allowlist again on every redirect, so an allowed host cannot send a
+// request on to a host the policy does not allow.
+var httpClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return checkHost(req.Context(), req.URL.String())
+	},
+}
+
+// httpResponse is the outcome of a request made through doHTTP.
+type httpResponse struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+// doHTTP performs a request on behalf of a network tool, enforcing the host
+// allowlist. Errors are prefixed with the tool name.
+func doHTTP(ctx context.Context, toolName, method, rawURL string, headers map[string]string, body []byte) (*httpResponse, error) {
+	if err := checkHost(ctx, rawURL); err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return sendHTTP(toolName, req)
+}
+
+// sendHTTP sends an already-built request and reads the whole response.
+// Callers are responsible for checking the host allowlist first.
+func sendHTTP(toolName string, req *http.Request) (*httpResponse, error) {
+	if err := evaluator.ChargeBytesSent(req.Context(), requestSize(req)); err != nil {
+		return nil, err
+	}
+	timings := evaluator.ToolTimingsFrom(req.Context())
+	var phases *httpPhases
+	if timings != nil {
+		phases = &httpPhases{}
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), phases.clientTrace()))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+	if phases != nil {
+		phases.record(timings, time.Now())
+	}
+	return &httpResponse{status: resp.StatusCode, headers: resp.Header, body: respBody}, nil
+}
+
+// headersRecord converts response headers to a record with lower-cased keys.
+func headersRecord(h http.Header) evaluator.A0Value {
+	pairs := make([]evaluator.KeyValue, 0, len(h))
+	for k, vs := range h {
+		pairs = append(pairs, evaluator.KeyValue{
+			Key:   strings.ToLower(k),
+			Value: evaluator.NewString(strings.Join(vs, ", ")),
+		})
+	}
+	return evaluator.NewRecord(pairs)
+}
+
+// httpPhases captures connection and transfer timestamps for one request.
+// Phases that did not happen (e.g. DNS and TLS on a reused connection) are
+// not reported.
+type httpPhases struct {
+	mu                      sync.Mutex
+	dnsStart, dnsDone       time.Time
+	connStart, connDone     time.Time
+	tlsStart, tlsDone       time.Time
+	wroteRequest, firstByte time.Time
+}
+
+func (p *httpPhases) mark(t *time.Time) {
+	p.mu.Lock()
+	*t = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *httpPhases) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.mark(&p.dnsDone) },
+		ConnectStart:         func(string, string) { p.mark(&p.connStart) },
+		ConnectDone:          func(string, string, error) { p.mark(&p.connDone) },
+		TLSHandshakeStart:    func() { p.mark(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.mark(&p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.mark(&p.wroteRequest) },
+		GotFirstResponseByte: func() { p.mark(&p.firstByte) },
+	}
+}
+
+// record reports dns, connect, tls, ttfb (request written to first response
+// byte) and transfer (first byte to end of body) phases.
+func (p *httpPhases) record(t *evaluator.ToolTimings, bodyDone time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	span := func(phase string, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			t.Record(phase, end.Sub(start))
+		}
+	}
+	span("dns", p.dnsStart, p.dnsDone)
+	span("connect", p.connStart, p.connDone)
+	span("tls", p.tlsStart, p.tlsDone)
+	span("ttfb", p.wroteRequest, p.firstByte)
+	span("transfer", p.firstByte, bodyDone)
+}
+
+// requestSize approximates the bytes a request puts on the wire for the
+// maxBytesSent budget: URL, header names and values, and body.
+func requestSize(req *http.Request) int64 {
+	n := int64(len(req.URL.String()))
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			n += int64(len(k) + len(v))
+		}
+	}
+	if req.ContentLength > 0 {
+		n += req.ContentLength
+	}
+	return n
+}
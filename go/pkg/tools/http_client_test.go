@@ -0,0 +1,101 @@
+package tools_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// record builds tool arguments from alternating keys and values.
+func record(kv ...any) *evaluator.A0Record {
+	pairs := make([]evaluator.KeyValue, 0, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		var v evaluator.A0Value
+		switch x := kv[i+1].(type) {
+		case string:
+			v = evaluator.NewString(x)
+		case bool:
+			v = evaluator.NewBool(x)
+		case float64:
+			v = evaluator.NewNumber(x)
+		case int:
+			v = evaluator.NewNumber(float64(x))
+		case evaluator.A0Value:
+			v = x
+		}
+		pairs = append(pairs, evaluator.KeyValue{Key: kv[i].(string), Value: v})
+	}
+	rec := evaluator.NewRecord(pairs).(evaluator.A0Record)
+	return &rec
+}
+
+// tool returns the default tool registered under name.
+func tool(t *testing.T, name string) *tools.Def {
+	t.Helper()
+	reg := tools.NewRegistry()
+	tools.RegisterDefaults(reg)
+	def := reg.Get(name)
+	if def == nil {
+		t.Fatalf("tool %s is not registered", name)
+	}
+	return def
+}
+
+func field(t *testing.T, v evaluator.A0Value, key string) evaluator.A0Value {
+	t.Helper()
+	rec, ok := v.(evaluator.A0Record)
+	if !ok {
+		t.Fatalf("expected a record, got %s", evaluator.ValueToJSONString(v))
+	}
+	val, _ := rec.Get(key)
+	return val
+}
+
+func TestHTTPGet_RedirectToDisallowedHostIsRefused(t *testing.T) {
+	var reached atomic.Bool
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+	}))
+	defer elsewhere.Close()
+	// The allowlist names 127.0.0.1, so redirecting to localhost leaves it.
+	target := strings.Replace(elsewhere.URL, "127.0.0.1", "localhost", 1)
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target+"/secret", http.StatusFound)
+	}))
+	defer allowed.Close()
+
+	ctx := tools.WithHostAllowlist(context.Background(), []string{"127.0.0.1"})
+	_, err := tool(t, "http.get").Execute(ctx, record("url", allowed.URL))
+	if err == nil || !strings.Contains(err.Error(), "host 'localhost' is not in the policy host allowlist") {
+		t.Fatalf("expected the redirect to be refused, got %v", err)
+	}
+	if reached.Load() {
+		t.Errorf("expected the disallowed host never to receive the request")
+	}
+}
+
+func TestHTTPGet_RedirectWithinAllowlistIsFollowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	ctx := tools.WithHostAllowlist(context.Background(), []string{"127.0.0.1"})
+	res, err := tool(t, "http.get").Execute(ctx, record("url", srv.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body := field(t, res, "body"); evaluator.ValueToJSONString(body) != `"done"` {
+		t.Errorf("expected the redirect to be followed, got body %s", evaluator.ValueToJSONString(body))
+	}
+}
@@ -3,8 +3,6 @@ package tools
 import (
 	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"strings"
 
@@ -32,7 +30,7 @@ func httpGetTool() Def {
 			headers := make(map[string]string)
 			if hdrsVal, found := args.Get("headers"); found {
 				if hdrsRec, ok := hdrsVal.(evaluator.A0Record); ok {
-					for _, kv := range hdrsRec.Pairs {
+					for _, kv := range hdrsRec.Pairs() {
 						if s, ok := kv.Value.(evaluator.A0String); ok {
 							headers[kv.Key] = s.Value
 						}
@@ -40,40 +38,32 @@ func httpGetTool() Def {
 				}
 			}
 
-			req, err := http.NewRequestWithContext(ctx, "GET", urlStr.Value, nil)
-			if err != nil {
-				return nil, fmt.Errorf("http.get: %s", err)
+			// cache: false bypasses the response cache for this call
+			useCache := true
+			if cacheVal, found := args.Get("cache"); found {
+				if b, ok := cacheVal.(evaluator.A0Bool); ok {
+					useCache = b.Value
+				}
 			}
-
-			for k, v := range headers {
-				req.Header.Set(k, v)
+			cacheCtx := ctx
+			if !useCache {
+				cacheCtx = WithHTTPCache(ctx, "")
 			}
 
-			resp, err := http.DefaultClient.Do(req)
+			resp, hit, err := cachedGet(cacheCtx, "http.get", urlStr.Value, headers)
 			if err != nil {
-				return nil, fmt.Errorf("http.get: %s", err)
+				return nil, err
 			}
-			defer resp.Body.Close()
 
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, fmt.Errorf("http.get: %s", err)
+			pairs := []evaluator.KeyValue{
+				{Key: "status", Value: evaluator.NewNumber(float64(resp.status))},
+				{Key: "headers", Value: headersRecord(resp.headers)},
+				{Key: "body", Value: evaluator.NewString(string(resp.body))},
 			}
-
-			// Build response headers record
-			respHeaders := make([]evaluator.KeyValue, 0)
-			for k, vs := range resp.Header {
-				respHeaders = append(respHeaders, evaluator.KeyValue{
-					Key:   strings.ToLower(k),
-					Value: evaluator.NewString(strings.Join(vs, ", ")),
-				})
+			if httpCacheDir(cacheCtx) != "" {
+				pairs = append(pairs, evaluator.KeyValue{Key: "cached", Value: evaluator.NewBool(hit)})
 			}
-
-			return evaluator.NewRecord([]evaluator.KeyValue{
-				{Key: "status", Value: evaluator.NewNumber(float64(resp.StatusCode))},
-				{Key: "headers", Value: evaluator.NewRecord(respHeaders)},
-				{Key: "body", Value: evaluator.NewString(string(body))},
-			}), nil
+			return evaluator.NewRecord(pairs), nil
 		},
 	}
 }
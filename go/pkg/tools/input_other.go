@@ -0,0 +1,23 @@
+//go:build !windows
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+)
+
+// disableEcho turns off terminal echo for secret input and returns a func
+// that restores it.
+func disableEcho() (func(), error) {
+	if err := stty("-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty("echo") }, nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// stdin hands out lines read from os.Stdin.
+var stdin = newLineReader(os.Stdin)
+
+// stdinIsTerminal reports whether stdin is attached to a terminal.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// readLine reads one line from stdin, honoring ctx cancellation.
+func readLine(ctx context.Context) (string, error) {
+	return stdin.readLine(ctx)
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+// lineReader reads lines from src on a single long-lived goroutine, one
+// line per request. A read abandoned because its ctx was cancelled stays
+// pending, and the line it produces goes to the next readLine rather than
+// being lost.
+type lineReader struct {
+	src     io.Reader
+	start   sync.Once
+	turn    chan struct{} // held by the caller currently waiting for a line
+	want    chan struct{}
+	lines   chan lineResult
+	pending bool // a line has been requested but not yet handed out
+}
+
+func newLineReader(src io.Reader) *lineReader {
+	return &lineReader{
+		src:   src,
+		turn:  make(chan struct{}, 1),
+		want:  make(chan struct{}),
+		lines: make(chan lineResult, 1),
+	}
+}
+
+func (r *lineReader) run() {
+	br := bufio.NewReader(r.src)
+	for range r.want {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		r.lines <- lineResult{strings.TrimRight(line, "\r\n"), err}
+	}
+}
+
+func (r *lineReader) readLine(ctx context.Context) (string, error) {
+	select {
+	case r.turn <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-r.turn }()
+
+	r.start.Do(func() { go r.run() })
+	if !r.pending {
+		r.pending = true
+		r.want <- struct{}{}
+	}
+	select {
+	case res := <-r.lines:
+		r.pending = false
+		return res.line, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func inputPromptTool() Def {
+	return Def{
+		Name:         "input.prompt",
+		Mode:         "effect",
+		CapabilityID: "interactive",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			msgVal, _ := args.Get("message")
+			msgStr, ok := msgVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("input.prompt requires a 'message' argument of type string")
+			}
+
+			var choices []string
+			if choicesVal, found := args.Get("choices"); found {
+				if _, isNull := choicesVal.(evaluator.A0Null); !isNull {
+					list, ok := choicesVal.(evaluator.A0List)
+					if !ok {
+						return nil, fmt.Errorf("input.prompt 'choices' must be a list of strings")
+					}
+					for _, item := range list.Items {
+						s, ok := item.(evaluator.A0String)
+						if !ok {
+							return nil, fmt.Errorf("input.prompt 'choices' must be a list of strings")
+						}
+						choices = append(choices, s.Value)
+					}
+				}
+			}
+
+			secret := false
+			if secretVal, found := args.Get("secret"); found {
+				secret = evaluator.Truthiness(secretVal)
+			}
+
+			if !stdinIsTerminal() {
+				return nil, fmt.Errorf("input.prompt: no terminal attached to stdin")
+			}
+
+			prompt := msgStr.Value
+			if len(choices) > 0 {
+				prompt += " [" + strings.Join(choices, "/") + "]"
+			}
+
+			for {
+				// Prompts go to stderr so stdout stays reserved for the result
+				fmt.Fprint(os.Stderr, prompt+" ")
+
+				var answer string
+				var err error
+				if secret {
+					restore, echoErr := disableEcho()
+					if echoErr != nil {
+						return nil, fmt.Errorf("input.prompt: cannot hide input: %s", echoErr)
+					}
+					answer, err = readLine(ctx)
+					restore()
+					fmt.Fprintln(os.Stderr)
+				} else {
+					answer, err = readLine(ctx)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("input.prompt: %s", err)
+				}
+
+				if len(choices) == 0 {
+					return evaluator.NewString(answer), nil
+				}
+				for _, c := range choices {
+					if strings.EqualFold(strings.TrimSpace(answer), c) {
+						return evaluator.NewString(c), nil
+					}
+				}
+				fmt.Fprintf(os.Stderr, "Please answer one of: %s\n", strings.Join(choices, ", "))
+			}
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+func TestLineReader_ReadsLines(t *testing.T) {
+	r := newLineReader(strings.NewReader("first\r\nsecond\nlast"))
+	for _, want := range []string{"first", "second", "last"} {
+		got, err := r.readLine(context.Background())
+		if err != nil || got != want {
+			t.Fatalf("readLine = %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := r.readLine(context.Background()); err != io.EOF {
+		t.Errorf("expected io.EOF at end of input, got %v", err)
+	}
+}
+
+func TestLineReader_CancelledReadKeepsLine(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r := newLineReader(pr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := r.readLine(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the read to be cancelled, got %v", err)
+	}
+
+	// The abandoned read is still waiting on the pipe; the line it gets
+	// must go to the next caller, and only one line may be consumed.
+	go pw.Write([]byte("answer\nnext\n"))
+	got, err := r.readLine(context.Background())
+	if err != nil || got != "answer" {
+		t.Fatalf("readLine after cancellation = %q, %v; want \"answer\"", got, err)
+	}
+	got, err = r.readLine(context.Background())
+	if err != nil || got != "next" {
+		t.Fatalf("second readLine = %q, %v; want \"next\"", got, err)
+	}
+}
+
+func TestInputPrompt_RequiresTerminal(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	saved := os.Stdin
+	os.Stdin = pr
+	defer func() { os.Stdin = saved }()
+
+	args := evaluator.NewRecord([]evaluator.KeyValue{{Key: "message", Value: evaluator.NewString("Continue?")}}).(evaluator.A0Record)
+	_, err = inputPromptTool().Execute(context.Background(), &args)
+	if err == nil || !strings.Contains(err.Error(), "no terminal attached to stdin") {
+		t.Errorf("expected piped stdin to be refused, got %v", err)
+	}
+}
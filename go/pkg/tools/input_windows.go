@@ -0,0 +1,31 @@
+//go:build windows
+
+package tools
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const enableEchoInput = 0x0004
+
+var (
+	kernel32DLL        = syscall.NewLazyDLL("kernel32.dll")
+	getConsoleModeProc = kernel32DLL.NewProc("GetConsoleMode")
+	setConsoleModeProc = kernel32DLL.NewProc("SetConsoleMode")
+)
+
+// disableEcho turns off console echo for secret input and returns a func
+// that restores it.
+func disableEcho() (func(), error) {
+	handle := os.Stdin.Fd()
+	var mode uint32
+	if r, _, err := getConsoleModeProc.Call(handle, uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return nil, err
+	}
+	if r, _, err := setConsoleModeProc.Call(handle, uintptr(mode&^enableEchoInput)); r == 0 {
+		return nil, err
+	}
+	return func() { setConsoleModeProc.Call(handle, uintptr(mode)) }, nil
+}
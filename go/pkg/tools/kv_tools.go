@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/thomasrohde/agent0/go/internal/filelock"
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+type kvPathKey struct{}
+
+// WithKVPath returns a context whose kv.* tools use the store file at path.
+func WithKVPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, kvPathKey{}, path)
+}
+
+// kvStorePath returns the configured store file, defaulting to
+// ~/.a0/kv.json.
+func kvStorePath(ctx context.Context) (string, error) {
+	if p, ok := ctx.Value(kvPathKey{}).(string); ok && p != "" {
+		return filepath.Abs(p)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("no kv path configured and home directory unavailable: %s", err)
+	}
+	return filepath.Join(home, ".a0", "kv.json"), nil
+}
+
+// The store is a single JSON object, read whole and rewritten atomically on
+// every write. That suits the small amounts of scratch state agents keep
+// (cursors, dedup sets, checkpoints) and keeps the module free of
+// dependencies; it is not meant for large or hot data sets.
+//
+// kvMu serializes store access within the process, and lockKV adds an
+// advisory lock on a sibling ".lock" file so concurrent runs sharing a store
+// do not lose each other's writes.
+var kvMu sync.Mutex
+
+// lockKV takes the in-process and cross-process locks for the store at path
+// and returns the func that releases them.
+func lockKV(path string) (func(), error) {
+	kvMu.Lock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		kvMu.Unlock()
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		kvMu.Unlock()
+		return nil, err
+	}
+	if err := filelock.Lock(f); err != nil {
+		f.Close()
+		kvMu.Unlock()
+		return nil, fmt.Errorf("cannot lock store %s: %s", path, err)
+	}
+	return func() {
+		filelock.Unlock(f)
+		f.Close()
+		kvMu.Unlock()
+	}, nil
+}
+
+func loadKV(path string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return make(map[string]json.RawMessage), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	store := make(map[string]json.RawMessage)
+	if len(data) == 0 {
+		return store, nil
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("corrupt store %s: %s", path, err)
+	}
+	return store, nil
+}
+
+func saveKV(path string, store map[string]json.RawMessage) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".kv-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func kvKeyArg(toolName string, args *evaluator.A0Record) (string, error) {
+	keyVal, _ := args.Get("key")
+	keyStr, ok := keyVal.(evaluator.A0String)
+	if !ok || keyStr.Value == "" {
+		return "", fmt.Errorf("%s requires a non-empty 'key' argument of type string", toolName)
+	}
+	return keyStr.Value, nil
+}
+
+func kvGetTool() Def {
+	return Def{
+		Name:         "kv.get",
+		Mode:         "read",
+		CapabilityID: "kv",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			key, err := kvKeyArg("kv.get", args)
+			if err != nil {
+				return nil, err
+			}
+			path, err := kvStorePath(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("kv.get: %s", err)
+			}
+
+			unlock, err := lockKV(path)
+			if err != nil {
+				return nil, fmt.Errorf("kv.get: %s", err)
+			}
+			store, err := loadKV(path)
+			unlock()
+			if err != nil {
+				return nil, fmt.Errorf("kv.get: %s", err)
+			}
+
+			raw, found := store[key]
+			if !found {
+				if def, ok := args.Get("default"); ok {
+					return def, nil
+				}
+				return evaluator.NewNull(), nil
+			}
+			val, err := evaluator.ParseJSONToValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("kv.get: %s", err)
+			}
+			return val, nil
+		},
+	}
+}
+
+func kvSetTool() Def {
+	return Def{
+		Name:         "kv.set",
+		Mode:         "effect",
+		CapabilityID: "kv",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			key, err := kvKeyArg("kv.set", args)
+			if err != nil {
+				return nil, err
+			}
+			value, _ := args.Get("value")
+			if value == nil {
+				value = evaluator.NewNull()
+			}
+			raw, err := evaluator.ValueToJSON(value)
+			if err != nil {
+				return nil, fmt.Errorf("kv.set: failed to serialize value: %s", err)
+			}
+			path, err := kvStorePath(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("kv.set: %s", err)
+			}
+
+			unlock, err := lockKV(path)
+			if err != nil {
+				return nil, fmt.Errorf("kv.set: %s", err)
+			}
+			defer unlock()
+			store, err := loadKV(path)
+			if err != nil {
+				return nil, fmt.Errorf("kv.set: %s", err)
+			}
+			store[key] = raw
+			if err := saveKV(path, store); err != nil {
+				return nil, fmt.Errorf("kv.set: %s", err)
+			}
+
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "key", Value: evaluator.NewString(key)},
+				{Key: "bytes", Value: evaluator.NewNumber(float64(len(raw)))},
+			}), nil
+		},
+		Prepare: func(ctx context.Context, args *evaluator.A0Record) (any, error) {
+			return saveKVEntry(ctx, "kv.set", args)
+		},
+		Rollback: func(ctx context.Context, token any) error { return token.(*kvEntry).restore() },
+	}
+}
+
+func kvDeleteTool() Def {
+	return Def{
+		Name:         "kv.delete",
+		Mode:         "effect",
+		CapabilityID: "kv",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			key, err := kvKeyArg("kv.delete", args)
+			if err != nil {
+				return nil, err
+			}
+			path, err := kvStorePath(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("kv.delete: %s", err)
+			}
+
+			unlock, err := lockKV(path)
+			if err != nil {
+				return nil, fmt.Errorf("kv.delete: %s", err)
+			}
+			defer unlock()
+			store, err := loadKV(path)
+			if err != nil {
+				return nil, fmt.Errorf("kv.delete: %s", err)
+			}
+			_, found := store[key]
+			if found {
+				delete(store, key)
+				if err := saveKV(path, store); err != nil {
+					return nil, fmt.Errorf("kv.delete: %s", err)
+				}
+			}
+
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "key", Value: evaluator.NewString(key)},
+				{Key: "deleted", Value: evaluator.NewBool(found)},
+			}), nil
+		},
+		Prepare: func(ctx context.Context, args *evaluator.A0Record) (any, error) {
+			return saveKVEntry(ctx, "kv.delete", args)
+		},
+		Rollback: func(ctx context.Context, token any) error { return token.(*kvEntry).restore() },
+	}
+}
+
+// kvEntry is a key's value before a transactional kv.set or kv.delete, so
+// the call can be rolled back.
+type kvEntry struct {
+	path, key string
+	raw       json.RawMessage // nil when the key was absent
+}
+
+func saveKVEntry(ctx context.Context, tool string, args *evaluator.A0Record) (*kvEntry, error) {
+	key, err := kvKeyArg(tool, args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := kvStorePath(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", tool, err)
+	}
+	unlock, err := lockKV(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", tool, err)
+	}
+	defer unlock()
+	store, err := loadKV(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", tool, err)
+	}
+	return &kvEntry{path: path, key: key, raw: store[key]}, nil
+}
+
+func (e *kvEntry) restore() error {
+	unlock, err := lockKV(e.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	store, err := loadKV(e.path)
+	if err != nil {
+		return err
+	}
+	if e.raw == nil {
+		delete(store, e.key)
+	} else {
+		store[e.key] = e.raw
+	}
+	return saveKV(e.path, store)
+}
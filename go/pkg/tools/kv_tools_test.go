@@ -0,0 +1,138 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+func kvContext(t *testing.T) (context.Context, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state", "kv.json")
+	return tools.WithKVPath(context.Background(), path), path
+}
+
+func TestKV_SetGetDelete(t *testing.T) {
+	ctx, path := kvContext(t)
+
+	got, err := tool(t, "kv.get").Execute(ctx, record("key", "cursor"))
+	if err != nil {
+		t.Fatalf("kv.get: %v", err)
+	}
+	if _, ok := got.(evaluator.A0Null); !ok {
+		t.Errorf("missing key should read as null, got %s", evaluator.ValueToJSONString(got))
+	}
+	got, _ = tool(t, "kv.get").Execute(ctx, record("key", "cursor", "default", 0))
+	if s := evaluator.ValueToJSONString(got); s != "0" {
+		t.Errorf("missing key with default = %s, want 0", s)
+	}
+
+	value := record("seen", evaluator.NewList([]evaluator.A0Value{evaluator.NewString("a")}), "n", 3)
+	set, err := tool(t, "kv.set").Execute(ctx, record("key", "cursor", "value", value))
+	if err != nil {
+		t.Fatalf("kv.set: %v", err)
+	}
+	if s := evaluator.ValueToJSONString(field(t, set, "key")); s != `"cursor"` {
+		t.Errorf("kv.set key = %s", s)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the store file to be created: %v", err)
+	}
+
+	got, _ = tool(t, "kv.get").Execute(ctx, record("key", "cursor", "default", 0))
+	if s, want := evaluator.ValueToJSONString(got), evaluator.ValueToJSONString(value); s != want {
+		t.Errorf("kv.get = %s, want %s", s, want)
+	}
+
+	del, err := tool(t, "kv.delete").Execute(ctx, record("key", "cursor"))
+	if err != nil {
+		t.Fatalf("kv.delete: %v", err)
+	}
+	if s := evaluator.ValueToJSONString(field(t, del, "deleted")); s != "true" {
+		t.Errorf("kv.delete deleted = %s, want true", s)
+	}
+	del, _ = tool(t, "kv.delete").Execute(ctx, record("key", "cursor"))
+	if s := evaluator.ValueToJSONString(field(t, del, "deleted")); s != "false" {
+		t.Errorf("second kv.delete deleted = %s, want false", s)
+	}
+	got, _ = tool(t, "kv.get").Execute(ctx, record("key", "cursor", "default", "none"))
+	if s := evaluator.ValueToJSONString(got); s != `"none"` {
+		t.Errorf("kv.get after delete = %s, want the default", s)
+	}
+}
+
+func TestKV_RequiresKey(t *testing.T) {
+	ctx, _ := kvContext(t)
+	_, err := tool(t, "kv.set").Execute(ctx, record("key", "", "value", 1))
+	if err == nil || !strings.Contains(err.Error(), "non-empty 'key'") {
+		t.Errorf("expected an empty key to be rejected, got %v", err)
+	}
+}
+
+func TestKV_CorruptStore(t *testing.T) {
+	ctx, path := kvContext(t)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("{not json"), 0644)
+	_, err := tool(t, "kv.get").Execute(ctx, record("key", "k"))
+	if err == nil || !strings.Contains(err.Error(), "corrupt store") {
+		t.Errorf("expected a corrupt store error, got %v", err)
+	}
+}
+
+func TestKV_RollbackRestoresPreviousValue(t *testing.T) {
+	ctx, _ := kvContext(t)
+	set := tool(t, "kv.set")
+	set.Execute(ctx, record("key", "k", "value", "before"))
+
+	args := record("key", "k", "value", "after")
+	token, err := set.Prepare(ctx, args)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	set.Execute(ctx, args)
+	if err := set.Rollback(ctx, token); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	got, _ := tool(t, "kv.get").Execute(ctx, record("key", "k"))
+	if s := evaluator.ValueToJSONString(got); s != `"before"` {
+		t.Errorf("after rollback kv.get = %s, want \"before\"", s)
+	}
+
+	// Rolling back a write to a new key removes it again.
+	args = record("key", "fresh", "value", 1)
+	token, _ = set.Prepare(ctx, args)
+	set.Execute(ctx, args)
+	set.Rollback(ctx, token)
+	got, _ = tool(t, "kv.get").Execute(ctx, record("key", "fresh", "default", "absent"))
+	if s := evaluator.ValueToJSONString(got); s != `"absent"` {
+		t.Errorf("after rollback of a new key kv.get = %s, want the default", s)
+	}
+}
+
+func TestKV_ConcurrentWritersKeepAllKeys(t *testing.T) {
+	ctx, _ := kvContext(t)
+	set := tool(t, "kv.set")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := set.Execute(ctx, record("key", evaluator.FormatNumber(float64(i)), "value", i)); err != nil {
+				t.Errorf("kv.set: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		got, _ := tool(t, "kv.get").Execute(ctx, record("key", evaluator.FormatNumber(float64(i))))
+		if _, ok := got.(evaluator.A0Null); ok {
+			t.Errorf("key %d was lost", i)
+		}
+	}
+}
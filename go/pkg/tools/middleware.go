@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// Retry retries read-mode tools up to attempts times in total, waiting delay
+// between tries (doubling each time). Effect tools are never retried because
+// repeating a side effect is not safe in general.
+func Retry(attempts int, delay time.Duration) Middleware {
+	return func(tool Def, next ExecuteFunc) ExecuteFunc {
+		if tool.Mode != "read" || attempts <= 1 {
+			return next
+		}
+		return func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			wait := delay
+			for i := 1; ; i++ {
+				result, err := next(ctx, args)
+				if err == nil || i >= attempts {
+					return result, err
+				}
+				select {
+				case <-ctx.Done():
+					return nil, err
+				case <-time.After(wait):
+				}
+				wait *= 2
+			}
+		}
+	}
+}
+
+// Logging records one structured entry per tool call with its duration and
+// outcome. Arguments are not logged, as they may contain secrets.
+func Logging(logger *slog.Logger) Middleware {
+	return func(tool Def, next ExecuteFunc) ExecuteFunc {
+		return func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			start := time.Now()
+			result, err := next(ctx, args)
+			attrs := []slog.Attr{
+				slog.String("tool", tool.Name),
+				slog.String("mode", tool.Mode),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+				logger.LogAttrs(ctx, slog.LevelWarn, "tool call failed", attrs...)
+				return result, err
+			}
+			logger.LogAttrs(ctx, slog.LevelInfo, "tool call", attrs...)
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package tools_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// flakyTool fails its first failures calls and counts every call.
+func flakyTool(name, mode string, failures int, calls *int) tools.Def {
+	return tools.Def{Name: name, Mode: mode, Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+		*calls++
+		if *calls <= failures {
+			return nil, errors.New("transient")
+		}
+		return evaluator.NewString("done"), nil
+	}}
+}
+
+func TestRegistryUse_OrderAndLateRegistration(t *testing.T) {
+	var trace []string
+	tag := func(name string) tools.Middleware {
+		return func(tool tools.Def, next tools.ExecuteFunc) tools.ExecuteFunc {
+			return func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+				trace = append(trace, name+">"+tool.Name)
+				return next(ctx, args)
+			}
+		}
+	}
+	reg := tools.NewRegistry()
+	reg.Use(tag("outer"), tag("inner"))
+	var calls int
+	reg.Register(flakyTool("test.late", "read", 0, &calls))
+
+	reg.Get("test.late").Execute(context.Background(), record())
+	reg.All()["test.late"].Execute(context.Background(), record())
+	if got := strings.Join(trace, " "); got != "outer>test.late inner>test.late outer>test.late inner>test.late" {
+		t.Errorf("middleware trace = %q", got)
+	}
+	if calls != 2 {
+		t.Errorf("tool ran %d times, want 2", calls)
+	}
+}
+
+func TestRetry_RetriesReadTools(t *testing.T) {
+	reg := tools.NewRegistry()
+	reg.Use(tools.Retry(3, time.Millisecond))
+	var ok, failing int
+	reg.Register(flakyTool("test.ok", "read", 2, &ok))
+	reg.Register(flakyTool("test.failing", "read", 5, &failing))
+
+	if v, err := reg.Get("test.ok").Execute(context.Background(), record()); err != nil || v.(evaluator.A0String).Value != "done" {
+		t.Errorf("expected the third attempt to succeed, got %v, %v", v, err)
+	}
+	if ok != 3 {
+		t.Errorf("test.ok ran %d times, want 3", ok)
+	}
+	if _, err := reg.Get("test.failing").Execute(context.Background(), record()); err == nil {
+		t.Errorf("expected the last error after all attempts")
+	}
+	if failing != 3 {
+		t.Errorf("test.failing ran %d times, want 3", failing)
+	}
+}
+
+func TestRetry_NeverRetriesEffectTools(t *testing.T) {
+	reg := tools.NewRegistry()
+	reg.Use(tools.Retry(3, time.Millisecond))
+	var calls int
+	reg.Register(flakyTool("test.effect", "effect", 1, &calls))
+	if _, err := reg.Get("test.effect").Execute(context.Background(), record()); err == nil || calls != 1 {
+		t.Errorf("effect tool ran %d times (err %v), want one failed call", calls, err)
+	}
+}
+
+func TestRetry_StopsWhenContextIsDone(t *testing.T) {
+	reg := tools.NewRegistry()
+	reg.Use(tools.Retry(5, time.Hour))
+	var calls int
+	reg.Register(flakyTool("test.slow", "read", 5, &calls))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := reg.Get("test.slow").Execute(ctx, record()); err == nil || err.Error() != "transient" || calls != 1 {
+		t.Errorf("expected the first error once the context ends, got %v after %d calls", err, calls)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	reg := tools.NewRegistry()
+	reg.Use(tools.Logging(logger))
+	var ok, failing int
+	reg.Register(flakyTool("test.ok", "read", 0, &ok))
+	reg.Register(flakyTool("test.failing", "effect", 1, &failing))
+
+	reg.Get("test.ok").Execute(context.Background(), record("token", "s3cr3t"))
+	reg.Get("test.failing").Execute(context.Background(), record())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one log entry per call, got:\n%s", buf.String())
+	}
+	for _, want := range []string{"level=INFO", `msg="tool call"`, "tool=test.ok", "mode=read", "duration="} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("log entry %q is missing %q", lines[0], want)
+		}
+	}
+	for _, want := range []string{"level=WARN", `msg="tool call failed"`, "tool=test.failing", "error=transient"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("log entry %q is missing %q", lines[1], want)
+		}
+	}
+	if strings.Contains(buf.String(), "s3cr3t") {
+		t.Errorf("arguments must not be logged:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// slackAPIURL is the Slack Web API endpoint used when a bot token is set.
+const slackAPIURL = "https://slack.com/api/chat.postMessage"
+
+func notifyWebhookTool() Def {
+	return Def{
+		Name:         "notify.webhook",
+		Mode:         "effect",
+		CapabilityID: "notify",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			urlVal, _ := args.Get("url")
+			urlStr, ok := urlVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("notify.webhook requires a 'url' argument of type string")
+			}
+			payload, _ := args.Get("payload")
+			if payload == nil {
+				payload = evaluator.NewNull()
+			}
+			body, err := evaluator.ValueToJSON(payload)
+			if err != nil {
+				return nil, fmt.Errorf("notify.webhook: failed to serialize payload: %s", err)
+			}
+
+			headers := map[string]string{"Content-Type": "application/json"}
+			if hdrsVal, found := args.Get("headers"); found {
+				if hdrsRec, ok := hdrsVal.(evaluator.A0Record); ok {
+					for _, kv := range hdrsRec.Pairs() {
+						if s, ok := kv.Value.(evaluator.A0String); ok {
+							headers[kv.Key] = s.Value
+						}
+					}
+				}
+			}
+
+			resp, err := doHTTP(ctx, "notify.webhook", "POST", urlStr.Value, headers, body)
+			if err != nil {
+				return nil, err
+			}
+			return notifyResult(resp), nil
+		},
+	}
+}
+
+// notify.slack posts through an incoming webhook (A0_SLACK_WEBHOOK_URL) or,
+// failing that, the chat.postMessage API with a bot token (SLACK_BOT_TOKEN).
+func notifySlackTool() Def {
+	return Def{
+		Name:         "notify.slack",
+		Mode:         "effect",
+		CapabilityID: "notify",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			textVal, _ := args.Get("text")
+			textStr, ok := textVal.(evaluator.A0String)
+			if !ok {
+				return nil, fmt.Errorf("notify.slack requires a 'text' argument of type string")
+			}
+
+			pairs := []evaluator.KeyValue{{Key: "text", Value: textStr}}
+			if chVal, found := args.Get("channel"); found {
+				chStr, ok := chVal.(evaluator.A0String)
+				if !ok {
+					return nil, fmt.Errorf("notify.slack 'channel' must be a string")
+				}
+				pairs = append([]evaluator.KeyValue{{Key: "channel", Value: chStr}}, pairs...)
+			}
+			body, err := evaluator.ValueToJSON(evaluator.NewRecord(pairs))
+			if err != nil {
+				return nil, fmt.Errorf("notify.slack: failed to serialize message: %s", err)
+			}
+
+			headers := map[string]string{"Content-Type": "application/json; charset=utf-8"}
+			target := os.Getenv("A0_SLACK_WEBHOOK_URL")
+			if target == "" {
+				token := os.Getenv("SLACK_BOT_TOKEN")
+				if token == "" {
+					return nil, fmt.Errorf("notify.slack: set A0_SLACK_WEBHOOK_URL or SLACK_BOT_TOKEN")
+				}
+				target = slackAPIURL
+				headers["Authorization"] = "Bearer " + token
+			}
+
+			resp, err := doHTTP(ctx, "notify.slack", "POST", target, headers, body)
+			if err != nil {
+				return nil, err
+			}
+			return notifyResult(resp), nil
+		},
+	}
+}
+
+// notifyResult builds the { ok, status, body } record returned by notify tools.
+func notifyResult(resp *httpResponse) evaluator.A0Value {
+	return evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "ok", Value: evaluator.NewBool(resp.status >= 200 && resp.status < 300)},
+		{Key: "status", Value: evaluator.NewNumber(float64(resp.status))},
+		{Key: "body", Value: evaluator.NewString(string(resp.body))},
+	})
+}
@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type overlayKey struct{}
+
+// overlayManifest is written to the overlay directory so that a later
+// Overlay.Apply knows which tree the overlay belongs to.
+const overlayManifest = "a0overlay.json"
+
+// Overlay is a copy-on-write layer over the directory tree at Root. Under
+// an overlay, fs effect tools write to Dir instead of Root, and fs read
+// tools see those writes in place of the real files. sh.exec is not
+// redirected.
+type Overlay struct {
+	Root string // the tree being protected
+	Dir  string // where writes go; files live under Dir/tree
+
+	realRoot string // Root with symlinks resolved, as workdir paths are
+}
+
+// OpenOverlay prepares dir as an overlay of root, creating it if needed. An
+// existing overlay is reused (so successive runs build on each other) but
+// must belong to the same root.
+func OpenOverlay(root, dir string) (*Overlay, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := LoadOverlay(dir); err == nil {
+		if existing.Root != root {
+			return nil, fmt.Errorf("overlay '%s' belongs to %s, not %s", dir, existing.Root, root)
+		}
+		return existing, nil
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tree"), 0o755); err != nil {
+		return nil, err
+	}
+	data, _ := json.MarshalIndent(map[string]string{"root": root}, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, overlayManifest), data, 0o644); err != nil {
+		return nil, err
+	}
+	return newOverlay(root, dir), nil
+}
+
+// LoadOverlay opens an overlay directory created by OpenOverlay.
+func LoadOverlay(dir string) (*Overlay, error) {
+	data, err := os.ReadFile(filepath.Join(dir, overlayManifest))
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not an overlay directory: %w", dir, err)
+	}
+	var m struct {
+		Root string `json:"root"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil || m.Root == "" {
+		return nil, fmt.Errorf("'%s': invalid %s", dir, overlayManifest)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return newOverlay(m.Root, abs), nil
+}
+
+func newOverlay(root, dir string) *Overlay {
+	o := &Overlay{Root: root, Dir: dir, realRoot: root}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		o.realRoot = real
+	}
+	return o
+}
+
+// WithOverlay returns a context in which fs tools use o.
+func WithOverlay(ctx context.Context, o *Overlay) context.Context {
+	return context.WithValue(ctx, overlayKey{}, o)
+}
+
+func overlayFrom(ctx context.Context) *Overlay {
+	o, _ := ctx.Value(overlayKey{}).(*Overlay)
+	return o
+}
+
+// shadow returns where path lives in the overlay, or "" when path is
+// outside Root.
+func (o *Overlay) shadow(path string) string {
+	if within(o.Dir, path) {
+		return ""
+	}
+	for _, root := range []string{o.Root, o.realRoot} {
+		if within(root, path) {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return ""
+			}
+			return filepath.Join(o.Dir, "tree", rel)
+		}
+	}
+	return ""
+}
+
+// writeTarget maps a resolved path an fs effect tool is about to write to
+// its overlay location. Paths in the run's temp directory are scratch space
+// and pass through; other paths outside the overlay root are refused.
+func writeTarget(ctx context.Context, resolved string) (string, error) {
+	o := overlayFrom(ctx)
+	if o == nil {
+		return resolved, nil
+	}
+	if target := o.shadow(resolved); target != "" {
+		return target, nil
+	}
+	if scope := tempScopeFrom(ctx); scope != nil && scope.Path() != "" && within(scope.Path(), resolved) {
+		return resolved, nil
+	}
+	return "", fmt.Errorf("path '%s' is outside the overlay root %s", resolved, o.Root)
+}
+
+// readSource maps a resolved path an fs read tool is about to read to its
+// overlay copy, if the run (or an earlier one) wrote it.
+func readSource(ctx context.Context, resolved string) string {
+	o := overlayFrom(ctx)
+	if o == nil {
+		return resolved
+	}
+	if target := o.shadow(resolved); target != "" {
+		if _, err := os.Stat(target); err == nil {
+			return target
+		}
+	}
+	return resolved
+}
+
+// readDirMerged lists a directory as seen through the overlay: real entries
+// plus those the overlay added, with overlay entries taking precedence.
+func readDirMerged(ctx context.Context, resolved string) ([]fs.DirEntry, error) {
+	entries, err := os.ReadDir(resolved)
+	o := overlayFrom(ctx)
+	if o == nil {
+		return entries, err
+	}
+	target := o.shadow(resolved)
+	if target == "" {
+		return entries, err
+	}
+	extra, oerr := os.ReadDir(target)
+	if oerr != nil {
+		return entries, err
+	}
+	byName := make(map[string]fs.DirEntry, len(entries)+len(extra))
+	for _, e := range entries {
+		byName[e.Name()] = e
+	}
+	for _, e := range extra {
+		byName[e.Name()] = e
+	}
+	merged := make([]fs.DirEntry, 0, len(byName))
+	for _, e := range byName {
+		merged = append(merged, e)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
+
+// OverlayChange is one file the overlay would write to Root. Status is
+// "added" or "modified"; files identical to Root are not reported.
+type OverlayChange struct {
+	Path   string `json:"path"` // relative to Root, slash-separated
+	Status string `json:"status"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Changes lists the files in the overlay that differ from Root, sorted by
+// path.
+func (o *Overlay) Changes() ([]OverlayChange, error) {
+	var changes []OverlayChange
+	tree := filepath.Join(o.Dir, "tree")
+	err := filepath.WalkDir(tree, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(tree, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		status := "added"
+		if old, err := os.ReadFile(filepath.Join(o.Root, rel)); err == nil {
+			if bytes.Equal(old, data) {
+				return nil
+			}
+			status = "modified"
+		}
+		changes = append(changes, OverlayChange{Path: filepath.ToSlash(rel), Status: status, Bytes: int64(len(data))})
+		return nil
+	})
+	return changes, err
+}
+
+// Apply copies the overlay's changes into Root and removes the overlay
+// directory. It returns the changes it applied.
+func (o *Overlay) Apply() ([]OverlayChange, error) {
+	changes, err := o.Changes()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		src := filepath.Join(o.Dir, "tree", filepath.FromSlash(c.Path))
+		dst := filepath.Join(o.Root, filepath.FromSlash(c.Path))
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dst, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return changes, os.RemoveAll(o.Dir)
+}
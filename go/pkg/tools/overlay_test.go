@@ -0,0 +1,125 @@
+package tools_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// overlayTree returns a root holding a.txt and keep.txt, an overlay of it,
+// and a workdir context whose fs tools write through the overlay.
+func overlayTree(t *testing.T) (context.Context, string, *tools.Overlay) {
+	t.Helper()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("old"), 0o644)
+	os.WriteFile(filepath.Join(root, "keep.txt"), []byte("same"), 0o644)
+	o, err := tools.OpenOverlay(root, filepath.Join(t.TempDir(), "overlay"))
+	if err != nil {
+		t.Fatalf("OpenOverlay: %v", err)
+	}
+	return tools.WithOverlay(tools.WithWorkdir(context.Background(), root), o), root, o
+}
+
+func readReal(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(data)
+}
+
+func TestOverlay_WritesStayInOverlayAndReadsSeeThem(t *testing.T) {
+	ctx, root, _ := overlayTree(t)
+	write := tool(t, "fs.write")
+	for path, data := range map[string]string{"a.txt": "new", "b/c.txt": "added", "keep.txt": "same"} {
+		if _, err := write.Execute(ctx, record("path", path, "data", data)); err != nil {
+			t.Fatalf("fs.write %s: %v", path, err)
+		}
+	}
+
+	if got := readReal(t, filepath.Join(root, "a.txt")); got != "old" {
+		t.Errorf("the real a.txt changed to %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b")); !os.IsNotExist(err) {
+		t.Errorf("expected b/ not to be created in the real tree")
+	}
+
+	got, err := tool(t, "fs.read").Execute(ctx, record("path", "a.txt"))
+	if err != nil || got.(evaluator.A0String).Value != "new" {
+		t.Errorf("fs.read through the overlay = %v, %v; want \"new\"", got, err)
+	}
+	list, err := tool(t, "fs.list").Execute(ctx, record("path", "."))
+	if err != nil {
+		t.Fatalf("fs.list: %v", err)
+	}
+	if s := evaluator.ValueToJSONString(list); s != `[{"name":"a.txt","type":"file"},{"name":"b","type":"directory"},{"name":"keep.txt","type":"file"}]` {
+		t.Errorf("fs.list through the overlay = %s", s)
+	}
+}
+
+func TestOverlay_ChangesAndApply(t *testing.T) {
+	ctx, root, o := overlayTree(t)
+	write := tool(t, "fs.write")
+	write.Execute(ctx, record("path", "a.txt", "data", "new"))
+	write.Execute(ctx, record("path", "b/c.txt", "data", "added"))
+	write.Execute(ctx, record("path", "keep.txt", "data", "same"))
+
+	changes, err := o.Changes()
+	if err != nil {
+		t.Fatalf("Changes: %v", err)
+	}
+	want := []tools.OverlayChange{
+		{Path: "a.txt", Status: "modified", Bytes: 3},
+		{Path: "b/c.txt", Status: "added", Bytes: 5},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Fatalf("Changes = %+v, want %+v", changes, want)
+	}
+
+	// A later run reopens the same overlay and applies it.
+	reopened, err := tools.OpenOverlay(root, o.Dir)
+	if err != nil {
+		t.Fatalf("reopening the overlay: %v", err)
+	}
+	if _, err := reopened.Apply(); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if got := readReal(t, filepath.Join(root, "a.txt")); got != "new" {
+		t.Errorf("after Apply a.txt = %q", got)
+	}
+	if got := readReal(t, filepath.Join(root, "b", "c.txt")); got != "added" {
+		t.Errorf("after Apply b/c.txt = %q", got)
+	}
+	if _, err := os.Stat(o.Dir); !os.IsNotExist(err) {
+		t.Errorf("expected Apply to remove the overlay directory")
+	}
+}
+
+func TestOverlay_RefusesWritesOutsideRoot(t *testing.T) {
+	_, root, o := overlayTree(t)
+	outside := filepath.Join(t.TempDir(), "x.txt")
+	ctx := tools.WithOverlay(context.Background(), o)
+	_, err := tool(t, "fs.write").Execute(ctx, record("path", outside, "data", "x"))
+	if err == nil || !strings.Contains(err.Error(), "outside the overlay root "+root) {
+		t.Errorf("expected the write to be refused, got %v", err)
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written outside the root")
+	}
+}
+
+func TestOverlay_BelongsToOneRoot(t *testing.T) {
+	_, _, o := overlayTree(t)
+	if _, err := tools.OpenOverlay(t.TempDir(), o.Dir); err == nil || !strings.Contains(err.Error(), "belongs to") {
+		t.Errorf("expected reusing the overlay for another root to fail, got %v", err)
+	}
+	if _, err := tools.LoadOverlay(t.TempDir()); err == nil || !strings.Contains(err.Error(), "is not an overlay directory") {
+		t.Errorf("expected LoadOverlay on a plain directory to fail, got %v", err)
+	}
+}
@@ -12,12 +12,29 @@ type Def struct {
 	Name         string
 	Mode         string // "read" or "effect"
 	CapabilityID string
+	// AlsoRequires lists further capabilities the tool exercises; see
+	// evaluator.ToolDef.
+	AlsoRequires []string
 	Execute      func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error)
+	// Prepare, Commit and Rollback make an effect tool usable inside a
+	// transaction block; see evaluator.ToolDef.
+	Prepare  func(ctx context.Context, args *evaluator.A0Record) (any, error)
+	Commit   func(ctx context.Context, token any) error
+	Rollback func(ctx context.Context, token any) error
 }
 
+// ExecuteFunc is the signature of Def.Execute.
+type ExecuteFunc func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error)
+
+// Middleware wraps a tool's Execute with a cross-cutting concern such as
+// logging, metrics or retries. It receives the tool's definition so it can
+// label its output by name or skip effect tools.
+type Middleware func(tool Def, next ExecuteFunc) ExecuteFunc
+
 // Registry holds registered tools.
 type Registry struct {
-	tools map[string]*Def
+	tools      map[string]*Def
+	middleware []Middleware
 }
 
 // NewRegistry creates a new empty tool registry.
@@ -32,22 +49,66 @@ func (r *Registry) Register(tool Def) {
 	r.tools[tool.Name] = &tool
 }
 
-// Get retrieves a tool by name.
+// Use adds middleware that wraps every tool, including tools registered
+// later. The first middleware added is the outermost.
+func (r *Registry) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Get retrieves a tool by name, wrapped in the registry's middleware.
 func (r *Registry) Get(name string) *Def {
-	return r.tools[name]
+	tool, ok := r.tools[name]
+	if !ok {
+		return nil
+	}
+	return r.wrap(tool)
 }
 
-// All returns all registered tools.
+// All returns all registered tools, wrapped in the registry's middleware.
 func (r *Registry) All() map[string]*Def {
-	return r.tools
+	if len(r.middleware) == 0 {
+		return r.tools
+	}
+	out := make(map[string]*Def, len(r.tools))
+	for name, tool := range r.tools {
+		out[name] = r.wrap(tool)
+	}
+	return out
+}
+
+func (r *Registry) wrap(tool *Def) *Def {
+	if len(r.middleware) == 0 {
+		return tool
+	}
+	wrapped := *tool
+	exec := ExecuteFunc(tool.Execute)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		exec = r.middleware[i](*tool, exec)
+	}
+	wrapped.Execute = exec
+	return &wrapped
 }
 
 // RegisterDefaults adds all built-in tools.
 func RegisterDefaults(r *Registry) {
 	r.Register(fsReadTool())
 	r.Register(fsWriteTool())
+	r.Register(fsTempTool())
 	r.Register(fsListTool())
 	r.Register(fsExistsTool())
+	r.Register(fsHashTool())
+	r.Register(archiveZipTool())
+	r.Register(archiveUnzipTool())
 	r.Register(httpGetTool())
+	r.Register(notifyWebhookTool())
+	r.Register(notifySlackTool())
 	r.Register(shExecTool())
+	r.Register(timeSleepTool())
+	r.Register(inputPromptTool())
+	r.Register(kvGetTool())
+	r.Register(kvSetTool())
+	r.Register(kvDeleteTool())
+	r.Register(s3GetTool())
+	r.Register(s3PutTool())
+	r.Register(s3ListTool())
 }
@@ -0,0 +1,355 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// S3Config configures the s3.* tools. Credentials are never read from the
+// policy, which is meant to be shared and checked in; they come from
+// Credentials, or else from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+type S3Config struct {
+	// Endpoint overrides the AWS endpoint, e.g. "http://localhost:9000" for
+	// MinIO. Requests to a custom endpoint use path-style addressing.
+	Endpoint string
+	// Region used for signing. Falls back to AWS_REGION, then us-east-1.
+	Region string
+	// Buckets restricts which buckets may be accessed. nil means any bucket.
+	Buckets []string
+	// Credentials supplies the keys requests are signed with, e.g. from a
+	// secret manager. nil reads them from the environment.
+	Credentials S3CredentialsProvider
+}
+
+// S3Credentials are the keys s3.* tools sign requests with.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3CredentialsProvider returns the credentials for one s3.* request. It is
+// called for every request, so it may hand out short-lived keys.
+type S3CredentialsProvider func(ctx context.Context) (S3Credentials, error)
+
+type s3ConfigKey struct{}
+
+// WithS3Config returns a context whose s3.* tools use cfg.
+func WithS3Config(ctx context.Context, cfg S3Config) context.Context {
+	return context.WithValue(ctx, s3ConfigKey{}, cfg)
+}
+
+func s3ConfigFrom(ctx context.Context) S3Config {
+	cfg, _ := ctx.Value(s3ConfigKey{}).(S3Config)
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = os.Getenv("A0_S3_ENDPOINT")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return cfg
+}
+
+func (c S3Config) credentials(ctx context.Context, toolName string) (awsCredentials, error) {
+	if c.Credentials != nil {
+		creds, err := c.Credentials(ctx)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("%s: cannot get credentials: %s", toolName, err)
+		}
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return awsCredentials{}, fmt.Errorf("%s: the credentials provider returned no keys", toolName)
+		}
+		return awsCredentials{accessKey: creds.AccessKeyID, secretKey: creds.SecretAccessKey, sessionToken: creds.SessionToken}, nil
+	}
+	creds := awsCredentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return creds, fmt.Errorf("%s: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set", toolName)
+	}
+	return creds, nil
+}
+
+func (c S3Config) checkBucket(bucket string) error {
+	if c.Buckets == nil {
+		return nil
+	}
+	for _, b := range c.Buckets {
+		if b == bucket {
+			return nil
+		}
+	}
+	return fmt.Errorf("bucket '%s' is not in the policy bucket allowlist", bucket)
+}
+
+// objectURL builds the request URL for bucket/key. AWS uses
+// virtual-hosted-style addressing; custom endpoints use path-style.
+func (c S3Config) objectURL(bucket, key string, query url.Values) string {
+	u := &url.URL{}
+	if c.Endpoint != "" {
+		base, err := url.Parse(strings.TrimRight(c.Endpoint, "/"))
+		if err == nil {
+			*u = *base
+		}
+		u.Path = u.Path + "/" + bucket
+	} else {
+		u.Scheme = "https"
+		u.Host = fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, c.Region)
+	}
+	if key != "" {
+		u.Path += "/" + key
+	} else if u.Path == "" {
+		u.Path = "/"
+	}
+	// Encode the path strictly so the wire form matches the signed form
+	segments := strings.Split(u.Path, "/")
+	for i, seg := range segments {
+		segments[i] = uriEncode(seg)
+	}
+	u.RawPath = strings.Join(segments, "/")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// s3Request signs and sends a request to S3, enforcing the host and bucket
+// allowlists. Non-2xx responses are returned as errors.
+func s3Request(ctx context.Context, toolName, method, bucket, key string, query url.Values, body []byte, contentType string) (*httpResponse, error) {
+	cfg := s3ConfigFrom(ctx)
+	if err := cfg.checkBucket(bucket); err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+	creds, err := cfg.credentials(ctx, toolName)
+	if err != nil {
+		return nil, err
+	}
+
+	rawURL := cfg.objectURL(bucket, key, query)
+	if err := checkHost(ctx, rawURL); err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", toolName, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.ContentLength = int64(len(body))
+	signV4(req, creds, cfg.Region, "s3", sha256Hex(body), time.Now())
+
+	resp, err := sendHTTP(toolName, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status < 200 || resp.status > 299 {
+		return nil, fmt.Errorf("%s: %s", toolName, s3ErrorMessage(resp))
+	}
+	return resp, nil
+}
+
+// s3ErrorMessage extracts the error code and message from an S3 error body.
+func s3ErrorMessage(resp *httpResponse) string {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.Unmarshal(resp.body, &e); err == nil && e.Code != "" {
+		return fmt.Sprintf("HTTP %d %s: %s", resp.status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("HTTP %d", resp.status)
+}
+
+func s3StringArg(toolName string, args *evaluator.A0Record, name string, required bool) (string, error) {
+	val, found := args.Get(name)
+	if !found {
+		if required {
+			return "", fmt.Errorf("%s requires a '%s' argument of type string", toolName, name)
+		}
+		return "", nil
+	}
+	str, ok := val.(evaluator.A0String)
+	if !ok || (required && str.Value == "") {
+		return "", fmt.Errorf("%s requires a '%s' argument of type string", toolName, name)
+	}
+	return str.Value, nil
+}
+
+func s3GetTool() Def {
+	return Def{
+		Name:         "s3.get",
+		Mode:         "read",
+		CapabilityID: "s3.read",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			bucket, err := s3StringArg("s3.get", args, "bucket", true)
+			if err != nil {
+				return nil, err
+			}
+			key, err := s3StringArg("s3.get", args, "key", true)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := s3Request(ctx, "s3.get", "GET", bucket, key, nil, nil, "")
+			if err != nil {
+				return nil, err
+			}
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "bucket", Value: evaluator.NewString(bucket)},
+				{Key: "key", Value: evaluator.NewString(key)},
+				{Key: "body", Value: evaluator.NewString(string(resp.body))},
+				{Key: "contentType", Value: evaluator.NewString(resp.headers.Get("Content-Type"))},
+				{Key: "etag", Value: evaluator.NewString(strings.Trim(resp.headers.Get("ETag"), `"`))},
+				{Key: "bytesRead", Value: evaluator.NewNumber(float64(len(resp.body)))},
+			}), nil
+		},
+	}
+}
+
+func s3PutTool() Def {
+	return Def{
+		Name:         "s3.put",
+		Mode:         "effect",
+		CapabilityID: "s3.write",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			bucket, err := s3StringArg("s3.put", args, "bucket", true)
+			if err != nil {
+				return nil, err
+			}
+			key, err := s3StringArg("s3.put", args, "key", true)
+			if err != nil {
+				return nil, err
+			}
+			dataVal, found := args.Get("data")
+			if !found {
+				return nil, fmt.Errorf("s3.put requires a 'data' argument")
+			}
+			format := ""
+			if fmtVal, ok := args.Get("format"); ok {
+				if fmtStr, ok := fmtVal.(evaluator.A0String); ok {
+					format = fmtStr.Value
+				}
+			}
+			content, err := serializeWriteData("s3.put", dataVal, format)
+			if err != nil {
+				return nil, err
+			}
+			contentType, err := s3StringArg("s3.put", args, "contentType", false)
+			if err != nil {
+				return nil, err
+			}
+			if contentType == "" && format == "json" {
+				contentType = "application/json"
+			}
+
+			body := []byte(content)
+			resp, err := s3Request(ctx, "s3.put", "PUT", bucket, key, nil, body, contentType)
+			if err != nil {
+				return nil, err
+			}
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "bucket", Value: evaluator.NewString(bucket)},
+				{Key: "key", Value: evaluator.NewString(key)},
+				{Key: "etag", Value: evaluator.NewString(strings.Trim(resp.headers.Get("ETag"), `"`))},
+				{Key: "bytes", Value: evaluator.NewNumber(float64(len(body)))},
+				{Key: "sha256", Value: evaluator.NewString(sha256Hex(body))},
+			}), nil
+		},
+	}
+}
+
+// listBucketResult is the subset of the ListObjectsV2 response we expose.
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		ETag         string `xml:"ETag"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func s3ListTool() Def {
+	return Def{
+		Name:         "s3.list",
+		Mode:         "read",
+		CapabilityID: "s3.read",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			bucket, err := s3StringArg("s3.list", args, "bucket", true)
+			if err != nil {
+				return nil, err
+			}
+			prefix, err := s3StringArg("s3.list", args, "prefix", false)
+			if err != nil {
+				return nil, err
+			}
+			token, err := s3StringArg("s3.list", args, "continuationToken", false)
+			if err != nil {
+				return nil, err
+			}
+
+			query := url.Values{"list-type": {"2"}}
+			if prefix != "" {
+				query.Set("prefix", prefix)
+			}
+			if token != "" {
+				query.Set("continuation-token", token)
+			}
+			if mkVal, ok := args.Get("maxKeys"); ok {
+				mk, ok := mkVal.(evaluator.A0Number)
+				if !ok || mk.Value < 1 {
+					return nil, fmt.Errorf("s3.list 'maxKeys' must be a positive number")
+				}
+				query.Set("max-keys", strconv.Itoa(int(mk.Value)))
+			}
+
+			resp, err := s3Request(ctx, "s3.list", "GET", bucket, "", query, nil, "")
+			if err != nil {
+				return nil, err
+			}
+			var result listBucketResult
+			if err := xml.Unmarshal(resp.body, &result); err != nil {
+				return nil, fmt.Errorf("s3.list: invalid response: %s", err)
+			}
+
+			objects := make([]evaluator.A0Value, len(result.Contents))
+			for i, obj := range result.Contents {
+				objects[i] = evaluator.NewRecord([]evaluator.KeyValue{
+					{Key: "key", Value: evaluator.NewString(obj.Key)},
+					{Key: "size", Value: evaluator.NewNumber(float64(obj.Size))},
+					{Key: "etag", Value: evaluator.NewString(strings.Trim(obj.ETag, `"`))},
+					{Key: "lastModified", Value: evaluator.NewString(obj.LastModified)},
+				})
+			}
+			var next evaluator.A0Value = evaluator.NewNull()
+			if result.IsTruncated && result.NextContinuationToken != "" {
+				next = evaluator.NewString(result.NextContinuationToken)
+			}
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "bucket", Value: evaluator.NewString(bucket)},
+				{Key: "objects", Value: evaluator.NewList(objects)},
+				{Key: "truncated", Value: evaluator.NewBool(result.IsTruncated)},
+				{Key: "nextContinuationToken", Value: next},
+			}), nil
+		},
+	}
+}
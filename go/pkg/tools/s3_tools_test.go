@@ -0,0 +1,173 @@
+package tools_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+	"github.com/thomasrohde/agent0/go/pkg/tools"
+)
+
+// fakeS3 is a path-style S3 endpoint holding objects in memory. It checks
+// that every request is signed with the test credentials and that the
+// signed payload hash matches the body.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]string // "bucket/key" -> body
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		f.t.Errorf("unexpected Authorization %q", auth)
+	}
+	if got := r.Header.Get("x-amz-content-sha256"); got != hex.EncodeToString(sum[:]) {
+		f.t.Errorf("x-amz-content-sha256 %q does not match the body", got)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == "PUT":
+		f.objects[path] = string(body)
+		f.types[path] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag-put"`)
+	case r.Method == "GET" && r.URL.Query().Get("list-type") == "2":
+		prefix := path + "/" + r.URL.Query().Get("prefix")
+		var b strings.Builder
+		b.WriteString(`<ListBucketResult><IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken>`)
+		for name, obj := range f.objects {
+			if strings.HasPrefix(name, prefix) {
+				b.WriteString("<Contents><Key>" + strings.TrimPrefix(name, path+"/") + "</Key><Size>" +
+					evaluator.FormatNumber(float64(len(obj))) + `</Size><ETag>"e1"</ETag></Contents>`)
+			}
+		}
+		b.WriteString("</ListBucketResult>")
+		w.Write([]byte(b.String()))
+	case r.Method == "GET":
+		obj, ok := f.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Header().Set("Content-Type", f.types[path])
+		w.Header().Set("ETag", `"etag-get"`)
+		w.Write([]byte(obj))
+	}
+}
+
+func s3Context(t *testing.T, buckets []string) (context.Context, *fakeS3) {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	fake := &fakeS3{t: t, objects: map[string]string{}, types: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	ctx := tools.WithS3Config(context.Background(), tools.S3Config{
+		Endpoint: srv.URL,
+		Region:   "us-east-1",
+		Buckets:  buckets,
+		Credentials: func(ctx context.Context) (tools.S3Credentials, error) {
+			return tools.S3Credentials{AccessKeyID: "AKIDTEST", SecretAccessKey: "secret"}, nil
+		},
+	})
+	return ctx, fake
+}
+
+func TestS3_PutGetList(t *testing.T) {
+	ctx, fake := s3Context(t, nil)
+
+	report := evaluator.NewRecord([]evaluator.KeyValue{{Key: "ok", Value: evaluator.NewBool(true)}})
+	put, err := tool(t, "s3.put").Execute(ctx, record("bucket", "artifacts", "key", "runs/report.json", "data", report, "format", "json"))
+	if err != nil {
+		t.Fatalf("s3.put: %v", err)
+	}
+	stored := fake.objects["artifacts/runs/report.json"]
+	if !strings.Contains(stored, `"ok": true`) && !strings.Contains(stored, `"ok":true`) {
+		t.Errorf("unexpected stored object %q", stored)
+	}
+	if ct := fake.types["artifacts/runs/report.json"]; ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	sum := sha256.Sum256([]byte(stored))
+	if got := evaluator.ValueToJSONString(field(t, put, "sha256")); got != `"`+hex.EncodeToString(sum[:])+`"` {
+		t.Errorf("s3.put sha256 = %s", got)
+	}
+
+	got, err := tool(t, "s3.get").Execute(ctx, record("bucket", "artifacts", "key", "runs/report.json"))
+	if err != nil {
+		t.Fatalf("s3.get: %v", err)
+	}
+	if body := field(t, got, "body").(evaluator.A0String).Value; body != stored {
+		t.Errorf("s3.get body = %q, want %q", body, stored)
+	}
+	if etag := evaluator.ValueToJSONString(field(t, got, "etag")); etag != `"etag-get"` {
+		t.Errorf("s3.get etag = %s", etag)
+	}
+
+	list, err := tool(t, "s3.list").Execute(ctx, record("bucket", "artifacts", "prefix", "runs/"))
+	if err != nil {
+		t.Fatalf("s3.list: %v", err)
+	}
+	if objs := field(t, list, "objects").(evaluator.A0List); len(objs.Items) != 1 ||
+		evaluator.ValueToJSONString(field(t, objs.Items[0], "key")) != `"runs/report.json"` {
+		t.Errorf("unexpected listing %s", evaluator.ValueToJSONString(list))
+	}
+	if next := evaluator.ValueToJSONString(field(t, list, "nextContinuationToken")); next != `"next"` {
+		t.Errorf("nextContinuationToken = %s", next)
+	}
+}
+
+func TestS3_GetMissingKeyReportsS3Error(t *testing.T) {
+	ctx, _ := s3Context(t, nil)
+	_, err := tool(t, "s3.get").Execute(ctx, record("bucket", "artifacts", "key", "nope"))
+	if err == nil || !strings.Contains(err.Error(), "HTTP 404 NoSuchKey") {
+		t.Errorf("expected a NoSuchKey error, got %v", err)
+	}
+}
+
+func TestS3_BucketAllowlist(t *testing.T) {
+	ctx, fake := s3Context(t, []string{"artifacts"})
+	_, err := tool(t, "s3.put").Execute(ctx, record("bucket", "other", "key", "k", "data", "x"))
+	if err == nil || !strings.Contains(err.Error(), "bucket 'other' is not in the policy bucket allowlist") {
+		t.Errorf("expected the bucket to be refused, got %v", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("expected nothing to be written")
+	}
+}
+
+func TestS3_Credentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	ctx := tools.WithS3Config(context.Background(), tools.S3Config{Endpoint: "http://127.0.0.1:1"})
+	_, err := tool(t, "s3.get").Execute(ctx, record("bucket", "b", "key", "k"))
+	if err == nil || !strings.Contains(err.Error(), "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set") {
+		t.Errorf("expected missing environment credentials to be reported, got %v", err)
+	}
+
+	ctx = tools.WithS3Config(context.Background(), tools.S3Config{
+		Endpoint: "http://127.0.0.1:1",
+		Credentials: func(ctx context.Context) (tools.S3Credentials, error) {
+			return tools.S3Credentials{}, errors.New("vault sealed")
+		},
+	})
+	_, err = tool(t, "s3.get").Execute(ctx, record("bucket", "b", "key", "k"))
+	if err == nil || !strings.Contains(err.Error(), "cannot get credentials: vault sealed") {
+		t.Errorf("expected the provider error to be reported, got %v", err)
+	}
+}
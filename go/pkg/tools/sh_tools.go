@@ -25,9 +25,19 @@ func shExecTool() Def {
 
 			// Default values
 			cwd, _ := os.Getwd()
+			if dir := Workdir(ctx); dir != "" {
+				cwd = dir
+			}
 			if cwdVal, found := args.Get("cwd"); found {
 				if s, ok := cwdVal.(evaluator.A0String); ok {
 					cwd = s.Value
+					if Workdir(ctx) != "" {
+						resolved, err := resolvePath(ctx, s.Value)
+						if err != nil {
+							return nil, fmt.Errorf("sh.exec: %s", err)
+						}
+						cwd = resolved
+					}
 				}
 			}
 
@@ -42,7 +52,7 @@ func shExecTool() Def {
 			envVars := os.Environ()
 			if envVal, found := args.Get("env"); found {
 				if envRec, ok := envVal.(evaluator.A0Record); ok {
-					for _, kv := range envRec.Pairs {
+					for _, kv := range envRec.Pairs() {
 						if s, ok := kv.Value.(evaluator.A0String); ok {
 							envVars = append(envVars, fmt.Sprintf("%s=%s", kv.Key, s.Value))
 						}
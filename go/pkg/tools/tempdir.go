@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+type tempScopeKey struct{}
+
+// TempScope owns the run-scoped temp directory used by fs.temp. The
+// directory is created on first use and removed by Cleanup.
+type TempScope struct {
+	mu   sync.Mutex
+	base string
+	dir  string
+}
+
+// NewTempScope creates a temp scope whose directory will be created under
+// base (os.TempDir() when base is empty).
+func NewTempScope(base string) *TempScope {
+	return &TempScope{base: base}
+}
+
+// WithTempScope returns a context carrying the run's temp scope.
+func WithTempScope(ctx context.Context, s *TempScope) context.Context {
+	return context.WithValue(ctx, tempScopeKey{}, s)
+}
+
+func tempScopeFrom(ctx context.Context) *TempScope {
+	s, _ := ctx.Value(tempScopeKey{}).(*TempScope)
+	return s
+}
+
+// Dir returns the scope's directory, creating it if needed.
+func (s *TempScope) Dir() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir != "" {
+		return s.dir, nil
+	}
+	dir, err := os.MkdirTemp(s.base, "a0-run-")
+	if err != nil {
+		return "", err
+	}
+	s.dir = dir
+	return dir, nil
+}
+
+// Path returns the scope's directory, or "" if nothing was created.
+func (s *TempScope) Path() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir
+}
+
+// Cleanup removes the scope's directory and everything in it.
+func (s *TempScope) Cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	return err
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+func timeSleepTool() Def {
+	return Def{
+		Name:         "time.sleep",
+		Mode:         "read",
+		CapabilityID: "time.sleep",
+		Execute: func(ctx context.Context, args *evaluator.A0Record) (evaluator.A0Value, error) {
+			msVal, _ := args.Get("ms")
+			ms, ok := msVal.(evaluator.A0Number)
+			if !ok {
+				return nil, fmt.Errorf("time.sleep requires an 'ms' argument of type number")
+			}
+			if ms.Value < 0 {
+				return nil, fmt.Errorf("time.sleep 'ms' must not be negative")
+			}
+
+			start := time.Now()
+			timer := time.NewTimer(time.Duration(ms.Value * float64(time.Millisecond)))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return nil, fmt.Errorf("time.sleep: interrupted after %dms: %s", time.Since(start).Milliseconds(), ctx.Err())
+			}
+
+			return evaluator.NewRecord([]evaluator.KeyValue{
+				{Key: "requestedMs", Value: evaluator.NewNumber(ms.Value)},
+				{Key: "actualMs", Value: evaluator.NewNumber(float64(time.Since(start).Milliseconds()))},
+			}), nil
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type workdirKey struct{}
+
+// WithWorkdir returns a context that confines fs tool paths to dir. Paths are
+// resolved relative to dir, absolute paths outside it are re-rooted under it,
+// and any path that escapes it (via "..", or a symlink pointing outside) is
+// rejected.
+// sh.exec runs in dir by default, but the shell itself is not confined.
+func WithWorkdir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workdirKey{}, dir)
+}
+
+// Workdir returns the sandbox directory carried by ctx, or "" if fs tools
+// are unconfined.
+func Workdir(ctx context.Context) string {
+	dir, _ := ctx.Value(workdirKey{}).(string)
+	return dir
+}
+
+// resolvePath turns a program-supplied path into an absolute host path,
+// enforcing the workdir sandbox when one is set on ctx.
+func resolvePath(ctx context.Context, p string) (string, error) {
+	workdir := Workdir(ctx)
+	if workdir == "" {
+		return filepath.Abs(p)
+	}
+
+	root, err := filepath.Abs(workdir)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+
+	// Absolute paths already inside the sandbox (e.g. paths returned by an
+	// earlier tool call) are used as-is; other absolute paths are re-rooted.
+	rel := p
+	if filepath.IsAbs(p) && within(root, filepath.Clean(p)) {
+		rel, _ = filepath.Rel(root, filepath.Clean(p))
+	}
+	if vol := filepath.VolumeName(rel); vol != "" {
+		rel = rel[len(vol):]
+	}
+	rel = strings.TrimLeft(rel, `/\`)
+	resolved := filepath.Join(root, rel)
+	if !within(root, resolved) {
+		return "", fmt.Errorf("path '%s' escapes workdir", p)
+	}
+
+	// Follow symlinks the way opening the path would, including a dangling
+	// final link, so links cannot point outside the sandbox. A path that
+	// cannot be resolved is rejected rather than used unchecked.
+	real, err := followLinks(resolved)
+	if err != nil {
+		return "", fmt.Errorf("path '%s': %w", p, err)
+	}
+	if !within(root, real) {
+		return "", fmt.Errorf("path '%s' escapes workdir", p)
+	}
+	return real, nil
+}
+
+// maxLinks bounds the symlinks followLinks follows, as the OS does (ELOOP).
+const maxLinks = 255
+
+// followLinks resolves every symlink along the absolute path p, one
+// component at a time. Unlike filepath.EvalSymlinks it also follows links
+// whose target does not exist yet, returning the path they would create.
+// Components after the first missing one are kept as they are.
+func followLinks(p string) (string, error) {
+	vol := filepath.VolumeName(p)
+	resolved := vol + string(filepath.Separator)
+	pending := splitPath(p[len(vol):])
+	links := 0
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if name == "." {
+			continue
+		}
+		if name == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			return filepath.Join(append([]string{next}, pending...)...), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			vol := filepath.VolumeName(target)
+			resolved = vol + string(filepath.Separator)
+			target = target[len(vol):]
+		}
+		pending = append(splitPath(target), pending...)
+	}
+	return resolved, nil
+}
+
+// splitPath splits p into its non-empty components.
+func splitPath(p string) []string {
+	return strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == filepath.Separator })
+}
+
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
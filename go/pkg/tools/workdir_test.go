@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thomasrohde/agent0/go/pkg/evaluator"
+)
+
+// sandbox returns a workdir context rooted at a fresh directory, and that
+// directory with symlinks resolved.
+func sandbox(t *testing.T) (context.Context, string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithWorkdir(context.Background(), root), root
+}
+
+func TestResolvePath_RelativePathsStayInWorkdir(t *testing.T) {
+	ctx, root := sandbox(t)
+	for p, want := range map[string]string{
+		"a.txt":         filepath.Join(root, "a.txt"),
+		"sub/new/b.txt": filepath.Join(root, "sub", "new", "b.txt"),
+		"sub/../c.txt":  filepath.Join(root, "c.txt"),
+		"./d/./e.txt":   filepath.Join(root, "d", "e.txt"),
+		".":             root,
+	} {
+		got, err := resolvePath(ctx, p)
+		if err != nil || got != want {
+			t.Errorf("resolvePath(%q) = %q, %v; want %q", p, got, err, want)
+		}
+	}
+}
+
+func TestResolvePath_DotDotEscapesAreRejected(t *testing.T) {
+	ctx, _ := sandbox(t)
+	for _, p := range []string{"..", "../x.txt", "a/../../x.txt", "a/b/../../../x.txt"} {
+		if got, err := resolvePath(ctx, p); err == nil || !strings.Contains(err.Error(), "escapes workdir") {
+			t.Errorf("resolvePath(%q) = %q, %v; want an escape error", p, got, err)
+		}
+	}
+}
+
+func TestResolvePath_AbsolutePathsAreReRooted(t *testing.T) {
+	ctx, root := sandbox(t)
+	got, err := resolvePath(ctx, "/etc/passwd")
+	if want := filepath.Join(root, "etc", "passwd"); err != nil || got != want {
+		t.Errorf("outside absolute path: got %q, %v; want %q", got, err, want)
+	}
+	// An absolute path already inside the workdir, such as one an earlier
+	// tool call returned, is kept.
+	inside := filepath.Join(root, "out", "r.json")
+	if got, err := resolvePath(ctx, inside); err != nil || got != inside {
+		t.Errorf("inside absolute path: got %q, %v; want %q", got, err, inside)
+	}
+}
+
+func TestResolvePath_SymlinkEscapesAreRejected(t *testing.T) {
+	ctx, root := sandbox(t)
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "dirlink")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	os.Symlink(secret, filepath.Join(root, "filelink"))
+	os.MkdirAll(filepath.Join(root, "real"), 0755)
+	os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "innerlink"))
+
+	for _, p := range []string{"dirlink", "dirlink/secret.txt", "dirlink/new/file.txt", "filelink"} {
+		if got, err := resolvePath(ctx, p); err == nil || !strings.Contains(err.Error(), "escapes workdir") {
+			t.Errorf("resolvePath(%q) = %q, %v; want an escape error", p, got, err)
+		}
+	}
+	got, err := resolvePath(ctx, "innerlink/f.txt")
+	if want := filepath.Join(root, "real", "f.txt"); err != nil || got != want {
+		t.Errorf("link within the workdir: got %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestResolvePath_DanglingSymlinkEscapesAreRejected(t *testing.T) {
+	ctx, root := sandbox(t)
+	outside := t.TempDir()
+	target := filepath.Join(outside, "created.txt")
+	if err := os.Symlink(target, filepath.Join(root, "dangling")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	os.Symlink(filepath.Join(outside, "nodir"), filepath.Join(root, "danglingdir"))
+	os.Symlink("../../"+filepath.Base(outside)+"/rel.txt", filepath.Join(root, "danglingrel"))
+	os.Symlink("chain2", filepath.Join(root, "chain1"))
+	os.Symlink(target, filepath.Join(root, "chain2"))
+
+	for _, p := range []string{"dangling", "danglingdir/f.txt", "danglingrel", "chain1"} {
+		if got, err := resolvePath(ctx, p); err == nil || !strings.Contains(err.Error(), "escapes workdir") {
+			t.Errorf("resolvePath(%q) = %q, %v; want an escape error", p, got, err)
+		}
+	}
+
+	// fs.write through the link must not create the file outside.
+	args := evaluator.NewRecord([]evaluator.KeyValue{
+		{Key: "path", Value: evaluator.NewString("dangling")},
+		{Key: "data", Value: evaluator.NewString("x")},
+	}).(evaluator.A0Record)
+	if _, err := fsWriteTool().Execute(ctx, &args); err == nil {
+		t.Error("fs.write through a dangling link should fail")
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("fs.write created %s outside the workdir", target)
+	}
+
+	// A dangling link to a path inside the workdir resolves to its target.
+	os.Symlink(filepath.Join(root, "later", "x.txt"), filepath.Join(root, "inner"))
+	got, err := resolvePath(ctx, "inner")
+	if want := filepath.Join(root, "later", "x.txt"); err != nil || got != want {
+		t.Errorf("dangling link within the workdir: got %q, %v; want %q", got, err, want)
+	}
+}
+
+func TestResolvePath_SymlinkLoopIsRejected(t *testing.T) {
+	ctx, root := sandbox(t)
+	if err := os.Symlink("loop", filepath.Join(root, "loop")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	if got, err := resolvePath(ctx, "loop/f.txt"); err == nil {
+		t.Errorf("resolvePath through a link loop = %q, want an error", got)
+	}
+}
+
+func TestResolvePath_WithoutWorkdirIsAbsolute(t *testing.T) {
+	got, err := resolvePath(context.Background(), "x.txt")
+	if err != nil || !filepath.IsAbs(got) {
+		t.Errorf("got %q, %v; want an absolute path", got, err)
+	}
+}
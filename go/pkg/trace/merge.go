@@ -0,0 +1,184 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// MergedSummary aggregates many trace files, as printed by
+// a0 trace --merge.
+type MergedSummary struct {
+	Files       int                   `json:"files"`
+	Runs        int                   `json:"runs"`
+	Succeeded   int                   `json:"succeeded"`
+	Failed      int                   `json:"failed"`
+	SuccessRate float64               `json:"successRate"`
+	Tools       map[string]*ToolStats `json:"tools"`
+	TopFailures []FailureCount        `json:"topFailures"`
+}
+
+// ToolStats holds call counts and latency percentiles, in milliseconds,
+// measured from tool_start to tool_end.
+type ToolStats struct {
+	Calls  int     `json:"calls"`
+	MeanMs float64 `json:"meanMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P90Ms  float64 `json:"p90Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	MaxMs  float64 `json:"maxMs"`
+
+	latencies []float64
+}
+
+// FailureCount counts the runs that failed with one code and message.
+type FailureCount struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// maxTopFailures bounds the failure list of a merged summary.
+const maxTopFailures = 10
+
+// Merger folds trace files into a MergedSummary.
+type Merger struct {
+	summary  MergedSummary
+	failures map[[2]string]int // code, message
+}
+
+// NewMerger returns a Merger with no files added.
+func NewMerger() *Merger {
+	return &Merger{
+		summary:  MergedSummary{Tools: make(map[string]*ToolStats)},
+		failures: make(map[[2]string]int),
+	}
+}
+
+// Add folds the runs of one trace file into the summary. A run fails when
+// its run_end carries an error code or it has no run_end at all.
+func (m *Merger) Add(r io.Reader) {
+	summary, failures := &m.summary, m.failures
+	summary.Files++
+	ended := make(map[string]bool)
+	var runs []string
+	toolStarts := make(map[[2]string][]time.Time) // runId, tool
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event traceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		tool, _ := event.Data["tool"].(string)
+		switch event.Event {
+		case "run_start":
+			runs = append(runs, event.RunID)
+		case "run_end":
+			ended[event.RunID] = true
+			summary.Runs++
+			if code, ok := event.Data["code"].(string); ok {
+				summary.Failed++
+				msg, _ := event.Data["message"].(string)
+				failures[[2]string{code, msg}]++
+			} else {
+				summary.Succeeded++
+			}
+		case "tool_start":
+			if ts, err := parseTime(event.TS); err == nil && tool != "" {
+				key := [2]string{event.RunID, tool}
+				toolStarts[key] = append(toolStarts[key], ts)
+			}
+		case "tool_end":
+			key := [2]string{event.RunID, tool}
+			starts := toolStarts[key]
+			if len(starts) == 0 {
+				continue
+			}
+			toolStarts[key] = starts[1:]
+			end, err := parseTime(event.TS)
+			if err != nil {
+				continue
+			}
+			t, ok := summary.Tools[tool]
+			if !ok {
+				t = &ToolStats{}
+				summary.Tools[tool] = t
+			}
+			t.Calls++
+			t.latencies = append(t.latencies, float64(end.Sub(starts[0]))/float64(time.Millisecond))
+		}
+	}
+	for _, id := range runs {
+		if !ended[id] {
+			summary.Runs++
+			summary.Failed++
+			failures[[2]string{"", "run did not finish (no run_end event)"}]++
+		}
+	}
+}
+
+// Summary computes the rates, latency statistics and top failures of the
+// files added so far.
+func (m *Merger) Summary() *MergedSummary {
+	summary := m.summary
+	if summary.Runs > 0 {
+		summary.SuccessRate = float64(summary.Succeeded) / float64(summary.Runs)
+	}
+	for _, t := range summary.Tools {
+		t.finish()
+	}
+	summary.TopFailures = topFailures(m.failures, maxTopFailures)
+	return &summary
+}
+
+// topFailures returns up to n failures by count, breaking ties by code and
+// message.
+func topFailures(failures map[[2]string]int, n int) []FailureCount {
+	out := make([]FailureCount, 0, len(failures))
+	for k, count := range failures {
+		out = append(out, FailureCount{Code: k[0], Message: k[1], Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Code+a.Message < b.Code+b.Message
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// finish computes the latency statistics from the collected samples.
+func (t *ToolStats) finish() {
+	if len(t.latencies) == 0 {
+		return
+	}
+	sort.Float64s(t.latencies)
+	sum := 0.0
+	for _, ms := range t.latencies {
+		sum += ms
+	}
+	round := func(ms float64) float64 { return math.Round(ms*1000) / 1000 }
+	t.MeanMs = round(sum / float64(len(t.latencies)))
+	t.P50Ms = round(percentile(t.latencies, 0.50))
+	t.P90Ms = round(percentile(t.latencies, 0.90))
+	t.P99Ms = round(percentile(t.latencies, 0.99))
+	t.MaxMs = round(t.latencies[len(t.latencies)-1])
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// run renders one run of a trace: tool calls of the given durations, then a
+// run_end failing with code unless code is empty.
+func run(id, code, message string, toolMs ...float64) string {
+	var b strings.Builder
+	ts := func(ms float64) string {
+		return base.Add(time.Duration(ms * float64(time.Millisecond))).Format(time.RFC3339Nano)
+	}
+	fmt.Fprintf(&b, `{"event":"run_start","runId":%q,"ts":%q}`+"\n", id, ts(0))
+	at := 0.0
+	for _, ms := range toolMs {
+		fmt.Fprintf(&b, `{"event":"tool_start","runId":%q,"ts":%q,"data":{"tool":"fs.read"}}`+"\n", id, ts(at))
+		at += ms
+		fmt.Fprintf(&b, `{"event":"tool_end","runId":%q,"ts":%q,"data":{"tool":"fs.read"}}`+"\n", id, ts(at))
+	}
+	if code != "" {
+		fmt.Fprintf(&b, `{"event":"run_end","runId":%q,"ts":%q,"data":{"code":%q,"message":%q}}`+"\n", id, ts(at), code, message)
+	} else {
+		fmt.Fprintf(&b, `{"event":"run_end","runId":%q,"ts":%q}`+"\n", id, ts(at))
+	}
+	return b.String()
+}
+
+func TestMerger_RunsAndLatencies(t *testing.T) {
+	m := NewMerger()
+	m.Add(strings.NewReader(run("a", "", "", 1, 2, 3) + run("b", "E_TOOL", "boom", 4)))
+	// A run without a run_end counts as failed.
+	m.Add(strings.NewReader(`{"event":"run_start","runId":"c","ts":"2025-01-02T03:04:05Z"}` + "\n"))
+
+	s := m.Summary()
+	if s.Files != 2 || s.Runs != 3 || s.Succeeded != 1 || s.Failed != 2 {
+		t.Errorf("files %d, runs %d, succeeded %d, failed %d", s.Files, s.Runs, s.Succeeded, s.Failed)
+	}
+	if s.SuccessRate != 1.0/3 {
+		t.Errorf("SuccessRate = %v", s.SuccessRate)
+	}
+	want := &ToolStats{Calls: 4, MeanMs: 2.5, P50Ms: 2, P90Ms: 4, P99Ms: 4, MaxMs: 4}
+	got := s.Tools["fs.read"]
+	if got == nil {
+		t.Fatalf("no stats for fs.read: %v", s.Tools)
+	}
+	got.latencies = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fs.read stats = %+v, want %+v", got, want)
+	}
+	wantFailures := []FailureCount{
+		{Code: "E_TOOL", Message: "boom", Count: 1},
+		{Code: "", Message: "run did not finish (no run_end event)", Count: 1},
+	}
+	if !reflect.DeepEqual(s.TopFailures, wantFailures) {
+		t.Errorf("TopFailures = %+v", s.TopFailures)
+	}
+}
+
+func TestMerger_TopFailuresOrder(t *testing.T) {
+	m := NewMerger()
+	var trace strings.Builder
+	add := func(code, message string, n int) {
+		for i := 0; i < n; i++ {
+			trace.WriteString(run(fmt.Sprintf("%s-%s-%d", code, message, i), code, message))
+		}
+	}
+	add("E_TOOL", "timeout", 1)
+	add("E_ASSERT", "bad", 3)
+	add("E_TOOL", "refused", 2)
+	add("E_IO", "missing", 2)
+	m.Add(strings.NewReader(trace.String()))
+
+	want := []FailureCount{
+		{Code: "E_ASSERT", Message: "bad", Count: 3},
+		// Ties are broken by code, then message.
+		{Code: "E_IO", Message: "missing", Count: 2},
+		{Code: "E_TOOL", Message: "refused", Count: 2},
+		{Code: "E_TOOL", Message: "timeout", Count: 1},
+	}
+	if got := m.Summary().TopFailures; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestMerger_TopFailuresCutoff(t *testing.T) {
+	m := NewMerger()
+	var trace strings.Builder
+	// Failure i happens i times, so the list keeps the last ten.
+	n := maxTopFailures + 3
+	for i := 1; i <= n; i++ {
+		for j := 0; j < i; j++ {
+			trace.WriteString(run(fmt.Sprintf("r%d-%d", i, j), "E_TOOL", fmt.Sprintf("failure %02d", i)))
+		}
+	}
+	m.Add(strings.NewReader(trace.String()))
+
+	got := m.Summary().TopFailures
+	if len(got) != maxTopFailures {
+		t.Fatalf("got %d failures, want %d", len(got), maxTopFailures)
+	}
+	for i, f := range got {
+		if want := n - i; f.Count != want || f.Message != fmt.Sprintf("failure %02d", want) {
+			t.Errorf("failure %d = %+v, want failure %02d seen %d times", i, f, want, want)
+		}
+	}
+}
+
+func TestMerger_Empty(t *testing.T) {
+	s := NewMerger().Summary()
+	if s.Runs != 0 || s.SuccessRate != 0 || s.TopFailures == nil || len(s.TopFailures) != 0 {
+		t.Errorf("got %+v", s)
+	}
+}
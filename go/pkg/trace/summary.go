@@ -0,0 +1,257 @@
+// Package trace analyzes the JSONL traces a0 run --trace writes: it
+// summarizes one run for a0 trace and merges many for a0 trace --merge.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+)
+
+// Summary describes one traced run, as printed by a0 trace.
+type Summary struct {
+	SchemaVersion   int            `json:"schemaVersion"`
+	RunID           string         `json:"runId"`
+	TotalEvents     int            `json:"totalEvents"`
+	ToolInvocations int            `json:"toolInvocations"`
+	ToolsByName     map[string]int `json:"toolsByName"`
+	EvidenceCount   int            `json:"evidenceCount"`
+	Failures        int            `json:"failures"`
+	BudgetExceeded  int            `json:"budgetExceeded"`
+	StartTime       string         `json:"startTime,omitempty"`
+	EndTime         string         `json:"endTime,omitempty"`
+	DurationMs      float64        `json:"durationMs"`
+
+	// ToolPhasesMs sums the phase timings (dns, connect, tls, ttfb,
+	// transfer) reported in tool_end events.
+	ToolPhasesMs map[string]float64 `json:"toolPhasesMs,omitempty"`
+	// LogsByLevel counts log events per level.
+	LogsByLevel map[string]int `json:"logsByLevel,omitempty"`
+	// Capabilities lists the cap_check decisions in the order they were
+	// made.
+	Capabilities []CapDecision `json:"capabilities,omitempty"`
+	// SlowestStatements ranks statements by the total time between their
+	// stmt_start and stmt_end events, slowest first.
+	SlowestStatements []StmtTiming `json:"slowestStatements,omitempty"`
+}
+
+// StmtTiming aggregates the executions of one statement. Times include
+// nested statements, such as the body of a called fn.
+type StmtTiming struct {
+	Span    string  `json:"span"` // file:line:col
+	Count   int     `json:"count"`
+	TotalMs float64 `json:"totalMs"`
+	AvgMs   float64 `json:"avgMs"`
+}
+
+// maxSlowestStatements bounds the slowest statements table.
+const maxSlowestStatements = 10
+
+// CapDecision is one cap_check event of a trace.
+type CapDecision struct {
+	Capability string `json:"capability"`
+	Allowed    bool   `json:"allowed"`
+	Source     string `json:"source"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// traceEvent is one line of a trace file.
+type traceEvent struct {
+	Event string         `json:"event"`
+	RunID string         `json:"runId"`
+	TS    string         `json:"ts"`
+	Span  *ast.Span      `json:"span,omitempty"`
+	Data  map[string]any `json:"data,omitempty"`
+}
+
+// Summarize reads a trace and summarizes it. Lines that are not valid
+// events are skipped; SchemaVersion is left for the caller to fill in.
+func Summarize(r io.Reader) *Summary {
+	summary := &Summary{
+		ToolsByName: make(map[string]int),
+	}
+	stmts := &stmtTimer{timings: make(map[string]*StmtTiming)}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var event traceEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue // skip invalid lines
+		}
+
+		summary.TotalEvents++
+		if summary.RunID == "" {
+			summary.RunID = event.RunID
+		}
+
+		switch event.Event {
+		case "run_start":
+			if summary.StartTime == "" {
+				summary.StartTime = event.TS
+			}
+		case "run_end":
+			summary.EndTime = event.TS
+		case "stmt_start":
+			stmts.start(event)
+		case "stmt_end":
+			stmts.end(event)
+		case "tool_start":
+			summary.ToolInvocations++
+			if name, ok := event.Data["tool"]; ok {
+				if s, ok := name.(string); ok {
+					summary.ToolsByName[s]++
+				}
+			}
+		case "tool_end":
+			for k, v := range event.Data {
+				s, ok := v.(string)
+				if !ok || !strings.HasSuffix(k, "Ms") {
+					continue
+				}
+				if ms, err := strconv.ParseFloat(s, 64); err == nil {
+					if summary.ToolPhasesMs == nil {
+						summary.ToolPhasesMs = make(map[string]float64)
+					}
+					summary.ToolPhasesMs[strings.TrimSuffix(k, "Ms")] += ms
+				}
+			}
+		case "evidence":
+			summary.EvidenceCount++
+			if ok, found := event.Data["ok"]; found {
+				if b, ok := ok.(bool); ok && !b {
+					summary.Failures++
+				}
+			}
+		case "budget_exceeded":
+			summary.BudgetExceeded++
+		case "log":
+			if level, ok := event.Data["level"].(string); ok {
+				if summary.LogsByLevel == nil {
+					summary.LogsByLevel = make(map[string]int)
+				}
+				summary.LogsByLevel[level]++
+			}
+		case "cap_check":
+			decision := CapDecision{}
+			decision.Capability, _ = event.Data["capability"].(string)
+			decision.Source, _ = event.Data["source"].(string)
+			decision.Reason, _ = event.Data["reason"].(string)
+			allowed, _ := event.Data["allowed"].(string)
+			decision.Allowed = allowed == "true"
+			summary.Capabilities = append(summary.Capabilities, decision)
+		}
+	}
+
+	// Compute duration from start/end times
+	if summary.StartTime != "" && summary.EndTime != "" {
+		start, err1 := parseTime(summary.StartTime)
+		end, err2 := parseTime(summary.EndTime)
+		if err1 == nil && err2 == nil {
+			summary.DurationMs = float64(end.Sub(start).Milliseconds())
+		}
+	}
+	summary.SlowestStatements = stmts.slowest(maxSlowestStatements)
+
+	return summary
+}
+
+// stmtTimer pairs stmt_start and stmt_end events. Statements nest (a fn
+// body runs inside the statement calling it), so open statements are kept
+// on a stack and an end closes the innermost start with the same span.
+type stmtTimer struct {
+	open    []openStmt
+	timings map[string]*StmtTiming
+}
+
+type openStmt struct {
+	span  string
+	start time.Time
+}
+
+func stmtKey(span *ast.Span) string {
+	return fmt.Sprintf("%s:%d:%d", span.File, span.StartLine, span.StartCol)
+}
+
+func (t *stmtTimer) start(event traceEvent) {
+	if event.Span == nil {
+		return
+	}
+	ts, err := parseTime(event.TS)
+	if err != nil {
+		return
+	}
+	t.open = append(t.open, openStmt{span: stmtKey(event.Span), start: ts})
+}
+
+func (t *stmtTimer) end(event traceEvent) {
+	if event.Span == nil {
+		return
+	}
+	ts, err := parseTime(event.TS)
+	if err != nil {
+		return
+	}
+	key := stmtKey(event.Span)
+	for i := len(t.open) - 1; i >= 0; i-- {
+		if t.open[i].span != key {
+			continue
+		}
+		timing := t.timings[key]
+		if timing == nil {
+			timing = &StmtTiming{Span: key}
+			t.timings[key] = timing
+		}
+		timing.Count++
+		timing.TotalMs += float64(ts.Sub(t.open[i].start).Microseconds()) / 1000
+		t.open = append(t.open[:i], t.open[i+1:]...)
+		return
+	}
+}
+
+// slowest returns up to n statements by total time, breaking ties by span.
+func (t *stmtTimer) slowest(n int) []StmtTiming {
+	out := make([]StmtTiming, 0, len(t.timings))
+	for _, timing := range t.timings {
+		timing.AvgMs = timing.TotalMs / float64(timing.Count)
+		out = append(out, *timing)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TotalMs != out[j].TotalMs {
+			return out[i].TotalMs > out[j].TotalMs
+		}
+		return out[i].Span < out[j].Span
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// parseTime parses an event timestamp.
+func parseTime(s string) (time.Time, error) {
+	// Try RFC3339Nano first, then other common formats
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time: %s", s)
+}
@@ -0,0 +1,161 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// traceLines renders events as a JSONL trace.
+type traceLines []string
+
+func (l *traceLines) add(t *testing.T, event string, ms float64, line int, data map[string]any) {
+	t.Helper()
+	ev := map[string]any{
+		"event": event,
+		"runId": "run-1",
+		"ts":    base.Add(time.Duration(ms * float64(time.Millisecond))).Format(time.RFC3339Nano),
+	}
+	if line > 0 {
+		ev["span"] = map[string]any{"file": "main.a0", "startLine": line, "startCol": 1, "endLine": line, "endCol": 2}
+	}
+	if data != nil {
+		ev["data"] = data
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*l = append(*l, string(b))
+}
+
+// stmt adds a statement on line that runs from start to end.
+func (l *traceLines) stmt(t *testing.T, line int, start, end float64) {
+	t.Helper()
+	l.add(t, "stmt_start", start, line, nil)
+	l.add(t, "stmt_end", end, line, nil)
+}
+
+func (l traceLines) reader() *strings.Reader {
+	return strings.NewReader(strings.Join(l, "\n") + "\n")
+}
+
+func spans(timings []StmtTiming) []string {
+	out := make([]string, len(timings))
+	for i, timing := range timings {
+		out[i] = timing.Span
+	}
+	return out
+}
+
+func TestSummarize_SlowestStatementsOrder(t *testing.T) {
+	var lines traceLines
+	lines.add(t, "run_start", 0, 0, nil)
+	lines.stmt(t, 1, 0, 5)
+	lines.stmt(t, 2, 5, 25)
+	lines.stmt(t, 3, 25, 35)
+	// Line 1 runs again, for 15ms in total.
+	lines.stmt(t, 1, 35, 45)
+	lines.add(t, "run_end", 45, 0, nil)
+
+	summary := Summarize(lines.reader())
+	want := []StmtTiming{
+		{Span: "main.a0:2:1", Count: 1, TotalMs: 20, AvgMs: 20},
+		{Span: "main.a0:1:1", Count: 2, TotalMs: 15, AvgMs: 7.5},
+		{Span: "main.a0:3:1", Count: 1, TotalMs: 10, AvgMs: 10},
+	}
+	if !reflect.DeepEqual(summary.SlowestStatements, want) {
+		t.Errorf("got %+v, want %+v", summary.SlowestStatements, want)
+	}
+	if summary.DurationMs != 45 {
+		t.Errorf("DurationMs = %v, want 45", summary.DurationMs)
+	}
+}
+
+func TestSummarize_SlowestStatementsTiesBySpan(t *testing.T) {
+	var lines traceLines
+	for _, line := range []int{30, 4, 12} {
+		lines.stmt(t, line, 0, 10)
+	}
+	got := spans(Summarize(lines.reader()).SlowestStatements)
+	want := []string{"main.a0:12:1", "main.a0:30:1", "main.a0:4:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSummarize_SlowestStatementsCutoff(t *testing.T) {
+	var lines traceLines
+	// Line n takes n ms, so the table keeps the last ten lines.
+	n := maxSlowestStatements + 5
+	for line := 1; line <= n; line++ {
+		lines.stmt(t, line, 0, float64(line))
+	}
+	got := spans(Summarize(lines.reader()).SlowestStatements)
+	var want []string
+	for line := n; line > n-maxSlowestStatements; line-- {
+		want = append(want, fmt.Sprintf("main.a0:%d:1", line))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSummarize_NestedStatements(t *testing.T) {
+	var lines traceLines
+	// Line 1 calls a fn whose body (line 5) runs twice, recursing once.
+	lines.add(t, "stmt_start", 0, 1, nil)
+	lines.add(t, "stmt_start", 1, 5, nil)
+	lines.add(t, "stmt_start", 2, 5, nil)
+	lines.add(t, "stmt_end", 4, 5, nil)
+	lines.add(t, "stmt_end", 8, 5, nil)
+	lines.add(t, "stmt_end", 10, 1, nil)
+	// An end without a start is ignored.
+	lines.add(t, "stmt_end", 11, 7, nil)
+
+	want := []StmtTiming{
+		{Span: "main.a0:1:1", Count: 1, TotalMs: 10, AvgMs: 10},
+		{Span: "main.a0:5:1", Count: 2, TotalMs: 9, AvgMs: 4.5},
+	}
+	if got := Summarize(lines.reader()).SlowestStatements; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSummarize_Events(t *testing.T) {
+	var lines traceLines
+	lines.add(t, "run_start", 0, 0, nil)
+	lines.add(t, "tool_start", 1, 0, map[string]any{"tool": "http.get"})
+	lines.add(t, "tool_end", 2, 0, map[string]any{"tool": "http.get", "dnsMs": "1.5", "ttfbMs": "2"})
+	lines.add(t, "evidence", 3, 0, map[string]any{"ok": false})
+	lines.add(t, "log", 4, 0, map[string]any{"level": "warn"})
+	lines.add(t, "cap_check", 5, 0, map[string]any{"capability": "http.get", "allowed": "true", "source": "policy"})
+	lines = append(lines, "not json")
+	lines.add(t, "run_end", 6, 0, nil)
+
+	summary := Summarize(lines.reader())
+	if summary.TotalEvents != 7 || summary.RunID != "run-1" {
+		t.Errorf("TotalEvents = %d, RunID = %q", summary.TotalEvents, summary.RunID)
+	}
+	if summary.ToolInvocations != 1 || summary.ToolsByName["http.get"] != 1 {
+		t.Errorf("tools: %d, %v", summary.ToolInvocations, summary.ToolsByName)
+	}
+	if !reflect.DeepEqual(summary.ToolPhasesMs, map[string]float64{"dns": 1.5, "ttfb": 2}) {
+		t.Errorf("ToolPhasesMs = %v", summary.ToolPhasesMs)
+	}
+	if summary.EvidenceCount != 1 || summary.Failures != 1 || summary.LogsByLevel["warn"] != 1 {
+		t.Errorf("evidence %d, failures %d, logs %v", summary.EvidenceCount, summary.Failures, summary.LogsByLevel)
+	}
+	want := []CapDecision{{Capability: "http.get", Allowed: true, Source: "policy"}}
+	if !reflect.DeepEqual(summary.Capabilities, want) {
+		t.Errorf("Capabilities = %+v", summary.Capabilities)
+	}
+	if summary.SlowestStatements != nil {
+		t.Errorf("a trace without statements has no slowest table, got %+v", summary.SlowestStatements)
+	}
+}
@@ -0,0 +1,307 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// toolRequiredArgs lists the arguments each tool cannot do without; passing
+// a possibly-null value for one of them fails at call time.
+var toolRequiredArgs = map[string][]string{
+	"fs.read":        {"path"},
+	"fs.write":       {"path"},
+	"fs.list":        {"path"},
+	"fs.exists":      {"path"},
+	"fs.hash":        {"path"},
+	"archive.zip":    {"files", "to"},
+	"archive.unzip":  {"from", "to"},
+	"http.get":       {"url"},
+	"sh.exec":        {"cmd"},
+	"time.sleep":     {"ms"},
+	"input.prompt":   {"message"},
+	"notify.webhook": {"url"},
+	"notify.slack":   {"text"},
+	"kv.get":         {"key"},
+	"kv.set":         {"key"},
+	"kv.delete":      {"key"},
+	"s3.get":         {"bucket", "key"},
+	"s3.put":         {"bucket", "key"},
+	"s3.list":        {"bucket"},
+}
+
+// nullableStdlib lists stdlib functions that may return null.
+var nullableStdlib = map[string]bool{
+	"find": true, "get": true, "str.codePointAt": true,
+}
+
+// arithmeticOps are the operators that fail on a null operand.
+var arithmeticOps = map[ast.BinaryOp]bool{
+	ast.OpAdd: true, ast.OpSub: true, ast.OpMul: true, ast.OpDiv: true, ast.OpMod: true,
+	ast.OpGt: true, ast.OpLt: true, ast.OpGtEq: true, ast.OpLtEq: true,
+}
+
+// nullChecker is the opt-in null-safety pass (Options.NullSafety). It tracks
+// bindings that may hold null and warns when one reaches arithmetic, a
+// comparison, unary minus, or a required tool argument.
+//
+// Null comes from null literals, s[i] and other stdlib results that can be
+// null, if without else, and fn params that some call omits or passes null.
+// A condition such as x != null or plain x narrows x in the taken branch.
+type nullChecker struct {
+	v        *validator
+	nullable map[*ast.FnDecl]map[string]bool // params some call leaves null
+	fns      map[string]*ast.FnDecl
+}
+
+func (v *validator) checkNullSafety(program *ast.Program) {
+	c := &nullChecker{
+		v:        v,
+		nullable: make(map[*ast.FnDecl]map[string]bool),
+		fns:      make(map[string]*ast.FnDecl),
+	}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if fn, ok := n.(*ast.FnDecl); ok {
+			c.fns[fn.Name] = fn
+		}
+		return true
+	})
+	ast.Inspect(program, func(n ast.Node) bool {
+		if call, ok := n.(*ast.FnCallExpr); ok {
+			c.collectCall(call)
+		}
+		return true
+	})
+	c.stmts(program.Statements, map[string]bool{})
+}
+
+// collectCall marks the params of a user fn that call leaves null.
+func (c *nullChecker) collectCall(call *ast.FnCallExpr) {
+	fn := c.fns[call.Name.Parts[0]]
+	if fn == nil || len(call.Name.Parts) != 1 || call.Args == nil {
+		return
+	}
+	given := make(map[string]ast.Expr)
+	for _, entry := range call.Args.Pairs {
+		switch p := entry.(type) {
+		case *ast.RecordPair:
+			given[p.Key] = p.Value
+		case *ast.SpreadPair:
+			return // the spread may supply any param
+		}
+	}
+	for _, param := range fn.Params {
+		value, ok := given[param]
+		if _, isNull := value.(*ast.NullLiteral); ok && !isNull {
+			continue
+		}
+		if c.nullable[fn] == nil {
+			c.nullable[fn] = make(map[string]bool)
+		}
+		c.nullable[fn][param] = true
+	}
+}
+
+// stmts walks a block. env maps binding names to whether they may be null;
+// child blocks get a copy so narrowing and shadowing stay local.
+func (c *nullChecker) stmts(stmts []ast.Stmt, env map[string]bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.LetStmt:
+			c.expr(s.Value, env)
+			env[s.Name] = c.isNullable(s.Value, env)
+		case *ast.ExprStmt:
+			c.expr(s.Expr, env)
+			if s.Target != nil {
+				env[s.Target.Parts[0]] = c.isNullable(s.Expr, env)
+			}
+		case *ast.ReturnStmt:
+			c.expr(s.Value, env)
+		case *ast.EnsureStmt:
+			c.expr(s.That, env)
+			c.expr(s.Else, env)
+		case *ast.FnDecl:
+			child := copyEnv(env)
+			for _, param := range s.Params {
+				child[param] = c.nullable[s][param]
+			}
+			c.stmts(s.Body, child)
+		}
+	}
+}
+
+// block walks a nested block whose bindings (loop variables and the like)
+// are never null.
+func (c *nullChecker) block(stmts []ast.Stmt, env map[string]bool, bindings ...string) {
+	child := copyEnv(env)
+	for _, name := range bindings {
+		child[name] = false
+	}
+	c.stmts(stmts, child)
+}
+
+func copyEnv(env map[string]bool) map[string]bool {
+	child := make(map[string]bool, len(env))
+	for k, v := range env {
+		child[k] = v
+	}
+	return child
+}
+
+// narrowed returns env with the bindings cond proves non-null when it holds.
+func narrowed(cond ast.Expr, env map[string]bool) map[string]bool {
+	name := ""
+	switch e := cond.(type) {
+	case *ast.IdentPath:
+		if len(e.Parts) == 1 {
+			name = e.Parts[0]
+		}
+	case *ast.BinaryExpr:
+		if e.Op == ast.OpNeq {
+			name = nullComparedIdent(e)
+		}
+	}
+	if name == "" || !env[name] {
+		return env
+	}
+	child := copyEnv(env)
+	child[name] = false
+	return child
+}
+
+// nullComparedIdent returns x for x != null or null != x.
+func nullComparedIdent(e *ast.BinaryExpr) string {
+	left, right := e.Left, e.Right
+	if _, ok := left.(*ast.NullLiteral); ok {
+		left, right = right, left
+	}
+	if _, ok := right.(*ast.NullLiteral); !ok {
+		return ""
+	}
+	if id, ok := left.(*ast.IdentPath); ok && len(id.Parts) == 1 {
+		return id.Parts[0]
+	}
+	return ""
+}
+
+// isNullable reports whether expr may evaluate to null.
+func (c *nullChecker) isNullable(expr ast.Expr, env map[string]bool) bool {
+	switch e := expr.(type) {
+	case *ast.NullLiteral, *ast.IndexExpr:
+		return true
+	case *ast.IdentPath:
+		return len(e.Parts) == 1 && env[e.Parts[0]]
+	case *ast.FnCallExpr:
+		return nullableStdlib[strings.Join(e.Name.Parts, ".")]
+	case *ast.IfExpr:
+		return c.isNullable(e.Then, narrowed(e.Cond, env)) || c.isNullable(e.Else, env)
+	case *ast.IfBlockExpr:
+		return e.ElseBody == nil
+	}
+	return false
+}
+
+func (c *nullChecker) expr(expr ast.Expr, env map[string]bool) {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		c.expr(e.Left, env)
+		c.expr(e.Right, env)
+		if !arithmeticOps[e.Op] {
+			return
+		}
+		for _, operand := range []ast.Expr{e.Left, e.Right} {
+			if c.isNullable(operand, env) {
+				c.warn(operand, fmt.Sprintf("'%s' operand may be null", e.Op))
+			}
+		}
+	case *ast.UnaryExpr:
+		c.expr(e.Operand, env)
+		if c.isNullable(e.Operand, env) {
+			c.warn(e.Operand, "unary '-' operand may be null")
+		}
+	case *ast.CallExpr:
+		c.toolArgs(strings.Join(e.Tool.Parts, "."), e.Args, env)
+	case *ast.DoExpr:
+		c.toolArgs(strings.Join(e.Tool.Parts, "."), e.Args, env)
+	case *ast.IfExpr:
+		c.expr(e.Cond, env)
+		c.expr(e.Then, narrowed(e.Cond, env))
+		c.expr(e.Else, env)
+	case *ast.IfBlockExpr:
+		c.expr(e.Cond, env)
+		c.block(e.ThenBody, narrowed(e.Cond, env))
+		c.block(e.ElseBody, env)
+	case *ast.ForExpr:
+		c.expr(e.List, env)
+		c.block(e.Body, env, e.Binding)
+	case *ast.FilterBlockExpr:
+		c.expr(e.List, env)
+		c.block(e.Body, env, e.Binding)
+	case *ast.FindBlockExpr:
+		c.expr(e.List, env)
+		c.block(e.Body, env, e.Binding)
+	case *ast.LoopExpr:
+		c.expr(e.Init, env)
+		c.expr(e.Times, env)
+		c.block(e.Body, env, e.Binding)
+	case *ast.MatchExpr:
+		c.expr(e.Subject, env)
+		for _, arm := range []*ast.MatchArm{e.OkArm, e.ErrArm} {
+			if arm != nil {
+				c.block(arm.Body, env, arm.Binding)
+			}
+		}
+	case *ast.TypeMatchExpr:
+		c.expr(e.Subject, env)
+		for _, arm := range e.Arms {
+			child := copyEnv(env)
+			if arm.Binding != "" {
+				child[arm.Binding] = arm.Tag == "null" || arm.Tag == "_"
+			}
+			c.stmts(arm.Body, child)
+		}
+	case *ast.TransactionExpr:
+		c.block(e.Body, env)
+	case *ast.TryExpr:
+		c.block(e.TryBody, env)
+		c.block(e.CatchBody, env, e.CatchBinding)
+	default:
+		// Records, lists, fn calls, index targets and the like: check
+		// their sub-expressions in place.
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if n == expr {
+				return true
+			}
+			if sub, ok := n.(ast.Expr); ok {
+				c.expr(sub, env)
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// toolArgs warns about possibly-null values passed for required tool args.
+func (c *nullChecker) toolArgs(tool string, args *ast.RecordExpr, env map[string]bool) {
+	if args == nil {
+		return
+	}
+	c.expr(args, env)
+	required := make(map[string]bool)
+	for _, name := range toolRequiredArgs[tool] {
+		required[name] = true
+	}
+	for _, entry := range args.Pairs {
+		if p, ok := entry.(*ast.RecordPair); ok && required[p.Key] && c.isNullable(p.Value, env) {
+			c.warn(p.Value, fmt.Sprintf("required argument '%s' of %s may be null", p.Key, tool))
+		}
+	}
+}
+
+func (c *nullChecker) warn(expr ast.Expr, msg string) {
+	span := expr.NodeSpan()
+	c.v.diags = append(c.v.diags, diagnostics.MakeWarning(diagnostics.ENullable, msg, &span,
+		"check it with if { cond: x != null, ... } or give a default with coalesce"))
+}
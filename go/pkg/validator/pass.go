@@ -0,0 +1,26 @@
+package validator
+
+import (
+	"github.com/thomasrohde/agent0/go/pkg/ast"
+	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
+)
+
+// Pass is a custom validation pass, for rules an embedder enforces on top
+// of the language's own, such as an approved tool list or required meta
+// headers. Check runs after the built-in checks on the program and on each
+// module it imports (module is true for those); its diagnostics are
+// reported alongside theirs, and errors among them block execution.
+//
+// A Runtime may validate several programs at once, so Check must be safe
+// for concurrent use and must not modify the program.
+type Pass interface {
+	Check(program *ast.Program, module bool) []diagnostics.Diagnostic
+}
+
+// PassFunc adapts a plain function to a Pass.
+type PassFunc func(program *ast.Program, module bool) []diagnostics.Diagnostic
+
+// Check calls f.
+func (f PassFunc) Check(program *ast.Program, module bool) []diagnostics.Diagnostic {
+	return f(program, module)
+}
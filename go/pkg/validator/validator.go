@@ -3,6 +3,7 @@ package validator
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/thomasrohde/agent0/go/pkg/ast"
@@ -14,33 +15,63 @@ var knownCapabilities = map[string]bool{
 	"fs.write": true,
 	"http.get": true,
 	"sh.exec":  true,
+
+	"time.sleep":  true,
+	"interactive": true,
+	"notify":      true,
+	"kv":          true,
+	"s3.read":     true,
+	"s3.write":    true,
 }
 
 type toolInfo struct {
 	mode         string // "read" or "effect"
 	capabilityID string
+	alsoRequires []string // further capabilities the tool exercises
 }
 
 var knownTools = map[string]toolInfo{
 	"fs.read":   {mode: "read", capabilityID: "fs.read"},
 	"fs.write":  {mode: "effect", capabilityID: "fs.write"},
+	"fs.temp":   {mode: "effect", capabilityID: "fs.write"},
 	"fs.list":   {mode: "read", capabilityID: "fs.read"},
 	"fs.exists": {mode: "read", capabilityID: "fs.read"},
-	"http.get":  {mode: "read", capabilityID: "http.get"},
-	"sh.exec":   {mode: "effect", capabilityID: "sh.exec"},
+	"fs.hash":   {mode: "read", capabilityID: "fs.read"},
+
+	"archive.zip":   {mode: "effect", capabilityID: "fs.write", alsoRequires: []string{"fs.read"}},
+	"archive.unzip": {mode: "effect", capabilityID: "fs.write", alsoRequires: []string{"fs.read"}},
+	"http.get":      {mode: "read", capabilityID: "http.get"},
+	"sh.exec":       {mode: "effect", capabilityID: "sh.exec"},
+	"time.sleep":    {mode: "read", capabilityID: "time.sleep"},
+	"input.prompt":  {mode: "effect", capabilityID: "interactive"},
+
+	"notify.webhook": {mode: "effect", capabilityID: "notify"},
+	"notify.slack":   {mode: "effect", capabilityID: "notify"},
+
+	"kv.get":    {mode: "read", capabilityID: "kv"},
+	"kv.set":    {mode: "effect", capabilityID: "kv"},
+	"kv.delete": {mode: "effect", capabilityID: "kv"},
+
+	"s3.get":  {mode: "read", capabilityID: "s3.read"},
+	"s3.put":  {mode: "effect", capabilityID: "s3.write"},
+	"s3.list": {mode: "read", capabilityID: "s3.read"},
 }
 
 var knownStdlib = map[string]bool{
-	"eq": true, "not": true, "and": true, "or": true, "coalesce": true, "typeof": true,
+	"eq": true, "hash": true, "not": true, "and": true, "or": true, "coalesce": true, "typeof": true,
 	"len": true, "append": true, "concat": true, "sort": true, "filter": true, "find": true,
 	"range": true, "join": true, "unique": true, "pluck": true, "flat": true,
-	"get": true, "put": true, "patch": true,
+	"get": true, "put": true, "patch": true, "diff.text": true, "diff.json": true,
 	"parse.json": true, "keys": true, "values": true, "merge": true, "entries": true,
-	"math.max": true, "math.min": true,
+	"math.max": true, "math.min": true, "approxEq": true,
 	"str.concat": true, "str.split": true, "str.starts": true, "str.ends": true,
-	"str.replace": true, "str.template": true,
-	"map": true, "reduce": true,
-	"contains": true,
+	"str.replace": true, "str.template": true, "str.chars": true,
+	"str.codePointAt": true, "str.substr": true, "str.compare": true,
+	"md.table": true, "md.link": true, "md.codeBlock": true, "html.escape": true,
+	"map": true, "reduce": true, "paginate": true, "call.batch": true, "forall": true, "expect.snapshot": true, "expect.schema": true, "evidence": true,
+	"gen.int": true, "gen.string": true, "gen.list": true,
+	"log.debug": true, "log.info": true, "log.warn": true, "log.error": true,
+	"contains": true, "tools.list": true, "stdlib.list": true,
 }
 
 var knownBudgetFields = map[string]bool{
@@ -48,11 +79,26 @@ var knownBudgetFields = map[string]bool{
 	"maxToolCalls":    true,
 	"maxBytesWritten": true,
 	"maxIterations":   true,
+	"maxBytesRead":    true,
+	"maxMemoryBytes":  true,
+	"maxBytesSent":    true,
+	"maxSteps":        true,
 }
 
+// readOnlyBindings are predeclared in every program and module (run.id) and
+// may not be rebound with let or ->.
+var readOnlyBindings = map[string]bool{"run": true}
+
 type scope struct {
 	bindings map[string]bool
-	parent   *scope
+	// records holds the record literal a let bound, so spreads of it have
+	// known keys.
+	records map[string]*ast.RecordExpr
+	// params holds the names bound as fn parameters in this scope.
+	params map[string]bool
+	// floats holds the names a let bound to float arithmetic.
+	floats map[string]bool
+	parent *scope
 }
 
 func newScope(parent *scope) *scope {
@@ -73,40 +119,172 @@ func (s *scope) add(name string) {
 	s.bindings[name] = true
 }
 
+// setRecord notes that name is bound to the record literal rec.
+func (s *scope) setRecord(name string, rec *ast.RecordExpr) {
+	if s.records == nil {
+		s.records = make(map[string]*ast.RecordExpr)
+	}
+	s.records[name] = rec
+}
+
+// record returns the record literal name is bound to, or nil if the nearest
+// binding of name is something else.
+func (s *scope) record(name string) *ast.RecordExpr {
+	for ; s != nil; s = s.parent {
+		if s.bindings[name] {
+			return s.records[name]
+		}
+	}
+	return nil
+}
+
+// setFloat notes that name is bound to float-producing arithmetic.
+func (s *scope) setFloat(name string) {
+	if s.floats == nil {
+		s.floats = make(map[string]bool)
+	}
+	s.floats[name] = true
+}
+
+// float reports whether the nearest binding of name is float arithmetic.
+func (s *scope) float(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.bindings[name] {
+			return s.floats[name]
+		}
+	}
+	return false
+}
+
+// lookup returns the nearest scope that binds name, or nil.
+func (s *scope) lookup(name string) *scope {
+	for ; s != nil; s = s.parent {
+		if s.bindings[name] {
+			return s
+		}
+	}
+	return nil
+}
+
 func (s *scope) hasLocal(name string) bool {
 	return s.bindings[name]
 }
 
+func globalScope() *scope {
+	sc := newScope(nil)
+	for name := range readOnlyBindings {
+		sc.add(name)
+	}
+	return sc
+}
+
+// Options configures optional validator passes.
+type Options struct {
+	// Strict flags fn bodies without a final return, value-producing blocks
+	// that rely on their implicit last-expression value, and if-blocks in
+	// value position without an else branch.
+	Strict bool
+	// StrictAsWarnings reports strict-mode findings as warnings instead of errors.
+	StrictAsWarnings bool
+	// NullSafety enables the null-safety pass, which warns when a value
+	// that may be null reaches arithmetic or a required tool argument.
+	NullSafety bool
+	// Lint enables advisory checks that are always reported as warnings,
+	// such as capabilities declared in cap { ... } but never exercised, and
+	// let bindings that shadow an enclosing binding.
+	Lint bool
+	// DisabledLints turns off individual Lint checks by diagnostic code,
+	// e.g. E_SHADOW (from the "lint" section of a0.json).
+	DisabledLints map[string]bool
+	// Module validates the program as an imported module, which need not
+	// end with a return statement.
+	Module bool
+	// Modules holds the resolved program for each import header. When nil,
+	// calls into imported modules are not checked.
+	Modules map[*ast.ImportDecl]*ast.Program
+	// HostFns names the host-provided functions available to the program
+	// (see runtime.WithHostFn); calls to them are valid.
+	HostFns map[string]bool
+	// Passes are custom passes run after the built-in ones (see
+	// runtime.WithValidatorPass).
+	Passes []Pass
+}
+
 type validator struct {
 	diags        []diagnostics.Diagnostic
 	declaredCaps map[string]bool
+	usedCaps     map[string]bool
+	capPairs     []*ast.RecordPair
 	fnNames      map[string]bool
+	deprecated   map[string]string          // @deprecated message by local fn name
+	imports      map[string]*ast.ImportDecl // by alias
 	scope        *scope
+	opts         Options
+	discarded    ast.Expr // expression in statement position whose value is unused
 }
 
 // Validate performs semantic analysis on an A0 program and returns diagnostics.
 func Validate(program *ast.Program) []diagnostics.Diagnostic {
+	return ValidateWithOptions(program, Options{})
+}
+
+// ValidateWithOptions performs semantic analysis with optional passes enabled.
+func ValidateWithOptions(program *ast.Program, opts Options) []diagnostics.Diagnostic {
 	v := &validator{
 		declaredCaps: make(map[string]bool),
+		usedCaps:     make(map[string]bool),
 		fnNames:      make(map[string]bool),
-		scope:        newScope(nil),
+		deprecated:   make(map[string]string),
+		imports:      make(map[string]*ast.ImportDecl),
+		scope:        newScope(globalScope()),
+		opts:         opts,
 	}
 
 	v.validateHeaders(program)
 	v.validateStatements(program.Statements, v.scope, true)
+	if v.lintEnabled(diagnostics.EUnusedCap) {
+		v.checkUnusedCaps()
+	}
+	if opts.NullSafety {
+		v.checkNullSafety(program)
+	}
+	for _, pass := range opts.Passes {
+		v.diags = append(v.diags, pass.Check(program, opts.Module)...)
+	}
 
 	return v.diags
 }
 
+// lintEnabled reports whether the Lint check reporting code should run.
+func (v *validator) lintEnabled(code string) bool {
+	return v.opts.Lint && !v.opts.DisabledLints[code]
+}
+
 func (v *validator) addDiag(code, msg string, span *ast.Span) {
 	v.diags = append(v.diags, diagnostics.MakeDiag(code, msg, span, ""))
 }
 
+func (v *validator) addStrictDiag(code, msg string, span *ast.Span, hint string) {
+	if v.opts.StrictAsWarnings {
+		v.diags = append(v.diags, diagnostics.MakeWarning(code, msg, span, hint))
+		return
+	}
+	v.diags = append(v.diags, diagnostics.MakeDiag(code, msg, span, hint))
+}
+
 func (v *validator) validateHeaders(program *ast.Program) {
 	budgetCount := 0
+	metaCount := 0
 
 	for _, h := range program.Headers {
 		switch hdr := h.(type) {
+		case *ast.MetaDecl:
+			metaCount++
+			if metaCount > 1 {
+				span := hdr.Span
+				v.addDiag(diagnostics.EAst, "duplicate meta declaration", &span)
+			}
+			v.validateMetaDecl(hdr)
 		case *ast.CapDecl:
 			v.validateCapDecl(hdr)
 		case *ast.BudgetDecl:
@@ -117,65 +295,242 @@ func (v *validator) validateHeaders(program *ast.Program) {
 			}
 			v.validateBudgetDecl(hdr)
 		case *ast.ImportDecl:
-			span := hdr.Span
-			v.addDiag(diagnostics.EAst, "import is not supported", &span)
+			if _, dup := v.imports[hdr.Alias]; dup {
+				span := hdr.Span
+				v.addDiag(diagnostics.EDupBinding, fmt.Sprintf("duplicate import alias '%s'", hdr.Alias), &span)
+				continue
+			}
+			if stdlibNamespace(hdr.Alias) {
+				span := hdr.Span
+				v.addDiag(diagnostics.EDupBinding, fmt.Sprintf("import alias '%s' shadows the stdlib namespace", hdr.Alias), &span)
+				continue
+			}
+			v.imports[hdr.Alias] = hdr
+			if mod, ok := v.opts.Modules[hdr]; ok {
+				if meta := ast.Meta(mod); meta != nil && meta.Deprecated != "" {
+					span := hdr.Span
+					v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EDeprecated,
+						fmt.Sprintf("module '%s' is deprecated: %s", hdr.Path, meta.Deprecated), &span, ""))
+				}
+			}
+			if hdr.Budget != nil {
+				v.validateBudgetRecord(hdr.Budget, true)
+			}
+		}
+	}
+}
+
+// stdlibNamespace reports whether name is a stdlib fn or the prefix of
+// dotted stdlib names such as str.concat.
+func stdlibNamespace(name string) bool {
+	if knownStdlib[name] {
+		return true
+	}
+	for fn := range knownStdlib {
+		if strings.HasPrefix(fn, name+".") {
+			return true
 		}
 	}
+	return false
 }
 
+// validateCapDecl checks a cap header. The evaluator only grants pairs
+// written as key: true, so anything else would be silently ignored at run
+// time and is reported here instead.
 func (v *validator) validateCapDecl(decl *ast.CapDecl) {
 	for _, entry := range decl.Capabilities.Pairs {
 		pair, ok := entry.(*ast.RecordPair)
 		if !ok {
+			span := entry.NodeSpan()
+			v.addDiag(diagnostics.ECapValue, "capabilities must be written out; spreads are not allowed in cap { ... }", &span)
 			continue
 		}
+		span := pair.Span
 		if !knownCapabilities[pair.Key] {
-			span := pair.Span
 			v.addDiag(diagnostics.EUnknownCap, fmt.Sprintf("unknown capability '%s'", pair.Key), &span)
 		}
 		// Check value is boolean literal
-		if _, ok := pair.Value.(*ast.BoolLiteral); !ok {
-			span := pair.Span
-			v.addDiag(diagnostics.EAst, fmt.Sprintf("capability '%s' value must be a boolean", pair.Key), &span)
+		b, ok := pair.Value.(*ast.BoolLiteral)
+		if !ok {
+			v.addDiag(diagnostics.EAst, fmt.Sprintf("capability '%s' value must be a boolean literal, not an expression", pair.Key), &span)
+			continue
+		}
+		if !b.Value {
+			v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.ECapValue,
+				fmt.Sprintf("capability '%s' is set to false, which declares nothing", pair.Key), &span,
+				fmt.Sprintf("remove '%s' from cap { ... }; tools needing it stay undeclared either way", pair.Key)))
+			continue
 		}
 		v.declaredCaps[pair.Key] = true
+		v.capPairs = append(v.capPairs, pair)
+	}
+}
+
+// checkUnusedCaps warns about capabilities granted in cap { ... } that no
+// tool call in the program requires.
+func (v *validator) checkUnusedCaps() {
+	for _, pair := range v.capPairs {
+		if b, ok := pair.Value.(*ast.BoolLiteral); !ok || !b.Value {
+			continue
+		}
+		if !knownCapabilities[pair.Key] || v.usedCaps[pair.Key] {
+			continue
+		}
+		span := pair.Span
+		v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EUnusedCap,
+			fmt.Sprintf("capability '%s' is declared but never used", pair.Key), &span,
+			fmt.Sprintf("remove '%s' from cap { ... } to narrow what this program may do", pair.Key)))
+	}
+}
+
+// metaFields are the fields a meta header may declare.
+var metaFields = map[string]bool{"name": true, "version": true, "description": true, "author": true, "deprecated": true}
+
+// validateMetaDecl checks a meta header: known fields, each once, with
+// string literal values so catalogues can read them without running the
+// program.
+func (v *validator) validateMetaDecl(decl *ast.MetaDecl) {
+	seen := make(map[string]bool)
+	for _, entry := range decl.Fields.Pairs {
+		pair, ok := entry.(*ast.RecordPair)
+		if !ok {
+			span := entry.NodeSpan()
+			v.addDiag(diagnostics.EAst, "meta fields must be written out; spreads are not allowed in meta { ... }", &span)
+			continue
+		}
+		span := pair.Span
+		if !metaFields[pair.Key] {
+			v.addDiag(diagnostics.EAst, fmt.Sprintf("unknown meta field '%s'; expected name, version, description, author or deprecated", pair.Key), &span)
+		}
+		if seen[pair.Key] {
+			v.addDiag(diagnostics.EAst, fmt.Sprintf("duplicate meta field '%s'", pair.Key), &span)
+		}
+		seen[pair.Key] = true
+		if _, ok := pair.Value.(*ast.StrLiteral); !ok {
+			v.addDiag(diagnostics.EAst, fmt.Sprintf("meta field '%s' must be a string literal", pair.Key), &span)
+		}
 	}
 }
 
 func (v *validator) validateBudgetDecl(decl *ast.BudgetDecl) {
-	for _, entry := range decl.Budget.Pairs {
+	v.validateBudgetRecord(decl.Budget, false)
+}
+
+// validateBudgetRecord checks the fields of a budget header or of an import
+// budget. Import budgets cannot limit time, which is only tracked per run.
+func (v *validator) validateBudgetRecord(rec *ast.RecordExpr, onImport bool) {
+	seen := make(map[string]bool)
+	for _, entry := range rec.Pairs {
 		pair, ok := entry.(*ast.RecordPair)
 		if !ok {
+			span := entry.NodeSpan()
+			v.addDiag(diagnostics.EAst, "budget fields must be written out; spreads are not allowed in budget { ... }", &span)
 			continue
 		}
+		span := pair.Span
 		if !knownBudgetFields[pair.Key] {
-			span := pair.Span
-			v.addDiag(diagnostics.EUnknownBudget, fmt.Sprintf("unknown budget field '%s'", pair.Key), &span)
+			msg := fmt.Sprintf("unknown budget field '%s'", pair.Key)
+			if near := nearestBudgetField(pair.Key); near != "" {
+				msg += fmt.Sprintf(" (did you mean '%s'?)", near)
+			}
+			v.addDiag(diagnostics.EUnknownBudget, msg, &span)
+		} else if onImport && pair.Key == "timeMs" {
+			v.addDiag(diagnostics.EUnknownBudget, "budget field 'timeMs' is not supported on imports", &span)
+		}
+		if seen[pair.Key] {
+			v.addDiag(diagnostics.EAst, fmt.Sprintf("duplicate budget field '%s'", pair.Key), &span)
 		}
-		// Check value is numeric
-		switch pair.Value.(type) {
-		case *ast.IntLiteral, *ast.FloatLiteral:
-			// ok
+		seen[pair.Key] = true
+
+		// Check value is a non-negative number
+		switch val := pair.Value.(type) {
+		case *ast.IntLiteral:
+			if val.Value == 0 && zeroBudgetBlocks[pair.Key] != "" {
+				v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EBudgetZero,
+					fmt.Sprintf("budget field '%s' is 0, so %s fails", pair.Key, zeroBudgetBlocks[pair.Key]), &span,
+					fmt.Sprintf("remove '%s' for no limit, or set it to the most the program needs", pair.Key)))
+			}
+		case *ast.FloatLiteral:
+			// ok; truncated to an integer limit
+		case *ast.UnaryExpr:
+			if isLiteral(val.Operand) && val.Op == ast.OpNeg {
+				v.addDiag(diagnostics.EAst, fmt.Sprintf("budget field '%s' must not be negative", pair.Key), &span)
+				break
+			}
+			v.addDiag(diagnostics.EAst, fmt.Sprintf("budget field '%s' must be a number", pair.Key), &span)
 		default:
-			span := pair.Span
 			v.addDiag(diagnostics.EAst, fmt.Sprintf("budget field '%s' must be a number", pair.Key), &span)
 		}
 	}
 }
 
+// zeroBudgetBlocks describes what a zero limit forbids, for the fields where
+// 0 is almost certainly a mistake.
+var zeroBudgetBlocks = map[string]string{
+	"timeMs":        "the run",
+	"maxToolCalls":  "any tool call",
+	"maxIterations": "any loop, map, filter or reduce",
+	"maxSteps":      "the run",
+}
+
+// nearestBudgetField suggests the known budget field a misspelt key was
+// probably meant to be: one that differs only in case, or by at most two
+// edits.
+func nearestBudgetField(key string) string {
+	best, bestDist := "", 3
+	for field := range knownBudgetFields {
+		if strings.EqualFold(field, key) {
+			return field
+		}
+		if d := editDistance(strings.ToLower(field), strings.ToLower(key)); d < bestDist || (d == bestDist && field < best) {
+			best, bestDist = field, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
 func (v *validator) validateStatements(stmts []ast.Stmt, sc *scope, isTopLevel bool) {
+	requireReturn := isTopLevel && !v.opts.Module
 	if len(stmts) == 0 {
-		if isTopLevel {
+		if requireReturn {
 			v.addDiag(diagnostics.ENoReturn, "program must end with a return statement", nil)
 		}
 		return
 	}
 
-	// Check return positioning
+	// Check return positioning; an export footer may follow the return
+	last := len(stmts) - 1
+	for last > 0 {
+		if _, ok := stmts[last].(*ast.ExportDecl); !ok {
+			break
+		}
+		last--
+	}
 	hasReturn := false
 	for i, stmt := range stmts {
 		if _, ok := stmt.(*ast.ReturnStmt); ok {
-			if i != len(stmts)-1 {
+			if i != last {
 				span := stmt.NodeSpan()
 				v.addDiag(diagnostics.EReturnNotLast, "return must be the last statement", &span)
 			}
@@ -183,7 +538,7 @@ func (v *validator) validateStatements(stmts []ast.Stmt, sc *scope, isTopLevel b
 		}
 	}
 
-	if !hasReturn && isTopLevel {
+	if !hasReturn && requireReturn {
 		v.addDiag(diagnostics.ENoReturn, "program must end with a return statement", nil)
 	}
 
@@ -196,8 +551,14 @@ func (v *validator) validateStatements(stmts []ast.Stmt, sc *scope, isTopLevel b
 			} else if knownStdlib[fn.Name] {
 				span := fn.Span
 				v.addDiag(diagnostics.EFnDup, fmt.Sprintf("function '%s' conflicts with stdlib", fn.Name), &span)
+			} else if v.opts.HostFns[fn.Name] {
+				span := fn.Span
+				v.addDiag(diagnostics.EFnDup, fmt.Sprintf("function '%s' conflicts with a host function", fn.Name), &span)
 			} else {
 				v.fnNames[fn.Name] = true
+				if fn.Deprecated != "" {
+					v.deprecated[fn.Name] = fn.Deprecated
+				}
 			}
 			// fn name is available as a binding in scope
 			sc.add(fn.Name)
@@ -213,18 +574,35 @@ func (v *validator) validateStatements(stmts []ast.Stmt, sc *scope, isTopLevel b
 func (v *validator) validateStmt(stmt ast.Stmt, sc *scope) {
 	switch s := stmt.(type) {
 	case *ast.LetStmt:
-		if sc.hasLocal(s.Name) {
+		if readOnlyBindings[s.Name] {
+			span := s.Span
+			v.addDiag(diagnostics.EDupBinding, fmt.Sprintf("cannot rebind read-only binding '%s'", s.Name), &span)
+		} else if sc.hasLocal(s.Name) {
 			span := s.Span
 			v.addDiag(diagnostics.EDupBinding, fmt.Sprintf("duplicate binding '%s'", s.Name), &span)
+		} else if v.lintEnabled(diagnostics.EShadow) {
+			v.checkShadow(s, sc)
 		}
 		v.validateExpr(s.Value, sc)
 		sc.add(s.Name)
+		if rec, ok := s.Value.(*ast.RecordExpr); ok {
+			sc.setRecord(s.Name, rec)
+		}
+		if isFloatArith(s.Value, sc) {
+			sc.setFloat(s.Name)
+		}
 
 	case *ast.ExprStmt:
+		if s.Target == nil {
+			v.discarded = s.Expr
+		}
 		v.validateExpr(s.Expr, sc)
 		if s.Target != nil {
 			name := s.Target.Parts[0]
-			if sc.hasLocal(name) {
+			if readOnlyBindings[name] {
+				span := s.Target.Span
+				v.addDiag(diagnostics.EDupBinding, fmt.Sprintf("cannot rebind read-only binding '%s'", name), &span)
+			} else if sc.hasLocal(name) {
 				span := s.Target.Span
 				v.addDiag(diagnostics.EDupBinding, fmt.Sprintf("duplicate binding '%s'", name), &span)
 			}
@@ -234,12 +612,91 @@ func (v *validator) validateStmt(stmt ast.Stmt, sc *scope) {
 	case *ast.ReturnStmt:
 		v.validateExpr(s.Value, sc)
 
+	case *ast.EnsureStmt:
+		v.validateExpr(s.That, sc)
+		v.validateExpr(s.Else, sc)
+
 	case *ast.FnDecl:
 		childScope := newScope(sc)
+		childScope.params = make(map[string]bool, len(s.Params))
 		for _, param := range s.Params {
 			childScope.add(param)
+			childScope.params[param] = true
+		}
+		if v.opts.Strict && !endsWithReturn(s.Body) {
+			span := s.Span
+			v.addStrictDiag(diagnostics.ENoReturn, fmt.Sprintf("fn '%s' body must end with a return statement", s.Name), &span,
+				"add return <expr> as the last statement of the fn body")
 		}
 		v.validateBlockStatements(s.Body, childScope)
+
+	case *ast.ExportDecl:
+		for _, name := range s.Names {
+			if !v.fnNames[name] {
+				span := s.Span
+				v.addDiag(diagnostics.EUnknownFn, fmt.Sprintf("cannot export unknown function '%s'", name), &span)
+			}
+		}
+	}
+}
+
+func endsWithReturn(stmts []ast.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	_, ok := stmts[len(stmts)-1].(*ast.ReturnStmt)
+	return ok
+}
+
+// checkStrictValue flags value-producing block expressions whose value is
+// consumed but whose bodies rely on the implicit last-expression value.
+func (v *validator) checkStrictValue(expr ast.Expr) {
+	if expr == v.discarded {
+		return
+	}
+	span := expr.NodeSpan()
+	implicit := func(construct string, body []ast.Stmt) {
+		if !endsWithReturn(body) {
+			v.addStrictDiag(diagnostics.EImplicitReturn,
+				fmt.Sprintf("%s body relies on its implicit last-expression value", construct), &span,
+				"end the block with an explicit return <expr>")
+		}
+	}
+
+	switch e := expr.(type) {
+	case *ast.IfBlockExpr:
+		if e.ElseBody == nil {
+			v.addStrictDiag(diagnostics.EIfNoElse, "if block used as a value has no else branch", &span,
+				"add an else { return <expr> } branch; without it the value is null")
+		}
+		implicit("if", e.ThenBody)
+		if e.ElseBody != nil {
+			implicit("else", e.ElseBody)
+		}
+	case *ast.ForExpr:
+		implicit("for", e.Body)
+	case *ast.FilterBlockExpr:
+		implicit("filter", e.Body)
+	case *ast.FindBlockExpr:
+		implicit("find", e.Body)
+	case *ast.LoopExpr:
+		implicit("loop", e.Body)
+	case *ast.MatchExpr:
+		if e.OkArm != nil {
+			implicit("match ok arm", e.OkArm.Body)
+		}
+		if e.ErrArm != nil {
+			implicit("match err arm", e.ErrArm.Body)
+		}
+	case *ast.TypeMatchExpr:
+		for _, arm := range e.Arms {
+			implicit("match type "+arm.Tag+" arm", arm.Body)
+		}
+	case *ast.TryExpr:
+		implicit("try", e.TryBody)
+		implicit("catch", e.CatchBody)
+	case *ast.TransactionExpr:
+		implicit("transaction", e.Body)
 	}
 }
 
@@ -271,6 +728,12 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 	if expr == nil {
 		return
 	}
+	if v.opts.Strict {
+		v.checkStrictValue(expr)
+	}
+	if v.lintEnabled(diagnostics.EDeadBranch) {
+		v.checkDeadBranch(expr)
+	}
 
 	switch e := expr.(type) {
 	case *ast.IntLiteral, *ast.FloatLiteral, *ast.BoolLiteral, *ast.StrLiteral, *ast.NullLiteral:
@@ -292,6 +755,7 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 				v.validateExpr(p.Expr, sc)
 			}
 		}
+		v.checkRecordKeys(e, sc)
 
 	case *ast.ListExpr:
 		for _, elem := range e.Elements {
@@ -301,10 +765,17 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 	case *ast.BinaryExpr:
 		v.validateExpr(e.Left, sc)
 		v.validateExpr(e.Right, sc)
+		if v.lintEnabled(diagnostics.EFloatEq) {
+			v.checkFloatEq(e, sc)
+		}
 
 	case *ast.UnaryExpr:
 		v.validateExpr(e.Operand, sc)
 
+	case *ast.IndexExpr:
+		v.validateExpr(e.Target, sc)
+		v.validateExpr(e.Index, sc)
+
 	case *ast.IfExpr:
 		v.validateExpr(e.Cond, sc)
 		v.validateExpr(e.Then, sc)
@@ -338,6 +809,19 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 			v.validateBlockStatements(e.ErrArm.Body, childScope)
 		}
 
+	case *ast.TypeMatchExpr:
+		v.validateExpr(e.Subject, sc)
+		for _, arm := range e.Arms {
+			childScope := newScope(sc)
+			if arm.Binding != "" {
+				childScope.add(arm.Binding)
+			}
+			v.validateBlockStatements(arm.Body, childScope)
+		}
+
+	case *ast.TransactionExpr:
+		v.validateBlockStatements(e.Body, newScope(sc))
+
 	case *ast.TryExpr:
 		childTry := newScope(sc)
 		v.validateBlockStatements(e.TryBody, childTry)
@@ -353,6 +837,14 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 		}
 		v.validateBlockStatements(e.Body, childScope)
 
+	case *ast.FindBlockExpr:
+		v.validateExpr(e.List, sc)
+		childScope := newScope(sc)
+		if e.Binding != "" {
+			childScope.add(e.Binding)
+		}
+		v.validateBlockStatements(e.Body, childScope)
+
 	case *ast.LoopExpr:
 		if e.Init != nil {
 			v.validateExpr(e.Init, sc)
@@ -384,7 +876,9 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 
 	case *ast.FnCallExpr:
 		fnName := strings.Join(e.Name.Parts, ".")
-		if !knownStdlib[fnName] && !v.fnNames[fnName] {
+		if decl, ok := v.imports[e.Name.Parts[0]]; ok && len(e.Name.Parts) > 1 {
+			v.validateImportedCall(decl, strings.Join(e.Name.Parts[1:], "."), &e.Span)
+		} else if !knownStdlib[fnName] && !v.fnNames[fnName] && !v.opts.HostFns[fnName] {
 			// Check if it's a known tool (error: use call?/do)
 			if _, ok := knownTools[fnName]; ok {
 				span := e.Span
@@ -393,17 +887,71 @@ func (v *validator) validateExpr(expr ast.Expr, sc *scope) {
 				span := e.Span
 				v.addDiag(diagnostics.EUnknownFn, fmt.Sprintf("unknown function '%s'", fnName), &span)
 			}
+		} else if msg, ok := v.deprecated[fnName]; ok {
+			span := e.Span
+			v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EDeprecated,
+				fmt.Sprintf("function '%s' is deprecated: %s", fnName, msg), &span, ""))
+		}
+		if fnName == "call.batch" {
+			v.validateBatchTool(e)
 		}
 		v.validateExpr(e.Args, sc)
 	}
 }
 
+// validateBatchTool checks the tool a call.batch names as if it were a
+// call? of it. The tool must be a string literal so its capability is
+// known before the program runs.
+func (v *validator) validateBatchTool(e *ast.FnCallExpr) {
+	span := e.Span
+	for _, entry := range e.Args.Pairs {
+		if p, ok := entry.(*ast.RecordPair); ok && p.Key == "tool" {
+			if lit, ok := p.Value.(*ast.StrLiteral); ok {
+				v.validateToolUsage(lit.Value, "call?", &span)
+				return
+			}
+		}
+	}
+	v.addDiag(diagnostics.EToolArgs, "call.batch needs 'tool' as a string literal, so its capability can be checked", &span)
+}
+
+// validateImportedCall checks that alias.name refers to a function the
+// imported module defines and exports, and warns when it is deprecated.
+func (v *validator) validateImportedCall(decl *ast.ImportDecl, name string, span *ast.Span) {
+	mod, ok := v.opts.Modules[decl]
+	if !ok {
+		return
+	}
+	exported, defined := ast.ExportedFns(mod)[name]
+	if !defined {
+		v.addDiag(diagnostics.EUnknownFn, fmt.Sprintf("module '%s' has no function '%s'", decl.Alias, name), span)
+		return
+	}
+	if !exported {
+		v.diags = append(v.diags, diagnostics.MakeDiag(diagnostics.EImportPrivate,
+			fmt.Sprintf("function '%s' is not exported by module '%s'", name, decl.Alias), span,
+			fmt.Sprintf("mark it 'export fn %s' or list it in an export { ... } footer of %s", name, decl.Path)))
+		return
+	}
+	for _, stmt := range mod.Statements {
+		if fn, ok := stmt.(*ast.FnDecl); ok && fn.Name == name && fn.Deprecated != "" {
+			v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EDeprecated,
+				fmt.Sprintf("function '%s.%s' is deprecated: %s", decl.Alias, name, fn.Deprecated), span, ""))
+			return
+		}
+	}
+}
+
 func (v *validator) validateToolUsage(toolName, mode string, span *ast.Span) {
 	info, known := knownTools[toolName]
 	if !known {
 		v.addDiag(diagnostics.EUnknownTool, fmt.Sprintf("unknown tool '%s'", toolName), span)
 		return
 	}
+	v.usedCaps[info.capabilityID] = true
+	for _, c := range info.alsoRequires {
+		v.usedCaps[c] = true
+	}
 
 	// Check call? on effect tool → E_CALL_EFFECT
 	if mode == "call?" && info.mode == "effect" {
@@ -412,8 +960,177 @@ func (v *validator) validateToolUsage(toolName, mode string, span *ast.Span) {
 	}
 
 	// Check capability is declared
-	capID := info.capabilityID
-	if !v.declaredCaps[capID] {
-		v.addDiag(diagnostics.EUndeclaredCap, fmt.Sprintf("capability '%s' not declared (required by tool '%s')", capID, toolName), span)
+	for _, capID := range append([]string{info.capabilityID}, info.alsoRequires...) {
+		if !v.declaredCaps[capID] {
+			v.addDiag(diagnostics.EUndeclaredCap, fmt.Sprintf("capability '%s' not declared (required by tool '%s')", capID, toolName), span)
+		}
+	}
+}
+
+// checkRecordKeys warns about keys a record literal sets only to lose them:
+// a key written twice (the last value wins) and a key followed by a spread
+// that also has it (the spread's value wins). A spread's keys are known when
+// it spreads a record literal or a let bound to one. Spreading first and
+// then overriding, { ...base, key: v }, is the intended idiom and passes.
+func (v *validator) checkRecordKeys(rec *ast.RecordExpr, sc *scope) {
+	written := make(map[string]bool)
+	for _, entry := range rec.Pairs {
+		switch p := entry.(type) {
+		case *ast.RecordPair:
+			if written[p.Key] {
+				span := p.Span
+				v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EDupKey,
+					fmt.Sprintf("duplicate key '%s' in record; the last value wins", p.Key), &span,
+					fmt.Sprintf("remove the earlier '%s' entry", p.Key)))
+			}
+			written[p.Key] = true
+		case *ast.SpreadPair:
+			for _, key := range spreadKeys(p.Expr, sc) {
+				if written[key] {
+					span := p.Span
+					v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.ESpreadOverride,
+						fmt.Sprintf("spread overwrites key '%s' set earlier in the record", key), &span,
+						fmt.Sprintf("move '%s: ...' after the spread if it should take precedence", key)))
+					delete(written, key)
+				}
+			}
+		}
+	}
+}
+
+// spreadKeys returns the keys a spread expression is known to contribute.
+func spreadKeys(expr ast.Expr, sc *scope) []string {
+	rec, ok := expr.(*ast.RecordExpr)
+	if !ok {
+		if ip, isIdent := expr.(*ast.IdentPath); isIdent && len(ip.Parts) == 1 {
+			rec = sc.record(ip.Parts[0])
+		}
+	}
+	if rec == nil {
+		return nil
+	}
+	var keys []string
+	for _, entry := range rec.Pairs {
+		if p, ok := entry.(*ast.RecordPair); ok {
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
+
+// checkShadow warns when let rebinds a name that an enclosing scope (or the
+// enclosing fn's parameter list) already binds, which hides the outer value
+// for the rest of the block.
+func (v *validator) checkShadow(let *ast.LetStmt, sc *scope) {
+	outer := sc.parent.lookup(let.Name)
+	if outer == nil || outer.parent == nil {
+		return // unbound, or a read-only global
+	}
+	what := "a binding from an enclosing scope"
+	if outer.params[let.Name] {
+		what = "a parameter of the enclosing fn"
+	}
+	span := let.Span
+	v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EShadow,
+		fmt.Sprintf("let '%s' shadows %s", let.Name, what), &span,
+		fmt.Sprintf("rename the inner '%s' so the outer value stays visible", let.Name)))
+}
+
+// checkDeadBranch warns about code a literal makes unreachable: an if whose
+// condition is a literal, so one branch never runs, and a for or filter over
+// an empty list literal, whose body never runs. These are usually leftovers
+// from debugging.
+func (v *validator) checkDeadBranch(expr ast.Expr) {
+	var cond, list ast.Expr
+	construct := ""
+	switch e := expr.(type) {
+	case *ast.IfExpr:
+		cond, construct = e.Cond, "if"
+	case *ast.IfBlockExpr:
+		cond, construct = e.Cond, "if"
+	case *ast.ForExpr:
+		list, construct = e.List, "for"
+	case *ast.FilterBlockExpr:
+		list, construct = e.List, "filter"
+	case *ast.FindBlockExpr:
+		list, construct = e.List, "find"
+	case *ast.FnCallExpr:
+		if len(e.Name.Parts) != 1 || e.Args == nil {
+			return
+		}
+		switch e.Name.Parts[0] {
+		case "filter", "map", "reduce":
+			construct = e.Name.Parts[0]
+			for _, entry := range e.Args.Pairs {
+				if p, ok := entry.(*ast.RecordPair); ok && p.Key == "in" {
+					list = p.Value
+				}
+			}
+		}
+	}
+	span := expr.NodeSpan()
+	if cond != nil && isLiteral(cond) {
+		v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EDeadBranch,
+			fmt.Sprintf("%s condition is a literal, so only one branch can run", construct), &span,
+			"remove the dead branch, or restore the real condition"))
 	}
+	if l, ok := list.(*ast.ListExpr); ok && len(l.Elements) == 0 {
+		v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EDeadBranch,
+			fmt.Sprintf("%s iterates over an empty list literal, so its body never runs", construct), &span,
+			fmt.Sprintf("remove the %s, or restore the real list", construct)))
+	}
+}
+
+// checkFloatEq warns about == and != on float arithmetic, whose rounding
+// makes exact comparison flaky: 0.1 + 0.2 == 0.3 is false.
+func (v *validator) checkFloatEq(e *ast.BinaryExpr, sc *scope) {
+	if e.Op != ast.OpEqEq && e.Op != ast.OpNeq {
+		return
+	}
+	if !isFloatArith(e.Left, sc) && !isFloatArith(e.Right, sc) {
+		return
+	}
+	span := e.Span
+	v.diags = append(v.diags, diagnostics.MakeWarning(diagnostics.EFloatEq,
+		fmt.Sprintf("'%s' compares float arithmetic exactly; rounding can make it flaky", e.Op), &span,
+		"use approxEq { a, b, tolerance? }, or assert.approx in an assertion"))
+}
+
+// isFloatArith reports whether expr is arithmetic statically known to
+// produce a float: a division, or arithmetic with a fractional literal or
+// another float operand. Idents count when a let bound them to such
+// arithmetic.
+func isFloatArith(expr ast.Expr, sc *scope) bool {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case ast.OpDiv:
+			return true
+		case ast.OpAdd, ast.OpSub, ast.OpMul, ast.OpMod:
+			return isFloatOperand(e.Left, sc) || isFloatOperand(e.Right, sc)
+		}
+	case *ast.UnaryExpr:
+		return e.Op == ast.OpNeg && isFloatArith(e.Operand, sc)
+	case *ast.IdentPath:
+		return len(e.Parts) == 1 && sc.float(e.Parts[0])
+	}
+	return false
+}
+
+func isFloatOperand(expr ast.Expr, sc *scope) bool {
+	if lit, ok := expr.(*ast.FloatLiteral); ok {
+		return lit.Value != math.Trunc(lit.Value)
+	}
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == ast.OpNeg {
+		return isFloatOperand(u.Operand, sc)
+	}
+	return isFloatArith(expr, sc)
+}
+
+func isLiteral(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BoolLiteral, *ast.IntLiteral, *ast.FloatLiteral, *ast.StrLiteral, *ast.NullLiteral:
+		return true
+	}
+	return false
 }
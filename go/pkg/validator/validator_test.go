@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/thomasrohde/agent0/go/pkg/ast"
 	"github.com/thomasrohde/agent0/go/pkg/diagnostics"
 	"github.com/thomasrohde/agent0/go/pkg/parser"
 	"github.com/thomasrohde/agent0/go/pkg/validator"
@@ -430,24 +431,176 @@ return "ok"
 	}
 }
 
-// ===== E_AST (import unsupported) =====
+// ===== Imports and exports =====
 
-func TestError_ImportUnsupported(t *testing.T) {
+// mustParseWithModule parses source and a module imported by it as "mod",
+// validating source with the module resolved.
+func mustParseWithModule(t *testing.T, source, module string) []diagnostics.Diagnostic {
+	t.Helper()
+	prog, parseErrs := parser.Parse(source, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	mod, parseErrs := parser.Parse(module, "mod.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error in module: %s", parseErrs[0].Message)
+	}
+	modules := make(map[*ast.ImportDecl]*ast.Program)
+	for _, h := range prog.Headers {
+		if decl, ok := h.(*ast.ImportDecl); ok {
+			modules[decl] = mod
+		}
+	}
+	return validator.ValidateWithOptions(prog, validator.Options{Modules: modules})
+}
+
+const testModule = `
+fn helper { x } {
+  return x + 1
+}
+export fn inc { x } {
+  return helper { x: x }
+}
+fn twice { x } {
+  return x * 2
+}
+export { twice }
+`
+
+func TestImport_UnresolvedIsAccepted(t *testing.T) {
 	diags := mustParseAndValidate(t, `
 import "foo.a0" as foo
+let n = foo.inc { x: 1 }
+return n
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestImport_ExportedCalls(t *testing.T) {
+	diags := mustParseWithModule(t, `
+import "mod.a0" as mod
+let a = mod.inc { x: 1 }
+let b = mod.twice { x: 2 }
+return { a: a, b: b }
+`, testModule)
+	assertNoDiags(t, diags)
+}
+
+func TestImport_PrivateCall(t *testing.T) {
+	diags := mustParseWithModule(t, `
+import "mod.a0" as mod
+let a = mod.helper { x: 1 }
+return a
+`, testModule)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EImportPrivate)
+}
+
+func TestImport_UnknownModuleFn(t *testing.T) {
+	diags := mustParseWithModule(t, `
+import "mod.a0" as mod
+let a = mod.missing { x: 1 }
+return a
+`, testModule)
+	assertHasCode(t, diags, diagnostics.EUnknownFn)
+}
+
+func TestImport_DuplicateAlias(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+import "a.a0" as lib
+import "b.a0" as lib
 return "ok"
 `)
-	assertHasCode(t, diags, diagnostics.EAst)
-	found := false
-	for _, d := range diags {
-		if d.Code == diagnostics.EAst && strings.Contains(d.Message, "import") {
-			found = true
+	assertHasCode(t, diags, diagnostics.EDupBinding)
+}
+
+func TestImport_AliasShadowsStdlib(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+import "strings.a0" as str
+return "ok"
+`)
+	assertHasCode(t, diags, diagnostics.EDupBinding)
+}
+
+func TestImport_Budget(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+import "foo.a0" as foo budget { maxToolCalls: 3, maxIterations: 100 }
+return "ok"
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestImport_BudgetTimeMsRejected(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+import "foo.a0" as foo budget { timeMs: 1000 }
+return "ok"
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EUnknownBudget)
+}
+
+func TestDeprecated_WarnsAtCallSites(t *testing.T) {
+	diags := mustParseWithModule(t, `
+import "mod.a0" as mod
+@deprecated "use mod.inc"
+fn bump { x } {
+  return x + 1
+}
+let a = bump { x: 1 }
+let b = mod.old { x: a }
+return mod.inc { x: b }
+`, `
+meta { deprecated: "moved to lib/math.a0" }
+@deprecated "use inc"
+export fn old { x } {
+  return x + 1
+}
+export fn inc { x } {
+  return x + 1
+}
+`)
+	assertDiagCount(t, diags, 3)
+	for i, want := range []string{"module 'mod.a0' is deprecated: moved to lib/math.a0", "function 'bump' is deprecated: use mod.inc", "function 'mod.old' is deprecated: use inc"} {
+		if i >= len(diags) {
 			break
 		}
+		assertDiagCodeAt(t, diags, i, diagnostics.EDeprecated)
+		if !diags[i].IsWarning() || diags[i].Message != want {
+			t.Errorf("diag %d: expected warning %q, got %q", i, want, diags[i].Message)
+		}
 	}
-	if !found {
-		t.Errorf("expected 'import' related diagnostic message")
+}
+
+func TestExport_UnknownFn(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+fn f { x } {
+  return x
+}
+export { f, g }
+return "ok"
+`)
+	assertDiagCount(t, diags, 1)
+	assertHasCode(t, diags, diagnostics.EUnknownFn)
+}
+
+func TestExport_FooterAfterReturn(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+fn f { x } {
+  return x
+}
+return "ok"
+export { f }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestModule_NoReturnRequired(t *testing.T) {
+	prog, parseErrs := parser.Parse(testModule, "mod.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
 	}
+	assertNoDiags(t, validator.ValidateWithOptions(prog, validator.Options{Module: true}))
+	assertHasCode(t, validator.Validate(prog), diagnostics.ENoReturn)
 }
 
 // ===== E_UNKNOWN_CAP: unknown capability =====
@@ -570,6 +723,28 @@ return x
 	assertHasCode(t, diags, diagnostics.EDupBinding)
 }
 
+func TestValid_RunID(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let id = run.id
+return { id: id }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestError_RebindRun(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let run = { id: "mine" }
+return run
+`)
+	assertHasCode(t, diags, diagnostics.EDupBinding)
+
+	diags = mustParseAndValidate(t, `
+call? fs.read { path: "x" } -> run
+return null
+`)
+	assertHasCode(t, diags, diagnostics.EDupBinding)
+}
+
 func TestError_DupBinding_Multiple(t *testing.T) {
 	diags := mustParseAndValidate(t, `
 let a = 1
@@ -836,6 +1011,29 @@ return result
 	assertHasCode(t, diags, diagnostics.ECallEffect)
 }
 
+func TestCallBatch_ChecksToolLikeCall(t *testing.T) {
+	assertNoDiags(t, mustParseAndValidate(t, `
+cap { http.get: true }
+let r = call.batch { tool: "http.get", items: [{ url: "https://a.dev" }] }
+return r
+`))
+	assertHasCode(t, mustParseAndValidate(t, `
+let r = call.batch { tool: "http.get", items: [] }
+return r
+`), diagnostics.EUndeclaredCap)
+	assertHasCode(t, mustParseAndValidate(t, `
+cap { fs.write: true }
+let r = call.batch { tool: "fs.write", items: [] }
+return r
+`), diagnostics.ECallEffect)
+	assertHasCode(t, mustParseAndValidate(t, `
+cap { http.get: true }
+let name = "http.get"
+let r = call.batch { tool: name, items: [] }
+return r
+`), diagnostics.EToolArgs)
+}
+
 func TestNoError_DoWithEffectTool(t *testing.T) {
 	// do with effect tool is correct usage
 	diags := mustParseAndValidate(t, `
@@ -1495,3 +1693,634 @@ return myFunc { x: 1 }
 	}
 	t.Errorf("no E_FN_DUP diagnostic found")
 }
+
+// ===== Strict mode =====
+
+func mustParseAndValidateStrict(t *testing.T, source string, asWarnings bool) []diagnostics.Diagnostic {
+	t.Helper()
+	prog, parseErrs := parser.Parse(source, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	return validator.ValidateWithOptions(prog, validator.Options{Strict: true, StrictAsWarnings: asWarnings})
+}
+
+func TestStrict_DefaultModeIgnoresImplicitValues(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let x = 10
+let r = if (x > 5) {
+  "big"
+}
+return r
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestStrict_FnMissingReturn(t *testing.T) {
+	diags := mustParseAndValidateStrict(t, `
+fn double { x } {
+  x * 2
+}
+return double { x: 2 }
+`, false)
+	assertHasCode(t, diags, diagnostics.ENoReturn)
+}
+
+func TestStrict_IfBlockWithoutElse(t *testing.T) {
+	diags := mustParseAndValidateStrict(t, `
+let x = 10
+let r = if (x > 5) {
+  return "big"
+}
+return r
+`, false)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EIfNoElse)
+}
+
+func TestStrict_ImplicitBlockValue(t *testing.T) {
+	diags := mustParseAndValidateStrict(t, `
+let x = 10
+let r = if (x > 5) {
+  "big"
+} else {
+  return "small"
+}
+return r
+`, false)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EImplicitReturn)
+}
+
+func TestStrict_ExplicitReturnsAccepted(t *testing.T) {
+	diags := mustParseAndValidateStrict(t, `
+fn double { x } {
+  return x * 2
+}
+let r = if (true) {
+  return "yes"
+} else {
+  return "no"
+}
+return { r: r, d: double { x: 2 } }
+`, false)
+	assertNoDiags(t, diags)
+}
+
+func TestStrict_StatementIfNotFlagged(t *testing.T) {
+	diags := mustParseAndValidateStrict(t, `
+let x = 10
+if (x > 5) {
+  let y = "big"
+}
+return x
+`, false)
+	assertNoDiags(t, diags)
+}
+
+func TestStrict_AsWarnings(t *testing.T) {
+	diags := mustParseAndValidateStrict(t, `
+fn double { x } {
+  x * 2
+}
+return double { x: 2 }
+`, true)
+	assertDiagCount(t, diags, 1)
+	if !diags[0].IsWarning() {
+		t.Errorf("expected warning severity, got %q", diags[0].Severity)
+	}
+	if diagnostics.HasErrors(diags) {
+		t.Errorf("expected no errors when strict findings are warnings")
+	}
+}
+
+// ===== Lint =====
+
+func mustParseAndLint(t *testing.T, source string) []diagnostics.Diagnostic {
+	t.Helper()
+	prog, parseErrs := parser.Parse(source, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	return validator.ValidateWithOptions(prog, validator.Options{Lint: true})
+}
+
+func TestLint_UnusedCapability(t *testing.T) {
+	diags := mustParseAndLint(t, `
+cap { fs.read: true, http.get: true }
+call? fs.read { path: "a.txt" } -> data
+return data
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EUnusedCap)
+	if len(diags) == 1 {
+		if !diags[0].IsWarning() {
+			t.Errorf("expected unused capability to be a warning")
+		}
+		if !strings.Contains(diags[0].Message, "http.get") {
+			t.Errorf("expected message to mention 'http.get', got: %s", diags[0].Message)
+		}
+	}
+}
+
+func TestLint_CapabilityUsedViaAliasTool(t *testing.T) {
+	diags := mustParseAndLint(t, `
+cap { fs.read: true }
+call? fs.exists { path: "a.txt" } -> found
+return found
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestLint_CapabilityUsedInFnBody(t *testing.T) {
+	diags := mustParseAndLint(t, `
+cap { sh.exec: true }
+fn run { cmd } {
+  do sh.exec { cmd: cmd } -> out
+  return out
+}
+return run { cmd: "ls" }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestLint_DisabledByDefault(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { fs.read: true }
+return 1
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestInvalid_FsTempRequiresFsWrite(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { fs.read: true }
+do fs.temp { data: "x" } -> tmp
+return tmp
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EUndeclaredCap)
+}
+
+func TestValid_ArchiveTools(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { fs.read: true, fs.write: true }
+do archive.zip { files: ["dist"], to: "out/dist.zip" } -> zipped
+do archive.unzip { from: zipped.path, to: "unpacked" } -> unpacked
+return unpacked
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestInvalid_ArchiveZipRequiresFsRead(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { fs.write: true }
+do archive.zip { files: ["dist"], to: "dist.zip" } -> zipped
+return zipped
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EUndeclaredCap)
+}
+
+func TestValid_FsHashWithBytesReadBudget(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { fs.read: true }
+budget { maxBytesRead: 1048576 }
+call? fs.hash { path: "download.tgz", alg: "sha256" } -> sum
+return sum.digest
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestValid_TimeSleep(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { time.sleep: true }
+call? time.sleep { ms: 100 } -> waited
+return waited
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestInvalid_InputPromptIsEffect(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { interactive: true }
+call? input.prompt { message: "Continue?" } -> answer
+return answer
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.ECallEffect)
+}
+
+func TestValid_NotifyTools(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { notify: true }
+do notify.webhook { url: "https://hooks.example.com/x", payload: { ok: true } } -> hook
+do notify.slack { channel: "#ops", text: "done" } -> msg
+return { hook: hook, msg: msg }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestValid_KVTools(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { kv: true }
+call? kv.get { key: "cursor", default: 0 } -> cursor
+do kv.set { key: "cursor", value: cursor + 1 } -> saved
+do kv.delete { key: "stale" } -> removed
+return { saved: saved, removed: removed }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestValid_S3Tools(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { s3.read: true, s3.write: true }
+call? s3.list { bucket: "artifacts", prefix: "runs/" } -> listing
+call? s3.get { bucket: "artifacts", key: "runs/last.txt" } -> last
+do s3.put { bucket: "artifacts", key: "runs/next.txt", data: "ok" } -> put
+return { listing: listing, last: last, put: put }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestInvalid_S3PutWithCall(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { s3.write: true }
+call? s3.put { bucket: "artifacts", key: "k", data: "ok" } -> put
+return { put: put }
+`)
+	assertHasCode(t, diags, diagnostics.ECallEffect)
+}
+
+// ===== Null safety =====
+
+func mustParseAndValidateNullSafe(t *testing.T, source string) []diagnostics.Diagnostic {
+	t.Helper()
+	prog, parseErrs := parser.Parse(source, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	return validator.ValidateWithOptions(prog, validator.Options{NullSafety: true})
+}
+
+func countCode(diags []diagnostics.Diagnostic, code string) int {
+	n := 0
+	for _, d := range diags {
+		if d.Code == code {
+			n++
+		}
+	}
+	return n
+}
+
+func TestNullSafety_OffByDefault(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let x = null
+return x + 1
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestNullSafety_OmittedParamInArithmetic(t *testing.T) {
+	diags := mustParseAndValidateNullSafe(t, `
+fn area { w, h } {
+  return w * h
+}
+let a = area { w: 2 }
+return a
+`)
+	if n := countCode(diags, diagnostics.ENullable); n != 1 {
+		t.Fatalf("expected 1 E_NULLABLE warning for h, got %d: %v", n, diags)
+	}
+	if diags[0].Severity != diagnostics.SeverityWarning || diags[0].Span.StartCol != 14 {
+		t.Errorf("expected a warning on h, got %+v", diags[0])
+	}
+}
+
+func TestNullSafety_AllParamsGiven(t *testing.T) {
+	diags := mustParseAndValidateNullSafe(t, `
+fn area { w, h } {
+  return w * h
+}
+return area { w: 2, h: 3 }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestNullSafety_IndexIntoToolArg(t *testing.T) {
+	diags := mustParseAndValidateNullSafe(t, `
+cap { fs.read: true }
+let paths = ["a.txt"]
+let p = paths[0]
+let text = call? fs.read { path: p }
+return text
+`)
+	if n := countCode(diags, diagnostics.ENullable); n != 1 {
+		t.Fatalf("expected 1 E_NULLABLE warning, got %d: %v", n, diags)
+	}
+	if !strings.Contains(diags[0].Message, "'path' of fs.read") {
+		t.Errorf("unexpected message: %s", diags[0].Message)
+	}
+}
+
+func TestNullSafety_NarrowingAndCoalesce(t *testing.T) {
+	diags := mustParseAndValidateNullSafe(t, `
+let s = "abc"
+let c = s[5]
+let a = if { cond: c != null, then: c + "!", else: "" }
+let b = if (c) {
+  return c + "?"
+} else {
+  return ""
+}
+let d = coalesce { in: c, default: "" } + "."
+return { a: a, b: b, d: d }
+`)
+	assertNoDiags(t, diags)
+}
+
+func TestHostFns(t *testing.T) {
+	src := `
+let s = summarize { text: "a long story" }
+return s
+`
+	prog, parseErrs := parser.Parse(src, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	assertHasCode(t, validator.Validate(prog), diagnostics.EUnknownFn)
+
+	opts := validator.Options{HostFns: map[string]bool{"summarize": true}}
+	assertNoDiags(t, validator.ValidateWithOptions(prog, opts))
+
+	prog, _ = parser.Parse(`
+fn summarize { text } {
+  return text
+}
+return summarize { text: "x" }
+`, "test.a0")
+	assertHasCode(t, validator.ValidateWithOptions(prog, opts), diagnostics.EFnDup)
+}
+
+// ===== Record keys =====
+
+func TestRecordKeys_DuplicateKeyWarns(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let r = { a: 1, b: 2, a: 3 }
+return r
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EDupKey)
+	if len(diags) == 1 && !diags[0].IsWarning() {
+		t.Errorf("expected duplicate key to be a warning")
+	}
+}
+
+func TestRecordKeys_SpreadOverridesEarlierKey(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let base = { mode: "fast", retries: 3 }
+let r = { mode: "safe", ...base }
+return r
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.ESpreadOverride)
+}
+
+func TestRecordKeys_OverrideAfterSpreadIsFine(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+let base = { mode: "fast", retries: 3 }
+let other = { ...base, mode: "safe" }
+return { ...other, mode: "slow" }
+`)
+	assertNoDiags(t, diags)
+}
+
+// ===== Shadowing =====
+
+func TestLint_LetShadowsOuterBinding(t *testing.T) {
+	diags := mustParseAndLint(t, `
+let total = 0
+let xs = for { in: [1, 2], as: "n" } {
+  let total = n * 2
+  return total
+}
+return xs
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EShadow)
+}
+
+func TestLint_LetShadowsFnParam(t *testing.T) {
+	diags := mustParseAndLint(t, `
+fn scale { x } {
+  let ys = for { in: [1, 2], as: "n" } {
+    let x = n
+    return x
+  }
+  return ys
+}
+return scale { x: 3 }
+`)
+	assertDiagCount(t, diags, 1)
+	if len(diags) == 1 && !strings.Contains(diags[0].Message, "parameter") {
+		t.Errorf("expected message to mention the parameter, got: %s", diags[0].Message)
+	}
+}
+
+func TestLint_ShadowCanBeDisabled(t *testing.T) {
+	prog, parseErrs := parser.Parse(`
+let total = 0
+let xs = for { in: [1, 2], as: "n" } {
+  let total = n * 2
+  return total
+}
+return xs
+`, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	diags := validator.ValidateWithOptions(prog, validator.Options{
+		Lint:          true,
+		DisabledLints: map[string]bool{diagnostics.EShadow: true},
+	})
+	assertNoDiags(t, diags)
+}
+
+// ===== Dead branches =====
+
+func TestLint_LiteralIfCondition(t *testing.T) {
+	diags := mustParseAndLint(t, `
+let a = if { cond: true, then: 1, else: 2 }
+let b = if (false) { return 1 } else { return 2 }
+return a + b
+`)
+	assertDiagCount(t, diags, 2)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EDeadBranch)
+	assertDiagCodeAt(t, diags, 1, diagnostics.EDeadBranch)
+}
+
+func TestLint_IterationOverEmptyListLiteral(t *testing.T) {
+	diags := mustParseAndLint(t, `
+let xs = for { in: [], as: "n" } { return n }
+let ys = filter { in: [], as: "n" } { return n > 1 }
+return { xs: xs, ys: ys }
+`)
+	assertDiagCount(t, diags, 2)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EDeadBranch)
+}
+
+func TestLint_NonLiteralConditionIsFine(t *testing.T) {
+	diags := mustParseAndLint(t, `
+let n = 3
+let a = if { cond: n > 1, then: 1, else: 2 }
+let xs = for { in: [n], as: "x" } { return x }
+return { a: a, xs: xs }
+`)
+	assertNoDiags(t, diags)
+}
+
+// ===== Float equality =====
+
+func TestLint_FloatEqualityOnArithmetic(t *testing.T) {
+	diags := mustParseAndLint(t, `
+let a = 3
+let b = 4
+let ratio = a / b
+let sum = 0.1 + 0.2
+let x = sum == 0.3
+let y = ratio != 0.75
+let z = -(a * 1.5) == 4.5
+return { x: x, y: y, z: z }
+`)
+	assertDiagCount(t, diags, 3)
+	for i := range diags {
+		assertDiagCodeAt(t, diags, i, diagnostics.EFloatEq)
+	}
+}
+
+func TestLint_IntegerEqualityIsFine(t *testing.T) {
+	diags := mustParseAndLint(t, `
+let a = 3
+let total = a * 2 + 1
+let half = 0.5
+return { x: total == 7, y: half == 0.5, z: a % 2 != 0 }
+`)
+	assertNoDiags(t, diags)
+}
+
+// ===== Budget header checks =====
+
+func TestBudget_UnknownFieldSuggestsSpelling(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+budget { timeMS: 1000 }
+return "ok"
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EUnknownBudget)
+	if len(diags) == 1 && !strings.Contains(diags[0].Message, "did you mean 'timeMs'") {
+		t.Errorf("expected a spelling suggestion, got: %s", diags[0].Message)
+	}
+}
+
+func TestBudget_NegativeAndDuplicateFields(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+budget { maxToolCalls: -1, maxSteps: 10, maxSteps: 20 }
+return "ok"
+`)
+	assertDiagCount(t, diags, 2)
+	for _, want := range []string{"must not be negative", "duplicate budget field 'maxSteps'"} {
+		found := false
+		for _, d := range diags {
+			found = found || strings.Contains(d.Message, want)
+		}
+		if !found {
+			t.Errorf("expected a diagnostic containing %q", want)
+		}
+	}
+}
+
+func TestMeta_FieldsChecked(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+meta { name: "sync", version: 2, tags: "x", name: "again" }
+meta { author: "ops" }
+return "ok"
+`)
+	for _, want := range []string{"'version' must be a string literal", "unknown meta field 'tags'", "duplicate meta field 'name'", "duplicate meta declaration"} {
+		found := false
+		for _, d := range diags {
+			found = found || (d.Code == diagnostics.EAst && strings.Contains(d.Message, want))
+		}
+		if !found {
+			t.Errorf("expected a diagnostic containing %q", want)
+		}
+	}
+}
+
+func TestBudget_ZeroIterationsWarns(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+budget { maxIterations: 0 }
+return "ok"
+`)
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, diagnostics.EBudgetZero)
+	if len(diags) == 1 && !diags[0].IsWarning() {
+		t.Errorf("expected a zero budget to be a warning")
+	}
+}
+
+// ===== Cap header values =====
+
+func TestCapValue_FalseDeclaresNothing(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { sh.exec: false }
+do sh.exec { cmd: "ls" } -> out
+return out
+`)
+	assertHasCode(t, diags, diagnostics.EUndeclaredCap)
+	assertHasCode(t, diags, diagnostics.ECapValue)
+}
+
+func TestCapValue_SpreadIsAnError(t *testing.T) {
+	diags := mustParseAndValidate(t, `
+cap { ...{ fs.read: true } }
+return "ok"
+`)
+	assertHasCode(t, diags, diagnostics.ECapValue)
+	if !diagnostics.HasErrors(diags) {
+		t.Errorf("expected a spread in cap { ... } to be an error")
+	}
+}
+
+// ===== Custom passes =====
+
+func TestPass_ReportsCustomDiagnostics(t *testing.T) {
+	approved := map[string]bool{"fs.read": true}
+	pass := validator.PassFunc(func(program *ast.Program, module bool) []diagnostics.Diagnostic {
+		var diags []diagnostics.Diagnostic
+		for _, stmt := range program.Statements {
+			ast.Inspect(stmt, func(n ast.Node) bool {
+				if do, ok := n.(*ast.DoExpr); ok {
+					if name := strings.Join(do.Tool.Parts, "."); !approved[name] {
+						diags = append(diags, diagnostics.MakeDiag("E_ORG_TOOL", "tool '"+name+"' is not approved", &do.Span, ""))
+					}
+				}
+				return true
+			})
+		}
+		return diags
+	})
+	prog, parseErrs := parser.Parse(`
+cap { fs.write: true }
+do fs.write { path: "out.txt", data: "hi" } -> w
+return w
+`, "test.a0")
+	if len(parseErrs) > 0 {
+		t.Fatalf("unexpected parse error: %s", parseErrs[0].Message)
+	}
+	diags := validator.ValidateWithOptions(prog, validator.Options{Passes: []validator.Pass{pass}})
+	assertDiagCount(t, diags, 1)
+	assertDiagCodeAt(t, diags, 0, "E_ORG_TOOL")
+	if !diagnostics.HasErrors(diags) {
+		t.Errorf("expected a custom error diagnostic to count as an error")
+	}
+}